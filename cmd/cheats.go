@@ -0,0 +1,101 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/nevisdale/nestic/internal/cheats"
+	"github.com/nevisdale/nestic/internal/config"
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// cheatList manages the cheat list of the game the frontends apply:
+//
+//	nestic cheats [flags] game.nes [list]
+//	nestic cheats [flags] game.nes add CODE [NAME]
+//	nestic cheats [flags] game.nes enable|disable|remove N
+//	nestic cheats [flags] game.nes on-write|every-frame N
+//
+// The code is a Game Genie code or a raw RAM code AAAA:VV, the RAM code
+// freezes the address before every frame or on the CPU writes too.
+// The cheats are numbered from 1 in the list
+func cheatList(args []string) error {
+	flags := flag.NewFlagSet("cheats", flag.ExitOnError)
+	c := config.Default()
+	if err := c.Parse(flags, args); err != nil {
+		if err == config.ErrPrinted {
+			return nil
+		}
+		return err
+	}
+	if flags.NArg() < 1 {
+		return fmt.Errorf("usage: nestic cheats [flags] game.nes [list | add CODE [NAME] | enable N | disable N | remove N | on-write N | every-frame N]")
+	}
+	cart, err := nes.NewCartFromFile(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("couldn't load the ROM: %s", err)
+	}
+	dir := c.Paths.Cheats
+	if dir == "" {
+		if dir, err = cheats.DefaultDir(); err != nil {
+			return err
+		}
+	}
+	path := filepath.Join(dir, cheats.ListName(filepath.Base(flags.Arg(0)), cart.CRC()))
+	list, err := cheats.LoadList(path)
+	if err != nil {
+		return fmt.Errorf("couldn't load the cheats: %s", err)
+	}
+
+	command, rest := "list", flags.Args()[1:]
+	if len(rest) > 0 {
+		command, rest = rest[0], rest[1:]
+	}
+	switch command {
+	case "list":
+		for i, cheat := range list.Cheats {
+			state, freeze := "off", ""
+			if cheat.Enabled {
+				state = "on"
+			}
+			if cheats.IsRAMCode(cheat.Code) {
+				freeze = "every-frame"
+				if cheat.OnWrite {
+					freeze = "on-write"
+				}
+			}
+			fmt.Printf("%d\t%s\t%s\t%s\t%s\n", i+1, state, cheat.Code, freeze, cheat.Name)
+		}
+		return nil
+	case "add":
+		if len(rest) < 1 {
+			return fmt.Errorf("usage: nestic cheats game.nes add CODE [NAME]")
+		}
+		err = list.Add(rest[0], strings.Join(rest[1:], " "))
+	case "enable", "disable", "remove", "on-write", "every-frame":
+		if len(rest) != 1 {
+			return fmt.Errorf("usage: nestic cheats game.nes %s N", command)
+		}
+		n, convErr := strconv.Atoi(rest[0])
+		if convErr != nil || n < 1 || n > len(list.Cheats) {
+			return fmt.Errorf("no cheat %s", rest[0])
+		}
+		switch command {
+		case "remove":
+			err = list.Remove(n - 1)
+		case "on-write", "every-frame":
+			err = list.SetOnWrite(n-1, command == "on-write")
+		default:
+			err = list.SetEnabled(n-1, command == "enable")
+		}
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+	if err != nil {
+		return err
+	}
+	return list.Save(path)
+}
@@ -0,0 +1,105 @@
+// chrtool extracts the CHR banks of a ROM to PNG sheets
+// and imports the edited sheets back.
+//
+//	chrtool extract -rom game.nes -out dir
+//	chrtool import -rom game.nes -bank 0 -png bank00.png -out patched.nes
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "extract":
+		err = extract(os.Args[2:])
+	case "import":
+		err = importSheet(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: chrtool extract|import [flags]\n")
+	os.Exit(2)
+}
+
+func extract(args []string) error {
+	flags := flag.NewFlagSet("extract", flag.ExitOnError)
+	romPath := flags.String("rom", "", "path to the ROM file")
+	outDir := flags.String("out", ".", "directory to write the sheets to")
+	flags.Parse(args)
+
+	cart, err := nes.NewCartFromFile(*romPath)
+	if err != nil {
+		return fmt.Errorf("couldn't load the ROM: %s", err)
+	}
+	for bank := 0; bank < cart.CHRBanks(); bank++ {
+		img, err := cart.CHRSheet(bank)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(*outDir, fmt.Sprintf("bank%02d.png", bank))
+		file, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("couldn't create the file: %s", err)
+		}
+		if err := png.Encode(file, img); err != nil {
+			file.Close()
+			return fmt.Errorf("couldn't encode the sheet: %s", err)
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("couldn't write the sheet: %s", err)
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
+
+func importSheet(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	romPath := flags.String("rom", "", "path to the ROM file")
+	bank := flags.Int("bank", 0, "CHR bank to replace")
+	pngPath := flags.String("png", "", "path to the edited sheet")
+	outPath := flags.String("out", "", "path to the patched ROM, the ROM itself if empty")
+	flags.Parse(args)
+
+	cart, err := nes.NewCartFromFile(*romPath)
+	if err != nil {
+		return fmt.Errorf("couldn't load the ROM: %s", err)
+	}
+
+	file, err := os.Open(*pngPath)
+	if err != nil {
+		return fmt.Errorf("couldn't open the sheet: %s", err)
+	}
+	img, err := png.Decode(file)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("couldn't decode the sheet: %s", err)
+	}
+
+	if err := cart.ImportCHRSheet(*bank, img); err != nil {
+		return err
+	}
+	if *outPath == "" {
+		*outPath = *romPath
+	}
+	return cart.Save(*outPath)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nevisdale/nestic/internal/audio"
+	"github.com/nevisdale/nestic/internal/coverage"
+	"github.com/nevisdale/nestic/internal/input"
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/profiler"
+	"github.com/nevisdale/nestic/internal/symbols"
+)
+
+// headless runs the console without a window or an audio device:
+//
+//	nestic headless [flags] game.nes
+//
+// It runs the frames with the scripted or the movie input as fast as it can
+// and dumps the results, e.g. for the CI checks of the game behavior
+func headless(args []string) error {
+	flags := flag.NewFlagSet("headless", flag.ExitOnError)
+	frames := flags.Int("frames", 0, "frames to run, 0: the length of the movie")
+	scriptPath := flags.String("input-script", "", "feed the controllers from the script file, .json or .csv")
+	moviePath := flags.String("play-movie", "", "play the movie file, .fm2: FCEUX movie")
+	fourScore := flags.Bool("four-score", false, "plug in the Four Score for the controllers 3 and 4")
+	printHash := flags.Bool("hash", false, "print the hash of the last frame")
+	screenshotPath := flags.String("screenshot", "", "save the last frame as a PNG file")
+	ramPath := flags.String("dump-ram", "", "save the 2 KB of the work RAM after the last frame")
+	wavPath := flags.String("wav", "", "save the sound as a WAV file")
+	tracePath := flags.String("trace", "", "write the trace log of the CPU instructions to the file")
+	symbolsPath := flags.String("symbols", "", "the labels of the trace log, the profile and the coverage, .nl, .mlb or .dbg, without it the files next to the ROM are read")
+	traceFormat := flags.String("trace-format", "mesen", "the format of the trace log: mesen, fceux or a template, e.g. \"[PC,4h] [Disassembly][Align,24] A:[A,2h]\"")
+	profilePath := flags.String("profile", "", "write the CPU cycles by the PRG bank and by the labeled function to the file, .csv: CSV")
+	profileSort := flags.String("profile-sort", "cycles", "the order of the profile: cycles, name or address")
+	profileBank := flags.Int("profile-bank-size", profiler.DefaultBankSize, "the size of the PRG banks of the profile in bytes")
+	cdlPath := flags.String("cdl", "", "the code/data log of the PRG ROM, the FCEUX .cdl file: the run adds to the existing file, so the coverage spans the runs")
+	coveragePath := flags.String("coverage", "", "write the coverage of the PRG ROM by the code/data log to the file, .json: JSON, else HTML")
+	coverageBank := flags.Int("coverage-bank-size", coverage.DefaultBankSize, "the size of the PRG banks of the coverage in bytes")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: nestic headless [flags] game.nes")
+	}
+
+	cart, err := nes.NewCartFromFile(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("couldn't load the ROM: %s", err)
+	}
+	console := nes.NewBus()
+	console.SetFourScore(*fourScore)
+	console.LoadCart(cart)
+	console.Reset()
+
+	var script input.Source
+	switch {
+	case *scriptPath != "" && *moviePath != "":
+		return fmt.Errorf("both the input script and the movie are given")
+	case *scriptPath != "":
+		if script, err = input.LoadScript(*scriptPath); err != nil {
+			return fmt.Errorf("couldn't load the input script: %s", err)
+		}
+	case *moviePath != "":
+		m, err := nes.LoadMovie(*moviePath)
+		if err == nil {
+			err = console.PlayMovie(m, true)
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't play the movie: %s", err)
+		}
+		if *frames == 0 {
+			*frames = len(m.Frames)
+		}
+	}
+	if *frames <= 0 {
+		return fmt.Errorf("no frames to run, set -frames")
+	}
+	sortKey, err := profiler.ParseSortKey(*profileSort)
+	if err != nil {
+		return err
+	}
+	var table *symbols.Table
+	if *tracePath != "" || *profilePath != "" || *coveragePath != "" {
+		if *symbolsPath != "" {
+			table, err = symbols.Load(*symbolsPath)
+		} else {
+			table, err = symbols.LoadGame(flags.Arg(0))
+		}
+		if err != nil {
+			return fmt.Errorf("couldn't load the symbols: %s", err)
+		}
+		console.SetSymbols(table)
+	}
+	if *tracePath != "" {
+		format, err := nes.ParseTraceFormat(*traceFormat)
+		if err != nil {
+			return err
+		}
+		f, err := os.Create(*tracePath)
+		if err != nil {
+			return fmt.Errorf("couldn't create the trace log: %s", err)
+		}
+		defer f.Close()
+		console.StartTrace(f, format)
+	}
+	console.SetCycleProfiling(*profilePath != "")
+	console.SetCodeDataLogging(*cdlPath != "" || *coveragePath != "")
+	if *cdlPath != "" {
+		err := console.LoadCodeDataLog(*cdlPath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("couldn't load the code/data log: %s", err)
+		}
+	}
+
+	var sound []float32
+	samples := make([]float32, 4096)
+	for frame := 0; frame < *frames; frame++ {
+		var buttons [4]nes.Button
+		if script != nil {
+			buttons = script.Input(frame)
+		}
+		console.SetInput(buttons)
+		console.RunFrame()
+
+		// the samples are read every frame, so the buffer never overflows
+		for n := console.APU().ReadSamples(samples); n > 0; n = console.APU().ReadSamples(samples) {
+			if *wavPath != "" {
+				sound = append(sound, samples[:n]...)
+			}
+		}
+	}
+
+	if err := console.StopTrace(); err != nil {
+		return fmt.Errorf("couldn't write the trace log: %s", err)
+	}
+	if *profilePath != "" {
+		report := profiler.NewReport(console.CycleProfile(), table, *profileBank)
+		report.Sort(sortKey)
+		if err := saveProfile(*profilePath, report); err != nil {
+			return fmt.Errorf("couldn't save the profile: %s", err)
+		}
+	}
+	if *cdlPath != "" {
+		if err := console.SaveCodeDataLog(*cdlPath); err != nil {
+			return fmt.Errorf("couldn't save the code/data log: %s", err)
+		}
+	}
+	if *coveragePath != "" {
+		report := coverage.NewReport(console.CodeDataLog(), table, *coverageBank)
+		if err := saveCoverage(*coveragePath, report); err != nil {
+			return fmt.Errorf("couldn't save the coverage: %s", err)
+		}
+	}
+	if *printHash {
+		fmt.Printf("%016x\n", console.PPU().FrameHash())
+	}
+	if *screenshotPath != "" {
+		if err := console.SaveFramePNG(*screenshotPath); err != nil {
+			return fmt.Errorf("couldn't save the screenshot: %s", err)
+		}
+	}
+	if *ramPath != "" {
+		ram := make([]byte, 0x800)
+		for addr := range ram {
+			ram[addr] = console.RAM().Read8(uint16(addr))
+		}
+		if err := os.WriteFile(*ramPath, ram, 0o644); err != nil {
+			return fmt.Errorf("couldn't save the RAM: %s", err)
+		}
+	}
+	if *wavPath != "" {
+		if err := saveWAV(*wavPath, sound); err != nil {
+			return fmt.Errorf("couldn't save the sound: %s", err)
+		}
+	}
+	return nil
+}
+
+// saveProfile writes the report to the file, as CSV for .csv
+func saveProfile(path string, report *profiler.Report) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("couldn't create the file: %s", err)
+	}
+	defer file.Close()
+	write := report.Write
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		write = report.WriteCSV
+	}
+	if err := write(file); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// saveCoverage writes the report to the file, as JSON for .json
+func saveCoverage(path string, report *coverage.Report) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("couldn't create the file: %s", err)
+	}
+	defer file.Close()
+	write := report.WriteHTML
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		write = report.WriteJSON
+	}
+	if err := write(file); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// saveWAV writes the mono samples to the WAV file
+func saveWAV(path string, samples []float32) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("couldn't create the file: %s", err)
+	}
+	defer file.Close()
+	if err := audio.WriteWAV(file, samples, nes.DefaultSampleRate, 1); err != nil {
+		return err
+	}
+	return file.Close()
+}
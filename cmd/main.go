@@ -3,19 +3,74 @@ package main
 import (
 	"flag"
 	"fmt"
+	"image"
+	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"time"
 
+	"github.com/nevisdale/nestic/internal/audio"
+	"github.com/nevisdale/nestic/internal/config"
+	"github.com/nevisdale/nestic/internal/frontend"
+	"github.com/nevisdale/nestic/internal/input"
 	"github.com/nevisdale/nestic/internal/nes"
 )
 
 var (
 	romPath string
+	cfg     = config.Default()
+
+	recordMoviePath string
+	playMoviePath   string
+	movieReadWrite  bool
+	movieStatePath  string
+	inputScriptPath string
 )
 
+// frameDuration is the NTSC frame period, 60.0988 frames per second
+const frameDuration = time.Second * 1000 / 60099
+
 func main() {
+	if len(os.Args) > 1 && (os.Args[1] == "play" || os.Args[1] == "headless" || os.Args[1] == "term" || os.Args[1] == "verify" || os.Args[1] == "cheats") {
+		run := play
+		switch os.Args[1] {
+		case "headless":
+			run = headless
+		case "term":
+			run = term
+		case "verify":
+			run = verify
+		case "cheats":
+			run = cheatList
+		}
+		if err := run(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	flag.StringVar(&romPath, "rom", "", "path to the ROM file")
-	flag.Parse()
+	flag.StringVar(&recordMoviePath, "record-movie", "", "record the input from power-on into the movie file, it is saved on exit, .fm2: FCEUX movie")
+	flag.StringVar(&movieStatePath, "record-movie-from-state", "", "with -record-movie, start the movie from the save state file instead of power-on")
+	flag.StringVar(&playMoviePath, "play-movie", "", "play the movie file, .fm2: FCEUX movie")
+	flag.BoolVar(&movieReadWrite, "movie-read-write", false, "record the input after the end of the played movie, it is saved on exit")
+	flag.StringVar(&inputScriptPath, "input-script", "", "feed the controllers from the script file instead of the live input, .json or .csv")
+	// without a window the frames are paced by the clock
+	cfg.Video.FramePacing = "clock"
+	if err := cfg.Parse(flag.CommandLine, os.Args[1:]); err != nil {
+		if err == config.ErrPrinted {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	pacing, err := cfg.FramePacing()
+	if err != nil || pacing == frontend.FramePacingVsync {
+		fmt.Fprintf(os.Stderr, "invalid frame pacing %q\n", cfg.Video.FramePacing)
+		os.Exit(1)
+	}
 
 	cart, err := nes.NewCartFromFile(romPath)
 	if err != nil {
@@ -23,13 +78,150 @@ func main() {
 		os.Exit(1)
 	}
 
-	nes := nes.NewBus()
-	nes.LoadCart(cart)
-	nes.Reset()
+	console := nes.NewBus()
+	if err := cfg.Apply(console); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	console.LoadCart(cart)
+	console.Reset()
+
+	// the movie to save on exit
+	var movie *nes.Movie
+	moviePath := recordMoviePath
+	switch {
+	case recordMoviePath != "" && movieStatePath != "":
+		err := console.LoadStateFile(movieStatePath)
+		if err == nil {
+			movie, err = console.RecordMovieFromState()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "couldn't record the movie: %s\n", err)
+			os.Exit(1)
+		}
+		movie.ROMName = filepath.Base(romPath)
+	case recordMoviePath != "":
+		movie = console.RecordMovie()
+		movie.ROMName = filepath.Base(romPath)
+	case playMoviePath != "":
+		m, err := nes.LoadMovie(playMoviePath)
+		if err == nil {
+			err = console.PlayMovie(m, !movieReadWrite)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "couldn't play the movie: %s\n", err)
+			os.Exit(1)
+		}
+		if movieReadWrite {
+			movie, moviePath = m, playMoviePath
+		}
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	audioBuffer := cfg.Audio.Buffer
+	var autoBuffer *frontend.AutoBuffer
+	if cfg.Audio.AutoBuffer {
+		autoBuffer = frontend.NewAutoBuffer()
+		audioBuffer = autoBuffer.Size()
+	}
+	player, err := audio.NewPlayer(console.APU(), audio.Options{
+		SampleRate: nes.DefaultSampleRate,
+		Channels:   cfg.Channels(),
+		BufferSize: audioBuffer,
+	})
+	// samples kept in the buffer: the device buffer and a frame of slack
+	bufferTarget := int((audioBuffer + cart.Region().FrameDuration()).Seconds() * nes.DefaultSampleRate)
+	audioPacing := pacing == frontend.FramePacingAudio
+	if err != nil {
+		log.Printf("audio is disabled: %s\n", err)
+		audioPacing = false
+		autoBuffer = nil
+	} else {
+		defer player.Close()
+		if !audioPacing {
+			console.APU().SetRateControl(bufferTarget)
+		}
+	}
 
-	for {
-		nes.Tic()
-		time.Sleep(time.Second / 60)
+	gamepads := input.DefaultGamepadConfig()
+	if cfg.Input.GamepadConfig != "" {
+		gamepads, err = input.LoadGamepadConfig(cfg.Input.GamepadConfig)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "couldn't load the gamepad config: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	turbo, err := input.ParseTurboRate(cfg.Input.TurboRate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	// the scripted input replaces the live input
+	var script input.Source
+	if inputScriptPath != "" {
+		script, err = input.LoadScript(inputScriptPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "couldn't load the input script: %s\n", err)
+			os.Exit(1)
+		}
 	}
+	joysticks := input.OpenJoysticks()
+	defer joysticks.Close()
+	game := filepath.Base(romPath)
+
+	frameDone := false
+	console.PPU().OnFrame(func(*image.RGBA) {
+		frameDone = true
+	})
+	// the frames are paced at the rate of the TV system of the game
+	limiter := frontend.NewLimiter(cart.Region().FrameDuration())
+	for frame := 0; ; frame++ {
+		var buttons [4]nes.Button
+		if script != nil {
+			buttons = script.Input(frame)
+		} else {
+			pads := joysticks.Pads()
+			held, turboButtons := gamepads.Buttons(game, pads), gamepads.TurboButtons(game, pads)
+			for port := range buttons {
+				buttons[port] = turbo.Apply(held[port], turboButtons[port])
+			}
+		}
+		console.SetInput(buttons)
+		turbo.Tic()
 
+		for !frameDone {
+			console.Tic()
+		}
+		frameDone = false
+
+		select {
+		case <-interrupt:
+			if movie != nil {
+				if err := movie.Save(moviePath); err != nil {
+					fmt.Fprintf(os.Stderr, "couldn't save the movie: %s\n", err)
+					os.Exit(1)
+				}
+			}
+			return
+		default:
+		}
+
+		if autoBuffer != nil && autoBuffer.Update(player.Underruns()) {
+			// the device buffer stays, more samples wait for it
+			bufferTarget = int((autoBuffer.Size() + cart.Region().FrameDuration()).Seconds() * nes.DefaultSampleRate)
+			if !audioPacing {
+				console.APU().SetRateControl(bufferTarget)
+			}
+			log.Printf("the sound broke up, the audio buffer is %s\n", autoBuffer.Size())
+		}
+		if audioPacing {
+			// the audio device consumes the samples at its own rate
+			for console.APU().BufferedSamples() > bufferTarget {
+				time.Sleep(time.Millisecond)
+			}
+			continue
+		}
+		limiter.Wait()
+	}
 }
@@ -0,0 +1,110 @@
+//go:build sdl
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/frontend"
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// audio queues the samples of every frame on the audio device.
+// The queue is kept at about the buffer size, the frames run
+// when it falls below
+type audio struct {
+	apu     *nes.APU
+	device  sdl.AudioDeviceID
+	target  uint32 // the queue size in bytes
+	samples []float32
+	bytes   []byte
+	frame   uint32 // the bytes of a sample, 4 per channel
+
+	auto      *frontend.AutoBuffer // nil: the buffer size is fixed
+	started   bool                 // the queue had the samples
+	underruns uint64               // the times the queue ran dry
+}
+
+func newAudio(apu *nes.APU, buffer time.Duration) (*audio, error) {
+	channels := uint8(1)
+	if apu.Stereo() {
+		channels = 2
+	}
+	want := sdl.AudioSpec{
+		Freq:     nes.DefaultSampleRate,
+		Format:   sdl.AUDIO_F32LSB,
+		Channels: channels,
+		Samples:  512,
+	}
+	device, err := sdl.OpenAudioDevice("", false, &want, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open the audio device: %s", err)
+	}
+	a := &audio{
+		apu:     apu,
+		device:  device,
+		frame:   4 * uint32(channels),
+		samples: make([]float32, nes.DefaultSampleRate/10*int(channels)),
+	}
+	a.setBuffer(buffer)
+	sdl.PauseAudioDevice(device, false)
+	return a, nil
+}
+
+// setBuffer sets the queue size
+func (a *audio) setBuffer(buffer time.Duration) {
+	a.target = uint32(buffer.Seconds()*nes.DefaultSampleRate) * a.frame
+}
+
+// tune grows the automatic buffer while the sound breaks up,
+// and reports whether it grew. The underruns count only while the sound plays
+func (a *audio) tune(playing bool) bool {
+	if a.auto == nil {
+		return false
+	}
+	if !playing {
+		a.auto.Settle()
+		return false
+	}
+	if !a.auto.Update(a.underruns) {
+		return false
+	}
+	a.setBuffer(a.auto.Size())
+	return true
+}
+
+// hungry reports whether the queue needs the samples of another frame
+func (a *audio) hungry() bool {
+	waiting := uint32(a.apu.BufferedSamples()) * a.frame
+	return sdl.GetQueuedAudioSize(a.device)+waiting < a.target
+}
+
+// queue moves the produced samples to the device up to the queue size,
+// the rest wait in the APU buffer
+func (a *audio) queue() {
+	queued := sdl.GetQueuedAudioSize(a.device)
+	if queued == 0 && a.started {
+		a.underruns++
+	}
+	room := (int(a.target) - int(queued)) / 4
+	if room <= 0 {
+		return
+	}
+	n := a.apu.ReadSamples(a.samples[:min(room, len(a.samples))])
+	a.bytes = a.bytes[:0]
+	for _, sample := range a.samples[:n] {
+		a.bytes = binary.LittleEndian.AppendUint32(a.bytes, math.Float32bits(sample))
+	}
+	if len(a.bytes) > 0 {
+		sdl.QueueAudio(a.device, a.bytes)
+		a.started = true
+	}
+}
+
+func (a *audio) close() {
+	sdl.CloseAudioDevice(a.device)
+}
@@ -0,0 +1,307 @@
+//go:build sdl
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/config"
+	"github.com/nevisdale/nestic/internal/frontend"
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// instance is a console with its window and its audio stream. Several
+// instances run in one process, e.g. two revisions of a game side by side
+type instance struct {
+	cfg     *config.Config
+	session *frontend.Session
+	window  *window
+	audio   *audio // nil: the sound is disabled
+	hotkeys *frontend.Hotkeys
+	limiter *frontend.Limiter
+	pacing  frontend.FramePacing
+
+	frameDuration time.Duration
+	rateControl   bool // the APU keeps about a frame of the samples waiting for the queue
+
+	quickOpen  frontend.QuickOpen
+	recent     *frontend.RecentROMs
+	recentPath string
+
+	fastToggled bool
+	paused      bool
+}
+
+// newInstance loads the ROM and opens its window and its audio stream.
+// Without the vsync the frames of the vsync mode are paced by the clock
+func newInstance(cfg *config.Config, path string, vsync bool, recent *frontend.RecentROMs, recentPath string) (*instance, error) {
+	cart, err := nes.NewCartFromFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load the ROM: %s", err)
+	}
+	rememberROM(recent, recentPath, path)
+	console := nes.NewBus()
+	if err := cfg.Apply(console); err != nil {
+		return nil, err
+	}
+	console.LoadCart(cart)
+	console.Reset()
+
+	session, err := cfg.NewSession(console, path)
+	if err != nil {
+		return nil, err
+	}
+	pacing, err := cfg.FramePacing()
+	if err != nil {
+		return nil, err
+	}
+	if pacing == frontend.FramePacingVsync && !vsync {
+		pacing = frontend.FramePacingClock
+	}
+	hotkeys, err := cfg.Hotkeys()
+	if err != nil {
+		return nil, err
+	}
+	hotkeys.SetPassThrough(session.KeyboardTakes)
+	shader, err := cfg.Shader()
+	if err != nil {
+		return nil, err
+	}
+	aspect, err := cfg.PixelAspect()
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := newWindow(windowTitle(path), cfg.Video.Scale, cfg.Video.IntegerScale, aspect, pacing == frontend.FramePacingVsync)
+	if err != nil {
+		return nil, err
+	}
+	w.post.Shader = shader
+	w.setFullscreen(cfg.Video.Fullscreen)
+	i := &instance{
+		cfg:           cfg,
+		session:       session,
+		window:        w,
+		hotkeys:       hotkeys,
+		frameDuration: cart.Region().FrameDuration(),
+		quickOpen:     frontend.QuickOpen{Recent: recent},
+		recent:        recent,
+		recentPath:    recentPath,
+	}
+	i.limiter = frontend.NewLimiter(i.frameDuration)
+
+	audioBuffer := cfg.Audio.Buffer
+	if cfg.Audio.AutoBuffer {
+		audioBuffer = frontend.MinAutoBuffer
+	}
+	i.audio, err = newAudio(console.APU(), audioBuffer)
+	if err != nil {
+		log.Printf("audio is disabled: %s\n", err)
+		if pacing == frontend.FramePacingAudio {
+			pacing = frontend.FramePacingClock
+		}
+	} else {
+		if cfg.Audio.AutoBuffer {
+			i.audio.auto = frontend.NewAutoBuffer()
+		}
+		// the display or the clock runs a bit off the audio device, the rate
+		// control keeps about a frame of the samples waiting for the queue
+		if pacing != frontend.FramePacingAudio {
+			i.rateControl = true
+			console.APU().SetRateControl(frameSamples(i.frameDuration))
+		}
+	}
+	i.pacing = pacing
+	return i, nil
+}
+
+// openROM swaps in the ROM file, dropped on the window or quick-opened
+func (i *instance) openROM(path string) {
+	region, ok := loadROM(i.session, path)
+	if !ok {
+		return
+	}
+	rememberROM(i.recent, i.recentPath, path)
+	i.window.window.SetTitle(windowTitle(path))
+	i.frameDuration = region.FrameDuration()
+	if i.rateControl {
+		i.session.Console.APU().SetRateControl(frameSamples(i.frameDuration))
+	}
+	if i.audio != nil {
+		i.audio.tune(false)
+	}
+	i.limiter.Reset()
+}
+
+// step runs the frames due and draws the picture, and reports whether
+// it did. The frames paced by the audio are due when the queue gets low,
+// the frames paced by the clock or the display wait for their time.
+// The input is read once the frame is due
+func (i *instance) step(readInput func(*instance) frontend.HostInput) (bool, error) {
+	session := i.session
+	session.SetFocused(i.focused())
+	paused := i.paused || session.BackgroundPaused()
+	fast := i.fastToggled || i.hotkeys.Held(frontend.HotkeyFastForward)
+	rewinding := i.hotkeys.Held(frontend.HotkeyRewind) && session.RewindEnabled()
+	speed := session.SlowMotion()
+	if fast {
+		speed = 1
+	}
+	fastMute, slowMute := i.cfg.Emulation.FastForwardMute, i.cfg.Emulation.SlowMotionMute
+	pacing := i.pacing
+	muted := fast && fastMute || speed < 1 && slowMute || session.BackgroundMuted() || rewinding
+	if pacing == frontend.FramePacingAudio && (muted || paused) {
+		// the muted sound doesn't fill the audio queue, nor do the pause and the rewind
+		pacing = frontend.FramePacingClock
+	}
+	// the slow motion runs a frame in some of the real time frames
+	run := true
+	switch pacing {
+	case frontend.FramePacingAudio:
+		// the stretched sound of the slow motion fills the queue slower
+		if !i.audio.hungry() {
+			return false, nil
+		}
+	case frontend.FramePacingClock:
+		i.limiter.SetPeriod(time.Duration(float64(i.frameDuration) / speed))
+		i.limiter.Wait()
+	case frontend.FramePacingVsync:
+		// the present waits for the display refresh
+		run = fast || session.SlowDue() > 0
+	}
+
+	w := i.window
+	in := readInput(i)
+	advance := false
+	for _, action := range i.hotkeys.Update(in.Keys) {
+		switch action {
+		case frontend.HotkeyFullscreen:
+			w.setFullscreen(!w.fullscreen())
+		case frontend.HotkeyScaleUp:
+			w.setScale(w.scale + 1)
+		case frontend.HotkeyScaleDown:
+			w.setScale(w.scale - 1)
+		case frontend.HotkeyFastForwardToggle:
+			i.fastToggled = !i.fastToggled
+		case frontend.HotkeySlowMotion:
+			session.SetSlowMotion(frontend.NextSlowMotion(session.SlowMotion()), slowMute)
+		case frontend.HotkeyPause:
+			i.paused = !i.paused
+		case frontend.HotkeyFrameAdvance:
+			// exactly one frame with its sound per keypress
+			i.paused = true
+			advance = true
+		case frontend.HotkeyScreenshot:
+			if path, err := session.SaveScreenshot(i.cfg.ScreenshotOptions()); err != nil {
+				log.Printf("couldn't save the screenshot: %s\n", err)
+			} else {
+				log.Printf("saved the screenshot to %s\n", path)
+			}
+		case frontend.HotkeyVideoRecording:
+			toggleVideoRecording(session, i.cfg.VideoOptions())
+		case frontend.HotkeyQuickOpen:
+			i.quickOpen.Toggle()
+		case frontend.HotkeyMovieReadOnly:
+			session.ToggleMovieReadOnly()
+		case frontend.HotkeyPerfOverlay:
+			session.SetPerfOverlay(!session.PerfOverlay())
+		case frontend.HotkeyShader:
+			w.post.Shader = frontend.NextShader(w.post.Shader)
+			session.OSD.Show("Shader: %s", w.post.Shader)
+		case frontend.HotkeySaveClip:
+			if path, err := session.SaveClip(i.cfg.ClipOptions()); err != nil {
+				log.Printf("couldn't save the clip: %s\n", err)
+			} else {
+				log.Printf("saving the clip to %s\n", path)
+			}
+		case frontend.HotkeySaveState:
+			if _, err := session.SaveState(i.cfg.Paths.States); err != nil {
+				log.Printf("couldn't save the state: %s\n", err)
+			}
+		case frontend.HotkeyLoadState:
+			if err := session.LoadState(i.cfg.Paths.States); err != nil {
+				log.Printf("couldn't load the state: %s\n", err)
+			}
+		case frontend.HotkeyNextStateSlot:
+			session.SetStateSlot(session.StateSlot() + 1)
+			session.ShowStateSlots(i.cfg.Paths.States)
+		case frontend.HotkeyPrevStateSlot:
+			session.SetStateSlot(session.StateSlot() - 1)
+			session.ShowStateSlots(i.cfg.Paths.States)
+		case frontend.HotkeyRewind:
+			if !session.RewindEnabled() {
+				session.OSD.Show("Rewind is off, see -rewind")
+			}
+		}
+	}
+	in.Keys = i.hotkeys.Unbound(in.Keys)
+	if i.quickOpen.Active() {
+		if path := i.quickOpen.Update(in.Keys); path != "" {
+			i.openROM(path)
+		}
+		in.Keys = nil
+	}
+	osd := session.OSD
+	osd.SetIndicator("fast_forward", indicator(fast && !paused, "Fast forward"))
+	osd.SetIndicator("pause", indicator(i.paused, "Paused"))
+	osd.SetIndicator("quick_open", i.quickOpen.Menu())
+	osd.SetIndicator("rewind", indicator(rewinding, "Rewind"))
+	switch {
+	case rewinding:
+		// the past plays back a kept state per frame, without the sound
+		session.Rewind()
+	case paused:
+		if advance {
+			session.RunFrame(in)
+		}
+	case fast:
+		session.RunFast(in, i.cfg.Emulation.FastForwardSpeed, fastMute)
+	case run:
+		session.RunFrame(in)
+	}
+	w.update()
+	if a := i.audio; a != nil {
+		a.queue()
+		if a.tune(!paused && !muted) {
+			osd.Show("Audio buffer: %s", a.auto.Size())
+			log.Printf("the sound broke up, the audio buffer is %s\n", a.auto.Size())
+		}
+	}
+	start := time.Now()
+	if err := w.draw(session.Display()); err != nil {
+		return true, err
+	}
+	session.FrameShown(time.Since(start))
+	return true, nil
+}
+
+// windowID returns the id of the window of the instance
+func (i *instance) windowID() uint32 {
+	id, _ := i.window.window.GetID()
+	return id
+}
+
+// focused reports whether the window of the instance has the keyboard
+func (i *instance) focused() bool {
+	return i.window.window.GetFlags()&sdl.WINDOW_INPUT_FOCUS != 0
+}
+
+func (i *instance) close() {
+	stopVideoRecording(i.session)
+	if err := i.session.AutoSaveState(); err != nil {
+		log.Printf("couldn't auto-save the state: %s\n", err)
+	}
+	if err := i.session.WaitClip(); err != nil {
+		log.Printf("couldn't save the clip: %s\n", err)
+	}
+	if err := i.session.SaveAPULog(); err != nil {
+		log.Printf("couldn't export the APU log: %s\n", err)
+	}
+	if i.audio != nil {
+		i.audio.close()
+	}
+	i.window.close()
+}
@@ -0,0 +1,55 @@
+//go:build sdl
+
+package main
+
+import (
+	"strconv"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// keyNames names the scancodes the way the keymap names the keys
+var keyNames = map[sdl.Scancode]string{
+	sdl.SCANCODE_UP: "ArrowUp", sdl.SCANCODE_DOWN: "ArrowDown",
+	sdl.SCANCODE_LEFT: "ArrowLeft", sdl.SCANCODE_RIGHT: "ArrowRight",
+	sdl.SCANCODE_RETURN: "Enter", sdl.SCANCODE_ESCAPE: "Escape",
+	sdl.SCANCODE_BACKSPACE: "Backspace", sdl.SCANCODE_TAB: "Tab",
+	sdl.SCANCODE_SPACE: "Space", sdl.SCANCODE_CAPSLOCK: "CapsLock",
+	sdl.SCANCODE_LSHIFT: "ShiftLeft", sdl.SCANCODE_RSHIFT: "ShiftRight",
+	sdl.SCANCODE_LCTRL: "ControlLeft", sdl.SCANCODE_RCTRL: "ControlRight",
+	sdl.SCANCODE_LALT: "AltLeft", sdl.SCANCODE_RALT: "AltRight",
+	sdl.SCANCODE_MINUS: "Minus", sdl.SCANCODE_EQUALS: "Equal",
+	sdl.SCANCODE_LEFTBRACKET: "BracketLeft", sdl.SCANCODE_RIGHTBRACKET: "BracketRight",
+	sdl.SCANCODE_BACKSLASH: "Backslash", sdl.SCANCODE_SEMICOLON: "Semicolon",
+	sdl.SCANCODE_APOSTROPHE: "Quote", sdl.SCANCODE_GRAVE: "Backquote",
+	sdl.SCANCODE_COMMA: "Comma", sdl.SCANCODE_PERIOD: "Period", sdl.SCANCODE_SLASH: "Slash",
+	sdl.SCANCODE_INSERT: "Insert", sdl.SCANCODE_DELETE: "Delete",
+	sdl.SCANCODE_HOME: "Home", sdl.SCANCODE_END: "End",
+	sdl.SCANCODE_PAGEUP: "PageUp", sdl.SCANCODE_PAGEDOWN: "PageDown",
+	sdl.SCANCODE_PAUSE: "Pause", sdl.SCANCODE_SCROLLLOCK: "ScrollLock",
+	sdl.SCANCODE_PRINTSCREEN: "PrintScreen",
+}
+
+func init() {
+	for i := 0; i < 26; i++ {
+		keyNames[sdl.SCANCODE_A+sdl.Scancode(i)] = string(rune('A' + i))
+	}
+	// the scancodes of the digits start from 1
+	for i := 0; i < 10; i++ {
+		keyNames[sdl.SCANCODE_1+sdl.Scancode(i)] = "Digit" + string(rune('0'+(i+1)%10))
+	}
+	for i := 0; i < 12; i++ {
+		keyNames[sdl.SCANCODE_F1+sdl.Scancode(i)] = "F" + strconv.Itoa(i+1)
+	}
+}
+
+// pressedKeys returns the names of the pressed keys
+func pressedKeys(dst []string) []string {
+	state := sdl.GetKeyboardState()
+	for scancode, name := range keyNames {
+		if int(scancode) < len(state) && state[scancode] != 0 {
+			dst = append(dst, name)
+		}
+	}
+	return dst
+}
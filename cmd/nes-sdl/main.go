@@ -0,0 +1,252 @@
+//go:build sdl
+
+// Command nes-sdl is the emulator with an SDL2 window, an alternative
+// to the Ebiten frontend for the platforms Ebiten runs poorly on. By default
+// the frames are paced by the audio queue, so the input and the sound go out
+// with about the audio buffer of latency. With -compare a second console
+// runs in its own window with its own sound, e.g. another revision of the game.
+//
+// It needs go-sdl2 with the SDL2 libraries and is built with the sdl build tag:
+//
+//	go build -tags sdl ./cmd/nes-sdl
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/config"
+	"github.com/nevisdale/nestic/internal/frontend"
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+var (
+	romPath     string
+	recentROM   int
+	comparePath string
+	mirrorInput bool
+	cfg         = config.Default()
+)
+
+func init() {
+	// SDL wants the events and the rendering on the main thread
+	runtime.LockOSThread()
+}
+
+func main() {
+	flag.StringVar(&romPath, "rom", "", "path to the ROM file, or the first argument, default: the last opened ROM")
+	flag.IntVar(&recentROM, "recent", 0, "open the recent ROM by its number, 1 is the last opened one")
+	flag.StringVar(&comparePath, "compare", "", "run the second ROM in another window, e.g. another revision of the game side by side")
+	flag.BoolVar(&mirrorInput, "mirror-input", false, "with -compare, feed the input to both windows instead of the one with the focus")
+	// the audio queue paces the frames best, 40ms of it is safe on most systems
+	cfg.Video.FramePacing = "audio"
+	cfg.Audio.Buffer = 40 * time.Millisecond
+	if err := cfg.Parse(flag.CommandLine, os.Args[1:]); err != nil {
+		if err == config.ErrPrinted {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	if romPath == "" {
+		romPath = flag.Arg(0)
+	}
+	recentPath, _ := frontend.RecentROMsPath()
+	recent, _ := frontend.LoadRecentROMs(recentPath)
+	path, err := recent.Resolve(romPath, recentROM)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\nusage: nes-sdl [flags] game.nes\n", err)
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	romPath = path
+
+	if err := run(recent, recentPath); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+// flagSet reports whether the flag is given on the command line
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+func run(recent *frontend.RecentROMs, recentPath string) error {
+	if err := sdl.Init(sdl.INIT_VIDEO | sdl.INIT_AUDIO | sdl.INIT_JOYSTICK); err != nil {
+		return fmt.Errorf("couldn't init SDL: %s", err)
+	}
+	defer sdl.Quit()
+
+	paths := []string{romPath}
+	if comparePath != "" {
+		paths = append(paths, comparePath)
+	}
+	var instances []*instance
+	defer func() {
+		for _, i := range instances {
+			i.close()
+		}
+	}()
+	for n, path := range paths {
+		// two windows waiting for the display refresh would halve the frame rate,
+		// the other windows are paced by the clock
+		i, err := newInstance(cfg, path, n == 0, recent, recentPath)
+		if err != nil {
+			return err
+		}
+		instances = append(instances, i)
+	}
+
+	// the flags given explicitly win over the remembered window
+	w := instances[0].window
+	windowPath, err := frontend.WindowStatePath()
+	if cfg.Video.RememberWindow && err == nil {
+		if state, err := frontend.LoadWindowState(windowPath); err == nil {
+			if flagSet("fullscreen") {
+				state.Fullscreen = cfg.Video.Fullscreen
+			}
+			w.restore(state, !flagSet("scale"))
+		}
+		defer func() {
+			if err := w.state.Save(windowPath); err != nil {
+				log.Printf("couldn't remember the window: %s\n", err)
+			}
+		}()
+	}
+
+	pads := newPads()
+	defer pads.close()
+
+	var keys []string
+	// readInput returns the input of the instance: the keyboard, the mouse
+	// and the pads go to the window with the focus, or to all of them
+	readInput := func(i *instance) frontend.HostInput {
+		if !mirrorInput && !i.focused() && len(instances) > 1 {
+			return frontend.HostInput{}
+		}
+		keys = pressedKeys(keys[:0])
+		x, _, mouse := sdl.GetMouseState()
+		return frontend.HostInput{
+			Keys:      keys,
+			Pads:      pads.state(),
+			MouseX:    i.window.pictureX(int(x)),
+			MouseLeft: mouse&sdl.ButtonLMask() != 0,
+		}
+	}
+	for {
+		for event := sdl.PollEvent(); event != nil; event = sdl.PollEvent() {
+			switch e := event.(type) {
+			case *sdl.QuitEvent:
+				return nil
+			case *sdl.WindowEvent:
+				// closing any of the windows quits
+				if e.Event == sdl.WINDOWEVENT_CLOSE {
+					return nil
+				}
+			case *sdl.JoyDeviceAddedEvent:
+				pads.open(int(e.Which))
+			case *sdl.JoyDeviceRemovedEvent:
+				pads.remove(e.Which)
+			case *sdl.DropEvent:
+				if e.Type != sdl.DROPFILE {
+					break
+				}
+				for _, i := range instances {
+					if i.windowID() == e.WindowID || len(instances) == 1 {
+						i.openROM(e.File)
+					}
+				}
+			}
+		}
+
+		stepped := false
+		for _, i := range instances {
+			ran, err := i.step(readInput)
+			if err != nil {
+				return err
+			}
+			stepped = stepped || ran
+		}
+		if !stepped {
+			sdl.Delay(1)
+		}
+	}
+}
+
+// toggleVideoRecording starts or stops the video recording
+func toggleVideoRecording(session *frontend.Session, videos frontend.VideoOptions) {
+	if session.RecordingVideo() {
+		stopVideoRecording(session)
+		return
+	}
+	if path, err := session.StartVideoRecording(videos); err != nil {
+		log.Printf("couldn't start the video recording: %s\n", err)
+	} else {
+		log.Printf("recording the video to %s\n", path)
+	}
+}
+
+func stopVideoRecording(session *frontend.Session) {
+	if !session.RecordingVideo() {
+		return
+	}
+	if err := session.StopVideoRecording(); err != nil {
+		log.Printf("couldn't finish the video: %s\n", err)
+	} else {
+		log.Printf("finished the video\n")
+	}
+}
+
+// loadROM swaps in the ROM file and returns its TV system
+func loadROM(session *frontend.Session, path string) (nes.Region, bool) {
+	cart, err := nes.NewCartFromFile(path)
+	if err != nil {
+		log.Printf("couldn't load the ROM %s: %s\n", path, err)
+		return 0, false
+	}
+	if err := session.SwapCart(cart, filepath.Base(path)); err != nil {
+		log.Printf("%s\n", err)
+	}
+	log.Printf("loaded %s\n", path)
+	return cart.Region(), true
+}
+
+// frameSamples returns the samples produced per frame
+func frameSamples(frameDuration time.Duration) int {
+	return int(frameDuration.Seconds() * nes.DefaultSampleRate)
+}
+
+// windowTitle returns the title of the window with the game
+func windowTitle(game string) string {
+	return "nestic - " + filepath.Base(game)
+}
+
+// rememberROM puts the opened ROM first in the recent ROMs
+func rememberROM(recent *frontend.RecentROMs, recentPath, path string) {
+	recent.Add(path)
+	if recentPath == "" {
+		return
+	}
+	if err := recent.Save(recentPath); err != nil {
+		log.Printf("couldn't remember the ROM: %s\n", err)
+	}
+}
+
+// indicator returns the text of the indicator while it is on
+func indicator(on bool, text string) string {
+	if on {
+		return text
+	}
+	return ""
+}
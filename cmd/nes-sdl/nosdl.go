@@ -0,0 +1,17 @@
+//go:build !sdl
+
+// Command nes-sdl is the emulator with an SDL2 window. It needs go-sdl2
+// with the SDL2 libraries and is built with the sdl build tag:
+//
+//	go build -tags sdl ./cmd/nes-sdl
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Fprintln(os.Stderr, "built without SDL2 support, rebuild with -tags sdl")
+	os.Exit(1)
+}
@@ -0,0 +1,68 @@
+//go:build sdl
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/nevisdale/nestic/internal/input"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// pads holds the open joysticks, the controllers take them
+// in the order they were connected
+type pads struct {
+	joysticks map[sdl.JoystickID]*sdl.Joystick
+}
+
+func newPads() *pads {
+	return &pads{joysticks: map[sdl.JoystickID]*sdl.Joystick{}}
+}
+
+// open opens the joystick of the device index
+func (p *pads) open(index int) {
+	joystick := sdl.JoystickOpen(index)
+	if joystick == nil {
+		return
+	}
+	p.joysticks[joystick.InstanceID()] = joystick
+}
+
+// remove closes the disconnected joystick
+func (p *pads) remove(id sdl.JoystickID) {
+	if joystick, ok := p.joysticks[id]; ok {
+		joystick.Close()
+		delete(p.joysticks, id)
+	}
+}
+
+// state returns the state of the joysticks
+func (p *pads) state() []input.Pad {
+	ids := make([]sdl.JoystickID, 0, len(p.joysticks))
+	for id := range p.joysticks {
+		ids = append(ids, id)
+	}
+	// the instance ids grow with every connection
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	pads := make([]input.Pad, 0, len(ids))
+	for _, id := range ids {
+		joystick := p.joysticks[id]
+		pad := input.Pad{ID: fmt.Sprint(id), Name: joystick.Name()}
+		for b := 0; b < joystick.NumButtons(); b++ {
+			pad.Buttons = append(pad.Buttons, joystick.Button(b) != 0)
+		}
+		for a := 0; a < joystick.NumAxes(); a++ {
+			pad.Axes = append(pad.Axes, float64(joystick.Axis(a))/32768)
+		}
+		pads = append(pads, pad)
+	}
+	return pads
+}
+
+func (p *pads) close() {
+	for id := range p.joysticks {
+		p.remove(id)
+	}
+}
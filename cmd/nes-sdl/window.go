@@ -0,0 +1,175 @@
+//go:build sdl
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"unsafe"
+
+	"github.com/nevisdale/nestic/internal/frontend"
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// window shows the frames scaled to the window size
+type window struct {
+	window   *sdl.Window
+	renderer *sdl.Renderer
+	texture  *sdl.Texture
+	post     frontend.PostProcessor
+	shaded   *sdl.Texture // the picture scaled up by the post-processor
+	shadedAt int          // the scale of the shaded texture
+
+	integerScale bool
+	scale        int
+	state        frontend.WindowState // the placement out of the fullscreen
+}
+
+func newWindow(title string, scale int, integerScale bool, aspect frontend.PixelAspect, vsync bool) (*window, error) {
+	w := &window{scale: frontend.ClampScale(scale), integerScale: integerScale}
+	w.post.Aspect = aspect
+	size := frontend.WindowSize(w.scale, aspect)
+	var err error
+	w.window, err = sdl.CreateWindow(title, sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED,
+		int32(size.X), int32(size.Y), sdl.WINDOW_SHOWN|sdl.WINDOW_RESIZABLE)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create the window: %s", err)
+	}
+	// without vsync the frames are paced by the audio or the clock
+	var flags uint32 = sdl.RENDERER_ACCELERATED
+	if vsync {
+		flags |= sdl.RENDERER_PRESENTVSYNC
+	}
+	w.renderer, err = sdl.CreateRenderer(w.window, -1, flags)
+	if err != nil {
+		w.close()
+		return nil, fmt.Errorf("couldn't create the renderer: %s", err)
+	}
+	// the bytes of image.RGBA are R, G, B, A, a little endian ABGR pixel
+	w.texture, err = w.renderer.CreateTexture(sdl.PIXELFORMAT_ABGR8888, sdl.TEXTUREACCESS_STREAMING,
+		nes.FrameWidth, nes.FrameHeight)
+	if err != nil {
+		w.close()
+		return nil, fmt.Errorf("couldn't create the texture: %s", err)
+	}
+	w.update()
+	return w, nil
+}
+
+// restore places the window where it was
+func (w *window) restore(state frontend.WindowState, size bool) {
+	if size && state.Width > 0 && state.Height > 0 {
+		w.window.SetSize(int32(state.Width), int32(state.Height))
+	}
+	w.window.SetPosition(int32(state.X), int32(state.Y))
+	w.setFullscreen(state.Fullscreen)
+}
+
+func (w *window) fullscreen() bool {
+	return w.window.GetFlags()&sdl.WINDOW_FULLSCREEN_DESKTOP == sdl.WINDOW_FULLSCREEN_DESKTOP
+}
+
+// setFullscreen switches between the window and the borderless fullscreen
+func (w *window) setFullscreen(fullscreen bool) {
+	var flags uint32
+	if fullscreen {
+		flags = sdl.WINDOW_FULLSCREEN_DESKTOP
+	}
+	w.window.SetFullscreen(flags)
+}
+
+// setScale sizes the window to the multiple of the picture
+func (w *window) setScale(scale int) {
+	w.scale = frontend.ClampScale(scale)
+	if !w.fullscreen() {
+		size := frontend.WindowSize(w.scale, w.post.Aspect)
+		w.window.SetSize(int32(size.X), int32(size.Y))
+	}
+}
+
+// update remembers the placement of the window
+func (w *window) update() {
+	w.state.Fullscreen = w.fullscreen()
+	if !w.state.Fullscreen {
+		x, y := w.window.GetPosition()
+		width, height := w.window.GetSize()
+		w.state.X, w.state.Y = int(x), int(y)
+		w.state.Width, w.state.Height = int(width), int(height)
+	}
+}
+
+// pictureX converts the x in the window to the x in the picture
+func (w *window) pictureX(x int) int {
+	width, height := w.window.GetSize()
+	r := frontend.FitRect(image.Pt(int(width), int(height)), w.integerScale, w.post.Aspect)
+	return (x - r.Min.X) * nes.FrameWidth / max(r.Dx(), 1)
+}
+
+// draw shows the frame
+func (w *window) draw(frame *image.RGBA) error {
+	width, height, err := w.renderer.GetOutputSize()
+	if err != nil {
+		return fmt.Errorf("couldn't get the output size: %s", err)
+	}
+	r := frontend.FitRect(image.Pt(int(width), int(height)), w.integerScale, w.post.Aspect)
+	texture, err := w.picture(frame, r.Dy())
+	if err != nil {
+		return err
+	}
+	dst := &sdl.Rect{X: int32(r.Min.X), Y: int32(r.Min.Y), W: int32(r.Dx()), H: int32(r.Dy())}
+	if err := w.renderer.Clear(); err != nil {
+		return fmt.Errorf("couldn't clear the window: %s", err)
+	}
+	if err := w.renderer.Copy(texture, nil, dst); err != nil {
+		return fmt.Errorf("couldn't draw the frame: %s", err)
+	}
+	w.renderer.Present()
+	return nil
+}
+
+// picture returns the texture of the frame drawn with the height.
+// The picture scaled up by the shader or for the wide pixels is scaled
+// smoothly to the window
+func (w *window) picture(frame *image.RGBA, height int) (*sdl.Texture, error) {
+	scale := frontend.ShaderScale(height)
+	shaded := w.post.Process(frame, scale)
+	if shaded == frame {
+		if err := w.texture.Update(nil, unsafe.Pointer(&frame.Pix[0]), frame.Stride); err != nil {
+			return nil, fmt.Errorf("couldn't update the texture: %s", err)
+		}
+		return w.texture, nil
+	}
+	if w.shaded == nil || w.shadedAt != scale {
+		if w.shaded != nil {
+			w.shaded.Destroy()
+		}
+		var err error
+		w.shaded, err = w.renderer.CreateTexture(sdl.PIXELFORMAT_ABGR8888, sdl.TEXTUREACCESS_STREAMING,
+			int32(shaded.Rect.Dx()), int32(shaded.Rect.Dy()))
+		if err != nil {
+			return nil, fmt.Errorf("couldn't create the texture: %s", err)
+		}
+		w.shadedAt = scale
+		if err := w.shaded.SetScaleMode(sdl.ScaleModeLinear); err != nil {
+			return nil, fmt.Errorf("couldn't set the scale mode: %s", err)
+		}
+	}
+	if err := w.shaded.Update(nil, unsafe.Pointer(&shaded.Pix[0]), shaded.Stride); err != nil {
+		return nil, fmt.Errorf("couldn't update the texture: %s", err)
+	}
+	return w.shaded, nil
+}
+
+func (w *window) close() {
+	if w.shaded != nil {
+		w.shaded.Destroy()
+	}
+	if w.texture != nil {
+		w.texture.Destroy()
+	}
+	if w.renderer != nil {
+		w.renderer.Destroy()
+	}
+	w.window.Destroy()
+}
@@ -0,0 +1,424 @@
+//go:build ebiten
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/nevisdale/nestic/internal/audio"
+	"github.com/nevisdale/nestic/internal/frontend"
+	"github.com/nevisdale/nestic/internal/input"
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// game runs a frame of the console per Ebiten update
+// and draws the last completed frame
+type game struct {
+	session *frontend.Session
+	hotkeys *frontend.Hotkeys
+	keys    []ebiten.Key
+
+	picture       *ebiten.Image
+	post          frontend.PostProcessor
+	shaded        *ebiten.Image // the picture scaled up by the post-processor
+	integerScale  bool
+	scale         int
+	pacing        frontend.FramePacing
+	limiter       *frontend.Limiter
+	frameDuration time.Duration // the frame period of the TV system
+	frameSamples  int           // the samples produced per frame
+	audioBuffer   time.Duration
+	bufferTarget  int  // the samples kept in the audio buffer
+	rateControl   bool // the APU keeps the audio buffer filled
+	player        *audio.Player
+	autoBuffer    *frontend.AutoBuffer // nil: the buffer size is fixed
+
+	fastSpeed   float64 // the fast-forward speed, 0: unlimited
+	fastMute    bool
+	fastToggled bool
+	paused      bool
+	screenshots frontend.ScreenshotOptions
+	videos      frontend.VideoOptions
+	clips       frontend.ClipOptions
+	states      string // the save states directory, "": in the user config directory
+	slowMute    bool
+
+	quickOpen  frontend.QuickOpen
+	recent     *frontend.RecentROMs
+	recentPath string
+
+	window frontend.WindowState // the placement out of the fullscreen
+	drawn  image.Rectangle      // where the picture was drawn in the window
+}
+
+func newGame(session *frontend.Session) *game {
+	return &game{
+		session: session,
+		hotkeys: frontend.DefaultHotkeys(),
+		picture: ebiten.NewImage(nes.FrameWidth, nes.FrameHeight),
+		scale:   3,
+
+		fastSpeed: 4,
+	}
+}
+
+func (g *game) Update() error {
+	if files := ebiten.DroppedFiles(); files != nil {
+		g.loadDropped(files)
+	}
+	in := g.hostInput()
+	advance := false
+	for _, action := range g.hotkeys.Update(in.Keys) {
+		switch action {
+		case frontend.HotkeyFullscreen:
+			ebiten.SetFullscreen(!ebiten.IsFullscreen())
+		case frontend.HotkeyScaleUp:
+			g.setScale(g.scale + 1)
+		case frontend.HotkeyScaleDown:
+			g.setScale(g.scale - 1)
+		case frontend.HotkeyFastForwardToggle:
+			g.fastToggled = !g.fastToggled
+		case frontend.HotkeySlowMotion:
+			g.session.SetSlowMotion(frontend.NextSlowMotion(g.session.SlowMotion()), g.slowMute)
+		case frontend.HotkeyPause:
+			g.paused = !g.paused
+			g.limiter.Reset()
+		case frontend.HotkeyFrameAdvance:
+			g.paused = true
+			advance = true
+		case frontend.HotkeyScreenshot:
+			if path, err := g.session.SaveScreenshot(g.screenshots); err != nil {
+				log.Printf("couldn't save the screenshot: %s\n", err)
+			} else {
+				log.Printf("saved the screenshot to %s\n", path)
+			}
+		case frontend.HotkeyVideoRecording:
+			g.toggleVideoRecording()
+		case frontend.HotkeyQuickOpen:
+			g.quickOpen.Toggle()
+		case frontend.HotkeyMovieReadOnly:
+			g.session.ToggleMovieReadOnly()
+		case frontend.HotkeyPerfOverlay:
+			g.session.SetPerfOverlay(!g.session.PerfOverlay())
+		case frontend.HotkeyShader:
+			g.post.Shader = frontend.NextShader(g.post.Shader)
+			g.session.OSD.Show("Shader: %s", g.post.Shader)
+		case frontend.HotkeySaveClip:
+			if path, err := g.session.SaveClip(g.clips); err != nil {
+				log.Printf("couldn't save the clip: %s\n", err)
+			} else {
+				log.Printf("saving the clip to %s\n", path)
+			}
+		case frontend.HotkeySaveState:
+			if _, err := g.session.SaveState(g.states); err != nil {
+				log.Printf("couldn't save the state: %s\n", err)
+			}
+		case frontend.HotkeyLoadState:
+			if err := g.session.LoadState(g.states); err != nil {
+				log.Printf("couldn't load the state: %s\n", err)
+			}
+		case frontend.HotkeyNextStateSlot:
+			g.session.SetStateSlot(g.session.StateSlot() + 1)
+			g.session.ShowStateSlots(g.states)
+		case frontend.HotkeyPrevStateSlot:
+			g.session.SetStateSlot(g.session.StateSlot() - 1)
+			g.session.ShowStateSlots(g.states)
+		case frontend.HotkeyRewind:
+			if !g.session.RewindEnabled() {
+				g.session.OSD.Show("Rewind is off, see -rewind")
+			}
+		}
+	}
+	in.Keys = g.hotkeys.Unbound(in.Keys)
+	if g.quickOpen.Active() {
+		if path := g.quickOpen.Update(in.Keys); path != "" {
+			g.openROM(path)
+		}
+		in.Keys = nil
+	}
+	g.session.SetFocused(ebiten.IsFocused())
+	rewinding := g.hotkeys.Held(frontend.HotkeyRewind) && g.session.RewindEnabled()
+	g.session.OSD.SetIndicator("rewind", indicator(rewinding, "Rewind"))
+	if rewinding {
+		// the past plays back a kept state per tick, without the sound
+		g.limiter.Reset()
+		g.showIndicators(false)
+		g.tuneBuffer(false)
+		g.session.Rewind()
+		g.updateWindow()
+		return nil
+	}
+	if g.paused || g.session.BackgroundPaused() {
+		// the frames don't catch up with the pause
+		g.limiter.Reset()
+		g.showIndicators(false)
+		g.tuneBuffer(false)
+		// exactly one frame with its sound per keypress
+		if advance {
+			g.session.RunFrame(in)
+		}
+		g.updateWindow()
+		return nil
+	}
+	fast := g.fastToggled || g.hotkeys.Held(frontend.HotkeyFastForward)
+	g.showIndicators(fast)
+	for n := g.framesDue(fast); n > 0; n-- {
+		if fast {
+			g.session.RunFast(in, g.fastSpeed, g.fastMute)
+		} else {
+			g.session.RunFrame(in)
+		}
+	}
+	g.tuneBuffer(!(fast && g.fastMute) && !(g.session.SlowMotion() < 1 && g.slowMute) && !g.session.BackgroundMuted())
+
+	g.updateWindow()
+	return nil
+}
+
+// showIndicators shows the state of the frontend on the OSD
+func (g *game) showIndicators(fast bool) {
+	osd := g.session.OSD
+	osd.SetIndicator("fast_forward", indicator(fast, "Fast forward"))
+	osd.SetIndicator("pause", indicator(g.paused, "Paused"))
+	osd.SetIndicator("quick_open", g.quickOpen.Menu())
+}
+
+// indicator returns the text of the indicator while it is on
+func indicator(on bool, text string) string {
+	if on {
+		return text
+	}
+	return ""
+}
+
+// loadDropped swaps in the ROM dropped on the window
+func (g *game) loadDropped(files fs.FS) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil || len(entries) == 0 || entries[0].IsDir() {
+		return
+	}
+	name := entries[0].Name()
+	file, err := files.Open(name)
+	if err != nil {
+		log.Printf("couldn't open the dropped file: %s\n", err)
+		return
+	}
+	defer file.Close()
+	cart, err := nes.NewCart(file)
+	if err != nil {
+		log.Printf("couldn't load the dropped ROM %s: %s\n", name, err)
+		return
+	}
+	// only the contents of the dropped files are known,
+	// so they don't go to the recent ROMs
+	g.swapCart(cart, name)
+}
+
+// openROM swaps in the ROM file
+func (g *game) openROM(path string) {
+	cart, err := nes.NewCartFromFile(path)
+	if err != nil {
+		log.Printf("couldn't load the ROM %s: %s\n", path, err)
+		return
+	}
+	rememberROM(g.recent, g.recentPath, path)
+	g.swapCart(cart, filepath.Base(path))
+}
+
+func (g *game) swapCart(cart *nes.Cart, name string) {
+	if err := g.session.SwapCart(cart, name); err != nil {
+		log.Printf("%s\n", err)
+	}
+	g.setRegion(cart.Region())
+	g.limiter.Reset()
+	g.tuneBuffer(false)
+	ebiten.SetWindowTitle(windowTitle(name))
+	log.Printf("loaded %s\n", name)
+}
+
+// setRegion sets the frame pacing to the TV system of the game
+func (g *game) setRegion(region nes.Region) {
+	g.frameDuration = region.FrameDuration()
+	g.frameSamples = int(g.frameDuration.Seconds() * nes.DefaultSampleRate)
+	// the samples kept in the buffer: the device buffer and a frame of slack
+	g.bufferTarget = int(g.audioBuffer.Seconds()*nes.DefaultSampleRate) + g.frameSamples
+	if g.rateControl {
+		g.session.Console.APU().SetRateControl(g.bufferTarget)
+	}
+}
+
+// tuneBuffer grows the automatic audio buffer while the sound breaks up.
+// The underruns count only while the sound plays
+func (g *game) tuneBuffer(playing bool) {
+	if g.autoBuffer == nil {
+		return
+	}
+	if !playing {
+		g.autoBuffer.Settle()
+		return
+	}
+	if g.autoBuffer.Update(g.player.Underruns()) {
+		g.audioBuffer = g.autoBuffer.Size()
+		g.setRegion(g.session.Console.Region())
+		g.session.OSD.Show("Audio buffer: %s", g.audioBuffer)
+		log.Printf("the sound broke up, the audio buffer is %s\n", g.audioBuffer)
+	}
+}
+
+// windowTitle returns the title of the window with the game
+func windowTitle(game string) string {
+	return "nestic - " + filepath.Base(game)
+}
+
+// toggleVideoRecording starts or stops the video recording
+func (g *game) toggleVideoRecording() {
+	if g.session.RecordingVideo() {
+		g.stopVideoRecording()
+		return
+	}
+	if path, err := g.session.StartVideoRecording(g.videos); err != nil {
+		log.Printf("couldn't start the video recording: %s\n", err)
+	} else {
+		log.Printf("recording the video to %s\n", path)
+	}
+}
+
+func (g *game) stopVideoRecording() {
+	if !g.session.RecordingVideo() {
+		return
+	}
+	if err := g.session.StopVideoRecording(); err != nil {
+		log.Printf("couldn't finish the video: %s\n", err)
+	} else {
+		log.Printf("finished the video\n")
+	}
+}
+
+// updateWindow remembers the placement of the window
+func (g *game) updateWindow() {
+	g.window.Fullscreen = ebiten.IsFullscreen()
+	if !g.window.Fullscreen {
+		g.window.X, g.window.Y = ebiten.WindowPosition()
+		g.window.Width, g.window.Height = ebiten.WindowSize()
+	}
+}
+
+// framesDue returns how many frames the update runs
+func (g *game) framesDue(fast bool) int {
+	speed := g.session.SlowMotion()
+	if fast {
+		speed = 1
+	}
+	pacing := g.pacing
+	if pacing == frontend.FramePacingAudio && (fast && g.fastMute || speed < 1 && g.slowMute || g.session.BackgroundMuted()) {
+		// the muted sound doesn't fill the audio buffer
+		pacing = frontend.FramePacingClock
+	}
+	switch pacing {
+	case frontend.FramePacingClock:
+		g.limiter.SetPeriod(time.Duration(float64(g.frameDuration) / speed))
+		return g.limiter.Due()
+	case frontend.FramePacingAudio:
+		// refill what the device consumed, a few frames at most,
+		// so a stall drops the sound instead of freezing the window.
+		// The slow motion stretches the sound of a frame
+		frameSamples := int(float64(g.frameSamples) / speed)
+		missing := g.bufferTarget - g.session.Console.APU().BufferedSamples()
+		return min(max(0, (missing+frameSamples-1)/frameSamples), 3)
+	}
+	if fast {
+		return 1
+	}
+	return g.session.SlowDue()
+}
+
+// setScale sizes the window to the multiple of the picture
+func (g *game) setScale(scale int) {
+	g.scale = frontend.ClampScale(scale)
+	if !ebiten.IsFullscreen() {
+		size := frontend.WindowSize(g.scale, g.post.Aspect)
+		ebiten.SetWindowSize(size.X, size.Y)
+	}
+}
+
+func (g *game) Draw(screen *ebiten.Image) {
+	start := time.Now()
+	defer func() { g.session.FrameShown(time.Since(start)) }()
+	r := frontend.FitRect(screen.Bounds().Size(), g.integerScale, g.post.Aspect)
+	op := &ebiten.DrawImageOptions{}
+	picture, display := g.picture, g.session.Display()
+	// the picture scaled up by the shader or for the wide pixels
+	// is scaled smoothly to the window
+	if shaded := g.post.Process(display, frontend.ShaderScale(r.Dy())); shaded != display {
+		if g.shaded == nil || g.shaded.Bounds() != shaded.Rect {
+			if g.shaded != nil {
+				g.shaded.Deallocate()
+			}
+			g.shaded = ebiten.NewImage(shaded.Rect.Dx(), shaded.Rect.Dy())
+		}
+		g.shaded.WritePixels(shaded.Pix)
+		picture = g.shaded
+		op.Filter = ebiten.FilterLinear
+	} else {
+		g.picture.WritePixels(display.Pix)
+	}
+	size := picture.Bounds().Size()
+	op.GeoM.Scale(float64(r.Dx())/float64(size.X), float64(r.Dy())/float64(size.Y))
+	op.GeoM.Translate(float64(r.Min.X), float64(r.Min.Y))
+	g.drawn = r
+	screen.DrawImage(picture, op)
+}
+
+func (g *game) Layout(outsideWidth, outsideHeight int) (int, int) {
+	return outsideWidth, outsideHeight
+}
+
+// hostInput returns the state of the keyboard, the gamepads and the mouse
+func (g *game) hostInput() frontend.HostInput {
+	g.keys = inpututil.AppendPressedKeys(g.keys[:0])
+	in := frontend.HostInput{Keys: make([]string, len(g.keys))}
+	for i, key := range g.keys {
+		in.Keys[i] = key.String()
+	}
+	in.Pads = g.pads()
+	// the paddle follows the cursor in the picture pixels
+	if x, _ := ebiten.CursorPosition(); g.drawn.Dx() > 0 {
+		in.MouseX = (x - g.drawn.Min.X) * nes.FrameWidth / g.drawn.Dx()
+	}
+	in.MouseLeft = ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft)
+	return in
+}
+
+// pads returns the state of the connected gamepads
+func (g *game) pads() []input.Pad {
+	var pads []input.Pad
+	for _, id := range ebiten.AppendGamepadIDs(nil) {
+		pad := input.Pad{ID: fmt.Sprint(id), Name: ebiten.GamepadName(id)}
+		for b := 0; b < ebiten.GamepadButtonCount(id); b++ {
+			pad.Buttons = append(pad.Buttons, ebiten.IsGamepadButtonPressed(id, ebiten.GamepadButton(b)))
+		}
+		for a := 0; a < ebiten.GamepadAxisCount(id); a++ {
+			pad.Axes = append(pad.Axes, ebiten.GamepadAxisValue(id, ebiten.GamepadAxisType(a)))
+		}
+		pads = append(pads, pad)
+	}
+	return pads
+}
+
+// rememberROM puts the opened ROM first in the recent ROMs
+func rememberROM(recent *frontend.RecentROMs, recentPath, path string) {
+	recent.Add(path)
+	if recentPath == "" {
+		return
+	}
+	if err := recent.Save(recentPath); err != nil {
+		log.Printf("couldn't remember the ROM: %s\n", err)
+	}
+}
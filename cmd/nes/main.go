@@ -0,0 +1,188 @@
+//go:build ebiten
+
+// Command nes is the emulator with a window: it shows the picture,
+// plays the sound and reads the keyboard and the gamepads.
+//
+// It is built with the ebiten build tag, and with the oto tag for the sound:
+//
+//	go build -tags "ebiten oto" ./cmd/nes
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/nevisdale/nestic/internal/audio"
+	"github.com/nevisdale/nestic/internal/config"
+	"github.com/nevisdale/nestic/internal/frontend"
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+var (
+	romPath   string
+	recentROM int
+	cfg       = config.Default()
+)
+
+func main() {
+	flag.StringVar(&romPath, "rom", "", "path to the ROM file, or the first argument, default: the last opened ROM")
+	flag.IntVar(&recentROM, "recent", 0, "open the recent ROM by its number, 1 is the last opened one")
+	if err := cfg.Parse(flag.CommandLine, os.Args[1:]); err != nil {
+		if err == config.ErrPrinted {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	if romPath == "" {
+		romPath = flag.Arg(0)
+	}
+	recentPath, _ := frontend.RecentROMsPath()
+	recent, _ := frontend.LoadRecentROMs(recentPath)
+	path, err := recent.Resolve(romPath, recentROM)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\nusage: nes [flags] game.nes\n", err)
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+	romPath = path
+
+	if err := run(recent, recentPath); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+// flagSet reports whether the flag is given on the command line
+func flagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+func run(recent *frontend.RecentROMs, recentPath string) error {
+	cart, err := nes.NewCartFromFile(romPath)
+	if err != nil {
+		return fmt.Errorf("couldn't load the ROM: %s", err)
+	}
+	rememberROM(recent, recentPath, romPath)
+	console := nes.NewBus()
+	if err := cfg.Apply(console); err != nil {
+		return err
+	}
+	console.LoadCart(cart)
+	console.Reset()
+
+	pacing, err := cfg.FramePacing()
+	if err != nil {
+		return err
+	}
+	session, err := cfg.NewSession(console, romPath)
+	if err != nil {
+		return err
+	}
+	hotkeys, err := cfg.Hotkeys()
+	if err != nil {
+		return err
+	}
+	shader, err := cfg.Shader()
+	if err != nil {
+		return err
+	}
+	aspect, err := cfg.PixelAspect()
+	if err != nil {
+		return err
+	}
+
+	game := newGame(session)
+	game.hotkeys = hotkeys
+	hotkeys.SetPassThrough(session.KeyboardTakes)
+	game.post.Shader, game.post.Aspect = shader, aspect
+	game.recent, game.recentPath = recent, recentPath
+	game.quickOpen.Recent = recent
+	game.integerScale = cfg.Video.IntegerScale
+	game.scale = frontend.ClampScale(cfg.Video.Scale)
+	game.fastSpeed = cfg.Emulation.FastForwardSpeed
+	game.fastMute = cfg.Emulation.FastForwardMute
+	game.slowMute = cfg.Emulation.SlowMotionMute
+	game.screenshots = cfg.ScreenshotOptions()
+	game.videos = cfg.VideoOptions()
+	game.clips = cfg.ClipOptions()
+	game.states = cfg.Paths.States
+	game.limiter = frontend.NewLimiter(cart.Region().FrameDuration())
+	audioBuffer := cfg.Audio.Buffer
+	if cfg.Audio.AutoBuffer {
+		game.autoBuffer = frontend.NewAutoBuffer()
+		audioBuffer = game.autoBuffer.Size()
+	}
+	game.audioBuffer = audioBuffer
+	game.setRegion(cart.Region())
+
+	player, err := audio.NewPlayer(console.APU(), audio.Options{
+		SampleRate: nes.DefaultSampleRate,
+		Channels:   cfg.Channels(),
+		BufferSize: audioBuffer,
+	})
+	if err != nil {
+		log.Printf("audio is disabled: %s\n", err)
+		if pacing == frontend.FramePacingAudio {
+			pacing = frontend.FramePacingClock
+		}
+		game.autoBuffer = nil
+	} else {
+		defer player.Close()
+		game.player = player
+		// the display or the clock runs a bit off the audio device,
+		// the rate control keeps the buffer from running dry
+		game.rateControl = pacing != frontend.FramePacingAudio
+		game.setRegion(cart.Region())
+	}
+	game.pacing = pacing
+
+	ebiten.SetWindowTitle(windowTitle(romPath))
+	size := frontend.WindowSize(game.scale, aspect)
+	ebiten.SetWindowSize(size.X, size.Y)
+	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
+	ebiten.SetFullscreen(cfg.Video.Fullscreen)
+	// the flags given explicitly win over the remembered window
+	windowPath, err := frontend.WindowStatePath()
+	rememberWindow := cfg.Video.RememberWindow
+	if rememberWindow && err == nil {
+		if state, err := frontend.LoadWindowState(windowPath); err == nil {
+			if !flagSet("scale") && state.Width > 0 && state.Height > 0 {
+				ebiten.SetWindowSize(state.Width, state.Height)
+			}
+			ebiten.SetWindowPosition(state.X, state.Y)
+			if !flagSet("fullscreen") {
+				ebiten.SetFullscreen(state.Fullscreen)
+			}
+		}
+	}
+	// the updates follow the display, the game decides how many frames they run
+	ebiten.SetTPS(ebiten.SyncWithFPS)
+	err = ebiten.RunGame(game)
+	game.stopVideoRecording()
+	if err := game.session.AutoSaveState(); err != nil {
+		log.Printf("couldn't auto-save the state: %s\n", err)
+	}
+	if err := game.session.WaitClip(); err != nil {
+		log.Printf("couldn't save the clip: %s\n", err)
+	}
+	if err := game.session.SaveAPULog(); err != nil {
+		log.Printf("couldn't export the APU log: %s\n", err)
+	}
+	if err != nil {
+		return err
+	}
+	if rememberWindow && windowPath != "" && game.window.Width > 0 {
+		if err := game.window.Save(windowPath); err != nil {
+			log.Printf("couldn't remember the window: %s\n", err)
+		}
+	}
+	return nil
+}
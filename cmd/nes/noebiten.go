@@ -0,0 +1,17 @@
+//go:build !ebiten
+
+// Command nes is the emulator with a window. It needs Ebiten
+// and is built with the ebiten build tag:
+//
+//	go build -tags "ebiten oto" ./cmd/nes
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Fprintln(os.Stderr, "built without the window support, rebuild with -tags ebiten")
+	os.Exit(1)
+}
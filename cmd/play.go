@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/audio"
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// play runs the NSF player:
+//
+//	nestic play [flags] music.nsf
+//
+// The commands are read from the standard input, a command per line:
+// n: the next track, p: the previous track, a number: go to the track, q: quit
+func play(args []string) error {
+	flags := flag.NewFlagSet("play", flag.ExitOnError)
+	track := flags.Int("track", 0, "track to start with, 0: the default track of the file")
+	length := flags.Duration("length", 3*time.Minute, "time to play a track for before moving on")
+	loop := flags.Bool("loop", false, "repeat the track instead of moving on")
+	buffer := flags.Duration("audio-buffer", 0, "audio device buffer size, 0: the device default")
+	logPath := flags.String("apu-log", "", "path to export the APU register writes to on quit")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: nestic play [flags] music.nsf")
+	}
+
+	nsf, err := nes.LoadNSF(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("couldn't load the NSF: %s", err)
+	}
+	player := nes.NewNSFPlayer(nsf)
+	player.APU().SetWriteLogging(*logPath != "")
+	if *track > 0 {
+		player.SetSong(*track - 1)
+	}
+
+	out, err := audio.NewPlayer(player.APU(), audio.Options{
+		SampleRate: nes.DefaultSampleRate,
+		BufferSize: *buffer,
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't open the audio device: %s", err)
+	}
+	defer out.Close()
+
+	fmt.Printf("%s\n%s\n%s\n", nsf.Name, nsf.Artist, nsf.Copyright)
+	if nsf.Chips != 0 {
+		fmt.Printf("the expansion audio of the NSF is not emulated\n")
+	}
+	fmt.Printf("n: next, p: previous, number: go to the track, q: quit\n")
+
+	commands := make(chan string)
+	go readCommands(os.Stdin, commands)
+
+	bufferTarget := int((*buffer + frameDuration).Seconds() * nes.DefaultSampleRate)
+	lastStatus := ""
+	for {
+		select {
+		case cmd, ok := <-commands:
+			if !ok {
+				// no more commands, keep playing
+				commands = nil
+				break
+			}
+			switch cmd {
+			case "q":
+				fmt.Println()
+				if *logPath != "" {
+					return player.APU().SaveWriteLog(*logPath)
+				}
+				return nil
+			case "n":
+				player.SetSong(player.Song() + 1)
+			case "p":
+				player.SetSong(player.Song() - 1)
+			default:
+				if n, err := strconv.Atoi(cmd); err == nil && n >= 1 && n <= nsf.Songs {
+					player.SetSong(n - 1)
+				}
+			}
+		default:
+		}
+
+		// the audio device consumes the samples at its own rate
+		for player.APU().BufferedSamples() < bufferTarget {
+			player.RunFrame()
+		}
+		if player.Elapsed() >= *length {
+			if *loop {
+				player.SetSong(player.Song())
+			} else {
+				player.SetSong(player.Song() + 1)
+			}
+		}
+
+		elapsed := player.Elapsed().Truncate(time.Second)
+		status := fmt.Sprintf("\rtrack %d/%d  %02d:%02d ", player.Song()+1, nsf.Songs,
+			int(elapsed.Minutes()), int(elapsed.Seconds())%60)
+		if status != lastStatus {
+			fmt.Print(status)
+			lastStatus = status
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// readCommands sends the lines of r to the channel until r ends
+func readCommands(r io.Reader, commands chan<- string) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		commands <- strings.TrimSpace(scanner.Text())
+	}
+	close(commands)
+}
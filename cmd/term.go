@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/audio"
+	"github.com/nevisdale/nestic/internal/config"
+	"github.com/nevisdale/nestic/internal/frontend"
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// term runs the console in the terminal:
+//
+//	nestic term [flags] game.nes
+//
+// The picture is drawn with the half block characters in the 24-bit colors,
+// or as the sixel images where the terminal supports them, and the keys
+// are read in the raw mode. Ctrl+C or Ctrl+Q quits
+func term(args []string) error {
+	flags := flag.NewFlagSet("term", flag.ExitOnError)
+	graphicsName := flags.String("graphics", "auto", "how the picture is drawn: blocks (half block characters), sixel, or auto: sixel where the terminal supports it")
+	c := config.Default()
+	c.Video.Scale = 2
+	if err := c.Parse(flags, args); err != nil {
+		if err == config.ErrPrinted {
+			return nil
+		}
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: nestic term [flags] game.nes")
+	}
+	graphics, err := frontend.ParseTerminalGraphics(*graphicsName)
+	if err != nil {
+		return err
+	}
+	aspect, err := c.PixelAspect()
+	if err != nil {
+		return err
+	}
+	hotkeys, err := c.Hotkeys()
+	if err != nil {
+		return err
+	}
+
+	cart, err := nes.NewCartFromFile(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("couldn't load the ROM: %s", err)
+	}
+	console := nes.NewBus()
+	if err := c.Apply(console); err != nil {
+		return err
+	}
+	console.LoadCart(cart)
+	console.Reset()
+	session, err := c.NewSession(console, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	hotkeys.SetPassThrough(session.KeyboardTakes)
+	if c.Input.Keymap == "" {
+		// the terminal doesn't see the shift alone
+		session.Keymap.Bind("Space", 0, nes.ButtonSelect)
+	}
+	defer func() {
+		if err := session.AutoSaveState(); err != nil {
+			log.Printf("couldn't auto-save the state: %s\n", err)
+		}
+		if err := session.SaveAPULog(); err != nil {
+			log.Printf("couldn't export the APU log: %s\n", err)
+		}
+	}()
+
+	tty, err := openRawTerminal(os.Stdin)
+	if err != nil {
+		return err
+	}
+	defer tty.restore()
+	// the log would scroll the picture, it is shown on the screen
+	flagsBefore := log.Flags()
+	log.SetOutput(osdLog{session.OSD})
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flagsBefore)
+	}()
+
+	out := bufio.NewWriterSize(os.Stdout, 1<<16)
+	// the alternate screen without the cursor, the shell screen comes back on exit
+	out.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		out.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+		out.Flush()
+	}()
+	if graphics == frontend.TerminalAuto {
+		graphics = frontend.TerminalBlocks
+		if sixelSupported(out) {
+			graphics = frontend.TerminalSixel
+		}
+	}
+	renderer := &frontend.TerminalRenderer{Graphics: graphics, Aspect: aspect, Scale: c.Video.Scale}
+
+	// the keys are read in the background, the reads wake up
+	// every 100ms to see whether the frontend quit
+	keyInput := make(chan []byte, 16)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				keyInput <- bytes.Clone(buf[:n])
+			}
+			if err != nil && n == 0 {
+				time.Sleep(100 * time.Millisecond)
+			}
+		}
+	}()
+
+	frameDuration := cart.Region().FrameDuration()
+	player, err := audio.NewPlayer(console.APU(), audio.Options{
+		SampleRate: nes.DefaultSampleRate,
+		Channels:   c.Channels(),
+		BufferSize: c.Audio.Buffer,
+	})
+	if err != nil {
+		log.Printf("audio is disabled: %s\n", err)
+	} else {
+		defer player.Close()
+		// the samples kept in the buffer: the device buffer and a frame of slack
+		console.APU().SetRateControl(int((c.Audio.Buffer + frameDuration).Seconds() * nes.DefaultSampleRate))
+	}
+
+	limiter := frontend.NewLimiter(frameDuration)
+	var keys frontend.TerminalKeys
+	fastToggled, paused := false, false
+	for {
+		now := time.Now()
+	read:
+		for {
+			select {
+			case b := <-keyInput:
+				pressed := frontend.ParseTerminalKeys(b)
+				if slices.Contains(pressed, "Ctrl+C") || slices.Contains(pressed, "Ctrl+Q") {
+					return nil
+				}
+				keys.Press(pressed, now)
+			default:
+				break read
+			}
+		}
+		held := keys.Held(now)
+		for _, action := range hotkeys.Update(held) {
+			switch action {
+			case frontend.HotkeyFastForwardToggle:
+				fastToggled = !fastToggled
+			case frontend.HotkeyPause:
+				paused = !paused
+				limiter.Reset()
+			case frontend.HotkeyScaleUp:
+				renderer.Scale = frontend.ClampScale(renderer.Scale + 1)
+				renderer.Invalidate()
+				out.WriteString("\x1b[2J")
+			case frontend.HotkeyScaleDown:
+				renderer.Scale = frontend.ClampScale(renderer.Scale - 1)
+				renderer.Invalidate()
+				out.WriteString("\x1b[2J")
+			case frontend.HotkeyScreenshot:
+				if path, err := session.SaveScreenshot(c.ScreenshotOptions()); err != nil {
+					log.Printf("couldn't save the screenshot: %s\n", err)
+				} else {
+					log.Printf("saved the screenshot to %s\n", path)
+				}
+			case frontend.HotkeyMovieReadOnly:
+				session.ToggleMovieReadOnly()
+			case frontend.HotkeyPerfOverlay:
+				session.SetPerfOverlay(!session.PerfOverlay())
+			case frontend.HotkeySaveState:
+				if _, err := session.SaveState(c.Paths.States); err != nil {
+					log.Printf("couldn't save the state: %s\n", err)
+				}
+			case frontend.HotkeyLoadState:
+				if err := session.LoadState(c.Paths.States); err != nil {
+					log.Printf("couldn't load the state: %s\n", err)
+				}
+			case frontend.HotkeyNextStateSlot:
+				session.SetStateSlot(session.StateSlot() + 1)
+				session.ShowStateSlots(c.Paths.States)
+			case frontend.HotkeyPrevStateSlot:
+				session.SetStateSlot(session.StateSlot() - 1)
+				session.ShowStateSlots(c.Paths.States)
+			case frontend.HotkeyRewind:
+				if !session.RewindEnabled() {
+					session.OSD.Show("Rewind is off, see -rewind")
+				}
+			}
+		}
+		in := frontend.HostInput{Keys: hotkeys.Unbound(held)}
+		fast := fastToggled || hotkeys.Held(frontend.HotkeyFastForward)
+		rewinding := hotkeys.Held(frontend.HotkeyRewind) && session.RewindEnabled()
+		session.OSD.SetIndicator("fast_forward", indicator(fast && !paused, "Fast forward"))
+		session.OSD.SetIndicator("pause", indicator(paused, "Paused"))
+		session.OSD.SetIndicator("rewind", indicator(rewinding, "Rewind"))
+		switch {
+		case rewinding:
+			session.Rewind()
+		case paused:
+		case fast:
+			session.RunFast(in, c.Emulation.FastForwardSpeed, c.Emulation.FastForwardMute)
+		default:
+			session.RunFrame(in)
+		}
+
+		start := time.Now()
+		cols, rows, err := tty.size()
+		if err != nil {
+			return err
+		}
+		out.Write(renderer.Render(session.Display(), cols, rows))
+		if err := out.Flush(); err != nil {
+			return fmt.Errorf("couldn't draw the picture: %s", err)
+		}
+		session.FrameShown(time.Since(start))
+		limiter.Wait()
+	}
+}
+
+// sixelSupported asks the terminal whether it draws the sixel images,
+// the terminals which don't answer in time don't
+func sixelSupported(out *bufio.Writer) bool {
+	out.WriteString(frontend.TerminalAttributesQuery)
+	if err := out.Flush(); err != nil {
+		return false
+	}
+	var answer []byte
+	buf := make([]byte, 64)
+	for deadline := time.Now().Add(300 * time.Millisecond); time.Now().Before(deadline); {
+		n, _ := os.Stdin.Read(buf)
+		answer = append(answer, buf[:n]...)
+		if i := bytes.Index(answer, []byte("\x1b[?")); i >= 0 && bytes.IndexByte(answer[i:], 'c') >= 0 {
+			break
+		}
+	}
+	return frontend.SixelSupported(answer)
+}
+
+// osdLog shows the log lines as the messages on the screen
+type osdLog struct {
+	osd *frontend.OSD
+}
+
+func (l osdLog) Write(p []byte) (int, error) {
+	l.osd.Show("%s", strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+// indicator returns the text while the indicator is on
+func indicator(on bool, text string) string {
+	if on {
+		return text
+	}
+	return ""
+}
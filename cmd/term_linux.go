@@ -0,0 +1,60 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// rawTerminal is the terminal switched to the raw mode: the keys are read
+// as they are pressed, without the echo and the line editing
+type rawTerminal struct {
+	fd    int
+	saved syscall.Termios
+}
+
+// openRawTerminal switches the terminal of the file to the raw mode.
+// The reads return after 100ms without the input, so the reader can stop
+func openRawTerminal(f *os.File) (*rawTerminal, error) {
+	t := &rawTerminal{fd: int(f.Fd())}
+	if err := ioctl(t.fd, syscall.TCGETS, unsafe.Pointer(&t.saved)); err != nil {
+		return nil, fmt.Errorf("couldn't read the terminal mode: %s", err)
+	}
+	raw := t.saved
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Oflag &^= syscall.OPOST
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 0
+	raw.Cc[syscall.VTIME] = 1
+	if err := ioctl(t.fd, syscall.TCSETS, unsafe.Pointer(&raw)); err != nil {
+		return nil, fmt.Errorf("couldn't switch the terminal to the raw mode: %s", err)
+	}
+	return t, nil
+}
+
+// size returns the size of the terminal in the character cells
+func (t *rawTerminal) size() (int, int, error) {
+	var ws struct{ rows, cols, x, y uint16 }
+	if err := ioctl(t.fd, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return 0, 0, fmt.Errorf("couldn't read the terminal size: %s", err)
+	}
+	return int(ws.cols), int(ws.rows), nil
+}
+
+// restore switches the terminal back to the mode it had
+func (t *rawTerminal) restore() error {
+	return ioctl(t.fd, syscall.TCSETS, unsafe.Pointer(&t.saved))
+}
+
+func ioctl(fd int, request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
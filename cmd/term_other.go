@@ -0,0 +1,24 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// rawTerminal is the terminal switched to the raw mode.
+// Only Linux is supported
+type rawTerminal struct{}
+
+func openRawTerminal(f *os.File) (*rawTerminal, error) {
+	return nil, errors.New("the terminal frontend is only supported on Linux")
+}
+
+func (t *rawTerminal) size() (int, int, error) {
+	return 0, 0, errors.New("the terminal frontend is only supported on Linux")
+}
+
+func (t *rawTerminal) restore() error {
+	return nil
+}
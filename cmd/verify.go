@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// verify checks that the emulation is deterministic:
+//
+//	nestic verify [flags] game.nes
+//
+// It replays the movie, or the frames without the input, twice from
+// the same start: the save state or the power-on. The hashes of every
+// frame and the final RAM must match, otherwise the first frame they
+// differ at is reported. The nondeterminism breaks the movies, the rewind
+// and the netplay
+func verify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	frames := flags.Int("frames", 0, "frames to replay, 0: the length of the movie")
+	moviePath := flags.String("play-movie", "", "replay the movie file, .fm2: FCEUX movie")
+	statePath := flags.String("state", "", "start from the save state instead of the power-on or the start of the movie")
+	fourScore := flags.Bool("four-score", false, "plug in the Four Score, the movie sets it itself")
+	process := flags.Bool("process", false, "run the second replay in a new process")
+	printTrace := flags.Bool("print-trace", false, "print the hashes of a single replay instead of the check")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: nestic verify [flags] game.nes")
+	}
+
+	cart, err := nes.NewCartFromFile(flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("couldn't load the ROM: %s", err)
+	}
+	console := nes.NewBus()
+	console.LoadCart(cart)
+	console.Reset()
+
+	movie := &nes.Movie{FourScore: *fourScore}
+	if *moviePath != "" {
+		if movie, err = nes.LoadMovie(*moviePath); err != nil {
+			return fmt.Errorf("couldn't load the movie: %s", err)
+		}
+		if *frames == 0 {
+			*frames = len(movie.Frames)
+		}
+	}
+	if *statePath != "" {
+		if movie.State, err = os.ReadFile(*statePath); err != nil {
+			return fmt.Errorf("couldn't read the state: %s", err)
+		}
+	}
+	if *frames <= 0 {
+		return fmt.Errorf("no frames to replay, set -frames")
+	}
+
+	first, err := console.Replay(movie, *frames)
+	if err != nil {
+		return fmt.Errorf("couldn't replay: %s", err)
+	}
+	if *printTrace {
+		return first.Write(os.Stdout)
+	}
+
+	var second *nes.ReplayTrace
+	if *process {
+		second, err = replayInProcess(flags, *frames)
+	} else {
+		// the same console again, its state must not leak into the replay
+		second, err = console.Replay(movie, *frames)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't replay again: %s", err)
+	}
+	if frame, what := first.Divergence(second); frame >= 0 {
+		return fmt.Errorf("the replays diverge at the frame %d: %s differs", frame, what)
+	}
+	fmt.Printf("the replays match, %d frames\n", *frames)
+	return nil
+}
+
+// replayInProcess runs the replay in a new nestic process with the same
+// flags and reads its trace
+func replayInProcess(flags *flag.FlagSet, frames int) (*nes.ReplayTrace, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't find the executable: %s", err)
+	}
+	args := []string{"verify", "-print-trace", "-frames", strconv.Itoa(frames)}
+	for _, name := range []string{"play-movie", "state", "four-score"} {
+		args = append(args, "-"+name+"="+flags.Lookup(name).Value.String())
+	}
+	cmd := exec.Command(exe, append(args, flags.Arg(0))...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("the process failed: %s", err)
+	}
+	return nes.ReadReplayTrace(bytes.NewReader(out))
+}
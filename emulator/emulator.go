@@ -0,0 +1,234 @@
+// Package emulator is the API of the emulator for the programs embedding
+// it: the bots, the trainers and the analysis tools. The console runs
+// frame by frame with the input the program sets, and the program hooks
+// into it:
+//
+//	emu, err := emulator.Open("game.nes")
+//	if err != nil {
+//		return err
+//	}
+//	emu.OnMemoryWrite(0x0075, 0x0075, func(addr uint16, data uint8) {
+//		log.Printf("lives: %d\n", data)
+//	})
+//	for {
+//		emu.SetInput(0, emulator.ButtonRight)
+//		emu.RunFrame()
+//	}
+//
+// The hooks run on the goroutine running the frames. The API is kept
+// compatible, the internal packages of the emulator are not.
+package emulator
+
+import (
+	"fmt"
+	"image"
+	"io"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// Button is a button of the standard controller, the buttons combine
+type Button uint8
+
+const (
+	ButtonA Button = 1 << iota
+	ButtonB
+	ButtonSelect
+	ButtonStart
+	ButtonUp
+	ButtonDown
+	ButtonLeft
+	ButtonRight
+)
+
+// the buttons of the console by the bits of Button
+var consoleButtons = [8]nes.Button{
+	nes.ButtonA, nes.ButtonB, nes.ButtonSelect, nes.ButtonStart,
+	nes.ButtonUp, nes.ButtonDown, nes.ButtonLeft, nes.ButtonRight,
+}
+
+// consoleButton returns the buttons of the console
+func consoleButton(b Button) nes.Button {
+	var buttons nes.Button
+	for i, button := range consoleButtons {
+		if b&(1<<i) != 0 {
+			buttons |= button
+		}
+	}
+	return buttons
+}
+
+// Registers are the registers of the CPU. Between the instructions
+// the PC is the address of the next instruction
+type Registers struct {
+	A, X, Y uint8
+	P       uint8 // the flags: NV-BDIZC
+	SP      uint8
+	PC      uint16
+	Cycles  uint64 // the cycles since the power-on
+}
+
+// the size of the picture
+const (
+	FrameWidth  = 256
+	FrameHeight = 240
+)
+
+// Emulator is the console with the ROM loaded
+type Emulator struct {
+	console *nes.Bus
+	input   [4]nes.Button
+	frame   *image.RGBA // the last frame with the overlays
+
+	onFrame  []func(frame int)
+	onWrite  []writeHook
+	onNMI    []func()
+	overlays []func(dst *image.RGBA)
+}
+
+type writeHook struct {
+	start, end uint16
+	fn         func(addr uint16, data uint8)
+}
+
+// Open loads the ROM and powers the console on
+func Open(romPath string) (*Emulator, error) {
+	cart, err := nes.NewCartFromFile(romPath)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load the ROM: %s", err)
+	}
+	console := nes.NewBus()
+	console.LoadCart(cart)
+	console.Reset()
+	return &Emulator{
+		console: console,
+		frame:   image.NewRGBA(image.Rect(0, 0, FrameWidth, FrameHeight)),
+	}, nil
+}
+
+// RunFrame runs the console with the input until the frame
+// is completed, then calls the frame hooks
+func (e *Emulator) RunFrame() {
+	e.console.SetInput(e.input)
+	e.console.RunFrame()
+	frame := e.FrameCount()
+	for _, fn := range e.onFrame {
+		fn(frame)
+	}
+}
+
+// FrameCount returns the frames run since the power-on
+func (e *Emulator) FrameCount() int {
+	return e.console.InputView().Frame
+}
+
+// Frame returns the last completed frame with the overlays drawn over
+// it, the image is reused
+func (e *Emulator) Frame() *image.RGBA {
+	copy(e.frame.Pix, e.console.PPU().Frame().Pix)
+	for _, draw := range e.overlays {
+		draw(e.frame)
+	}
+	return e.frame
+}
+
+// SetInput sets the pressed buttons of the controller in the port,
+// 0-3, for the next frames. The other ports are ignored
+func (e *Emulator) SetInput(port int, buttons Button) {
+	if port < 0 || port >= len(e.input) {
+		return
+	}
+	e.input[port] = consoleButton(buttons)
+}
+
+// ReadSamples reads the sound of the frames run, mono at 44100 Hz,
+// and returns how many samples are read. While the samples aren't read
+// the oldest ones are dropped
+func (e *Emulator) ReadSamples(samples []float32) int {
+	return e.console.APU().ReadSamples(samples)
+}
+
+// ReadMemory reads the CPU memory without the side effects of the read
+func (e *Emulator) ReadMemory(addr uint16) uint8 {
+	return e.console.PeekMemory(addr)
+}
+
+// WriteMemory writes the CPU memory the way the CPU does
+func (e *Emulator) WriteMemory(addr uint16, data uint8) {
+	e.console.WriteMemory(addr, data)
+}
+
+// Registers returns the registers of the CPU
+func (e *Emulator) Registers() Registers {
+	r := e.console.CPURegisters()
+	return Registers{A: r.A, X: r.X, Y: r.Y, P: r.P, SP: r.SP, PC: r.PC, Cycles: r.Cycles}
+}
+
+// Reset presses the reset button of the console
+func (e *Emulator) Reset() {
+	e.console.Reset()
+}
+
+// SaveState writes the state of the console
+func (e *Emulator) SaveState(w io.Writer) error {
+	return e.console.SaveStateCompressed(w)
+}
+
+// LoadState loads the state written by SaveState
+func (e *Emulator) LoadState(r io.Reader) error {
+	return e.console.LoadState(r)
+}
+
+// OnFrame calls fn after every frame with the number of the frame
+func (e *Emulator) OnFrame(fn func(frame int)) {
+	e.onFrame = append(e.onFrame, fn)
+}
+
+// OnMemoryWrite calls fn after the CPU writes the addresses
+// from start to end. The console runs slower with the hook
+func (e *Emulator) OnMemoryWrite(start, end uint16, fn func(addr uint16, data uint8)) {
+	e.onWrite = append(e.onWrite, writeHook{start: min(start, end), end: max(start, end), fn: fn})
+	e.console.SetDebugHooks(hooks{e})
+}
+
+// OnNMI calls fn when the PPU raises the NMI, at the start of the vblank.
+// The console runs slower with the hook
+func (e *Emulator) OnNMI(fn func()) {
+	e.onNMI = append(e.onNMI, fn)
+	e.console.SetDebugHooks(hooks{e})
+}
+
+// DrawOverlay adds the overlay drawn over the frames Frame returns
+func (e *Emulator) DrawOverlay(draw func(dst *image.RGBA)) {
+	e.overlays = append(e.overlays, draw)
+}
+
+// hooks watches the console for the hooks, they never break
+type hooks struct {
+	e *Emulator
+}
+
+func (h hooks) Instruction(pc uint16) bool {
+	return false
+}
+
+func (h hooks) Access(addr uint16, data uint8, write bool) bool {
+	if !write {
+		return false
+	}
+	for _, hook := range h.e.onWrite {
+		if addr >= hook.start && addr <= hook.end {
+			hook.fn(addr, data)
+		}
+	}
+	return false
+}
+
+func (h hooks) Event(event nes.Event) bool {
+	if event.Type == nes.EventNMI {
+		for _, fn := range h.e.onNMI {
+			fn()
+		}
+	}
+	return false
+}
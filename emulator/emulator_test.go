@@ -0,0 +1,105 @@
+package emulator
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openTestROM opens the loop counting the NMIs in $11
+func openTestROM(t *testing.T) *Emulator {
+	rom := make([]byte, 16+0x4000+0x2000)
+	copy(rom, "NES\x1a\x01\x01")
+	prg := rom[16:]
+	copy(prg, []uint8{
+		0xA9, 0x80, 0x8D, 0x00, 0x20, // LDA #$80, STA $2000: NMI on
+		0xE6, 0x10, // loop: INC $10
+		0x4C, 0x05, 0x80, // JMP loop
+	})
+	copy(prg[0x20:], []uint8{
+		0xE6, 0x11, // NMI: INC $11
+		0x40, // RTI
+	})
+	copy(prg[0x3FFA:], []uint8{0x20, 0x80, 0x00, 0x80, 0x20, 0x80})
+	path := filepath.Join(t.TempDir(), "test.nes")
+	require.NoError(t, os.WriteFile(path, rom, 0o644))
+	emu, err := Open(path)
+	require.NoError(t, err)
+	return emu
+}
+
+func Test_Emulator_Hooks(t *testing.T) {
+	emu := openTestROM(t)
+	var frames []int
+	emu.OnFrame(func(frame int) {
+		frames = append(frames, frame)
+	})
+	nmis := 0
+	emu.OnNMI(func() {
+		nmis++
+	})
+	var writes []uint8
+	emu.OnMemoryWrite(0x11, 0x11, func(addr uint16, data uint8) {
+		writes = append(writes, data)
+	})
+
+	emu.SetInput(1, ButtonA|ButtonStart)
+	for i := 0; i < 3; i++ {
+		emu.RunFrame()
+	}
+	assert.Equal(t, []int{1, 2, 3}, frames)
+	assert.GreaterOrEqual(t, nmis, 2)
+	assert.Len(t, writes, nmis, "every NMI increments $11")
+	assert.Equal(t, uint8(nmis), writes[len(writes)-1])
+	assert.Equal(t, uint8(nmis), emu.ReadMemory(0x11))
+	assert.Equal(t, nes.ButtonA|nes.ButtonStart, emu.console.InputView().Buttons[1])
+	emu.SetInput(4, ButtonA)
+	emu.SetInput(-1, ButtonA)
+	assert.Greater(t, emu.ReadSamples(make([]float32, 4096)), 0)
+}
+
+func Test_Emulator_SetInput(t *testing.T) {
+	emu := openTestROM(t)
+	emu.SetInput(0, ButtonRight|ButtonSelect)
+	emu.SetInput(3, ButtonUp)
+	emu.RunFrame()
+	assert.Equal(t, [4]nes.Button{nes.ButtonRight | nes.ButtonSelect, 0, 0, nes.ButtonUp}, emu.console.InputView().Buttons)
+	assert.Equal(t, nes.FrameWidth, emu.Frame().Bounds().Dx())
+	assert.Equal(t, nes.FrameHeight, emu.Frame().Bounds().Dy())
+}
+
+func Test_Emulator_Overlay(t *testing.T) {
+	emu := openTestROM(t)
+	emu.RunFrame()
+	red := color.RGBA{0xFF, 0, 0, 0xFF}
+	emu.DrawOverlay(func(dst *image.RGBA) {
+		dst.SetRGBA(5, 5, red)
+	})
+	assert.Equal(t, red, emu.Frame().RGBAAt(5, 5))
+	assert.NotEqual(t, red, emu.console.PPU().Frame().RGBAAt(5, 5), "the console frame stays as it was")
+}
+
+func Test_Emulator_State(t *testing.T) {
+	emu := openTestROM(t)
+	emu.RunFrame()
+	emu.WriteMemory(0x0300, 0x42)
+	var state bytes.Buffer
+	require.NoError(t, emu.SaveState(&state))
+	regs := emu.Registers()
+
+	emu.RunFrame()
+	emu.WriteMemory(0x0300, 0)
+	require.NoError(t, emu.LoadState(&state))
+	assert.Equal(t, uint8(0x42), emu.ReadMemory(0x0300))
+	assert.Equal(t, regs, emu.Registers())
+
+	_, err := Open(filepath.Join(t.TempDir(), "none.nes"))
+	assert.ErrorContains(t, err, "couldn't load the ROM")
+}
@@ -0,0 +1,71 @@
+// Package audio plays the samples produced by the emulator on the audio device.
+//
+// The device backend uses oto and needs cgo with the platform audio
+// libraries (ALSA on Linux), so it is built only with the oto build tag.
+// Without it, or without an audio device, NewPlayer returns an error and
+// the emulator runs silently.
+package audio
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// Source produces mono samples, or interleaved stereo samples
+type Source interface {
+	ReadSamples(dst []float32) int
+}
+
+// Options of the audio output
+type Options struct {
+	SampleRate int
+	// Channels is 1 for mono or 2 for stereo. 0: mono
+	Channels int
+	// BufferSize is the size of the device buffer.
+	// Smaller buffers have less latency but may crackle. 0: the device default
+	BufferSize time.Duration
+}
+
+// sourceReader adapts the source into the float32 little endian byte
+// stream the device reads. When the source has no samples, the last
+// sample is repeated, so the underrun is silent instead of a click
+type sourceReader struct {
+	src       Source
+	samples   []float32
+	last      []float32 // the last sample, a value per channel
+	underruns atomic.Uint64
+}
+
+func newSourceReader(src Source, channels int) *sourceReader {
+	return &sourceReader{src: src, last: make([]float32, max(channels, 1))}
+}
+
+func (r *sourceReader) Read(p []byte) (int, error) {
+	channels := len(r.last)
+	n := len(p) / 4 / channels * channels
+	if n == 0 {
+		return 0, io.ErrShortBuffer
+	}
+	if cap(r.samples) < n {
+		r.samples = make([]float32, n)
+	}
+	samples := r.samples[:n]
+	read := r.src.ReadSamples(samples)
+	read -= read % channels
+	if read < n {
+		r.underruns.Add(1)
+	}
+	if read > 0 {
+		copy(r.last, samples[read-channels:read])
+	}
+	for i := read; i < n; i++ {
+		samples[i] = r.last[i%channels]
+	}
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint32(p[i*4:], math.Float32bits(sample))
+	}
+	return n * 4, nil
+}
@@ -0,0 +1,63 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testSource []float32
+
+func (s *testSource) ReadSamples(dst []float32) int {
+	n := copy(dst, *s)
+	*s = (*s)[n:]
+	return n
+}
+
+func Test_SourceReader(t *testing.T) {
+	src := &testSource{0.25, 0.5}
+	r := newSourceReader(src, 1)
+
+	buf := make([]byte, 16)
+	n, err := r.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 16, n)
+
+	var samples []float32
+	for i := 0; i < 4; i++ {
+		samples = append(samples, math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:])))
+	}
+	assert.Equal(t, []float32{0.25, 0.5, 0.5, 0.5}, samples, "an underrun repeats the last sample")
+	assert.Equal(t, uint64(1), r.underruns.Load())
+}
+
+func Test_SourceReader_Underruns(t *testing.T) {
+	src := &testSource{0.25, 0.5, 0.75, 1}
+	r := newSourceReader(src, 1)
+
+	buf := make([]byte, 8)
+	r.Read(buf)
+	r.Read(buf)
+	assert.Zero(t, r.underruns.Load(), "the source had the samples")
+	r.Read(buf)
+	r.Read(buf)
+	assert.Equal(t, uint64(2), r.underruns.Load())
+}
+
+func Test_SourceReader_Stereo(t *testing.T) {
+	src := &testSource{0.25, 0.5, 0.75}
+	r := newSourceReader(src, 2)
+
+	buf := make([]byte, 20)
+	n, err := r.Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 16, n, "only whole samples are written")
+
+	var samples []float32
+	for i := 0; i < 4; i++ {
+		samples = append(samples, math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:])))
+	}
+	assert.Equal(t, []float32{0.25, 0.5, 0.25, 0.5}, samples, "an underrun repeats the last sample")
+}
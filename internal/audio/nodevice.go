@@ -0,0 +1,40 @@
+//go:build !oto
+
+package audio
+
+import "errors"
+
+var errNoDevice = errors.New("built without audio support, rebuild with -tags oto")
+
+// Device is the audio device. The players of several consoles
+// play on it together
+type Device struct{}
+
+// OpenDevice returns an error, the emulator is built without audio support
+func OpenDevice(opts Options) (*Device, error) {
+	return nil, errNoDevice
+}
+
+// NewPlayer starts playing the source on the device
+func (d *Device) NewPlayer(src Source) *Player {
+	return &Player{}
+}
+
+// Player plays the source on the audio device
+type Player struct{}
+
+// NewPlayer returns an error, the emulator is built without audio support
+func NewPlayer(src Source, opts Options) (*Player, error) {
+	return nil, errNoDevice
+}
+
+// Close stops the playback
+func (p *Player) Close() error {
+	return nil
+}
+
+// Underruns returns how many times the device read
+// more samples than the source had
+func (p *Player) Underruns() uint64 {
+	return 0
+}
@@ -0,0 +1,66 @@
+//go:build oto
+
+package audio
+
+import (
+	"fmt"
+
+	"github.com/ebitengine/oto/v3"
+)
+
+// Device is the audio device. The players of several consoles
+// play on it together, oto opens the device once per process
+type Device struct {
+	ctx      *oto.Context
+	channels int
+}
+
+// OpenDevice opens the audio device, the options are of all its players
+func OpenDevice(opts Options) (*Device, error) {
+	channels := max(opts.Channels, 1)
+	ctx, ready, err := oto.NewContext(&oto.NewContextOptions{
+		SampleRate:   opts.SampleRate,
+		ChannelCount: channels,
+		Format:       oto.FormatFloat32LE,
+		BufferSize:   opts.BufferSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open the audio device: %s", err)
+	}
+	<-ready
+	return &Device{ctx: ctx, channels: channels}, nil
+}
+
+// NewPlayer starts playing the source on the device
+func (d *Device) NewPlayer(src Source) *Player {
+	p := &Player{reader: newSourceReader(src, d.channels)}
+	p.player = d.ctx.NewPlayer(p.reader)
+	p.player.Play()
+	return p
+}
+
+// Player plays the source on the audio device
+type Player struct {
+	player *oto.Player
+	reader *sourceReader
+}
+
+// NewPlayer opens the audio device and starts playing the source
+func NewPlayer(src Source, opts Options) (*Player, error) {
+	d, err := OpenDevice(opts)
+	if err != nil {
+		return nil, err
+	}
+	return d.NewPlayer(src), nil
+}
+
+// Close stops the playback
+func (p *Player) Close() error {
+	return p.player.Close()
+}
+
+// Underruns returns how many times the device read
+// more samples than the source had
+func (p *Player) Underruns() uint64 {
+	return p.reader.underruns.Load()
+}
@@ -0,0 +1,110 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// wavHeader is the header of the 16-bit PCM WAV file
+type wavHeader struct {
+	Riff          [4]byte
+	RiffSize      uint32
+	Wave          [4]byte
+	Fmt           [4]byte
+	FmtSize       uint32
+	Format        uint16
+	Channels      uint16
+	SampleRate    uint32
+	ByteRate      uint32
+	BlockAlign    uint16
+	BitsPerSample uint16
+	Data          [4]byte
+	DataSize      uint32
+}
+
+// wavHeaderSize is the size of the encoded wavHeader
+const wavHeaderSize = 44
+
+func newWAVHeader(size int, sampleRate int, channels int) wavHeader {
+	return wavHeader{
+		Riff:          [4]byte{'R', 'I', 'F', 'F'},
+		RiffSize:      uint32(wavHeaderSize - 8 + size),
+		Wave:          [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:           [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		Format:        1, // PCM
+		Channels:      uint16(channels),
+		SampleRate:    uint32(sampleRate),
+		ByteRate:      uint32(sampleRate * channels * 2),
+		BlockAlign:    uint16(channels * 2),
+		BitsPerSample: 16,
+		Data:          [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      uint32(size),
+	}
+}
+
+// appendPCM appends the samples as 16-bit PCM, clipped to -1..1
+func appendPCM(data []byte, samples []float32) []byte {
+	for _, sample := range samples {
+		v := math.Round(float64(max(-1, min(sample, 1))) * math.MaxInt16)
+		data = binary.LittleEndian.AppendUint16(data, uint16(int16(v)))
+	}
+	return data
+}
+
+// WriteWAV writes the samples as a 16-bit PCM WAV file,
+// the stereo samples are interleaved: left, right
+func WriteWAV(w io.Writer, samples []float32, sampleRate int, channels int) error {
+	channels = max(channels, 1)
+	size := len(samples) * 2
+	if err := binary.Write(w, binary.LittleEndian, newWAVHeader(size, sampleRate, channels)); err != nil {
+		return fmt.Errorf("couldn't write the header: %s", err)
+	}
+	if _, err := w.Write(appendPCM(make([]byte, 0, size), samples)); err != nil {
+		return fmt.Errorf("couldn't write the samples: %s", err)
+	}
+	return nil
+}
+
+// WAVWriter streams the samples into a 16-bit PCM WAV file.
+// The sizes in the header are written on Close
+type WAVWriter struct {
+	w          io.WriteSeeker
+	sampleRate int
+	channels   int
+	size       int
+	buf        []byte
+}
+
+// NewWAVWriter writes the header with no samples yet
+func NewWAVWriter(w io.WriteSeeker, sampleRate int, channels int) (*WAVWriter, error) {
+	ww := &WAVWriter{w: w, sampleRate: sampleRate, channels: max(channels, 1)}
+	if err := binary.Write(w, binary.LittleEndian, newWAVHeader(0, sampleRate, ww.channels)); err != nil {
+		return nil, fmt.Errorf("couldn't write the header: %s", err)
+	}
+	return ww, nil
+}
+
+// Write appends the samples
+func (w *WAVWriter) Write(samples []float32) error {
+	w.buf = appendPCM(w.buf[:0], samples)
+	if _, err := w.w.Write(w.buf); err != nil {
+		return fmt.Errorf("couldn't write the samples: %s", err)
+	}
+	w.size += len(w.buf)
+	return nil
+}
+
+// Close writes the sizes into the header, it doesn't close the writer
+func (w *WAVWriter) Close() error {
+	if _, err := w.w.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("couldn't seek to the header: %s", err)
+	}
+	if err := binary.Write(w.w, binary.LittleEndian, newWAVHeader(w.size, w.sampleRate, w.channels)); err != nil {
+		return fmt.Errorf("couldn't write the header: %s", err)
+	}
+	_, err := w.w.Seek(0, io.SeekEnd)
+	return err
+}
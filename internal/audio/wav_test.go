@@ -0,0 +1,49 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_WriteWAV(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteWAV(&buf, []float32{0, 1, -1, 2}, 44100, 2))
+
+	data := buf.Bytes()
+	assert.Len(t, data, 44+8)
+	assert.Equal(t, "RIFF", string(data[0:4]))
+	assert.Equal(t, uint32(36+8), binary.LittleEndian.Uint32(data[4:]))
+	assert.Equal(t, "WAVEfmt ", string(data[8:16]))
+	assert.Equal(t, uint16(2), binary.LittleEndian.Uint16(data[22:]))
+	assert.Equal(t, uint32(44100), binary.LittleEndian.Uint32(data[24:]))
+	assert.Equal(t, "data", string(data[36:40]))
+
+	var samples []int16
+	for i := 44; i < len(data); i += 2 {
+		samples = append(samples, int16(binary.LittleEndian.Uint16(data[i:])))
+	}
+	assert.Equal(t, []int16{0, 32767, -32767, 32767}, samples, "the samples are clipped")
+}
+
+func Test_WAVWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.wav")
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	w, err := NewWAVWriter(file, 44100, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write([]float32{0, 1}))
+	assert.NoError(t, w.Write([]float32{-1, 2}))
+	assert.NoError(t, w.Close())
+	assert.NoError(t, file.Close())
+
+	var expected bytes.Buffer
+	assert.NoError(t, WriteWAV(&expected, []float32{0, 1, -1, 2}, 44100, 2))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, expected.Bytes(), data)
+}
@@ -0,0 +1,69 @@
+package cheats
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// the letters of the Game Genie codes, a letter is 4 bits
+const genieLetters = "APZLGITYEOXUKSVN"
+
+// DecodeGameGenie decodes the 6-letter Game Genie code into the address
+// and the value, and the 8-letter one into the address, the value and
+// the compare value
+func DecodeGameGenie(code string) (nes.ROMPatch, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 6 && len(code) != 8 {
+		return nes.ROMPatch{}, fmt.Errorf("invalid Game Genie code %q: it has 6 or 8 letters", code)
+	}
+	n := make([]uint16, len(code))
+	for i, c := range code {
+		v := strings.IndexRune(genieLetters, c)
+		if v < 0 {
+			return nes.ROMPatch{}, fmt.Errorf("invalid Game Genie code %q: no letter %q", code, c)
+		}
+		n[i] = uint16(v)
+	}
+
+	p := nes.ROMPatch{
+		Addr: 0x8000 | (n[3]&7)<<12 | (n[5]&7)<<8 | (n[4]&8)<<8 |
+			(n[2]&7)<<4 | (n[1]&8)<<4 | n[4]&7 | n[3]&8,
+	}
+	value := (n[1]&7)<<4 | (n[0]&8)<<4 | n[0]&7
+	if len(n) == 6 {
+		p.Value = uint8(value | n[5]&8)
+		return p, nil
+	}
+	p.Value = uint8(value | n[7]&8)
+	p.Compare = uint8((n[7]&7)<<4 | (n[6]&8)<<4 | n[6]&7 | n[5]&8)
+	p.HasCompare = true
+	return p, nil
+}
+
+// EncodeGameGenie returns the Game Genie code of the patch,
+// of 8 letters with the compare value
+func EncodeGameGenie(p nes.ROMPatch) string {
+	addr, value, compare := p.Addr, uint16(p.Value), uint16(p.Compare)
+	n := []uint16{
+		(value>>4)&8 | value&7,
+		(addr>>4)&8 | (value>>4)&7,
+		(addr >> 4) & 7,
+		addr&8 | (addr>>12)&7,
+		(addr>>8)&8 | addr&7,
+		(addr >> 8) & 7,
+	}
+	if p.HasCompare {
+		n[2] |= 8 // the code has 8 letters
+		n[5] |= compare & 8
+		n = append(n, (compare>>4)&8|compare&7, value&8|(compare>>4)&7)
+	} else {
+		n[5] |= value & 8
+	}
+	var code strings.Builder
+	for _, v := range n {
+		code.WriteByte(genieLetters[v])
+	}
+	return code.String()
+}
@@ -0,0 +1,35 @@
+package cheats
+
+import (
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DecodeGameGenie(t *testing.T) {
+	p, err := DecodeGameGenie("SXIOPO")
+	require.NoError(t, err)
+	assert.Equal(t, nes.ROMPatch{Addr: 0x91D9, Value: 0xAD}, p)
+
+	p, err = DecodeGameGenie(" zexpygla ")
+	require.NoError(t, err)
+	assert.Equal(t, nes.ROMPatch{Addr: 0x94A7, Value: 0x02, Compare: 0x03, HasCompare: true}, p)
+
+	_, err = DecodeGameGenie("SXIOP")
+	assert.Error(t, err)
+	_, err = DecodeGameGenie("SXIOPB")
+	assert.Error(t, err)
+}
+
+func Test_EncodeGameGenie(t *testing.T) {
+	for _, code := range []string{"SXIOPO", "ZEXPYGLA", "AAAAAA", "NNNNNNNN"} {
+		p, err := DecodeGameGenie(code)
+		require.NoError(t, err)
+		p2, err := DecodeGameGenie(EncodeGameGenie(p))
+		require.NoError(t, err)
+		assert.Equal(t, p, p2, code)
+	}
+	assert.Equal(t, "SXIOPO", EncodeGameGenie(nes.ROMPatch{Addr: 0x91D9, Value: 0xAD}))
+}
@@ -0,0 +1,167 @@
+package cheats
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"gopkg.in/yaml.v3"
+)
+
+// Cheat is a code of the cheat list, a Game Genie code or a raw RAM code
+type Cheat struct {
+	Code    string `yaml:"code"`
+	Name    string `yaml:"name,omitempty"`
+	Enabled bool   `yaml:"enabled"`
+	// the RAM code keeps the value on the CPU writes too,
+	// not only before every frame
+	OnWrite bool `yaml:"on_write,omitempty"`
+}
+
+// List is the cheats of a game, every game has its file:
+//
+//	cheats:
+//	  - code: SXIOPO
+//	    name: Infinite lives
+//	    enabled: true
+//	  - code: 0075:09
+//	    name: 9 lives
+//	    enabled: true
+//	    on_write: true
+type List struct {
+	Cheats []Cheat `yaml:"cheats"`
+}
+
+// DefaultDir returns the cheats directory in the user config directory
+func DefaultDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("couldn't find the config directory: %s", err)
+	}
+	return filepath.Join(dir, "nestic", "cheats"), nil
+}
+
+// ListName returns the file name of the cheat list of the game: the ROM
+// name without the extension and the CRC32 of the game
+func ListName(game string, crc uint32) string {
+	name := strings.TrimSuffix(filepath.Base(game), filepath.Ext(game))
+	return fmt.Sprintf("%s-%08X.yaml", name, crc)
+}
+
+// LoadList reads the cheat list file, the missing file is the empty list
+func LoadList(path string) (*List, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &List{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read the file: %s", err)
+	}
+	var l List
+	if err := yaml.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("couldn't decode the cheat list: %s", err)
+	}
+	for _, c := range l.Cheats {
+		if err := checkCode(c.Code); err != nil {
+			return nil, err
+		}
+	}
+	return &l, nil
+}
+
+// Save writes the cheat list file
+func (l *List) Save(path string) error {
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return fmt.Errorf("couldn't encode the cheat list: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("couldn't create the directory: %s", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("couldn't write the file: %s", err)
+	}
+	return nil
+}
+
+// Add adds the enabled cheat to the end of the list
+func (l *List) Add(code, name string) error {
+	if err := checkCode(code); err != nil {
+		return err
+	}
+	l.Cheats = append(l.Cheats, Cheat{Code: strings.ToUpper(strings.TrimSpace(code)), Name: name, Enabled: true})
+	return nil
+}
+
+// Remove removes the cheat, the cheats are numbered from 0
+func (l *List) Remove(i int) error {
+	if err := l.check(i); err != nil {
+		return err
+	}
+	l.Cheats = append(l.Cheats[:i], l.Cheats[i+1:]...)
+	return nil
+}
+
+// SetEnabled enables or disables the cheat
+func (l *List) SetEnabled(i int, enabled bool) error {
+	if err := l.check(i); err != nil {
+		return err
+	}
+	l.Cheats[i].Enabled = enabled
+	return nil
+}
+
+// SetOnWrite sets whether the RAM code keeps the value on the CPU writes too
+func (l *List) SetOnWrite(i int, onWrite bool) error {
+	if err := l.check(i); err != nil {
+		return err
+	}
+	if !IsRAMCode(l.Cheats[i].Code) {
+		return fmt.Errorf("the cheat %s isn't a RAM code", l.Cheats[i].Code)
+	}
+	l.Cheats[i].OnWrite = onWrite
+	return nil
+}
+
+func (l *List) check(i int) error {
+	if i < 0 || i >= len(l.Cheats) {
+		return fmt.Errorf("no cheat %d", i)
+	}
+	return nil
+}
+
+// Apply sets the enabled cheats of the list to the console
+// in place of the ones set before
+func (l *List) Apply(console *nes.Bus) {
+	var patches []nes.ROMPatch
+	var freezes []nes.RAMFreeze
+	for _, c := range l.Cheats {
+		if !c.Enabled {
+			continue
+		}
+		// the codes are checked when they are added
+		if IsRAMCode(c.Code) {
+			if f, err := DecodeRAMCode(c.Code); err == nil {
+				f.OnWrite = c.OnWrite
+				freezes = append(freezes, f)
+			}
+		} else if p, err := DecodeGameGenie(c.Code); err == nil {
+			patches = append(patches, p)
+		}
+	}
+	console.SetROMPatches(patches)
+	console.SetRAMFreezes(freezes)
+}
+
+// checkCode checks the Game Genie code or the RAM code
+func checkCode(code string) error {
+	if IsRAMCode(code) {
+		_, err := DecodeRAMCode(code)
+		return err
+	}
+	_, err := DecodeGameGenie(code)
+	return err
+}
@@ -0,0 +1,66 @@
+package cheats
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_List_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cheats", ListName("dir/game.nes", 0xABCD))
+	assert.Equal(t, "game-0000ABCD.yaml", filepath.Base(path))
+
+	l, err := LoadList(path)
+	require.NoError(t, err, "no file is the empty list")
+	assert.Empty(t, l.Cheats)
+
+	require.NoError(t, l.Add("sxiopo", "Infinite lives"))
+	require.NoError(t, l.Add("ZEXPYGLA", ""))
+	assert.Error(t, l.Add("QQQQQQ", ""))
+	require.NoError(t, l.SetEnabled(1, false))
+	assert.Error(t, l.SetEnabled(2, false))
+	require.NoError(t, l.Save(path))
+
+	l, err = LoadList(path)
+	require.NoError(t, err)
+	assert.Equal(t, []Cheat{
+		{Code: "SXIOPO", Name: "Infinite lives", Enabled: true},
+		{Code: "ZEXPYGLA"},
+	}, l.Cheats)
+
+	require.NoError(t, l.Remove(0))
+	assert.Equal(t, []Cheat{{Code: "ZEXPYGLA"}}, l.Cheats)
+	assert.Error(t, l.Remove(1))
+}
+
+func Test_List_Apply(t *testing.T) {
+	l := &List{Cheats: []Cheat{
+		{Code: "SXIOPO", Enabled: true},
+		{Code: "ZEXPYGLA"},
+	}}
+	console := nes.NewBus()
+	l.Apply(console)
+	assert.Equal(t, []nes.ROMPatch{{Addr: 0x91D9, Value: 0xAD}}, console.ROMPatches())
+
+	l.Cheats[0].Enabled = false
+	l.Apply(console)
+	assert.Empty(t, console.ROMPatches())
+}
+
+func Test_List_RAMCodes(t *testing.T) {
+	l := &List{}
+	require.NoError(t, l.Add("0075:09", "9 lives"))
+	require.NoError(t, l.Add("SXIOPO", ""))
+	require.NoError(t, l.Add("0110:ff", ""))
+	assert.Error(t, l.Add("6010:ff", ""), "the cartridge has no RAM")
+	require.NoError(t, l.SetOnWrite(0, true))
+	assert.Error(t, l.SetOnWrite(1, true), "not a RAM code")
+
+	console := nes.NewBus()
+	l.Apply(console)
+	assert.Equal(t, []nes.RAMFreeze{{Addr: 0x75, Value: 9, OnWrite: true}, {Addr: 0x110, Value: 0xFF}}, console.RAMFreezes())
+	assert.Len(t, console.ROMPatches(), 1)
+}
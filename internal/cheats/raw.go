@@ -0,0 +1,46 @@
+package cheats
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// IsRAMCode reports whether the code is a raw RAM code, not a Game Genie one
+func IsRAMCode(code string) bool {
+	return strings.Contains(code, ":")
+}
+
+// DecodeRAMCode decodes the raw RAM code AAAA:VV, the Pro Action Replay
+// way: the hex address of the RAM, $0000-$07FF, and the hex value it is
+// frozen at. The cartridges have no RAM at $6000-$7FFF, the codes of it
+// are rejected
+func DecodeRAMCode(code string) (nes.RAMFreeze, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	addrText, valueText, ok := strings.Cut(code, ":")
+	if !ok || len(addrText) != 4 || len(valueText) != 2 {
+		return nes.RAMFreeze{}, fmt.Errorf("invalid RAM code %q: it is AAAA:VV", code)
+	}
+	addr, err := strconv.ParseUint(addrText, 16, 16)
+	if err != nil {
+		return nes.RAMFreeze{}, fmt.Errorf("invalid RAM code %q: the address isn't hex", code)
+	}
+	value, err := strconv.ParseUint(valueText, 16, 8)
+	if err != nil {
+		return nes.RAMFreeze{}, fmt.Errorf("invalid RAM code %q: the value isn't hex", code)
+	}
+	if addr >= 0x6000 && addr < 0x8000 {
+		return nes.RAMFreeze{}, fmt.Errorf("invalid RAM code %q: the cartridge has no RAM", code)
+	}
+	if addr >= 0x0800 {
+		return nes.RAMFreeze{}, fmt.Errorf("invalid RAM code %q: the address isn't in the RAM", code)
+	}
+	return nes.RAMFreeze{Addr: uint16(addr), Value: uint8(value)}, nil
+}
+
+// EncodeRAMCode returns the raw RAM code of the frozen address
+func EncodeRAMCode(f nes.RAMFreeze) string {
+	return fmt.Sprintf("%04X:%02X", f.Addr, f.Value)
+}
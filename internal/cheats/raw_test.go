@@ -0,0 +1,26 @@
+package cheats
+
+import (
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_DecodeRAMCode(t *testing.T) {
+	f, err := DecodeRAMCode(" 075a:0f ")
+	require.NoError(t, err)
+	assert.Equal(t, nes.RAMFreeze{Addr: 0x075A, Value: 0x0F}, f)
+	assert.Equal(t, "075A:0F", EncodeRAMCode(f))
+
+	_, err = DecodeRAMCode("7FFF:80")
+	assert.ErrorContains(t, err, "the cartridge has no RAM")
+
+	for _, code := range []string{"75:09", "0075:9", "00G5:09", "0075:0G", "0800:00", "8000:00", "0075"} {
+		_, err := DecodeRAMCode(code)
+		assert.Error(t, err, code)
+	}
+	assert.True(t, IsRAMCode("0075:09"))
+	assert.False(t, IsRAMCode("SXIOPO"))
+}
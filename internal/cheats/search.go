@@ -0,0 +1,152 @@
+// Package cheats finds and applies the cheats: the RAM search locates
+// the addresses of the lives or the health, the Game Genie codes of the
+// cheat list of the game patch the reads of the cartridge and its raw
+// RAM codes freeze the addresses found.
+package cheats
+
+import "fmt"
+
+// Width is how many bytes a value of the search takes,
+// the 16-bit values are little-endian
+type Width uint8
+
+const (
+	Width8 Width = iota
+	Width16
+)
+
+// Compare is how the values are compared with the previous ones,
+// the way the cheat search of FCEUX compares them
+type Compare uint8
+
+const (
+	CompareKnown    Compare = iota // the value is the operand
+	CompareEqual                   // the value didn't change
+	CompareNotEqual                // the value changed, by the operand unless it is 0
+	CompareLess                    // the value went down, by the operand unless it is 0
+	CompareGreater                 // the value went up, by the operand unless it is 0
+)
+
+var compareNames = []string{"known", "equal", "not_equal", "less", "greater"}
+
+func (c Compare) String() string {
+	if int(c) < len(compareNames) {
+		return compareNames[c]
+	}
+	return fmt.Sprintf("Compare(%d)", int(c))
+}
+
+// ParseCompare returns the comparison by its name, e.g. less
+func ParseCompare(s string) (Compare, error) {
+	for i, name := range compareNames {
+		if name == s {
+			return Compare(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown comparison %q", s)
+}
+
+// Result is a candidate address of the search
+type Result struct {
+	Addr     uint16
+	Value    int
+	Previous int
+}
+
+// Search narrows the addresses of the RAM down to the ones
+// whose values changed the way the game value did
+type Search struct {
+	width      Width
+	signed     bool
+	previous   []uint8 // the RAM the values are compared with
+	candidates []uint16
+}
+
+// NewSearch starts the search with all the addresses of the RAM
+// as the candidates
+func NewSearch(ram []uint8, width Width, signed bool) *Search {
+	s := &Search{width: width, signed: signed}
+	s.Reset(ram)
+	return s
+}
+
+// Reset starts the search over
+func (s *Search) Reset(ram []uint8) {
+	s.previous = append(s.previous[:0], ram...)
+	s.candidates = s.candidates[:0]
+	for addr := 0; addr+s.bytes() <= len(ram); addr++ {
+		s.candidates = append(s.candidates, uint16(addr))
+	}
+}
+
+func (s *Search) bytes() int {
+	if s.width == Width16 {
+		return 2
+	}
+	return 1
+}
+
+// value returns the value at the address in the view of the search
+func (s *Search) value(ram []uint8, addr uint16) int {
+	if s.width == Width16 {
+		v := uint16(ram[addr]) | uint16(ram[addr+1])<<8
+		if s.signed {
+			return int(int16(v))
+		}
+		return int(v)
+	}
+	if s.signed {
+		return int(int8(ram[addr]))
+	}
+	return int(ram[addr])
+}
+
+// Filter keeps the candidates whose values compare with the previous ones,
+// the RAM becomes the previous one. It returns how many candidates are left
+func (s *Search) Filter(ram []uint8, cmp Compare, operand int) int {
+	kept := s.candidates[:0]
+	for _, addr := range s.candidates {
+		if int(addr)+s.bytes() > len(ram) {
+			continue
+		}
+		v, prev := s.value(ram, addr), s.value(s.previous, addr)
+		var ok bool
+		switch cmp {
+		case CompareKnown:
+			ok = v == operand
+		case CompareEqual:
+			ok = v == prev
+		case CompareNotEqual:
+			ok = v != prev && (operand == 0 || v-prev == operand || prev-v == operand)
+		case CompareLess:
+			ok = v < prev && (operand == 0 || prev-v == operand)
+		case CompareGreater:
+			ok = v > prev && (operand == 0 || v-prev == operand)
+		}
+		if ok {
+			kept = append(kept, addr)
+		}
+	}
+	s.candidates = kept
+	s.previous = append(s.previous[:0], ram...)
+	return len(kept)
+}
+
+// Results returns the candidates with their values in the RAM and
+// in the snapshot the next filter compares with, but the ones past
+// the end of the RAM
+func (s *Search) Results(ram []uint8) []Result {
+	results := make([]Result, 0, len(s.candidates))
+	for _, addr := range s.candidates {
+		if int(addr)+s.bytes() > min(len(ram), len(s.previous)) {
+			continue
+		}
+		results = append(results, Result{Addr: addr, Value: s.value(ram, addr), Previous: s.value(s.previous, addr)})
+	}
+	return results
+}
+
+// Count returns how many candidates are left
+func (s *Search) Count() int {
+	return len(s.candidates)
+}
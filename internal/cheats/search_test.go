@@ -0,0 +1,61 @@
+package cheats
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Search_Filter(t *testing.T) {
+	ram := make([]uint8, 0x800)
+	ram[0x30], ram[0x31] = 3, 3 // the lives and a lookalike
+	s := NewSearch(ram, Width8, false)
+	assert.Equal(t, 0x800, s.Count())
+
+	assert.Equal(t, 2, s.Filter(ram, CompareKnown, 3))
+
+	ram[0x30], ram[0x31] = 2, 5
+	assert.Equal(t, 1, s.Filter(ram, CompareLess, 1), "a life is lost")
+	assert.Equal(t, []Result{{Addr: 0x30, Value: 2, Previous: 2}}, s.Results(ram))
+
+	assert.Equal(t, 1, s.Filter(ram, CompareEqual, 0))
+	ram[0x30] = 4
+	assert.Equal(t, 0, s.Filter(ram, CompareGreater, 1), "not by 1")
+
+	s.Reset(ram)
+	assert.Equal(t, 0x800, s.Count())
+}
+
+func Test_Search_Views(t *testing.T) {
+	ram := make([]uint8, 0x800)
+	ram[0x10], ram[0x11] = 0xFF, 0xFF
+	s := NewSearch(ram, Width16, true)
+	assert.Equal(t, 0x7FF, s.Count(), "the last byte starts no 16-bit value")
+	assert.Equal(t, 1, s.Filter(ram, CompareKnown, -1))
+
+	ram[0x10], ram[0x11] = 0x01, 0x01
+	assert.Equal(t, 1, s.Filter(ram, CompareNotEqual, 258), "-1 to 257")
+	assert.Equal(t, []Result{{Addr: 0x10, Value: 257, Previous: 257}}, s.Results(ram))
+
+	s = NewSearch(ram, Width8, true)
+	ram[0x20] = 0x80
+	assert.Equal(t, 1, s.Filter(ram, CompareLess, 128), "0 to -128")
+}
+
+func Test_ParseCompare(t *testing.T) {
+	c, err := ParseCompare("not_equal")
+	require.NoError(t, err)
+	assert.Equal(t, CompareNotEqual, c)
+	assert.Equal(t, "greater", CompareGreater.String())
+	_, err = ParseCompare("bigger")
+	assert.EqualError(t, err, `unknown comparison "bigger"`)
+}
+
+func Test_Search_Results_ShortRAM(t *testing.T) {
+	ram := make([]uint8, 0x10)
+	s := NewSearch(ram, Width16, false)
+	results := s.Results(ram[:4])
+	assert.Len(t, results, 3, "the values past the end of the RAM are left out")
+	assert.Equal(t, uint16(2), results[2].Addr)
+}
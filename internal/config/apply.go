@@ -0,0 +1,245 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path/filepath"
+
+	"github.com/nevisdale/nestic/internal/debugger"
+	"github.com/nevisdale/nestic/internal/debugserver"
+	"github.com/nevisdale/nestic/internal/frontend"
+	"github.com/nevisdale/nestic/internal/gdbstub"
+	"github.com/nevisdale/nestic/internal/input"
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/script"
+	"github.com/nevisdale/nestic/internal/symbols"
+)
+
+// Apply sets the emulation, the video and the audio options
+// and plugs in the devices, before the cart is loaded
+func (c *Config) Apply(console *nes.Bus) error {
+	mode, err := nes.ParseRenderMode(c.Emulation.Render)
+	if err != nil {
+		return fmt.Errorf("invalid render mode: %s", err)
+	}
+	console.SetRenderMode(mode)
+	console.PPU().SetSpriteLimit(c.Emulation.SpriteLimit)
+	palette, err := c.palette()
+	if err != nil {
+		return err
+	}
+	console.PPU().SetPalette(palette)
+
+	apu := console.APU()
+	apu.SetAccuracy(c.Emulation.APUAccuracy)
+	apu.SetOutputFilters(c.Audio.Filters)
+	apu.SetStereo(c.Audio.Stereo)
+	for _, name := range c.Audio.Mute {
+		channel, err := nes.ParseChannel(name)
+		if err != nil {
+			return fmt.Errorf("invalid channel: %s", err)
+		}
+		apu.SetChannelMuted(channel, true)
+	}
+	for name, pan := range c.Audio.Pan {
+		channel, err := nes.ParseChannel(name)
+		if err != nil {
+			return fmt.Errorf("invalid channel: %s", err)
+		}
+		apu.SetChannelPan(channel, pan)
+	}
+
+	console.SetFourScore(c.Input.FourScore)
+	switch c.Input.Expansion {
+	case "":
+	case "keyboard":
+		console.SetExpansionDevice(nes.NewKeyboard())
+	case "paddle":
+		console.SetExpansionDevice(nes.NewFamicomPaddle())
+	case "trainer":
+		console.SetExpansionDevice(nes.NewFamilyTrainer())
+	default:
+		return fmt.Errorf("invalid expansion device %q", c.Input.Expansion)
+	}
+	for port, device := range c.Input.Ports {
+		switch device {
+		case "", "controller":
+		case "paddle":
+			console.SetPortDevice(port, nes.NewPaddle())
+		case "powerpad":
+			console.SetPortDevice(port, nes.NewPowerPad())
+		default:
+			return fmt.Errorf("invalid device %q in the port %d", device, port+1)
+		}
+	}
+	return nil
+}
+
+// palette returns the palette of the options, nil is the default one
+func (c *Config) palette() (*nes.Palette, error) {
+	v := c.Video
+	switch v.Palette {
+	case "":
+		return nil, nil
+	case "ntsc":
+		return nes.GeneratePalette(v.PaletteHue, v.PaletteSaturation, v.PaletteBrightness), nil
+	}
+	palette, err := nes.LoadPalette(v.Palette)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load the palette: %s", err)
+	}
+	return palette, nil
+}
+
+// Channels returns the number of the audio channels
+func (c *Config) Channels() int {
+	if c.Audio.Stereo {
+		return 2
+	}
+	return 1
+}
+
+// NewSession returns the session with the input options of the game
+// at the path, after the cart is loaded
+func (c *Config) NewSession(console *nes.Bus, romPath string) (*frontend.Session, error) {
+	s := frontend.NewSession(console, filepath.Base(romPath))
+	var err error
+	if c.Input.Keymap != "" {
+		if s.Keymap, err = input.LoadKeymap(c.Input.Keymap); err != nil {
+			return nil, fmt.Errorf("couldn't load the keymap: %s", err)
+		}
+	}
+	if c.Input.GamepadConfig != "" {
+		if s.Gamepads, err = input.LoadGamepadConfig(c.Input.GamepadConfig); err != nil {
+			return nil, fmt.Errorf("couldn't load the gamepad config: %s", err)
+		}
+	}
+	if s.Turbo, err = input.ParseTurboRate(c.Input.TurboRate); err != nil {
+		return nil, err
+	}
+	s.SetClipLength(c.Video.ClipLength)
+	s.SetRunAhead(c.Emulation.RunAhead)
+	background, err := frontend.ParseBackground(c.Emulation.Background)
+	if err != nil {
+		return nil, err
+	}
+	s.SetBackground(background)
+	if e := c.Emulation; e.Rewind {
+		s.SetRewind(frontend.RewindOptions{
+			Interval: max(1, min(e.RewindInterval, 8)),
+			Duration: e.RewindDuration,
+			Budget:   e.RewindBudget << 20,
+		})
+	}
+	resume, err := frontend.ParseResume(c.Emulation.Resume)
+	if err != nil {
+		return nil, err
+	}
+	hotkeys, err := c.Hotkeys()
+	if err != nil {
+		return nil, err
+	}
+	if c.Emulation.AutoSave {
+		s.SetAutoSave(c.Paths.States, c.Emulation.AutoSaveInterval)
+	}
+	s.SetAPULog(c.Emulation.APULog)
+	if err := s.Resume(resume, hotkeys.Keys(frontend.HotkeyLoadState)); err != nil {
+		s.OSD.Show("Couldn't resume: %s", err)
+	}
+	if err := s.SetCheatDir(c.Paths.Cheats); err != nil {
+		return nil, err
+	}
+	if c.Emulation.LuaScript != "" {
+		sc, err := script.Load(c.Emulation.LuaScript, console)
+		if err != nil {
+			return nil, err
+		}
+		s.SetScript(sc)
+	}
+	if c.Emulation.GDBServer == "" && c.Emulation.DebugServer == "" {
+		return s, nil
+	}
+	// the gdb stub and the debug server share the debugger,
+	// they serve until the frontend exits
+	d := debugger.New(console)
+	if c.Emulation.Symbols != "" {
+		table, err := symbols.Load(c.Emulation.Symbols)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't load the symbols: %s", err)
+		}
+		d.SetSymbols(table)
+	} else {
+		// the game may come without the symbol files
+		table, err := symbols.LoadGame(romPath)
+		if err != nil {
+			s.OSD.Show("Couldn't load the symbols: %s", err)
+		}
+		d.SetSymbols(table)
+	}
+	if c.Emulation.GDBServer != "" {
+		server, err := gdbstub.Listen(c.Emulation.GDBServer, d)
+		if err != nil {
+			return nil, err
+		}
+		go server.Serve()
+		s.OSD.Show("gdb: listening at %s", server.Addr())
+	}
+	if c.Emulation.DebugServer != "" {
+		l, err := net.Listen("tcp", c.Emulation.DebugServer)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't start the debug server: %s", err)
+		}
+		go http.Serve(l, debugserver.New(d))
+		s.OSD.Show("debug server: listening at %s", l.Addr())
+	}
+	s.SetDebugger(d)
+	return s, nil
+}
+
+// Hotkeys returns the default hotkeys with the keys of the options
+func (c *Config) Hotkeys() (*frontend.Hotkeys, error) {
+	h := frontend.DefaultHotkeys()
+	for name, keys := range c.Input.Hotkeys {
+		action, err := frontend.ParseHotkey(name)
+		if err != nil {
+			return nil, err
+		}
+		h.Set(action, keys)
+	}
+	return h, nil
+}
+
+// FramePacing returns what paces the frames
+func (c *Config) FramePacing() (frontend.FramePacing, error) {
+	return frontend.ParseFramePacing(c.Video.FramePacing)
+}
+
+// Shader returns the effects applied to the scaled picture
+func (c *Config) Shader() (frontend.Shader, error) {
+	return frontend.ParseShader(c.Video.Shader)
+}
+
+// PixelAspect returns the shape of the picture pixels
+func (c *Config) PixelAspect() (frontend.PixelAspect, error) {
+	return frontend.ParsePixelAspect(c.Video.Aspect)
+}
+
+// ScreenshotOptions returns how the screenshots are taken
+func (c *Config) ScreenshotOptions() frontend.ScreenshotOptions {
+	return frontend.ScreenshotOptions{
+		Dir:   c.Paths.Screenshots,
+		Scale: c.Video.ScreenshotScale,
+		Raw:   c.Video.ScreenshotRaw,
+	}
+}
+
+// VideoOptions returns how the videos are recorded
+func (c *Config) VideoOptions() frontend.VideoOptions {
+	return frontend.VideoOptions{Dir: c.Paths.Videos, Format: c.Video.VideoFormat, FFmpeg: c.Paths.FFmpeg}
+}
+
+// ClipOptions returns how the clips are saved
+func (c *Config) ClipOptions() frontend.ClipOptions {
+	return frontend.ClipOptions{Dir: c.Paths.Clips, Format: c.Video.ClipFormat, FFmpeg: c.Paths.FFmpeg}
+}
@@ -0,0 +1,249 @@
+// Package config holds the options of the frontends. They come from
+// the config file, and the command line flags override them:
+//
+//	video:
+//	  scale: 4
+//	  frame_pacing: audio
+//	audio:
+//	  stereo: true
+//	  pan: {triangle: -0.3, dmc: 0.5}
+//	input:
+//	  hotkeys: {pause: [P], screenshot: [F12, PrintScreen]}
+//
+// The options missing from the file keep their defaults.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the options of the frontends
+type Config struct {
+	Paths     Paths     `yaml:"paths"`
+	Video     Video     `yaml:"video"`
+	Audio     Audio     `yaml:"audio"`
+	Input     Input     `yaml:"input"`
+	Emulation Emulation `yaml:"emulation"`
+}
+
+// Paths are where the captures go and the tools they use
+type Paths struct {
+	Screenshots string `yaml:"screenshots"` // "": in the user config directory
+	Videos      string `yaml:"videos"`
+	Clips       string `yaml:"clips"`
+	States      string `yaml:"states"`
+	Cheats      string `yaml:"cheats"`
+	FFmpeg      string `yaml:"ffmpeg"`
+}
+
+// Video is the picture and the window
+type Video struct {
+	Scale          int    `yaml:"scale"` // the window size in multiples of the picture
+	Fullscreen     bool   `yaml:"fullscreen"`
+	IntegerScale   bool   `yaml:"integer_scale"`
+	RememberWindow bool   `yaml:"remember_window"`
+	FramePacing    string `yaml:"frame_pacing"` // vsync, audio or clock
+	Shader         string `yaml:"shader"`       // the comma separated effects, e.g. scanlines,curvature, or crt
+	Aspect         string `yaml:"aspect"`       // the pixel aspect: square or 8:7
+
+	Palette           string  `yaml:"palette"` // a .pal file, "ntsc" generates the palette
+	PaletteHue        float64 `yaml:"palette_hue"`
+	PaletteSaturation float64 `yaml:"palette_saturation"`
+	PaletteBrightness float64 `yaml:"palette_brightness"`
+
+	ScreenshotScale int           `yaml:"screenshot_scale"`
+	ScreenshotRaw   bool          `yaml:"screenshot_raw"`
+	VideoFormat     string        `yaml:"video_format"`
+	ClipFormat      string        `yaml:"clip_format"`
+	ClipLength      time.Duration `yaml:"clip_length"`
+}
+
+// Audio is the sound output
+type Audio struct {
+	Buffer     time.Duration      `yaml:"buffer"`      // 0: the device default
+	AutoBuffer bool               `yaml:"auto_buffer"` // grow the buffer from the smallest one while the sound breaks up
+	Filters    bool               `yaml:"filters"`
+	Stereo     bool               `yaml:"stereo"`
+	Pan        map[string]float64 `yaml:"pan"` // the channel positions from -1 (left) to 1 (right)
+	Mute       []string           `yaml:"mute"`
+}
+
+// Input is the devices and the bindings
+type Input struct {
+	Keymap        string              `yaml:"keymap"` // the keymap file, "": the default keymap
+	GamepadConfig string              `yaml:"gamepad_config"`
+	TurboRate     string              `yaml:"turbo_rate"` // on:off frames
+	FourScore     bool                `yaml:"four_score"`
+	Expansion     string              `yaml:"expansion"` // keyboard, paddle or trainer
+	Ports         [2]string           `yaml:"ports"`     // controller, paddle or powerpad
+	Hotkeys       map[string][]string `yaml:"hotkeys"`   // the keys replacing the default ones of the hotkeys
+}
+
+// Emulation is the accuracy and the speed
+type Emulation struct {
+	Render           string  `yaml:"render"` // dot (accurate) or scanline (fast)
+	SpriteLimit      bool    `yaml:"sprite_limit"`
+	APUAccuracy      bool    `yaml:"apu_accuracy"`
+	FastForwardSpeed float64 `yaml:"fast_forward_speed"` // 0: unlimited
+	FastForwardMute  bool    `yaml:"fast_forward_mute"`
+	SlowMotionMute   bool    `yaml:"slow_motion_mute"`
+	RunAhead         int     `yaml:"run_ahead"`  // the frames run ahead of the shown one to hide the input lag
+	Background       string  `yaml:"background"` // run, pause, mute or ignore_input without the focus
+
+	Rewind         bool          `yaml:"rewind"`
+	RewindDuration time.Duration `yaml:"rewind_duration"` // the longest past kept
+	RewindBudget   int           `yaml:"rewind_budget"`   // the megabytes the past takes at most, 0: no limit
+	RewindInterval int           `yaml:"rewind_interval"` // the frames between the kept states
+
+	AutoSave         bool          `yaml:"auto_save"`          // save the state on exit
+	AutoSaveInterval time.Duration `yaml:"auto_save_interval"` // and this often in case of a crash, 0: only on exit
+	Resume           string        `yaml:"resume"`             // off, ask or auto: the auto-saved state at the launch
+
+	LuaScript   string `yaml:"lua_script"`   // the Lua script run along the game, "": none
+	GDBServer   string `yaml:"gdb_server"`   // the address the GDB stub listens at, e.g. localhost:2345, "": none
+	DebugServer string `yaml:"debug_server"` // the address the HTTP debug API listens at, e.g. localhost:8080, "": none
+	Symbols     string `yaml:"symbols"`      // the labels of the debugger, .nl, .mlb or .dbg, "": the files next to the ROM
+	APULog      string `yaml:"apu_log"`      // the file the APU register writes are exported to on exit, "": none
+}
+
+// Default returns the default options
+func Default() *Config {
+	return &Config{
+		Video: Video{
+			Scale:             3,
+			IntegerScale:      true,
+			RememberWindow:    true,
+			FramePacing:       "vsync",
+			Shader:            "none",
+			Aspect:            "square",
+			PaletteSaturation: 1,
+			PaletteBrightness: 1,
+			ScreenshotScale:   1,
+			VideoFormat:       "mkv",
+			ClipFormat:        "gif",
+			ClipLength:        10 * time.Second,
+		},
+		Audio: Audio{Filters: true},
+		Input: Input{
+			TurboRate: "2:2",
+			Ports:     [2]string{"controller", "controller"},
+		},
+		Emulation: Emulation{
+			Render:           "dot",
+			SpriteLimit:      true,
+			FastForwardSpeed: 4,
+			Background:       "run",
+			RewindDuration:   time.Minute,
+			RewindBudget:     64,
+			RewindInterval:   2,
+			AutoSave:         true,
+			AutoSaveInterval: time.Minute,
+			Resume:           "ask",
+		},
+	}
+}
+
+// Path returns the path of the config file in the user config directory
+func Path() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("couldn't find the config directory: %s", err)
+	}
+	return filepath.Join(dir, "nestic", "config.yaml"), nil
+}
+
+// Load reads the config file over the options
+func (c *Config) Load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("couldn't open the file: %s", err)
+	}
+	defer file.Close()
+	return c.Read(file)
+}
+
+// Read reads the config over the options
+func (c *Config) Read(r io.Reader) error {
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("couldn't decode the config: %s", err)
+	}
+	return nil
+}
+
+// Write writes the options as the config file
+func (c *Config) Write(w io.Writer) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return fmt.Errorf("couldn't encode the config: %s", err)
+	}
+	return encoder.Close()
+}
+
+// ErrPrinted is returned by Parse when -print-config printed the options
+var ErrPrinted = errors.New("the config is printed")
+
+// Parse reads the config file and then the flags over the options. The file
+// is the -config flag or the one in the user config directory, if it exists.
+// With -print-config the options are printed to stdout and ErrPrinted is
+// returned
+func (c *Config) Parse(fs *flag.FlagSet, args []string) error {
+	path, explicit := configFlag(args)
+	if !explicit {
+		path, _ = Path()
+	}
+	if _, err := os.Stat(path); explicit || err == nil {
+		if err := c.Load(path); err != nil {
+			return fmt.Errorf("couldn't load the config %s: %s", path, err)
+		}
+	}
+
+	fs.String("config", path, "path to the config file, the flags override its options")
+	printConfig := fs.Bool("print-config", false, "print the options with the config file and the flags applied, and exit")
+	c.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *printConfig {
+		if err := c.Write(os.Stdout); err != nil {
+			return err
+		}
+		return ErrPrinted
+	}
+	return nil
+}
+
+// configFlag finds the -config flag in the arguments,
+// it is needed before the other flags are parsed
+func configFlag(args []string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "config" {
+			continue
+		}
+		if hasValue {
+			return value, true
+		}
+		if i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
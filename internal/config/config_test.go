@@ -0,0 +1,129 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/frontend"
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Config_Read(t *testing.T) {
+	c := Default()
+	err := c.Read(strings.NewReader(`
+video:
+  scale: 4
+  clip_length: 5s
+audio:
+  pan: {triangle: -0.5}
+  mute: [dmc]
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 4, c.Video.Scale)
+	assert.Equal(t, 5*time.Second, c.Video.ClipLength)
+	assert.True(t, c.Video.IntegerScale, "the missing options keep the defaults")
+	assert.Equal(t, map[string]float64{"triangle": -0.5}, c.Audio.Pan)
+	assert.Equal(t, []string{"dmc"}, c.Audio.Mute)
+
+	assert.Error(t, Default().Read(strings.NewReader("video:\n  scael: 4\n")), "unknown options")
+	assert.NoError(t, Default().Read(strings.NewReader("")))
+}
+
+func Test_Config_Write(t *testing.T) {
+	c := Default()
+	c.Input.Hotkeys = map[string][]string{"pause": {"P"}}
+	c.Audio.Pan = map[string]float64{"dmc": 0.5}
+	c.Audio.Mute = []string{"noise"}
+	var buf bytes.Buffer
+	assert.NoError(t, c.Write(&buf))
+
+	read := Default()
+	read.Video.Scale = 1
+	assert.NoError(t, read.Read(&buf))
+	assert.Equal(t, c, read)
+}
+
+func Test_Config_Parse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("video:\n  scale: 4\n  frame_pacing: audio\nemulation:\n  sprite_limit: true\n"), 0o644))
+
+	c := Default()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	err := c.Parse(fs, []string{"-scale", "2", "-config", path, "-no-sprite-limit", "-mute", "dmc,noise", "game.nes"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, c.Video.Scale, "the flags override the file")
+	assert.Equal(t, "audio", c.Video.FramePacing)
+	assert.False(t, c.Emulation.SpriteLimit)
+	assert.Equal(t, []string{"dmc", "noise"}, c.Audio.Mute)
+	assert.Equal(t, []string{"game.nes"}, fs.Args())
+
+	c = Default()
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	assert.Error(t, c.Parse(fs, []string{"-config=" + path + ".missing"}), "the given file must exist")
+}
+
+func Test_Config_Apply(t *testing.T) {
+	c := Default()
+	c.Audio.Stereo = true
+	c.Input.Ports[1] = "paddle"
+	c.Input.Expansion = "keyboard"
+	console := nes.NewBus()
+	assert.NoError(t, c.Apply(console))
+	assert.True(t, console.APU().Stereo())
+	assert.IsType(t, &nes.Paddle{}, console.PortDevice(1))
+	assert.IsType(t, &nes.Keyboard{}, console.ExpansionDevice())
+	assert.Equal(t, 2, c.Channels())
+
+	c = Default()
+	c.Audio.Mute = []string{"kazoo"}
+	assert.Error(t, c.Apply(nes.NewBus()))
+	c = Default()
+	c.Emulation.Render = "fast"
+	assert.Error(t, c.Apply(nes.NewBus()))
+}
+
+func Test_Config_Hotkeys(t *testing.T) {
+	c := Default()
+	c.Input.Hotkeys = map[string][]string{"pause": {"P"}}
+	h, err := c.Hotkeys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"P"}, h.Keys(frontend.HotkeyPause))
+	assert.Equal(t, []string{"F12"}, h.Keys(frontend.HotkeyScreenshot))
+
+	c.Input.Hotkeys = map[string][]string{"jump": {"P"}}
+	_, err = c.Hotkeys()
+	assert.Error(t, err)
+}
+
+func Test_Config_NewSession_Symbols(t *testing.T) {
+	dir := t.TempDir()
+	rom := make([]byte, 16+0x4000+0x2000)
+	copy(rom, "NES\x1a\x01\x01")
+	copy(rom[16:], []byte{0xA5, 0x10}) // LDA $10
+	path := filepath.Join(dir, "game.nes")
+	assert.NoError(t, os.WriteFile(path, rom, 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "game.nes.ram.nl"), []byte("$0010#lives#\n"), 0o644))
+	cart, err := nes.NewCartFromFile(path)
+	assert.NoError(t, err)
+	console := nes.NewBus()
+	console.LoadCart(cart)
+
+	c := Default()
+	c.Emulation.DebugServer = "localhost:0"
+	_, err = c.NewSession(console, path)
+	assert.NoError(t, err)
+	assert.Equal(t, "LDA lives", console.Disassemble(0x8000).Text, "the labels next to the ROM")
+
+	c.Emulation.Symbols = filepath.Join(dir, "missing.nl")
+	_, err = c.NewSession(console, path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RegisterFlags defines the flags of the options, their defaults
+// are the current values
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Paths.Screenshots, "screenshot-dir", c.Paths.Screenshots, "directory of the screenshots, default: screenshots in the user config directory")
+	fs.StringVar(&c.Paths.Videos, "video-dir", c.Paths.Videos, "directory of the video recordings, default: videos in the user config directory")
+	fs.StringVar(&c.Paths.Clips, "clip-dir", c.Paths.Clips, "directory of the clips, default: clips in the user config directory")
+	fs.StringVar(&c.Paths.States, "state-dir", c.Paths.States, "directory of the save states, default: states in the user config directory")
+	fs.StringVar(&c.Paths.Cheats, "cheat-dir", c.Paths.Cheats, "directory of the cheat lists of the games, default: cheats in the user config directory")
+	fs.StringVar(&c.Paths.FFmpeg, "ffmpeg", c.Paths.FFmpeg, "the ffmpeg command the videos and the clips are encoded by, default: ffmpeg")
+
+	v := &c.Video
+	fs.IntVar(&v.Scale, "scale", v.Scale, "initial window size in multiples of the picture, 1-6")
+	fs.BoolVar(&v.Fullscreen, "fullscreen", v.Fullscreen, "start in the borderless fullscreen")
+	fs.BoolVar(&v.IntegerScale, "integer-scale", v.IntegerScale, "scale the picture by whole multiples only")
+	fs.BoolVar(&v.RememberWindow, "remember-window", v.RememberWindow, "restore the window size and position of the last run")
+	fs.StringVar(&v.FramePacing, "frame-pacing", v.FramePacing, "pace the frames by the display refresh, by the audio device, or by the clock at the console frame rate: vsync, audio or clock")
+	fs.StringVar(&v.Shader, "shader", v.Shader, "comma separated effects applied to the scaled picture: scanlines, aperture_grille, curvature and ntsc_blur, crt for the first three, or none")
+	fs.StringVar(&v.Aspect, "aspect", v.Aspect, "pixel aspect ratio: square, or 8:7 wide as the TV showed them")
+	fs.StringVar(&v.Palette, "palette", v.Palette, "path to a .pal file, \"ntsc\" to generate the palette")
+	fs.Float64Var(&v.PaletteHue, "palette-hue", v.PaletteHue, "hue shift of the generated palette in degrees")
+	fs.Float64Var(&v.PaletteSaturation, "palette-saturation", v.PaletteSaturation, "saturation of the generated palette")
+	fs.Float64Var(&v.PaletteBrightness, "palette-brightness", v.PaletteBrightness, "brightness of the generated palette")
+	fs.IntVar(&v.ScreenshotScale, "screenshot-scale", v.ScreenshotScale, "scale the screenshots by the whole multiple")
+	fs.BoolVar(&v.ScreenshotRaw, "screenshot-raw", v.ScreenshotRaw, "take the screenshots without the video filter")
+	fs.StringVar(&v.VideoFormat, "video-format", v.VideoFormat, "format of the video recordings: mkv or mp4 encoded by ffmpeg, or y4m with a wav file")
+	fs.StringVar(&v.ClipFormat, "clip-format", v.ClipFormat, "format of the clips: gif, or webm encoded by ffmpeg")
+	fs.DurationVar(&v.ClipLength, "clip-length", v.ClipLength, "length of the clips saved by the hotkey, the last frames are kept for them, 0: off")
+
+	a := &c.Audio
+	fs.DurationVar(&a.Buffer, "audio-buffer", a.Buffer, "audio device buffer size, 0: the device default")
+	fs.BoolVar(&a.AutoBuffer, "audio-auto-buffer", a.AutoBuffer, "pick the smallest audio buffer the sound plays without breaking up, the buffer grows on every underrun")
+	fs.Var(notFlag{&a.Filters}, "no-audio-filters", "disable the console audio output filters")
+	fs.BoolVar(&a.Stereo, "stereo", a.Stereo, "stereo audio output with the channels panned")
+	fs.Var(panFlag{&a.Pan}, "pan", "comma separated channel positions from -1 (left) to 1 (right), e.g. triangle=-0.3,dmc=0.5")
+	fs.Var(listFlag{&a.Mute}, "mute", "comma separated sound channels to mute, e.g. triangle,dmc")
+
+	in := &c.Input
+	fs.StringVar(&in.Keymap, "keymap", in.Keymap, "path to the keymap file")
+	fs.StringVar(&in.GamepadConfig, "gamepad-config", in.GamepadConfig, "path to the gamepad mapping file")
+	fs.StringVar(&in.TurboRate, "turbo-rate", in.TurboRate, "frames the turbo buttons are pressed and released for, on:off")
+	fs.BoolVar(&in.FourScore, "four-score", in.FourScore, "plug in the Four Score for the controllers 3 and 4")
+	fs.StringVar(&in.Expansion, "expansion", in.Expansion, "device on the Famicom expansion port: keyboard (Family BASIC), paddle (Arkanoid) or trainer (Family Trainer mat)")
+	fs.StringVar(&in.Ports[0], "port1", in.Ports[0], "device in the first port: controller, paddle (Arkanoid) or powerpad")
+	fs.StringVar(&in.Ports[1], "port2", in.Ports[1], "device in the second port: controller, paddle (Arkanoid) or powerpad")
+
+	e := &c.Emulation
+	fs.StringVar(&e.Render, "render", e.Render, "PPU render mode: dot (accurate) or scanline (fast)")
+	fs.Var(notFlag{&e.SpriteLimit}, "no-sprite-limit", "render more than 8 sprites per scanline")
+	fs.BoolVar(&e.APUAccuracy, "apu-accuracy", e.APUAccuracy, "emulate the APU timing edge cases the test ROMs check")
+	fs.Float64Var(&e.FastForwardSpeed, "fast-forward-speed", e.FastForwardSpeed, "speed of the fast-forward in multiples of the normal speed, 0: unlimited")
+	fs.BoolVar(&e.FastForwardMute, "fast-forward-mute", e.FastForwardMute, "mute the fast-forward instead of playing the sound of a frame per real time frame")
+	fs.BoolVar(&e.SlowMotionMute, "slow-motion-mute", e.SlowMotionMute, "mute the slow motion instead of stretching the sound")
+	fs.IntVar(&e.RunAhead, "run-ahead", e.RunAhead, "frames run ahead of the shown one to cut the input lag of the game, 0-2, each costs a frame of the emulation")
+	fs.BoolVar(&e.Rewind, "rewind", e.Rewind, "keep the past of the console to go back to with the rewind hotkey")
+	fs.DurationVar(&e.RewindDuration, "rewind-duration", e.RewindDuration, "how far back the rewind goes")
+	fs.IntVar(&e.RewindBudget, "rewind-budget", e.RewindBudget, "the megabytes the past of the rewind takes at most, 0: no limit")
+	fs.IntVar(&e.RewindInterval, "rewind-interval", e.RewindInterval, "frames between the states kept for the rewind, 1-8")
+	fs.BoolVar(&e.AutoSave, "auto-save", e.AutoSave, "save the state of the game on exit to resume it at the next launch")
+	fs.DurationVar(&e.AutoSaveInterval, "auto-save-interval", e.AutoSaveInterval, "how often the state is auto-saved in case of a crash, 0: only on exit")
+	fs.StringVar(&e.Resume, "resume", e.Resume, "what happens to the auto-saved state at the launch: off, ask to offer it for a few seconds, or auto to load it")
+	fs.StringVar(&e.LuaScript, "lua", e.LuaScript, "Lua script to run along the game, the API of FCEUX, needs the build with the lua tag")
+	fs.StringVar(&e.GDBServer, "gdb", e.GDBServer, "listen for gdb at the address, e.g. localhost:2345, to debug the game with the gdb front-ends")
+	fs.StringVar(&e.DebugServer, "debug-server", e.DebugServer, "serve the HTTP and WebSocket debug API at the address, e.g. localhost:8080, for the debugger UIs and the tools")
+	fs.StringVar(&e.Symbols, "symbols", e.Symbols, "the labels of -gdb and -debug-server, .nl, .mlb or .dbg, without it the files next to the ROM are read")
+	fs.StringVar(&e.APULog, "apu-log", e.APULog, "path to export the APU register writes of the game to on exit")
+	fs.StringVar(&e.Background, "background", e.Background, "what the console does while the window doesn't have the focus: run, pause, mute, or ignore_input to run with the sound and without the input")
+}
+
+// notFlag is the boolean flag turning the option off, e.g. -no-sprite-limit
+type notFlag struct {
+	option *bool
+}
+
+func (f notFlag) String() string {
+	if f.option == nil {
+		return "false"
+	}
+	return strconv.FormatBool(!*f.option)
+}
+
+func (f notFlag) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	*f.option = !v
+	return nil
+}
+
+func (f notFlag) IsBoolFlag() bool {
+	return true
+}
+
+// listFlag is the comma separated list, it replaces the list of the config
+type listFlag struct {
+	list *[]string
+}
+
+func (f listFlag) String() string {
+	if f.list == nil {
+		return ""
+	}
+	return strings.Join(*f.list, ",")
+}
+
+func (f listFlag) Set(s string) error {
+	*f.list = nil
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*f.list = append(*f.list, item)
+		}
+	}
+	return nil
+}
+
+// panFlag is the comma separated name=value list, it replaces the map of the config
+type panFlag struct {
+	pans *map[string]float64
+}
+
+func (f panFlag) String() string {
+	if f.pans == nil {
+		return ""
+	}
+	var settings []string
+	for name, pan := range *f.pans {
+		settings = append(settings, name+"="+strconv.FormatFloat(pan, 'g', -1, 64))
+	}
+	sort.Strings(settings)
+	return strings.Join(settings, ",")
+}
+
+func (f panFlag) Set(s string) error {
+	pans := map[string]float64{}
+	for _, setting := range strings.Split(s, ",") {
+		if setting == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(setting, "=")
+		pan, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid pan of %s: %s", name, err)
+		}
+		pans[name] = pan
+	}
+	*f.pans = pans
+	return nil
+}
@@ -0,0 +1,169 @@
+// Package coverage reports the code of the PRG ROM the game ran by the
+// code/data log: the part of the PRG ROM executed, the heat map of the
+// banks and the labeled functions that never ran. The homebrew test
+// suites measure the coverage of their tests with it.
+package coverage
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/symbols"
+)
+
+// DefaultBankSize is the PRG bank of the iNES header, 16 KB
+const DefaultBankSize = 0x4000
+
+// BlockSize is the bytes of the PRG ROM a cell of the heat map covers
+const BlockSize = 0x100
+
+// Bank is the coverage of a PRG bank
+type Bank struct {
+	Bank int `json:"bank"`
+	PRG  int `json:"prg"` // the offset of the PRG ROM the bank starts at
+	Size int `json:"size"`
+	Code int `json:"code"` // the bytes run
+	Data int `json:"data"` // the bytes read as data and never run
+	// the share of the bytes run by the blocks of BlockSize bytes, 0-1
+	Heat []float64 `json:"heat"`
+}
+
+// Percent returns the part of the bank run
+func (b Bank) Percent() float64 {
+	return percent(b.Code, b.Size)
+}
+
+// Function is a label of the code of the PRG ROM
+type Function struct {
+	Name string `json:"name"`
+	Bank int    `json:"bank"`
+	PRG  int    `json:"prg"`            // the offset of the PRG ROM
+	Addr uint16 `json:"addr,omitempty"` // the CPU address, 0: unknown
+}
+
+// Report is the coverage of the PRG ROM
+type Report struct {
+	PRG        int        `json:"prg"`  // the size of the PRG ROM
+	Code       int        `json:"code"` // the bytes run
+	Data       int        `json:"data"` // the bytes read as data and never run
+	Percent    float64    `json:"percent"`
+	Banks      []Bank     `json:"banks"`
+	Functions  int        `json:"functions"`  // the labeled functions
+	Unexecuted []Function `json:"unexecuted"` // the functions never run
+}
+
+// NewReport sums the code/data log by the banks of the size, 0 is
+// DefaultBankSize. The labels of the PRG ROM of the table, nil is none,
+// are the functions, but the ones of the data: the labels spanning more
+// than a byte and the bytes read as data
+func NewReport(log nes.CodeDataLog, table *symbols.Table, bankSize int) *Report {
+	if bankSize <= 0 {
+		bankSize = DefaultBankSize
+	}
+	r := &Report{PRG: len(log.PRG), Unexecuted: []Function{}}
+	for start := 0; start < len(log.PRG); start += bankSize {
+		bank := Bank{Bank: start / bankSize, PRG: start, Size: min(bankSize, len(log.PRG)-start)}
+		for block := start; block < start+bank.Size; block += BlockSize {
+			end := min(block+BlockSize, start+bank.Size)
+			code := 0
+			for _, flags := range log.PRG[block:end] {
+				switch {
+				case flags&nes.CDLCode != 0:
+					code++
+				case flags&(nes.CDLData|nes.CDLPCM) != 0:
+					bank.Data++
+				}
+			}
+			bank.Code += code
+			bank.Heat = append(bank.Heat, float64(code)/float64(end-block))
+		}
+		r.Code += bank.Code
+		r.Data += bank.Data
+		r.Banks = append(r.Banks, bank)
+	}
+	r.Percent = percent(r.Code, r.PRG)
+
+	for _, s := range table.Symbols() {
+		if s.PRG < 0 || s.PRG >= len(log.PRG) || s.Size > 1 {
+			continue
+		}
+		flags := log.PRG[s.PRG]
+		if flags&nes.CDLCode == 0 && flags&(nes.CDLData|nes.CDLPCM) != 0 {
+			continue
+		}
+		r.Functions++
+		if flags&nes.CDLCode == 0 {
+			r.Unexecuted = append(r.Unexecuted, Function{Name: s.Name, Bank: s.PRG / bankSize, PRG: s.PRG, Addr: s.Addr})
+		}
+	}
+	slices.SortFunc(r.Unexecuted, func(a, b Function) int {
+		return cmp.Or(cmp.Compare(a.PRG, b.PRG), strings.Compare(a.Name, b.Name))
+	})
+	return r
+}
+
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+// WriteJSON writes the report as JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(r)
+}
+
+// WriteHTML writes the report as the HTML page with the heat map
+func (r *Report) WriteHTML(w io.Writer) error {
+	return htmlReport.Execute(w, r)
+}
+
+var htmlReport = template.Must(template.New("coverage").Funcs(template.FuncMap{
+	"heat": func(share float64) template.CSS {
+		if share == 0 {
+			return "background: #333"
+		}
+		return template.CSS(fmt.Sprintf("background: hsl(120, 70%%, %.0f%%)", 15+share*45))
+	},
+	"percent": func(share float64) string { return fmt.Sprintf("%.0f%%", share*100) },
+	"prg":     func(offset int) string { return fmt.Sprintf("$%05X", offset) },
+	"offset":  func(bank Bank, i int) int { return bank.PRG + i*BlockSize },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>PRG ROM coverage</title>
+<style>
+body { font-family: sans-serif; background: #111; color: #ddd; }
+table { border-collapse: collapse; }
+td, th { padding: 2px 8px; text-align: left; }
+.heat { display: flex; flex-wrap: wrap; width: 520px; }
+.heat div { width: 14px; height: 14px; margin: 1px; }
+</style>
+</head>
+<body>
+<h1>PRG ROM coverage: {{printf "%.2f" .Percent}}%</h1>
+<p>{{.Code}} of {{.PRG}} bytes run, {{.Data}} bytes of data,
+{{len .Unexecuted}} of {{.Functions}} labeled functions never run</p>
+<h2>Banks</h2>
+{{range $bank := .Banks}}
+<h3>Bank {{.Bank}}: {{printf "%.2f" .Percent}}%</h3>
+<div class="heat">{{range $i, $share := .Heat}}<div style="{{heat $share}}" title="{{prg (offset $bank $i)}}: {{percent $share}}"></div>{{end}}</div>
+{{end}}
+<h2>Functions never run</h2>
+<table>
+<tr><th>function</th><th>bank</th><th>PRG</th><th>address</th></tr>
+{{range .Unexecuted}}<tr><td>{{.Name}}</td><td>{{.Bank}}</td><td>{{prg .PRG}}</td><td>{{if .Addr}}{{printf "$%04X" .Addr}}{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
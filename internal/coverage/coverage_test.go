@@ -0,0 +1,83 @@
+package coverage
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/symbols"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestLog is 2 banks of 16 KB, the bank 0 runs main and reads
+// the table, the bank 1 has the handler never run
+func newTestLog() (nes.CodeDataLog, *symbols.Table) {
+	l := nes.CodeDataLog{PRG: make([]uint8, 0x8000)}
+	for i := 0x0000; i < 0x0080; i++ {
+		l.PRG[i] = nes.CDLCode // main
+	}
+	for i := 0x0200; i < 0x0220; i++ {
+		l.PRG[i] = nes.CDLData // table
+	}
+	l.PRG[0x4000] = nes.CDLCode | 0x0C // reset
+	l.PRG[0x4100] = nes.CDLPCM
+
+	table := symbols.NewTable()
+	table.Add(symbols.Symbol{Name: "main", Addr: 0x8000, PRG: 0x0000})
+	table.Add(symbols.Symbol{Name: "unused", Addr: 0x8100, PRG: 0x0100})
+	table.Add(symbols.Symbol{Name: "table", Addr: 0x8200, PRG: 0x0200})
+	table.Add(symbols.Symbol{Name: "array", PRG: 0x0300, Size: 0x20})
+	table.Add(symbols.Symbol{Name: "reset", Addr: 0xC000, PRG: 0x4000})
+	table.Add(symbols.Symbol{Name: "irq", PRG: 0x4080})
+	table.Add(symbols.Symbol{Name: "player_x", Addr: 0x0010, PRG: -1})
+	return l, table
+}
+
+func Test_NewReport(t *testing.T) {
+	l, table := newTestLog()
+	r := NewReport(l, table, 0)
+
+	assert.Equal(t, 0x8000, r.PRG)
+	assert.Equal(t, 0x81, r.Code)
+	assert.Equal(t, 0x21, r.Data)
+	assert.InDelta(t, 0.39, r.Percent, 0.01)
+	require.Len(t, r.Banks, 2)
+	assert.Equal(t, Bank{Bank: 1, PRG: 0x4000, Size: 0x4000, Code: 1, Data: 1}, Bank{
+		Bank: r.Banks[1].Bank, PRG: r.Banks[1].PRG, Size: r.Banks[1].Size, Code: r.Banks[1].Code, Data: r.Banks[1].Data,
+	})
+	assert.Len(t, r.Banks[0].Heat, 0x40)
+	assert.Equal(t, 0.5, r.Banks[0].Heat[0])
+	assert.Equal(t, 0.0, r.Banks[0].Heat[1])
+	assert.InDelta(t, 0.78, r.Banks[0].Percent(), 0.01)
+
+	assert.Equal(t, 4, r.Functions, "the data labels aren't functions")
+	assert.Equal(t, []Function{
+		{Name: "unused", Bank: 0, PRG: 0x0100, Addr: 0x8100},
+		{Name: "irq", Bank: 1, PRG: 0x4080},
+	}, r.Unexecuted)
+
+	r = NewReport(l, nil, 0x2000)
+	assert.Len(t, r.Banks, 4)
+	assert.Zero(t, r.Functions)
+	assert.Empty(t, r.Unexecuted)
+}
+
+func Test_Report_Write(t *testing.T) {
+	l, table := newTestLog()
+	r := NewReport(l, table, 0)
+
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteJSON(&buf))
+	var decoded Report
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, *r, decoded)
+
+	buf.Reset()
+	require.NoError(t, r.WriteHTML(&buf))
+	html := buf.String()
+	assert.Contains(t, html, "PRG ROM coverage: 0.39%")
+	assert.Contains(t, html, "<td>unused</td><td>0</td><td>$00100</td><td>$8100</td>")
+	assert.Contains(t, html, `title="$04000: 0%"`)
+}
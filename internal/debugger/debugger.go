@@ -0,0 +1,561 @@
+// Package debugger is the debugging engine the debugger frontends share:
+// the breakpoints and the watchpoints, the stepping and the pausing of
+// the console. The commands are safe to call from any goroutine, e.g. from
+// a terminal UI and a web server at once, while the frontend runs the
+// console frames between BeginFrame and EndFrame.
+package debugger
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/symbols"
+)
+
+// Access is what a breakpoint watches the addresses for, the bits combine
+type Access uint8
+
+const (
+	// Exec breaks before the instruction at the address runs
+	Exec Access = 1 << iota
+	// Read breaks after the CPU reads the address
+	Read
+	// Write breaks after the CPU writes the address
+	Write
+)
+
+func (a Access) String() string {
+	var s string
+	for i, name := range []string{"x", "r", "w"} {
+		if a&(1<<i) != 0 {
+			s += name
+		}
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// ParseAccess parses the access letters: x, r and w, e.g. "rw"
+func ParseAccess(s string) (Access, error) {
+	var a Access
+	for _, c := range s {
+		switch c {
+		case 'x':
+			a |= Exec
+		case 'r':
+			a |= Read
+		case 'w':
+			a |= Write
+		default:
+			return 0, fmt.Errorf("invalid access %q", s)
+		}
+	}
+	if a == 0 {
+		return 0, fmt.Errorf("invalid access %q", s)
+	}
+	return a, nil
+}
+
+// Breakpoint stops the console on the access to the addresses
+// from Start to End, both included. With Read or Write it is
+// a watchpoint. With the condition it stops only while the condition
+// isn't 0, and with the hit count from the hit the count reaches
+type Breakpoint struct {
+	ID        int
+	Start     uint16
+	End       uint16
+	Access    Access
+	Enabled   bool
+	Condition string // e.g. A == $3F && [$00FE] > 4, see SetCondition
+	HitCount  int    // the hit it stops from, 0 and 1: every hit
+	Hits      int    // the accesses the condition held at
+}
+
+func (b *Breakpoint) matches(addr uint16, access Access) bool {
+	return b.Enabled && b.Access&access != 0 && addr >= b.Start && addr <= b.End
+}
+
+// StopReason is why the console stopped
+type StopReason int
+
+const (
+	StopPause StopReason = iota
+	StopStep
+	StopBreakpoint
+	StopWatchpoint
+	StopEvent
+)
+
+var stopReasonNames = []string{"pause", "step", "breakpoint", "watchpoint", "event"}
+
+func (r StopReason) String() string {
+	if int(r) < len(stopReasonNames) {
+		return stopReasonNames[r]
+	}
+	return fmt.Sprintf("StopReason(%d)", int(r))
+}
+
+// Stop is the console stopped by the debugger
+type Stop struct {
+	Reason     StopReason
+	Breakpoint int // the ID of the breakpoint, 0: none
+	// the access of the watchpoint
+	Addr  uint16
+	Data  uint8
+	Write bool
+	// the event of the event breakpoint
+	Event nes.Event
+
+	Registers nes.CPURegisters
+}
+
+// ErrRunning is returned by the commands which need the paused console
+var ErrRunning = errors.New("the console isn't paused")
+
+type stepKind int
+
+const (
+	stepNone stepKind = iota
+	stepInto
+	stepOver // the subroutine called by the instruction runs through
+	stepOut
+)
+
+// addrSet is a bit per address of the CPU memory
+type addrSet [0x10000 / 64]uint64
+
+func (s *addrSet) has(addr uint16) bool {
+	return s[addr/64]&(1<<(addr%64)) != 0
+}
+
+func (s *addrSet) add(start, end uint16) {
+	for addr := uint32(start); addr <= uint32(end); addr++ {
+		s[addr/64] |= 1 << (addr % 64)
+	}
+}
+
+// Debugger debugs the console. The console runs its frames between
+// BeginFrame and EndFrame, the commands wait for the frame to end
+type Debugger struct {
+	console *nes.Bus
+	symbols *symbols.Table
+
+	mu          sync.Mutex // held by the frame and by the commands
+	breakpoints []Breakpoint
+	conditions  map[int]expr // the compiled conditions by the breakpoint IDs
+	nextID      int
+	exec        addrSet // the addresses of the enabled breakpoints
+	reads       addrSet
+	writes      addrSet
+	step        stepKind
+	stepSP      uint8
+	stop        *Stop // the stop of the frame, sent at its end
+	last        *Stop // the last stop
+	listeners   []chan Stop
+	events      EventBreak // the events the console stops on
+	logging     bool       // the console logs the events of the frames
+
+	paused       atomic.Bool
+	pauseRequest atomic.Bool
+}
+
+// New returns the debugger of the console, the console runs
+func New(console *nes.Bus) *Debugger {
+	return &Debugger{console: console, nextID: 1, conditions: map[int]expr{}}
+}
+
+// BeginFrame is called by the frontend before it runs a frame of the
+// console and reports whether to run it: the paused console doesn't run.
+// EndFrame must follow the frame
+func (d *Debugger) BeginFrame() bool {
+	d.mu.Lock()
+	if d.paused.Load() {
+		d.mu.Unlock()
+		return false
+	}
+	// the console runs at the full speed with nothing to watch
+	var hooks nes.DebugHooks
+	if d.step != stepNone || d.pauseRequest.Load() || d.anyEnabled() {
+		hooks = d
+	}
+	if d.events != 0 {
+		// the console logs the events only for the hooks watching them
+		hooks = eventHooks{d}
+	}
+	d.console.SetDebugHooks(hooks)
+	return true
+}
+
+// EndFrame ends the frame started by BeginFrame
+// and sends the stop of the frame to the subscribers
+func (d *Debugger) EndFrame() {
+	stop := d.stop
+	d.stop = nil
+	var listeners []chan Stop
+	if stop != nil {
+		listeners = append(listeners, d.listeners...)
+	}
+	d.mu.Unlock()
+	for _, l := range listeners {
+		select {
+		case l <- *stop:
+		default:
+			// the subscriber is behind, it reads the stop with State
+		}
+	}
+}
+
+// Paused reports whether the console is paused
+func (d *Debugger) Paused() bool {
+	return d.paused.Load()
+}
+
+// Close removes the debugger from the console and resumes it
+func (d *Debugger) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.console.SetDebugHooks(nil)
+	d.step = stepNone
+	d.pauseRequest.Store(false)
+	d.paused.Store(false)
+}
+
+// Subscribe returns the channel the stops are sent to and the function
+// which unsubscribes. The stops are dropped while the channel is full
+func (d *Debugger) Subscribe() (<-chan Stop, func()) {
+	ch := make(chan Stop, 16)
+	d.mu.Lock()
+	d.listeners = append(d.listeners, ch)
+	d.mu.Unlock()
+	return ch, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		for i, l := range d.listeners {
+			if l == ch {
+				d.listeners = append(d.listeners[:i], d.listeners[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Pause stops the console before its next instruction.
+// It doesn't wait for the frame to end
+func (d *Debugger) Pause() {
+	if !d.paused.Load() {
+		d.pauseRequest.Store(true)
+	}
+}
+
+// Resume runs the paused console
+func (d *Debugger) Resume() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.step = stepNone
+	d.paused.Store(false)
+}
+
+// StepInto runs the next instruction of the paused console
+func (d *Debugger) StepInto() error {
+	return d.startStep(stepInto)
+}
+
+// StepOver runs the next instruction, the subroutine called by JSR
+// runs through to its return
+func (d *Debugger) StepOver() error {
+	return d.startStep(stepOver)
+}
+
+// StepOut runs until the subroutine or the interrupt handler returns
+func (d *Debugger) StepOut() error {
+	return d.startStep(stepOut)
+}
+
+func (d *Debugger) startStep(kind stepKind) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.paused.Load() {
+		return ErrRunning
+	}
+	regs := d.console.CPURegisters()
+	if kind == stepOver && d.console.PeekMemory(regs.PC) != 0x20 {
+		// only JSR has anything to step over
+		kind = stepInto
+	}
+	d.step, d.stepSP = kind, regs.SP
+	d.paused.Store(false)
+	return nil
+}
+
+// State returns whether the console is paused and the last stop,
+// nil before the first one
+func (d *Debugger) State() (bool, *Stop) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.paused.Load(), d.last
+}
+
+// Registers returns the registers of the CPU
+func (d *Debugger) Registers() nes.CPURegisters {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.console.CPURegisters()
+}
+
+// SetRegisters changes the registers of the paused CPU,
+// the cycles stay
+func (d *Debugger) SetRegisters(r nes.CPURegisters) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.paused.Load() {
+		return ErrRunning
+	}
+	d.console.SetCPURegisters(r)
+	return nil
+}
+
+// ReadMemory reads n bytes of the CPU memory from the address without
+// the side effects of the reads, the addresses wrap around
+func (d *Debugger) ReadMemory(addr uint16, n int) []uint8 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	data := make([]uint8, n)
+	for i := range data {
+		data[i] = d.console.PeekMemory(addr + uint16(i))
+	}
+	return data
+}
+
+// Do runs fn with the console between the frames, the extensions
+// of the debugger run their commands through it
+func (d *Debugger) Do(fn func(console *nes.Bus)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fn(d.console)
+}
+
+// AddBreakpoint adds the breakpoint on the execution
+// of the instruction at the address and returns its ID
+func (d *Debugger) AddBreakpoint(addr uint16) int {
+	return d.AddWatchpoint(addr, addr, Exec)
+}
+
+// AddWatchpoint adds the breakpoint on the access to the addresses
+// from start to end and returns its ID
+func (d *Debugger) AddWatchpoint(start, end uint16, access Access) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if end < start {
+		start, end = end, start
+	}
+	id := d.nextID
+	d.nextID++
+	d.breakpoints = append(d.breakpoints, Breakpoint{ID: id, Start: start, End: end, Access: access, Enabled: true})
+	d.rebuild()
+	return id
+}
+
+// RemoveBreakpoint removes the breakpoint or the watchpoint
+func (d *Debugger) RemoveBreakpoint(id int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	i, err := d.find(id)
+	if err != nil {
+		return err
+	}
+	d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+	delete(d.conditions, id)
+	d.rebuild()
+	return nil
+}
+
+// EnableBreakpoint enables or disables the breakpoint or the watchpoint
+func (d *Debugger) EnableBreakpoint(id int, enabled bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	i, err := d.find(id)
+	if err != nil {
+		return err
+	}
+	d.breakpoints[i].Enabled = enabled
+	d.rebuild()
+	return nil
+}
+
+// SetCondition sets the condition of the breakpoint, "" removes it.
+// The expression is the one of Evaluate, the address and the byte of the
+// access are Address and Value, the PC and the opcode for Exec
+func (d *Debugger) SetCondition(id int, condition string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	i, err := d.find(id)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(condition) == "" {
+		d.breakpoints[i].Condition = ""
+		delete(d.conditions, id)
+		return nil
+	}
+	e, err := parseExpr(condition, d.parseAddress)
+	if err != nil {
+		return err
+	}
+	d.breakpoints[i].Condition = condition
+	d.conditions[id] = e
+	return nil
+}
+
+// SetHitCount sets the hit the breakpoint stops from,
+// 0 stops at every hit. The hits are counted over
+func (d *Debugger) SetHitCount(id, count int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	i, err := d.find(id)
+	if err != nil {
+		return err
+	}
+	if count < 0 {
+		return fmt.Errorf("invalid hit count %d", count)
+	}
+	d.breakpoints[i].HitCount = count
+	d.breakpoints[i].Hits = 0
+	return nil
+}
+
+// Evaluate evaluates the expression with the state of the console:
+//
+//	A == $3F && [$00FE] > 4
+//
+// The numbers are $hex, %binary or decimal. The variables are the
+// registers A, X, Y, SP, PC and P, the flags N, V, B, D, I, Z and C,
+// Scanline, Cycle (the PPU dot), CycleCount (the CPU cycles) and Frame.
+// [addr] reads the byte of the memory, {addr} the little-endian word, and
+// the labels of SetSymbols are their addresses. The operators are the
+// ones of C, the comparisons are 1 or 0
+func (d *Debugger) Evaluate(expression string) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, err := parseExpr(expression, d.parseAddress)
+	if err != nil {
+		return 0, err
+	}
+	return e(&exprEnv{console: d.console, regs: d.console.CPURegisters()}), nil
+}
+
+// hit counts the hit of the breakpoint and reports whether it stops
+func (d *Debugger) hit(b *Breakpoint, addr uint16, data uint8) bool {
+	if cond, ok := d.conditions[b.ID]; ok {
+		env := exprEnv{console: d.console, regs: d.console.CPURegisters(), addr: addr, value: data}
+		if cond(&env) == 0 {
+			return false
+		}
+	}
+	b.Hits++
+	return b.Hits >= b.HitCount
+}
+
+// Breakpoints returns the breakpoints and the watchpoints
+// in the order they were added
+func (d *Debugger) Breakpoints() []Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]Breakpoint(nil), d.breakpoints...)
+}
+
+func (d *Debugger) find(id int) (int, error) {
+	for i := range d.breakpoints {
+		if d.breakpoints[i].ID == id {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no breakpoint %d", id)
+}
+
+// rebuild marks the addresses of the enabled breakpoints,
+// the hooks look them up at every access
+func (d *Debugger) rebuild() {
+	d.exec, d.reads, d.writes = addrSet{}, addrSet{}, addrSet{}
+	for _, b := range d.breakpoints {
+		if !b.Enabled {
+			continue
+		}
+		for access, set := range map[Access]*addrSet{Exec: &d.exec, Read: &d.reads, Write: &d.writes} {
+			if b.Access&access != 0 {
+				set.add(b.Start, b.End)
+			}
+		}
+	}
+}
+
+func (d *Debugger) anyEnabled() bool {
+	for _, b := range d.breakpoints {
+		if b.Enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// Instruction implements nes.DebugHooks, it runs in the frame
+func (d *Debugger) Instruction(pc uint16) bool {
+	if d.pauseRequest.Load() {
+		d.pauseRequest.Store(false)
+		return d.halt(Stop{Reason: StopPause})
+	}
+	switch d.step {
+	case stepInto:
+		return d.halt(Stop{Reason: StopStep})
+	case stepOver:
+		// back from the subroutine, the stack is as before the call
+		if d.console.CPURegisters().SP >= d.stepSP {
+			return d.halt(Stop{Reason: StopStep})
+		}
+	case stepOut:
+		// the return address is pulled from the stack
+		if d.console.CPURegisters().SP > d.stepSP {
+			return d.halt(Stop{Reason: StopStep})
+		}
+	}
+	if !d.exec.has(pc) {
+		return false
+	}
+	for i := range d.breakpoints {
+		if b := &d.breakpoints[i]; b.matches(pc, Exec) && d.hit(b, pc, d.console.PeekMemory(pc)) {
+			return d.halt(Stop{Reason: StopBreakpoint, Breakpoint: b.ID})
+		}
+	}
+	return false
+}
+
+// Access implements nes.DebugHooks, it runs in the frame
+func (d *Debugger) Access(addr uint16, data uint8, write bool) bool {
+	set, access := &d.reads, Read
+	if write {
+		set, access = &d.writes, Write
+	}
+	if !set.has(addr) {
+		return false
+	}
+	for i := range d.breakpoints {
+		if b := &d.breakpoints[i]; b.matches(addr, access) && d.hit(b, addr, data) {
+			return d.halt(Stop{Reason: StopWatchpoint, Breakpoint: b.ID, Addr: addr, Data: data, Write: write})
+		}
+	}
+	return false
+}
+
+// halt pauses the console in the frame
+func (d *Debugger) halt(stop Stop) bool {
+	stop.Registers = d.console.CPURegisters()
+	d.step = stepNone
+	d.paused.Store(true)
+	d.stop, d.last = &stop, &stop
+	return true
+}
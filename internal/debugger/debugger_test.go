@@ -0,0 +1,157 @@
+package debugger
+
+import (
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runFrame runs the frame the way the frontends do
+func runFrame(d *Debugger, console *nes.Bus) bool {
+	if !d.BeginFrame() {
+		return false
+	}
+	defer d.EndFrame()
+	console.RunFrame()
+	return true
+}
+
+func Test_Debugger_Breakpoint(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.LoopROM())
+	d := New(console)
+	id := d.AddBreakpoint(0x8010)
+
+	assert.True(t, runFrame(d, console))
+	paused, stop := d.State()
+	assert.True(t, paused)
+	require.NotNil(t, stop)
+	assert.Equal(t, StopBreakpoint, stop.Reason)
+	assert.Equal(t, id, stop.Breakpoint)
+	assert.Equal(t, uint16(0x8010), d.Registers().PC)
+	assert.Equal(t, 1, d.Breakpoints()[0].Hits)
+
+	cycles := d.Registers().Cycles
+	assert.False(t, runFrame(d, console), "the paused console doesn't run")
+	assert.Equal(t, cycles, d.Registers().Cycles)
+
+	d.Resume()
+	assert.True(t, runFrame(d, console))
+	assert.Equal(t, uint16(0x8010), d.Registers().PC, "the loop comes back to the breakpoint")
+	assert.Equal(t, 2, d.Breakpoints()[0].Hits)
+
+	require.NoError(t, d.EnableBreakpoint(id, false))
+	d.Resume()
+	assert.True(t, runFrame(d, console))
+	assert.False(t, d.Paused(), "the disabled breakpoint doesn't stop")
+
+	require.NoError(t, d.RemoveBreakpoint(id))
+	assert.Empty(t, d.Breakpoints())
+	assert.EqualError(t, d.RemoveBreakpoint(id), "no breakpoint 1")
+}
+
+func Test_Debugger_Watchpoint(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.LoopROM())
+	d := New(console)
+	d.AddWatchpoint(0x11, 0x10, Write)
+
+	runFrame(d, console)
+	_, stop := d.State()
+	require.NotNil(t, stop)
+	assert.Equal(t, StopWatchpoint, stop.Reason)
+	assert.Equal(t, uint16(0x11), stop.Addr, "INC $11 writes first")
+	assert.True(t, stop.Write)
+	assert.Equal(t, []uint8{0x11, 0x60}, d.ReadMemory(0x8011, 2))
+}
+
+func Test_Debugger_Step(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.LoopROM())
+	d := New(console)
+	assert.ErrorIs(t, d.StepInto(), ErrRunning)
+
+	id := d.AddBreakpoint(0x8002)
+	runFrame(d, console)
+	require.NoError(t, d.RemoveBreakpoint(id))
+	pc := func() uint16 { return d.Registers().PC }
+
+	require.NoError(t, d.StepInto())
+	runFrame(d, console)
+	assert.Equal(t, uint16(0x8010), pc(), "into the subroutine")
+	_, stop := d.State()
+	assert.Equal(t, StopStep, stop.Reason)
+
+	require.NoError(t, d.StepOut())
+	runFrame(d, console)
+	assert.Equal(t, uint16(0x8005), pc(), "out of the subroutine")
+
+	require.NoError(t, d.StepOver())
+	runFrame(d, console)
+	assert.Equal(t, uint16(0x8007), pc(), "not JSR, the step into")
+
+	require.NoError(t, d.StepInto())
+	runFrame(d, console)
+	assert.Equal(t, uint16(0x8002), pc())
+	require.NoError(t, d.StepOver())
+	runFrame(d, console)
+	assert.Equal(t, uint16(0x8005), pc(), "over the subroutine")
+	assert.True(t, d.Paused())
+}
+
+func Test_Debugger_Pause(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.LoopROM())
+	d := New(console)
+	stops, unsubscribe := d.Subscribe()
+
+	assert.True(t, runFrame(d, console))
+	assert.False(t, d.Paused())
+
+	d.Pause()
+	runFrame(d, console)
+	assert.True(t, d.Paused())
+	select {
+	case stop := <-stops:
+		assert.Equal(t, StopPause, stop.Reason)
+		assert.Equal(t, d.Registers(), stop.Registers)
+	default:
+		assert.Fail(t, "the stop isn't sent")
+	}
+
+	unsubscribe()
+	d.Resume()
+	d.Pause()
+	runFrame(d, console)
+	assert.Empty(t, stops, "the stops aren't sent after the unsubscribe")
+
+	d.Close()
+	assert.False(t, d.Paused())
+}
+
+func Test_Debugger_SetRegisters(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.LoopROM())
+	d := New(console)
+	regs := d.Registers()
+	regs.A, regs.PC = 0x42, 0x8010
+	assert.Equal(t, ErrRunning, d.SetRegisters(regs))
+
+	d.Pause()
+	runFrame(d, console)
+	regs = d.Registers()
+	regs.A, regs.PC = 0x42, 0x8010
+	require.NoError(t, d.SetRegisters(regs))
+	assert.Equal(t, regs, d.Registers())
+}
+
+func Test_ParseAccess(t *testing.T) {
+	a, err := ParseAccess("rw")
+	require.NoError(t, err)
+	assert.Equal(t, Read|Write, a)
+	assert.Equal(t, "rw", a.String())
+	assert.Equal(t, "x", Exec.String())
+
+	_, err = ParseAccess("")
+	assert.Error(t, err)
+	_, err = ParseAccess("rq")
+	assert.EqualError(t, err, `invalid access "rq"`)
+}
@@ -0,0 +1,142 @@
+package debugger
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// EventBreak is the events the console stops on, the bits combine
+type EventBreak uint8
+
+const (
+	// BreakNMI stops at the first instruction of the NMI handler
+	BreakNMI EventBreak = 1 << iota
+	// BreakIRQFrameCounter stops at the first instruction of the IRQ
+	// handler entered for the APU frame counter
+	BreakIRQFrameCounter
+	// BreakIRQDMC stops at the first instruction of the IRQ
+	// handler entered for the APU DMC channel
+	BreakIRQDMC
+	// BreakBRK stops before BRK runs
+	BreakBRK
+	// BreakIllegal stops before an unofficial opcode runs
+	BreakIllegal
+	// BreakVBlank stops at the dot the PPU starts the vertical blank
+	BreakVBlank
+
+	// BreakIRQ is the IRQ of any source
+	BreakIRQ = BreakIRQFrameCounter | BreakIRQDMC
+)
+
+var eventBreakNames = []string{"nmi", "irq_frame", "irq_dmc", "brk", "illegal", "vblank"}
+
+func (e EventBreak) String() string {
+	var names []string
+	for i, name := range eventBreakNames {
+		if e&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "-"
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseEventBreak parses the comma-separated event names: nmi, irq,
+// irq_frame, irq_dmc, brk, illegal and vblank, e.g. "nmi,brk"
+func ParseEventBreak(s string) (EventBreak, error) {
+	var e EventBreak
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "irq" {
+			e |= BreakIRQ
+			continue
+		}
+		i := slices.Index(eventBreakNames, name)
+		if i < 0 {
+			return 0, fmt.Errorf("unknown event %q", name)
+		}
+		e |= 1 << i
+	}
+	return e, nil
+}
+
+// SetEventBreaks sets the events the console stops on, 0 stops on none.
+// The stops have the StopEvent reason and the event
+func (d *Debugger) SetEventBreaks(events EventBreak) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.events = events
+}
+
+// EventBreaks returns the events the console stops on
+func (d *Debugger) EventBreaks() EventBreak {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.events
+}
+
+// SetEventLogging turns on the event log of the console,
+// see nes.Bus.SetEventLogging
+func (d *Debugger) SetEventLogging(enabled bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.logging = enabled
+	d.console.SetEventLogging(enabled)
+}
+
+// EventLogging reports whether the console logs the events
+func (d *Debugger) EventLogging() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.logging
+}
+
+// Events returns the events of the last complete frame the filter accepts
+// in the order they happened at
+func (d *Debugger) Events(filter nes.EventFilter) []nes.Event {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.console.Events(filter.Match)
+}
+
+// eventBreak returns the event breaks the event matches
+func eventBreak(e nes.Event) EventBreak {
+	switch e.Type {
+	case nes.EventNMIEntry:
+		return BreakNMI
+	case nes.EventIRQEntry:
+		var b EventBreak
+		if e.Data&nes.IRQFrameCounter != 0 {
+			b |= BreakIRQFrameCounter
+		}
+		if e.Data&nes.IRQDMC != 0 {
+			b |= BreakIRQDMC
+		}
+		return b
+	case nes.EventBRK:
+		return BreakBRK
+	case nes.EventIllegalOpcode:
+		return BreakIllegal
+	case nes.EventVBlank:
+		return BreakVBlank
+	}
+	return 0
+}
+
+// eventHooks are the hooks of the debugger watching the events too
+type eventHooks struct {
+	*Debugger
+}
+
+// Event implements nes.DebugEventHooks, it runs in the frame
+func (h eventHooks) Event(e nes.Event) bool {
+	if h.events&eventBreak(e) == 0 {
+		return false
+	}
+	return h.halt(Stop{Reason: StopEvent, Event: e})
+}
@@ -0,0 +1,85 @@
+package debugger
+
+import (
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Debugger_EventBreaks(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.LoopROM())
+	d := New(console)
+	// the loop turns the NMI on, the PPU ignores the writes after the power-on
+	_, err := d.Assemble(0x8007, "JMP $8014")
+	require.NoError(t, err)
+	_, err = d.Assemble(0x8014, "LDA #$80 / STA $2000 / JMP $8002")
+	require.NoError(t, err)
+
+	d.SetEventBreaks(BreakVBlank | BreakNMI)
+	assert.Equal(t, BreakNMI|BreakVBlank, d.EventBreaks())
+	for i := 0; i < 3 && !d.Paused(); i++ {
+		runFrame(d, console)
+	}
+	_, stop := d.State()
+	require.NotNil(t, stop)
+	assert.Equal(t, StopEvent, stop.Reason)
+	assert.Equal(t, nes.EventVBlank, stop.Event.Type)
+	assert.Equal(t, 241, stop.Event.ScanLine)
+
+	d.Resume()
+	runFrame(d, console)
+	_, stop = d.State()
+	assert.Equal(t, nes.EventNMIEntry, stop.Event.Type)
+	assert.Equal(t, uint16(0x8013), stop.Registers.PC, "the console stops at the handler")
+
+	// the subroutine runs BRK
+	d.SetEventBreaks(BreakBRK)
+	_, err = d.Assemble(0x8010, "BRK")
+	require.NoError(t, err)
+	d.Resume()
+	runFrame(d, console)
+	_, stop = d.State()
+	assert.Equal(t, nes.EventBRK, stop.Event.Type)
+	assert.Equal(t, uint16(0x8010), stop.Registers.PC)
+
+	d.SetEventBreaks(0)
+	d.Resume()
+	runFrame(d, console)
+	assert.False(t, d.Paused())
+}
+
+func Test_ParseEventBreak(t *testing.T) {
+	e, err := ParseEventBreak("nmi, BRK,vblank")
+	require.NoError(t, err)
+	assert.Equal(t, BreakNMI|BreakBRK|BreakVBlank, e)
+	assert.Equal(t, "nmi,brk,vblank", e.String())
+
+	e, err = ParseEventBreak("irq")
+	require.NoError(t, err)
+	assert.Equal(t, "irq_frame,irq_dmc", e.String())
+
+	_, err = ParseEventBreak("reset")
+	assert.EqualError(t, err, `unknown event "reset"`)
+}
+
+func Test_Debugger_Events(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.LoopROM())
+	d := New(console)
+	assert.False(t, d.EventLogging())
+	d.SetEventLogging(true)
+	assert.True(t, d.EventLogging())
+	for range 2 {
+		runFrame(d, console)
+	}
+	events := d.Events(nes.EventFilter{Types: []nes.EventType{nes.EventVBlank}})
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, 241, events[0].ScanLine)
+	}
+	assert.Empty(t, d.Events(nes.EventFilter{Sources: []nes.EventSource{nes.SourceMapper}}))
+
+	d.SetEventLogging(false)
+	assert.Empty(t, d.Events(nes.EventFilter{}))
+}
@@ -0,0 +1,290 @@
+package debugger
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// exprEnv is the state of the console the expression is evaluated in
+type exprEnv struct {
+	console *nes.Bus
+	regs    nes.CPURegisters
+	addr    uint16 // the accessed address, the PC of the breakpoint
+	value   uint8  // the accessed byte, the opcode of the breakpoint
+}
+
+// expr is a compiled expression, it never fails to evaluate:
+// the division by zero is 0
+type expr func(env *exprEnv) int
+
+// the variables of the expressions, by their lowercase names
+var exprVars = map[string]expr{
+	"a":  func(e *exprEnv) int { return int(e.regs.A) },
+	"x":  func(e *exprEnv) int { return int(e.regs.X) },
+	"y":  func(e *exprEnv) int { return int(e.regs.Y) },
+	"sp": func(e *exprEnv) int { return int(e.regs.SP) },
+	"pc": func(e *exprEnv) int { return int(e.regs.PC) },
+	"p":  func(e *exprEnv) int { return int(e.regs.P) },
+	"n":  exprFlag(7),
+	"v":  exprFlag(6),
+	"b":  exprFlag(4),
+	"d":  exprFlag(3),
+	"i":  exprFlag(2),
+	"z":  exprFlag(1),
+	"c":  exprFlag(0),
+	"scanline": func(e *exprEnv) int {
+		scanline, _ := e.console.PPUPosition()
+		return scanline
+	},
+	"cycle": func(e *exprEnv) int {
+		_, dot := e.console.PPUPosition()
+		return dot
+	},
+	"cyclecount": func(e *exprEnv) int { return int(e.regs.Cycles) },
+	"frame":      func(e *exprEnv) int { return int(e.console.PPUFrames()) },
+	"address":    func(e *exprEnv) int { return int(e.addr) },
+	"value":      func(e *exprEnv) int { return int(e.value) },
+}
+
+func exprFlag(bit int) expr {
+	return func(e *exprEnv) int { return int(e.regs.P>>bit) & 1 }
+}
+
+// the binary operators from the lowest precedence
+var exprOperators = [][]string{
+	{"||"}, {"&&"}, {"|"}, {"^"}, {"&"}, {"==", "!="},
+	{"<=", ">=", "<", ">"}, {"<<", ">>"}, {"+", "-"}, {"*", "/", "%"},
+}
+
+// exprParser parses the expressions, see Debugger.Evaluate
+type exprParser struct {
+	tokens []string
+	pos    int
+	label  func(name string) (uint16, error)
+}
+
+// parseExpr compiles the expression, the labels are resolved by label
+func parseExpr(s string, label func(name string) (uint16, error)) (expr, error) {
+	tokens, err := exprTokens(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %s", s, err)
+	}
+	p := &exprParser{tokens: tokens, label: label}
+	e, err := p.binary(0)
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %s", s, err)
+	}
+	return e, nil
+}
+
+func exprTokens(s string) ([]string, error) {
+	var tokens []string
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		n := 1
+		switch c := s[0]; {
+		case isExprName(c) || c == '$' || c == '%' && len(tokens) > 0 && isOperator(tokens[len(tokens)-1]) ||
+			c == '%' && len(tokens) == 0:
+			for n < len(s) && isExprName(s[n]) {
+				n++
+			}
+		case len(s) > 1 && slices.Contains([]string{"||", "&&", "==", "!=", "<=", ">=", "<<", ">>"}, s[:2]):
+			n = 2
+		case strings.IndexByte("|^&<>+-*/%!~()[]{}", c) >= 0:
+		default:
+			return nil, fmt.Errorf("unexpected %q", c)
+		}
+		tokens = append(tokens, s[:n])
+		s = s[n:]
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("it is empty")
+	}
+	return tokens, nil
+}
+
+func isExprName(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '@' || c == '.'
+}
+
+// isOperator reports whether the token comes before an operand,
+// so % starts a binary number after it
+func isOperator(token string) bool {
+	return !isExprName(token[0]) && token[0] != '$' && token[0] != '%' &&
+		token != ")" && token != "]" && token != "}"
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *exprParser) binary(level int) (expr, error) {
+	if level == len(exprOperators) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		found := false
+		for _, o := range exprOperators[level] {
+			found = found || o == op
+		}
+		if !found {
+			return left, nil
+		}
+		p.next()
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr(op, left, right)
+	}
+}
+
+func binaryExpr(op string, l, r expr) expr {
+	boolean := func(b bool) int {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	switch op {
+	case "||":
+		return func(e *exprEnv) int { return boolean(l(e) != 0 || r(e) != 0) }
+	case "&&":
+		return func(e *exprEnv) int { return boolean(l(e) != 0 && r(e) != 0) }
+	case "|":
+		return func(e *exprEnv) int { return l(e) | r(e) }
+	case "^":
+		return func(e *exprEnv) int { return l(e) ^ r(e) }
+	case "&":
+		return func(e *exprEnv) int { return l(e) & r(e) }
+	case "==":
+		return func(e *exprEnv) int { return boolean(l(e) == r(e)) }
+	case "!=":
+		return func(e *exprEnv) int { return boolean(l(e) != r(e)) }
+	case "<":
+		return func(e *exprEnv) int { return boolean(l(e) < r(e)) }
+	case "<=":
+		return func(e *exprEnv) int { return boolean(l(e) <= r(e)) }
+	case ">":
+		return func(e *exprEnv) int { return boolean(l(e) > r(e)) }
+	case ">=":
+		return func(e *exprEnv) int { return boolean(l(e) >= r(e)) }
+	case "<<":
+		return func(e *exprEnv) int { return l(e) << (r(e) & 63) }
+	case ">>":
+		return func(e *exprEnv) int { return l(e) >> (r(e) & 63) }
+	case "+":
+		return func(e *exprEnv) int { return l(e) + r(e) }
+	case "-":
+		return func(e *exprEnv) int { return l(e) - r(e) }
+	case "*":
+		return func(e *exprEnv) int { return l(e) * r(e) }
+	case "/":
+		return func(e *exprEnv) int {
+			if d := r(e); d != 0 {
+				return l(e) / d
+			}
+			return 0
+		}
+	}
+	return func(e *exprEnv) int {
+		if d := r(e); d != 0 {
+			return l(e) % d
+		}
+		return 0
+	}
+}
+
+func (p *exprParser) unary() (expr, error) {
+	switch op := p.peek(); op {
+	case "!", "-", "~":
+		p.next()
+		e, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "!":
+			return func(env *exprEnv) int {
+				if e(env) == 0 {
+					return 1
+				}
+				return 0
+			}, nil
+		case "-":
+			return func(env *exprEnv) int { return -e(env) }, nil
+		}
+		return func(env *exprEnv) int { return ^e(env) }, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (expr, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("it ends too early")
+	case token == "(" || token == "[" || token == "{":
+		e, err := p.binary(0)
+		if err != nil {
+			return nil, err
+		}
+		closing := map[string]string{"(": ")", "[": "]", "{": "}"}[token]
+		if p.next() != closing {
+			return nil, fmt.Errorf("no closing %s", closing)
+		}
+		switch token {
+		case "[":
+			return func(env *exprEnv) int { return int(env.console.PeekMemory(uint16(e(env)))) }, nil
+		case "{":
+			return func(env *exprEnv) int {
+				addr := uint16(e(env))
+				return int(env.console.PeekMemory(addr)) | int(env.console.PeekMemory(addr+1))<<8
+			}, nil
+		}
+		return e, nil
+	case token[0] == '$' || token[0] == '%' || token[0] >= '0' && token[0] <= '9':
+		base, digits := 10, token
+		switch token[0] {
+		case '$':
+			base, digits = 16, token[1:]
+		case '%':
+			base, digits = 2, token[1:]
+		}
+		v, err := strconv.ParseInt(digits, base, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", token)
+		}
+		return func(*exprEnv) int { return int(v) }, nil
+	case isExprName(token[0]):
+		if v, ok := exprVars[strings.ToLower(token)]; ok {
+			return v, nil
+		}
+		addr, err := p.label(token)
+		if err != nil {
+			return nil, err
+		}
+		return func(*exprEnv) int { return int(addr) }, nil
+	}
+	return nil, fmt.Errorf("unexpected %q", token)
+}
@@ -0,0 +1,95 @@
+package debugger
+
+import (
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/nevisdale/nestic/internal/symbols"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Debugger_Evaluate(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.LoopROM())
+	d := New(console)
+	console.SetCPURegisters(nes.CPURegisters{A: 0x3F, X: 2, P: 0x81, SP: 0xFD, PC: 0x8000})
+	console.WriteMemory(0x00FE, 5)
+	console.WriteMemory(0x0300, 0x34)
+	console.WriteMemory(0x0301, 0x12)
+	table := symbols.NewTable()
+	table.Add(symbols.Symbol{Name: "buffer", Addr: 0x0300, PRG: -1})
+	d.SetSymbols(table)
+
+	for expression, want := range map[string]int{
+		"A == $3F && [$00FE] > 4": 1,
+		"a == $3F && [$00FE] > 5": 0,
+		"{buffer}":                0x1234,
+		"[buffer + 1]":            0x12,
+		"[buffer+X-1]":            0x12,
+		"N && C && !Z":            1,
+		"P & %10000000":           0x80,
+		"1 + 2 * 3 - 8 / 2 % 3":   6,
+		"(1 + 2) * 3 << 1":        18,
+		"-1 < 0 || 1 / 0":         1,
+		"~0 == -1 ^ 0":            1,
+		"PC == $8000":             1,
+		"CycleCount > 0":          1,
+		"Scanline >= 0":           1,
+	} {
+		v, err := d.Evaluate(expression)
+		require.NoError(t, err, expression)
+		assert.Equal(t, want, v, expression)
+	}
+	for _, expression := range []string{"", "A ==", "[A", "(A", "nothing", "A # 1", "$GG", "A B"} {
+		_, err := d.Evaluate(expression)
+		assert.Error(t, err, expression)
+	}
+}
+
+func Test_Debugger_Condition(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.LoopROM())
+	d := New(console)
+	id := d.AddBreakpoint(0x8010)
+	require.NoError(t, d.SetCondition(id, "[$11] == 5"))
+	assert.Error(t, d.SetCondition(id, "[$11] =="))
+	assert.Equal(t, "[$11] == 5", d.Breakpoints()[0].Condition)
+
+	runFrame(d, console)
+	paused, stop := d.State()
+	require.True(t, paused)
+	assert.Equal(t, id, stop.Breakpoint)
+	assert.Equal(t, []uint8{5}, d.ReadMemory(0x11, 1))
+	assert.Equal(t, 1, d.Breakpoints()[0].Hits)
+
+	// the watchpoint with the value of the write
+	require.NoError(t, d.SetCondition(id, ""))
+	require.NoError(t, d.EnableBreakpoint(id, false))
+	watch := d.AddWatchpoint(0x10, 0x11, Write)
+	require.NoError(t, d.SetCondition(watch, "Address == $10 && Value == 3"))
+	d.Resume()
+	runFrame(d, console)
+	paused, stop = d.State()
+	require.True(t, paused)
+	assert.Equal(t, watch, stop.Breakpoint)
+	assert.Equal(t, uint16(0x10), stop.Addr)
+	assert.Equal(t, uint8(3), stop.Data)
+}
+
+func Test_Debugger_HitCount(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.LoopROM())
+	d := New(console)
+	id := d.AddBreakpoint(0x8010)
+	require.NoError(t, d.SetHitCount(id, 3))
+	assert.Error(t, d.SetHitCount(id, -1))
+
+	runFrame(d, console)
+	paused, _ := d.State()
+	require.True(t, paused)
+	assert.Equal(t, []uint8{2}, d.ReadMemory(0x11, 1), "the third call")
+	assert.Equal(t, 3, d.Breakpoints()[0].Hits)
+
+	d.Resume()
+	runFrame(d, console)
+	assert.Equal(t, []uint8{3}, d.ReadMemory(0x11, 1), "every hit from the count")
+}
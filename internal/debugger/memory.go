@@ -0,0 +1,91 @@
+package debugger
+
+import (
+	"fmt"
+	"image"
+	"slices"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// MemoryPage is a page of the memory the hex viewers show
+type MemoryPage struct {
+	Space nes.MemorySpace
+	Addr  int     // the address of the first byte
+	Data  []uint8 // shorter than asked for at the end of the memory
+	Size  int     // the size of the whole memory
+}
+
+// ReadPage reads the page of the memory from the address
+// without the side effects of the reads
+func (d *Debugger) ReadPage(space nes.MemorySpace, addr, length int) (MemoryPage, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	size := d.console.MemorySize(space)
+	if err := checkRange(space, addr, size); err != nil {
+		return MemoryPage{}, err
+	}
+	page := MemoryPage{Space: space, Addr: addr, Size: size, Data: make([]uint8, min(length, size-addr))}
+	for i := range page.Data {
+		page.Data[i] = d.console.Peek(space, addr+i)
+	}
+	return page, nil
+}
+
+// Poke changes the bytes of the memory from the address, see nes.Bus.Poke
+func (d *Debugger) Poke(space nes.MemorySpace, addr int, data []uint8) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	size := d.console.MemorySize(space)
+	if err := checkRange(space, addr, size); err != nil {
+		return err
+	}
+	if addr+len(data) > size {
+		return fmt.Errorf("the data goes past the end of the %s memory", space)
+	}
+	for i, v := range data {
+		d.console.Poke(space, addr+i, v)
+	}
+	return nil
+}
+
+func checkRange(space nes.MemorySpace, addr, size int) error {
+	if addr < 0 || addr >= size {
+		return fmt.Errorf("the address $%X is out of the %s memory", addr, space)
+	}
+	return nil
+}
+
+// Assemble encodes the instructions, see nes.Assemble, and writes them to
+// the CPU memory at the address, the RAM or the ROM of the cartridge.
+// It returns the bytes written
+func (d *Debugger) Assemble(addr uint16, source string) ([]uint8, error) {
+	code, err := nes.Assemble(addr, source)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.Poke(nes.MemoryCPU, int(addr), code); err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// Disassemble decodes n instructions from the address, the addresses wrap around
+func (d *Debugger) Disassemble(addr uint16, n int) []nes.Instruction {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	instructions := make([]nes.Instruction, n)
+	for i := range instructions {
+		instructions[i] = d.console.Disassemble(addr)
+		addr += uint16(len(instructions[i].Bytes))
+	}
+	return instructions
+}
+
+// Frame returns a copy of the last frame of the PPU
+func (d *Debugger) Frame() *image.RGBA {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	frame := d.console.PPU().Frame()
+	return &image.RGBA{Pix: slices.Clone(frame.Pix), Stride: frame.Stride, Rect: frame.Rect}
+}
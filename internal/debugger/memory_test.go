@@ -0,0 +1,72 @@
+package debugger
+
+import (
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Debugger_ReadPage(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.LoopROM())
+	d := New(console)
+
+	page, err := d.ReadPage(nes.MemoryCPU, 0x8000, 4)
+	require.NoError(t, err)
+	assert.Equal(t, nes.MemoryCPU, page.Space)
+	assert.Equal(t, []uint8{0xA9, 0x00, 0x20, 0x10}, page.Data)
+	assert.Equal(t, 0x10000, page.Size)
+
+	page, err = d.ReadPage(nes.MemoryOAM, 0xF8, 16)
+	require.NoError(t, err)
+	assert.Len(t, page.Data, 8, "the page ends with the memory")
+
+	_, err = d.ReadPage(nes.MemoryOAM, 0x100, 16)
+	assert.EqualError(t, err, "the address $100 is out of the oam memory")
+}
+
+func Test_Debugger_Poke(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.LoopROM())
+	d := New(console)
+
+	require.NoError(t, d.Poke(nes.MemoryCPU, 0x0300, []uint8{1, 2, 3}))
+	assert.Equal(t, []uint8{1, 2, 3}, d.ReadMemory(0x0300, 3))
+	require.NoError(t, d.Poke(nes.MemoryPRG, 0x0011, []uint8{0x12}))
+	assert.Equal(t, []uint8{0x12}, d.ReadMemory(0x8011, 1), "the running code is patched")
+
+	assert.EqualError(t, d.Poke(nes.MemoryOAM, 0xFF, []uint8{1, 2}), "the data goes past the end of the oam memory")
+	assert.Error(t, d.Poke(nes.MemoryCHR, -1, []uint8{1}))
+}
+
+func Test_Debugger_Assemble(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.LoopROM())
+	d := New(console)
+
+	code, err := d.Assemble(0x8010, "INC $12 / RTS")
+	require.NoError(t, err)
+	assert.Equal(t, []uint8{0xE6, 0x12, 0x60}, code)
+	assert.Equal(t, code, d.ReadMemory(0x8010, 3))
+
+	console.RunFrame()
+	assert.NotZero(t, d.ReadMemory(0x12, 1)[0], "the patched subroutine runs")
+	assert.Zero(t, d.ReadMemory(0x11, 1)[0])
+
+	_, err = d.Assemble(0x8010, "INC $12 / FOO")
+	assert.EqualError(t, err, `invalid instruction "FOO": unknown instruction FOO`)
+	assert.Equal(t, code, d.ReadMemory(0x8010, 3), "nothing is written")
+}
+
+func Test_Debugger_Disassemble(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.LoopROM())
+	d := New(console)
+
+	instructions := d.Disassemble(0x8000, 3)
+	if assert.Len(t, instructions, 3) {
+		assert.Equal(t, "LDA #$00", instructions[0].Text)
+		assert.Equal(t, uint16(0x8002), instructions[1].Addr)
+		assert.Equal(t, "JSR $8010", instructions[1].Text)
+		assert.Equal(t, "INC $10", instructions[2].Text)
+	}
+}
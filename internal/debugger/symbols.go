@@ -0,0 +1,79 @@
+package debugger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nevisdale/nestic/internal/symbols"
+)
+
+// SetSymbols sets the labels of the game, they name the addresses of
+// the breakpoints and of the disassembly. nil removes them
+func (d *Debugger) SetSymbols(t *symbols.Table) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.symbols = t
+	if t == nil {
+		d.console.SetSymbols(nil)
+		return
+	}
+	d.console.SetSymbols(t)
+}
+
+// Symbols returns the labels of the game, nil without them
+func (d *Debugger) Symbols() *symbols.Table {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.symbols
+}
+
+// ParseAddress returns the CPU address of $C000, of the label or of
+// the label with the offset, e.g. reset_handler or oam+4
+func (d *Debugger) ParseAddress(s string) (uint16, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.parseAddress(s)
+}
+
+func (d *Debugger) parseAddress(s string) (uint16, error) {
+	s = strings.TrimSpace(s)
+	if hex, ok := strings.CutPrefix(s, "$"); ok {
+		addr, err := strconv.ParseUint(hex, 16, 16)
+		if err != nil {
+			return 0, fmt.Errorf("invalid address %q", s)
+		}
+		return uint16(addr), nil
+	}
+	name, offsetText, hasOffset := strings.Cut(s, "+")
+	sym, ok := d.symbols.Lookup(name)
+	if !ok {
+		return 0, fmt.Errorf("unknown label %q", name)
+	}
+	offset := 0
+	if hasOffset {
+		n, err := strconv.ParseUint(strings.TrimPrefix(offsetText, "$"), offsetBase(offsetText), 16)
+		if err != nil {
+			return 0, fmt.Errorf("invalid offset %q", offsetText)
+		}
+		offset = int(n)
+	}
+	if sym.PRG < 0 {
+		return sym.Addr + uint16(offset), nil
+	}
+	// the label of the ROM is at the address the CPU reads it from
+	for addr := 0x8000; addr <= 0xFFFF; addr++ {
+		if prg, ok := d.console.PRGOffset(uint16(addr)); ok && prg == sym.PRG+offset {
+			return uint16(addr), nil
+		}
+	}
+	return 0, fmt.Errorf("the label %s isn't in the CPU memory", s)
+}
+
+// offsetBase returns the base of the $hex or the decimal offset
+func offsetBase(s string) int {
+	if strings.HasPrefix(s, "$") {
+		return 16
+	}
+	return 10
+}
@@ -0,0 +1,44 @@
+package debugger
+
+import (
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/nevisdale/nestic/internal/symbols"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Debugger_ParseAddress(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.LoopROM())
+	d := New(console)
+	table := symbols.NewTable()
+	table.Add(symbols.Symbol{Name: "counter", Addr: 0x10, PRG: -1, Size: 2})
+	table.Add(symbols.Symbol{Name: "sub", PRG: 0x0010})
+	d.SetSymbols(table)
+
+	for s, want := range map[string]uint16{"$C000": 0xC000, "counter": 0x10, "counter+2": 0x12, "counter+$10": 0x20, "sub": 0x8010} {
+		addr, err := d.ParseAddress(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, want, addr, s)
+	}
+	for _, s := range []string{"$G000", "nothing", "counter+x"} {
+		_, err := d.ParseAddress(s)
+		assert.Error(t, err, s)
+	}
+
+	// break at the label of the subroutine
+	addr, err := d.ParseAddress("sub")
+	require.NoError(t, err)
+	d.AddBreakpoint(addr)
+	assert.True(t, d.BeginFrame())
+	console.RunFrame()
+	d.EndFrame()
+	paused, stop := d.State()
+	require.True(t, paused)
+	assert.Equal(t, uint16(0x8010), stop.Registers.PC)
+	assert.Equal(t, "INC counter+1", console.Disassemble(0x8010).Text)
+
+	d.SetSymbols(nil)
+	assert.Equal(t, "INC $11", console.Disassemble(0x8010).Text)
+}
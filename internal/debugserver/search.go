@@ -0,0 +1,123 @@
+package debugserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/nevisdale/nestic/internal/cheats"
+)
+
+// the work RAM the cheat search looks through
+const searchRAMSize = 0x800
+
+// the most results GET /api/search returns by default
+const searchResultsLimit = 256
+
+// SearchStart is the body of PUT /api/search, the width is 8 or 16 bits
+type SearchStart struct {
+	Width  int  `json:"width"`
+	Signed bool `json:"signed"`
+}
+
+// SearchFilter is the body of POST /api/search/filter, the comparison
+// is of cheats.ParseCompare
+type SearchFilter struct {
+	Compare string `json:"compare"`
+	Operand int    `json:"operand"`
+}
+
+// SearchResult is a candidate address of the search
+type SearchResult struct {
+	Addr     uint16 `json:"addr"`
+	Value    int    `json:"value"`
+	Previous int    `json:"previous"`
+}
+
+// SearchResults are the candidates left, the first ones of them
+type SearchResults struct {
+	Count   int            `json:"count"`
+	Results []SearchResult `json:"results"`
+}
+
+// ram returns the work RAM of the console
+func (s *Server) ram() []uint8 {
+	return s.debugger.ReadMemory(0, searchRAMSize)
+}
+
+func (s *Server) startSearch(w http.ResponseWriter, r *http.Request) {
+	start := SearchStart{Width: 8}
+	if !readJSON(w, r, &start) {
+		return
+	}
+	var width cheats.Width
+	switch start.Width {
+	case 8:
+		width = cheats.Width8
+	case 16:
+		width = cheats.Width16
+	default:
+		writeError(w, fmt.Errorf("invalid width %d, 8 or 16 is expected", start.Width))
+		return
+	}
+	search := cheats.NewSearch(s.ram(), width, start.Signed)
+	s.searchMu.Lock()
+	s.search = search
+	s.searchMu.Unlock()
+	writeJSON(w, SearchResults{Count: search.Count(), Results: []SearchResult{}})
+}
+
+func (s *Server) filterSearch(w http.ResponseWriter, r *http.Request) {
+	var f SearchFilter
+	if !readJSON(w, r, &f) {
+		return
+	}
+	cmp, err := cheats.ParseCompare(f.Compare)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	ram := s.ram()
+	s.searchMu.Lock()
+	defer s.searchMu.Unlock()
+	if s.search == nil {
+		writeError(w, errors.New("no search, PUT /api/search starts one"))
+		return
+	}
+	s.search.Filter(ram, cmp, f.Operand)
+	writeJSON(w, s.searchResults(ram, searchResultsLimit))
+}
+
+func (s *Server) searchResultsOf(w http.ResponseWriter, r *http.Request) {
+	limit := searchResultsLimit
+	if text := r.URL.Query().Get("limit"); text != "" {
+		n, err := strconv.Atoi(text)
+		if err != nil || n < 0 {
+			writeError(w, fmt.Errorf("invalid limit %q", text))
+			return
+		}
+		limit = n
+	}
+	ram := s.ram()
+	s.searchMu.Lock()
+	defer s.searchMu.Unlock()
+	if s.search == nil {
+		writeError(w, errors.New("no search, PUT /api/search starts one"))
+		return
+	}
+	writeJSON(w, s.searchResults(ram, limit))
+}
+
+// searchResults returns the first candidates of the search,
+// s.searchMu is held
+func (s *Server) searchResults(ram []uint8, limit int) SearchResults {
+	results := SearchResults{Count: s.search.Count(), Results: []SearchResult{}}
+	for _, result := range s.search.Results(ram) {
+		if len(results.Results) == limit {
+			break
+		}
+		results.Results = append(results.Results, SearchResult(result))
+	}
+	return results
+}
@@ -0,0 +1,654 @@
+// Package debugserver serves the debugger over HTTP for the debugger UIs
+// in the browser and the external tools. The endpoints read and write
+// JSON:
+//
+//	GET    /api/state                 paused and the last stop
+//	GET    /api/registers             PUT changes them while paused
+//	POST   /api/pause                 /api/resume, /api/step?kind=into|over|out
+//	GET    /api/memory?space=cpu&addr=$8000&length=256
+//	PUT    /api/memory                {"space": "cpu", "addr": 768, "data": "a9ff"}
+//	GET    /api/disassembly?addr=$8000&count=16
+//	GET    /api/breakpoints           POST adds one, PATCH and DELETE /api/breakpoints/{id}
+//	GET    /api/event-breaks          PUT {"events": "nmi,brk"}
+//	GET    /api/events?types=nmi,oam+dma&sources=apu,mapper
+//	                                  the events of the last frame, PUT {"logging": true}
+//	GET    /api/search?limit=256      the RAM search of the cheats, PUT {"width": 8, "signed": false}
+//	                                  starts it, POST /api/search/filter {"compare": "less", "operand": 0}
+//	GET    /api/evaluate?expr=[$10]+1
+//	GET    /api/frame                 the last frame as PNG
+//	GET    /api/stops                 the WebSocket stream of the stops
+//
+// The addresses of the CPU are $hex, 0x hex, decimal or the labels. The
+// server has no authentication, it is meant to listen at localhost. Against
+// the web pages calling it from the browser, the Host has to be localhost
+// or the address the server listens at, the requests changing the state
+// have to send JSON and the WebSocket has to come from such an origin.
+package debugserver
+
+import (
+	"cmp"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nevisdale/nestic/internal/cheats"
+	"github.com/nevisdale/nestic/internal/debugger"
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// Server is the HTTP handler of the debug API
+type Server struct {
+	debugger *debugger.Debugger
+	mux      *http.ServeMux
+
+	searchMu sync.Mutex
+	search   *cheats.Search // nil: no search started
+}
+
+// New returns the debug API of the debugger
+func New(d *debugger.Debugger) *Server {
+	s := &Server{debugger: d, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /api/state", s.state)
+	s.mux.HandleFunc("GET /api/registers", s.registers)
+	s.mux.HandleFunc("PUT /api/registers", s.setRegisters)
+	s.mux.HandleFunc("POST /api/pause", s.pause)
+	s.mux.HandleFunc("POST /api/resume", s.resume)
+	s.mux.HandleFunc("POST /api/step", s.step)
+	s.mux.HandleFunc("GET /api/memory", s.memory)
+	s.mux.HandleFunc("PUT /api/memory", s.poke)
+	s.mux.HandleFunc("GET /api/disassembly", s.disassembly)
+	s.mux.HandleFunc("GET /api/breakpoints", s.breakpoints)
+	s.mux.HandleFunc("POST /api/breakpoints", s.addBreakpoint)
+	s.mux.HandleFunc("PATCH /api/breakpoints/{id}", s.changeBreakpoint)
+	s.mux.HandleFunc("DELETE /api/breakpoints/{id}", s.removeBreakpoint)
+	s.mux.HandleFunc("GET /api/event-breaks", s.eventBreaks)
+	s.mux.HandleFunc("PUT /api/event-breaks", s.setEventBreaks)
+	s.mux.HandleFunc("GET /api/events", s.events)
+	s.mux.HandleFunc("PUT /api/events", s.setEventLogging)
+	s.mux.HandleFunc("GET /api/search", s.searchResultsOf)
+	s.mux.HandleFunc("PUT /api/search", s.startSearch)
+	s.mux.HandleFunc("POST /api/search/filter", s.filterSearch)
+	s.mux.HandleFunc("GET /api/evaluate", s.evaluate)
+	s.mux.HandleFunc("GET /api/frame", s.frame)
+	s.mux.HandleFunc("GET /api/stops", s.stops)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !allowedHost(r, r.Host) {
+		http.Error(w, "the host isn't allowed", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		// the pages can't send JSON to the other sites without CORS
+		if t, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); t != "application/json" {
+			http.Error(w, "the Content-Type has to be application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// allowedHost reports whether the host, host:port, is localhost or
+// the address the request came to, the other names may point a web page
+// at the server by the DNS rebinding
+func allowedHost(r *http.Request, host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return false
+	}
+	listen, _, err := net.SplitHostPort(local.String())
+	return err == nil && ip.Equal(net.ParseIP(listen))
+}
+
+// Registers are the registers of the CPU
+type Registers struct {
+	A      uint8  `json:"a"`
+	X      uint8  `json:"x"`
+	Y      uint8  `json:"y"`
+	P      uint8  `json:"p"`
+	SP     uint8  `json:"sp"`
+	PC     uint16 `json:"pc"`
+	Cycles uint64 `json:"cycles"`
+}
+
+func newRegisters(r nes.CPURegisters) Registers {
+	return Registers{A: r.A, X: r.X, Y: r.Y, P: r.P, SP: r.SP, PC: r.PC, Cycles: r.Cycles}
+}
+
+// Event is the event of the console
+type Event struct {
+	Type     string `json:"type"`
+	Source   string `json:"source"`
+	Frame    uint64 `json:"frame"`
+	Scanline int    `json:"scanline"`
+	Dot      int    `json:"dot"`
+	PC       uint16 `json:"pc"`
+	Addr     uint16 `json:"addr"`
+	Data     uint8  `json:"data"`
+}
+
+func newEvent(e nes.Event) Event {
+	return Event{
+		Type:     e.Type.String(),
+		Source:   e.Type.Source().String(),
+		Frame:    e.Frame,
+		Scanline: e.ScanLine,
+		Dot:      e.Dot,
+		PC:       e.PC,
+		Addr:     e.Addr,
+		Data:     e.Data,
+	}
+}
+
+// Stop is the console stopped by the debugger
+type Stop struct {
+	Reason     string    `json:"reason"`
+	Breakpoint int       `json:"breakpoint,omitempty"`
+	Addr       uint16    `json:"addr,omitempty"`
+	Data       uint8     `json:"data,omitempty"`
+	Write      bool      `json:"write,omitempty"`
+	Event      *Event    `json:"event,omitempty"`
+	Registers  Registers `json:"registers"`
+}
+
+func newStop(stop debugger.Stop) *Stop {
+	s := &Stop{
+		Reason:     stop.Reason.String(),
+		Breakpoint: stop.Breakpoint,
+		Addr:       stop.Addr,
+		Data:       stop.Data,
+		Write:      stop.Write,
+		Registers:  newRegisters(stop.Registers),
+	}
+	if stop.Reason == debugger.StopEvent {
+		e := newEvent(stop.Event)
+		s.Event = &e
+	}
+	return s
+}
+
+// State is whether the console is paused and the last stop
+type State struct {
+	Paused bool  `json:"paused"`
+	Stop   *Stop `json:"stop"` // nil before the first stop
+}
+
+// Memory is the bytes of a memory, the data is hex
+type Memory struct {
+	Space string `json:"space"`
+	Addr  int    `json:"addr"`
+	Size  int    `json:"size,omitempty"` // the size of the whole memory
+	Data  string `json:"data"`
+}
+
+// Instruction is an instruction of the disassembly, the bytes are hex
+type Instruction struct {
+	Addr       uint16 `json:"addr"`
+	Label      string `json:"label,omitempty"`
+	Bytes      string `json:"bytes"`
+	Name       string `json:"name"`
+	Text       string `json:"text"`
+	Unofficial bool   `json:"unofficial,omitempty"`
+}
+
+// Breakpoint is a breakpoint or a watchpoint, the access is
+// the letters x, r and w. The addresses of the new one are of ParseAddress
+type Breakpoint struct {
+	ID        int    `json:"id"`
+	Start     string `json:"start"`
+	End       string `json:"end,omitempty"`    // "": the start
+	Access    string `json:"access,omitempty"` // "": x
+	Enabled   bool   `json:"enabled"`
+	Condition string `json:"condition,omitempty"`
+	HitCount  int    `json:"hit_count,omitempty"`
+	Hits      int    `json:"hits"`
+}
+
+func (s *Server) state(w http.ResponseWriter, r *http.Request) {
+	paused, stop := s.debugger.State()
+	state := State{Paused: paused}
+	if stop != nil {
+		state.Stop = newStop(*stop)
+	}
+	writeJSON(w, state)
+}
+
+func (s *Server) registers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, newRegisters(s.debugger.Registers()))
+}
+
+func (s *Server) setRegisters(w http.ResponseWriter, r *http.Request) {
+	regs := newRegisters(s.debugger.Registers())
+	if !readJSON(w, r, &regs) {
+		return
+	}
+	err := s.debugger.SetRegisters(nes.CPURegisters{A: regs.A, X: regs.X, Y: regs.Y, P: regs.P, SP: regs.SP, PC: regs.PC})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, newRegisters(s.debugger.Registers()))
+}
+
+func (s *Server) pause(w http.ResponseWriter, r *http.Request) {
+	s.debugger.Pause()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) resume(w http.ResponseWriter, r *http.Request) {
+	s.debugger.Resume()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) step(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch kind := r.URL.Query().Get("kind"); kind {
+	case "", "into":
+		err = s.debugger.StepInto()
+	case "over":
+		err = s.debugger.StepOver()
+	case "out":
+		err = s.debugger.StepOut()
+	default:
+		err = fmt.Errorf("unknown step %q", kind)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) memory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	space, addr, err := s.parseMemoryAddress(q.Get("space"), q.Get("addr"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	length := 256
+	if q.Has("length") {
+		if length, err = parseNumber(q.Get("length")); err != nil || length < 0 {
+			writeError(w, fmt.Errorf("invalid length %q", q.Get("length")))
+			return
+		}
+	}
+	page, err := s.debugger.ReadPage(space, addr, length)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, Memory{Space: space.String(), Addr: page.Addr, Size: page.Size, Data: hex.EncodeToString(page.Data)})
+}
+
+func (s *Server) poke(w http.ResponseWriter, r *http.Request) {
+	var m Memory
+	if !readJSON(w, r, &m) {
+		return
+	}
+	space, err := nes.ParseMemorySpace(cmp.Or(m.Space, "cpu"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	data, err := hex.DecodeString(m.Data)
+	if err != nil {
+		writeError(w, fmt.Errorf("invalid data: %s", err))
+		return
+	}
+	if err := s.debugger.Poke(space, m.Addr, data); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) disassembly(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var addr uint16
+	if q.Has("addr") {
+		var err error
+		if addr, err = s.parseAddress(q.Get("addr")); err != nil {
+			writeError(w, err)
+			return
+		}
+	} else {
+		addr = s.debugger.Registers().PC
+	}
+	count := 16
+	if q.Has("count") {
+		n, err := parseNumber(q.Get("count"))
+		if err != nil || n < 0 || n > 0x10000 {
+			writeError(w, fmt.Errorf("invalid count %q", q.Get("count")))
+			return
+		}
+		count = n
+	}
+	instructions := []Instruction{}
+	for _, in := range s.debugger.Disassemble(addr, count) {
+		instructions = append(instructions, Instruction{
+			Addr: in.Addr, Label: in.Label, Bytes: hex.EncodeToString(in.Bytes),
+			Name: in.Name, Text: in.Text, Unofficial: in.Unofficial,
+		})
+	}
+	writeJSON(w, instructions)
+}
+
+func (s *Server) breakpoints(w http.ResponseWriter, r *http.Request) {
+	breakpoints := []Breakpoint{}
+	for _, b := range s.debugger.Breakpoints() {
+		breakpoints = append(breakpoints, Breakpoint{
+			ID: b.ID, Start: fmt.Sprintf("$%04X", b.Start), End: fmt.Sprintf("$%04X", b.End),
+			Access: b.Access.String(), Enabled: b.Enabled,
+			Condition: b.Condition, HitCount: b.HitCount, Hits: b.Hits,
+		})
+	}
+	writeJSON(w, breakpoints)
+}
+
+func (s *Server) addBreakpoint(w http.ResponseWriter, r *http.Request) {
+	var b Breakpoint
+	if !readJSON(w, r, &b) {
+		return
+	}
+	start, err := s.parseAddress(b.Start)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	end := start
+	if b.End != "" {
+		if end, err = s.parseAddress(b.End); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	access, err := debugger.ParseAccess(cmp.Or(b.Access, "x"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	id := s.debugger.AddWatchpoint(start, end, access)
+	if err := s.changeNew(id, b); err != nil {
+		s.debugger.RemoveBreakpoint(id)
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]int{"id": id})
+}
+
+// changeNew sets the condition and the hit count of the new breakpoint
+func (s *Server) changeNew(id int, b Breakpoint) error {
+	if err := s.debugger.SetCondition(id, b.Condition); err != nil {
+		return err
+	}
+	return s.debugger.SetHitCount(id, b.HitCount)
+}
+
+// breakpointChange is the change of PATCH /api/breakpoints/{id},
+// the missing fields stay
+type breakpointChange struct {
+	Enabled   *bool   `json:"enabled"`
+	Condition *string `json:"condition"`
+	HitCount  *int    `json:"hit_count"`
+}
+
+func (s *Server) changeBreakpoint(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid breakpoint ID", http.StatusNotFound)
+		return
+	}
+	var c breakpointChange
+	if !readJSON(w, r, &c) {
+		return
+	}
+	if c.Enabled != nil {
+		err = s.debugger.EnableBreakpoint(id, *c.Enabled)
+	}
+	if c.Condition != nil && err == nil {
+		err = s.debugger.SetCondition(id, *c.Condition)
+	}
+	if c.HitCount != nil && err == nil {
+		err = s.debugger.SetHitCount(id, *c.HitCount)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) removeBreakpoint(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err == nil {
+		err = s.debugger.RemoveBreakpoint(id)
+	}
+	if err != nil {
+		http.Error(w, "no breakpoint "+r.PathValue("id"), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// eventBreaks is the body of /api/event-breaks, the names of ParseEventBreak
+type eventBreaks struct {
+	Events string `json:"events"`
+}
+
+func (s *Server) eventBreaks(w http.ResponseWriter, r *http.Request) {
+	events := s.debugger.EventBreaks()
+	names := ""
+	if events != 0 {
+		names = events.String()
+	}
+	writeJSON(w, eventBreaks{Events: names})
+}
+
+func (s *Server) setEventBreaks(w http.ResponseWriter, r *http.Request) {
+	var e eventBreaks
+	if !readJSON(w, r, &e) {
+		return
+	}
+	var events debugger.EventBreak
+	if strings.TrimSpace(e.Events) != "" {
+		var err error
+		if events, err = debugger.ParseEventBreak(e.Events); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	s.debugger.SetEventBreaks(events)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// events is the event log of the last frame
+type eventLog struct {
+	Logging bool    `json:"logging"`
+	Events  []Event `json:"events"`
+}
+
+func (s *Server) events(w http.ResponseWriter, r *http.Request) {
+	var filter nes.EventFilter
+	for _, name := range splitList(r.URL.Query().Get("types")) {
+		t, err := nes.ParseEventType(name)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		filter.Types = append(filter.Types, t)
+	}
+	for _, name := range splitList(r.URL.Query().Get("sources")) {
+		source, err := nes.ParseEventSource(name)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		filter.Sources = append(filter.Sources, source)
+	}
+	log := eventLog{Logging: s.debugger.EventLogging(), Events: []Event{}}
+	for _, e := range s.debugger.Events(filter) {
+		log.Events = append(log.Events, newEvent(e))
+	}
+	writeJSON(w, log)
+}
+
+func (s *Server) setEventLogging(w http.ResponseWriter, r *http.Request) {
+	var log eventLog
+	if !readJSON(w, r, &log) {
+		return
+	}
+	s.debugger.SetEventLogging(log.Logging)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// splitList splits the comma-separated list, "" is none
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (s *Server) evaluate(w http.ResponseWriter, r *http.Request) {
+	v, err := s.debugger.Evaluate(r.URL.Query().Get("expr"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, map[string]int{"value": v})
+}
+
+func (s *Server) frame(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "image/png")
+	png.Encode(w, s.debugger.Frame())
+}
+
+// stops streams the stops over the WebSocket, the message is the
+// state: the first one is the current state, the next ones the stops
+func (s *Server) stops(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	defer ws.conn.Close()
+	stops, unsubscribe := s.debugger.Subscribe()
+	defer unsubscribe()
+	closed := make(chan struct{})
+	go func() {
+		ws.readUntilClose()
+		close(closed)
+	}()
+
+	paused, stop := s.debugger.State()
+	state := State{Paused: paused}
+	if stop != nil {
+		state.Stop = newStop(*stop)
+	}
+	for {
+		data, _ := json.Marshal(state)
+		if err := ws.WriteText(data); err != nil {
+			return
+		}
+		select {
+		case stop := <-stops:
+			state = State{Paused: true, Stop: newStop(stop)}
+		case <-closed:
+			return
+		}
+	}
+}
+
+// parseAddress returns the CPU address of $hex, 0x hex,
+// decimal or the label
+func (s *Server) parseAddress(text string) (uint16, error) {
+	if n, err := parseNumber(text); err == nil {
+		if n < 0 || n > 0xFFFF {
+			return 0, fmt.Errorf("invalid address %q", text)
+		}
+		return uint16(n), nil
+	}
+	return s.debugger.ParseAddress(text)
+}
+
+// parseMemoryAddress returns the memory, the CPU one by default,
+// and the address in it, the labels are of the CPU
+func (s *Server) parseMemoryAddress(spaceName, text string) (nes.MemorySpace, int, error) {
+	space, err := nes.ParseMemorySpace(cmp.Or(spaceName, "cpu"))
+	if err != nil {
+		return 0, 0, err
+	}
+	if space == nes.MemoryCPU {
+		addr, err := s.parseAddress(cmp.Or(text, "0"))
+		return space, int(addr), err
+	}
+	addr, err := parseNumber(cmp.Or(text, "0"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid address %q", text)
+	}
+	return space, addr, nil
+}
+
+// parseNumber parses $hex, 0x hex or decimal
+func parseNumber(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if h, ok := strings.CutPrefix(s, "$"); ok {
+		n, err := strconv.ParseInt(h, 16, 32)
+		return int(n), err
+	}
+	n, err := strconv.ParseInt(s, 0, 32)
+	return int(n), err
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, fmt.Errorf("invalid JSON: %s", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError replies with the error, the commands needing the paused
+// console conflict with the running one
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, debugger.ErrRunning) {
+		status = http.StatusConflict
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
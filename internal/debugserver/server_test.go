@@ -0,0 +1,281 @@
+package debugserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/debugger"
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startServer serves the debugger of the console running its frames
+// the way the frontends do
+func startServer(t *testing.T) (*debugger.Debugger, *httptest.Server) {
+	console := nestest.NewConsole(t, nestest.LoopROM())
+	d := debugger.New(console)
+	server := httptest.NewServer(New(d))
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if !d.BeginFrame() {
+				time.Sleep(time.Millisecond)
+				continue
+			}
+			console.RunFrame()
+			d.EndFrame()
+		}
+	}()
+	t.Cleanup(func() {
+		server.Close()
+		close(done)
+	})
+	return d, server
+}
+
+// call sends the request with the JSON body, nil is none, and decodes
+// the JSON reply into reply, nil is none. It returns the status
+func call(t *testing.T, server *httptest.Server, method, path string, body, reply any) int {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, server.URL+path, r)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	if reply != nil {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(reply))
+	}
+	return resp.StatusCode
+}
+
+func Test_Server_API(t *testing.T) {
+	d, server := startServer(t)
+
+	var regs Registers
+	assert.Equal(t, http.StatusConflict, call(t, server, "PUT", "/api/registers", Registers{A: 1}, nil))
+	assert.Equal(t, http.StatusNoContent, call(t, server, "POST", "/api/pause", nil, nil))
+	require.Eventually(t, d.Paused, time.Second, time.Millisecond)
+
+	var state State
+	assert.Equal(t, http.StatusOK, call(t, server, "GET", "/api/state", nil, &state))
+	assert.True(t, state.Paused)
+	assert.Equal(t, "pause", state.Stop.Reason)
+
+	call(t, server, "GET", "/api/registers", nil, &regs)
+	assert.Equal(t, newRegisters(d.Registers()), regs)
+	regs.A = 0x42
+	assert.Equal(t, http.StatusOK, call(t, server, "PUT", "/api/registers", regs, &regs))
+	assert.Equal(t, uint8(0x42), d.Registers().A)
+
+	assert.Equal(t, http.StatusNoContent, call(t, server, "PUT", "/api/memory", Memory{Addr: 0x300, Data: "a1b2"}, nil))
+	var mem Memory
+	call(t, server, "GET", "/api/memory?addr=$0300&length=2", nil, &mem)
+	assert.Equal(t, Memory{Space: "cpu", Addr: 0x300, Size: 0x10000, Data: "a1b2"}, mem)
+	call(t, server, "GET", "/api/memory?space=prg&addr=0x10&length=3", nil, &mem)
+	assert.Equal(t, "e61160", mem.Data)
+	var apiErr map[string]string
+	assert.Equal(t, http.StatusBadRequest, call(t, server, "GET", "/api/memory?space=oam&addr=300", nil, &apiErr))
+	assert.Equal(t, "the address $12C is out of the oam memory", apiErr["error"])
+
+	var instructions []Instruction
+	call(t, server, "GET", "/api/disassembly?addr=$8002&count=2", nil, &instructions)
+	assert.Equal(t, []Instruction{
+		{Addr: 0x8002, Bytes: "201080", Name: "JSR", Text: "JSR $8010"},
+		{Addr: 0x8005, Bytes: "e610", Name: "INC", Text: "INC $10"},
+	}, instructions)
+
+	var value map[string]int
+	call(t, server, "GET", "/api/evaluate?expr="+"%5B%240300%5D+%2B+1", nil, &value)
+	assert.Equal(t, 0xA2, value["value"])
+
+	var created map[string]int
+	assert.Equal(t, http.StatusCreated, call(t, server, "POST", "/api/breakpoints",
+		Breakpoint{Start: "$8010", Condition: "A == $42"}, &created))
+	var breakpoints []Breakpoint
+	call(t, server, "GET", "/api/breakpoints", nil, &breakpoints)
+	assert.Equal(t, []Breakpoint{{ID: created["id"], Start: "$8010", End: "$8010", Access: "x", Enabled: true, Condition: "A == $42"}}, breakpoints)
+	assert.Equal(t, http.StatusBadRequest, call(t, server, "POST", "/api/breakpoints", Breakpoint{Start: "nowhere"}, nil))
+
+	// the step over runs the subroutine, the breakpoint stops it
+	call(t, server, "GET", "/api/registers", nil, &regs)
+	for regs.PC != 0x8002 {
+		require.Equal(t, http.StatusNoContent, call(t, server, "POST", "/api/step", nil, nil))
+		require.Eventually(t, d.Paused, time.Second, time.Millisecond)
+		call(t, server, "GET", "/api/registers", nil, &regs)
+	}
+	call(t, server, "POST", "/api/step?kind=over", nil, nil)
+	require.Eventually(t, d.Paused, time.Second, time.Millisecond)
+	call(t, server, "GET", "/api/state", nil, &state)
+	assert.Equal(t, "breakpoint", state.Stop.Reason)
+	assert.Equal(t, uint16(0x8010), state.Stop.Registers.PC)
+
+	off := false
+	path := "/api/breakpoints/" + strconv.Itoa(created["id"])
+	assert.Equal(t, http.StatusNoContent, call(t, server, "PATCH", path, map[string]any{"enabled": off}, nil))
+	assert.False(t, d.Breakpoints()[0].Enabled)
+	assert.Equal(t, http.StatusNoContent, call(t, server, "DELETE", path, nil, nil))
+	assert.Equal(t, http.StatusNotFound, call(t, server, "DELETE", path, nil, nil))
+
+	assert.Equal(t, http.StatusNoContent, call(t, server, "PUT", "/api/event-breaks", map[string]string{"events": "brk, nmi"}, nil))
+	var events map[string]string
+	call(t, server, "GET", "/api/event-breaks", nil, &events)
+	assert.Equal(t, "nmi,brk", events["events"])
+	assert.Equal(t, debugger.BreakNMI|debugger.BreakBRK, d.EventBreaks())
+
+	var log eventLog
+	assert.Equal(t, http.StatusNoContent, call(t, server, "PUT", "/api/events", eventLog{Logging: true}, nil))
+	d.Resume()
+	require.Eventually(t, func() bool {
+		call(t, server, "GET", "/api/events?types=vblank&sources=ppu,cpu", nil, &log)
+		return len(log.Events) > 0
+	}, time.Second, time.Millisecond)
+	assert.True(t, log.Logging)
+	assert.Equal(t, []Event{{Type: "vblank", Source: "ppu", Frame: log.Events[0].Frame, Scanline: 241, Dot: log.Events[0].Dot,
+		PC: log.Events[0].PC, Addr: 0x2002, Data: 0x80}}, log.Events)
+	call(t, server, "GET", "/api/events?sources=mapper", nil, &log)
+	assert.Empty(t, log.Events)
+	assert.Equal(t, http.StatusBadRequest, call(t, server, "GET", "/api/events?types=nope", nil, nil))
+
+	resp, err := http.Get(server.URL + "/api/frame")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	img, err := png.Decode(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, nes.FrameWidth, img.Bounds().Dx())
+}
+
+func Test_Server_Stops(t *testing.T) {
+	d, server := startServer(t)
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	conn.Write([]byte("GET /api/stops HTTP/1.1\r\nHost: localhost\r\n" +
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+
+	readState := func() State {
+		var head [2]byte
+		_, err := io.ReadFull(r, head[:])
+		require.NoError(t, err)
+		assert.Equal(t, byte(0x81), head[0], "a text message")
+		n := int(head[1])
+		if n == 126 {
+			var ext [2]byte
+			io.ReadFull(r, ext[:])
+			n = int(binary.BigEndian.Uint16(ext[:]))
+		}
+		data := make([]byte, n)
+		_, err = io.ReadFull(r, data)
+		require.NoError(t, err)
+		var state State
+		require.NoError(t, json.Unmarshal(data, &state))
+		return state
+	}
+	assert.Equal(t, State{}, readState(), "the state comes first")
+
+	d.AddBreakpoint(0x8010)
+	state := readState()
+	assert.True(t, state.Paused)
+	assert.Equal(t, "breakpoint", state.Stop.Reason)
+
+	// the masked close frame of the client
+	conn.Write([]byte{0x88, 0x80, 1, 2, 3, 4})
+	var head [2]byte
+	_, err = io.ReadFull(r, head[:])
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x88), head[0], "the close is answered")
+}
+
+func Test_Server_Forbidden(t *testing.T) {
+	d, server := startServer(t)
+
+	send := func(method, path, host, contentType string) int {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader("{}"))
+		require.NoError(t, err)
+		req.Host = host
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, send("GET", "/api/state", "localhost:6502", ""))
+	assert.Equal(t, http.StatusForbidden, send("GET", "/api/state", "rebound.example.com:6502", ""),
+		"the DNS rebinding")
+	assert.Equal(t, http.StatusUnsupportedMediaType, send("POST", "/api/pause", "localhost", "text/plain"),
+		"the form of a web page")
+	assert.Equal(t, http.StatusUnsupportedMediaType, send("POST", "/api/pause", "localhost", ""))
+	assert.False(t, d.Paused())
+	assert.Equal(t, http.StatusNoContent, send("POST", "/api/pause", "localhost", "application/json; charset=utf-8"))
+	assert.True(t, d.Paused())
+
+	handshake := func(origin string) int {
+		conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+		require.NoError(t, err)
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		conn.Write([]byte("GET /api/stops HTTP/1.1\r\nHost: localhost\r\nOrigin: " + origin + "\r\n" +
+			"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+			"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"))
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusForbidden, handshake("https://example.com"))
+	assert.Equal(t, http.StatusSwitchingProtocols, handshake("http://localhost:6502"))
+}
+
+func Test_Server_Search(t *testing.T) {
+	d, server := startServer(t)
+	d.Pause()
+	require.Eventually(t, d.Paused, time.Second, time.Millisecond)
+
+	var results SearchResults
+	assert.Equal(t, http.StatusBadRequest, call(t, server, "GET", "/api/search", nil, nil), "no search yet")
+	require.NoError(t, d.Poke(nes.MemoryCPU, 0x300, []uint8{5}))
+	assert.Equal(t, http.StatusOK, call(t, server, "PUT", "/api/search", SearchStart{Width: 8}, &results))
+	assert.Equal(t, 0x800, results.Count)
+
+	require.NoError(t, d.Poke(nes.MemoryCPU, 0x300, []uint8{4}))
+	assert.Equal(t, http.StatusOK, call(t, server, "POST", "/api/search/filter", SearchFilter{Compare: "less", Operand: 1}, &results))
+	assert.Equal(t, SearchResults{Count: 1, Results: []SearchResult{{Addr: 0x300, Value: 4, Previous: 4}}}, results)
+	assert.Equal(t, http.StatusOK, call(t, server, "GET", "/api/search?limit=0", nil, &results))
+	assert.Equal(t, SearchResults{Count: 1, Results: []SearchResult{}}, results)
+
+	assert.Equal(t, http.StatusBadRequest, call(t, server, "PUT", "/api/search", SearchStart{Width: 32}, nil))
+	assert.Equal(t, http.StatusBadRequest, call(t, server, "POST", "/api/search/filter", SearchFilter{Compare: "odd"}, nil))
+}
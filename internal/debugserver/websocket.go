@@ -0,0 +1,167 @@
+package debugserver
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// the GUID of the WebSocket handshake, RFC 6455
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// the opcodes of the WebSocket frames
+const (
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+)
+
+// websocket is the server side of the WebSocket connection,
+// the server sends the text messages and answers the control frames
+type websocket struct {
+	conn net.Conn
+	r    *bufio.Reader
+	mu   sync.Mutex // held by the writes
+}
+
+// upgradeWebSocket switches the HTTP connection to the WebSocket
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*websocket, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !headerHas(r.Header, "Connection", "upgrade") || !headerHas(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "the WebSocket handshake is expected", http.StatusBadRequest)
+		return nil, errors.New("not a WebSocket handshake")
+	}
+	// the browsers send the origin of the page, the other clients none
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !allowedHost(r, u.Host) {
+			http.Error(w, "the origin isn't allowed", http.StatusForbidden)
+			return nil, errors.New("the origin isn't allowed")
+		}
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "the connection can't be upgraded", http.StatusInternalServerError)
+		return nil, errors.New("the connection can't be hijacked")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &websocket{conn: conn, r: rw.Reader}, nil
+}
+
+// headerHas reports whether the comma-separated header has the token
+func headerHas(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteText sends the text message
+func (ws *websocket) WriteText(data []byte) error {
+	return ws.writeFrame(opText, data)
+}
+
+func (ws *websocket) writeFrame(op byte, data []byte) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	header := []byte{0x80 | op}
+	switch n := len(data); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	if _, err := ws.conn.Write(append(header, data...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readUntilClose reads the frames of the client, answers the pings and
+// drops the messages. It returns when the client closes the connection
+func (ws *websocket) readUntilClose() {
+	defer ws.conn.Close()
+	for {
+		op, payload, err := ws.readFrame()
+		if err != nil {
+			return
+		}
+		switch op {
+		case opClose:
+			ws.writeFrame(opClose, payload)
+			return
+		case opPing:
+			ws.writeFrame(opPong, payload)
+		}
+	}
+}
+
+// readFrame reads the masked frame of the client
+func (ws *websocket) readFrame() (byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(ws.r, head[:]); err != nil {
+		return 0, nil, err
+	}
+	op := head[0] & 0x0F
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	// the server reads the commands over HTTP, the messages are small
+	if n > 1<<16 {
+		return 0, nil, errors.New("the WebSocket message is too long")
+	}
+	var mask [4]byte
+	if head[1]&0x80 != 0 {
+		if _, err := io.ReadFull(ws.r, mask[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(ws.r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return op, payload, nil
+}
@@ -0,0 +1,18 @@
+package frontend
+
+// SetAPULog records the sound register writes of the game to export them
+// to the file on SaveAPULog, "" turns the recording off. The run-ahead
+// is off while they are recorded
+func (s *Session) SetAPULog(path string) {
+	s.apuLog = path
+	s.Console.APU().SetWriteLogging(path != "")
+}
+
+// SaveAPULog exports the recorded sound register writes, the frontends
+// call it on exit. It does nothing without SetAPULog
+func (s *Session) SaveAPULog() error {
+	if s.apuLog == "" {
+		return nil
+	}
+	return s.Console.APU().SaveWriteLog(s.apuLog)
+}
@@ -0,0 +1,32 @@
+package frontend
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Session_SaveAPULog(t *testing.T) {
+	console := newCountingConsole(t)
+	s := NewSession(console, "test.nes")
+	assert.NoError(t, s.SaveAPULog(), "nothing is exported without the log")
+
+	path := filepath.Join(t.TempDir(), "apu.log")
+	s.SetAPULog(path)
+	assert.True(t, console.Instrumented(), "the run-ahead is off")
+	s.RunFrame(HostInput{})
+	console.WriteMemory(0x4015, 0x0F)
+	require.NoError(t, s.SaveAPULog())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "# nestic APU write log\n"))
+	assert.Contains(t, string(data), " 4015 0F\n")
+
+	s.SetAPULog("")
+	assert.False(t, console.Instrumented())
+}
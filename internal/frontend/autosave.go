@@ -0,0 +1,175 @@
+package frontend
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Resume is what happens to the auto-saved state of the game at the launch
+type Resume int
+
+const (
+	// ResumeOff starts the game from the power-on
+	ResumeOff Resume = iota
+	// ResumeAsk offers the auto-saved state for a while,
+	// the load state hotkey resumes it
+	ResumeAsk
+	// ResumeAuto loads the auto-saved state
+	ResumeAuto
+)
+
+var resumeNames = []string{"off", "ask", "auto"}
+
+func (r Resume) String() string {
+	if int(r) < len(resumeNames) {
+		return resumeNames[r]
+	}
+	return fmt.Sprintf("Resume(%d)", int(r))
+}
+
+// ParseResume parses the name of the resume behavior: off, ask or auto
+func ParseResume(name string) (Resume, error) {
+	for i, n := range resumeNames {
+		if n == name {
+			return Resume(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid resume behavior %q", name)
+}
+
+// resumeOfferTime is how long the auto-saved state is offered
+const resumeOfferTime = 10 * time.Second
+
+// autoSave saves the state of the game on exit and every interval
+type autoSave struct {
+	dir      string
+	interval int // frames, 0: only on exit
+	due      int // the frames until the next save
+}
+
+// AutoStateName returns the file name of the auto-saved state:
+// the ROM name without the extension and the CRC32 of the game
+func AutoStateName(game string, crc uint32) string {
+	name := strings.TrimSuffix(filepath.Base(game), filepath.Ext(game))
+	return fmt.Sprintf("%s-%08X.auto.state", name, crc)
+}
+
+// SetAutoSave saves the state of the game into the states directory
+// on AutoSaveState and every interval, the zero interval only saves
+// on AutoSaveState
+func (s *Session) SetAutoSave(dir string, interval time.Duration) {
+	frames := int(interval.Seconds() * s.Console.Region().FrameRate())
+	s.autoSave = &autoSave{dir: dir, interval: frames, due: frames}
+}
+
+// AutoSaveState saves the auto-saved state of the game, the frontends call
+// it on exit. It does nothing without SetAutoSave
+func (s *Session) AutoSaveState() error {
+	if s.autoSave == nil || s.Console.Cart() == nil {
+		return nil
+	}
+	path, err := s.autoStatePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("couldn't create the directory: %s", err)
+	}
+	return s.Console.SaveStateFile(path)
+}
+
+// autoStatePath returns the path of the auto-saved state of the game
+func (s *Session) autoStatePath() (string, error) {
+	dir := s.autoSave.dir
+	if dir == "" {
+		var err error
+		if dir, err = DefaultStateDir(); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, AutoStateName(s.Game, s.Console.Cart().CRC())), nil
+}
+
+// tickAutoSave saves the state every interval,
+// so a crash loses the last interval at most
+func (s *Session) tickAutoSave() {
+	a := s.autoSave
+	if a == nil || a.interval == 0 {
+		return
+	}
+	if a.due--; a.due > 0 {
+		return
+	}
+	a.due = a.interval
+	if err := s.AutoSaveState(); err != nil {
+		s.OSD.Show("Couldn't auto-save: %s", err)
+	}
+}
+
+// Resume resumes the auto-saved state of the game the way the mode says,
+// the keys of the load state hotkey are shown with the offer
+func (s *Session) Resume(mode Resume, keys []string) error {
+	s.resume, s.resumeKeys = mode, keys
+	s.resumeOffer = 0
+	s.OSD.SetIndicator("resume", "")
+	if mode == ResumeOff || s.autoSave == nil || s.Console.Cart() == nil {
+		return nil
+	}
+	path, err := s.autoStatePath()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if mode == ResumeAuto {
+		return s.resumeAutoState()
+	}
+	s.resumeOffer = int(resumeOfferTime.Seconds() * s.Console.Region().FrameRate())
+	text := "Load the state to resume"
+	if len(keys) > 0 {
+		text = fmt.Sprintf("Press %s to resume", strings.Join(keys, " or "))
+	}
+	s.OSD.SetIndicator("resume", text)
+	return nil
+}
+
+// ResumeOffered reports whether the auto-saved state is offered,
+// LoadState resumes it instead of loading the slot
+func (s *Session) ResumeOffered() bool {
+	return s.resumeOffer > 0
+}
+
+// resumeAutoState loads the auto-saved state and ends the offer
+func (s *Session) resumeAutoState() error {
+	s.endResumeOffer()
+	path, err := s.autoStatePath()
+	if err != nil {
+		return err
+	}
+	if err := s.Console.LoadStateFile(path); err != nil {
+		return err
+	}
+	copy(s.frame.Pix, s.Console.PPU().Frame().Pix)
+	s.OSD.Show("Resumed")
+	return nil
+}
+
+// tickResumeOffer ends the offer once its time is up
+func (s *Session) tickResumeOffer() {
+	if s.resumeOffer == 0 {
+		return
+	}
+	if s.resumeOffer--; s.resumeOffer == 0 {
+		s.endResumeOffer()
+	}
+}
+
+func (s *Session) endResumeOffer() {
+	s.resumeOffer = 0
+	s.OSD.SetIndicator("resume", "")
+}
@@ -0,0 +1,96 @@
+package frontend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseResume(t *testing.T) {
+	for _, r := range []Resume{ResumeOff, ResumeAsk, ResumeAuto} {
+		parsed, err := ParseResume(r.String())
+		assert.NoError(t, err)
+		assert.Equal(t, r, parsed)
+	}
+	_, err := ParseResume("always")
+	assert.EqualError(t, err, `invalid resume behavior "always"`)
+}
+
+func Test_AutoStateName(t *testing.T) {
+	assert.Equal(t, "smb-0012ABCD.auto.state", AutoStateName("roms/smb.nes", 0x12ABCD))
+}
+
+func Test_Session_Resume(t *testing.T) {
+	dir := t.TempDir()
+	console := newCountingConsole(t)
+	s := NewSession(console, "test.nes")
+	assert.NoError(t, s.AutoSaveState(), "nothing is saved without the auto-save")
+	s.SetAutoSave(dir, 0)
+	for i := 0; i < 5; i++ {
+		s.RunFrame(HostInput{})
+	}
+	count := console.RAM().Read8(0x11)
+	require.NoError(t, s.AutoSaveState())
+
+	t.Run("auto", func(t *testing.T) {
+		console := newCountingConsole(t)
+		s := NewSession(console, "test.nes")
+		s.SetAutoSave(dir, 0)
+		require.NoError(t, s.Resume(ResumeAuto, nil))
+		assert.Equal(t, count, console.RAM().Read8(0x11))
+		assert.False(t, s.ResumeOffered())
+	})
+	t.Run("ask", func(t *testing.T) {
+		console := newCountingConsole(t)
+		s := NewSession(console, "test.nes")
+		s.SetAutoSave(dir, 0)
+		require.NoError(t, s.Resume(ResumeAsk, []string{"F4"}))
+		assert.True(t, s.ResumeOffered())
+		assert.Contains(t, s.OSD.indicators["resume"], "Press F4 to resume")
+		s.RunFrame(HostInput{})
+		require.NoError(t, s.LoadState(filepath.Join(dir, "slots")), "the load state hotkey resumes")
+		assert.Equal(t, count, console.RAM().Read8(0x11))
+		assert.False(t, s.ResumeOffered())
+	})
+	t.Run("ask times out", func(t *testing.T) {
+		s := NewSession(newCountingConsole(t), "test.nes")
+		s.SetAutoSave(dir, 0)
+		require.NoError(t, s.Resume(ResumeAsk, nil))
+		assert.Equal(t, int(resumeOfferTime.Seconds()*60), s.resumeOffer)
+		s.resumeOffer = 2
+		s.RunFrame(HostInput{})
+		assert.True(t, s.ResumeOffered())
+		s.RunFrame(HostInput{})
+		assert.False(t, s.ResumeOffered())
+		assert.Empty(t, s.OSD.indicators["resume"])
+	})
+	t.Run("another game", func(t *testing.T) {
+		s := NewSession(newCountingConsole(t), "other.nes")
+		s.SetAutoSave(dir, 0)
+		require.NoError(t, s.Resume(ResumeAsk, nil))
+		assert.False(t, s.ResumeOffered(), "the game has no auto-saved state")
+	})
+}
+
+func Test_Session_AutoSaveInterval(t *testing.T) {
+	dir := t.TempDir()
+	console := newCountingConsole(t)
+	s := NewSession(console, "test.nes")
+	s.SetAutoSave(dir, time.Second)
+	path := filepath.Join(dir, AutoStateName("test.nes", console.Cart().CRC()))
+
+	for i := 0; i < 59; i++ {
+		s.RunFrame(HostInput{})
+	}
+	assert.NoFileExists(t, path)
+	s.RunFrame(HostInput{})
+	assert.FileExists(t, path, "the state is saved every second")
+
+	require.NoError(t, os.Remove(path))
+	s.SwapCart(console.Cart(), "test.nes")
+	assert.FileExists(t, path, "the state is saved before the game is swapped")
+}
@@ -0,0 +1,84 @@
+package frontend
+
+import "fmt"
+
+// Background is what the console does while its window doesn't have the focus
+type Background int
+
+const (
+	// BackgroundRun runs the console as with the focus,
+	// the gamepads keep working
+	BackgroundRun Background = iota
+	// BackgroundPause pauses the console until the focus is back
+	BackgroundPause
+	// BackgroundMute runs the console without the sound
+	BackgroundMute
+	// BackgroundIgnoreInput runs the console with the sound,
+	// the keyboard, the gamepads and the mouse are ignored
+	BackgroundIgnoreInput
+)
+
+var backgroundNames = []string{"run", "pause", "mute", "ignore_input"}
+
+func (b Background) String() string {
+	if int(b) < len(backgroundNames) {
+		return backgroundNames[b]
+	}
+	return fmt.Sprintf("Background(%d)", int(b))
+}
+
+// ParseBackground parses the name of the background
+// behavior: run, pause, mute or ignore_input
+func ParseBackground(name string) (Background, error) {
+	for i, n := range backgroundNames {
+		if n == name {
+			return Background(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid background behavior %q", name)
+}
+
+// SetBackground sets what the console does while the window doesn't have the focus
+func (s *Session) SetBackground(b Background) {
+	s.background = b
+	s.applyFocus()
+}
+
+// SetFocused tells whether the window has the focus,
+// the frontends call it before every frame
+func (s *Session) SetFocused(focused bool) {
+	if s.focused == focused {
+		return
+	}
+	s.focused = focused
+	s.applyFocus()
+}
+
+// BackgroundPaused reports whether the console is paused for the lost focus
+func (s *Session) BackgroundPaused() bool {
+	return !s.focused && s.background == BackgroundPause
+}
+
+// BackgroundMuted reports whether the sound is muted for the lost focus,
+// the muted sound doesn't fill the audio buffer
+func (s *Session) BackgroundMuted() bool {
+	return !s.focused && s.background == BackgroundMute
+}
+
+// backgroundInput reports whether the input is ignored for the lost focus
+func (s *Session) backgroundInput() bool {
+	return !s.focused && s.background == BackgroundIgnoreInput
+}
+
+func (s *Session) applyFocus() {
+	s.applySlowMotion()
+	s.OSD.SetIndicator("background", indicatorText(s.BackgroundPaused(), "Paused in the background"))
+}
+
+// indicatorText returns the text while the indicator is on
+func indicatorText(on bool, text string) string {
+	if on {
+		return text
+	}
+	return ""
+}
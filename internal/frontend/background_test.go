@@ -0,0 +1,56 @@
+package frontend
+
+import (
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseBackground(t *testing.T) {
+	for _, b := range []Background{BackgroundRun, BackgroundPause, BackgroundMute, BackgroundIgnoreInput} {
+		parsed, err := ParseBackground(b.String())
+		assert.NoError(t, err)
+		assert.Equal(t, b, parsed)
+	}
+	_, err := ParseBackground("sleep")
+	assert.Error(t, err)
+}
+
+func Test_Session_SetFocused(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := NewSession(console, "test.nes")
+	apu := console.APU()
+
+	s.SetBackground(BackgroundPause)
+	s.SetFocused(false)
+	assert.True(t, s.BackgroundPaused())
+	indicators, _ := s.OSD.Lines()
+	assert.Equal(t, []string{"Paused in the background"}, indicators)
+	s.SetFocused(true)
+	assert.False(t, s.BackgroundPaused())
+
+	s.SetBackground(BackgroundMute)
+	s.SetFocused(false)
+	assert.True(t, s.BackgroundMuted())
+	assert.False(t, apu.SampleOutput())
+	s.RunFast(HostInput{}, 2, false)
+	assert.False(t, apu.SampleOutput(), "the fast-forward stays muted")
+	s.SetFocused(true)
+	assert.True(t, apu.SampleOutput())
+
+	s.SetBackground(BackgroundIgnoreInput)
+	s.SetFocused(false)
+	assert.True(t, apu.SampleOutput())
+	s.RunFrame(HostInput{Keys: []string{"X"}})
+	assert.Equal(t, [4]nes.Button{}, console.InputView().Buttons)
+	s.SetFocused(true)
+	s.RunFrame(HostInput{Keys: []string{"X"}})
+	assert.Equal(t, [4]nes.Button{nes.ButtonA}, console.InputView().Buttons)
+
+	s.SetBackground(BackgroundRun)
+	s.SetFocused(false)
+	s.RunFrame(HostInput{Keys: []string{"X"}})
+	assert.Equal(t, [4]nes.Button{nes.ButtonA}, console.InputView().Buttons, "the gamepads keep working")
+}
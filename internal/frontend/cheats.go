@@ -0,0 +1,77 @@
+package frontend
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/nevisdale/nestic/internal/cheats"
+)
+
+// SetCheatDir loads the cheat list of the game from the directory and
+// applies its enabled cheats, "" is the default directory. The list of
+// the new game is loaded when the game is swapped
+func (s *Session) SetCheatDir(dir string) error {
+	s.cheatDir = dir
+	s.cheats = &cheats.List{}
+	return s.loadCheats()
+}
+
+// Cheats returns the cheat list of the game,
+// nil while the cheat directory isn't set
+func (s *Session) Cheats() *cheats.List {
+	return s.cheats
+}
+
+// SaveCheats saves the changed cheat list of the game and applies it
+func (s *Session) SaveCheats() error {
+	if s.cheats == nil {
+		return errors.New("the cheat directory isn't set")
+	}
+	path, err := s.cheatPath()
+	if err != nil {
+		return err
+	}
+	s.cheats.Apply(s.Console)
+	if err := s.cheats.Save(path); err != nil {
+		return fmt.Errorf("couldn't save the cheats: %s", err)
+	}
+	return nil
+}
+
+// cheatPath returns the path of the cheat list of the game
+func (s *Session) cheatPath() (string, error) {
+	cart := s.Console.Cart()
+	if cart == nil {
+		return "", errors.New("no game is loaded")
+	}
+	dir := s.cheatDir
+	if dir == "" {
+		var err error
+		if dir, err = cheats.DefaultDir(); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, cheats.ListName(s.Game, cart.CRC())), nil
+}
+
+// loadCheats loads the cheat list of the game and applies it
+func (s *Session) loadCheats() error {
+	s.Console.SetROMPatches(nil)
+	s.Console.SetRAMFreezes(nil)
+	path, err := s.cheatPath()
+	if err != nil {
+		return err
+	}
+	list, err := cheats.LoadList(path)
+	if err != nil {
+		s.cheats = &cheats.List{}
+		return fmt.Errorf("couldn't load the cheats: %s", err)
+	}
+	s.cheats = list
+	list.Apply(s.Console)
+	if n := len(s.Console.ROMPatches()) + len(s.Console.RAMFreezes()); n > 0 {
+		s.OSD.Show("Cheats on: %d", n)
+	}
+	return nil
+}
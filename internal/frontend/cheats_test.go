@@ -0,0 +1,39 @@
+package frontend
+
+import (
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/cheats"
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Session_Cheats(t *testing.T) {
+	s := NewSession(nestest.NewConsole(t, nestest.NewROM()), "test.nes")
+	assert.Nil(t, s.Cheats())
+	assert.Error(t, s.SaveCheats())
+
+	dir := t.TempDir()
+	require.NoError(t, s.SetCheatDir(dir))
+	require.NoError(t, s.Cheats().Add("SXIOPO", "Infinite lives"))
+	require.NoError(t, s.Cheats().Add("0075:09", "9 lives"))
+	require.NoError(t, s.SaveCheats())
+	assert.Equal(t, []nes.ROMPatch{{Addr: 0x91D9, Value: 0xAD}}, s.Console.ROMPatches())
+	assert.Equal(t, []nes.RAMFreeze{{Addr: 0x75, Value: 9}}, s.Console.RAMFreezes())
+
+	// the list of the game is loaded again
+	s = NewSession(nestest.NewConsole(t, nestest.NewROM()), "test.nes")
+	require.NoError(t, s.SetCheatDir(dir))
+	assert.Len(t, s.Console.ROMPatches(), 1)
+	assert.Len(t, s.Console.RAMFreezes(), 1)
+
+	// the other game has no cheats
+	rom := nestest.NewROM()
+	rom[16] = 1
+	require.NoError(t, s.SwapCart(nestest.NewCart(t, rom), "other.nes"))
+	assert.Empty(t, s.Console.ROMPatches())
+	assert.Empty(t, s.Console.RAMFreezes())
+	assert.Equal(t, &cheats.List{}, s.Cheats())
+}
@@ -0,0 +1,268 @@
+package frontend
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// ClipBuffer keeps the last frames in the palette form, the NES picture
+// rarely has more than a few dozen colors, so a frame takes a byte per pixel
+type ClipBuffer struct {
+	frames []*image.Paletted
+	next   int // the slot of the next frame
+	count  int
+
+	colors map[color.RGBA]uint8
+}
+
+// NewClipBuffer returns the buffer of the last frames
+func NewClipBuffer(frames int) *ClipBuffer {
+	return &ClipBuffer{
+		frames: make([]*image.Paletted, max(frames, 1)),
+		colors: map[color.RGBA]uint8{},
+	}
+}
+
+// Add keeps the frame, dropping the oldest one when the buffer is full
+func (c *ClipBuffer) Add(frame *image.RGBA) {
+	dst := c.frames[c.next]
+	if dst == nil {
+		dst = image.NewPaletted(frame.Bounds(), nil)
+		c.frames[c.next] = dst
+	}
+	c.toPaletted(frame, dst)
+	c.next = (c.next + 1) % len(c.frames)
+	c.count = min(c.count+1, len(c.frames))
+}
+
+// toPaletted converts the frame with its own colors, or dithers it
+// to the standard palette when it has more than 256 of them
+func (c *ClipBuffer) toPaletted(frame *image.RGBA, dst *image.Paletted) {
+	clear(c.colors)
+	dst.Palette = dst.Palette[:0]
+	var last color.RGBA
+	var index uint8
+	for i := 0; i < len(dst.Pix); i++ {
+		p := frame.Pix[i*4 : i*4+4]
+		rgba := color.RGBA{p[0], p[1], p[2], p[3]}
+		// the runs of a color skip the lookup
+		if rgba == last && i > 0 {
+			dst.Pix[i] = index
+			continue
+		}
+		last = rgba
+		var ok bool
+		if index, ok = c.colors[rgba]; !ok {
+			if len(dst.Palette) == 256 {
+				dst.Palette = append(dst.Palette[:0], palette.Plan9...)
+				draw.FloydSteinberg.Draw(dst, dst.Rect, frame, image.Point{})
+				return
+			}
+			index = uint8(len(dst.Palette))
+			c.colors[rgba] = index
+			dst.Palette = append(dst.Palette, rgba)
+		}
+		dst.Pix[i] = index
+	}
+}
+
+// Len returns the number of the kept frames
+func (c *ClipBuffer) Len() int {
+	return c.count
+}
+
+// Frames returns the kept frames from the oldest, they are reused by Add
+func (c *ClipBuffer) Frames() []*image.Paletted {
+	frames := make([]*image.Paletted, 0, c.count)
+	start := (c.next - c.count + len(c.frames)) % len(c.frames)
+	for i := 0; i < c.count; i++ {
+		frames = append(frames, c.frames[(start+i)%len(c.frames)])
+	}
+	return frames
+}
+
+// ClipOptions are how the clips are saved
+type ClipOptions struct {
+	Dir    string // "": DefaultClipDir
+	Format string // gif, or webm encoded by ffmpeg. "": gif
+	FFmpeg string // the ffmpeg command, "": ffmpeg
+}
+
+// DefaultClipDir returns the clips directory in the user config directory
+func DefaultClipDir() (string, error) {
+	return configDir("clips")
+}
+
+// SetClipLength keeps the frames of the last d for SaveClip, 0 keeps none
+func (s *Session) SetClipLength(d time.Duration) {
+	s.clip, s.clipLength = nil, d
+	if frames := int(d.Seconds() * s.Console.Region().FrameRate()); frames > 0 {
+		s.clip = NewClipBuffer(frames)
+	}
+}
+
+// SaveClip starts saving the kept frames as a silent clip into the clips
+// directory and returns its path. The clip is encoded in the background
+// from a copy of the frames, the OSD tells when it is saved
+func (s *Session) SaveClip(opts ClipOptions) (string, error) {
+	if s.clip == nil || s.clip.Len() == 0 {
+		return "", fmt.Errorf("no frames are kept for the clip")
+	}
+	if s.clipDone != nil {
+		return "", fmt.Errorf("the last clip is still being saved")
+	}
+	format := strings.ToLower(opts.Format)
+	if format == "" {
+		format = "gif"
+	}
+	command := opts.FFmpeg
+	if command == "" {
+		command = "ffmpeg"
+	}
+	var encode func(path string, frames []*image.Paletted, rate float64) error
+	switch format {
+	case "gif":
+		encode = saveGIF
+	case "webm", "mp4", "mkv":
+		encode = func(path string, frames []*image.Paletted, rate float64) error {
+			return encodeClip(command, path, frames, rate)
+		}
+	default:
+		return "", fmt.Errorf("unknown clip format %q", opts.Format)
+	}
+	dir := opts.Dir
+	if dir == "" {
+		var err error
+		if dir, err = DefaultClipDir(); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("couldn't create the directory: %s", err)
+	}
+	path := filepath.Join(dir, captureName(s.Game, time.Now(), "."+format))
+	rate := s.Console.Region().FrameRate()
+
+	// Add reuses the frames while the clip is encoded
+	frames := s.clip.Frames()
+	for i, frame := range frames {
+		frames[i] = &image.Paletted{
+			Pix:     slices.Clone(frame.Pix),
+			Stride:  frame.Stride,
+			Rect:    frame.Rect,
+			Palette: slices.Clone(frame.Palette),
+		}
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- encode(path, frames, rate)
+	}()
+	s.clipDone = done
+	s.OSD.Show("Saving the clip")
+	return path, nil
+}
+
+// tickClip shows on the OSD how saving the clip ended
+func (s *Session) tickClip() {
+	select {
+	case err := <-s.clipDone:
+		s.clipDone = nil
+		if err != nil {
+			s.OSD.Show("Couldn't save the clip: %s", err)
+		} else {
+			s.OSD.Show("Clip saved")
+		}
+	default:
+	}
+}
+
+// WaitClip waits until the clip being saved is written and returns
+// the error of saving it, the frontends call it on exit
+func (s *Session) WaitClip() error {
+	if s.clipDone == nil {
+		return nil
+	}
+	err := <-s.clipDone
+	s.clipDone = nil
+	return err
+}
+
+// saveGIF writes every second frame, the browsers slow down the GIFs
+// with the delays below 2/100 s. The delays add up to the real time
+func saveGIF(path string, frames []*image.Paletted, rate float64) error {
+	anim := &gif.GIF{}
+	elapsed := 0.0 // in 1/100 s
+	for i := 0; i < len(frames); i += 2 {
+		start := int(elapsed + 0.5)
+		elapsed += 2 * 100 / rate
+		anim.Image = append(anim.Image, frames[i])
+		anim.Delay = append(anim.Delay, int(elapsed+0.5)-start)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("couldn't create the file: %s", err)
+	}
+	w := bufio.NewWriter(file)
+	if err := gif.EncodeAll(w, anim); err != nil {
+		file.Close()
+		return fmt.Errorf("couldn't encode the GIF: %s", err)
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("couldn't write the file: %s", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("couldn't write the file: %s", err)
+	}
+	return nil
+}
+
+// encodeClip pipes the raw frames into ffmpeg
+func encodeClip(command, path string, frames []*image.Paletted, rate float64) error {
+	var stderr bytes.Buffer
+	cmd := exec.Command(command, "-y", "-loglevel", "error",
+		"-f", "rawvideo", "-pixel_format", "rgba",
+		"-video_size", fmt.Sprintf("%dx%d", nes.FrameWidth, nes.FrameHeight),
+		"-framerate", strconv.FormatFloat(rate, 'f', -1, 64),
+		"-i", "pipe:0",
+		"-pix_fmt", "yuv420p", path)
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("couldn't create the pipe: %s", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("couldn't start ffmpeg: %s", err)
+	}
+	rgba := image.NewRGBA(image.Rect(0, 0, nes.FrameWidth, nes.FrameHeight))
+	for _, frame := range frames {
+		draw.Draw(rgba, rgba.Rect, frame, image.Point{}, draw.Src)
+		if _, err = stdin.Write(rgba.Pix); err != nil {
+			break
+		}
+	}
+	stdin.Close()
+	if werr := cmd.Wait(); werr != nil {
+		return fmt.Errorf("ffmpeg failed: %s: %s", werr, strings.TrimSpace(stderr.String()))
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't write into ffmpeg: %s", err)
+	}
+	return nil
+}
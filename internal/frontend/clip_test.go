@@ -0,0 +1,78 @@
+package frontend
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ClipBuffer(t *testing.T) {
+	c := NewClipBuffer(3)
+	for i := 0; i < 5; i++ {
+		frame := image.NewRGBA(image.Rect(0, 0, 2, 1))
+		frame.Set(0, 0, color.RGBA{uint8(i), 0, 0, 255})
+		c.Add(frame)
+	}
+	assert.Equal(t, 3, c.Len())
+	frames := c.Frames()
+	for i, frame := range frames {
+		assert.Equal(t, color.RGBA{uint8(i + 2), 0, 0, 255}, frame.At(0, 0), "the oldest first")
+		assert.Equal(t, color.RGBA{}, frame.At(1, 0))
+		assert.Len(t, frame.Palette, 2)
+	}
+}
+
+func Test_ClipBuffer_ManyColors(t *testing.T) {
+	frame := image.NewRGBA(image.Rect(0, 0, 300, 1))
+	for x := 0; x < 300; x++ {
+		frame.Set(x, 0, color.RGBA{uint8(x), uint8(x >> 8), 0, 255})
+	}
+	c := NewClipBuffer(1)
+	c.Add(frame)
+	assert.Len(t, c.Frames()[0].Palette, 256, "dithered to the standard palette")
+}
+
+func Test_Session_SaveClip(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := NewSession(console, "test.nes")
+	_, err := s.SaveClip(ClipOptions{Dir: t.TempDir()})
+	assert.Error(t, err, "no frames are kept")
+
+	s.SetClipLength(100 * time.Millisecond)
+	for i := 0; i < 10; i++ {
+		s.RunFrame(HostInput{})
+	}
+	dir := filepath.Join(t.TempDir(), "clips")
+	last := s.Frame().At(0, 0)
+	path, err := s.SaveClip(ClipOptions{Dir: dir})
+	assert.NoError(t, err)
+	assert.Equal(t, ".gif", filepath.Ext(path))
+	_, err = s.SaveClip(ClipOptions{Dir: dir})
+	assert.EqualError(t, err, "the last clip is still being saved")
+	// the frames are copied for the encoding
+	for _, frame := range s.clip.Frames() {
+		frame.Palette[0] = color.RGBA{1, 2, 3, 255}
+	}
+	require.NoError(t, s.WaitClip())
+	assert.NoError(t, s.WaitClip(), "nothing is being saved")
+
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	anim, err := gif.DecodeAll(file)
+	assert.NoError(t, err)
+	// the 6 frames of 0.1 s, every second one
+	assert.Len(t, anim.Image, 3)
+	assert.Equal(t, []int{3, 4, 3}, anim.Delay)
+	assert.Equal(t, nes.FrameWidth, anim.Config.Width)
+	assert.Equal(t, last, anim.Image[2].At(0, 0))
+}
@@ -0,0 +1,137 @@
+package frontend
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"gopkg.in/yaml.v3"
+)
+
+// MaxScale is the largest window size in multiples of the picture
+const MaxScale = 6
+
+// ClampScale returns the scale limited to 1..MaxScale
+func ClampScale(scale int) int {
+	return max(1, min(scale, MaxScale))
+}
+
+// PixelAspect is the shape of the picture pixels on the screen
+type PixelAspect int
+
+const (
+	AspectSquare PixelAspect = iota
+	AspectCRT                // 8:7, the pixels as wide as the TV showed them
+)
+
+var pixelAspectNames = []string{
+	AspectSquare: "square",
+	AspectCRT:    "8:7",
+}
+
+func (a PixelAspect) String() string {
+	if int(a) < len(pixelAspectNames) {
+		return pixelAspectNames[a]
+	}
+	return fmt.Sprintf("PixelAspect(%d)", int(a))
+}
+
+// ParsePixelAspect parses the name of the pixel aspect: square or 8:7
+func ParsePixelAspect(name string) (PixelAspect, error) {
+	for i, n := range pixelAspectNames {
+		if n == name {
+			return PixelAspect(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid pixel aspect %q", name)
+}
+
+// ratio returns the pixel width to the height
+func (a PixelAspect) ratio() (int, int) {
+	if a == AspectCRT {
+		return 8, 7
+	}
+	return 1, 1
+}
+
+// Width returns the width on the screen of the pixels of the picture
+func (a PixelAspect) Width(pixels int) int {
+	num, den := a.ratio()
+	return (pixels*num + den/2) / den
+}
+
+// WindowSize returns the size of the window showing the picture
+// at the multiple of its height
+func WindowSize(scale int, aspect PixelAspect) image.Point {
+	return image.Pt(aspect.Width(nes.FrameWidth*scale), nes.FrameHeight*scale)
+}
+
+// FitRect returns where the picture is drawn on the screen of the size:
+// the largest rectangle keeping the aspect ratio, centered. With the integer
+// scaling the picture height is a whole multiple of its size while it fits
+func FitRect(screen image.Point, integer bool, aspect PixelAspect) image.Rectangle {
+	num, den := aspect.ratio()
+	w, h := screen.X, screen.X*nes.FrameHeight*den/(nes.FrameWidth*num)
+	if h > screen.Y {
+		w, h = screen.Y*nes.FrameWidth*num/(nes.FrameHeight*den), screen.Y
+	}
+	scale := screen.Y / nes.FrameHeight
+	for scale > 0 && WindowSize(scale, aspect).X > screen.X {
+		scale--
+	}
+	if integer && scale >= 1 {
+		size := WindowSize(scale, aspect)
+		w, h = size.X, size.Y
+	}
+	left, top := (screen.X-w)/2, (screen.Y-h)/2
+	return image.Rect(left, top, left+w, top+h)
+}
+
+// WindowState is the window placement remembered between the runs
+type WindowState struct {
+	X          int  `yaml:"x"`
+	Y          int  `yaml:"y"`
+	Width      int  `yaml:"width"`
+	Height     int  `yaml:"height"`
+	Fullscreen bool `yaml:"fullscreen"`
+}
+
+// WindowStatePath returns the path of the window state file
+// in the user config directory
+func WindowStatePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("couldn't find the config directory: %s", err)
+	}
+	return filepath.Join(dir, "nestic", "window.yaml"), nil
+}
+
+// LoadWindowState reads the window state file
+func LoadWindowState(path string) (WindowState, error) {
+	var s WindowState
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, fmt.Errorf("couldn't read the file: %s", err)
+	}
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return s, fmt.Errorf("couldn't decode the window state: %s", err)
+	}
+	return s, nil
+}
+
+// Save writes the window state file, creating its directory
+func (s WindowState) Save(path string) error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("couldn't encode the window state: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("couldn't create the directory: %s", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("couldn't write the file: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package frontend
+
+import (
+	"image"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_FitRect(t *testing.T) {
+	// a 2x window
+	assert.Equal(t, image.Rect(0, 0, 512, 480), FitRect(image.Pt(512, 480), true, AspectSquare))
+	// a wide screen keeps the aspect ratio
+	assert.Equal(t, image.Rect(384, 0, 1536, 1080), FitRect(image.Pt(1920, 1080), false, AspectSquare))
+	// the integer scaling only takes the whole multiples
+	assert.Equal(t, image.Rect(448, 60, 1472, 1020), FitRect(image.Pt(1920, 1080), true, AspectSquare))
+	// smaller than the picture
+	assert.Equal(t, image.Rect(0, 0, 128, 120), FitRect(image.Pt(128, 120), true, AspectSquare))
+
+	// the wide pixels of the CRT
+	assert.Equal(t, image.Rect(0, 0, 585, 480), FitRect(image.Pt(585, 480), true, AspectCRT))
+	assert.Equal(t, image.Rect(302, 0, 1618, 1080), FitRect(image.Pt(1920, 1080), false, AspectCRT))
+	assert.Equal(t, image.Rect(375, 60, 1545, 1020), FitRect(image.Pt(1920, 1080), true, AspectCRT))
+}
+
+func Test_ParsePixelAspect(t *testing.T) {
+	aspect, err := ParsePixelAspect("8:7")
+	assert.NoError(t, err)
+	assert.Equal(t, AspectCRT, aspect)
+	assert.Equal(t, "8:7", aspect.String())
+	_, err = ParsePixelAspect("4:3")
+	assert.Error(t, err)
+	assert.Equal(t, image.Pt(878, 720), WindowSize(3, AspectCRT))
+	assert.Equal(t, image.Pt(768, 720), WindowSize(3, AspectSquare))
+}
+
+func Test_ClampScale(t *testing.T) {
+	assert.Equal(t, 1, ClampScale(0))
+	assert.Equal(t, 3, ClampScale(3))
+	assert.Equal(t, MaxScale, ClampScale(10))
+}
+
+func Test_WindowState_Save(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nestic", "window.yaml")
+	state := WindowState{X: 10, Y: 20, Width: 768, Height: 720, Fullscreen: true}
+	assert.NoError(t, state.Save(path))
+
+	loaded, err := LoadWindowState(path)
+	assert.NoError(t, err)
+	assert.Equal(t, state, loaded)
+}
@@ -0,0 +1,196 @@
+package frontend
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Hotkey is an action of the frontend bound to a key
+type Hotkey int
+
+const (
+	HotkeyFullscreen Hotkey = iota
+	HotkeyScaleUp
+	HotkeyScaleDown
+	HotkeyFastForward // while held
+	HotkeyFastForwardToggle
+	HotkeySlowMotion // cycles through the speeds
+	HotkeyPause
+	HotkeyFrameAdvance // pauses and runs a frame
+	HotkeyScreenshot
+	HotkeyVideoRecording // starts or stops the recording
+	HotkeySaveClip       // saves the last seconds
+	HotkeyQuickOpen      // the menu of the recent ROMs
+	HotkeyShader         // cycles through the shader presets
+	HotkeyPerfOverlay
+	HotkeySaveState // into the selected slot
+	HotkeyLoadState // from the selected slot
+	HotkeyNextStateSlot
+	HotkeyPrevStateSlot
+	HotkeyRewind        // while held
+	HotkeyMovieReadOnly // switches the movie between the playback and the recording
+)
+
+var hotkeyNames = map[Hotkey]string{
+	HotkeyFullscreen: "fullscreen",
+	HotkeyScaleUp:    "scale_up",
+	HotkeyScaleDown:  "scale_down",
+
+	HotkeyFastForward:       "fast_forward",
+	HotkeyFastForwardToggle: "fast_forward_toggle",
+	HotkeySlowMotion:        "slow_motion",
+	HotkeyPause:             "pause",
+	HotkeyFrameAdvance:      "frame_advance",
+	HotkeyScreenshot:        "screenshot",
+	HotkeyVideoRecording:    "video_recording",
+	HotkeySaveClip:          "save_clip",
+	HotkeyQuickOpen:         "quick_open",
+	HotkeyShader:            "shader",
+	HotkeyPerfOverlay:       "perf_overlay",
+	HotkeySaveState:         "save_state",
+	HotkeyLoadState:         "load_state",
+	HotkeyNextStateSlot:     "next_state_slot",
+	HotkeyPrevStateSlot:     "prev_state_slot",
+	HotkeyRewind:            "rewind",
+	HotkeyMovieReadOnly:     "movie_read_only",
+}
+
+func (h Hotkey) String() string {
+	if name, ok := hotkeyNames[h]; ok {
+		return name
+	}
+	return fmt.Sprintf("Hotkey(%d)", int(h))
+}
+
+// ParseHotkey parses the name of the hotkey, e.g. "fullscreen"
+func ParseHotkey(name string) (Hotkey, error) {
+	for h, n := range hotkeyNames {
+		if n == name {
+			return h, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown hotkey %q", name)
+}
+
+// Hotkeys maps the keys to the frontend actions. The keys are named
+// the way the keymap names them. The keys bound to the actions
+// don't reach the console
+type Hotkeys struct {
+	keys map[string]Hotkey
+	held map[Hotkey]bool
+	// the keys passing to the console as if unbound, nil: none
+	passThrough func(key string) bool
+}
+
+// NewHotkeys returns the hotkeys with no keys bound
+func NewHotkeys() *Hotkeys {
+	return &Hotkeys{keys: map[string]Hotkey{}, held: map[Hotkey]bool{}}
+}
+
+// DefaultHotkeys returns the default bindings. They stay off the keys
+// of the default keymap of the controllers, the function keys and
+// a few more are the keys of the Family BASIC keyboard, see SetPassThrough
+func DefaultHotkeys() *Hotkeys {
+	h := NewHotkeys()
+	h.Bind("F11", HotkeyFullscreen)
+	h.Bind("F10", HotkeyScaleUp)
+	h.Bind("F9", HotkeyScaleDown)
+	h.Bind("Tab", HotkeyFastForward)
+	h.Bind("Backquote", HotkeyFastForwardToggle)
+	h.Bind("PageDown", HotkeySlowMotion)
+	h.Bind("Pause", HotkeyPause)
+	h.Bind("PageUp", HotkeyFrameAdvance)
+	h.Bind("F12", HotkeyScreenshot)
+	h.Bind("ScrollLock", HotkeyVideoRecording)
+	h.Bind("F8", HotkeySaveClip)
+	h.Bind("F7", HotkeyQuickOpen)
+	h.Bind("F6", HotkeyShader)
+	h.Bind("F3", HotkeyPerfOverlay)
+	h.Bind("F5", HotkeySaveState)
+	h.Bind("F4", HotkeyLoadState)
+	h.Bind("F2", HotkeyNextStateSlot)
+	h.Bind("F1", HotkeyPrevStateSlot)
+	h.Bind("Backspace", HotkeyRewind)
+	h.Bind("Insert", HotkeyMovieReadOnly)
+	return h
+}
+
+// SetPassThrough sets the keys passing to the console instead of
+// the actions, e.g. Session.KeyboardTakes, nil is none
+func (h *Hotkeys) SetPassThrough(fn func(key string) bool) {
+	h.passThrough = fn
+}
+
+// bound returns the action of the key
+func (h *Hotkeys) bound(key string) (Hotkey, bool) {
+	if h.passThrough != nil && h.passThrough(key) {
+		return 0, false
+	}
+	action, ok := h.keys[key]
+	return action, ok
+}
+
+// Bind binds the key to the action, replacing the previous action of the key
+func (h *Hotkeys) Bind(key string, action Hotkey) {
+	h.keys[key] = action
+}
+
+// Set binds the keys to the action instead of its current keys
+func (h *Hotkeys) Set(action Hotkey, keys []string) {
+	for key, a := range h.keys {
+		if a == action {
+			delete(h.keys, key)
+		}
+	}
+	for _, key := range keys {
+		h.Bind(key, action)
+	}
+}
+
+// Keys returns the keys bound to the action, sorted
+func (h *Hotkeys) Keys(action Hotkey) []string {
+	var keys []string
+	for key, a := range h.keys {
+		if a == action {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Update takes the pressed keys and returns the actions
+// pressed since the last update
+func (h *Hotkeys) Update(pressed []string) []Hotkey {
+	held := make(map[Hotkey]bool, len(h.held))
+	var actions []Hotkey
+	for _, key := range pressed {
+		action, ok := h.bound(key)
+		if !ok || held[action] {
+			continue
+		}
+		held[action] = true
+		if !h.held[action] {
+			actions = append(actions, action)
+		}
+	}
+	h.held = held
+	return actions
+}
+
+// Held reports whether a key of the action was pressed at the last update
+func (h *Hotkeys) Held(action Hotkey) bool {
+	return h.held[action]
+}
+
+// Unbound returns the pressed keys not bound to the actions,
+// the keys left for the console
+func (h *Hotkeys) Unbound(pressed []string) []string {
+	var keys []string
+	for _, key := range pressed {
+		if _, ok := h.bound(key); !ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
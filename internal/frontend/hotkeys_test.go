@@ -0,0 +1,48 @@
+package frontend
+
+import (
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Hotkeys_Update(t *testing.T) {
+	h := DefaultHotkeys()
+	h.Bind("Escape", HotkeyFullscreen)
+
+	assert.Equal(t, []Hotkey{HotkeyFullscreen}, h.Update([]string{"F11", "Escape", "X"}))
+	assert.True(t, h.Held(HotkeyFullscreen))
+	assert.Empty(t, h.Update([]string{"Escape"}), "the held keys don't repeat")
+	assert.Equal(t, []Hotkey{HotkeyScaleUp}, h.Update([]string{"F10"}))
+	assert.False(t, h.Held(HotkeyFullscreen))
+	assert.Equal(t, []string{"Escape", "F11"}, h.Keys(HotkeyFullscreen))
+	assert.Equal(t, []string{"X"}, h.Unbound([]string{"Tab", "X", "F11"}))
+
+	action, err := ParseHotkey("scale_down")
+	assert.NoError(t, err)
+	assert.Equal(t, HotkeyScaleDown, action)
+	assert.Equal(t, "scale_down", action.String())
+}
+
+func Test_Hotkeys_Set(t *testing.T) {
+	h := DefaultHotkeys()
+	h.Set(HotkeyPause, []string{"P", "Pause"})
+	assert.Equal(t, []string{"P", "Pause"}, h.Keys(HotkeyPause))
+	h.Set(HotkeyPause, []string{"O"})
+	assert.Equal(t, []string{"O"}, h.Keys(HotkeyPause))
+	assert.Equal(t, []string{"F11"}, h.Keys(HotkeyFullscreen), "the other hotkeys keep their keys")
+}
+
+func Test_Hotkeys_PassThrough(t *testing.T) {
+	s := NewSession(nestest.NewConsole(t, nestest.NewROM()), "test.nes")
+	h := DefaultHotkeys()
+	h.SetPassThrough(s.KeyboardTakes)
+	assert.Equal(t, []Hotkey{HotkeySaveState}, h.Update([]string{"F5"}), "no keyboard is plugged in")
+
+	s.Console.SetExpansionDevice(nes.NewKeyboard())
+	assert.Equal(t, []Hotkey{HotkeyPause}, h.Update([]string{"F1", "F5", "Tab", "Backquote", "Pause"}))
+	assert.Equal(t, []string{"F1", "F5", "Tab", "Backquote"}, h.Unbound([]string{"F1", "F5", "Tab", "Backquote", "Pause"}),
+		"the keys of the keyboard reach it")
+}
@@ -0,0 +1,60 @@
+package frontend
+
+import "time"
+
+// the sizes the automatic audio buffer takes
+const (
+	MinAutoBuffer  = 20 * time.Millisecond
+	MaxAutoBuffer  = 200 * time.Millisecond
+	autoBufferStep = 10 * time.Millisecond
+)
+
+// autoBufferSettle is how many frames the underruns are ignored for
+// after the sound starts, the buffer is filled up from empty
+const autoBufferSettle = 30
+
+// AutoBuffer picks the smallest audio buffer the sound plays without
+// breaking up on. The latency the audio stacks manage differs a lot
+// between the platforms and the machines, so it starts at the smallest
+// size and grows by a step on every underrun. It never shrinks back,
+// a buffer that broke up once is likely to break up again
+type AutoBuffer struct {
+	size      time.Duration
+	underruns uint64 // the count of the underruns seen last
+	settle    int    // the frames left the underruns are ignored for
+}
+
+// NewAutoBuffer returns the buffer at the smallest size
+func NewAutoBuffer() *AutoBuffer {
+	return &AutoBuffer{size: MinAutoBuffer, settle: autoBufferSettle}
+}
+
+// Size returns the buffer size
+func (b *AutoBuffer) Size() time.Duration {
+	return b.size
+}
+
+// Settle ignores the underruns of the next frames, the sound
+// starts again from the empty buffer, e.g. after a pause, the fast
+// forward without the sound or another game loaded
+func (b *AutoBuffer) Settle() {
+	b.settle = autoBufferSettle
+}
+
+// Update takes the count of the underruns so far after a frame
+// with the sound playing, and reports whether the buffer grew
+func (b *AutoBuffer) Update(underruns uint64) bool {
+	broke := underruns > b.underruns
+	b.underruns = underruns
+	if b.settle > 0 {
+		b.settle--
+		return false
+	}
+	if !broke || b.size >= MaxAutoBuffer {
+		return false
+	}
+	b.size = min(b.size+autoBufferStep, MaxAutoBuffer)
+	// the bigger buffer is filled up first
+	b.settle = autoBufferSettle
+	return true
+}
@@ -0,0 +1,45 @@
+package frontend
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_AutoBuffer(t *testing.T) {
+	b := NewAutoBuffer()
+	assert.Equal(t, MinAutoBuffer, b.Size())
+
+	underruns := uint64(0)
+	for i := 0; i < autoBufferSettle; i++ {
+		underruns++
+		assert.False(t, b.Update(underruns), "the buffer fills up after the start")
+	}
+	assert.False(t, b.Update(underruns), "no new underruns")
+	assert.Equal(t, MinAutoBuffer, b.Size())
+
+	assert.True(t, b.Update(underruns+1))
+	assert.Equal(t, MinAutoBuffer+autoBufferStep, b.Size())
+	assert.False(t, b.Update(underruns+2), "the grown buffer fills up")
+
+	underruns += 2
+	for b.Size() < MaxAutoBuffer {
+		for i := 0; i < autoBufferSettle; i++ {
+			b.Update(underruns)
+		}
+		underruns++
+		assert.True(t, b.Update(underruns))
+	}
+	for i := 0; i < autoBufferSettle; i++ {
+		b.Update(underruns)
+	}
+	assert.False(t, b.Update(underruns+1), "the buffer doesn't grow past the largest size")
+	assert.Equal(t, MaxAutoBuffer, b.Size())
+
+	b = NewAutoBuffer()
+	for i := 0; i < autoBufferSettle; i++ {
+		b.Update(0)
+	}
+	b.Settle()
+	assert.False(t, b.Update(1), "the underruns after the pause are ignored")
+}
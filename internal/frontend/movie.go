@@ -0,0 +1,20 @@
+package frontend
+
+import "github.com/nevisdale/nestic/internal/nes"
+
+// ToggleMovieReadOnly switches the movie of the console between
+// the read-only playback and the recording of the live input
+// from the current frame, see nes.Bus.SetMovieReadOnly
+func (s *Session) ToggleMovieReadOnly() {
+	if _, mode, _ := s.Console.Movie(); mode == nes.MovieOff {
+		s.OSD.Show("No movie")
+		return
+	}
+	readOnly := !s.Console.MovieReadOnly()
+	s.Console.SetMovieReadOnly(readOnly)
+	if readOnly {
+		s.OSD.Show("Movie read-only")
+	} else {
+		s.OSD.Show("Movie recording")
+	}
+}
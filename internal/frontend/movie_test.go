@@ -0,0 +1,31 @@
+package frontend
+
+import (
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Session_ToggleMovieReadOnly(t *testing.T) {
+	console := newCountingConsole(t)
+	s := NewSession(console, "test.nes")
+	s.ToggleMovieReadOnly()
+	_, mode, _ := console.Movie()
+	assert.Equal(t, nes.MovieOff, mode, "no movie")
+
+	m := console.RecordMovie()
+	for i := 0; i < 3; i++ {
+		s.RunFrame(HostInput{})
+	}
+	s.ToggleMovieReadOnly()
+	assert.True(t, console.MovieReadOnly())
+	_, mode, _ = console.Movie()
+	assert.Equal(t, nes.MoviePlaying, mode)
+
+	s.ToggleMovieReadOnly()
+	assert.False(t, console.MovieReadOnly())
+	_, mode, _ = console.Movie()
+	assert.Equal(t, nes.MovieRecording, mode)
+	assert.Len(t, m.Frames, 3)
+}
@@ -0,0 +1,136 @@
+package frontend
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MessageDuration is how long a message stays on the screen
+const MessageDuration = 2 * time.Second
+
+// the font metrics in the picture pixels
+const (
+	glyphWidth  = 6
+	glyphHeight = 13
+	osdMargin   = 4
+)
+
+// osdMessage is a transient message
+type osdMessage struct {
+	text  string
+	until time.Time
+}
+
+// OSD is the layer of the text drawn over the frames: the transient
+// messages at the bottom, e.g. "State 3 saved", and the persistent
+// indicators at the top, e.g. "Fast forward", until they are cleared
+type OSD struct {
+	messages   []osdMessage // the newest last
+	indicators map[string]string
+
+	now func() time.Time
+}
+
+// NewOSD returns the layer with nothing on it
+func NewOSD() *OSD {
+	return &OSD{indicators: map[string]string{}, now: time.Now}
+}
+
+// Show shows the message for MessageDuration
+func (o *OSD) Show(format string, args ...any) {
+	o.messages = append(o.messages, osdMessage{
+		text:  fmt.Sprintf(format, args...),
+		until: o.now().Add(MessageDuration),
+	})
+}
+
+// SetIndicator shows the text of the indicator until it is set again,
+// "" clears it. The indicators are drawn in the order of their names,
+// the text may have several lines
+func (o *OSD) SetIndicator(name, text string) {
+	if text == "" {
+		delete(o.indicators, name)
+		return
+	}
+	o.indicators[name] = text
+}
+
+// Lines returns the lines on the screen now: the indicators, then the messages
+func (o *OSD) Lines() (indicators, messages []string) {
+	now := o.now()
+	n := 0
+	for _, m := range o.messages {
+		if now.Before(m.until) {
+			o.messages[n] = m
+			n++
+		}
+	}
+	o.messages = o.messages[:n]
+
+	names := make([]string, 0, len(o.indicators))
+	for name := range o.indicators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		indicators = append(indicators, strings.Split(o.indicators[name], "\n")...)
+	}
+	for _, m := range o.messages {
+		messages = append(messages, strings.Split(m.text, "\n")...)
+	}
+	return indicators, messages
+}
+
+// Draw draws the lines over the picture: the indicators from the top,
+// the messages up from the bottom
+func (o *OSD) Draw(dst *image.RGBA) {
+	indicators, messages := o.Lines()
+	bounds := dst.Bounds()
+	for i, line := range indicators {
+		DrawText(dst, line, bounds.Min.X+osdMargin, bounds.Min.Y+osdMargin+i*glyphHeight)
+	}
+	top := bounds.Max.Y - osdMargin - len(messages)*glyphHeight
+	for i, line := range messages {
+		DrawText(dst, line, bounds.Min.X+osdMargin, top+i*glyphHeight)
+	}
+}
+
+// drawText draws the white line on the darkened box at x, y.
+// The characters out of the font are drawn as ?
+func DrawText(dst *image.RGBA, text string, x, y int) {
+	runes := []rune(text)
+	box := image.Rect(x-1, y, x+len(runes)*glyphWidth+1, y+glyphHeight).Intersect(dst.Bounds())
+	darken(dst, box)
+	for n, r := range runes {
+		if r < ' ' || r > '~' {
+			r = '?'
+		}
+		glyph := &osdFont[r-' ']
+		for row, bits := range glyph {
+			for col := 0; col < glyphWidth; col++ {
+				p := image.Pt(x+n*glyphWidth+col, y+row)
+				if bits&(1<<(glyphWidth-1-col)) == 0 || !p.In(box) {
+					continue
+				}
+				i := dst.PixOffset(p.X, p.Y)
+				dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2] = 0xFF, 0xFF, 0xFF
+			}
+		}
+	}
+}
+
+// darken darkens the box of the picture, the text over it stands out
+func darken(dst *image.RGBA, box image.Rectangle) {
+	box = box.Intersect(dst.Bounds())
+	for py := box.Min.Y; py < box.Max.Y; py++ {
+		for px := box.Min.X; px < box.Max.X; px++ {
+			i := dst.PixOffset(px, py)
+			for c := 0; c < 3; c++ {
+				dst.Pix[i+c] /= 3
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package frontend
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_OSD_Lines(t *testing.T) {
+	now := time.Unix(0, 0)
+	o := NewOSD()
+	o.now = func() time.Time { return now }
+
+	o.SetIndicator("pause", "Paused")
+	o.SetIndicator("fast_forward", "Fast forward")
+	o.Show("State %d saved", 3)
+	now = now.Add(time.Second)
+	o.Show("Rewinding\nback")
+
+	indicators, messages := o.Lines()
+	assert.Equal(t, []string{"Fast forward", "Paused"}, indicators)
+	assert.Equal(t, []string{"State 3 saved", "Rewinding", "back"}, messages)
+
+	// the first message expires, the cleared indicator goes
+	now = now.Add(MessageDuration - time.Second)
+	o.SetIndicator("pause", "")
+	indicators, messages = o.Lines()
+	assert.Equal(t, []string{"Fast forward"}, indicators)
+	assert.Equal(t, []string{"Rewinding", "back"}, messages)
+
+	now = now.Add(time.Second)
+	_, messages = o.Lines()
+	assert.Empty(t, messages)
+}
+
+func Test_OSD_Draw(t *testing.T) {
+	o := NewOSD()
+	frame := image.NewRGBA(image.Rect(0, 0, nes.FrameWidth, nes.FrameHeight))
+	for i := range frame.Pix {
+		frame.Pix[i] = 0x90
+	}
+	empty := append([]byte(nil), frame.Pix...)
+	o.Draw(frame)
+	assert.Equal(t, empty, frame.Pix, "nothing to draw")
+
+	o.SetIndicator("pause", "Paused")
+	o.Show("é")
+	o.Draw(frame)
+	// the indicator has white pixels at the top, the message at the bottom
+	hasWhite := func(r image.Rectangle) bool {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if frame.RGBAAt(x, y).R == 0xFF {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	assert.True(t, hasWhite(image.Rect(0, 0, nes.FrameWidth, osdMargin+glyphHeight)))
+	assert.True(t, hasWhite(image.Rect(0, nes.FrameHeight-osdMargin-glyphHeight, nes.FrameWidth, nes.FrameHeight)))
+	assert.False(t, hasWhite(image.Rect(0, 2*glyphHeight, nes.FrameWidth, nes.FrameHeight-2*glyphHeight)))
+	// the box darkens the frame under the text
+	assert.Equal(t, uint8(0x30), frame.RGBAAt(osdMargin-1, osdMargin).R)
+}
+
+func Test_Session_Display(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := NewSession(console, "test.nes")
+	s.RunFrame(HostInput{})
+	s.OSD.Show("Hello")
+	frame := append([]byte(nil), s.Frame().Pix...)
+
+	display := s.Display()
+	assert.NotEqual(t, frame, display.Pix)
+	// the frame itself stays clean for the captures
+	assert.Equal(t, frame, s.Frame().Pix)
+}
@@ -0,0 +1,108 @@
+package frontend
+
+import (
+	"fmt"
+	"time"
+)
+
+// FramePacing is what paces the frames of the console
+type FramePacing int
+
+const (
+	// FramePacingVsync runs a frame per display refresh. It is the smoothest
+	// on a 60 Hz display, the audio rate control absorbs the difference
+	FramePacingVsync FramePacing = iota
+	// FramePacingAudio runs the frames as the audio device consumes the samples
+	FramePacingAudio
+	// FramePacingClock runs the frames at the console frame rate by the clock
+	FramePacingClock
+)
+
+var framePacingNames = []string{"vsync", "audio", "clock"}
+
+func (m FramePacing) String() string {
+	if int(m) < len(framePacingNames) {
+		return framePacingNames[m]
+	}
+	return fmt.Sprintf("FramePacing(%d)", int(m))
+}
+
+// ParseFramePacing parses the name of the frame pacing: vsync, audio or clock
+func ParseFramePacing(name string) (FramePacing, error) {
+	for i, n := range framePacingNames {
+		if n == name {
+			return FramePacing(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid frame pacing %q", name)
+}
+
+// spinTime is the end of the wait spun instead of slept,
+// the OS sleep often oversleeps by a millisecond or more
+const spinTime = 2 * time.Millisecond
+
+// maxLag is how many frames the limiter catches up after a stall,
+// a longer stall drops the frames
+const maxLag = 3
+
+// Limiter paces the frames at the console frame rate by the clock.
+// The deadlines are kept on the exact period, so the rate doesn't drift
+// the way a 60 Hz ticker does against the 60.0988 Hz of the console
+type Limiter struct {
+	period time.Duration
+	next   time.Time
+	now    func() time.Time
+}
+
+// NewLimiter returns the limiter for the frame period,
+// the first frame is due immediately
+func NewLimiter(period time.Duration) *Limiter {
+	l := &Limiter{period: period, now: time.Now}
+	l.Reset()
+	return l
+}
+
+// Reset makes the next frame due immediately, e.g. after a pause
+func (l *Limiter) Reset() {
+	l.next = l.now()
+}
+
+// Period returns the frame period
+func (l *Limiter) Period() time.Duration {
+	return l.period
+}
+
+// SetPeriod changes the frame period from the next frame
+func (l *Limiter) SetPeriod(period time.Duration) {
+	l.period = period
+}
+
+// Wait blocks until the next frame is due
+func (l *Limiter) Wait() {
+	if wait := l.next.Sub(l.now()); wait > spinTime {
+		time.Sleep(wait - spinTime)
+	}
+	for l.now().Before(l.next) {
+	}
+	l.advance(1)
+}
+
+// Due returns how many frames are due by now and moves past them,
+// for the frontends called back at their own rate
+func (l *Limiter) Due() int {
+	now := l.now()
+	if now.Before(l.next) {
+		return 0
+	}
+	n := int(now.Sub(l.next)/l.period) + 1
+	l.advance(n)
+	return min(n, maxLag)
+}
+
+// advance moves the deadline by the frames, skipping the missed ones
+func (l *Limiter) advance(frames int) {
+	l.next = l.next.Add(l.period * time.Duration(frames))
+	if l.now().Sub(l.next) > l.period*maxLag {
+		l.next = l.now()
+	}
+}
@@ -0,0 +1,53 @@
+package frontend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Limiter_Due(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewLimiter(10 * time.Millisecond)
+	l.now = func() time.Time { return now }
+	l.Reset()
+
+	assert.Equal(t, 1, l.Due(), "the first frame is due immediately")
+	assert.Equal(t, 0, l.Due())
+	now = now.Add(9 * time.Millisecond)
+	assert.Equal(t, 0, l.Due())
+	now = now.Add(time.Millisecond)
+	assert.Equal(t, 1, l.Due())
+
+	// the deadlines stay on the period
+	now = now.Add(25 * time.Millisecond)
+	assert.Equal(t, 2, l.Due())
+	now = now.Add(5 * time.Millisecond)
+	assert.Equal(t, 1, l.Due())
+
+	// a long stall doesn't run all the missed frames
+	now = now.Add(time.Second)
+	assert.Equal(t, maxLag, l.Due())
+	assert.Equal(t, 0, l.Due())
+}
+
+func Test_Limiter_Wait(t *testing.T) {
+	l := NewLimiter(5 * time.Millisecond)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		l.Wait()
+	}
+	// the first frame is due immediately
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+}
+
+func Test_ParseFramePacing(t *testing.T) {
+	mode, err := ParseFramePacing("clock")
+	assert.NoError(t, err)
+	assert.Equal(t, FramePacingClock, mode)
+	assert.Equal(t, "clock", mode.String())
+
+	_, err = ParseFramePacing("video")
+	assert.Error(t, err)
+}
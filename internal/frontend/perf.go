@@ -0,0 +1,92 @@
+package frontend
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// perfInterval is how often the performance overlay is updated
+const perfInterval = 500 * time.Millisecond
+
+// perfStats are the measurements of the performance overlay
+// since its last update
+type perfStats struct {
+	start    time.Time
+	emulated int // the real frames, the frames run ahead count in their time
+	shown    int
+	frames   time.Duration // the time of the emulated frames
+	render   time.Duration
+	profile  nes.Profile
+
+	now func() time.Time
+}
+
+// SetPerfOverlay shows or hides the performance overlay: the emulated and
+// the shown frames per second, the time of a frame in the chips and in
+// the frontend, the sound waiting in the audio buffer and the past
+// the rewind keeps
+func (s *Session) SetPerfOverlay(on bool) {
+	s.perf = nil
+	s.Console.SetProfiling(on)
+	if !on {
+		s.OSD.SetIndicator("perf", "")
+		return
+	}
+	s.perf = &perfStats{now: time.Now}
+	s.perf.start = s.perf.now()
+	s.OSD.SetIndicator("perf", "FPS ...")
+}
+
+// PerfOverlay reports whether the performance overlay is shown
+func (s *Session) PerfOverlay() bool {
+	return s.perf != nil
+}
+
+// FrameShown counts the frame the frontend showed,
+// the render is the time it took to draw it
+func (s *Session) FrameShown(render time.Duration) {
+	p := s.perf
+	if p == nil {
+		return
+	}
+	p.shown++
+	p.render += render
+	elapsed := p.now().Sub(p.start)
+	if elapsed < perfInterval {
+		return
+	}
+
+	p.profile = s.Console.ReadProfile()
+	apu := s.Console.APU()
+	buffered := time.Duration(apu.BufferedSamples()) * time.Second / time.Duration(apu.SampleRate())
+	text := p.text(elapsed, buffered)
+	if r := s.rewind; r != nil {
+		text += fmt.Sprintf("\nRewind %.1fs %.1fMB", r.Duration(s.Console.Region().FrameRate()).Seconds(), float64(r.Size())/(1<<20))
+	}
+	s.OSD.SetIndicator("perf", text)
+	*p = perfStats{start: p.now(), now: p.now}
+}
+
+// text returns the lines of the overlay
+func (p *perfStats) text(elapsed, buffered time.Duration) string {
+	perFrame := func(d time.Duration) float64 {
+		if p.emulated == 0 {
+			return 0
+		}
+		return float64(d) / float64(p.emulated) / float64(time.Millisecond)
+	}
+	ms := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "FPS %.1f emulated, %.1f shown\n",
+		float64(p.emulated)/elapsed.Seconds(), float64(p.shown)/elapsed.Seconds())
+	fmt.Fprintf(&b, "Frame %.2fms CPU %.2f PPU %.2f APU %.2f\n",
+		perFrame(p.frames), perFrame(p.profile.CPU), perFrame(p.profile.PPU), perFrame(p.profile.APU))
+	fmt.Fprintf(&b, "Render %.2fms\n", ms(p.render)/float64(p.shown))
+	fmt.Fprintf(&b, "Audio buffer %.0fms", ms(buffered))
+	return b.String()
+}
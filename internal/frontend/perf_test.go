@@ -0,0 +1,41 @@
+package frontend
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Session_SetPerfOverlay(t *testing.T) {
+	s := NewSession(nestest.NewConsole(t, nestest.NewROM()), "test.nes")
+	s.FrameShown(time.Millisecond)
+	assert.False(t, s.PerfOverlay())
+
+	s.SetPerfOverlay(true)
+	now := time.Unix(0, 0)
+	s.perf.now = func() time.Time { return now }
+	s.perf.start = now
+	for i := 0; i < 4; i++ {
+		s.RunFrame(HostInput{})
+		s.FrameShown(2 * time.Millisecond)
+		now = now.Add(perfInterval / 4)
+	}
+	s.RunFrame(HostInput{})
+	s.FrameShown(2 * time.Millisecond)
+
+	text := s.OSD.indicators["perf"]
+	lines := strings.Split(text, "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, "FPS 10.0 emulated, 10.0 shown", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "Frame 0.00ms CPU "), lines[1])
+	assert.Equal(t, "Render 2.00ms", lines[2])
+	assert.True(t, strings.HasPrefix(lines[3], "Audio buffer "), lines[3])
+	assert.Equal(t, 0, s.perf.shown, "the measurements start over")
+
+	s.SetPerfOverlay(false)
+	assert.False(t, s.PerfOverlay())
+	assert.NotContains(t, s.OSD.indicators, "perf")
+}
@@ -0,0 +1,161 @@
+package frontend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MaxRecentROMs is how many recently opened ROMs are remembered,
+// the quick-open picks them by the digit keys
+const MaxRecentROMs = 9
+
+// RecentROMs are the recently opened ROMs, the last one first
+type RecentROMs struct {
+	Paths []string `yaml:"roms"`
+}
+
+// RecentROMsPath returns the path of the recent ROMs file
+// in the user config directory
+func RecentROMsPath() (string, error) {
+	dir, err := configDir("")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "recent.yaml"), nil
+}
+
+// LoadRecentROMs reads the recent ROMs file
+func LoadRecentROMs(path string) (*RecentROMs, error) {
+	r := &RecentROMs{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return r, fmt.Errorf("couldn't read the file: %s", err)
+	}
+	if err := yaml.Unmarshal(data, r); err != nil {
+		return &RecentROMs{}, fmt.Errorf("couldn't decode the recent ROMs: %s", err)
+	}
+	return r, nil
+}
+
+// Save writes the recent ROMs file, creating its directory
+func (r *RecentROMs) Save(path string) error {
+	data, err := yaml.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("couldn't encode the recent ROMs: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("couldn't create the directory: %s", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("couldn't write the file: %s", err)
+	}
+	return nil
+}
+
+// Add puts the opened ROM first, the oldest ROMs over MaxRecentROMs
+// are forgotten
+func (r *RecentROMs) Add(path string) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	r.Paths = slices.DeleteFunc(r.Paths, func(p string) bool { return p == path })
+	r.Paths = slices.Insert(r.Paths, 0, path)
+	if len(r.Paths) > MaxRecentROMs {
+		r.Paths = r.Paths[:MaxRecentROMs]
+	}
+}
+
+// Get returns the ROM by its number from 1, the last opened ROM
+func (r *RecentROMs) Get(n int) (string, error) {
+	if n < 1 || n > len(r.Paths) {
+		return "", fmt.Errorf("no recent ROM %d", n)
+	}
+	return r.Paths[n-1], nil
+}
+
+// Resolve returns the ROM to open: the path, or the recent ROM n,
+// or without both the last opened ROM
+func (r *RecentROMs) Resolve(path string, n int) (string, error) {
+	switch {
+	case path != "":
+		return path, nil
+	case n > 0:
+		return r.Get(n)
+	case len(r.Paths) == 0:
+		return "", fmt.Errorf("no ROM is given and none was opened before")
+	}
+	return r.Paths[0], nil
+}
+
+// Lines returns the numbered ROM names for the quick-open menu
+func (r *RecentROMs) Lines() []string {
+	lines := make([]string, len(r.Paths))
+	for i, path := range r.Paths {
+		lines[i] = strconv.Itoa(i+1) + ": " + filepath.Base(path)
+	}
+	return lines
+}
+
+// QuickOpen is the menu of the recent ROMs: while it is open the digit
+// keys pick a ROM and Escape closes it, the keys don't reach the console
+type QuickOpen struct {
+	Recent *RecentROMs
+	open   bool
+}
+
+// Toggle opens or closes the menu
+func (q *QuickOpen) Toggle() {
+	q.open = !q.open && len(q.Recent.Paths) > 0
+}
+
+// Active reports whether the menu is open
+func (q *QuickOpen) Active() bool {
+	return q.open
+}
+
+// Menu returns the text of the open menu for the OSD, "" while it is closed
+func (q *QuickOpen) Menu() string {
+	if !q.open {
+		return ""
+	}
+	return "Open the ROM, Escape to close:\n" + strings.Join(q.Recent.Lines(), "\n")
+}
+
+// Update takes the pressed keys while the menu is open and returns
+// the picked ROM, "" while none is picked. The menu closes on the pick
+func (q *QuickOpen) Update(pressed []string) string {
+	for _, key := range pressed {
+		if key == "Escape" {
+			q.open = false
+			return ""
+		}
+		digit, ok := digitKey(key)
+		if !ok {
+			continue
+		}
+		if path, err := q.Recent.Get(digit); err == nil {
+			q.open = false
+			return path
+		}
+	}
+	return ""
+}
+
+// digitKey returns the digit of the key of the top row or the keypad,
+// e.g. Digit3 or Numpad3
+func digitKey(key string) (int, bool) {
+	for _, prefix := range []string{"Digit", "Numpad"} {
+		if len(key) == len(prefix)+1 && key[:len(prefix)] == prefix {
+			if d := key[len(prefix)]; d >= '0' && d <= '9' {
+				return int(d - '0'), true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,61 @@
+package frontend
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_RecentROMs(t *testing.T) {
+	dir := t.TempDir()
+	r := &RecentROMs{}
+	_, err := r.Resolve("", 0)
+	assert.Error(t, err, "nothing to open")
+
+	for i := 0; i < MaxRecentROMs+2; i++ {
+		r.Add(filepath.Join(dir, fmt.Sprintf("game%d.nes", i)))
+	}
+	r.Add(filepath.Join(dir, "game5.nes"))
+	assert.Len(t, r.Paths, MaxRecentROMs)
+	assert.Equal(t, filepath.Join(dir, "game5.nes"), r.Paths[0], "the opened ROM goes first")
+	assert.Equal(t, filepath.Join(dir, "game10.nes"), r.Paths[1])
+	assert.Equal(t, "1: game5.nes", r.Lines()[0])
+
+	path, err := r.Resolve("", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, r.Paths[0], path)
+	path, err = r.Resolve("", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, r.Paths[1], path)
+	path, err = r.Resolve("other.nes", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "other.nes", path)
+	_, err = r.Resolve("", MaxRecentROMs+1)
+	assert.Error(t, err)
+
+	file := filepath.Join(dir, "recent.yaml")
+	assert.NoError(t, r.Save(file))
+	loaded, err := LoadRecentROMs(file)
+	assert.NoError(t, err)
+	assert.Equal(t, r, loaded)
+}
+
+func Test_QuickOpen(t *testing.T) {
+	q := &QuickOpen{Recent: &RecentROMs{}}
+	q.Toggle()
+	assert.False(t, q.Active(), "no ROMs to open")
+
+	q.Recent.Paths = []string{"/a.nes", "/b.nes"}
+	q.Toggle()
+	assert.True(t, q.Active())
+	assert.Equal(t, "", q.Update([]string{"X", "Digit3"}), "no ROM 3")
+	assert.True(t, q.Active())
+	assert.Equal(t, "/b.nes", q.Update([]string{"Numpad2"}))
+	assert.False(t, q.Active())
+
+	q.Toggle()
+	assert.Equal(t, "", q.Update([]string{"Escape", "Digit1"}))
+	assert.False(t, q.Active())
+}
@@ -0,0 +1,189 @@
+package frontend
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// RewindOptions are how much of the past the rewind keeps
+type RewindOptions struct {
+	Interval int           // the frames between the captured states, 0: 2
+	Duration time.Duration // the longest past kept, 0: the rewind is off
+	Budget   int           // the most bytes the captured states take, 0: no limit
+}
+
+// RewindBuffer keeps the states of the console captured every few frames.
+// The newest state is kept whole, every older one as the compressed
+// difference to the state after it, so the oldest states are dropped
+// without touching the rest. Going back pops the newest difference
+type RewindBuffer struct {
+	opts      RewindOptions
+	maxStates int
+
+	latest []uint8   // the newest state
+	deltas [][]uint8 // oldest first, deltas[i] XORed with the state i+1 is the state i
+	size   int       // the bytes of the deltas
+	since  int       // the frames run since the newest state
+
+	state bytes.Buffer
+	diff  []uint8
+	zw    *flate.Writer
+	zbuf  bytes.Buffer
+}
+
+// NewRewindBuffer returns the buffer of the states of the console
+// running at the frame rate
+func NewRewindBuffer(opts RewindOptions, frameRate float64) *RewindBuffer {
+	if opts.Interval <= 0 {
+		opts.Interval = 2
+	}
+	zw, _ := flate.NewWriter(nil, flate.BestSpeed)
+	return &RewindBuffer{
+		opts:      opts,
+		maxStates: max(int(opts.Duration.Seconds()*frameRate)/opts.Interval, 1),
+		zw:        zw,
+	}
+}
+
+// Capture is called after every frame, every Interval frames
+// it keeps the state of the console
+func (r *RewindBuffer) Capture(console *nes.Bus) error {
+	r.since++
+	if r.latest != nil && r.since < r.opts.Interval {
+		return nil
+	}
+	r.since = 0
+	r.state.Reset()
+	if err := console.SaveState(&r.state); err != nil {
+		return err
+	}
+	state := r.state.Bytes()
+	if len(state) != len(r.latest) {
+		// the state of another game or of another size has nothing to go back to
+		r.Clear()
+		r.latest = bytes.Clone(state)
+		return nil
+	}
+
+	r.diff = xorBytes(r.diff[:0], state, r.latest)
+	r.zbuf.Reset()
+	r.zw.Reset(&r.zbuf)
+	r.zw.Write(r.diff)
+	if err := r.zw.Close(); err != nil {
+		return fmt.Errorf("couldn't compress the state: %s", err)
+	}
+	r.deltas = append(r.deltas, bytes.Clone(r.zbuf.Bytes()))
+	r.size += r.zbuf.Len()
+	copy(r.latest, state)
+
+	drop := 0
+	for len(r.deltas)-drop > r.maxStates || r.opts.Budget > 0 && r.size+len(r.latest) > r.opts.Budget && drop < len(r.deltas) {
+		r.size -= len(r.deltas[drop])
+		r.deltas[drop] = nil
+		drop++
+	}
+	r.deltas = r.deltas[drop:]
+	return nil
+}
+
+// Back loads the state before the current one into the console, the frames
+// run since the newest state go back to it first. It reports false
+// when there is nothing older to go back to
+func (r *RewindBuffer) Back(console *nes.Bus) (bool, error) {
+	if r.latest == nil {
+		return false, nil
+	}
+	if r.since == 0 {
+		if len(r.deltas) == 0 {
+			return false, nil
+		}
+		last := len(r.deltas) - 1
+		delta := r.deltas[last]
+		diff, err := io.ReadAll(flate.NewReader(bytes.NewReader(delta)))
+		if err != nil || len(diff) != len(r.latest) {
+			r.Clear()
+			return false, fmt.Errorf("couldn't decompress the state: %v", err)
+		}
+		xorBytes(r.latest[:0], r.latest, diff)
+		r.deltas[last] = nil
+		r.deltas = r.deltas[:last]
+		r.size -= len(delta)
+	}
+	r.since = 0
+	if err := console.LoadState(bytes.NewReader(r.latest)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Clear drops the kept states
+func (r *RewindBuffer) Clear() {
+	r.latest, r.deltas, r.size, r.since = nil, nil, 0, 0
+}
+
+// Duration returns how far back the kept states go
+func (r *RewindBuffer) Duration(frameRate float64) time.Duration {
+	frames := len(r.deltas)*r.opts.Interval + r.since
+	return time.Duration(float64(frames) / frameRate * float64(time.Second))
+}
+
+// Size returns the bytes the kept states take
+func (r *RewindBuffer) Size() int {
+	return r.size + len(r.latest)
+}
+
+// xorBytes appends a XOR b to dst, a and b are of the same length
+func xorBytes(dst, a, b []uint8) []uint8 {
+	for i := range a {
+		dst = append(dst, a[i]^b[i])
+	}
+	return dst
+}
+
+// SetRewind keeps the past of the console for Rewind,
+// the zero duration turns the rewind off
+func (s *Session) SetRewind(opts RewindOptions) {
+	s.rewind = nil
+	if opts.Duration > 0 {
+		s.rewind = NewRewindBuffer(opts, s.Console.Region().FrameRate())
+	}
+}
+
+// RewindEnabled reports whether the past of the console is kept
+func (s *Session) RewindEnabled() bool {
+	return s.rewind != nil
+}
+
+// Rewind goes a captured state back and shows its frame, the frontends
+// call it instead of RunFrame while the rewind hotkey is held. It reports
+// false when the oldest kept state is reached
+func (s *Session) Rewind() bool {
+	if s.rewind == nil {
+		return false
+	}
+	ok, err := s.rewind.Back(s.Console)
+	if err != nil {
+		s.OSD.Show("Couldn't rewind: %s", err)
+	}
+	if ok {
+		copy(s.frame.Pix, s.Console.PPU().Frame().Pix)
+		s.fastDebt, s.slowDebt = 0, 0
+	}
+	return ok
+}
+
+// captureRewind keeps the state of the frame for the rewind
+func (s *Session) captureRewind() {
+	if s.rewind == nil {
+		return
+	}
+	if err := s.rewind.Capture(s.Console); err != nil {
+		s.OSD.Show("Rewind is off: %s", err)
+		s.rewind = nil
+	}
+}
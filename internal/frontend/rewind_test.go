@@ -0,0 +1,63 @@
+package frontend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Session_Rewind(t *testing.T) {
+	console := newCountingConsole(t)
+	s := NewSession(console, "test.nes")
+	assert.False(t, s.Rewind(), "the rewind is off")
+
+	s.SetRewind(RewindOptions{Interval: 2, Duration: time.Minute})
+	var counts []uint8
+	for i := 0; i < 10; i++ {
+		s.RunFrame(HostInput{})
+		counts = append(counts, console.RAM().Read8(0x11))
+	}
+	assert.Equal(t, 9*time.Second/60, s.rewind.Duration(60))
+
+	// the frames 1, 3, 5, 7 and 9 are kept, the frame 10 goes back to 9 first
+	for _, frame := range []int{9, 7, 5, 3, 1} {
+		assert.True(t, s.Rewind())
+		assert.Equal(t, counts[frame-1], console.RAM().Read8(0x11), "frame %d", frame)
+		assert.Equal(t, console.PPU().Frame().Pix, s.Frame().Pix)
+	}
+	assert.False(t, s.Rewind(), "the oldest state is reached")
+	assert.Equal(t, counts[0], console.RAM().Read8(0x11))
+
+	// the console runs on from the state it went back to
+	s.RunFrame(HostInput{})
+	s.RunFrame(HostInput{})
+	s.RunFrame(HostInput{})
+	assert.Equal(t, counts[3], console.RAM().Read8(0x11))
+	assert.True(t, s.Rewind())
+	assert.Equal(t, counts[2], console.RAM().Read8(0x11))
+	assert.True(t, s.Rewind())
+	assert.Equal(t, counts[0], console.RAM().Read8(0x11))
+}
+
+func Test_RewindBuffer_Limits(t *testing.T) {
+	console := newCountingConsole(t)
+	r := NewRewindBuffer(RewindOptions{Interval: 1, Duration: time.Second}, 10)
+	for i := 0; i < 30; i++ {
+		console.RunFrame()
+		assert.NoError(t, r.Capture(console))
+	}
+	assert.Equal(t, time.Second, r.Duration(10), "the past is cut to the duration")
+
+	r = NewRewindBuffer(RewindOptions{Interval: 1, Duration: time.Hour}, 60)
+	console.RunFrame()
+	assert.NoError(t, r.Capture(console))
+	budget := r.Size() + 1
+	r.opts.Budget = budget
+	for i := 0; i < 30; i++ {
+		console.RunFrame()
+		assert.NoError(t, r.Capture(console))
+		assert.LessOrEqual(t, r.Size(), budget)
+	}
+	assert.Zero(t, r.Duration(60), "the budget fits only the newest state")
+}
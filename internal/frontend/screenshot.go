@@ -0,0 +1,98 @@
+package frontend
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ScreenshotOptions are how the screenshots are taken
+type ScreenshotOptions struct {
+	Dir   string // "": DefaultScreenshotDir
+	Scale int    // the whole multiple the picture is scaled by, 0: 1
+	Raw   bool   // the picture without the video filter
+}
+
+// DefaultScreenshotDir returns the screenshots directory
+// in the user config directory
+func DefaultScreenshotDir() (string, error) {
+	return configDir("screenshots")
+}
+
+// configDir returns the directory in the nestic directory
+// of the user config directory
+func configDir(name string) (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("couldn't find the config directory: %s", err)
+	}
+	return filepath.Join(dir, "nestic", name), nil
+}
+
+// ScreenshotName returns the file name of the screenshot of the game
+// taken at the time: the ROM name without the extension and the time
+func ScreenshotName(game string, t time.Time) string {
+	return captureName(game, t, ".png")
+}
+
+// captureName returns the file name of the capture of the game
+// with the extension
+func captureName(game string, t time.Time, ext string) string {
+	name := strings.TrimSuffix(filepath.Base(game), filepath.Ext(game))
+	return fmt.Sprintf("%s-%s%s", name, t.Format("20060102-150405.000"), ext)
+}
+
+// SaveScreenshot saves the last frame as a PNG file into the screenshots
+// directory and returns its path
+func (s *Session) SaveScreenshot(opts ScreenshotOptions) (string, error) {
+	dir := opts.Dir
+	if dir == "" {
+		var err error
+		if dir, err = DefaultScreenshotDir(); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("couldn't create the directory: %s", err)
+	}
+
+	frame := s.frame
+	if opts.Raw {
+		frame = s.Console.PPU().RawFrame()
+	}
+	path := filepath.Join(dir, ScreenshotName(s.Game, time.Now()))
+	file, err := os.Create(path)
+	if err != nil {
+		return "", fmt.Errorf("couldn't create the file: %s", err)
+	}
+	if err := png.Encode(file, scaleImage(frame, max(opts.Scale, 1))); err != nil {
+		file.Close()
+		return "", fmt.Errorf("couldn't encode the image: %s", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("couldn't write the file: %s", err)
+	}
+	s.OSD.Show("Screenshot saved")
+	return path, nil
+}
+
+// scaleImage scales the image by the whole multiple, the pixels stay sharp
+func scaleImage(img *image.RGBA, scale int) *image.RGBA {
+	if scale == 1 {
+		return img
+	}
+	size := img.Bounds().Size()
+	dst := image.NewRGBA(image.Rect(0, 0, size.X*scale, size.Y*scale))
+	for y := 0; y < size.Y*scale; y++ {
+		src := img.Pix[y/scale*img.Stride:]
+		row := dst.Pix[y*dst.Stride:]
+		for x := 0; x < size.X*scale; x++ {
+			copy(row[x*4:x*4+4], src[x/scale*4:])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,38 @@
+package frontend
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ScreenshotName(t *testing.T) {
+	at := time.Date(2024, 5, 6, 7, 8, 9, 123e6, time.UTC)
+	assert.Equal(t, "smb-20240506-070809.123.png", ScreenshotName("roms/smb.nes", at))
+}
+
+func Test_Session_SaveScreenshot(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := NewSession(console, "test.nes")
+	s.RunFrame(HostInput{})
+
+	dir := filepath.Join(t.TempDir(), "shots")
+	path, err := s.SaveScreenshot(ScreenshotOptions{Dir: dir, Scale: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, dir, filepath.Dir(path))
+
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer file.Close()
+	img, err := png.Decode(file)
+	assert.NoError(t, err)
+	assert.Equal(t, nes.FrameWidth*2, img.Bounds().Dx())
+	assert.Equal(t, nes.FrameHeight*2, img.Bounds().Dy())
+	assert.Equal(t, s.Frame().At(10, 20), img.At(21, 41))
+}
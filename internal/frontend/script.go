@@ -0,0 +1,38 @@
+package frontend
+
+import (
+	"image"
+	"log"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// Script runs along the console, e.g. the Lua script. The session
+// calls it around every frame it runs
+type Script interface {
+	// BeforeFrame is called before the input of the frame is set
+	BeforeFrame() error
+	// Input changes the buttons of the frame the session set
+	Input(buttons *[4]nes.Button)
+	// AfterFrame is called after the frame is completed
+	AfterFrame() error
+	// Draw draws the overlay over the displayed frame
+	Draw(dst *image.RGBA)
+	Close()
+}
+
+// SetScript sets the script run along the console, nil removes it.
+// The previous script is closed
+func (s *Session) SetScript(script Script) {
+	if s.script != nil {
+		s.script.Close()
+	}
+	s.script = script
+}
+
+// scriptFailed stops the script which failed, the game goes on without it
+func (s *Session) scriptFailed(err error) {
+	log.Printf("the script failed: %s\n", err)
+	s.OSD.Show("The script failed")
+	s.SetScript(nil)
+}
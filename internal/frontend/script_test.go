@@ -0,0 +1,62 @@
+package frontend
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+)
+
+type testScript struct {
+	calls  []string
+	err    error
+	closed bool
+}
+
+func (s *testScript) BeforeFrame() error {
+	s.calls = append(s.calls, "before")
+	return nil
+}
+
+func (s *testScript) Input(buttons *[4]nes.Button) {
+	s.calls = append(s.calls, "input")
+	buttons[1] |= nes.ButtonB
+}
+
+func (s *testScript) AfterFrame() error {
+	s.calls = append(s.calls, "after")
+	return s.err
+}
+
+func (s *testScript) Draw(dst *image.RGBA) {
+	dst.SetRGBA(0, 0, color.RGBA{0xFF, 0, 0, 0xFF})
+}
+
+func (s *testScript) Close() {
+	s.closed = true
+}
+
+func Test_Session_Script(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := NewSession(console, "test.nes")
+	script := &testScript{}
+	s.SetScript(script)
+
+	s.RunFrame(HostInput{Keys: []string{"X"}})
+	assert.Equal(t, []string{"before", "input", "after"}, script.calls)
+	assert.Equal(t, [4]nes.Button{nes.ButtonA, nes.ButtonB}, console.InputView().Buttons)
+	assert.Equal(t, color.RGBA{0xFF, 0, 0, 0xFF}, s.Display().RGBAAt(0, 0), "the overlay is drawn")
+	assert.NotEqual(t, color.RGBA{0xFF, 0, 0, 0xFF}, s.Frame().RGBAAt(0, 0))
+
+	script.err = errors.New("attempt to call a nil value")
+	s.RunFrame(HostInput{})
+	assert.True(t, script.closed, "the failed script is stopped")
+	_, messages := s.OSD.Lines()
+	assert.Equal(t, []string{"The script failed"}, messages)
+	s.RunFrame(HostInput{})
+	assert.Len(t, script.calls, 6)
+}
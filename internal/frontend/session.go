@@ -0,0 +1,396 @@
+// Package frontend holds what the window frontends share: it turns
+// the state of the host input devices into the console input
+// and runs the console frame by frame. A frontend only reads its
+// devices and shows the frames.
+package frontend
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/cheats"
+	"github.com/nevisdale/nestic/internal/debugger"
+	"github.com/nevisdale/nestic/internal/input"
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// HostInput is the state of the host input devices
+type HostInput struct {
+	Keys      []string // the pressed keys, named the way the keymap names them
+	Pads      []input.Pad
+	MouseX    int
+	MouseLeft bool
+}
+
+// Session runs the console for a frontend
+type Session struct {
+	Console *nes.Bus
+	Game    string // the ROM file name, the game of the gamepad profiles
+
+	Keymap      *input.Keymap
+	KeyboardMap *input.KeyboardMap
+	Gamepads    *input.GamepadConfig
+	Turbo       *input.Turbo
+	Mouse       *input.MousePaddle
+
+	OSD *OSD // the text over the displayed frames
+
+	frame    *image.RGBA
+	display  *image.RGBA // the frame with the OSD
+	mouseX   int
+	hasMouse bool
+	fastDebt float64 // the fraction of a frame the fast-forward owes
+
+	slowSpeed float64 // 1: the real time
+	slowMute  bool
+	slowDebt  float64
+
+	runAhead   int // the frames run ahead of the shown one
+	focused    bool
+	background Background
+	snapshot   nes.Snapshot
+	stateSlot  int
+	picker     *statePicker  // nil: the slots aren't shown
+	rewind     *RewindBuffer // nil: the past isn't kept
+	autoSave   *autoSave     // nil: the state isn't auto-saved
+	apuLog     string        // the file the APU writes are exported to, "": none
+
+	resume      Resume
+	resumeKeys  []string
+	resumeOffer int        // the frames the auto-saved state is still offered for
+	perf        *perfStats // nil: the performance overlay is hidden
+
+	video      *video      // the video recording, nil: not recording
+	clip       *ClipBuffer // the last frames, nil: not kept
+	clipLength time.Duration
+	clipDone   chan error // the result of the clip being saved, nil: none
+
+	debugger *debugger.Debugger // nil: not debugged
+	script   Script             // nil: no script
+	cheatDir string
+	cheats   *cheats.List // nil: the cheats are off
+}
+
+// NewSession returns the session with the default input mappings
+func NewSession(console *nes.Bus, game string) *Session {
+	s := &Session{
+		Console:     console,
+		Game:        game,
+		Keymap:      input.DefaultKeymap(),
+		KeyboardMap: input.DefaultKeyboardMap(),
+		Gamepads:    input.DefaultGamepadConfig(),
+		Turbo:       &input.Turbo{On: 2, Off: 2},
+		Mouse:       input.DefaultMousePaddle(),
+		OSD:         NewOSD(),
+		frame:       image.NewRGBA(image.Rect(0, 0, nes.FrameWidth, nes.FrameHeight)),
+		display:     image.NewRGBA(image.Rect(0, 0, nes.FrameWidth, nes.FrameHeight)),
+		slowSpeed:   1,
+		focused:     true,
+	}
+	return s
+}
+
+// Frame returns the last completed frame, the image is reused
+func (s *Session) Frame() *image.RGBA {
+	return s.frame
+}
+
+// Display returns the last completed frame with the OSD drawn over it,
+// the frame the frontends show. The image is reused
+func (s *Session) Display() *image.RGBA {
+	copy(s.display.Pix, s.frame.Pix)
+	if s.script != nil {
+		s.script.Draw(s.display)
+	}
+	s.drawStatePicker(s.display)
+	s.tickClip()
+	s.OSD.Draw(s.display)
+	return s.display
+}
+
+// RunFrame sets the input of the frame and runs the console
+// until the frame is completed, with the sound of the frame
+func (s *Session) RunFrame(in HostInput) {
+	s.runFrame(in, true)
+}
+
+func (s *Session) runFrame(in HostInput, ahead bool) {
+	if s.debugger != nil {
+		paused := !s.debugger.BeginFrame()
+		s.OSD.SetIndicator("debugger", indicatorText(paused, "Paused in the debugger"))
+		if paused {
+			return
+		}
+		defer s.debugger.EndFrame()
+	}
+	if s.perf != nil {
+		start := s.perf.now()
+		defer func() {
+			s.perf.emulated++
+			s.perf.frames += s.perf.now().Sub(start)
+		}()
+	}
+	if s.script != nil {
+		if err := s.script.BeforeFrame(); err != nil {
+			s.scriptFailed(err)
+		}
+	}
+	s.setInput(in)
+	s.Console.RunFrame()
+	if s.script != nil {
+		if err := s.script.AfterFrame(); err != nil {
+			s.scriptFailed(err)
+		}
+	}
+	s.captureRewind()
+	s.tickAutoSave()
+	s.tickResumeOffer()
+	copy(s.frame.Pix, s.Console.PPU().Frame().Pix)
+	if s.video != nil {
+		s.recordFrame()
+	}
+	if s.clip != nil {
+		s.clip.Add(s.frame)
+	}
+	if ahead && s.runAhead > 0 && s.debugger == nil {
+		s.runAheadFrames()
+	}
+}
+
+// SetDebugger sets the debugger the console runs under, nil removes it.
+// The console paused by the debugger doesn't run the frames
+func (s *Session) SetDebugger(d *debugger.Debugger) {
+	s.debugger = d
+	s.OSD.SetIndicator("debugger", "")
+}
+
+// MaxRunAhead is the most frames the run-ahead runs
+const MaxRunAhead = 2
+
+// SetRunAhead sets how many frames run ahead of the shown frame, 0 is off.
+// The games react to the input a frame or two after it, with the run-ahead
+// the shown frame is the one of that reaction
+func (s *Session) SetRunAhead(frames int) {
+	s.runAhead = max(0, min(frames, MaxRunAhead))
+}
+
+// RunAhead returns how many frames run ahead of the shown frame
+func (s *Session) RunAhead() int {
+	return s.runAhead
+}
+
+// runAheadFrames runs the frames ahead with the same input, keeps
+// the last one to be shown and goes back to the real frame. The frames
+// ahead are silent and not recorded. It is off while a movie is active,
+// the movie would take the frames ahead, while the console is debugged,
+// the breakpoints would stop the frames ahead, and while the console is
+// instrumented, the trace and the logs would take them
+func (s *Session) runAheadFrames() {
+	console := s.Console
+	if _, mode, _ := console.Movie(); mode != nes.MovieOff || console.Instrumented() {
+		return
+	}
+	apu := console.APU()
+	output := apu.SampleOutput()
+	recorded := 0
+	if s.video != nil {
+		recorded = len(s.video.samples)
+	}
+
+	console.SaveSnapshot(&s.snapshot)
+	apu.SetSampleOutput(false)
+	for i := 0; i < s.runAhead; i++ {
+		console.RunFrame()
+	}
+	copy(s.frame.Pix, console.PPU().Frame().Pix)
+	console.LoadSnapshot(&s.snapshot)
+
+	apu.SetSampleOutput(output)
+	if s.video != nil {
+		s.video.samples = s.video.samples[:recorded]
+	}
+}
+
+// KeyboardTakes reports whether the key goes to the Family BASIC
+// keyboard, it takes its keys while it is plugged in
+func (s *Session) KeyboardTakes(key string) bool {
+	_, ok := s.Console.ExpansionDevice().(*nes.Keyboard)
+	return ok && s.KeyboardMap.Maps(key)
+}
+
+// setInput sets the input of the next frame from the keyboard,
+// the gamepads and the mouse
+func (s *Session) setInput(in HostInput) {
+	if s.backgroundInput() {
+		// the paddles stay where they are
+		in = HostInput{MouseX: s.mouseX}
+	}
+	console := s.Console
+	pressed := in.Keys
+
+	// the keys go to the Family BASIC keyboard while it is plugged in
+	if keyboard, ok := console.ExpansionDevice().(*nes.Keyboard); ok {
+		keyboard.SetKeys(s.KeyboardMap.Keys(pressed))
+		pressed = nil
+	}
+
+	held := s.Gamepads.Buttons(s.Game, in.Pads)
+	turbo := s.Gamepads.TurboButtons(s.Game, in.Pads)
+	var buttons [4]nes.Button
+	for port := range buttons {
+		held[port] |= s.Keymap.Buttons(port, pressed)
+		turbo[port] |= s.Keymap.TurboButtons(port, pressed)
+		buttons[port] = s.Turbo.Apply(held[port], turbo[port])
+	}
+	s.Turbo.Tic()
+	if s.script != nil {
+		s.script.Input(&buttons)
+	}
+	console.SetInput(buttons)
+	console.SetMicrophone(s.Keymap.Microphone(pressed))
+
+	// the paddles turn by the movement since the last frame
+	dx := 0.0
+	if s.hasMouse {
+		dx = float64(in.MouseX - s.mouseX)
+	}
+	s.mouseX, s.hasMouse = in.MouseX, true
+	for port := 0; port < 2; port++ {
+		switch d := console.PortDevice(port).(type) {
+		case *nes.Paddle:
+			s.Mouse.Apply(d, dx, in.MouseLeft)
+		case *nes.PowerPad:
+			d.SetButtons(s.Keymap.PowerPadButtons(pressed))
+		}
+	}
+	switch d := console.ExpansionDevice().(type) {
+	case *nes.FamicomPaddle:
+		s.Mouse.Apply(&d.Paddle, dx, in.MouseLeft)
+	case *nes.FamilyTrainer:
+		d.SetButtons(s.Keymap.PowerPadButtons(pressed))
+	}
+}
+
+// fastBudget is the time an unlimited fast-forward runs the frames for
+// per real time frame, the rest is left for the frontend
+const fastBudget = 12 * time.Millisecond
+
+// RunFast runs the frames of a real time frame in the fast-forward, all
+// with the same input. The speed is how many frames run, 0 runs as many as
+// fit in the time budget. Only the sound of the last frame is played,
+// so the sound keeps its pitch, with mute none of it
+func (s *Session) RunFast(in HostInput, speed float64, mute bool) {
+	mute = mute || s.BackgroundMuted()
+	apu := s.Console.APU()
+	apu.SetSlowMotion(1)
+	defer s.applySlowMotion()
+	if speed <= 0 {
+		apu.SetSampleOutput(false)
+		for start := time.Now(); time.Since(start) < fastBudget; {
+			s.runFrame(in, false)
+		}
+		if !mute {
+			apu.SetSampleOutput(true)
+			s.runFrame(in, false)
+		}
+		return
+	}
+
+	s.fastDebt += speed
+	frames := int(s.fastDebt)
+	s.fastDebt -= float64(frames)
+	for i := 0; i < frames; i++ {
+		apu.SetSampleOutput(!mute && i == frames-1)
+		s.runFrame(in, false)
+	}
+}
+
+// SlowMotionSpeeds are the speeds the slow motion hotkey cycles through
+var SlowMotionSpeeds = []float64{1, 0.5, 0.25, 0.1}
+
+// NextSlowMotion returns the speed after the speed in SlowMotionSpeeds
+func NextSlowMotion(speed float64) float64 {
+	for i, v := range SlowMotionSpeeds {
+		if v == speed {
+			return SlowMotionSpeeds[(i+1)%len(SlowMotionSpeeds)]
+		}
+	}
+	return SlowMotionSpeeds[0]
+}
+
+// SetSlowMotion sets the speed of the console below the real time,
+// 1 is the real time. The sound is stretched to the speed, or muted
+func (s *Session) SetSlowMotion(speed float64, mute bool) {
+	if speed <= 0 || speed > 1 {
+		speed = 1
+	}
+	s.slowSpeed, s.slowMute = speed, mute
+	s.slowDebt = 0
+	s.applySlowMotion()
+	indicator := ""
+	if speed < 1 {
+		indicator = fmt.Sprintf("Slow motion %d%%", int(speed*100+0.5))
+	}
+	s.OSD.SetIndicator("slow_motion", indicator)
+}
+
+// SlowMotion returns the speed of the console, 1 is the real time
+func (s *Session) SlowMotion() float64 {
+	return s.slowSpeed
+}
+
+func (s *Session) applySlowMotion() {
+	apu := s.Console.APU()
+	apu.SetSlowMotion(s.slowSpeed)
+	apu.SetSampleOutput((s.slowSpeed == 1 || !s.slowMute) && !s.BackgroundMuted())
+}
+
+// SlowDue returns how many frames a real time frame runs in the slow
+// motion, 0 or 1, for the frontends paced by the display
+func (s *Session) SlowDue() int {
+	s.slowDebt += s.slowSpeed
+	if s.slowDebt < 1 {
+		return 0
+	}
+	s.slowDebt--
+	return 1
+}
+
+// SwapCart replaces the game while running: the recording of the previous
+// game is finished, the kept frames are dropped and the console is powered
+// on with the new cartridge. The state of the previous game is auto-saved,
+// the new game is resumed the way it would be at the launch. The carts
+// have no battery RAM to flush, the auto-saved state keeps the progress
+func (s *Session) SwapCart(cart *nes.Cart, game string) error {
+	var err error
+	if videoErr := s.StopVideoRecording(); videoErr != nil {
+		err = fmt.Errorf("couldn't finish the video: %s", videoErr)
+	}
+	if saveErr := s.AutoSaveState(); saveErr != nil {
+		err = errors.Join(err, fmt.Errorf("couldn't auto-save the state: %s", saveErr))
+	}
+	console := s.Console
+	console.StopMovie()
+	console.LoadCart(cart)
+	console.PowerOn()
+	s.Game = game
+	s.OSD.Show("Loaded %s", game)
+	s.fastDebt, s.slowDebt = 0, 0
+	clear(s.frame.Pix)
+	s.SetClipLength(s.clipLength)
+	if s.rewind != nil {
+		s.SetRewind(s.rewind.opts)
+	}
+	if a := s.autoSave; a != nil {
+		a.due = a.interval
+	}
+	if resumeErr := s.Resume(s.resume, s.resumeKeys); resumeErr != nil {
+		err = errors.Join(err, fmt.Errorf("couldn't resume: %s", resumeErr))
+	}
+	if s.cheats != nil {
+		err = errors.Join(err, s.loadCheats())
+	}
+	return err
+}
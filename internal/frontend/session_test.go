@@ -0,0 +1,193 @@
+package frontend
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/debugger"
+	"github.com/nevisdale/nestic/internal/input"
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Session_RunFrame(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := NewSession(console, "test.nes")
+	s.Turbo = &input.Turbo{On: 1, Off: 1}
+
+	pad := input.Pad{Name: "Pad", PadState: input.PadState{Buttons: []bool{false, false, false, true}}}
+	s.RunFrame(HostInput{Keys: []string{"X", "ArrowUp", "K"}, Pads: []input.Pad{pad}})
+	assert.Equal(t, [4]nes.Button{nes.ButtonA | nes.ButtonUp, nes.ButtonA}, console.InputView().Buttons,
+		"the turbo A of the pad is pressed in the first frame")
+	assert.Equal(t, 1, console.InputView().Frame)
+
+	s.RunFrame(HostInput{Keys: []string{"ArrowUp"}, Pads: []input.Pad{pad}})
+	assert.Equal(t, [4]nes.Button{nes.ButtonUp}, console.InputView().Buttons)
+
+	// the paddle turns by the mouse movement
+	paddle := nes.NewPaddle()
+	console.SetPortDevice(1, paddle)
+	start := paddle.Position()
+	s.RunFrame(HostInput{})
+	s.RunFrame(HostInput{MouseX: 10, MouseLeft: true})
+	assert.Equal(t, start+5, paddle.Position())
+
+	// the keys go to the keyboard
+	keyboard := nes.NewKeyboard()
+	console.SetExpansionDevice(keyboard)
+	s.RunFrame(HostInput{Keys: []string{"X"}})
+	assert.Equal(t, [4]nes.Button{}, console.InputView().Buttons)
+}
+
+// newCountingConsole returns the console running a program which counts
+// the frames into $11 and shows the count as the backdrop color
+func newCountingConsole(t *testing.T) *nes.Bus {
+	rom := nestest.NewROM()
+	prg := rom[16:]
+	copy(prg, []byte{
+		0xA9, 0x80, 0x8D, 0x00, 0x20, // LDA #$80, STA $2000: NMI on
+		0xE6, 0x10, 0x4C, 0x05, 0x80, // loop: INC $10, JMP loop
+	})
+	copy(prg[0x20:], []byte{
+		0xE6, 0x11, // NMI: INC $11
+		0xA9, 0x3F, 0x8D, 0x06, 0x20, 0xA9, 0x00, 0x8D, 0x06, 0x20, // $3F00
+		0xA5, 0x11, 0x8D, 0x07, 0x20, // LDA $11, STA $2007: the backdrop
+		0xA9, 0x00, 0x8D, 0x06, 0x20, 0x8D, 0x06, 0x20, // the address back to 0
+		0x40, // RTI
+	})
+	copy(prg[0x3FFA:], []byte{0x20, 0x80, 0x00, 0x80, 0x00, 0x80})
+	return nestest.NewConsole(t, rom)
+}
+
+func Test_Session_SetRunAhead(t *testing.T) {
+	plain := NewSession(newCountingConsole(t), "test.nes")
+	ahead := NewSession(newCountingConsole(t), "test.nes")
+	ahead.SetRunAhead(5)
+	assert.Equal(t, MaxRunAhead, ahead.RunAhead())
+	ahead.SetRunAhead(1)
+
+	for i := 0; i < 3; i++ {
+		plain.RunFrame(HostInput{})
+		ahead.RunFrame(HostInput{})
+	}
+	// the console stays at the real frame with its sound,
+	// the shown frame is the next one
+	ram := func(s *Session) uint8 { return s.Console.RAM().Read8(0x11) }
+	assert.Equal(t, ram(plain), ram(ahead))
+	assert.Equal(t, plain.Console.APU().BufferedSamples(), ahead.Console.APU().BufferedSamples())
+	assert.NotEqual(t, plain.Frame().Pix, ahead.Frame().Pix)
+	plain.RunFrame(HostInput{})
+	assert.Equal(t, plain.Frame().Pix, ahead.Frame().Pix)
+}
+
+func Test_Session_SetRunAhead_Instrumented(t *testing.T) {
+	plain := NewSession(newCountingConsole(t), "test.nes")
+	ahead := NewSession(newCountingConsole(t), "test.nes")
+	ahead.SetRunAhead(1)
+	ahead.Console.SetCodeDataLogging(true)
+	for i := 0; i < 3; i++ {
+		plain.RunFrame(HostInput{})
+		ahead.RunFrame(HostInput{})
+	}
+	assert.Equal(t, plain.Frame().Pix, ahead.Frame().Pix, "no frames ahead go to the code/data log")
+}
+
+func Test_Session_RunFast(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := NewSession(console, "test.nes")
+
+	s.RunFast(HostInput{}, 2.5, false)
+	assert.Equal(t, 2, console.InputView().Frame)
+	s.RunFast(HostInput{}, 2.5, false)
+	assert.Equal(t, 5, console.InputView().Frame, "the fractions add up")
+
+	// only the sound of the last frame is kept
+	samples := make([]float32, nes.DefaultSampleRate)
+	console.APU().ReadSamples(samples)
+	s.RunFast(HostInput{}, 4, false)
+	n := console.APU().ReadSamples(samples)
+	assert.InDelta(t, nes.DefaultSampleRate/60, n, 20)
+
+	s.RunFast(HostInput{}, 4, true)
+	assert.Equal(t, 0, console.APU().ReadSamples(samples))
+
+	s.RunFast(HostInput{}, 0, true)
+	assert.Greater(t, console.InputView().Frame, 13, "the unlimited speed runs for the time budget")
+}
+
+func Test_Session_SetSlowMotion(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := NewSession(console, "test.nes")
+
+	s.SetSlowMotion(NextSlowMotion(1), false)
+	assert.Equal(t, 0.5, s.SlowMotion())
+	due := 0
+	for i := 0; i < 4; i++ {
+		due += s.SlowDue()
+	}
+	assert.Equal(t, 2, due)
+
+	// the sound is stretched, the first frame after the reset is shorter
+	samples := make([]float32, nes.DefaultSampleRate)
+	s.RunFrame(HostInput{})
+	console.APU().ReadSamples(samples)
+	s.RunFrame(HostInput{})
+	assert.InDelta(t, nes.DefaultSampleRate/30, console.APU().ReadSamples(samples), 20)
+
+	// the fast-forward plays the real time sound
+	s.RunFast(HostInput{}, 2, false)
+	assert.InDelta(t, nes.DefaultSampleRate/60, console.APU().ReadSamples(samples), 20)
+
+	s.SetSlowMotion(0.25, true)
+	s.RunFrame(HostInput{})
+	assert.Equal(t, 0, console.APU().ReadSamples(samples), "the slow motion is muted")
+
+	assert.Equal(t, 1.0, NextSlowMotion(0.1))
+	assert.Equal(t, 1.0, NextSlowMotion(0.3))
+}
+
+func Test_Session_SwapCart(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := NewSession(console, "test.nes")
+	s.SetClipLength(time.Second)
+	_, err := s.StartVideoRecording(VideoOptions{Dir: t.TempDir(), Format: "y4m"})
+	assert.NoError(t, err)
+	s.RunFrame(HostInput{})
+	console.RAM().Write8(0x10, 0x42)
+
+	// a PAL game
+	rom := nestest.NewROM()
+	rom[9] = 1
+	assert.NoError(t, s.SwapCart(nestest.NewCart(t, rom), "pal.nes"))
+	assert.False(t, s.RecordingVideo(), "the recording of the previous game is finished")
+	assert.Equal(t, "pal.nes", s.Game)
+	assert.Equal(t, nes.RegionPAL, console.Region())
+	assert.Equal(t, uint8(0), console.RAM().Read8(0x10), "the console is powered on")
+	assert.Equal(t, 0, s.clip.Len())
+	assert.Len(t, s.clip.frames, 50)
+}
+
+func Test_Session_Debugger(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := NewSession(console, "test.nes")
+	s.SetRunAhead(1)
+	d := debugger.New(console)
+	s.SetDebugger(d)
+
+	s.RunFrame(HostInput{})
+	d.Pause()
+	s.RunFrame(HostInput{})
+	assert.True(t, d.Paused())
+	cycles := console.CPURegisters().Cycles
+	s.RunFrame(HostInput{})
+	assert.Equal(t, cycles, console.CPURegisters().Cycles, "the paused console doesn't run")
+	indicators, _ := s.OSD.Lines()
+	assert.Equal(t, []string{"Paused in the debugger"}, indicators)
+
+	d.Resume()
+	s.RunFrame(HostInput{})
+	indicators, _ = s.OSD.Lines()
+	assert.Empty(t, indicators)
+	s.SetDebugger(nil)
+}
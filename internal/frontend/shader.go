@@ -0,0 +1,264 @@
+package frontend
+
+import (
+	"fmt"
+	"image"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// Shader is the set of the effects applied to the picture
+// when it is scaled up to the window
+type Shader uint8
+
+const (
+	ShaderScanlines      Shader = 1 << iota // darkens the gaps between the lines
+	ShaderApertureGrille                    // the stripes of the red, green and blue phosphors
+	ShaderCurvature                         // bends the picture like the glass of the tube
+	ShaderNTSCBlur                          // smears the pixels into the neighbors like the composite signal
+)
+
+// ShaderCRT is all the effects of the tube
+const ShaderCRT = ShaderScanlines | ShaderApertureGrille | ShaderCurvature
+
+var shaderNames = []struct {
+	shader Shader
+	name   string
+}{
+	{ShaderScanlines, "scanlines"},
+	{ShaderApertureGrille, "aperture_grille"},
+	{ShaderCurvature, "curvature"},
+	{ShaderNTSCBlur, "ntsc_blur"},
+}
+
+func (s Shader) String() string {
+	switch s {
+	case 0:
+		return "none"
+	case ShaderCRT:
+		return "crt"
+	}
+	var names []string
+	for _, n := range shaderNames {
+		if s&n.shader != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseShader parses the comma separated effects, e.g. "scanlines,curvature".
+// "crt" is all the effects of the tube, "none" or "" is no effects
+func ParseShader(s string) (Shader, error) {
+	var shader Shader
+	for _, name := range strings.Split(s, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "", "none":
+			continue
+		case "crt":
+			shader |= ShaderCRT
+			continue
+		}
+		found := false
+		for _, n := range shaderNames {
+			if n.name == name {
+				shader |= n.shader
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown shader %q", name)
+		}
+	}
+	return shader, nil
+}
+
+// ShaderPresets are the shaders the shader hotkey cycles through
+var ShaderPresets = []Shader{0, ShaderScanlines, ShaderApertureGrille, ShaderNTSCBlur, ShaderCRT}
+
+// NextShader returns the shader after the shader in ShaderPresets
+func NextShader(shader Shader) Shader {
+	for i, s := range ShaderPresets {
+		if s == shader {
+			return ShaderPresets[(i+1)%len(ShaderPresets)]
+		}
+	}
+	return ShaderPresets[0]
+}
+
+// ShaderScale returns the multiple of the picture the shader renders for
+// the picture drawn with the height: the smallest one not below the height,
+// so the window only scales it down
+func ShaderScale(height int) int {
+	return ClampScale(max((height+nes.FrameHeight-1)/nes.FrameHeight, 2))
+}
+
+// the weights of the effects out of 256
+const (
+	scanlineGap   = 128 // the last row of the picture pixel
+	apertureMask  = 176 // the two colors out of the stripe
+	curvatureBend = 0.05
+)
+
+// PostProcessor scales the frames up by a whole multiple applying
+// the shader. The effects need the picture pixels several window pixels
+// wide, so it is done before the window scales the picture to its size.
+// The wide pixels are scaled up too: the window scales the multiple
+// smoothly by less than a pixel, the nearest scaling to the odd widths
+// makes the pixels shimmer while they scroll
+type PostProcessor struct {
+	Shader Shader
+	Aspect PixelAspect
+
+	dst     *image.RGBA
+	scale   int
+	blurred *image.RGBA
+	warp    []int32 // see bend
+}
+
+// Process returns the frame scaled by the multiple with the shader applied.
+// Without the effects and with the square pixels it is the frame itself,
+// the window scales it with the nearest pixels. The image is reused
+func (p *PostProcessor) Process(frame *image.RGBA, scale int) *image.RGBA {
+	if p.Shader == 0 && p.Aspect == AspectSquare {
+		return frame
+	}
+	scale = ClampScale(scale)
+	width, height := nes.FrameWidth*scale, nes.FrameHeight*scale
+	if p.scale != scale || p.dst == nil {
+		p.dst = image.NewRGBA(image.Rect(0, 0, width, height))
+		p.scale, p.warp = scale, nil
+	}
+	if p.Shader&ShaderCurvature != 0 && p.warp == nil {
+		p.warp = bend(scale)
+	}
+
+	src := frame
+	if p.Shader&ShaderNTSCBlur != 0 {
+		if p.blurred == nil {
+			p.blurred = image.NewRGBA(frame.Rect)
+		}
+		blur(p.blurred, frame)
+		src = p.blurred
+	}
+
+	var rows [MaxScale]int
+	for i := range rows {
+		rows[i] = 256
+	}
+	if p.Shader&ShaderScanlines != 0 {
+		rows[scale-1] = scanlineGap
+	}
+	var mask [3][3]int // [column % 3][color]
+	for column := range mask {
+		for color := range mask[column] {
+			mask[column][color] = 256
+			if p.Shader&ShaderApertureGrille != 0 && column != color {
+				mask[column][color] = apertureMask
+			}
+		}
+	}
+
+	// the bands of the rows are processed in parallel
+	bands := runtime.GOMAXPROCS(0)
+	var wg sync.WaitGroup
+	for band := 0; band < bands; band++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for y := band * height / bands; y < (band+1)*height/bands; y++ {
+				out := p.dst.Pix[y*p.dst.Stride : y*p.dst.Stride+width*4]
+				if p.warp != nil && p.Shader&ShaderCurvature != 0 {
+					processBent(out, src, p.warp[y*width:(y+1)*width], &rows, &mask)
+				} else {
+					processRow(out, src, y, scale, rows[y%scale], &mask)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return p.dst
+}
+
+// processRow draws the row y of the picture scaled by the multiple
+func processRow(out []uint8, src *image.RGBA, y, scale, row int, mask *[3][3]int) {
+	var weights [3][3]int
+	for column := range weights {
+		for color := range weights[column] {
+			weights[column][color] = row * mask[column][color]
+		}
+	}
+	in := src.Pix[src.PixOffset(0, y/scale):]
+	column := 0
+	for x := 0; x < len(out)/4; x++ {
+		i := x / scale * 4
+		w := &weights[column]
+		out[x*4+0] = uint8(int(in[i+0]) * w[0] >> 16)
+		out[x*4+1] = uint8(int(in[i+1]) * w[1] >> 16)
+		out[x*4+2] = uint8(int(in[i+2]) * w[2] >> 16)
+		out[x*4+3] = 0xFF
+		if column++; column == 3 {
+			column = 0
+		}
+	}
+}
+
+// processBent draws the row of the bent picture by its unbent pixels
+func processBent(out []uint8, src *image.RGBA, warp []int32, rows *[MaxScale]int, mask *[3][3]int) {
+	for x, v := range warp {
+		if v < 0 {
+			out[x*4], out[x*4+1], out[x*4+2], out[x*4+3] = 0, 0, 0, 0xFF
+			continue
+		}
+		in := src.Pix[v>>3*4:]
+		row, m := rows[v&7], &mask[x%3]
+		out[x*4+0] = uint8(int(in[0]) * row * m[0] >> 16)
+		out[x*4+1] = uint8(int(in[1]) * row * m[1] >> 16)
+		out[x*4+2] = uint8(int(in[2]) * row * m[2] >> 16)
+		out[x*4+3] = 0xFF
+	}
+}
+
+// bend returns the unbent picture pixel and its row for every pixel
+// of the picture scaled by the multiple, as the pixel index << 3 | the row,
+// -1 is out of the picture. The middle of the edges bulges out and the corners are cut off
+func bend(scale int) []int32 {
+	width, height := nes.FrameWidth*scale, nes.FrameHeight*scale
+	warp := make([]int32, width*height)
+	for y := 0; y < height; y++ {
+		v := (float64(y)+0.5)/float64(height)*2 - 1
+		for x := 0; x < width; x++ {
+			u := (float64(x)+0.5)/float64(width)*2 - 1
+			bu, bv := u*(1+curvatureBend*v*v), v*(1+curvatureBend*u*u)
+			vx, vy := int((bu+1)/2*float64(width)), int((bv+1)/2*float64(height))
+			if bu < -1 || bv < -1 || vx >= width || vy >= height {
+				warp[y*width+x] = -1
+				continue
+			}
+			pixel := vy/scale*nes.FrameWidth + vx/scale
+			warp[y*width+x] = int32(pixel<<3 | vy%scale)
+		}
+	}
+	return warp
+}
+
+// blur mixes every pixel with its left and right neighbors by 1:2:1,
+// the composite signal is too narrow for the sharp edges
+func blur(dst, src *image.RGBA) {
+	bounds := src.Rect
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		in := src.Pix[src.PixOffset(bounds.Min.X, y):][:bounds.Dx()*4]
+		out := dst.Pix[dst.PixOffset(bounds.Min.X, y):][:bounds.Dx()*4]
+		last := len(in) - 4
+		for i := 0; i < len(in); i += 4 {
+			left, right := max(i-4, 0), min(i+4, last)
+			for c := 0; c < 3; c++ {
+				out[i+c] = uint8((int(in[left+c]) + 2*int(in[i+c]) + int(in[right+c]) + 2) / 4)
+			}
+			out[i+3] = 0xFF
+		}
+	}
+}
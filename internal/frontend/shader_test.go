@@ -0,0 +1,96 @@
+package frontend
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseShader(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		shader Shader
+	}{
+		{"none", 0},
+		{"scanlines", ShaderScanlines},
+		{"aperture_grille,ntsc_blur", ShaderApertureGrille | ShaderNTSCBlur},
+		{"crt", ShaderCRT},
+	} {
+		shader, err := ParseShader(tc.name)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.shader, shader)
+		assert.Equal(t, tc.name, shader.String())
+	}
+	shader, err := ParseShader(" scanlines, crt ,")
+	assert.NoError(t, err)
+	assert.Equal(t, ShaderCRT, shader)
+	_, err = ParseShader("bloom")
+	assert.Error(t, err)
+}
+
+func Test_NextShader(t *testing.T) {
+	shader := Shader(0)
+	for range ShaderPresets {
+		shader = NextShader(shader)
+	}
+	assert.Equal(t, Shader(0), shader, "the presets wrap around")
+	assert.Equal(t, Shader(0), NextShader(ShaderCurvature))
+}
+
+func Test_ShaderScale(t *testing.T) {
+	assert.Equal(t, 2, ShaderScale(nes.FrameHeight))
+	assert.Equal(t, 3, ShaderScale(3*nes.FrameHeight))
+	assert.Equal(t, 4, ShaderScale(3*nes.FrameHeight+1))
+	assert.Equal(t, MaxScale, ShaderScale(100*nes.FrameHeight))
+}
+
+// grayFrame returns the frame filled with the gray
+func grayFrame(v uint8) *image.RGBA {
+	frame := image.NewRGBA(image.Rect(0, 0, nes.FrameWidth, nes.FrameHeight))
+	for i := range frame.Pix {
+		frame.Pix[i] = v
+	}
+	return frame
+}
+
+func Test_PostProcessor_Process(t *testing.T) {
+	frame := grayFrame(200)
+	p := &PostProcessor{}
+	assert.Same(t, frame, p.Process(frame, 3), "no effects")
+	p.Aspect = AspectCRT
+	out := p.Process(frame, 3)
+	assert.Equal(t, image.Rect(0, 0, 3*nes.FrameWidth, 3*nes.FrameHeight), out.Rect, "the wide pixels are scaled smoothly")
+	assert.Equal(t, color.RGBA{200, 200, 200, 255}, out.RGBAAt(5, 2))
+
+	p.Shader = ShaderScanlines
+	out = p.Process(frame, 3)
+	assert.Equal(t, image.Rect(0, 0, 3*nes.FrameWidth, 3*nes.FrameHeight), out.Rect)
+	assert.Equal(t, color.RGBA{200, 200, 200, 255}, out.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{200, 200, 200, 255}, out.RGBAAt(0, 1))
+	assert.Equal(t, color.RGBA{100, 100, 100, 255}, out.RGBAAt(0, 2), "the gap between the lines")
+
+	p.Shader = ShaderApertureGrille
+	out = p.Process(frame, 3)
+	assert.Equal(t, color.RGBA{200, 137, 137, 255}, out.RGBAAt(0, 0))
+	assert.Equal(t, color.RGBA{137, 200, 137, 255}, out.RGBAAt(1, 0))
+	assert.Equal(t, color.RGBA{137, 137, 200, 255}, out.RGBAAt(2, 0))
+
+	p.Shader = ShaderCurvature
+	out = p.Process(frame, 2)
+	assert.Equal(t, color.RGBA{0, 0, 0, 255}, out.RGBAAt(0, 0), "the corners are cut off")
+	assert.Equal(t, color.RGBA{200, 200, 200, 255}, out.RGBAAt(nes.FrameWidth, nes.FrameHeight))
+}
+
+func Test_PostProcessor_Process_NTSCBlur(t *testing.T) {
+	frame := grayFrame(0)
+	frame.SetRGBA(10, 0, color.RGBA{200, 200, 200, 255})
+	p := &PostProcessor{Shader: ShaderNTSCBlur}
+	out := p.Process(frame, 2)
+	assert.Equal(t, color.RGBA{50, 50, 50, 255}, out.RGBAAt(2*9, 0))
+	assert.Equal(t, color.RGBA{100, 100, 100, 255}, out.RGBAAt(2*10, 0))
+	assert.Equal(t, color.RGBA{50, 50, 50, 255}, out.RGBAAt(2*11+1, 1))
+	assert.Equal(t, color.RGBA{0, 0, 0, 255}, out.RGBAAt(2*12, 0))
+}
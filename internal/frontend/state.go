@@ -0,0 +1,104 @@
+package frontend
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StateSlots is the number of the save state slots of every game
+const StateSlots = 10
+
+// DefaultStateDir returns the save states directory
+// in the user config directory
+func DefaultStateDir() (string, error) {
+	return configDir("states")
+}
+
+// StateName returns the file name of the save state in the slot: the ROM
+// name without the extension, the CRC32 of the game and the slot. The CRC
+// keeps the states of the games with the same file name apart
+func StateName(game string, crc uint32, slot int) string {
+	name := strings.TrimSuffix(filepath.Base(game), filepath.Ext(game))
+	return fmt.Sprintf("%s-%08X.%d.state", name, crc, slot)
+}
+
+// SetStateSlot selects the slot the states are saved into and loaded
+// from, the slots past the last one wrap around
+func (s *Session) SetStateSlot(slot int) {
+	s.stateSlot = (slot%StateSlots + StateSlots) % StateSlots
+	s.OSD.Show("State slot %d", s.stateSlot)
+}
+
+// StateSlot returns the selected save state slot
+func (s *Session) StateSlot() int {
+	return s.stateSlot
+}
+
+// statePath returns the path of the save state of the game
+// in the selected slot of the directory
+func (s *Session) statePath(dir string) (string, error) {
+	return s.slotPath(dir, s.stateSlot)
+}
+
+// slotPath returns the path of the save state of the game
+// in the slot of the directory
+func (s *Session) slotPath(dir string, slot int) (string, error) {
+	cart := s.Console.Cart()
+	if cart == nil {
+		return "", errors.New("no game is loaded")
+	}
+	if dir == "" {
+		var err error
+		if dir, err = DefaultStateDir(); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(dir, StateName(s.Game, cart.CRC(), slot)), nil
+}
+
+// SaveState saves the state of the console into the selected slot
+// in the states directory and returns the path of the file
+func (s *Session) SaveState(dir string) (string, error) {
+	path, err := s.statePath(dir)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("couldn't create the directory: %s", err)
+	}
+	if err := s.Console.SaveStateFile(path); err != nil {
+		return "", err
+	}
+	s.endResumeOffer()
+	s.picker = nil
+	s.OSD.Show("State %d saved", s.stateSlot)
+	return path, nil
+}
+
+// LoadState loads the state of the console from the selected slot,
+// the frame of the state is shown. While the auto-saved state
+// is offered, it is resumed instead
+func (s *Session) LoadState(dir string) error {
+	if s.ResumeOffered() {
+		return s.resumeAutoState()
+	}
+	path, err := s.statePath(dir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		s.OSD.Show("State %d is empty", s.stateSlot)
+		return fmt.Errorf("the slot %d of %s is empty", s.stateSlot, s.Game)
+	}
+	if err := s.Console.LoadStateFile(path); err != nil {
+		return err
+	}
+	copy(s.frame.Pix, s.Console.PPU().Frame().Pix)
+	s.fastDebt, s.slowDebt = 0, 0
+	s.picker = nil
+	s.OSD.Show("State %d loaded", s.stateSlot)
+	return nil
+}
@@ -0,0 +1,54 @@
+package frontend
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_StateName(t *testing.T) {
+	assert.Equal(t, "smb-0012ABCD.3.state", StateName("roms/smb.nes", 0x12ABCD, 3))
+}
+
+func Test_Session_SetStateSlot(t *testing.T) {
+	s := NewSession(nestest.NewConsole(t, nestest.NewROM()), "test.nes")
+	assert.Equal(t, 0, s.StateSlot())
+	s.SetStateSlot(9)
+	assert.Equal(t, 9, s.StateSlot())
+	s.SetStateSlot(s.StateSlot() + 1)
+	assert.Equal(t, 0, s.StateSlot(), "the slots wrap around")
+	s.SetStateSlot(s.StateSlot() - 1)
+	assert.Equal(t, 9, s.StateSlot())
+}
+
+func Test_Session_SaveState(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := NewSession(console, "test.nes")
+	dir := filepath.Join(t.TempDir(), "states")
+
+	assert.EqualError(t, s.LoadState(dir), "the slot 0 of test.nes is empty")
+
+	s.RunFrame(HostInput{})
+	path, err := s.SaveState(dir)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, StateName("test.nes", console.Cart().CRC(), 0)), path)
+	frame := console.InputView().Frame
+
+	s.SetStateSlot(1)
+	s.RunFrame(HostInput{})
+	_, err = s.SaveState(dir)
+	require.NoError(t, err)
+
+	s.RunFrame(HostInput{})
+	s.SetStateSlot(0)
+	require.NoError(t, s.LoadState(dir))
+	assert.Equal(t, frame, console.InputView().Frame)
+	assert.Equal(t, console.PPU().Frame().Pix, s.Frame().Pix)
+
+	s.SetStateSlot(1)
+	require.NoError(t, s.LoadState(dir))
+	assert.Equal(t, frame+1, console.InputView().Frame, "every slot keeps its own state")
+}
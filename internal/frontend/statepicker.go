@@ -0,0 +1,107 @@
+package frontend
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// statePicker shows the thumbnails of the selected save state slot
+// and of the slots around it for a while after the slot is changed
+type statePicker struct {
+	slots [3]pickerSlot // the previous, the selected and the next slot
+	until time.Time
+}
+
+type pickerSlot struct {
+	slot  int
+	thumb *image.RGBA // nil: the text is shown instead
+	text  string
+}
+
+// StateThumbnail returns the thumbnail of the save state in the slot,
+// nil for the empty slot
+func (s *Session) StateThumbnail(dir string, slot int) (*image.RGBA, error) {
+	path, err := s.slotPath(dir, slot)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open the state file: %s", err)
+	}
+	defer file.Close()
+	return nes.ReadStateThumbnail(bufio.NewReader(file))
+}
+
+// ShowStateSlots shows the thumbnails of the states in the selected slot
+// and in the slots next to it for MessageDuration, the frontends call it
+// when the slot is changed
+func (s *Session) ShowStateSlots(dir string) {
+	p := &statePicker{until: s.OSD.now().Add(MessageDuration)}
+	for i := range p.slots {
+		slot := (s.stateSlot + i - 1 + StateSlots) % StateSlots
+		thumb, err := s.StateThumbnail(dir, slot)
+		p.slots[i] = pickerSlot{slot: slot, thumb: thumb}
+		switch {
+		case err != nil:
+			p.slots[i].text = "?"
+		case thumb == nil:
+			p.slots[i].text = "Empty"
+		}
+	}
+	s.picker = p
+}
+
+// drawStatePicker draws the thumbnails in the middle of the picture,
+// the selected one in the frame
+func (s *Session) drawStatePicker(dst *image.RGBA) {
+	p := s.picker
+	if p == nil {
+		return
+	}
+	if !s.OSD.now().Before(p.until) {
+		s.picker = nil
+		return
+	}
+	const gap = 8
+	width := len(p.slots)*nes.ThumbnailWidth + (len(p.slots)-1)*gap
+	x := dst.Rect.Min.X + (dst.Rect.Dx()-width)/2
+	y := dst.Rect.Min.Y + (dst.Rect.Dy()-nes.ThumbnailHeight)/2
+	for i, slot := range p.slots {
+		cell := image.Rect(x, y, x+nes.ThumbnailWidth, y+nes.ThumbnailHeight)
+		if slot.thumb != nil {
+			draw.Draw(dst, cell, slot.thumb, image.Point{}, draw.Src)
+		} else {
+			darken(dst, cell)
+			DrawText(dst, slot.text, x+(nes.ThumbnailWidth-len(slot.text)*glyphWidth)/2, y+(nes.ThumbnailHeight-glyphHeight)/2)
+		}
+		DrawText(dst, fmt.Sprintf("Slot %d", slot.slot), x, y-glyphHeight-2)
+		if i == 1 {
+			drawOutline(dst, cell.Inset(-1))
+		}
+		x += nes.ThumbnailWidth + gap
+	}
+}
+
+// drawOutline draws the white line around the inside of the box
+func drawOutline(dst *image.RGBA, box image.Rectangle) {
+	white := image.NewUniform(image.White)
+	for _, side := range []image.Rectangle{
+		image.Rect(box.Min.X, box.Min.Y, box.Max.X, box.Min.Y+1),
+		image.Rect(box.Min.X, box.Max.Y-1, box.Max.X, box.Max.Y),
+		image.Rect(box.Min.X, box.Min.Y, box.Min.X+1, box.Max.Y),
+		image.Rect(box.Max.X-1, box.Min.Y, box.Max.X, box.Max.Y),
+	} {
+		draw.Draw(dst, side, white, image.Point{}, draw.Src)
+	}
+}
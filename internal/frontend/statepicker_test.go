@@ -0,0 +1,67 @@
+package frontend
+
+import (
+	"image/color"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Session_StateThumbnail(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := NewSession(console, "test.nes")
+	dir := t.TempDir()
+	s.RunFrame(HostInput{})
+	_, err := s.SaveState(dir)
+	require.NoError(t, err)
+
+	thumb, err := s.StateThumbnail(dir, 0)
+	require.NoError(t, err)
+	assert.Equal(t, nes.ThumbnailWidth, thumb.Rect.Dx())
+	assert.Equal(t, s.Frame().At(0, 0), thumb.At(0, 0))
+
+	thumb, err = s.StateThumbnail(dir, 1)
+	assert.NoError(t, err)
+	assert.Nil(t, thumb, "the slot is empty")
+}
+
+func Test_Session_ShowStateSlots(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := NewSession(console, "test.nes")
+	now := time.Unix(0, 0)
+	s.OSD.now = func() time.Time { return now }
+	dir := t.TempDir()
+	s.RunFrame(HostInput{})
+	_, err := s.SaveState(dir)
+	require.NoError(t, err)
+	path, err := s.slotPath(dir, 9)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []uint8("not a state"), 0o644))
+
+	s.SetStateSlot(0)
+	s.ShowStateSlots(dir)
+	require.NotNil(t, s.picker)
+	assert.Equal(t, 9, s.picker.slots[0].slot, "the slots wrap around")
+	assert.Equal(t, "?", s.picker.slots[0].text)
+	assert.NotNil(t, s.picker.slots[1].thumb)
+	assert.Equal(t, "Empty", s.picker.slots[2].text)
+
+	// the frame around the selected slot in the middle
+	x := (nes.FrameWidth-3*nes.ThumbnailWidth-16)/2 + nes.ThumbnailWidth + 8 - 1
+	y := (nes.FrameHeight-nes.ThumbnailHeight)/2 - 1
+	assert.Equal(t, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}, s.Display().At(x, y))
+
+	now = now.Add(MessageDuration)
+	assert.Equal(t, s.Frame().At(x, y), s.Display().At(x, y), "the picker is hidden after a while")
+	assert.Nil(t, s.picker)
+
+	s.ShowStateSlots(dir)
+	_, err = s.SaveState(dir)
+	require.NoError(t, err)
+	assert.Nil(t, s.picker, "saving hides the picker")
+}
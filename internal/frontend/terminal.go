@@ -0,0 +1,417 @@
+package frontend
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"strconv"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// TerminalGraphics is how the picture is drawn in the terminal
+type TerminalGraphics int
+
+const (
+	// TerminalAuto draws the sixel images when the terminal supports them
+	TerminalAuto TerminalGraphics = iota
+	// TerminalBlocks draws the half block characters in the 24-bit colors,
+	// a character cell is two pixels one above the other
+	TerminalBlocks
+	// TerminalSixel draws the sixel images
+	TerminalSixel
+)
+
+var terminalGraphicsNames = []string{"auto", "blocks", "sixel"}
+
+func (g TerminalGraphics) String() string {
+	if int(g) < len(terminalGraphicsNames) {
+		return terminalGraphicsNames[g]
+	}
+	return fmt.Sprintf("TerminalGraphics(%d)", int(g))
+}
+
+// ParseTerminalGraphics parses the graphics name: auto, blocks or sixel
+func ParseTerminalGraphics(name string) (TerminalGraphics, error) {
+	for i, n := range terminalGraphicsNames {
+		if n == name {
+			return TerminalGraphics(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid terminal graphics %q", name)
+}
+
+// TerminalAttributesQuery asks the terminal for its primary device
+// attributes, the answer lists the sixel graphics as the attribute 4
+const TerminalAttributesQuery = "\x1b[?c"
+
+// SixelSupported reports whether the answer to TerminalAttributesQuery,
+// e.g. "\x1b[?62;4;22c", has the sixel graphics
+func SixelSupported(answer []byte) bool {
+	start := bytes.Index(answer, []byte("\x1b[?"))
+	if start < 0 {
+		return false
+	}
+	answer = answer[start+3:]
+	end := bytes.IndexByte(answer, 'c')
+	if end < 0 {
+		return false
+	}
+	for _, attr := range bytes.Split(answer[:end], []byte(";")) {
+		if string(attr) == "4" {
+			return true
+		}
+	}
+	return false
+}
+
+// TerminalRenderer draws the frames as the escape sequences of the terminal.
+// The half blocks only redraw the cells which changed since the last frame
+type TerminalRenderer struct {
+	Graphics TerminalGraphics // TerminalBlocks or TerminalSixel
+	Aspect   PixelAspect
+	Scale    int // the multiple of the sixel images
+
+	out   []byte
+	cols  int
+	rows  int
+	cells []uint64 // the colors of the drawn cells, the top << 24 | the bottom
+
+	palette map[uint32]int // the sixel color registers
+	colors  []uint32
+	indexes []uint8 // the color register of every frame pixel
+	columns []int   // the frame pixel of every sixel image column
+}
+
+// Invalidate makes the next frame redraw the whole screen,
+// e.g. after the terminal was cleared
+func (r *TerminalRenderer) Invalidate() {
+	r.cells = nil
+}
+
+// Render returns the output drawing the frame on the terminal screen
+// of the size in the character cells. The output is reused
+func (r *TerminalRenderer) Render(frame *image.RGBA, cols, rows int) []byte {
+	r.out = r.out[:0]
+	if r.Graphics == TerminalSixel {
+		return r.sixel(frame)
+	}
+	return r.blocks(frame, cols, rows)
+}
+
+// blocks draws the frame with the upper half blocks, the foreground
+// color is the top pixel and the background is the bottom one
+func (r *TerminalRenderer) blocks(frame *image.RGBA, cols, rows int) []byte {
+	if cols != r.cols || rows != r.rows || len(r.cells) != cols*rows {
+		r.cols, r.rows = cols, rows
+		r.cells = make([]uint64, cols*rows)
+		for i := range r.cells {
+			r.cells[i] = 1 << 63 // no color, drawn for sure
+		}
+		r.out = append(r.out, "\x1b[0m\x1b[2J"...)
+	}
+	rect := FitRect(image.Pt(cols, rows*2), false, r.Aspect)
+	pixel := func(x, y int) uint32 {
+		if !image.Pt(x, y).In(rect) {
+			return 0
+		}
+		fx := (x - rect.Min.X) * nes.FrameWidth / rect.Dx()
+		fy := (y - rect.Min.Y) * nes.FrameHeight / rect.Dy()
+		p := frame.Pix[frame.PixOffset(fx, fy):]
+		return uint32(p[0])<<16 | uint32(p[1])<<8 | uint32(p[2])
+	}
+
+	fg, bg := int64(-1), int64(-1)
+	for y := 0; y < rows; y++ {
+		cursor := -1 // the column the cursor is at, -1: somewhere else
+		for x := 0; x < cols; x++ {
+			top, bottom := pixel(x, 2*y), pixel(x, 2*y+1)
+			cell := uint64(top)<<24 | uint64(bottom)
+			if r.cells[y*cols+x] == cell {
+				continue
+			}
+			r.cells[y*cols+x] = cell
+			if cursor != x {
+				r.out = fmt.Appendf(r.out, "\x1b[%d;%dH", y+1, x+1)
+			}
+			if int64(bottom) != bg {
+				bg = int64(bottom)
+				r.out = appendColor(r.out, "48", bottom)
+			}
+			if top == bottom {
+				r.out = append(r.out, ' ')
+			} else {
+				if int64(top) != fg {
+					fg = int64(top)
+					r.out = appendColor(r.out, "38", top)
+				}
+				r.out = append(r.out, "▀"...)
+			}
+			cursor = x + 1
+		}
+	}
+	return r.out
+}
+
+// appendColor appends the 24-bit color escape, 38 is the foreground
+// and 48 is the background
+func appendColor(dst []byte, kind string, c uint32) []byte {
+	dst = append(dst, "\x1b["...)
+	dst = append(dst, kind...)
+	dst = append(dst, ";2;"...)
+	dst = strconv.AppendUint(dst, uint64(c>>16), 10)
+	dst = append(dst, ';')
+	dst = strconv.AppendUint(dst, uint64(c>>8&0xFF), 10)
+	dst = append(dst, ';')
+	dst = strconv.AppendUint(dst, uint64(c&0xFF), 10)
+	return append(dst, 'm')
+}
+
+// maxSixelColors is the number of the sixel color registers
+const maxSixelColors = 256
+
+// sixel draws the frame as the sixel image in the top left corner,
+// scaled by the multiple. The frame has a few dozen colors of the palette,
+// the filtered frames with more are reduced to 3-3-2 bits
+func (r *TerminalRenderer) sixel(frame *image.RGBA) []byte {
+	scale := ClampScale(r.Scale)
+	width := r.Aspect.Width(nes.FrameWidth * scale)
+	height := nes.FrameHeight * scale
+
+	if !r.index(frame, false) {
+		r.index(frame, true)
+	}
+
+	r.out = append(r.out, "\x1b[H\x1bP0;1;0q"...)
+	r.out = fmt.Appendf(r.out, "\"1;1;%d;%d", width, height)
+	for i, c := range r.colors {
+		r.out = fmt.Appendf(r.out, "#%d;2;%d;%d;%d", i,
+			(c>>16)*100/255, (c>>8&0xFF)*100/255, (c&0xFF)*100/255)
+	}
+
+	// the image pixel to the frame pixel
+	if len(r.columns) != width {
+		r.columns = make([]int, width)
+		for x := range r.columns {
+			r.columns[x] = x * nes.FrameWidth / width
+		}
+	}
+	columns := r.columns
+	var used [maxSixelColors]bool
+	for band := 0; band < height; band += 6 {
+		for i := range r.colors {
+			used[i] = false
+		}
+		for y := band; y < min(band+6, height); y++ {
+			row := r.indexes[y/scale*nes.FrameWidth:]
+			for _, fx := range columns {
+				used[row[fx]] = true
+			}
+		}
+		first := true
+		for i := range r.colors {
+			if !used[i] {
+				continue
+			}
+			if !first {
+				r.out = append(r.out, '$')
+			}
+			first = false
+			r.out = fmt.Appendf(r.out, "#%d", i)
+			r.sixelRow(band, height, scale, columns, uint8(i))
+		}
+		r.out = append(r.out, '-')
+	}
+	return append(r.out, "\x1b\\"...)
+}
+
+// index finds the color register of every frame pixel, and reports
+// whether the registers were enough. The reduced colors always fit
+func (r *TerminalRenderer) index(frame *image.RGBA, reduce bool) bool {
+	if r.palette == nil {
+		r.palette = map[uint32]int{}
+	}
+	clear(r.palette)
+	r.colors, r.indexes = r.colors[:0], r.indexes[:0]
+	for y := 0; y < nes.FrameHeight; y++ {
+		row := frame.Pix[frame.PixOffset(0, y):]
+		for x := 0; x < nes.FrameWidth; x++ {
+			c := uint32(row[x*4])<<16 | uint32(row[x*4+1])<<8 | uint32(row[x*4+2])
+			if reduce {
+				c &= 0xE0E0C0
+			}
+			i, ok := r.palette[c]
+			if !ok {
+				if len(r.colors) == maxSixelColors {
+					return false
+				}
+				i = len(r.colors)
+				r.palette[c] = i
+				r.colors = append(r.colors, c)
+			}
+			r.indexes = append(r.indexes, uint8(i))
+		}
+	}
+	return true
+}
+
+// sixelRow appends the run-length encoded sixels of the color in the band
+func (r *TerminalRenderer) sixelRow(band, height, scale int, columns []int, color uint8) {
+	last, run := byte(0), 0
+	flush := func() {
+		switch {
+		case run > 3:
+			r.out = fmt.Appendf(r.out, "!%d%c", run, last)
+		default:
+			for ; run > 0; run-- {
+				r.out = append(r.out, last)
+			}
+		}
+	}
+	for _, fx := range columns {
+		bits := byte(0)
+		for y := band; y < min(band+6, height); y++ {
+			if r.indexes[y/scale*nes.FrameWidth+fx] == color {
+				bits |= 1 << (y - band)
+			}
+		}
+		sixel := '?' + bits
+		if sixel != last {
+			flush()
+			last, run = sixel, 0
+		}
+		run++
+	}
+	// the empty sixels at the end of the row are left out
+	if last != '?' {
+		flush()
+	}
+}
+
+// ParseTerminalKeys names the keys in the terminal input the way the
+// keymap names them. The letters are named by their keys, with or without
+// the shift, the control combinations are named like "Ctrl+C".
+// The modifier keys alone are not seen by the terminal programs
+func ParseTerminalKeys(in []byte) []string {
+	var keys []string
+	for len(in) > 0 {
+		c := in[0]
+		if c == 0x1B {
+			key, n := parseEscape(in)
+			if key != "" {
+				keys = append(keys, key)
+			}
+			in = in[n:]
+			continue
+		}
+		in = in[1:]
+		switch {
+		case c >= 'a' && c <= 'z':
+			keys = append(keys, string(rune(c-'a'+'A')))
+		case c >= 'A' && c <= 'Z':
+			keys = append(keys, string(rune(c)))
+		case c >= '0' && c <= '9':
+			keys = append(keys, "Digit"+string(rune(c)))
+		case c == '\r' || c == '\n':
+			keys = append(keys, "Enter")
+		case c == '\t':
+			keys = append(keys, "Tab")
+		case c == ' ':
+			keys = append(keys, "Space")
+		case c == 0x7F || c == 0x08:
+			keys = append(keys, "Backspace")
+		case c < 0x20:
+			keys = append(keys, "Ctrl+"+string(rune(c+'A'-1)))
+		default:
+			if name, ok := terminalPunctuation[c]; ok {
+				keys = append(keys, name)
+			}
+		}
+	}
+	return keys
+}
+
+// terminalPunctuation names the punctuation keys, with or without the shift
+var terminalPunctuation = map[byte]string{
+	'-': "Minus", '_': "Minus", '=': "Equal", '+': "Equal",
+	'[': "BracketLeft", '{': "BracketLeft", ']': "BracketRight", '}': "BracketRight",
+	'\\': "Backslash", '|': "Backslash", ';': "Semicolon", ':': "Semicolon",
+	'\'': "Quote", '"': "Quote", '`': "Backquote", '~': "Backquote",
+	',': "Comma", '<': "Comma", '.': "Period", '>': "Period", '/': "Slash", '?': "Slash",
+}
+
+// terminalEscapes names the escape sequences of the keys, xterm style
+var terminalEscapes = map[string]string{
+	"[A": "ArrowUp", "[B": "ArrowDown", "[C": "ArrowRight", "[D": "ArrowLeft",
+	"OA": "ArrowUp", "OB": "ArrowDown", "OC": "ArrowRight", "OD": "ArrowLeft",
+	"[H": "Home", "[F": "End", "OH": "Home", "OF": "End",
+	"[2~": "Insert", "[3~": "Delete", "[5~": "PageUp", "[6~": "PageDown",
+	"OP": "F1", "OQ": "F2", "OR": "F3", "OS": "F4",
+	"[15~": "F5", "[17~": "F6", "[18~": "F7", "[19~": "F8",
+	"[20~": "F9", "[21~": "F10", "[23~": "F11", "[24~": "F12",
+}
+
+// parseEscape returns the key of the escape sequence at the start of
+// the input and its length. The unknown sequences, e.g. the answers of
+// the terminal, are skipped, the escape alone is the escape key
+func parseEscape(in []byte) (string, int) {
+	if len(in) == 1 || (in[1] != '[' && in[1] != 'O') {
+		return "Escape", 1
+	}
+	// the control sequence ends with a byte in @-~, the SS3 one
+	// with the byte after the O
+	end := 2
+	if in[1] == '[' {
+		for end < len(in) && (in[end] < 0x40 || in[end] > 0x7E) {
+			end++
+		}
+	}
+	if end == len(in) {
+		return "", len(in)
+	}
+	return terminalEscapes[string(in[1:end+1])], end + 1
+}
+
+// Terminal key hold times: the terminal only sends the presses, and the
+// repeats while the key is held. The first repeat comes after the delay
+// of the keyboard, the next ones come faster
+const (
+	terminalKeyHold   = 500 * time.Millisecond
+	terminalKeyRepeat = 100 * time.Millisecond
+)
+
+// TerminalKeys keeps the keys held from their presses. A key is held since
+// its press until its repeats stop, so a tap holds it for a moment
+type TerminalKeys struct {
+	until map[string]time.Time
+	keys  []string
+}
+
+// Press holds the keys pressed at the time
+func (t *TerminalKeys) Press(keys []string, now time.Time) {
+	if t.until == nil {
+		t.until = map[string]time.Time{}
+	}
+	for _, key := range keys {
+		hold := terminalKeyHold
+		if until, held := t.until[key]; held && now.Before(until) {
+			// the key repeats
+			hold = terminalKeyRepeat
+		}
+		t.until[key] = now.Add(hold)
+	}
+}
+
+// Held returns the keys held at the time, the slice is reused
+func (t *TerminalKeys) Held(now time.Time) []string {
+	t.keys = t.keys[:0]
+	for key, until := range t.until {
+		if !now.Before(until) {
+			delete(t.until, key)
+			continue
+		}
+		t.keys = append(t.keys, key)
+	}
+	return t.keys
+}
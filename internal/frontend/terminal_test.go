@@ -0,0 +1,97 @@
+package frontend
+
+import (
+	"bytes"
+	"image/color"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseTerminalGraphics(t *testing.T) {
+	for _, g := range []TerminalGraphics{TerminalAuto, TerminalBlocks, TerminalSixel} {
+		parsed, err := ParseTerminalGraphics(g.String())
+		assert.NoError(t, err)
+		assert.Equal(t, g, parsed)
+	}
+	_, err := ParseTerminalGraphics("kitty")
+	assert.Error(t, err)
+}
+
+func Test_SixelSupported(t *testing.T) {
+	assert.True(t, SixelSupported([]byte("\x1b[?62;4;22c")))
+	assert.True(t, SixelSupported([]byte("A\x1b[?63;1;2;4c")), "a key pressed before the answer")
+	assert.False(t, SixelSupported([]byte("\x1b[?62;22c")))
+	assert.False(t, SixelSupported([]byte("\x1b[?1;2c")))
+	assert.False(t, SixelSupported([]byte("\x1b[?62;4")), "the answer is cut off")
+	assert.False(t, SixelSupported(nil))
+}
+
+func Test_TerminalRenderer_Blocks(t *testing.T) {
+	frame := grayFrame(0)
+	for x := 0; x < nes.FrameWidth; x++ {
+		for y := 0; y < 100; y++ {
+			frame.SetRGBA(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+	r := &TerminalRenderer{Graphics: TerminalBlocks}
+	// 16 by 15 pixels fill the screen
+	out := string(r.Render(frame, 16, 8))
+	assert.True(t, strings.HasPrefix(out, "\x1b[0m\x1b[2J"), "the screen is cleared first")
+	assert.Contains(t, out, "\x1b[1;1H\x1b[48;2;255;0;0m ", "the red cells")
+	assert.Contains(t, out, "\x1b[48;2;0;0;0m\x1b[38;2;255;0;0m▀", "the cell of the red and black pixels")
+	assert.Equal(t, 16*8, strings.Count(out, " ")+strings.Count(out, "▀"))
+
+	assert.Empty(t, r.Render(frame, 16, 8), "nothing changed")
+	// the bottom right cell, its bottom half is out of the picture
+	frame.SetRGBA(240, 224, color.RGBA{0, 0, 255, 255})
+	assert.Equal(t, "\x1b[8;16H\x1b[48;2;0;0;0m\x1b[38;2;0;0;255m▀", string(r.Render(frame, 16, 8)))
+	r.Invalidate()
+	out = string(r.Render(frame, 16, 8))
+	assert.Equal(t, 16*8, strings.Count(out, " ")+strings.Count(out, "▀"), "every cell is drawn again")
+}
+
+func Test_TerminalRenderer_Sixel(t *testing.T) {
+	frame := grayFrame(0)
+	frame.SetRGBA(0, 0, color.RGBA{255, 255, 255, 255})
+	r := &TerminalRenderer{Graphics: TerminalSixel, Scale: 1}
+	out := r.Render(frame, 80, 24)
+	assert.True(t, bytes.HasPrefix(out, []byte("\x1b[H\x1bP0;1;0q\"1;1;256;240#0;2;100;100;100#1;2;0;0;0")))
+	assert.True(t, bytes.HasSuffix(out, []byte("\x1b\\")))
+	assert.Equal(t, 40, bytes.Count(out, []byte("-")), "a band of 6 rows per line")
+	// the white pixel alone, and the black band around it
+	assert.Contains(t, string(out), "#0@$#1}!255~-")
+
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 256; x++ {
+			frame.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+	out = r.Render(frame, 80, 24)
+	assert.LessOrEqual(t, bytes.Count(out, []byte(";2;")), maxSixelColors, "the colors are reduced")
+}
+
+func Test_ParseTerminalKeys(t *testing.T) {
+	keys := ParseTerminalKeys([]byte("xZ1 \r\x1b[A\x1bOP\x1b[15~\x03\x1b[?62;4c\x1b"))
+	assert.Equal(t, []string{"X", "Z", "Digit1", "Space", "Enter", "ArrowUp", "F1", "F5", "Ctrl+C", "Escape"}, keys)
+	assert.Equal(t, []string{"Comma", "Slash"}, ParseTerminalKeys([]byte("<?")))
+}
+
+func Test_TerminalKeys(t *testing.T) {
+	var k TerminalKeys
+	now := time.Unix(0, 0)
+	k.Press([]string{"X"}, now)
+	assert.Equal(t, []string{"X"}, k.Held(now.Add(terminalKeyHold-time.Millisecond)), "a tap holds the key for a moment")
+	assert.Empty(t, k.Held(now.Add(terminalKeyHold)))
+
+	k.Press([]string{"X", "Z"}, now)
+	k.Press([]string{"X"}, now.Add(400*time.Millisecond))
+	held := k.Held(now.Add(450 * time.Millisecond))
+	sort.Strings(held)
+	assert.Equal(t, []string{"X", "Z"}, held)
+	assert.Empty(t, k.Held(now.Add(400*time.Millisecond+terminalKeyRepeat)), "the repeats stopped")
+}
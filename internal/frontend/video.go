@@ -0,0 +1,355 @@
+package frontend
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/audio"
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// VideoOptions are how the videos are recorded
+type VideoOptions struct {
+	Dir string // "": DefaultVideoDir
+	// Format is the container ffmpeg encodes to: mkv or mp4, or y4m
+	// for a Y4M video and a WAV sound written without ffmpeg. "": mkv
+	Format string
+	FFmpeg string // the ffmpeg command, "": ffmpeg
+}
+
+// DefaultVideoDir returns the videos directory in the user config directory
+func DefaultVideoDir() (string, error) {
+	return configDir("videos")
+}
+
+// videoRecorder writes the frames with their sound
+type videoRecorder interface {
+	writeFrame(frame *image.RGBA, samples []float32) error
+	close() error
+}
+
+// video is the recording of the session
+type video struct {
+	recorder videoRecorder
+	path     string
+	err      error // the first write error, the recording stops on it
+
+	samples  []float32 // the sound of the frame
+	channels int
+	perFrame float64 // the samples of a frame
+	debt     float64 // the fraction of a sample the frames owe
+}
+
+// StartVideoRecording starts recording the frames and the sound into
+// a file in the videos directory and returns its path. The recording
+// follows the emulation, so the fast-forwarded and the slowed down
+// frames are recorded at the normal speed
+func (s *Session) StartVideoRecording(opts VideoOptions) (string, error) {
+	if s.video != nil {
+		return "", fmt.Errorf("the video is already recording")
+	}
+	dir := opts.Dir
+	if dir == "" {
+		var err error
+		if dir, err = DefaultVideoDir(); err != nil {
+			return "", err
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("couldn't create the directory: %s", err)
+	}
+	format := strings.ToLower(opts.Format)
+	if format == "" {
+		format = "mkv"
+	}
+
+	apu := s.Console.APU()
+	v := &video{channels: 1}
+	if apu.Stereo() {
+		v.channels = 2
+	}
+	rate := s.Console.Region().FrameRate()
+	sampleRate := apu.SampleRate()
+	v.perFrame = float64(sampleRate) / rate
+	v.path = filepath.Join(dir, captureName(s.Game, time.Now(), "."+format))
+
+	var err error
+	switch format {
+	case "y4m":
+		v.recorder, err = newY4MRecorder(v.path, rate, sampleRate, v.channels)
+	case "mkv", "mp4", "mov", "webm":
+		command := opts.FFmpeg
+		if command == "" {
+			command = "ffmpeg"
+		}
+		v.recorder, err = newFFmpegRecorder(command, v.path, rate, sampleRate, v.channels)
+	default:
+		return "", fmt.Errorf("unknown video format %q", opts.Format)
+	}
+	if err != nil {
+		return "", err
+	}
+	apu.SetSampleTap(func(value float32) {
+		v.samples = append(v.samples, value)
+	})
+	s.video = v
+	s.OSD.SetIndicator("video_recording", "REC")
+	return v.path, nil
+}
+
+// StopVideoRecording finishes the recording. It returns the error
+// the recording stopped on, if any
+func (s *Session) StopVideoRecording() error {
+	v := s.video
+	if v == nil {
+		return nil
+	}
+	s.video = nil
+	s.Console.APU().SetSampleTap(nil)
+	s.OSD.SetIndicator("video_recording", "")
+	err := v.recorder.close()
+	if v.err != nil {
+		err = v.err
+	}
+	if err != nil {
+		s.OSD.Show("Video failed")
+		return err
+	}
+	s.OSD.Show("Video saved")
+	return nil
+}
+
+// RecordingVideo reports whether the video is recording
+func (s *Session) RecordingVideo() bool {
+	return s.video != nil
+}
+
+// recordFrame writes the last frame with the sound produced during it.
+// The sound is cut or padded to the samples of a frame, so the sound
+// and the picture stay in sync whatever the resampler produced
+func (s *Session) recordFrame() {
+	v := s.video
+	if v.err != nil {
+		return
+	}
+	v.debt += v.perFrame
+	n := int(v.debt)
+	v.debt -= float64(n)
+	samples := v.samples
+	if len(samples) > n*v.channels {
+		samples = samples[:n*v.channels]
+	}
+	for len(samples) < n*v.channels {
+		samples = append(samples, 0)
+	}
+	if err := v.recorder.writeFrame(s.Console.PPU().Frame(), samples); err != nil {
+		v.err = fmt.Errorf("couldn't record the video: %s", err)
+	}
+	v.samples = v.samples[:0]
+}
+
+// ffmpegRecorder pipes the raw frames into the stdin of ffmpeg
+// and the raw sound into its file descriptor 3
+type ffmpegRecorder struct {
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+	video  *pipeWriter
+	audio  *pipeWriter
+}
+
+func newFFmpegRecorder(command, path string, rate float64, sampleRate, channels int) (*ffmpegRecorder, error) {
+	audioR, audioW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create the pipe: %s", err)
+	}
+	defer audioR.Close()
+
+	r := &ffmpegRecorder{}
+	r.cmd = exec.Command(command, "-y", "-loglevel", "error",
+		"-f", "rawvideo", "-pixel_format", "rgba",
+		"-video_size", fmt.Sprintf("%dx%d", nes.FrameWidth, nes.FrameHeight),
+		"-framerate", strconv.FormatFloat(rate, 'f', -1, 64),
+		"-i", "pipe:0",
+		"-f", "f32le", "-ar", strconv.Itoa(sampleRate), "-ac", strconv.Itoa(channels),
+		"-i", "pipe:3",
+		"-pix_fmt", "yuv420p", path)
+	r.cmd.ExtraFiles = []*os.File{audioR}
+	r.cmd.Stderr = &r.stderr
+	stdin, err := r.cmd.StdinPipe()
+	if err != nil {
+		audioW.Close()
+		return nil, fmt.Errorf("couldn't create the pipe: %s", err)
+	}
+	if err := r.cmd.Start(); err != nil {
+		audioW.Close()
+		return nil, fmt.Errorf("couldn't start ffmpeg: %s", err)
+	}
+	r.video = newPipeWriter(stdin)
+	r.audio = newPipeWriter(audioW)
+	return r, nil
+}
+
+func (r *ffmpegRecorder) writeFrame(frame *image.RGBA, samples []float32) error {
+	if err := r.video.write(bytes.Clone(frame.Pix)); err != nil {
+		return err
+	}
+	return r.audio.write(appendFloat32LE(nil, samples))
+}
+
+func (r *ffmpegRecorder) close() error {
+	videoErr := r.video.close()
+	audioErr := r.audio.close()
+	if err := r.cmd.Wait(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %s: %s", err, strings.TrimSpace(r.stderr.String()))
+	}
+	if videoErr != nil {
+		return videoErr
+	}
+	return audioErr
+}
+
+// appendFloat32LE appends the samples as the little endian floats
+func appendFloat32LE(data []byte, samples []float32) []byte {
+	for _, v := range samples {
+		data = binary.LittleEndian.AppendUint32(data, math.Float32bits(v))
+	}
+	return data
+}
+
+// pipeWriter writes into the pipe on its own goroutine, so ffmpeg
+// reading one of its inputs doesn't block the writes of the other
+type pipeWriter struct {
+	data   chan []byte
+	done   chan struct{}
+	failed chan struct{} // closed on the first error
+	err    error
+}
+
+// pipeFrames is how many writes wait for the pipe
+const pipeFrames = 120
+
+func newPipeWriter(w io.WriteCloser) *pipeWriter {
+	p := &pipeWriter{
+		data:   make(chan []byte, pipeFrames),
+		done:   make(chan struct{}),
+		failed: make(chan struct{}),
+	}
+	go func() {
+		defer close(p.done)
+		for data := range p.data {
+			if p.err != nil {
+				continue
+			}
+			if _, err := w.Write(data); err != nil {
+				p.err = err
+				close(p.failed)
+			}
+		}
+		if err := w.Close(); err != nil && p.err == nil {
+			p.err = err
+		}
+	}()
+	return p
+}
+
+// write queues the data, it returns the error of a previous write
+func (p *pipeWriter) write(data []byte) error {
+	select {
+	case <-p.failed:
+		return fmt.Errorf("couldn't write into ffmpeg: %s", p.err)
+	default:
+	}
+	p.data <- data
+	return nil
+}
+
+func (p *pipeWriter) close() error {
+	close(p.data)
+	<-p.done
+	if p.err != nil {
+		return fmt.Errorf("couldn't write into ffmpeg: %s", p.err)
+	}
+	return nil
+}
+
+// y4mRecorder writes the frames into the Y4M file and the sound
+// into the WAV file next to it
+type y4mRecorder struct {
+	file  *os.File
+	w     *bufio.Writer
+	frame []byte // the Y, Cb and Cr planes
+
+	wavFile *os.File
+	wav     *audio.WAVWriter
+}
+
+func newY4MRecorder(path string, rate float64, sampleRate, channels int) (*y4mRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create the file: %s", err)
+	}
+	wavFile, err := os.Create(strings.TrimSuffix(path, filepath.Ext(path)) + ".wav")
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("couldn't create the file: %s", err)
+	}
+	wav, err := audio.NewWAVWriter(wavFile, sampleRate, channels)
+	if err != nil {
+		file.Close()
+		wavFile.Close()
+		return nil, err
+	}
+	r := &y4mRecorder{
+		file:    file,
+		w:       bufio.NewWriter(file),
+		frame:   make([]byte, 3*nes.FrameWidth*nes.FrameHeight),
+		wavFile: wavFile,
+		wav:     wav,
+	}
+	// the frame rate as a fraction, in thousandths
+	fmt.Fprintf(r.w, "YUV4MPEG2 W%d H%d F%d:1000 Ip A1:1 C444\n",
+		nes.FrameWidth, nes.FrameHeight, int(rate*1000+0.5))
+	return r, nil
+}
+
+func (r *y4mRecorder) writeFrame(frame *image.RGBA, samples []float32) error {
+	size := nes.FrameWidth * nes.FrameHeight
+	for i := 0; i < size; i++ {
+		p := frame.Pix[i*4 : i*4+3]
+		r.frame[i], r.frame[size+i], r.frame[2*size+i] = color.RGBToYCbCr(p[0], p[1], p[2])
+	}
+	r.w.WriteString("FRAME\n")
+	if _, err := r.w.Write(r.frame); err != nil {
+		return err
+	}
+	return r.wav.Write(samples)
+}
+
+func (r *y4mRecorder) close() error {
+	err := r.w.Flush()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	if werr := r.wav.Close(); err == nil {
+		err = werr
+	}
+	if cerr := r.wavFile.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't write the video: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package frontend
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Session_StartVideoRecording_Y4M(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := NewSession(console, "test.nes")
+	dir := t.TempDir()
+
+	path, err := s.StartVideoRecording(VideoOptions{Dir: dir, Format: "y4m"})
+	assert.NoError(t, err)
+	assert.True(t, s.RecordingVideo())
+	_, err = s.StartVideoRecording(VideoOptions{Dir: dir, Format: "y4m"})
+	assert.Error(t, err)
+
+	// the fast-forward records all the frames with their sound
+	s.RunFrame(HostInput{})
+	s.RunFast(HostInput{}, 2, true)
+	assert.NoError(t, s.StopVideoRecording())
+	assert.False(t, s.RecordingVideo())
+
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	header := "YUV4MPEG2 W256 H240 F60099:1000 Ip A1:1 C444\n"
+	assert.True(t, strings.HasPrefix(string(data), header))
+	frame := len("FRAME\n") + 3*nes.FrameWidth*nes.FrameHeight
+	assert.Equal(t, len(header)+3*frame, len(data))
+
+	// the sound is exactly the samples of the frames at the frame rate
+	wav, err := os.ReadFile(strings.TrimSuffix(path, ".y4m") + ".wav")
+	assert.NoError(t, err)
+	samples := int(3 * nes.DefaultSampleRate / nes.RegionNTSC.FrameRate())
+	assert.Equal(t, 44+samples*2, len(wav))
+}
+
+func Test_Session_StartVideoRecording_FFmpeg(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the sound pipe needs the file descriptor 3")
+	}
+	// the fake ffmpeg saves its inputs next to the output
+	dir := t.TempDir()
+	ffmpeg := filepath.Join(dir, "ffmpeg")
+	script := "#!/bin/sh\nfor out; do :; done\ncat > \"$out.video\"\ncat <&3 > \"$out.audio\"\n"
+	assert.NoError(t, os.WriteFile(ffmpeg, []byte(script), 0o755))
+
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := NewSession(console, "test.nes")
+	path, err := s.StartVideoRecording(VideoOptions{Dir: dir, Format: "mp4", FFmpeg: ffmpeg})
+	assert.NoError(t, err)
+	assert.Equal(t, ".mp4", filepath.Ext(path))
+	for i := 0; i < 2; i++ {
+		s.RunFrame(HostInput{})
+	}
+	assert.NoError(t, s.StopVideoRecording())
+
+	video, err := os.ReadFile(path + ".video")
+	assert.NoError(t, err)
+	assert.Equal(t, 2*4*nes.FrameWidth*nes.FrameHeight, len(video))
+	assert.Equal(t, s.Frame().Pix, video[len(video)/2:])
+	sound, err := os.ReadFile(path + ".audio")
+	assert.NoError(t, err)
+	samples := int(2 * nes.DefaultSampleRate / nes.RegionNTSC.FrameRate())
+	assert.Equal(t, samples*4, len(sound))
+}
+
+func Test_Session_StartVideoRecording_Errors(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := NewSession(console, "test.nes")
+	dir := t.TempDir()
+
+	_, err := s.StartVideoRecording(VideoOptions{Dir: dir, Format: "avi"})
+	assert.Error(t, err)
+	_, err = s.StartVideoRecording(VideoOptions{Dir: dir, FFmpeg: filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+	assert.False(t, s.RecordingVideo())
+	assert.NoError(t, s.StopVideoRecording(), "nothing to stop")
+}
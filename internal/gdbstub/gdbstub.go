@@ -0,0 +1,488 @@
+// Package gdbstub serves the debugger over the GDB remote serial protocol,
+// the way gdbserver does, so the gdb front-ends and the IDEs speaking the
+// protocol debug the games. The 6502 has the registers a, x, y, p, sp and pc,
+// the target description tells the client about them:
+//
+//	(gdb) target remote localhost:2345
+//
+// The stub reads and writes the registers and the CPU memory, sets the
+// breakpoints and the watchpoints, and steps and continues the console.
+package gdbstub
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nevisdale/nestic/internal/debugger"
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// targetXML describes the registers, g and G send them in this order
+const targetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.nestic.6502">
+    <reg name="a" bitsize="8" type="uint8" regnum="0"/>
+    <reg name="x" bitsize="8" type="uint8"/>
+    <reg name="y" bitsize="8" type="uint8"/>
+    <reg name="p" bitsize="8" type="uint8"/>
+    <reg name="sp" bitsize="8" type="uint8"/>
+    <reg name="pc" bitsize="16" type="code_ptr"/>
+  </feature>
+</target>
+`
+
+// the signals of the stop replies
+const (
+	sigint  = 0x02 // the console was paused
+	sigtrap = 0x05 // a breakpoint, a step or an event
+)
+
+// Server is the GDB stub of the debugger, it serves a client at a time
+type Server struct {
+	debugger *debugger.Debugger
+	listener net.Listener
+
+	mu     sync.Mutex
+	conn   net.Conn // the client being served, nil: none
+	closed bool
+}
+
+// Listen returns the stub of the debugger listening at the TCP address,
+// e.g. localhost:2345. Serve serves the clients
+func Listen(addr string, d *debugger.Debugger) (*Server, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't listen for gdb: %s", err)
+	}
+	return &Server{debugger: d, listener: l}, nil
+}
+
+// Addr returns the address the stub listens at
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Serve serves the clients one by one until Close
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return fmt.Errorf("couldn't accept the gdb client: %s", err)
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conn = conn
+		s.mu.Unlock()
+
+		newSession(s.debugger, conn).serve()
+
+		s.mu.Lock()
+		s.conn = nil
+		s.mu.Unlock()
+	}
+}
+
+// Close stops listening and disconnects the client,
+// the console resumes
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	return s.listener.Close()
+}
+
+// session is the connection of a client
+type session struct {
+	debugger *debugger.Debugger
+	conn     net.Conn
+	noAck    atomic.Bool // QStartNoAckMode: the packets aren't acknowledged
+	packets  chan string
+	stops    <-chan debugger.Stop
+
+	// the breakpoints of the client by the Z packets, e.g. "2,10,1",
+	// the IDs of the debugger
+	breakpoints map[string]int
+	// the stop reasons of the breakpoints: swbreak, hwbreak,
+	// watch, rwatch or awatch
+	reasons map[int]string
+	swbreak bool // the client knows the swbreak stop reason
+	hwbreak bool // the client knows the hwbreak stop reason
+	running bool // a stop is on its way
+}
+
+func newSession(d *debugger.Debugger, conn net.Conn) *session {
+	return &session{
+		debugger:    d,
+		conn:        conn,
+		packets:     make(chan string),
+		breakpoints: map[string]int{},
+		reasons:     map[int]string{},
+	}
+}
+
+// serve answers the packets of the client until it detaches or disconnects,
+// then removes its breakpoints and resumes the console
+func (s *session) serve() {
+	stops, unsubscribe := s.debugger.Subscribe()
+	s.stops = stops
+	defer func() {
+		unsubscribe()
+		for _, id := range s.breakpoints {
+			s.debugger.RemoveBreakpoint(id)
+		}
+		s.debugger.Resume()
+		s.conn.Close()
+	}()
+	go readPackets(s.conn, s.conn, func() bool { return !s.noAck.Load() }, s.packets)
+
+	// the console stops for the client, it asks why with ?
+	s.running = !s.debugger.Paused()
+	s.debugger.Pause()
+	for packet := range s.packets {
+		if packet == interrupt {
+			s.debugger.Pause()
+			continue
+		}
+		reply, ok := s.handle(packet)
+		if !ok {
+			return
+		}
+		if err := writePacket(s.conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// handle answers the packet, false: the session ends
+func (s *session) handle(packet string) (string, bool) {
+	if packet == "" {
+		return "", true
+	}
+	cmd, args := packet[:1], packet[1:]
+	switch cmd {
+	case "?":
+		return s.waitStop()
+	case "g":
+		r := s.debugger.Registers()
+		return fmt.Sprintf("%02x%02x%02x%02x%02x%02x%02x", r.A, r.X, r.Y, r.P, r.SP, uint8(r.PC), uint8(r.PC>>8)), true
+	case "G":
+		return s.setRegisters(args), true
+	case "p":
+		n, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || n > 5 {
+			return "E01", true
+		}
+		r := s.debugger.Registers()
+		values := []uint8{r.A, r.X, r.Y, r.P, r.SP}
+		if n == 5 {
+			return fmt.Sprintf("%02x%02x", uint8(r.PC), uint8(r.PC>>8)), true
+		}
+		return fmt.Sprintf("%02x", values[n]), true
+	case "P":
+		return s.setRegister(args), true
+	case "m":
+		addr, n, err := parseRange(args)
+		if err != nil {
+			return "E01", true
+		}
+		return hex.EncodeToString(s.debugger.ReadMemory(addr, n)), true
+	case "M", "X":
+		return s.writeMemory(args, cmd == "X"), true
+	case "Z", "z":
+		return s.breakpoint(args, cmd == "Z"), true
+	case "c", "C":
+		return s.resume(false)
+	case "s", "S":
+		return s.resume(true)
+	case "v":
+		return s.handleV(args)
+	case "q", "Q":
+		return s.query(packet), true
+	case "H", "T":
+		// the console has a thread
+		return "OK", true
+	case "D":
+		writePacket(s.conn, "OK")
+		return "", false
+	case "k":
+		return "", false
+	}
+	return "", true
+}
+
+func (s *session) handleV(args string) (string, bool) {
+	switch {
+	case args == "Cont?":
+		return "vCont;c;C;s;S", true
+	case strings.HasPrefix(args, "Cont;"):
+		action := strings.TrimPrefix(args, "Cont;")
+		if action == "" {
+			return "E01", true
+		}
+		return s.resume(action[0] == 's' || action[0] == 'S')
+	}
+	// vMustReplyEmpty and the rest aren't supported
+	return "", true
+}
+
+func (s *session) query(packet string) string {
+	name, args, _ := strings.Cut(packet, ":")
+	switch name {
+	case "qSupported":
+		for _, feature := range strings.Split(args, ";") {
+			s.swbreak = s.swbreak || feature == "swbreak+"
+			s.hwbreak = s.hwbreak || feature == "hwbreak+"
+		}
+		return "PacketSize=4000;qXfer:features:read+;QStartNoAckMode+;swbreak+;hwbreak+"
+	case "QStartNoAckMode":
+		// the packet is acknowledged already, the ones after it aren't
+		s.noAck.Store(true)
+		return "OK"
+	case "qXfer":
+		return readTargetXML(args)
+	case "qAttached":
+		return "1"
+	case "qC":
+		return "QC1"
+	case "qfThreadInfo":
+		return "m1"
+	case "qsThreadInfo":
+		return "l"
+	}
+	return ""
+}
+
+// readTargetXML reads the part of the target description,
+// features:read:target.xml:offset,length
+func readTargetXML(args string) string {
+	annex, rest, ok := strings.Cut(strings.TrimPrefix(args, "features:read:"), ":")
+	if !ok || annex != "target.xml" {
+		return "E00"
+	}
+	offset, length, ok := strings.Cut(rest, ",")
+	start, err1 := strconv.ParseUint(offset, 16, 32)
+	n, err2 := strconv.ParseUint(length, 16, 32)
+	if !ok || err1 != nil || err2 != nil {
+		return "E01"
+	}
+	if start >= uint64(len(targetXML)) {
+		return "l"
+	}
+	end := min(start+n, uint64(len(targetXML)))
+	if end == uint64(len(targetXML)) {
+		return "l" + targetXML[start:end]
+	}
+	return "m" + targetXML[start:end]
+}
+
+// resume continues or steps the console and waits for it to stop
+func (s *session) resume(step bool) (string, bool) {
+	// the stops before the resume are old news
+	for len(s.stops) > 0 {
+		<-s.stops
+	}
+	if step {
+		if err := s.debugger.StepInto(); err != nil {
+			return "E01", true
+		}
+	} else {
+		s.debugger.Resume()
+	}
+	s.running = true
+	return s.waitStop()
+}
+
+// waitStop returns the stop reply of the stopped console, it waits for the
+// running console to stop. Ctrl-C pauses it
+func (s *session) waitStop() (string, bool) {
+	for s.running {
+		select {
+		case stop := <-s.stops:
+			s.running = false
+			return s.stopReply(stop), true
+		case packet, ok := <-s.packets:
+			if !ok {
+				return "", false
+			}
+			if packet == interrupt {
+				s.debugger.Pause()
+			}
+		}
+	}
+	paused, stop := s.debugger.State()
+	if !paused || stop == nil {
+		return fmt.Sprintf("S%02x", sigint), true
+	}
+	return s.stopReply(*stop), true
+}
+
+// stopReply returns the T packet of the stop
+func (s *session) stopReply(stop debugger.Stop) string {
+	switch stop.Reason {
+	case debugger.StopPause:
+		return fmt.Sprintf("T%02x", sigint)
+	case debugger.StopBreakpoint:
+		if reason := s.reasons[stop.Breakpoint]; reason == "swbreak" && s.swbreak || reason == "hwbreak" && s.hwbreak {
+			return fmt.Sprintf("T%02x%s:;", sigtrap, reason)
+		}
+	case debugger.StopWatchpoint:
+		kind, ok := s.reasons[stop.Breakpoint]
+		if !ok {
+			kind = "rwatch"
+			if stop.Write {
+				kind = "watch"
+			}
+		}
+		return fmt.Sprintf("T%02x%s:%x;", sigtrap, kind, stop.Addr)
+	}
+	return fmt.Sprintf("T%02x", sigtrap)
+}
+
+func (s *session) setRegisters(args string) string {
+	var v [7]uint8
+	if len(args) != 2*len(v) {
+		return "E01"
+	}
+	for i := range v {
+		n, err := strconv.ParseUint(args[2*i:2*i+2], 16, 8)
+		if err != nil {
+			return "E01"
+		}
+		v[i] = uint8(n)
+	}
+	r := s.debugger.Registers()
+	r.A, r.X, r.Y, r.P, r.SP, r.PC = v[0], v[1], v[2], v[3], v[4], uint16(v[5])|uint16(v[6])<<8
+	return errorReply(s.debugger.SetRegisters(r))
+}
+
+// setRegister sets the register by P n=value, the value is little-endian
+func (s *session) setRegister(args string) string {
+	num, value, ok := strings.Cut(args, "=")
+	n, err1 := strconv.ParseUint(num, 16, 8)
+	if !ok || err1 != nil || n > 5 || len(value)%2 != 0 || len(value) == 0 {
+		return "E01"
+	}
+	var v uint16
+	for i := len(value) - 2; i >= 0; i -= 2 {
+		b, err := strconv.ParseUint(value[i:i+2], 16, 8)
+		if err != nil {
+			return "E01"
+		}
+		v = v<<8 | uint16(b)
+	}
+	r := s.debugger.Registers()
+	switch n {
+	case 0:
+		r.A = uint8(v)
+	case 1:
+		r.X = uint8(v)
+	case 2:
+		r.Y = uint8(v)
+	case 3:
+		r.P = uint8(v)
+	case 4:
+		r.SP = uint8(v)
+	case 5:
+		r.PC = v
+	}
+	return errorReply(s.debugger.SetRegisters(r))
+}
+
+// writeMemory writes the memory by M addr,length:hex or X addr,length:binary
+func (s *session) writeMemory(args string, binary bool) string {
+	spec, data, ok := strings.Cut(args, ":")
+	addr, n, err := parseRange(spec)
+	if !ok || err != nil {
+		return "E01"
+	}
+	bytes := []uint8(data)
+	if !binary {
+		if bytes, err = hex.DecodeString(data); err != nil {
+			return "E01"
+		}
+	}
+	if len(bytes) != n {
+		return "E01"
+	}
+	if n == 0 {
+		return "OK"
+	}
+	return errorReply(s.debugger.Poke(nes.MemoryCPU, int(addr), bytes))
+}
+
+// breakpoint sets or removes the breakpoint by Z type,addr,kind:
+// 0 and 1 break on the execution, 2 on the write, 3 on the read
+// and 4 on both
+func (s *session) breakpoint(args string, set bool) string {
+	parts := strings.Split(args, ",")
+	if len(parts) < 3 {
+		return "E01"
+	}
+	kind, err1 := strconv.Atoi(parts[0])
+	addr, err2 := strconv.ParseUint(parts[1], 16, 16)
+	size, err3 := strconv.ParseUint(parts[2], 16, 16)
+	if err1 != nil || err2 != nil || err3 != nil || kind < 0 || kind > 4 {
+		return ""
+	}
+	key := strings.Join(parts[:3], ",")
+	if !set {
+		id, ok := s.breakpoints[key]
+		if !ok {
+			return "E01"
+		}
+		delete(s.breakpoints, key)
+		delete(s.reasons, id)
+		return errorReply(s.debugger.RemoveBreakpoint(id))
+	}
+	if _, ok := s.breakpoints[key]; ok {
+		return "OK"
+	}
+	var id int
+	if kind <= 1 {
+		id = s.debugger.AddBreakpoint(uint16(addr))
+	} else {
+		access := []debugger.Access{2: debugger.Write, 3: debugger.Read, 4: debugger.Read | debugger.Write}[kind]
+		id = s.debugger.AddWatchpoint(uint16(addr), uint16(addr)+uint16(max(size, 1))-1, access)
+	}
+	s.breakpoints[key] = id
+	s.reasons[id] = []string{"swbreak", "hwbreak", "watch", "rwatch", "awatch"}[kind]
+	return "OK"
+}
+
+// parseRange parses addr,length of the CPU memory
+func parseRange(s string) (uint16, int, error) {
+	a, n, ok := strings.Cut(s, ",")
+	addr, err1 := strconv.ParseUint(a, 16, 16)
+	length, err2 := strconv.ParseUint(n, 16, 32)
+	if !ok || err1 != nil || err2 != nil || addr+length > 0x10000 {
+		return 0, 0, errors.New("invalid memory range")
+	}
+	return uint16(addr), int(length), nil
+}
+
+func errorReply(err error) string {
+	if err != nil {
+		return "E01"
+	}
+	return "OK"
+}
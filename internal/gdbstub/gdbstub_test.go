@@ -0,0 +1,149 @@
+package gdbstub
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nevisdale/nestic/internal/debugger"
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startStub serves the debugger of the console running its frames
+// the way the frontends do, and returns the client connected to it
+func startStub(t *testing.T) (*debugger.Debugger, *client) {
+	console := nestest.NewConsole(t, nestest.LoopROM())
+	d := debugger.New(console)
+	server, err := Listen("127.0.0.1:0", d)
+	require.NoError(t, err)
+	go server.Serve()
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if !d.BeginFrame() {
+				time.Sleep(time.Millisecond)
+				continue
+			}
+			console.RunFrame()
+			d.EndFrame()
+		}
+	}()
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	require.NoError(t, err)
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	t.Cleanup(func() {
+		conn.Close()
+		server.Close()
+		close(done)
+	})
+	return d, &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// send sends the packet and returns the reply
+func (c *client) send(packet string) string {
+	fmt.Fprintf(c.conn, "$%s#%02x", packet, checksum([]byte(packet)))
+	ack, err := c.r.ReadByte()
+	require.NoError(c.t, err)
+	require.Equal(c.t, byte('+'), ack)
+	return c.reply()
+}
+
+func (c *client) reply() string {
+	_, err := c.r.ReadString('$')
+	require.NoError(c.t, err)
+	data, err := c.r.ReadString('#')
+	require.NoError(c.t, err)
+	sum := make([]byte, 2)
+	_, err = c.r.Read(sum)
+	require.NoError(c.t, err)
+	data = strings.TrimSuffix(data, "#")
+	assert.Equal(c.t, fmt.Sprintf("%02x", checksum([]byte(data))), string(sum))
+	c.conn.Write([]byte("+"))
+	return string(unescape([]byte(data)))
+}
+
+func Test_Server(t *testing.T) {
+	d, c := startStub(t)
+
+	assert.Contains(t, c.send("qSupported:multiprocess+;swbreak+;hwbreak+"), "qXfer:features:read+")
+	assert.Equal(t, "T02", c.send("?"), "the console is paused for the client")
+	assert.True(t, d.Paused())
+
+	xml := c.send("qXfer:features:read:target.xml:0,40")
+	assert.Equal(t, "m"+targetXML[:0x40], xml)
+	assert.Equal(t, "l", c.send(fmt.Sprintf("qXfer:features:read:target.xml:%x,40", len(targetXML))))
+
+	r := d.Registers()
+	assert.Equal(t, fmt.Sprintf("%02x%02x%02x%02x%02x%02x%02x", r.A, r.X, r.Y, r.P, r.SP, uint8(r.PC), r.PC>>8), c.send("g"))
+	assert.Equal(t, "OK", c.send("P0=42"))
+	assert.Equal(t, "42", c.send("p0"))
+	assert.Equal(t, "OK", c.send("M0300,3:a1b2c3"))
+	assert.Equal(t, "a1b2c3", c.send("m0300,3"))
+	assert.Equal(t, "E01", c.send("mffff,2"))
+
+	assert.Equal(t, "OK", c.send("Z0,8010,1"))
+	assert.Equal(t, "T05swbreak:;", c.send("c"))
+	assert.Equal(t, uint16(0x8010), d.Registers().PC)
+	assert.Equal(t, "1080", c.send("p5"))
+	assert.Equal(t, "OK", c.send("z0,8010,1"))
+	assert.Empty(t, d.Breakpoints())
+
+	assert.Equal(t, "T05", c.send("vCont;s:1"))
+	assert.Equal(t, uint16(0x8012), d.Registers().PC, "INC $11 ran")
+
+	assert.Equal(t, "OK", c.send("Z2,11,1"))
+	assert.Equal(t, "T05watch:11;", c.send("c"))
+	assert.Equal(t, "OK", c.send("z2,11,1"))
+
+	// Ctrl-C pauses the running console
+	fmt.Fprintf(c.conn, "$c#%02x", 'c')
+	_, err := c.r.ReadByte()
+	require.NoError(t, err)
+	c.conn.Write([]byte{0x03})
+	assert.Equal(t, "T02", c.reply())
+
+	assert.Equal(t, "OK", c.send("Z4,10,1"))
+	assert.Equal(t, "OK", c.send("D"))
+	_, err = c.r.ReadByte()
+	assert.Error(t, err, "the stub disconnects")
+	assert.Eventually(t, func() bool { return !d.Paused() && len(d.Breakpoints()) == 0 }, time.Second, time.Millisecond,
+		"the console resumes without the breakpoints of the client")
+}
+
+func Test_Server_InvalidBreakpoint(t *testing.T) {
+	d, c := startStub(t)
+	assert.Equal(t, "", c.send("Z-1,8000,1"), "the kind isn't supported")
+	assert.Equal(t, "", c.send("z-1,8000,1"))
+	assert.Equal(t, "", c.send("Z5,8000,1"))
+	assert.Empty(t, d.Breakpoints())
+	assert.Equal(t, "OK", c.send("Z0,8000,1"), "the stub still serves the client")
+}
+
+func Test_Server_NoAck(t *testing.T) {
+	_, c := startStub(t)
+	assert.Equal(t, "OK", c.send("QStartNoAckMode"))
+	fmt.Fprintf(c.conn, "$qAttached#%02x", checksum([]byte("qAttached")))
+	assert.Equal(t, "1", c.reply())
+	c.conn.Write([]byte("$g#00"))
+	fmt.Fprintf(c.conn, "$vMustReplyEmpty#%02x", checksum([]byte("vMustReplyEmpty")))
+	c.reply() // the reply of g, the checksum isn't checked
+	assert.Equal(t, "", c.reply())
+}
@@ -0,0 +1,90 @@
+package gdbstub
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// interrupt is the Ctrl-C the client sends while the console runs,
+// it comes from readPackets as a packet of its own
+const interrupt = "\x03"
+
+// readPackets reads the packets of the client, $data#checksum, and sends
+// their data to the channel. The packets with the wrong checksum are asked
+// for again. The channel is closed when the connection is
+func readPackets(r io.Reader, w io.Writer, ack func() bool, packets chan<- string) {
+	defer close(packets)
+	br := bufio.NewReader(r)
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return
+		}
+		switch c {
+		case '$':
+		case 0x03:
+			packets <- interrupt
+			continue
+		default:
+			// the acks of the replies and the noise between the packets
+			continue
+		}
+		data, err := br.ReadBytes('#')
+		if err != nil {
+			return
+		}
+		data = data[:len(data)-1]
+		var sum [2]byte
+		if _, err := io.ReadFull(br, sum[:]); err != nil {
+			return
+		}
+		if ack() {
+			want, err := strconv.ParseUint(string(sum[:]), 16, 8)
+			if err != nil || uint8(want) != checksum(data) {
+				w.Write([]byte("-"))
+				continue
+			}
+			w.Write([]byte("+"))
+		}
+		packets <- string(unescape(data))
+	}
+}
+
+// unescape decodes the escaped bytes of the binary data, }X is X^0x20
+func unescape(data []byte) []byte {
+	out := data[:0]
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			out = append(out, data[i]^0x20)
+			continue
+		}
+		out = append(out, data[i])
+	}
+	return out
+}
+
+// writePacket writes the reply packet, the special bytes of the data escaped
+func writePacket(w io.Writer, data string) error {
+	escaped := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		switch c := data[i]; c {
+		case '#', '$', '}', '*':
+			escaped = append(escaped, '}', c^0x20)
+		default:
+			escaped = append(escaped, c)
+		}
+	}
+	_, err := fmt.Fprintf(w, "$%s#%02x", escaped, checksum(escaped))
+	return err
+}
+
+func checksum(data []byte) uint8 {
+	var sum uint8
+	for _, c := range data {
+		sum += c
+	}
+	return sum
+}
@@ -0,0 +1,262 @@
+package input
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"gopkg.in/yaml.v3"
+)
+
+// PadState is the state of the gamepad buttons and axes
+type PadState struct {
+	Buttons []bool
+	Axes    []float64 // -1..1
+}
+
+// Pad is a connected gamepad
+type Pad struct {
+	ID   string // stable while the pad is connected, e.g. the device path
+	Name string // the model name the pad reports
+	PadState
+}
+
+// AxisBinding presses the button when the axis is pushed past the dead zone
+// in the direction
+type AxisBinding struct {
+	Axis     int
+	Negative bool
+	Button   nes.Button
+}
+
+// GamepadMapping maps the pad buttons and axes to the controller buttons
+type GamepadMapping struct {
+	Buttons  map[int]nes.Button
+	Turbo    map[int]nes.Button // the buttons toggle while the pad button is held
+	Axes     []AxisBinding
+	Deadzone float64
+}
+
+// DefaultGamepadMapping maps the common layout of the pads: the right
+// face buttons are B and A, the left and the top ones are the turbo B and A,
+// back and start are select and start,
+// the left stick and the d-pad (hat axes 6 and 7) are the directions
+func DefaultGamepadMapping() GamepadMapping {
+	return GamepadMapping{
+		Buttons: map[int]nes.Button{
+			0: nes.ButtonB,
+			1: nes.ButtonA,
+			6: nes.ButtonSelect,
+			7: nes.ButtonStart,
+		},
+		Turbo: map[int]nes.Button{
+			2: nes.ButtonB,
+			3: nes.ButtonA,
+		},
+		Axes: []AxisBinding{
+			{Axis: 0, Negative: true, Button: nes.ButtonLeft},
+			{Axis: 0, Button: nes.ButtonRight},
+			{Axis: 1, Negative: true, Button: nes.ButtonUp},
+			{Axis: 1, Button: nes.ButtonDown},
+			{Axis: 6, Negative: true, Button: nes.ButtonLeft},
+			{Axis: 6, Button: nes.ButtonRight},
+			{Axis: 7, Negative: true, Button: nes.ButtonUp},
+			{Axis: 7, Button: nes.ButtonDown},
+		},
+		Deadzone: 0.5,
+	}
+}
+
+// Pressed returns the controller buttons pressed on the pad
+func (m GamepadMapping) Pressed(s PadState) nes.Button {
+	var buttons nes.Button
+	for i, pressed := range s.Buttons {
+		if pressed {
+			buttons |= m.Buttons[i]
+		}
+	}
+	for _, b := range m.Axes {
+		if b.Axis >= len(s.Axes) {
+			continue
+		}
+		value := s.Axes[b.Axis]
+		if b.Negative {
+			value = -value
+		}
+		if value > m.Deadzone {
+			buttons |= b.Button
+		}
+	}
+	return buttons
+}
+
+// TurboPressed returns the turbo buttons held on the pad
+func (m GamepadMapping) TurboPressed(s PadState) nes.Button {
+	var buttons nes.Button
+	for i, pressed := range s.Buttons {
+		if pressed {
+			buttons |= m.Turbo[i]
+		}
+	}
+	return buttons
+}
+
+// GamepadConfig holds the mappings of the pads.
+// A game profile overrides the mapping of a pad model for the game,
+// the model mapping overrides the default one
+type GamepadConfig struct {
+	Default GamepadMapping
+	Pads    map[string]GamepadMapping            // by the pad name
+	Games   map[string]map[string]GamepadMapping // by the game, then by the pad name
+}
+
+// DefaultGamepadConfig maps all the pads with the default mapping
+func DefaultGamepadConfig() *GamepadConfig {
+	return &GamepadConfig{Default: DefaultGamepadMapping()}
+}
+
+// Mapping returns the mapping of the pad model for the game
+func (c *GamepadConfig) Mapping(game, pad string) GamepadMapping {
+	if m, ok := c.Games[game][pad]; ok {
+		return m
+	}
+	if m, ok := c.Pads[pad]; ok {
+		return m
+	}
+	return c.Default
+}
+
+// Buttons returns the buttons of the controllers.
+// The first connected pad is the first controller, the second pad is the second one
+// and so on, the controllers 3 and 4 are plugged into the Four Score
+func (c *GamepadConfig) Buttons(game string, pads []Pad) [Ports]nes.Button {
+	var buttons [Ports]nes.Button
+	for port := 0; port < len(pads) && port < Ports; port++ {
+		buttons[port] = c.Mapping(game, pads[port].Name).Pressed(pads[port].PadState)
+	}
+	return buttons
+}
+
+// TurboButtons returns the turbo buttons held on the pads of the controllers
+func (c *GamepadConfig) TurboButtons(game string, pads []Pad) [Ports]nes.Button {
+	var buttons [Ports]nes.Button
+	for port := 0; port < len(pads) && port < Ports; port++ {
+		buttons[port] = c.Mapping(game, pads[port].Name).TurboPressed(pads[port].PadState)
+	}
+	return buttons
+}
+
+// gamepadMappingFile is the mapping as it is stored: the pad buttons
+// and the signed axes of every controller button
+//
+//	buttons: {a: 1, b: 0, start: 7, turbo_a: 3}
+//	axes: {left: [-0, -6], right: [+0, +6]}
+//	deadzone: 0.5
+type gamepadMappingFile struct {
+	Buttons  map[string]keyList `yaml:"buttons"`
+	Axes     map[string]keyList `yaml:"axes"`
+	Deadzone float64            `yaml:"deadzone"`
+}
+
+// gamepadConfigFile is the gamepad config as it is stored
+//
+//	default: {...}
+//	pads:
+//	  Xbox Controller: {...}
+//	games:
+//	  smb.nes:
+//	    Xbox Controller: {...}
+type gamepadConfigFile struct {
+	Default *gamepadMappingFile                      `yaml:"default"`
+	Pads    map[string]gamepadMappingFile            `yaml:"pads"`
+	Games   map[string]map[string]gamepadMappingFile `yaml:"games"`
+}
+
+// LoadGamepadConfig reads the gamepad config file
+func LoadGamepadConfig(path string) (*GamepadConfig, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open the file: %s", err)
+	}
+	defer file.Close()
+	return ReadGamepadConfig(file)
+}
+
+// ReadGamepadConfig reads the gamepad config from r.
+// The mappings missing in the config are the default ones
+func ReadGamepadConfig(r io.Reader) (*GamepadConfig, error) {
+	var f gamepadConfigFile
+	if err := yaml.NewDecoder(r).Decode(&f); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("couldn't decode the gamepad config: %s", err)
+	}
+
+	c := DefaultGamepadConfig()
+	var err error
+	if f.Default != nil {
+		if c.Default, err = f.Default.mapping(); err != nil {
+			return nil, fmt.Errorf("default: %s", err)
+		}
+	}
+	if len(f.Pads) > 0 {
+		c.Pads = map[string]GamepadMapping{}
+	}
+	for pad, m := range f.Pads {
+		if c.Pads[pad], err = m.mapping(); err != nil {
+			return nil, fmt.Errorf("%s: %s", pad, err)
+		}
+	}
+	if len(f.Games) > 0 {
+		c.Games = map[string]map[string]GamepadMapping{}
+	}
+	for game, pads := range f.Games {
+		c.Games[game] = map[string]GamepadMapping{}
+		for pad, m := range pads {
+			if c.Games[game][pad], err = m.mapping(); err != nil {
+				return nil, fmt.Errorf("%s: %s: %s", game, pad, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+func (f gamepadMappingFile) mapping() (GamepadMapping, error) {
+	m := GamepadMapping{Buttons: map[int]nes.Button{}, Turbo: map[int]nes.Button{}, Deadzone: f.Deadzone}
+	if m.Deadzone == 0 {
+		m.Deadzone = DefaultGamepadMapping().Deadzone
+	}
+	for name, indexes := range f.Buttons {
+		button, turbo, err := parseMappedButton(name)
+		if err != nil {
+			return m, err
+		}
+		buttons := m.Buttons
+		if turbo {
+			buttons = m.Turbo
+		}
+		for _, index := range indexes {
+			i, err := strconv.Atoi(index)
+			if err != nil {
+				return m, fmt.Errorf("invalid pad button %q", index)
+			}
+			buttons[i] |= button
+		}
+	}
+	for name, axes := range f.Axes {
+		button, err := nes.ParseButton(name)
+		if err != nil {
+			return m, err
+		}
+		for _, axis := range axes {
+			b := AxisBinding{Button: button, Negative: strings.HasPrefix(axis, "-")}
+			b.Axis, err = strconv.Atoi(strings.TrimLeft(axis, "+-"))
+			if err != nil {
+				return m, fmt.Errorf("invalid pad axis %q", axis)
+			}
+			m.Axes = append(m.Axes, b)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,44 @@
+package input
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GamepadMapping_Pressed(t *testing.T) {
+	m := DefaultGamepadMapping()
+	state := PadState{
+		Buttons: []bool{true, false, false, false, false, false, false, true},
+		Axes:    []float64{-0.9, 0.3, 0, 0, 0, 0, 0, 1},
+	}
+	assert.Equal(t, nes.ButtonB|nes.ButtonStart|nes.ButtonLeft|nes.ButtonDown, m.Pressed(state))
+	assert.Equal(t, nes.Button(0), m.Pressed(PadState{}))
+}
+
+func Test_GamepadConfig(t *testing.T) {
+	c, err := ReadGamepadConfig(strings.NewReader(`
+pads:
+  Old Pad:
+    buttons: {a: 2, b: [3, 4]}
+    axes: {left: -0, right: "+0"}
+games:
+  smb.nes:
+    Old Pad:
+      buttons: {a: 5}
+`))
+	assert.NoError(t, err)
+
+	pads := []Pad{
+		{Name: "Old Pad", PadState: PadState{Buttons: []bool{false, false, true, false, true, true}, Axes: []float64{1}}},
+		{Name: "New Pad", PadState: PadState{Buttons: []bool{false, true}}},
+		{Name: "Third Pad", PadState: PadState{Buttons: []bool{true}}},
+	}
+	assert.Equal(t, [Ports]nes.Button{nes.ButtonA | nes.ButtonB | nes.ButtonRight, nes.ButtonA, nes.ButtonB}, c.Buttons("zelda.nes", pads))
+	assert.Equal(t, [Ports]nes.Button{nes.ButtonA, nes.ButtonA, nes.ButtonB}, c.Buttons("smb.nes", pads), "the game profile")
+
+	_, err = ReadGamepadConfig(strings.NewReader("default:\n  axes: {up: -y}\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,172 @@
+//go:build linux
+
+package input
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// jsEvent is struct js_event of linux/joystick.h
+type jsEvent struct {
+	Time   uint32
+	Value  int16
+	Type   uint8
+	Number uint8
+}
+
+const (
+	jsEventButton = 0x01
+	jsEventAxis   = 0x02
+	jsEventInit   = 0x80 // the initial state of the device
+
+	joystickRescan = time.Second
+)
+
+// Joysticks reads the gamepads through the Linux joystick API,
+// the /dev/input/js* devices. The devices are rescanned at most once
+// a second, so the pads can be plugged in and out at any time
+type Joysticks struct {
+	mu       sync.Mutex
+	pads     map[string]*Pad // by the device path
+	order    []string        // the device paths in the connection order
+	files    map[string]*os.File
+	lastScan time.Time
+}
+
+// OpenJoysticks opens the connected joysticks
+func OpenJoysticks() *Joysticks {
+	j := &Joysticks{pads: map[string]*Pad{}, files: map[string]*os.File{}}
+	j.mu.Lock()
+	j.scan()
+	j.mu.Unlock()
+	return j
+}
+
+// Pads returns the connected pads in the order they were connected
+func (j *Joysticks) Pads() []Pad {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if time.Since(j.lastScan) >= joystickRescan {
+		j.scan()
+	}
+	pads := make([]Pad, 0, len(j.order))
+	for _, path := range j.order {
+		p := j.pads[path]
+		pads = append(pads, Pad{
+			ID:   p.ID,
+			Name: p.Name,
+			PadState: PadState{
+				Buttons: append([]bool(nil), p.Buttons...),
+				Axes:    append([]float64(nil), p.Axes...),
+			},
+		})
+	}
+	return pads
+}
+
+// Close closes the devices
+func (j *Joysticks) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for path, file := range j.files {
+		file.Close()
+		j.remove(path)
+	}
+	return nil
+}
+
+// scan opens the devices connected since the last scan
+func (j *Joysticks) scan() {
+	j.lastScan = time.Now()
+	paths, _ := filepath.Glob("/dev/input/js*")
+	for _, path := range paths {
+		if _, ok := j.pads[path]; ok {
+			continue
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		j.pads[path] = &Pad{ID: path, Name: joystickName(file)}
+		j.files[path] = file
+		j.order = append(j.order, path)
+		go j.read(path, file)
+	}
+}
+
+// read updates the pad state until the device is disconnected
+func (j *Joysticks) read(path string, file *os.File) {
+	var e jsEvent
+	for {
+		if err := binary.Read(file, binary.LittleEndian, &e); err != nil {
+			j.mu.Lock()
+			if j.files[path] == file {
+				file.Close()
+				j.remove(path)
+			}
+			j.mu.Unlock()
+			return
+		}
+
+		j.mu.Lock()
+		p := j.pads[path]
+		if p == nil || j.files[path] != file {
+			// closed or removed, the path may be of another device now
+			j.mu.Unlock()
+			return
+		}
+		i := int(e.Number)
+		switch e.Type &^ jsEventInit {
+		case jsEventButton:
+			for len(p.Buttons) <= i {
+				p.Buttons = append(p.Buttons, false)
+			}
+			p.Buttons[i] = e.Value != 0
+		case jsEventAxis:
+			for len(p.Axes) <= i {
+				p.Axes = append(p.Axes, 0)
+			}
+			p.Axes[i] = float64(e.Value) / 32767
+		}
+		j.mu.Unlock()
+	}
+}
+
+func (j *Joysticks) remove(path string) {
+	delete(j.pads, path)
+	delete(j.files, path)
+	for i, p := range j.order {
+		if p == path {
+			j.order = append(j.order[:i], j.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// joystickName returns the model name of the device, JSIOCGNAME
+func joystickName(file *os.File) string {
+	var name [128]byte
+	req := uintptr(2<<30 | len(name)<<16 | 'j'<<8 | 0x13)
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return ""
+	}
+	var errno syscall.Errno
+	conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(&name[0])))
+	})
+	if errno != 0 {
+		return ""
+	}
+	if i := bytes.IndexByte(name[:], 0); i >= 0 {
+		return string(name[:i])
+	}
+	return string(name[:])
+}
@@ -0,0 +1,43 @@
+//go:build linux
+
+package input
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Joysticks_Read(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	defer w.Close()
+	j := &Joysticks{pads: map[string]*Pad{"js0": {ID: "js0"}}, files: map[string]*os.File{"js0": r}, order: []string{"js0"},
+		lastScan: time.Now().Add(time.Hour)} // no scan of the real devices
+	done := make(chan struct{})
+	go func() {
+		j.read("js0", r)
+		close(done)
+	}()
+
+	binary.Write(w, binary.LittleEndian, jsEvent{Value: 1, Type: jsEventButton, Number: 2})
+	assert.Eventually(t, func() bool {
+		pads := j.Pads()
+		return len(pads) == 1 && len(pads[0].Buttons) == 3 && pads[0].Buttons[2]
+	}, time.Second, time.Millisecond)
+
+	// the event after the pad is removed, e.g. by Close
+	j.mu.Lock()
+	j.remove("js0")
+	j.mu.Unlock()
+	binary.Write(w, binary.LittleEndian, jsEvent{Value: 1, Type: jsEventAxis})
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the reader didn't stop")
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package input
+
+// Joysticks reads the gamepads of the host. Only Linux is supported,
+// on the other systems there are no pads
+type Joysticks struct{}
+
+// OpenJoysticks opens the connected joysticks
+func OpenJoysticks() *Joysticks {
+	return &Joysticks{}
+}
+
+// Pads returns the connected pads in the order they were connected
+func (j *Joysticks) Pads() []Pad {
+	return nil
+}
+
+// Close closes the devices
+func (j *Joysticks) Close() error {
+	return nil
+}
@@ -0,0 +1,67 @@
+package input
+
+import "github.com/nevisdale/nestic/internal/nes"
+
+// KeyboardMap translates the host keys to the keys of the Family BASIC
+// keyboard. While the keyboard is plugged in the frontends send
+// the host keys to it instead of looking them up in the keymap
+type KeyboardMap struct {
+	keys map[string]nes.KeyboardKey
+}
+
+// hostKeyboardKeys are the host keys of the Family BASIC keys which don't
+// have a key with the same name. The symbols are at their places
+// on the Japanese layout
+var hostKeyboardKeys = map[string]string{
+	"Enter": "Return", "End": "Stop", "Backquote": "Yen", "CapsLock": "Kana",
+	"ShiftLeft": "LShift", "ShiftRight": "RShift",
+	"ControlLeft": "Ctr", "AltLeft": "Grph", "Escape": "Esc",
+	"Semicolon": ";", "Quote": ":", "BracketLeft": "@", "BracketRight": "[",
+	"Backslash": "]", "Equal": "^", "Minus": "-", "Slash": "/", "Tab": "_",
+	"Comma": ",", "Period": ".",
+	"ArrowLeft": "Left", "ArrowRight": "Right", "ArrowUp": "Up", "ArrowDown": "Down",
+	"Home": "ClrHome", "Insert": "Ins", "Delete": "Del", "Space": "Space",
+}
+
+// DefaultKeyboardMap maps the letters, the digits and the function keys
+// to the same keys, and the other keys to the keys at the same places
+func DefaultKeyboardMap() *KeyboardMap {
+	m := &KeyboardMap{keys: map[string]nes.KeyboardKey{}}
+	var names []string
+	for c := 'A'; c <= 'Z'; c++ {
+		names = append(names, string(c))
+	}
+	for i := 1; i <= 8; i++ {
+		names = append(names, "F"+string(rune('0'+i)))
+	}
+	for _, name := range names {
+		key, _ := nes.ParseKeyboardKey(name)
+		m.keys[name] = key
+	}
+	for c := '0'; c <= '9'; c++ {
+		key, _ := nes.ParseKeyboardKey(string(c))
+		m.keys["Digit"+string(c)] = key
+	}
+	for host, name := range hostKeyboardKeys {
+		key, _ := nes.ParseKeyboardKey(name)
+		m.keys[host] = key
+	}
+	return m
+}
+
+// Maps reports whether the host key is a key of the keyboard
+func (m *KeyboardMap) Maps(host string) bool {
+	_, ok := m.keys[host]
+	return ok
+}
+
+// Keys returns the keyboard keys pressed by the host keys
+func (m *KeyboardMap) Keys(pressed []string) []nes.KeyboardKey {
+	var keys []nes.KeyboardKey
+	for _, host := range pressed {
+		if key, ok := m.keys[host]; ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
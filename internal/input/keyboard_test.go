@@ -0,0 +1,17 @@
+package input
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_KeyboardMap_Keys(t *testing.T) {
+	m := DefaultKeyboardMap()
+	keys := m.Keys([]string{"A", "Digit1", "Enter", "Backquote", "F8", "PageUp"})
+	var names []string
+	for _, key := range keys {
+		names = append(names, key.String())
+	}
+	assert.Equal(t, []string{"A", "1", "Return", "Yen", "F8"}, names)
+}
@@ -0,0 +1,283 @@
+// Package input maps the host input devices to the NES controllers.
+//
+// The keys are named the way the frontends name them, e.g. "ArrowUp",
+// "Enter" or "X", the frontend looks the pressed keys up in the keymap.
+package input
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"gopkg.in/yaml.v3"
+)
+
+// Ports is the number of the controllers: two ports
+// and two more through the Four Score
+const Ports = 4
+
+// Binding is a button of the controller plugged into the port
+type Binding struct {
+	Port   int
+	Button nes.Button
+	Turbo  bool // the button toggles while the key is held
+}
+
+// Keymap maps the host keys to the controller buttons,
+// to the buttons 1-12 of the Power Pad and to the Famicom microphone
+type Keymap struct {
+	keys       map[string]Binding
+	powerPad   map[string]int
+	microphone map[string]bool
+}
+
+// DefaultKeymap binds the first controller to the arrows, Z, X,
+// the right shift and Enter with the turbo B and A on C and V,
+// and the second controller to WASD, J, K, G and H
+// with the turbo B and A on U and I.
+// The Power Pad rows are QWER, ASDF and ZXCV, M is the microphone
+func DefaultKeymap() *Keymap {
+	k := &Keymap{keys: map[string]Binding{}}
+	for key, button := range map[string]nes.Button{
+		"ArrowUp": nes.ButtonUp, "ArrowDown": nes.ButtonDown,
+		"ArrowLeft": nes.ButtonLeft, "ArrowRight": nes.ButtonRight,
+		"X": nes.ButtonA, "Z": nes.ButtonB,
+		"ShiftRight": nes.ButtonSelect, "Enter": nes.ButtonStart,
+	} {
+		k.Bind(key, 0, button)
+	}
+	for key, button := range map[string]nes.Button{
+		"W": nes.ButtonUp, "S": nes.ButtonDown,
+		"A": nes.ButtonLeft, "D": nes.ButtonRight,
+		"K": nes.ButtonA, "J": nes.ButtonB,
+		"G": nes.ButtonSelect, "H": nes.ButtonStart,
+	} {
+		k.Bind(key, 1, button)
+	}
+	k.BindTurbo("C", 0, nes.ButtonB)
+	k.BindTurbo("V", 0, nes.ButtonA)
+	k.BindTurbo("U", 1, nes.ButtonB)
+	k.BindTurbo("I", 1, nes.ButtonA)
+	for i, key := range []string{"Q", "W", "E", "R", "A", "S", "D", "F", "Z", "X", "C", "V"} {
+		k.BindPowerPad(key, i+1)
+	}
+	k.BindMicrophone("M")
+	return k
+}
+
+// Bind binds the key to the button of the controller in the port,
+// replacing the previous binding of the key
+func (k *Keymap) Bind(key string, port int, button nes.Button) {
+	k.bind(key, Binding{Port: port & (Ports - 1), Button: button})
+}
+
+// BindTurbo binds the key to the turbo button of the controller in the port
+func (k *Keymap) BindTurbo(key string, port int, button nes.Button) {
+	k.bind(key, Binding{Port: port & (Ports - 1), Button: button, Turbo: true})
+}
+
+func (k *Keymap) bind(key string, b Binding) {
+	if k.keys == nil {
+		k.keys = map[string]Binding{}
+	}
+	k.keys[key] = b
+}
+
+// BindPowerPad binds the key to the Power Pad button 1-12.
+// The Power Pad bindings are separate, a key can be bound
+// to a controller button and a Power Pad button
+func (k *Keymap) BindPowerPad(key string, button int) {
+	if k.powerPad == nil {
+		k.powerPad = map[string]int{}
+	}
+	k.powerPad[key] = button
+}
+
+// BindMicrophone binds the key to the microphone of the Famicom
+// controller 2, holding it is blowing into the microphone
+func (k *Keymap) BindMicrophone(key string) {
+	if k.microphone == nil {
+		k.microphone = map[string]bool{}
+	}
+	k.microphone[key] = true
+}
+
+// Unbind removes the bindings of the key
+func (k *Keymap) Unbind(key string) {
+	delete(k.keys, key)
+	delete(k.powerPad, key)
+	delete(k.microphone, key)
+}
+
+// Lookup returns the binding of the key
+func (k *Keymap) Lookup(key string) (Binding, bool) {
+	b, ok := k.keys[key]
+	return b, ok
+}
+
+// Buttons returns the buttons of the controller in the port
+// pressed by the keys
+func (k *Keymap) Buttons(port int, pressed []string) nes.Button {
+	return k.buttons(port, pressed, false)
+}
+
+// TurboButtons returns the turbo buttons of the controller in the port
+// held by the keys
+func (k *Keymap) TurboButtons(port int, pressed []string) nes.Button {
+	return k.buttons(port, pressed, true)
+}
+
+// PowerPadButtons returns the Power Pad buttons pressed by the keys
+func (k *Keymap) PowerPadButtons(pressed []string) nes.PowerPadButtons {
+	var buttons nes.PowerPadButtons
+	for _, key := range pressed {
+		if n, ok := k.powerPad[key]; ok {
+			buttons |= nes.PowerPadButton(n)
+		}
+	}
+	return buttons
+}
+
+// Microphone reports whether the keys hold the microphone
+func (k *Keymap) Microphone(pressed []string) bool {
+	for _, key := range pressed {
+		if k.microphone[key] {
+			return true
+		}
+	}
+	return false
+}
+
+func (k *Keymap) buttons(port int, pressed []string, turbo bool) nes.Button {
+	var buttons nes.Button
+	for _, key := range pressed {
+		if b, ok := k.keys[key]; ok && b.Port == port && b.Turbo == turbo {
+			buttons |= b.Button
+		}
+	}
+	return buttons
+}
+
+// keymapFile is the keymap as it is stored: a section per controller
+// with the key or the list of the keys of every button,
+// and the keys of the Power Pad buttons by the number
+//
+//	controller1:
+//	  a: X
+//	  start: [Enter, Space]
+//	  turbo_a: V
+//	controller2:
+//	  a: K
+//	powerpad:
+//	  1: Q
+//	microphone: M
+type keymapFile struct {
+	Controller1 map[string]keyList `yaml:"controller1,omitempty"`
+	Controller2 map[string]keyList `yaml:"controller2,omitempty"`
+	Controller3 map[string]keyList `yaml:"controller3,omitempty"`
+	Controller4 map[string]keyList `yaml:"controller4,omitempty"`
+	PowerPad    map[int]keyList    `yaml:"powerpad,omitempty"`
+	Microphone  keyList            `yaml:"microphone,omitempty"`
+}
+
+// keyList is a key or a list of keys
+type keyList []string
+
+func (l *keyList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = keyList{node.Value}
+		return nil
+	}
+	return node.Decode((*[]string)(l))
+}
+
+func (l keyList) MarshalYAML() (interface{}, error) {
+	if len(l) == 1 {
+		return l[0], nil
+	}
+	return []string(l), nil
+}
+
+// LoadKeymap reads the keymap file
+func LoadKeymap(path string) (*Keymap, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open the file: %s", err)
+	}
+	defer file.Close()
+	return ReadKeymap(file)
+}
+
+// ReadKeymap reads the keymap from r
+func ReadKeymap(r io.Reader) (*Keymap, error) {
+	var f keymapFile
+	if err := yaml.NewDecoder(r).Decode(&f); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("couldn't decode the keymap: %s", err)
+	}
+	k := &Keymap{keys: map[string]Binding{}}
+	for port, section := range []map[string]keyList{f.Controller1, f.Controller2, f.Controller3, f.Controller4} {
+		for name, keys := range section {
+			button, turbo, err := parseMappedButton(name)
+			if err != nil {
+				return nil, fmt.Errorf("controller%d: %s", port+1, err)
+			}
+			for _, key := range keys {
+				k.bind(key, Binding{Port: port, Button: button, Turbo: turbo})
+			}
+		}
+	}
+	for button, keys := range f.PowerPad {
+		if button < 1 || button > 12 {
+			return nil, fmt.Errorf("powerpad: invalid button %d", button)
+		}
+		for _, key := range keys {
+			k.BindPowerPad(key, button)
+		}
+	}
+	for _, key := range f.Microphone {
+		k.BindMicrophone(key)
+	}
+	return k, nil
+}
+
+// Write writes the keymap in the format ReadKeymap reads
+func (k *Keymap) Write(w io.Writer) error {
+	var f keymapFile
+	sections := []*map[string]keyList{&f.Controller1, &f.Controller2, &f.Controller3, &f.Controller4}
+	keys := make([]string, 0, len(k.keys))
+	for key := range k.keys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b := k.keys[key]
+		section := sections[b.Port]
+		if *section == nil {
+			*section = map[string]keyList{}
+		}
+		name := mappedButtonName(b.Button, b.Turbo)
+		(*section)[name] = append((*section)[name], key)
+	}
+	powerPadKeys := make([]string, 0, len(k.powerPad))
+	for key := range k.powerPad {
+		powerPadKeys = append(powerPadKeys, key)
+	}
+	sort.Strings(powerPadKeys)
+	for _, key := range powerPadKeys {
+		if f.PowerPad == nil {
+			f.PowerPad = map[int]keyList{}
+		}
+		button := k.powerPad[key]
+		f.PowerPad[button] = append(f.PowerPad[button], key)
+	}
+	for key := range k.microphone {
+		f.Microphone = append(f.Microphone, key)
+	}
+	sort.Strings(f.Microphone)
+	if err := yaml.NewEncoder(w).Encode(&f); err != nil {
+		return fmt.Errorf("couldn't encode the keymap: %s", err)
+	}
+	return nil
+}
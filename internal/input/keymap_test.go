@@ -0,0 +1,60 @@
+package input
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Keymap_Buttons(t *testing.T) {
+	k := DefaultKeymap()
+	pressed := []string{"X", "ArrowLeft", "K", "F1"}
+	assert.Equal(t, nes.ButtonA|nes.ButtonLeft, k.Buttons(0, pressed))
+	assert.Equal(t, nes.ButtonA, k.Buttons(1, pressed))
+
+	k.Bind("F1", 1, nes.ButtonStart)
+	k.Unbind("X")
+	assert.Equal(t, nes.ButtonLeft, k.Buttons(0, pressed))
+	assert.Equal(t, nes.ButtonA|nes.ButtonStart, k.Buttons(1, pressed))
+}
+
+func Test_Keymap_ReadWrite(t *testing.T) {
+	k, err := ReadKeymap(strings.NewReader(`
+controller1:
+  a: X
+  start: [Enter, Space]
+controller2:
+  up: W
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, nes.ButtonStart, k.Buttons(0, []string{"Space"}))
+	b, ok := k.Lookup("W")
+	assert.True(t, ok)
+	assert.Equal(t, Binding{Port: 1, Button: nes.ButtonUp}, b)
+
+	var out bytes.Buffer
+	assert.NoError(t, k.Write(&out))
+	assert.Equal(t, "controller1:\n    a: X\n    start:\n        - Enter\n        - Space\ncontroller2:\n    up: W\n", out.String())
+
+	_, err = ReadKeymap(strings.NewReader("controller1:\n  turbo: X\n"))
+	assert.Error(t, err)
+}
+
+func Test_Keymap_PowerPad(t *testing.T) {
+	k := DefaultKeymap()
+	assert.Equal(t, nes.PowerPadButton(1)|nes.PowerPadButton(12), k.PowerPadButtons([]string{"Q", "V", "ArrowUp"}))
+	assert.Equal(t, nes.ButtonA, k.Buttons(0, []string{"X"}), "the controller binding of the key is kept")
+
+	k, err := ReadKeymap(strings.NewReader("powerpad:\n  1: Q\n  5: [A, Digit5]\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, nes.PowerPadButton(5), k.PowerPadButtons([]string{"Digit5"}))
+	var out bytes.Buffer
+	assert.NoError(t, k.Write(&out))
+	assert.Equal(t, "powerpad:\n    1: Q\n    5:\n        - A\n        - Digit5\n", out.String())
+
+	_, err = ReadKeymap(strings.NewReader("powerpad:\n  13: Q\n"))
+	assert.Error(t, err)
+}
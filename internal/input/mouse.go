@@ -0,0 +1,28 @@
+package input
+
+import "github.com/nevisdale/nestic/internal/nes"
+
+// MousePaddle turns the paddle knob by the horizontal mouse movement,
+// the left mouse button is the fire button
+type MousePaddle struct {
+	// Sensitivity is the knob steps per pixel of the movement
+	Sensitivity float64
+
+	remainder float64 // the movement less than a step
+}
+
+// DefaultMousePaddle turns the knob by a step per 2 pixels,
+// so the whole range is about 300 pixels
+func DefaultMousePaddle() *MousePaddle {
+	return &MousePaddle{Sensitivity: 0.5}
+}
+
+// Apply moves the knob by the mouse movement dx in pixels
+// and sets the fire button
+func (m *MousePaddle) Apply(p *nes.Paddle, dx float64, pressed bool) {
+	m.remainder += dx * m.Sensitivity
+	steps := int(m.remainder)
+	m.remainder -= float64(steps)
+	p.Move(steps)
+	p.SetFire(pressed)
+}
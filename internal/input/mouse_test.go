@@ -0,0 +1,21 @@
+package input
+
+import (
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MousePaddle_Apply(t *testing.T) {
+	m := DefaultMousePaddle()
+	p := nes.NewPaddle()
+	start := p.Position()
+
+	m.Apply(p, 3, true)
+	m.Apply(p, 3, false)
+	assert.Equal(t, start+3, p.Position(), "the half steps add up")
+
+	m.Apply(p, -1000, false)
+	assert.Equal(t, nes.PaddleMin, p.Position())
+}
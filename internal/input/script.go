@@ -0,0 +1,179 @@
+package input
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// Source provides the buttons of the controllers for every frame,
+// the frontends feed them to the console instead of the live input
+type Source interface {
+	Input(frame int) [Ports]nes.Button
+}
+
+// SourceFunc is a Source computing the input, e.g. a bot
+// reading the console memory
+type SourceFunc func(frame int) [Ports]nes.Button
+
+func (f SourceFunc) Input(frame int) [Ports]nes.Button {
+	return f(frame)
+}
+
+// ScriptEntry presses the buttons from the frame
+type ScriptEntry struct {
+	Frame   int
+	Buttons [Ports]nes.Button
+}
+
+// Script is the scripted controller input. The buttons of an entry
+// are held until the next entry, so a script only lists the changes
+type Script struct {
+	entries []ScriptEntry // in the frame order
+}
+
+// Set presses the buttons from the frame, replacing the entry of the frame
+func (s *Script) Set(frame int, buttons [Ports]nes.Button) {
+	i := sort.Search(len(s.entries), func(i int) bool {
+		return s.entries[i].Frame >= frame
+	})
+	if i < len(s.entries) && s.entries[i].Frame == frame {
+		s.entries[i].Buttons = buttons
+		return
+	}
+	s.entries = append(s.entries, ScriptEntry{})
+	copy(s.entries[i+1:], s.entries[i:])
+	s.entries[i] = ScriptEntry{Frame: frame, Buttons: buttons}
+}
+
+// Entries returns the entries in the frame order
+func (s *Script) Entries() []ScriptEntry {
+	return s.entries
+}
+
+// End returns the frame of the last entry
+func (s *Script) End() int {
+	if len(s.entries) == 0 {
+		return 0
+	}
+	return s.entries[len(s.entries)-1].Frame
+}
+
+// Input returns the buttons held at the frame
+func (s *Script) Input(frame int) [Ports]nes.Button {
+	i := sort.Search(len(s.entries), func(i int) bool {
+		return s.entries[i].Frame > frame
+	})
+	if i == 0 {
+		return [Ports]nes.Button{}
+	}
+	return s.entries[i-1].Buttons
+}
+
+// LoadScript reads the script file, .json files are JSON, the others CSV
+func LoadScript(path string) (*Script, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open the file: %s", err)
+	}
+	defer file.Close()
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return ReadScriptJSON(file)
+	}
+	return ReadScriptCSV(file)
+}
+
+// ReadScriptCSV reads the script from r: a line per entry with the frame
+// and the buttons of the controllers, the lines starting with # are comments
+//
+//	# frame,controller1,controller2
+//	60,start
+//	61,
+//	90,a+right,b
+func ReadScriptCSV(r io.Reader) (*Script, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	s := &Script{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read the script: %s", err)
+		}
+		line, _ := reader.FieldPos(0)
+		frame, err := strconv.Atoi(record[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid frame %q", line, record[0])
+		}
+		buttons, err := parseScriptButtons(record[1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		s.Set(frame, buttons)
+	}
+}
+
+// scriptEntryJSON is the entry of the JSON script
+type scriptEntryJSON struct {
+	Frame int      `json:"frame"`
+	Input []string `json:"input"`
+}
+
+// ReadScriptJSON reads the script from r: a list of the entries
+// with the frame and the buttons of the controllers
+//
+//	[
+//	  {"frame": 60, "input": ["start"]},
+//	  {"frame": 61, "input": []},
+//	  {"frame": 90, "input": ["a+right", "b"]}
+//	]
+func ReadScriptJSON(r io.Reader) (*Script, error) {
+	var entries []scriptEntryJSON
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("couldn't decode the script: %s", err)
+	}
+	s := &Script{}
+	for i, e := range entries {
+		buttons, err := parseScriptButtons(e.Input)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %s", i, err)
+		}
+		s.Set(e.Frame, buttons)
+	}
+	return s, nil
+}
+
+// parseScriptButtons parses the buttons of the controllers joined by +
+func parseScriptButtons(fields []string) ([Ports]nes.Button, error) {
+	var buttons [Ports]nes.Button
+	if len(fields) > Ports {
+		return buttons, fmt.Errorf("too many controllers")
+	}
+	for port, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		for _, name := range strings.Split(field, "+") {
+			button, err := nes.ParseButton(name)
+			if err != nil {
+				return buttons, err
+			}
+			buttons[port] |= button
+		}
+	}
+	return buttons, nil
+}
@@ -0,0 +1,36 @@
+package input
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Script_Input(t *testing.T) {
+	s, err := ReadScriptCSV(strings.NewReader(`# frame,controller1,controller2
+90,a+right,b
+60,start
+61,
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, [Ports]nes.Button{}, s.Input(59))
+	assert.Equal(t, [Ports]nes.Button{nes.ButtonStart}, s.Input(60))
+	assert.Equal(t, [Ports]nes.Button{}, s.Input(75))
+	assert.Equal(t, [Ports]nes.Button{nes.ButtonA | nes.ButtonRight, nes.ButtonB}, s.Input(1000), "the last entry is held")
+	assert.Equal(t, 90, s.End())
+
+	j, err := ReadScriptJSON(strings.NewReader(`[
+		{"frame": 60, "input": ["start"]},
+		{"frame": 61, "input": []},
+		{"frame": 90, "input": ["a+right", "b"]}
+	]`))
+	assert.NoError(t, err)
+	assert.Equal(t, s.Entries(), j.Entries())
+
+	_, err = ReadScriptCSV(strings.NewReader("10,turbo\n"))
+	assert.Error(t, err)
+	_, err = ReadScriptJSON(strings.NewReader(`[{"frame": 1, "input": ["a", "a", "a", "a", "a"]}]`))
+	assert.Error(t, err)
+}
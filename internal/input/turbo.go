@@ -0,0 +1,74 @@
+package input
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// turboPrefix marks the turbo buttons in the mapping files, e.g. turbo_a
+const turboPrefix = "turbo_"
+
+// Turbo toggles the held turbo buttons: they are pressed for On frames,
+// then released for Off frames. The pattern advances with the emulated
+// frames, not with the host time, so it is the same for the keyboard and
+// the pads and the controller sees the toggled buttons, the way input
+// movies record them.
+type Turbo struct {
+	On  int
+	Off int
+
+	frame int // frame of the current on/off period
+}
+
+// Apply returns the held buttons with the turbo buttons pressed
+// during the on part of the period
+func (t *Turbo) Apply(held, turbo nes.Button) nes.Button {
+	if t.frame < max(t.On, 1) {
+		held |= turbo
+	}
+	return held
+}
+
+// Tic advances the pattern by a frame
+func (t *Turbo) Tic() {
+	t.frame++
+	if t.frame >= max(t.On, 1)+max(t.Off, 1) {
+		t.frame = 0
+	}
+}
+
+// ParseTurboRate parses the rate as the frames on and the frames off, e.g. 2:2
+func ParseTurboRate(s string) (*Turbo, error) {
+	on, off, ok := strings.Cut(s, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid turbo rate %q, expected on:off", s)
+	}
+	t := &Turbo{}
+	var err error
+	if t.On, err = strconv.Atoi(on); err != nil || t.On < 1 {
+		return nil, fmt.Errorf("invalid turbo frames on %q", on)
+	}
+	if t.Off, err = strconv.Atoi(off); err != nil || t.Off < 1 {
+		return nil, fmt.Errorf("invalid turbo frames off %q", off)
+	}
+	return t, nil
+}
+
+// parseMappedButton parses the button name of a mapping file,
+// the turbo buttons have the turbo_ prefix
+func parseMappedButton(name string) (nes.Button, bool, error) {
+	turbo := strings.HasPrefix(name, turboPrefix)
+	button, err := nes.ParseButton(strings.TrimPrefix(name, turboPrefix))
+	return button, turbo, err
+}
+
+// mappedButtonName is the name of the button in a mapping file
+func mappedButtonName(button nes.Button, turbo bool) string {
+	if turbo {
+		return turboPrefix + button.String()
+	}
+	return button.String()
+}
@@ -0,0 +1,42 @@
+package input
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Turbo(t *testing.T) {
+	turbo, err := ParseTurboRate("2:1")
+	assert.NoError(t, err)
+
+	var pattern []nes.Button
+	for i := 0; i < 6; i++ {
+		pattern = append(pattern, turbo.Apply(nes.ButtonUp, nes.ButtonA))
+		turbo.Tic()
+	}
+	on, off := nes.ButtonUp|nes.ButtonA, nes.ButtonUp
+	assert.Equal(t, []nes.Button{on, on, off, on, on, off}, pattern)
+
+	_, err = ParseTurboRate("0:2")
+	assert.Error(t, err)
+	_, err = ParseTurboRate("2")
+	assert.Error(t, err)
+}
+
+func Test_Turbo_Mappings(t *testing.T) {
+	k, err := ReadKeymap(strings.NewReader("controller1:\n  a: X\n  turbo_a: V\n"))
+	assert.NoError(t, err)
+	pressed := []string{"X", "V"}
+	assert.Equal(t, nes.ButtonA, k.Buttons(0, pressed))
+	assert.Equal(t, nes.ButtonA, k.TurboButtons(0, pressed))
+	assert.Equal(t, nes.Button(0), k.TurboButtons(0, []string{"X"}))
+
+	c, err := ReadGamepadConfig(strings.NewReader("default:\n  buttons: {a: 1, turbo_b: 2}\n"))
+	assert.NoError(t, err)
+	pads := []Pad{{PadState: PadState{Buttons: []bool{false, true, true}}}}
+	assert.Equal(t, [Ports]nes.Button{nes.ButtonA, 0}, c.Buttons("", pads))
+	assert.Equal(t, [Ports]nes.Button{nes.ButtonB, 0}, c.TurboButtons("", pads))
+}
@@ -0,0 +1,362 @@
+package nes
+
+// lengthTable is the length counter load values indexed by bits 3-7
+// of the channel length register
+var lengthTable = [32]uint8{
+	10, 254, 20, 2, 40, 4, 80, 6, 160, 8, 60, 10, 14, 12, 26, 14,
+	12, 16, 24, 18, 48, 20, 96, 22, 192, 24, 72, 26, 16, 28, 32, 30,
+}
+
+// Frame counter steps in CPU cycles (NTSC)
+const (
+	apuFrameStep1     = 7457
+	apuFrameStep2     = 14913
+	apuFrameStep3     = 22371
+	apuFrameStep4     = 29829
+	apuFrameStep5     = 37281
+	apuFrameLength4   = 29830
+	apuFrameLength5   = 37282
+	apuFrameIRQCycles = 29828 // the frame IRQ flag is set at the last 3 cycles of the 4-step sequence
+)
+
+// APU is the audio processing unit of the 2A03.
+// It is clocked by the CPU, every channel timer runs at the CPU rate
+// or at its half.
+type APU struct {
+	mem ReadWriter // the DMC reads samples from the CPU memory
+
+	triangle triangleChannel
+	dmc      dmcChannel
+
+	expansion ExpansionAudio
+
+	frameCounter struct {
+		mode       uint8 // 0: 4-step, 1: 5-step
+		irqInhibit bool
+		irq        bool // frame interrupt flag
+		cycles     uint32
+
+		// the $4017 write waiting to restart the sequencer in the accurate mode
+		pendingWrite uint8
+		writeDelay   uint8
+	}
+
+	accurate bool // emulate the timing edge cases
+
+	mixer    channelMixer
+	writeLog apuWriteLog
+
+	sampleRate int
+	slowMotion float64 // the speed the sound is stretched for, 1: the real time
+	rateTarget int     // buffered samples the dynamic rate control aims at, 0: off
+	stereo     bool
+	resampler  blipResampler // the mono or the left output
+	filters    outputFilters
+	right      struct {
+		resampler blipResampler
+		filters   outputFilters
+		pending   float32 // the left sample waiting for the right one
+	}
+	noFilters   bool
+	dropSamples bool // the produced samples are dropped, e.g. in the fast-forwarded frames
+	sampleTap   func(value float32)
+	samples     *sampleBuffer
+	scopes      *channelScopes
+
+	stall  uint16 // CPU cycles taken by the DMC memory reader
+	cycles uint64
+}
+
+func NewAPU(mem ReadWriter) *APU {
+	a := &APU{mem: mem, mixer: newChannelMixer(), samples: &sampleBuffer{frame: 1}, scopes: &channelScopes{}, slowMotion: 1}
+	a.SetSampleRate(DefaultSampleRate)
+	a.dmc.period = dmcRates[0]
+	a.dmc.bits = 8
+	a.dmc.silence = true
+	return a
+}
+
+// Reset the APU to its power-up state.
+// The output settings and the samples not read yet are kept
+func (a *APU) Reset() {
+	rate, samples, mixer, noFilters := a.sampleRate, a.samples, a.mixer, a.noFilters
+	expansion, rateTarget, stereo := a.expansion, a.rateTarget, a.stereo
+	writeLog, accurate, dropSamples, slowMotion := a.writeLog, a.accurate, a.dropSamples, a.slowMotion
+	sampleTap := a.sampleTap
+	*a = *NewAPU(a.mem)
+	a.sampleTap = sampleTap
+	a.dropSamples = dropSamples
+	a.slowMotion = slowMotion
+	a.writeLog = writeLog
+	a.SetAccuracy(accurate)
+	a.expansion = expansion
+	a.samples = samples
+	a.mixer = mixer
+	a.noFilters = noFilters
+	a.rateTarget = rateTarget
+	a.stereo = stereo
+	a.SetSampleRate(rate)
+}
+
+// lengthCounter silences a channel after the loaded number of half frames
+type lengthCounter struct {
+	enabled bool
+	halt    bool
+	value   uint8
+
+	// in the accurate mode the writes take effect after the frame counter
+	// clock of the cycle they happen at
+	deferred    bool
+	pendingLoad bool
+	loadValue   uint8
+	pendingHalt bool
+	haltValue   bool
+	clocked     bool // clocked at this cycle while non-zero
+}
+
+func (l *lengthCounter) load(index uint8) {
+	if !l.enabled {
+		return
+	}
+	if l.deferred {
+		l.pendingLoad = true
+		l.loadValue = lengthTable[index&0x1F]
+		return
+	}
+	l.value = lengthTable[index&0x1F]
+}
+
+func (l *lengthCounter) setHalt(halt bool) {
+	if l.deferred {
+		l.pendingHalt = true
+		l.haltValue = halt
+		return
+	}
+	l.halt = halt
+}
+
+// applyWrites applies the deferred writes after the frame counter clock.
+// The load is ignored when it happens together with the clock
+// of the non-zero counter, the clock sees the old halt flag
+func (l *lengthCounter) applyWrites() {
+	if l.pendingLoad && !l.clocked {
+		l.value = l.loadValue
+	}
+	if l.pendingHalt {
+		l.halt = l.haltValue
+	}
+	l.pendingLoad = false
+	l.pendingHalt = false
+	l.clocked = false
+}
+
+func (l *lengthCounter) setEnabled(enabled bool) {
+	l.enabled = enabled
+	if !enabled {
+		l.value = 0
+	}
+}
+
+func (l *lengthCounter) clock() {
+	l.clocked = l.value > 0
+	if !l.halt && l.value > 0 {
+		l.value--
+	}
+}
+
+func (a *APU) readRegister(addr uint16) uint8 {
+	switch addr {
+	case 0x4015:
+		// in the accurate mode the flag set at the cycle of the read
+		// reads back set and isn't cleared
+		settingIRQ := a.accurate && a.settingFrameIRQ()
+		var data uint8
+		if a.triangle.length.value > 0 {
+			data |= 0x04
+		}
+		if a.dmc.remaining > 0 {
+			data |= 0x10
+		}
+		if a.frameCounter.irq || settingIRQ {
+			data |= 0x40
+		}
+		if a.dmc.irq {
+			data |= 0x80
+		}
+		// reading the status clears the frame interrupt flag
+		if !settingIRQ {
+			a.frameCounter.irq = false
+		}
+		return data
+	}
+	return 0
+}
+
+func (a *APU) writeRegister(addr uint16, data uint8) {
+	a.writeLog.log(addr, data)
+	switch addr {
+	case 0x4008, 0x400A, 0x400B:
+		a.triangle.write(addr, data)
+	case 0x4010, 0x4011, 0x4012, 0x4013:
+		a.dmc.write(addr, data)
+	case 0x4015:
+		a.triangle.length.setEnabled(data&0x04 != 0)
+		a.dmc.setEnabled(data&0x10 != 0)
+	case 0x4017:
+		a.frameCounter.irqInhibit = data&0x40 != 0
+		if a.frameCounter.irqInhibit {
+			a.frameCounter.irq = false
+		}
+		if !a.accurate {
+			a.resetFrameCounter(data)
+			return
+		}
+		// the sequencer restarts 3 cycles after the write on an APU cycle,
+		// 4 cycles after the write between the APU cycles
+		a.frameCounter.pendingWrite = data
+		a.frameCounter.writeDelay = 3 + uint8(a.cycles%2)
+	}
+}
+
+// settingFrameIRQ reports whether the frame counter sets the interrupt
+// flag at the current cycle, the APU runs after the CPU in the cycle
+func (a *APU) settingFrameIRQ() bool {
+	f := &a.frameCounter
+	if f.writeDelay == 1 {
+		// the sequencer restarts at the cycle
+		return false
+	}
+	return f.mode == 0 && !f.irqInhibit && f.cycles+1 >= apuFrameIRQCycles
+}
+
+// resetFrameCounter restarts the sequencer in the mode of the $4017 write,
+// the 5-step mode clocks the units immediately
+func (a *APU) resetFrameCounter(data uint8) {
+	a.frameCounter.mode = data >> 7
+	a.frameCounter.cycles = 0
+	if a.frameCounter.mode == 1 {
+		a.quarterFrame()
+		a.halfFrame()
+	}
+}
+
+// irq reports whether the APU asserts the IRQ line
+func (a *APU) irq() bool {
+	return a.frameCounter.irq || a.dmc.irq
+}
+
+// irqSources returns the sources asserting the IRQ line
+func (a *APU) irqSources() uint8 {
+	var sources uint8
+	if a.frameCounter.irq {
+		sources |= IRQFrameCounter
+	}
+	if a.dmc.irq {
+		sources |= IRQDMC
+	}
+	return sources
+}
+
+// takeStall returns the CPU cycles the DMC memory reader has taken since the last call
+func (a *APU) takeStall() uint16 {
+	stall := a.stall
+	a.stall = 0
+	return stall
+}
+
+// quarterFrame clocks the envelopes and the triangle linear counter
+func (a *APU) quarterFrame() {
+	a.triangle.clockLinear()
+}
+
+// halfFrame clocks the length counters and the sweep units
+func (a *APU) halfFrame() {
+	a.triangle.length.clock()
+}
+
+// clockFrameCounter advances the frame sequencer by one CPU cycle
+func (a *APU) clockFrameCounter() {
+	f := &a.frameCounter
+	f.cycles++
+	switch f.cycles {
+	case apuFrameStep1, apuFrameStep3:
+		a.quarterFrame()
+	case apuFrameStep2:
+		a.quarterFrame()
+		a.halfFrame()
+	}
+
+	if f.mode == 0 {
+		if f.cycles >= apuFrameIRQCycles && !f.irqInhibit {
+			f.irq = true
+		}
+		if f.cycles == apuFrameStep4 {
+			a.quarterFrame()
+			a.halfFrame()
+		}
+		if f.cycles == apuFrameLength4 {
+			f.cycles = 0
+		}
+		return
+	}
+
+	if f.cycles == apuFrameStep5 {
+		a.quarterFrame()
+		a.halfFrame()
+	}
+	if f.cycles == apuFrameLength5 {
+		f.cycles = 0
+	}
+}
+
+// SetAccuracy turns on the emulation of the timing edge cases:
+// the delayed sequencer restart after the $4017 write, the length
+// counter writes taking effect after the frame counter clock, and
+// the $4015 read not clearing the frame interrupt flag set at its cycle.
+// They matter for test ROMs more than for games, so it is off by default
+func (a *APU) SetAccuracy(accurate bool) {
+	a.accurate = accurate
+	a.triangle.length.deferred = accurate
+}
+
+// Tic executes one APU cycle, the APU runs at the CPU rate
+func (a *APU) Tic() {
+	if f := &a.frameCounter; f.writeDelay > 0 {
+		f.writeDelay--
+		if f.writeDelay == 0 {
+			a.resetFrameCounter(f.pendingWrite)
+		}
+	}
+	a.clockFrameCounter()
+	a.triangle.length.applyWrites()
+	a.triangle.clockTimer()
+	a.dmc.clockTimer()
+	a.stall += a.dmc.fetch(a.mem)
+	if a.expansion != nil {
+		a.expansion.AudioTic()
+	}
+	a.sample()
+	a.cycles++
+	if a.writeLog.enabled {
+		a.writeLog.cycles++
+	}
+}
+
+// Output returns the mixed level of all the channels in the range 0-1,
+// the expansion audio can drive it above 1
+func (a *APU) Output() float32 {
+	return a.mix(sideMono)
+}
+
+// mix mixes the channels for the side of the stereo output, or for mono
+func (a *APU) mix(side int) float32 {
+	// the nonlinear mixer of the triangle, noise and DMC channels
+	triangle := a.triangle.output() * a.mixer.sideGain(ChannelTriangle, side)
+	dmc := a.dmc.output() * a.mixer.sideGain(ChannelDMC, side)
+	tnd := triangle/8227 + dmc/22638
+	var out float64
+	if tnd != 0 {
+		out = 159.79 / (1/tnd + 100)
+	}
+	return float32(out + a.expansionOutput(side))
+}
@@ -0,0 +1,134 @@
+package nes
+
+// dmcRates is the output rate periods in CPU cycles (NTSC)
+var dmcRates = [16]uint16{
+	428, 380, 340, 320, 286, 254, 226, 214, 190, 160, 142, 128, 106, 84, 72, 54,
+}
+
+// dmcDMACycles is how long the CPU is stalled while the memory reader fetches a sample byte
+const dmcDMACycles = 4
+
+// dmcChannel plays 1-bit delta encoded samples from the CPU memory
+type dmcChannel struct {
+	irqEnabled bool
+	loop       bool
+	period     uint16
+	timer      uint16
+
+	sampleAddr   uint16
+	sampleLength uint16
+
+	// memory reader
+	addr      uint16
+	fetchAddr uint16 // the address of the last fetch
+	remaining uint16
+	buffer    uint8
+	hasBuffer bool
+
+	// output unit
+	shift   uint8
+	bits    uint8
+	silence bool
+	level   uint8 // 7-bit output level
+
+	irq bool
+}
+
+func (d *dmcChannel) write(addr uint16, data uint8) {
+	switch addr {
+	case 0x4010:
+		d.irqEnabled = data&0x80 != 0
+		d.loop = data&0x40 != 0
+		d.period = dmcRates[data&0x0F]
+		if !d.irqEnabled {
+			d.irq = false
+		}
+	case 0x4011:
+		d.level = data & 0x7F
+	case 0x4012:
+		d.sampleAddr = 0xC000 | uint16(data)<<6
+	case 0x4013:
+		d.sampleLength = uint16(data)<<4 | 1
+	}
+}
+
+// setEnabled starts the sample if it is not playing, or stops it
+func (d *dmcChannel) setEnabled(enabled bool) {
+	d.irq = false
+	if !enabled {
+		d.remaining = 0
+		return
+	}
+	if d.remaining == 0 {
+		d.restart()
+	}
+}
+
+func (d *dmcChannel) restart() {
+	d.addr = d.sampleAddr
+	d.remaining = d.sampleLength
+}
+
+// fetch fills the sample buffer from the memory when it is empty.
+// It returns the number of cycles the CPU is stalled for
+func (d *dmcChannel) fetch(mem ReadWriter) uint16 {
+	if d.hasBuffer || d.remaining == 0 {
+		return 0
+	}
+	d.buffer = mem.Read8(d.addr)
+	d.hasBuffer = true
+	d.fetchAddr = d.addr
+	// the address wraps to $8000
+	d.addr++
+	if d.addr == 0 {
+		d.addr = 0x8000
+	}
+	d.remaining--
+	if d.remaining == 0 {
+		switch {
+		case d.loop:
+			d.restart()
+		case d.irqEnabled:
+			d.irq = true
+		}
+	}
+	return dmcDMACycles
+}
+
+// clockTimer is called every CPU cycle
+func (d *dmcChannel) clockTimer() {
+	if d.timer > 0 {
+		d.timer--
+		return
+	}
+	d.timer = d.period - 1
+
+	if !d.silence {
+		if d.shift&0x1 != 0 {
+			if d.level <= 125 {
+				d.level += 2
+			}
+		} else if d.level >= 2 {
+			d.level -= 2
+		}
+	}
+	d.shift >>= 1
+
+	if d.bits > 0 {
+		d.bits--
+	}
+	// a new output cycle starts
+	if d.bits == 0 {
+		d.bits = 8
+		d.silence = !d.hasBuffer
+		if d.hasBuffer {
+			d.shift = d.buffer
+			d.hasBuffer = false
+		}
+	}
+}
+
+// output returns the channel level 0-127
+func (d *dmcChannel) output() float64 {
+	return float64(d.level)
+}
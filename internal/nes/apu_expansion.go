@@ -0,0 +1,73 @@
+package nes
+
+// ExpansionAudio is implemented by mappers with a sound chip on the cartridge,
+// like the VRC6 or the FDS. The Famicom mixes the chip output with the 2A03
+// output through the cartridge connector
+type ExpansionAudio interface {
+	// AudioChannel returns the channel the chip is mixed as, e.g. ChannelVRC6
+	AudioChannel() Channel
+	// AudioTic clocks the chip, it runs at the CPU rate
+	AudioTic()
+	// AudioOutput returns the level of all the chip channels
+	// in the range 0-1 of the chip full scale
+	AudioOutput() float64
+}
+
+// apuPulseLevel is the 2A03 output of one pulse channel at volume 15,
+// the expansion chips levels are measured against it
+const apuPulseLevel = 95.88 / (8128.0/15 + 100)
+
+// expansionLevels is the full scale output of the expansion chips
+// in the 2A03 pulse levels, approximately as they are mixed by a Famicom
+var expansionLevels = [channelCount]float64{
+	// two pulses at volume 15 and the saw at 31, the pulse at volume 15
+	// is about as loud as the 2A03 pulse
+	ChannelVRC6: 61.0 / 15,
+	ChannelVRC7: 3.5,
+	// the wave at the full master volume
+	ChannelFDS: 2.4,
+	// one channel at volume 15, the channels are time multiplexed
+	ChannelN163: 3,
+	// three channels at the full volume
+	ChannelSunsoft5B: 6,
+}
+
+// SetExpansionAudio sets the sound chip mixed with the APU output,
+// nil removes it
+func (a *APU) SetExpansionAudio(e ExpansionAudio) {
+	a.expansion = e
+}
+
+// expansionOutput returns the expansion chip level in the APU output scale
+// for the side of the stereo output, or for mono
+func (a *APU) expansionOutput(side int) float64 {
+	if a.expansion == nil {
+		return 0
+	}
+	c := a.expansion.AudioChannel()
+	if c < 0 || c >= channelCount {
+		return 0
+	}
+	return a.expansion.AudioOutput() * expansionLevels[c] * apuPulseLevel * a.mixer.sideGain(c, side)
+}
+
+// expansionRegister reports whether the address is a sound register of the chip
+func expansionRegister(c Channel, addr uint16) bool {
+	switch c {
+	case ChannelVRC6:
+		reg := addr & 0xF003
+		return reg >= 0x9000 && reg <= 0x9003 || reg >= 0xA000 && reg <= 0xA002 || reg >= 0xB000 && reg <= 0xB002
+	case ChannelVRC7:
+		return addr == 0x9010 || addr == 0x9030
+	case ChannelFDS:
+		// the wave RAM and the sound registers
+		return addr >= 0x4040 && addr <= 0x408A
+	case ChannelN163:
+		// the data port and the address port
+		return addr >= 0x4800 && addr <= 0x4FFF || addr >= 0xF800
+	case ChannelSunsoft5B:
+		// the address port and the data port
+		return addr >= 0xC000
+	}
+	return false
+}
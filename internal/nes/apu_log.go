@@ -0,0 +1,85 @@
+package nes
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// APUWrite is a CPU write to a sound register of the APU or the expansion chip
+type APUWrite struct {
+	Cycle uint64 // CPU cycles since the logging started
+	Addr  uint16
+	Data  uint8
+}
+
+// apuWriteLog records the sound register writes.
+// It survives the APU reset, so the timestamps keep going up
+type apuWriteLog struct {
+	enabled bool
+	cycles  uint64
+	writes  []APUWrite
+}
+
+func (l *apuWriteLog) log(addr uint16, data uint8) {
+	if l.enabled {
+		l.writes = append(l.writes, APUWrite{Cycle: l.cycles, Addr: addr, Data: data})
+	}
+}
+
+// SetWriteLogging turns on the recording of the sound register writes.
+// Turning it on starts a new log
+func (a *APU) SetWriteLogging(enabled bool) {
+	a.writeLog = apuWriteLog{enabled: enabled}
+}
+
+// Writes returns the recorded sound register writes
+func (a *APU) Writes() []APUWrite {
+	return a.writeLog.writes
+}
+
+// logExpansionWrite records the CPU write to the cartridge
+// if it goes to a sound register of the expansion chip
+func (a *APU) logExpansionWrite(addr uint16, data uint8) {
+	if a.writeLog.enabled && a.expansion != nil && expansionRegister(a.expansion.AudioChannel(), addr) {
+		a.writeLog.log(addr, data)
+	}
+}
+
+// WriteLog exports the recorded writes as text, a write per line:
+// the CPU cycle, the register address and the data in hex.
+// The lines starting with # are comments.
+//
+//	# clock 1789773
+//	0 4015 0F
+//	12 4008 81
+func (a *APU) WriteLog(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# nestic APU write log\n")
+	fmt.Fprintf(bw, "# clock %d\n", cpuFrequency)
+	if a.expansion != nil {
+		fmt.Fprintf(bw, "# expansion %s\n", a.expansion.AudioChannel())
+	}
+	fmt.Fprintf(bw, "# cycle addr data\n")
+	for _, write := range a.writeLog.writes {
+		fmt.Fprintf(bw, "%d %04X %02X\n", write.Cycle, write.Addr, write.Data)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("couldn't write the log: %s", err)
+	}
+	return nil
+}
+
+// SaveWriteLog exports the recorded writes to the file
+func (a *APU) SaveWriteLog(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("couldn't create the file: %s", err)
+	}
+	defer file.Close()
+	if err := a.WriteLog(file); err != nil {
+		return err
+	}
+	return file.Close()
+}
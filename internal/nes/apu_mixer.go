@@ -0,0 +1,161 @@
+package nes
+
+import "fmt"
+
+// Channel is a sound channel of the APU
+type Channel int
+
+const (
+	ChannelTriangle Channel = iota
+	ChannelDMC
+
+	// expansion sound chips on the cartridge, mixed as one channel each
+	ChannelVRC6
+	ChannelVRC7
+	ChannelFDS
+	ChannelN163
+	ChannelSunsoft5B
+
+	channelCount
+)
+
+var channelNames = [channelCount]string{
+	ChannelTriangle:  "triangle",
+	ChannelDMC:       "dmc",
+	ChannelVRC6:      "vrc6",
+	ChannelVRC7:      "vrc7",
+	ChannelFDS:       "fds",
+	ChannelN163:      "n163",
+	ChannelSunsoft5B: "5b",
+}
+
+func (c Channel) String() string {
+	if c >= 0 && c < channelCount {
+		return channelNames[c]
+	}
+	return fmt.Sprintf("Channel(%d)", c)
+}
+
+// ParseChannel returns the channel by its name, e.g. triangle or dmc
+func ParseChannel(s string) (Channel, error) {
+	for c, name := range channelNames {
+		if name == s {
+			return Channel(c), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown channel %q", s)
+}
+
+// channelMixer holds the user controls of the channels.
+// They are applied to the channel levels before the console mixer
+type channelMixer struct {
+	volume [channelCount]float64
+	muted  [channelCount]bool
+	solo   [channelCount]bool
+	pan    [channelCount]float64 // -1: left, 0: center, 1: right
+}
+
+// defaultPans keep the bass in the center
+// and move the percussion a bit to the side
+var defaultPans = [channelCount]float64{
+	ChannelTriangle: 0,
+	ChannelDMC:      0.25,
+}
+
+func newChannelMixer() channelMixer {
+	m := channelMixer{pan: defaultPans}
+	for c := range m.volume {
+		m.volume[c] = 1
+	}
+	return m
+}
+
+// Sides of the output
+const (
+	sideMono  = -1
+	sideLeft  = 0
+	sideRight = 1
+)
+
+// sideGain returns the gain of the channel on the side of the stereo output.
+// A centered channel is at the full level on both sides,
+// panning attenuates the opposite side
+func (m *channelMixer) sideGain(c Channel, side int) float64 {
+	gain := m.gain(c)
+	switch side {
+	case sideLeft:
+		gain *= min(1, 1-m.pan[c])
+	case sideRight:
+		gain *= min(1, 1+m.pan[c])
+	}
+	return gain
+}
+
+// gain returns the factor the channel level is multiplied by
+func (m *channelMixer) gain(c Channel) float64 {
+	if m.muted[c] {
+		return 0
+	}
+	for _, solo := range m.solo {
+		if solo && !m.solo[c] {
+			return 0
+		}
+	}
+	return m.volume[c]
+}
+
+// SetChannelVolume sets the volume of the channel, 0: silent, 1: normal
+func (a *APU) SetChannelVolume(c Channel, volume float64) {
+	if c >= 0 && c < channelCount {
+		a.mixer.volume[c] = max(0, volume)
+	}
+}
+
+// ChannelVolume returns the volume of the channel
+func (a *APU) ChannelVolume(c Channel) float64 {
+	if c >= 0 && c < channelCount {
+		return a.mixer.volume[c]
+	}
+	return 0
+}
+
+// SetChannelMuted mutes or unmutes the channel
+func (a *APU) SetChannelMuted(c Channel, muted bool) {
+	if c >= 0 && c < channelCount {
+		a.mixer.muted[c] = muted
+	}
+}
+
+// ChannelMuted reports whether the channel is muted
+func (a *APU) ChannelMuted(c Channel) bool {
+	return c >= 0 && c < channelCount && a.mixer.muted[c]
+}
+
+// SetChannelSolo solos the channel. While any channel is soloed,
+// only the soloed channels are heard
+func (a *APU) SetChannelSolo(c Channel, solo bool) {
+	if c >= 0 && c < channelCount {
+		a.mixer.solo[c] = solo
+	}
+}
+
+// ChannelSolo reports whether the channel is soloed
+func (a *APU) ChannelSolo(c Channel) bool {
+	return c >= 0 && c < channelCount && a.mixer.solo[c]
+}
+
+// SetChannelPan sets the position of the channel in the stereo output,
+// -1: left, 0: center, 1: right
+func (a *APU) SetChannelPan(c Channel, pan float64) {
+	if c >= 0 && c < channelCount {
+		a.mixer.pan[c] = max(-1, min(pan, 1))
+	}
+}
+
+// ChannelPan returns the position of the channel in the stereo output
+func (a *APU) ChannelPan(c Channel) float64 {
+	if c >= 0 && c < channelCount {
+		return a.mixer.pan[c]
+	}
+	return 0
+}
@@ -0,0 +1,351 @@
+package nes
+
+import (
+	"math"
+	"sync"
+)
+
+// cpuFrequency is the NTSC CPU clock rate in Hz
+const cpuFrequency = 1789773
+
+// DefaultSampleRate is the sample rate the APU produces samples at by default
+const DefaultSampleRate = 44100
+
+// rateControlDelta is the largest adjustment of the sample rate
+// made by the dynamic rate control, small enough to not change the pitch audibly
+const rateControlDelta = 0.005
+
+// sampleBuffer is a bounded queue of samples between the emulation
+// and the audio device. When nobody reads the samples, e.g. without
+// an audio device, the oldest samples are dropped.
+// A stereo sample is a frame of the left and the right values
+type sampleBuffer struct {
+	mu      sync.Mutex
+	samples []float32
+	frame   int // values per sample: 1 or 2
+	max     int // samples
+}
+
+func (b *sampleBuffer) push(frame ...float32) {
+	b.mu.Lock()
+	if len(b.samples) >= b.max*b.frame {
+		n := copy(b.samples, b.samples[len(b.samples)-b.max/2*b.frame:])
+		b.samples = b.samples[:n]
+	}
+	b.samples = append(b.samples, frame...)
+	b.mu.Unlock()
+}
+
+// read moves whole samples into dst and returns the number of the values
+func (b *sampleBuffer) read(dst []float32) int {
+	b.mu.Lock()
+	n := copy(dst[:len(dst)/b.frame*b.frame], b.samples)
+	rest := copy(b.samples, b.samples[n:])
+	b.samples = b.samples[:rest]
+	b.mu.Unlock()
+	return n
+}
+
+func (b *sampleBuffer) len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.samples) / b.frame
+}
+
+// setFrame drops the samples and sets the number of the values per sample
+func (b *sampleBuffer) setFrame(frame int) {
+	b.mu.Lock()
+	b.samples = b.samples[:0]
+	b.frame = frame
+	b.mu.Unlock()
+}
+
+// SetSampleRate sets the rate of the produced samples in Hz
+func (a *APU) SetSampleRate(rate int) {
+	a.sampleRate = rate
+	a.resampler = blipResampler{ratio: a.outputRate() / cpuFrequency}
+	a.filters = newOutputFilters(a.outputRate())
+	a.right.resampler = a.resampler
+	a.right.filters = a.filters
+	// keep at most half a second of audio
+	a.samples.max = max(rate/2, 2)
+}
+
+// SampleRate returns the rate of the produced samples in Hz
+func (a *APU) SampleRate() int {
+	return a.sampleRate
+}
+
+// SetSlowMotion stretches the sound for the emulation running slower
+// than the real time: at the speed 0.5 a second of the emulation produces
+// two seconds of the samples, so the sound plays slower and lower.
+// 1 is the real time
+func (a *APU) SetSlowMotion(speed float64) {
+	if speed <= 0 || speed > 1 {
+		speed = 1
+	}
+	a.slowMotion = speed
+	a.SetSampleRate(a.sampleRate)
+}
+
+// outputRate returns the samples produced per second of the emulation
+func (a *APU) outputRate() float64 {
+	return float64(a.sampleRate) / a.slowMotion
+}
+
+// SetStereo switches between the mono and the stereo output.
+// The stereo samples are interleaved: left, right.
+// The samples not read yet are dropped
+func (a *APU) SetStereo(enabled bool) {
+	a.stereo = enabled
+	frame := 1
+	if enabled {
+		frame = 2
+	}
+	a.samples.setFrame(frame)
+	a.SetSampleRate(a.sampleRate)
+}
+
+// Stereo reports whether the output is stereo
+func (a *APU) Stereo() bool {
+	return a.stereo
+}
+
+// ReadSamples moves the produced samples into dst and returns
+// the number of the values, two per sample in the stereo mode.
+// It is safe to call it from another goroutine,
+// e.g. from the audio device callback
+func (a *APU) ReadSamples(dst []float32) int {
+	return a.samples.read(dst)
+}
+
+// SetSampleOutput turns on or off the output of the samples. While it is off
+// the produced samples are dropped, e.g. the sound of the fast-forwarded frames
+func (a *APU) SetSampleOutput(enabled bool) {
+	a.dropSamples = !enabled
+}
+
+// SampleOutput reports whether the produced samples are output
+func (a *APU) SampleOutput() bool {
+	return !a.dropSamples
+}
+
+// SetSampleTap sets the function called with every produced value,
+// the left and then the right one of the stereo samples, also while
+// the sample output is off. It is called on the emulation goroutine,
+// e.g. for the recorders. nil removes it
+func (a *APU) SetSampleTap(fn func(value float32)) {
+	a.sampleTap = fn
+}
+
+// BufferedSamples returns the number of the produced samples not read yet
+func (a *APU) BufferedSamples() int {
+	return a.samples.len()
+}
+
+// SetRateControl turns on the dynamic rate control: the sample rate is
+// adjusted by up to ±0.5% to keep about target samples in the buffer,
+// so the emulation running slightly faster or slower than the audio device
+// doesn't drift into underruns or growing latency. 0 turns it off
+func (a *APU) SetRateControl(target int) {
+	a.rateTarget = max(target, 0)
+	a.resampler.ratio = a.outputRate() / cpuFrequency
+	a.right.resampler.ratio = a.resampler.ratio
+}
+
+// adjustRate sets the resampling ratio by the buffer fill level:
+// an emptier buffer gets more samples, a fuller one fewer
+func (a *APU) adjustRate() {
+	target := float64(a.rateTarget)
+	fill := float64(a.samples.len())
+	diff := max(-1, min((target-fill)/target, 1))
+	a.resampler.ratio = a.outputRate() / cpuFrequency * (1 + rateControlDelta*diff)
+	a.right.resampler.ratio = a.resampler.ratio
+}
+
+// SetOutputFilters turns on or off the filters of the console audio output.
+// They are on by default
+func (a *APU) SetOutputFilters(enabled bool) {
+	a.noFilters = !enabled
+}
+
+// sample feeds the output of the CPU cycle into the resampler
+func (a *APU) sample() {
+	if !a.stereo {
+		a.resampler.clock(a.Output(), a.emit)
+		return
+	}
+	// both resamplers run at the same ratio, so they emit together
+	a.resampler.clock(a.mix(sideLeft), a.emitLeft)
+	a.right.resampler.clock(a.mix(sideRight), a.emitRight)
+}
+
+// emit passes the output rate sample through the output filters
+func (a *APU) emit(sample float32) {
+	if !a.noFilters {
+		sample = a.filters.apply(sample)
+	}
+	if a.sampleTap != nil {
+		a.sampleTap(sample)
+	}
+	if !a.dropSamples {
+		a.samples.push(sample)
+	}
+	a.emitted()
+}
+
+func (a *APU) emitLeft(sample float32) {
+	a.right.pending = sample
+}
+
+func (a *APU) emitRight(sample float32) {
+	left := a.right.pending
+	if !a.noFilters {
+		left = a.filters.apply(left)
+		sample = a.right.filters.apply(sample)
+	}
+	if a.sampleTap != nil {
+		a.sampleTap(left)
+		a.sampleTap(sample)
+	}
+	if !a.dropSamples {
+		a.samples.push(left, sample)
+	}
+	a.emitted()
+}
+
+// emitted is called after every output sample
+func (a *APU) emitted() {
+	a.recordScopes()
+	if a.rateTarget > 0 && !a.dropSamples {
+		a.adjustRate()
+	}
+}
+
+// outputFilters are the filters of the console audio output:
+// two first-order high-pass filters at 90Hz and 440Hz,
+// and a first-order low-pass filter at 14kHz
+type outputFilters struct {
+	hp90  highPassFilter
+	hp440 highPassFilter
+	lp14k lowPassFilter
+}
+
+func newOutputFilters(rate float64) outputFilters {
+	return outputFilters{
+		hp90:  newHighPassFilter(90, rate),
+		hp440: newHighPassFilter(440, rate),
+		lp14k: newLowPassFilter(14000, rate),
+	}
+}
+
+func (f *outputFilters) apply(sample float32) float32 {
+	return f.lp14k.apply(f.hp440.apply(f.hp90.apply(sample)))
+}
+
+type highPassFilter struct {
+	alpha float32
+	prevX float32
+	prevY float32
+}
+
+func newHighPassFilter(cutoff, rate float64) highPassFilter {
+	rc := 1 / (2 * math.Pi * cutoff)
+	return highPassFilter{alpha: float32(rc / (rc + 1/rate))}
+}
+
+func (f *highPassFilter) apply(x float32) float32 {
+	y := f.alpha * (f.prevY + x - f.prevX)
+	f.prevX, f.prevY = x, y
+	return y
+}
+
+type lowPassFilter struct {
+	alpha float32
+	prevY float32
+}
+
+func newLowPassFilter(cutoff, rate float64) lowPassFilter {
+	rc := 1 / (2 * math.Pi * cutoff)
+	dt := 1 / rate
+	return lowPassFilter{alpha: float32(dt / (rc + dt))}
+}
+
+func (f *lowPassFilter) apply(x float32) float32 {
+	f.prevY += f.alpha * (x - f.prevY)
+	return f.prevY
+}
+
+// Band-limited step synthesis: instead of taking every n-th sample of the
+// CPU rate output, which aliases the harmonics above the Nyquist frequency
+// into audible noise, every change of the output level is added to the output
+// samples as a band-limited step. The steps are precomputed for blipPhases
+// positions between two output samples.
+const (
+	blipPhases = 64
+	blipWidth  = 16 // output samples a step is spread over
+	blipCutoff = 0.9
+)
+
+// blipKernel is the band-limited impulse, the derivative of the step,
+// for every phase. The impulses are normalized to the unit step
+var blipKernel = func() (kernel [blipPhases][blipWidth]float32) {
+	for phase := range kernel {
+		frac := float64(phase) / blipPhases
+		var sum float64
+		var impulse [blipWidth]float64
+		for i := range impulse {
+			t := float64(i) - frac
+			x := t - blipWidth/2
+			// windowed sinc
+			sinc := blipCutoff
+			if x != 0 {
+				sinc = math.Sin(math.Pi*blipCutoff*x) / (math.Pi * x)
+			}
+			n := t / blipWidth
+			window := 0.42 - 0.5*math.Cos(2*math.Pi*n) + 0.08*math.Cos(4*math.Pi*n)
+			impulse[i] = sinc * window
+			sum += impulse[i]
+		}
+		for i := range impulse {
+			kernel[phase][i] = float32(impulse[i] / sum)
+		}
+	}
+	return kernel
+}()
+
+// blipResampler converts the CPU rate signal into the output rate signal.
+// The output is delayed by blipWidth/2 samples
+type blipResampler struct {
+	ratio float64 // output samples per CPU cycle
+	frac  float64 // position within the current output sample
+
+	// the level changes of the current output sample and the following ones
+	deltas [blipWidth]float32
+	head   int
+
+	input float32 // the last input level
+	level float64 // the sum of the finished changes
+}
+
+// clock takes the input level of the CPU cycle
+// and emits the output samples which are finished
+func (b *blipResampler) clock(input float32, emit func(sample float32)) {
+	if delta := input - b.input; delta != 0 {
+		kernel := &blipKernel[int(b.frac*blipPhases)]
+		for i, k := range kernel {
+			b.deltas[(b.head+i)%blipWidth] += delta * k
+		}
+		b.input = input
+	}
+
+	b.frac += b.ratio
+	if b.frac < 1 {
+		return
+	}
+	b.frac--
+	b.level += float64(b.deltas[b.head])
+	b.deltas[b.head] = 0
+	b.head = (b.head + 1) % blipWidth
+	emit(float32(b.level))
+}
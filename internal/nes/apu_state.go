@@ -0,0 +1,174 @@
+package nes
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// apuState is the emulated state of the APU as it is serialized.
+// The output state (the resampler, the filters and the buffered samples)
+// belongs to the host and is not a part of it, so the audio
+// continues smoothly from the loaded levels
+type apuState struct {
+	Triangle struct {
+		LengthEnabled bool
+		LengthHalt    bool
+		Length        uint8
+		Control       bool
+		LinearReload  uint8
+		LinearCounter uint8
+		ReloadFlag    bool
+		Period        uint16
+		Timer         uint16
+		Step          uint8
+	}
+
+	DMC struct {
+		IRQEnabled   bool
+		Loop         bool
+		Period       uint16
+		Timer        uint16
+		SampleAddr   uint16
+		SampleLength uint16
+		Addr         uint16
+		Remaining    uint16
+		Buffer       uint8
+		HasBuffer    bool
+		Shift        uint8
+		Bits         uint8
+		Silence      bool
+		Level        uint8
+		IRQ          bool
+	}
+
+	FrameCounter struct {
+		Mode         uint8
+		IRQInhibit   bool
+		IRQ          bool
+		Cycles       uint32
+		PendingWrite uint8
+		WriteDelay   uint8
+	}
+
+	Stall  uint16
+	Cycles uint64
+
+	// the triangle length counter writes deferred in the accurate mode
+	LengthPendingLoad bool
+	LengthLoadValue   uint8
+	LengthPendingHalt bool
+	LengthHaltValue   bool
+	LengthClocked     bool
+	DMCFetchAddr      uint16
+}
+
+// SaveState writes the channels, the frame counter, the DMC reader
+// and the interrupt flags
+func (a *APU) SaveState(w io.Writer) error {
+	var s apuState
+	t, d, f := &a.triangle, &a.dmc, &a.frameCounter
+
+	s.Triangle.LengthEnabled = t.length.enabled
+	s.Triangle.LengthHalt = t.length.halt
+	s.Triangle.Length = t.length.value
+	s.Triangle.Control = t.control
+	s.Triangle.LinearReload = t.linearReload
+	s.Triangle.LinearCounter = t.linearCounter
+	s.Triangle.ReloadFlag = t.reloadFlag
+	s.Triangle.Period = t.period
+	s.Triangle.Timer = t.timer
+	s.Triangle.Step = t.step
+
+	s.DMC.IRQEnabled = d.irqEnabled
+	s.DMC.Loop = d.loop
+	s.DMC.Period = d.period
+	s.DMC.Timer = d.timer
+	s.DMC.SampleAddr = d.sampleAddr
+	s.DMC.SampleLength = d.sampleLength
+	s.DMC.Addr = d.addr
+	s.DMC.Remaining = d.remaining
+	s.DMC.Buffer = d.buffer
+	s.DMC.HasBuffer = d.hasBuffer
+	s.DMC.Shift = d.shift
+	s.DMC.Bits = d.bits
+	s.DMC.Silence = d.silence
+	s.DMC.Level = d.level
+	s.DMC.IRQ = d.irq
+
+	s.FrameCounter.Mode = f.mode
+	s.FrameCounter.IRQInhibit = f.irqInhibit
+	s.FrameCounter.IRQ = f.irq
+	s.FrameCounter.Cycles = f.cycles
+	s.FrameCounter.PendingWrite = f.pendingWrite
+	s.FrameCounter.WriteDelay = f.writeDelay
+
+	s.Stall = a.stall
+	s.Cycles = a.cycles
+
+	s.LengthPendingLoad = t.length.pendingLoad
+	s.LengthLoadValue = t.length.loadValue
+	s.LengthPendingHalt = t.length.pendingHalt
+	s.LengthHaltValue = t.length.haltValue
+	s.LengthClocked = t.length.clocked
+	s.DMCFetchAddr = d.fetchAddr
+
+	if err := binary.Write(w, binary.LittleEndian, &s); err != nil {
+		return fmt.Errorf("couldn't write the APU state: %s", err)
+	}
+	return nil
+}
+
+// LoadState reads the state written by SaveState
+func (a *APU) LoadState(r io.Reader) error {
+	var s apuState
+	if err := binary.Read(r, binary.LittleEndian, &s); err != nil {
+		return fmt.Errorf("couldn't read the APU state: %s", err)
+	}
+	t, d, f := &a.triangle, &a.dmc, &a.frameCounter
+
+	t.length.enabled = s.Triangle.LengthEnabled
+	t.length.halt = s.Triangle.LengthHalt
+	t.length.value = s.Triangle.Length
+	t.control = s.Triangle.Control
+	t.linearReload = s.Triangle.LinearReload
+	t.linearCounter = s.Triangle.LinearCounter
+	t.reloadFlag = s.Triangle.ReloadFlag
+	t.period = s.Triangle.Period & 0x7FF
+	t.timer = s.Triangle.Timer
+	t.step = s.Triangle.Step & 0x1F
+
+	d.irqEnabled = s.DMC.IRQEnabled
+	d.loop = s.DMC.Loop
+	d.period = max(s.DMC.Period, 1)
+	d.timer = s.DMC.Timer
+	d.sampleAddr = s.DMC.SampleAddr
+	d.sampleLength = s.DMC.SampleLength
+	d.addr = s.DMC.Addr
+	d.remaining = s.DMC.Remaining
+	d.buffer = s.DMC.Buffer
+	d.hasBuffer = s.DMC.HasBuffer
+	d.shift = s.DMC.Shift
+	d.bits = s.DMC.Bits
+	d.silence = s.DMC.Silence
+	d.level = s.DMC.Level & 0x7F
+	d.irq = s.DMC.IRQ
+
+	f.mode = s.FrameCounter.Mode & 0x1
+	f.irqInhibit = s.FrameCounter.IRQInhibit
+	f.irq = s.FrameCounter.IRQ
+	f.cycles = s.FrameCounter.Cycles
+	f.pendingWrite = s.FrameCounter.PendingWrite
+	f.writeDelay = s.FrameCounter.WriteDelay
+
+	a.stall = s.Stall
+	a.cycles = s.Cycles
+
+	t.length.pendingLoad = s.LengthPendingLoad
+	t.length.loadValue = s.LengthLoadValue
+	t.length.pendingHalt = s.LengthPendingHalt
+	t.length.haltValue = s.LengthHaltValue
+	t.length.clocked = s.LengthClocked
+	d.fetchAddr = s.DMCFetchAddr
+	return nil
+}
@@ -0,0 +1,513 @@
+package nes
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_APU_Triangle(t *testing.T) {
+	a := NewAPU(nil)
+	a.writeRegister(0x4015, 0x04)
+	a.writeRegister(0x4008, 0x81)
+	a.writeRegister(0x400A, 0x02)
+	a.writeRegister(0x400B, 0x08)
+	assert.Equal(t, uint8(254), a.triangle.length.value)
+	assert.Equal(t, uint8(0x04), a.readRegister(0x4015))
+
+	// the linear counter is loaded at the quarter frame
+	a.quarterFrame()
+	assert.Equal(t, uint8(1), a.triangle.linearCounter)
+
+	// the sequencer advances every period+1 cycles
+	var levels []float64
+	for i := 0; i < 9; i++ {
+		a.triangle.clockTimer()
+		levels = append(levels, a.triangle.output())
+	}
+	assert.Equal(t, []float64{14, 14, 14, 13, 13, 13, 12, 12, 12}, levels)
+
+	// ultrasonic periods output the middle level
+	a.writeRegister(0x400A, 0x00)
+	assert.Equal(t, 7.5, a.triangle.output())
+	a.writeRegister(0x400A, 0x02)
+
+	// with the control flag clear the linear counter runs out
+	a.writeRegister(0x4008, 0x01)
+	a.quarterFrame()
+	a.quarterFrame()
+	assert.Equal(t, uint8(0), a.triangle.linearCounter)
+	step := a.triangle.step
+	for i := 0; i < 10; i++ {
+		a.triangle.clockTimer()
+	}
+	assert.Equal(t, step, a.triangle.step, "the sequencer stops")
+
+	// disabling the channel clears the length counter
+	a.writeRegister(0x4015, 0x00)
+	assert.Equal(t, uint8(0), a.readRegister(0x4015))
+}
+
+func Test_APU_FrameCounter(t *testing.T) {
+	a := NewAPU(nil)
+	a.writeRegister(0x4015, 0x04)
+	a.writeRegister(0x400B, 0x18) // length 2
+
+	for i := 0; i < apuFrameIRQCycles-1; i++ {
+		a.Tic()
+	}
+	assert.False(t, a.irq())
+	assert.Equal(t, uint8(1), a.triangle.length.value, "clocked at the half frame")
+	a.Tic()
+	assert.True(t, a.irq())
+	assert.Equal(t, uint8(0x44), a.readRegister(0x4015))
+	assert.False(t, a.irq(), "reading the status clears the flag")
+
+	// the 5-step mode doesn't generate interrupts
+	a.writeRegister(0x4017, 0x80)
+	assert.Equal(t, uint8(0), a.triangle.length.value, "the 5-step mode clocks immediately")
+	for i := 0; i < apuFrameLength5*2; i++ {
+		a.Tic()
+	}
+	assert.False(t, a.irq())
+}
+
+type testMemory [0x10000]uint8
+
+func (m *testMemory) Read8(addr uint16) uint8        { return m[addr] }
+func (m *testMemory) Write8(addr uint16, data uint8) { m[addr] = data }
+
+func Test_APU_DMC(t *testing.T) {
+	mem := &testMemory{}
+	a := NewAPU(mem)
+
+	// 17 bytes at $C040: the first one raises the level, the rest lower it
+	mem[0xC040] = 0xFF
+	a.writeRegister(0x4010, 0x8F) // IRQ, the fastest rate
+	a.writeRegister(0x4011, 0x40)
+	a.writeRegister(0x4012, 0x01)
+	a.writeRegister(0x4013, 0x01)
+	a.writeRegister(0x4015, 0x10)
+	assert.Equal(t, uint8(0x10), a.readRegister(0x4015))
+
+	// the first byte is fetched right away and stalls the CPU
+	a.Tic()
+	assert.Equal(t, uint16(dmcDMACycles), a.takeStall())
+	assert.Equal(t, uint16(16), a.dmc.remaining)
+
+	// the first output cycle is silent, then the byte is loaded into the shifter
+	for i := 0; i < 54*15; i++ {
+		a.Tic()
+	}
+	assert.Equal(t, uint8(0x40+16), a.dmc.level)
+
+	for i := 0; i < 54*8*16; i++ {
+		a.Tic()
+	}
+	assert.Equal(t, uint8(0), a.readRegister(0x4015)&0x10, "the sample is over")
+	assert.True(t, a.irq())
+	assert.Equal(t, uint8(0x80), a.readRegister(0x4015)&0x80)
+
+	// writing $4015 acknowledges the interrupt
+	a.writeRegister(0x4015, 0x00)
+	assert.False(t, a.irq())
+}
+
+func Test_APU_Resampler(t *testing.T) {
+	var out []float32
+	emit := func(sample float32) { out = append(out, sample) }
+	r := blipResampler{ratio: float64(DefaultSampleRate) / cpuFrequency}
+
+	// a step settles at the new level
+	for i := 0; i < cpuFrequency/100; i++ {
+		r.clock(1, emit)
+	}
+	assert.InDelta(t, DefaultSampleRate/100, len(out), 1)
+	assert.InDelta(t, 1, out[len(out)-1], 0.001)
+
+	// a square wave above the Nyquist frequency is filtered out
+	// instead of aliasing into the audible range
+	out = out[:0]
+	for i := 0; i < cpuFrequency/100; i++ {
+		level := float32(1)
+		if i/30%2 == 0 {
+			level = 0
+		}
+		r.clock(level, emit)
+	}
+	for _, sample := range out[blipWidth:] {
+		assert.InDelta(t, 0.5, sample, 0.1)
+	}
+}
+
+func Test_APU_OutputFilters(t *testing.T) {
+	f := newOutputFilters(DefaultSampleRate)
+
+	// the high-pass filters remove the DC offset
+	var sample float32
+	for i := 0; i < DefaultSampleRate/10; i++ {
+		sample = f.apply(0.5)
+	}
+	assert.InDelta(t, 0, sample, 0.001)
+
+	// the low-pass filter attenuates the highest frequencies
+	var peak float32
+	for i := 0; i < DefaultSampleRate/10; i++ {
+		sample = f.apply(float32(i % 2))
+		peak = max(peak, sample)
+	}
+	assert.Less(t, peak, float32(0.4))
+
+	a := NewAPU(nil)
+	a.SetOutputFilters(false)
+	a.emit(0.5)
+	buf := make([]float32, 1)
+	a.ReadSamples(buf)
+	assert.Equal(t, float32(0.5), buf[0])
+}
+
+func Test_APU_ChannelMixer(t *testing.T) {
+	a := NewAPU(nil)
+	// the triangle channel holds its first step level at power-up
+	a.SetChannelVolume(ChannelTriangle, 0)
+	a.writeRegister(0x4011, 0x40)
+	full := a.Output()
+	assert.Greater(t, full, float32(0))
+
+	a.SetChannelVolume(ChannelDMC, 0.5)
+	assert.Less(t, a.Output(), full)
+	assert.Greater(t, a.Output(), float32(0))
+
+	a.SetChannelMuted(ChannelDMC, true)
+	assert.Equal(t, float32(0), a.Output())
+	a.SetChannelMuted(ChannelDMC, false)
+
+	a.SetChannelSolo(ChannelTriangle, true)
+	assert.Equal(t, float32(0), a.Output(), "only the soloed channel is heard")
+	a.SetChannelSolo(ChannelDMC, true)
+	assert.Greater(t, a.Output(), float32(0))
+
+	a.Reset()
+	assert.Equal(t, 0.5, a.ChannelVolume(ChannelDMC), "the settings survive the reset")
+	assert.True(t, a.ChannelSolo(ChannelTriangle))
+
+	c, err := ParseChannel("dmc")
+	assert.NoError(t, err)
+	assert.Equal(t, ChannelDMC, c)
+	assert.Equal(t, "triangle", ChannelTriangle.String())
+	_, err = ParseChannel("pulse3")
+	assert.Error(t, err)
+}
+
+type testExpansion struct {
+	tics  int
+	level float64
+}
+
+func (e *testExpansion) AudioChannel() Channel { return ChannelVRC6 }
+func (e *testExpansion) AudioTic()             { e.tics++ }
+func (e *testExpansion) AudioOutput() float64  { return e.level }
+
+func Test_APU_ExpansionAudio(t *testing.T) {
+	a := NewAPU(&testMemory{})
+	a.SetChannelVolume(ChannelTriangle, 0)
+	e := &testExpansion{level: 15.0 / 61}
+	a.SetExpansionAudio(e)
+
+	a.Tic()
+	assert.Equal(t, 1, e.tics, "the chip is clocked with the APU")
+	// a VRC6 pulse at volume 15 is as loud as a 2A03 pulse
+	assert.InDelta(t, apuPulseLevel, a.Output(), 0.0001)
+
+	a.SetChannelVolume(ChannelVRC6, 0.5)
+	assert.InDelta(t, apuPulseLevel/2, a.Output(), 0.0001)
+	a.SetChannelSolo(ChannelDMC, true)
+	assert.Equal(t, float32(0), a.Output())
+
+	a.Reset()
+	a.Tic()
+	assert.Equal(t, 2, e.tics, "the chip survives the reset")
+}
+
+func Test_APU_RateControl(t *testing.T) {
+	run := func(target int) int {
+		a := NewAPU(&testMemory{})
+		a.SetRateControl(target)
+		for i := 0; i < cpuFrequency/10; i++ {
+			a.Tic()
+		}
+		return a.BufferedSamples()
+	}
+
+	normal := run(0)
+	assert.InDelta(t, DefaultSampleRate/10, normal, 1)
+	// the buffer stays below the target, the rate goes up by 0.5%
+	assert.InDelta(t, float64(normal)*1.005, run(DefaultSampleRate), 2)
+	// the buffer goes above the target, the rate goes down by 0.5%
+	assert.InDelta(t, float64(normal)*0.995, run(1), 2)
+}
+
+func Test_Bus_APUView(t *testing.T) {
+	bus := newTestBus()
+	a := bus.apu
+	a.writeRegister(0x4015, 0x04)
+	a.writeRegister(0x4008, 0x81)
+	a.writeRegister(0x400A, 0xFD)
+	a.writeRegister(0x400B, 0x08)
+	a.writeRegister(0x4010, 0x4F)
+	a.writeRegister(0x4011, 0x7F)
+	for i := 0; i < cpuFrequency/100; i++ {
+		a.Tic()
+	}
+
+	view := bus.APUView()
+	assert.Equal(t, 4, view.FrameCounterMode)
+	assert.Equal(t, uint16(0xFD), view.Triangle.Period)
+	assert.InDelta(t, 220, view.Triangle.Frequency, 0.5)
+	assert.Equal(t, lengthTable[1], view.Triangle.Length)
+	assert.True(t, view.Triangle.LengthHalt)
+	assert.True(t, view.DMC.Loop)
+	assert.Equal(t, uint8(0x7F), view.DMC.Level)
+	assert.Nil(t, view.Expansion)
+
+	// the DMC holds the top level, the triangle goes up and down
+	assert.Equal(t, scopeTrace, view.DMC.Scope.RGBAAt(100, 0))
+	traced := map[int]bool{}
+	for y := 0; y < scopeHeight; y++ {
+		for x := 0; x < scopeLength; x++ {
+			if view.Triangle.Scope.RGBAAt(x, y) == scopeTrace {
+				traced[y] = true
+			}
+		}
+	}
+	assert.True(t, traced[0] && traced[scopeHeight-1], "the scope shows the full wave")
+}
+
+func Test_APU_State(t *testing.T) {
+	mem := &testMemory{}
+	for i := range mem {
+		mem[i] = uint8(i * 7)
+	}
+	setup := func(a *APU) {
+		a.writeRegister(0x4015, 0x14)
+		a.writeRegister(0x4008, 0x20)
+		a.writeRegister(0x400A, 0x40)
+		a.writeRegister(0x400B, 0x18)
+		a.writeRegister(0x4010, 0xCE)
+		a.writeRegister(0x4012, 0x10)
+		a.writeRegister(0x4013, 0x20)
+		a.writeRegister(0x4015, 0x14)
+	}
+
+	a := NewAPU(mem)
+	setup(a)
+	for i := 0; i < 12345; i++ {
+		a.Tic()
+	}
+	var state bytes.Buffer
+	assert.NoError(t, a.SaveState(&state))
+
+	b := NewAPU(mem)
+	assert.NoError(t, b.LoadState(bytes.NewReader(state.Bytes())))
+	for i := 0; i < 50000; i++ {
+		a.Tic()
+		b.Tic()
+		if !assert.Equal(t, a.Output(), b.Output(), "cycle %d", i) {
+			break
+		}
+	}
+	assert.Equal(t, a.irq(), b.irq())
+	assert.Equal(t, a.readRegister(0x4015), b.readRegister(0x4015))
+	assert.Equal(t, a.dmc.fetchAddr, b.dmc.fetchAddr)
+
+	assert.Error(t, b.LoadState(bytes.NewReader(state.Bytes()[:10])))
+
+	// the length counter write waiting for the frame counter clock
+	a.SetAccuracy(true)
+	b.SetAccuracy(true)
+	a.writeRegister(0x4008, 0x80)
+	a.writeRegister(0x400B, 0x08)
+	state.Reset()
+	assert.NoError(t, a.SaveState(&state))
+	assert.NoError(t, b.LoadState(bytes.NewReader(state.Bytes())))
+	a.Tic()
+	b.Tic()
+	assert.Equal(t, a.triangle.length, b.triangle.length)
+}
+
+func Test_APU_Stereo(t *testing.T) {
+	a := NewAPU(&testMemory{})
+	a.SetOutputFilters(false)
+	a.SetStereo(true)
+	a.SetChannelPan(ChannelTriangle, -1)
+	a.SetChannelPan(ChannelDMC, 0.5)
+	a.writeRegister(0x4011, 0x7F)
+	for i := 0; i < cpuFrequency/100; i++ {
+		a.Tic()
+	}
+	assert.InDelta(t, DefaultSampleRate/100, a.BufferedSamples(), 1)
+
+	buf := make([]float32, 3)
+	assert.Equal(t, 2, a.ReadSamples(buf), "only whole samples are read")
+	buf = make([]float32, DefaultSampleRate)
+	n := a.ReadSamples(buf)
+	left, right := buf[n-2], buf[n-1]
+	assert.InDelta(t, a.mix(sideLeft), left, 0.001)
+	assert.InDelta(t, a.mix(sideRight), right, 0.001)
+
+	// the triangle is on the left only, the DMC is at the half level on the left
+	a.SetChannelMuted(ChannelTriangle, true)
+	assert.InDelta(t, right, a.mix(sideRight), 0.001)
+	assert.Less(t, float64(a.mix(sideLeft)), float64(right))
+	assert.Greater(t, a.mix(sideLeft), float32(0))
+
+	a.Reset()
+	assert.True(t, a.Stereo())
+	assert.Equal(t, -1.0, a.ChannelPan(ChannelTriangle))
+}
+
+func Test_APU_WriteLog(t *testing.T) {
+	a := NewAPU(&testMemory{})
+	a.writeRegister(0x4015, 0x0F)
+	a.SetWriteLogging(true)
+	a.writeRegister(0x4015, 0x04)
+	for i := 0; i < 12; i++ {
+		a.Tic()
+	}
+	a.Reset()
+	a.writeRegister(0x4008, 0x81)
+	a.SetExpansionAudio(&testExpansion{})
+	a.logExpansionWrite(0x9000, 0x3F)
+	a.logExpansionWrite(0x8000, 0x01)
+
+	assert.Equal(t, []APUWrite{
+		{Cycle: 0, Addr: 0x4015, Data: 0x04},
+		{Cycle: 12, Addr: 0x4008, Data: 0x81},
+		{Cycle: 12, Addr: 0x9000, Data: 0x3F},
+	}, a.Writes())
+
+	var out bytes.Buffer
+	assert.NoError(t, a.WriteLog(&out))
+	assert.Equal(t, "# nestic APU write log\n# clock 1789773\n# expansion vrc6\n# cycle addr data\n"+
+		"0 4015 04\n12 4008 81\n12 9000 3F\n", out.String())
+}
+
+func Test_APU_Accuracy(t *testing.T) {
+	run := func(accurate bool) *APU {
+		a := NewAPU(&testMemory{})
+		a.SetAccuracy(accurate)
+		a.writeRegister(0x4015, 0x04)
+		a.writeRegister(0x400B, 0x18) // length 2
+		a.Tic()
+		// the write happens at the cycle of the half frame clock
+		a.frameCounter.cycles = apuFrameStep2 - 1
+		a.writeRegister(0x400B, 0x08) // length 254
+		a.writeRegister(0x4008, 0x80) // halt
+		a.Tic()
+		return a
+	}
+
+	a := run(false)
+	assert.Equal(t, uint8(254), a.triangle.length.value)
+	a = run(true)
+	assert.Equal(t, uint8(1), a.triangle.length.value, "the reload is ignored, the clock sees the old halt flag")
+	assert.True(t, a.triangle.length.halt)
+
+	// the sequencer restarts 3 or 4 cycles after the $4017 write
+	for cycles, delay := range []int{3, 4} {
+		a = NewAPU(&testMemory{})
+		a.SetAccuracy(true)
+		a.cycles = uint64(cycles)
+		a.writeRegister(0x4017, 0x80)
+		for i := 0; i < delay-1; i++ {
+			a.Tic()
+		}
+		assert.Equal(t, uint8(0), a.frameCounter.mode)
+		a.Tic()
+		assert.Equal(t, uint8(1), a.frameCounter.mode)
+	}
+
+	// the $4015 read at the cycle the frame interrupt flag is set
+	for _, accurate := range []bool{false, true} {
+		a = NewAPU(&testMemory{})
+		a.SetAccuracy(accurate)
+		for i := 0; i < apuFrameIRQCycles-1; i++ {
+			a.Tic()
+		}
+		status := a.readRegister(0x4015)
+		a.Tic()
+		if accurate {
+			assert.Equal(t, uint8(0x40), status, "the flag reads back set")
+			assert.True(t, a.irq(), "and isn't cleared")
+		} else {
+			assert.Equal(t, uint8(0), status)
+		}
+		for i := 0; i < 2; i++ {
+			a.Tic()
+		}
+		a.readRegister(0x4015)
+		assert.False(t, a.irq(), "the read after the last cycle of the flag clears it")
+	}
+}
+
+func Test_APU_SetSampleOutput(t *testing.T) {
+	a := NewAPU(&testMemory{})
+	a.SetSampleOutput(false)
+	a.Reset()
+	for i := 0; i < cpuFrequency/100; i++ {
+		a.Tic()
+	}
+	assert.Equal(t, 0, a.BufferedSamples(), "the samples are dropped")
+
+	a.SetSampleOutput(true)
+	for i := 0; i < cpuFrequency/100; i++ {
+		a.Tic()
+	}
+	assert.InDelta(t, DefaultSampleRate/100, a.BufferedSamples(), 1)
+}
+
+func Test_APU_SetSlowMotion(t *testing.T) {
+	a := NewAPU(&testMemory{})
+	a.SetSlowMotion(0.5)
+	a.Reset()
+	for i := 0; i < cpuFrequency/100; i++ {
+		a.Tic()
+	}
+	assert.InDelta(t, DefaultSampleRate/50, a.BufferedSamples(), 1, "the sound is stretched twice")
+
+	a.SetSlowMotion(0)
+	a.ReadSamples(make([]float32, DefaultSampleRate))
+	for i := 0; i < cpuFrequency/100; i++ {
+		a.Tic()
+	}
+	assert.InDelta(t, DefaultSampleRate/100, a.BufferedSamples(), 1)
+}
+
+func Test_APU_SetSampleTap(t *testing.T) {
+	a := NewAPU(&testMemory{})
+	tapped := 0
+	a.SetSampleTap(func(float32) {
+		tapped++
+	})
+	a.SetSampleOutput(false)
+	for i := 0; i < cpuFrequency/100; i++ {
+		a.Tic()
+	}
+	assert.InDelta(t, DefaultSampleRate/100, tapped, 1, "the tap sees the dropped samples")
+	assert.Equal(t, 0, a.BufferedSamples())
+
+	// the left and the right values
+	a.SetStereo(true)
+	tapped = 0
+	for i := 0; i < cpuFrequency/100; i++ {
+		a.Tic()
+	}
+	assert.InDelta(t, 2*DefaultSampleRate/100, tapped, 2)
+	allocs := testing.AllocsPerRun(10, func() {
+		for i := 0; i < 1000; i++ {
+			a.Tic()
+		}
+	})
+	assert.Zero(t, allocs, "the tap doesn't allocate")
+}
@@ -0,0 +1,73 @@
+package nes
+
+// triangleSequence is the 32-step output of the triangle channel
+var triangleSequence = [32]uint8{
+	15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0,
+	0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+}
+
+// triangleChannel generates the triangle wave.
+// Unlike the other channels it has no volume control,
+// it is silenced by the linear and length counters
+type triangleChannel struct {
+	length lengthCounter
+
+	control       bool // halts the length counter and keeps reloading the linear counter
+	linearReload  uint8
+	linearCounter uint8
+	reloadFlag    bool
+
+	period uint16 // 11-bit timer period
+	timer  uint16
+	step   uint8
+}
+
+func (t *triangleChannel) write(addr uint16, data uint8) {
+	switch addr {
+	case 0x4008:
+		t.control = data&0x80 != 0
+		t.length.setHalt(t.control)
+		t.linearReload = data & 0x7F
+	case 0x400A:
+		t.period = t.period&0x700 | uint16(data)
+	case 0x400B:
+		t.period = t.period&0x0FF | uint16(data&0x07)<<8
+		t.length.load(data >> 3)
+		t.reloadFlag = true
+	}
+}
+
+// clockTimer is called every CPU cycle.
+// The sequencer advances only when both counters are non-zero
+func (t *triangleChannel) clockTimer() {
+	if t.timer > 0 {
+		t.timer--
+		return
+	}
+	t.timer = t.period
+	if t.linearCounter > 0 && t.length.value > 0 {
+		t.step = (t.step + 1) & 0x1F
+	}
+}
+
+// clockLinear is called every quarter frame
+func (t *triangleChannel) clockLinear() {
+	if t.reloadFlag {
+		t.linearCounter = t.linearReload
+	} else if t.linearCounter > 0 {
+		t.linearCounter--
+	}
+	if !t.control {
+		t.reloadFlag = false
+	}
+}
+
+// output returns the channel level 0-15
+func (t *triangleChannel) output() float64 {
+	// periods below 2 produce ultrasonic frequencies, the TV and the output
+	// filters average them out to the middle of the wave
+	if t.period < 2 && t.linearCounter > 0 && t.length.value > 0 {
+		return 7.5
+	}
+	return float64(triangleSequence[t.step])
+}
@@ -0,0 +1,169 @@
+package nes
+
+import (
+	"image"
+	"image/color"
+)
+
+// scopeLength is the number of the output samples the channel scopes keep,
+// about 6ms at 44.1kHz
+const scopeLength = 256
+
+const scopeHeight = 64
+
+var (
+	scopeBackground = color.RGBA{0, 0, 0, 255}
+	scopeAxis       = color.RGBA{48, 48, 48, 255}
+	scopeTrace      = color.RGBA{0, 255, 0, 255}
+)
+
+// channelScopes records the levels of the channels at the output rate
+type channelScopes struct {
+	levels [channelCount][scopeLength]float32 // 0-1
+	pos    int
+}
+
+func (s *channelScopes) record(c Channel, level float64) {
+	s.levels[c][s.pos] = float32(level)
+}
+
+func (s *channelScopes) advance() {
+	s.pos = (s.pos + 1) % scopeLength
+}
+
+// image draws the recorded levels of the channel, the oldest on the left
+func (s *channelScopes) image(c Channel) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, scopeLength, scopeHeight))
+	for y := 0; y < scopeHeight; y++ {
+		for x := 0; x < scopeLength; x++ {
+			img.SetRGBA(x, y, scopeBackground)
+		}
+	}
+	for x := 0; x < scopeLength; x++ {
+		img.SetRGBA(x, scopeHeight/2, scopeAxis)
+	}
+
+	prev := -1
+	for x := 0; x < scopeLength; x++ {
+		level := max(0, min(s.levels[c][(s.pos+x)%scopeLength], 1))
+		y := scopeHeight - 1 - int(level*(scopeHeight-1))
+		if prev < 0 {
+			prev = y
+		}
+		// connect to the previous sample so the edges are visible
+		for i := min(y, prev); i <= max(y, prev); i++ {
+			img.SetRGBA(x, i, scopeTrace)
+		}
+		prev = y
+	}
+	return img
+}
+
+// recordScopes records the channel levels for the scopes
+func (a *APU) recordScopes() {
+	a.scopes.record(ChannelTriangle, a.triangle.output()/15)
+	a.scopes.record(ChannelDMC, a.dmc.output()/127)
+	if a.expansion != nil {
+		if c := a.expansion.AudioChannel(); c >= 0 && c < channelCount {
+			a.scopes.record(c, a.expansion.AudioOutput())
+		}
+	}
+	a.scopes.advance()
+}
+
+// APUView is a snapshot of the APU channels.
+// The scopes are 256x64 images of the last channel levels
+type APUView struct {
+	FrameCounterMode int // 4 or 5 steps
+	FrameIRQ         bool
+
+	Triangle  TriangleState
+	DMC       DMCState
+	Expansion *ExpansionState // nil without an expansion chip
+}
+
+// TriangleState is the state of the triangle channel.
+// It has no volume control, the counters silence it
+type TriangleState struct {
+	Period    uint16
+	Frequency float64 // Hz
+	Step      uint8
+	Level     uint8 // 0-15
+
+	Length       uint8
+	LengthHalt   bool
+	Linear       uint8
+	LinearReload uint8
+
+	Scope *image.RGBA
+}
+
+// DMCState is the state of the DMC channel
+type DMCState struct {
+	Period     uint16
+	Rate       float64 // bits per second
+	Loop       bool
+	IRQEnabled bool
+	IRQ        bool
+	Level      uint8 // 0-127
+
+	SampleAddr   uint16
+	SampleLength uint16
+	Addr         uint16 // address of the next sample byte
+	Remaining    uint16 // bytes left
+
+	Scope *image.RGBA
+}
+
+// ExpansionState is the state of the expansion sound chip
+type ExpansionState struct {
+	Channel Channel
+	Level   float64 // 0-1
+
+	Scope *image.RGBA
+}
+
+// APUView returns the state of the APU channels
+func (b *Bus) APUView() APUView {
+	a := b.apu
+	t, d := &a.triangle, &a.dmc
+	view := APUView{
+		FrameCounterMode: 4 + int(a.frameCounter.mode),
+		FrameIRQ:         a.frameCounter.irq,
+		Triangle: TriangleState{
+			Period:       t.period,
+			Frequency:    cpuFrequency / (32 * (float64(t.period) + 1)),
+			Step:         t.step,
+			Level:        triangleSequence[t.step],
+			Length:       t.length.value,
+			LengthHalt:   t.length.halt,
+			Linear:       t.linearCounter,
+			LinearReload: t.linearReload,
+			Scope:        a.scopes.image(ChannelTriangle),
+		},
+		DMC: DMCState{
+			Period:       d.period,
+			Rate:         cpuFrequency / float64(d.period),
+			Loop:         d.loop,
+			IRQEnabled:   d.irqEnabled,
+			IRQ:          d.irq,
+			Level:        d.level,
+			SampleAddr:   d.sampleAddr,
+			SampleLength: d.sampleLength,
+			Addr:         d.addr,
+			Remaining:    d.remaining,
+			Scope:        a.scopes.image(ChannelDMC),
+		},
+	}
+	if a.expansion != nil {
+		c := a.expansion.AudioChannel()
+		view.Expansion = &ExpansionState{
+			Channel: c,
+			Level:   a.expansion.AudioOutput(),
+		}
+		if c >= 0 && c < channelCount {
+			view.Expansion.Scope = a.scopes.image(c)
+		}
+	}
+	return view
+}
@@ -0,0 +1,125 @@
+package nes
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// the opcodes by their names and addressing modes,
+// the documented opcode of the name and the mode goes first
+var opcodesByName = func() map[string]map[addrMode]uint8 {
+	ops := map[string]map[addrMode]uint8{}
+	for op := range 0x100 {
+		name, mode := opcodeNames[op], opcodeModes[op]
+		if ops[name] == nil {
+			ops[name] = map[addrMode]uint8{}
+		}
+		if prev, ok := ops[name][mode]; !ok || unofficial(prev) && !unofficial(uint8(op)) {
+			ops[name][mode] = uint8(op)
+		}
+	}
+	return ops
+}()
+
+// Assemble encodes the instructions to run at the address. The
+// instructions are separated by the slashes or the new lines, e.g.
+// LDA #$01 / STA $0300,X / RTS. The numbers are $hex or decimal, the
+// 2-digit hex addresses are of the zero page, and the branches take
+// the address of the target
+func Assemble(addr uint16, source string) ([]uint8, error) {
+	var code []uint8
+	for _, line := range strings.FieldsFunc(source, func(r rune) bool { return r == '/' || r == '\n' }) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		bytes, err := assembleInstruction(addr+uint16(len(code)), line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid instruction %q: %s", line, err)
+		}
+		code = append(code, bytes...)
+	}
+	if len(code) == 0 {
+		return nil, fmt.Errorf("no instructions")
+	}
+	return code, nil
+}
+
+func assembleInstruction(addr uint16, line string) ([]uint8, error) {
+	name, operand, _ := strings.Cut(line, " ")
+	modes, ok := opcodesByName[strings.ToUpper(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown instruction %s", name)
+	}
+	operand = strings.ToUpper(strings.ReplaceAll(operand, " ", ""))
+
+	if _, ok := modes[addrModeREL]; ok {
+		target, _, err := parseOperandNumber(operand)
+		if err != nil {
+			return nil, err
+		}
+		offset := int(target) - int(addr+2)
+		if offset < -128 || offset > 127 {
+			return nil, fmt.Errorf("the target $%04X is too far", target)
+		}
+		return []uint8{modes[addrModeREL], uint8(offset)}, nil
+	}
+
+	var zp, abs addrMode // the modes of the short and the long address
+	switch {
+	case operand == "" || operand == "A":
+		if op, ok := modes[addrModeIMP]; ok && operand == "" {
+			return []uint8{op}, nil
+		}
+		if op, ok := modes[addrModeACC]; ok {
+			return []uint8{op}, nil
+		}
+		return nil, fmt.Errorf("the operand is missing")
+	case strings.HasPrefix(operand, "#"):
+		operand, zp = operand[1:], addrModeIMM
+	case strings.HasPrefix(operand, "(") && strings.HasSuffix(operand, ",X)"):
+		operand, zp = operand[1:len(operand)-3], addrModeINDX
+	case strings.HasPrefix(operand, "(") && strings.HasSuffix(operand, "),Y"):
+		operand, zp = operand[1:len(operand)-3], addrModeINDY
+	case strings.HasPrefix(operand, "(") && strings.HasSuffix(operand, ")"):
+		operand, abs = operand[1:len(operand)-1], addrModeIND
+	case strings.HasSuffix(operand, ",X"):
+		operand, zp, abs = operand[:len(operand)-2], addrModeZPX, addrModeABSX
+	case strings.HasSuffix(operand, ",Y"):
+		operand, zp, abs = operand[:len(operand)-2], addrModeZPY, addrModeABSY
+	default:
+		zp, abs = addrModeZP, addrModeABS
+	}
+	v, long, err := parseOperandNumber(operand)
+	if err != nil {
+		return nil, err
+	}
+	if op, ok := modes[zp]; ok && zp != 0 && !long && v <= 0xFF {
+		return []uint8{op, uint8(v)}, nil
+	}
+	if op, ok := modes[abs]; ok && abs != 0 {
+		return []uint8{op, uint8(v), uint8(v >> 8)}, nil
+	}
+	if zp == addrModeIMM || zp == addrModeINDX || zp == addrModeINDY {
+		if _, ok := modes[zp]; ok {
+			return nil, fmt.Errorf("the operand $%X is over a byte", v)
+		}
+	}
+	return nil, fmt.Errorf("no such addressing mode of %s", strings.ToUpper(name))
+}
+
+// parseOperandNumber parses $hex or decimal, long is the hex
+// number of more than 2 digits
+func parseOperandNumber(s string) (v uint16, long bool, err error) {
+	base := 10
+	if strings.HasPrefix(s, "$") {
+		s, base = s[1:], 16
+		long = len(s) > 2
+	}
+	n, err := strconv.ParseUint(s, base, 16)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid number %q", s)
+	}
+	return uint16(n), long, nil
+}
@@ -0,0 +1,46 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Assemble(t *testing.T) {
+	code, err := Assemble(0xC123, "LDA #$01 / sta $0300,x\n  ldx 16 / ASL / BNE $C123 / JMP ($FFFC) / RTS")
+	require.NoError(t, err)
+	assert.Equal(t, []uint8{
+		0xA9, 0x01,
+		0x9D, 0x00, 0x03,
+		0xA6, 0x10,
+		0x0A,
+		0xD0, 0xF6,
+		0x6C, 0xFC, 0xFF,
+		0x60,
+	}, code)
+
+	code, err = Assemble(0, "LDA $0010 / LDA $10,Y / NOP")
+	require.NoError(t, err)
+	assert.Equal(t, []uint8{0xAD, 0x10, 0x00, 0xB9, 0x10, 0x00, 0xEA}, code, "no zero page LDA $10,Y")
+
+	for _, source := range []string{"", "FOO", "LDA", "LDA #$100", "STX $1234,Y", "BNE $9000", "LDA $GG", "LDA ($10,Y)"} {
+		_, err := Assemble(0x8000, source)
+		assert.Error(t, err, source)
+	}
+}
+
+func Test_Assemble_Disassemble(t *testing.T) {
+	bus := newTestBus()
+	for op := range 0x100 {
+		name, mode := opcodeNames[op], opcodeModes[op]
+		if opcodesByName[name][mode] != uint8(op) {
+			continue // the other opcode of the same instruction
+		}
+		bytes := []uint8{uint8(op), 0x34, 0x92}[:1+mode.operandSize()]
+		copy(bus.cart.pgrMem, bytes)
+		code, err := Assemble(0x8000, bus.Disassemble(0x8000).Text)
+		require.NoError(t, err, "%02X", op)
+		assert.Equal(t, bytes, code, "%02X", op)
+	}
+}
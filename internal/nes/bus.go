@@ -1,37 +1,235 @@
 package nes
 
+import "log"
+
 type Bus struct {
 	cpu  *CPU
 	ppu  *PPU
+	apu  *APU
 	ram  *RAM
 	cart *Cart
 
+	controllers   [4]Controller // 3 and 4 are read through the Four Score
+	portDevices   [2]PortDevice // plugged instead of the controllers 1 and 2
+	fourScore     fourScore
+	expansionPort ExpansionDevice // the device on the Famicom expansion port
+	microphone    bool            // the microphone of the Famicom controller 2 picks up sound
+	movie         movieState
+	input         inputState
+
+	renderMode RenderMode // render mode requested by the user
+	events     eventLog
+
 	ticCounter uint64
+	oamDMAEnd  uint64 // the dot the OAM DMA in progress ends at
+
+	profile *Profile        // nil: not profiling
+	cycles  *cycleCounter   // nil: not counting the cycles
+	cdl     *codeDataLogger // nil: no code/data log
+	trace   *tracer         // nil: not tracing
+	symbols Symbols         // the labels of the disassembly
+
+	patches []ROMPatch  // the Game Genie codes
+	freezes []RAMFreeze // the raw RAM codes
+
+	debug       DebugHooks      // nil: not debugging
+	debugEvents DebugEventHooks // nil: the events aren't watched
+	debugBreak  bool            // a hook broke, RunFrame returns
 }
 
 func NewBus() *Bus {
 	b := &Bus{}
 	b.ram = NewRAM()
 	b.cpu = NewCPU(b.newCpuMemory())
-	b.ppu = NewPPU()
+	b.ppu = NewPPU(b.newPpuMemory())
+	b.apu = NewAPU(b.newCpuMemory())
 	return b
 }
 
 func (b *Bus) LoadCart(cart *Cart) {
 	b.cart = cart
+	b.ppu.SetRegion(cart.region)
+	b.applyRenderMode()
+	// the sound chip of the cartridge is mixed with the APU output
+	b.apu.SetExpansionAudio(nil)
+	if e, ok := cart.mapper.(ExpansionAudio); ok {
+		b.apu.SetExpansionAudio(e)
+	}
 	b.cpu.Reset()
 }
 
 func (b *Bus) Reset() {
 	b.cpu.Reset()
+	b.ppu.Reset()
+	b.apu.Reset()
 	b.ticCounter = 0
 }
 
+// PPU returns the picture processing unit of the console
+func (b *Bus) PPU() *PPU {
+	return b.ppu
+}
+
+// APU returns the audio processing unit of the console
+func (b *Bus) APU() *APU {
+	return b.apu
+}
+
+// Region returns the TV system the console works in
+func (b *Bus) Region() Region {
+	return b.ppu.region
+}
+
+// Cart returns the loaded cartridge, nil before one is loaded
+func (b *Bus) Cart() *Cart {
+	return b.cart
+}
+
+// RAM returns the 2 KB of the console work RAM
+func (b *Bus) RAM() *RAM {
+	return b.ram
+}
+
+// Controller returns the controller plugged into the port 0 or 1,
+// or into the port 2 or 3 of the Four Score
+func (b *Bus) Controller(port int) *Controller {
+	return &b.controllers[port&0x3]
+}
+
+// SetRenderMode sets how the PPU produces the picture.
+// Games known to break with the scanline renderer
+// fall back to the dot renderer
+func (b *Bus) SetRenderMode(m RenderMode) {
+	b.renderMode = m
+	b.applyRenderMode()
+}
+
+func (b *Bus) applyRenderMode() {
+	mode := b.renderMode
+	if mode != RenderModeDot && b.cart != nil {
+		if info, ok := romDatabase[b.cart.crc]; ok && info.needsDotRenderer {
+			log.Printf("%s needs the dot renderer, falling back from the %s renderer\n", info.name, mode)
+			mode = RenderModeDot
+		}
+	}
+	b.ppu.SetRenderMode(mode)
+}
+
+// Tic advances the console by one PPU dot.
+// The CPU runs every third dot, interleaved with the PPU,
+// so register writes land on the dot they happen at
 func (b *Bus) Tic() {
-	// FIXME: use cpu and ppu cycles to sync
+	if b.profile != nil && b.ticCounter%profileInterval == 0 {
+		b.profiledTic()
+		return
+	}
 	b.ppu.Tic()
+	b.watchEvents()
 	if b.ticCounter%3 == 0 {
-		b.cpu.Tic()
+		b.cpuTic()
+		b.apuTic()
 	}
 	b.ticCounter++
 }
+
+func (b *Bus) cpuTic() {
+	if b.trace != nil && b.cpu.fetching() {
+		b.traceInstruction()
+	}
+	if b.cdl != nil && b.cpu.fetching() {
+		b.logCode()
+	}
+	b.watchInterrupt()
+	b.cpu.Tic()
+	if b.cycles != nil {
+		b.countCycle()
+	}
+	if b.debug != nil {
+		b.debugInstruction()
+	}
+	// the NMI line is sampled at the end of the CPU cycle,
+	// after the cycle had a chance to read PPUSTATUS
+	nmi := b.ppu.nmiLine()
+	if nmi && !b.cpu.nmiLine {
+		b.logEvent(EventNMI, 0xFFFA, 0)
+	}
+	b.cpu.setNMI(nmi)
+	b.watchInstruction()
+}
+
+func (b *Bus) apuTic() {
+	b.apu.Tic()
+	if b.apu.takeStall() > 0 {
+		b.logEvent(EventDMCDMA, b.apu.dmc.fetchAddr, b.apu.dmc.buffer)
+		if b.cdl != nil {
+			b.markCDL(b.apu.dmc.fetchAddr, CDLPCM)
+		}
+		b.dmcDMA()
+	}
+	irq := b.apu.irq()
+	if irq && !b.cpu.irqLine {
+		b.logEvent(EventIRQ, 0xFFFE, 0)
+	}
+	b.cpu.irqLine = irq
+}
+
+// RunFrame runs the console until the PPU completes a frame
+// or a debug hook breaks
+func (b *Bus) RunFrame() {
+	b.debugBreak = false
+	for frame := b.ppu.frameCount; b.ppu.frameCount == frame && !b.debugBreak; {
+		b.Tic()
+	}
+}
+
+// oamDMA copies the CPU page $XX00-$XXFF into the PPU OAM
+// and stalls the CPU while the copy is in progress
+func (b *Bus) oamDMA(page uint8) {
+	addr := uint16(page) << 8
+	b.logEvent(EventOAMDMA, addr, page)
+	// DMA writes go through OAMDATA
+	for i := uint16(0); i < 0x100; i++ {
+		b.ppu.writeRegister(0x4, b.cpu.read8(addr|i))
+	}
+	// one more cycle to align with a read cycle on odd cpu cycles
+	stall := uint16(513)
+	if b.cpu.totalCycles%2 == 1 {
+		stall++
+	}
+	b.cpu.Stall(stall)
+	b.oamDMAEnd = b.ticCounter + uint64(stall)*3
+}
+
+// dmcDMA halts the CPU while the DMC fetches a sample byte.
+// The DMA takes a halt cycle, a dummy cycle, an alignment cycle when
+// the fetch would land on a put cycle, and the fetch. The halt waits for
+// a read cycle, so a write overlaps it. During the OAM DMA the fetch takes
+// two of its cycles.
+//
+// The halted CPU repeats its read: registers with read side effects see
+// an extra read, it deletes a bit of the controller data or skips
+// a byte of $2007
+func (b *Bus) dmcDMA() {
+	c := b.cpu
+	if b.ticCounter < b.oamDMAEnd {
+		c.Stall(2)
+		return
+	}
+
+	stall := uint16(3)
+	if c.totalCycles%2 == 1 {
+		stall++
+	}
+	if c.pendingWrite() {
+		stall--
+	} else if addr, ok := c.pendingRead(); ok && dmaConflictRegister(addr) {
+		b.newCpuMemory().Read8(addr)
+	}
+	c.Stall(stall)
+}
+
+// dmaConflictRegister reports whether the repeated read
+// of the address has side effects
+func dmaConflictRegister(addr uint16) bool {
+	return addr >= 0x2000 && addr < 0x4000 || addr == 0x4016 || addr == 0x4017
+}
@@ -1,6 +1,9 @@
 package nes
 
 import (
+	"bytes"
+	"hash/crc32"
+	"image"
 	"os"
 	"regexp"
 	"strconv"
@@ -8,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_BusTic_Nestest(t *testing.T) {
@@ -118,3 +122,122 @@ func Test_BusTic_Nestest(t *testing.T) {
 		}
 	}
 }
+
+func Test_Bus_DMCDMA(t *testing.T) {
+	bus := newTestBus()
+	c := bus.cpu
+	decode := func(opcode uint8, addr uint16) {
+		c.op = &c.instrs[opcode]
+		c.opcode = opcode
+		c.addrMode = c.op.mode
+		c.operandAddr = addr
+		c.cycles = 1
+		c.stall = 0
+	}
+
+	// the halted LDA $2007 reads the register once more
+	setPpuAddr(bus.ppu, 0x2000)
+	c.totalCycles = 10
+	decode(0xAD, 0x2007)
+	bus.dmcDMA()
+	assert.Equal(t, uint16(0x2001), bus.ppu.v)
+	assert.Equal(t, uint16(3), c.stall)
+
+	// an odd cycle needs the alignment cycle
+	c.totalCycles = 11
+	decode(0xAD, 0x0000)
+	bus.dmcDMA()
+	assert.Equal(t, uint16(4), c.stall)
+
+	// the write overlaps the halt cycle
+	c.totalCycles = 11
+	decode(0x8D, 0x2007)
+	bus.dmcDMA()
+	assert.Equal(t, uint16(3), c.stall)
+	assert.Equal(t, uint16(0x2001), bus.ppu.v, "the write is not repeated")
+
+	// the fetch during the OAM DMA
+	c.stall = 0
+	bus.oamDMA(0x02)
+	stall := c.stall
+	bus.dmcDMA()
+	assert.Equal(t, stall+2, c.stall)
+}
+
+func Test_Bus_RunFrame(t *testing.T) {
+	bus := newTestBus()
+	bus.Reset()
+
+	frames := 0
+	bus.ppu.OnFrame(func(*image.RGBA) {
+		frames++
+	})
+	bus.RunFrame()
+	bus.RunFrame()
+	assert.Equal(t, 2, frames)
+	assert.Equal(t, uint64(2), bus.ppu.frameCount)
+}
+
+func Test_Bus_Instances(t *testing.T) {
+	// the consoles share no state: one runs the same frames
+	// alone and next to another one
+	alone := newSnapshotBus()
+	for i := 0; i < 4; i++ {
+		alone.RunFrame()
+	}
+
+	a, b := newSnapshotBus(), newSnapshotBus()
+	b.cart.chrMem[0] = 0xFF
+	for i := 0; i < 4; i++ {
+		a.RunFrame()
+		b.SetInput([4]Button{ButtonStart})
+		b.RunFrame()
+		b.RunFrame()
+	}
+	assert.Equal(t, alone.ppu.FrameHash(), a.ppu.FrameHash())
+	assert.Equal(t, alone.ram.ram, a.ram.ram)
+	assert.Equal(t, uint8(3), a.ram.Read8(0x11), "the first frame starts before the NMI is on")
+	assert.Equal(t, uint8(7), b.ram.Read8(0x11))
+}
+
+// forgeCRC sets the last 4 bytes of the data so that its CRC32 is crc
+func forgeCRC(data []uint8, crc uint32) {
+	n := len(data) - 4
+	reg := ^crc32.ChecksumIEEE(data[:n])
+	// the table indices taking the register to the CRC, found backwards
+	var indices [4]uint8
+	r := ^crc
+	for i := 3; i >= 0; i-- {
+		for j, v := range crc32.IEEETable {
+			if v>>24 == r>>24 {
+				indices[i] = uint8(j)
+				r = (r ^ v) << 8
+				break
+			}
+		}
+	}
+	for i, index := range indices {
+		data[n+i] = uint8(reg) ^ index
+		reg = reg>>8 ^ crc32.IEEETable[index]
+	}
+}
+
+func Test_Bus_SetRenderMode_ROMDatabase(t *testing.T) {
+	load := func(crc uint32) *Bus {
+		rom := make([]uint8, 16+2*prgBankSizeBytes+chrBankSizeBytes)
+		copy(rom, "NES\x1a\x02\x01")
+		if crc != 0 {
+			forgeCRC(rom[16:], crc)
+		}
+		cart, err := NewCart(bytes.NewReader(rom))
+		require.NoError(t, err)
+		bus := NewBus()
+		bus.LoadCart(cart)
+		bus.SetRenderMode(RenderModeScanline)
+		return bus
+	}
+	smb := load(0x3337EC46)
+	assert.Equal(t, uint32(0x3337EC46), smb.cart.crc)
+	assert.Equal(t, RenderModeDot, smb.ppu.mode, "Super Mario Bros. falls back to the dot renderer")
+	assert.Equal(t, RenderModeScanline, load(0).ppu.mode)
+}
@@ -1,10 +1,13 @@
 package nes
 
 import (
+	"crypto/md5"
 	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
+	"time"
 )
 
 const (
@@ -13,6 +16,57 @@ const (
 	chrBankSizeBytes = 0x2000
 )
 
+// Region is the TV system the console is made for
+type Region uint8
+
+const (
+	RegionNTSC Region = iota
+	RegionPAL
+)
+
+// FrameRate returns the frames per second of the TV system
+func (r Region) FrameRate() float64 {
+	if r == RegionPAL {
+		return 50.007
+	}
+	return 60.0988
+}
+
+// FrameDuration returns the frame period of the TV system
+func (r Region) FrameDuration() time.Duration {
+	return time.Duration(float64(time.Second) / r.FrameRate())
+}
+
+type mirrorMode uint8
+
+const (
+	mirrorHorizontal mirrorMode = iota
+	mirrorVertical
+)
+
+func (m mirrorMode) String() string {
+	switch m {
+	case mirrorHorizontal:
+		return "horizontal"
+	case mirrorVertical:
+		return "vertical"
+	}
+	return fmt.Sprintf("mirrorMode(%d)", m)
+}
+
+// inesHeader is the header of the iNES file
+type inesHeader struct {
+	Magic      uint32
+	PrgRomSize uint8
+	ChrRomSize uint8
+	Flags6     uint8
+	Flags7     uint8
+	Flags8     uint8
+	Flags9     uint8
+	Flags10    uint8
+	_          [5]uint8 // unused
+}
+
 type Cart struct {
 	pgrMem []uint8
 	chrMem []uint8
@@ -20,6 +74,14 @@ type Cart struct {
 	pgrBanks uint8
 	chrBanks uint8
 	mapperID uint8
+	mirror   mirrorMode
+	region   Region
+	crc      uint32   // CRC32 of PRG and CHR ROM
+	md5      [16]byte // MD5 of PRG and CHR ROM, other emulators identify the games by it
+	chrRAM   bool     // the cartridge has CHR RAM instead of CHR ROM
+
+	header  inesHeader
+	trainer []uint8
 
 	mapper Mapper
 }
@@ -32,28 +94,24 @@ func NewCartFromFile(path string) (*Cart, error) {
 		return nil, fmt.Errorf("couldn't open the file: %s", err)
 	}
 	defer file.Close()
+	return NewCart(file)
+}
 
-	var header struct {
-		Magic      uint32
-		PrgRomSize uint8
-		ChrRomSize uint8
-		Flags6     uint8
-		Flags7     uint8
-		Flags8     uint8
-		Flags9     uint8
-		Flags10    uint8
-		_          [5]uint8 // unused
-	}
-	if err := binary.Read(file, binary.LittleEndian, &header); err != nil {
+// NewCart reads the iNES ROM from r, e.g. a file dropped on the window
+func NewCart(r io.Reader) (*Cart, error) {
+	var header inesHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
 		return nil, fmt.Errorf("couldn't read the header: %s", err)
 	}
 	if header.Magic != inesMagic {
 		return nil, fmt.Errorf("invalid header")
 	}
 	// the second bit of flags6 is the trainer flag
+	var trainer []uint8
 	if header.Flags6&0x4 != 0 {
-		if _, err := file.Seek(512, io.SeekCurrent); err != nil {
-			return nil, fmt.Errorf("couldn't skip the trainer: %s", err)
+		trainer = make([]uint8, 512)
+		if _, err := io.ReadFull(r, trainer); err != nil {
+			return nil, fmt.Errorf("couldn't read the trainer: %s", err)
 		}
 	}
 
@@ -62,31 +120,99 @@ func NewCartFromFile(path string) (*Cart, error) {
 	// flag7: upper 4 bits of mapper ID
 	mapperID := (header.Flags7 & 0xf0) | (header.Flags6 >> 4)
 
+	// the first bit of flags6 is the nametable mirroring
+	mirror := mirrorHorizontal
+	if header.Flags6&0x1 != 0 {
+		mirror = mirrorVertical
+	}
+
+	// the first bit of flags9 is the TV system
+	region := RegionNTSC
+	if header.Flags9&0x1 != 0 {
+		region = RegionPAL
+	}
+
 	cart := &Cart{
 		pgrMem:   make([]uint8, int(header.PrgRomSize)*prgBankSizeBytes),
 		chrMem:   make([]uint8, int(header.ChrRomSize)*chrBankSizeBytes),
 		pgrBanks: header.PrgRomSize,
 		chrBanks: header.ChrRomSize,
 		mapperID: mapperID,
+		mirror:   mirror,
+		region:   region,
+		header:   header,
+		trainer:  trainer,
 	}
 	cart.mapper = NewMapper(cart)
+	if cart.mapper == nil {
+		return nil, fmt.Errorf("unsupported mapper %d", mapperID)
+	}
 
-	if n, err := file.Read(cart.pgrMem); n != len(cart.pgrMem) || err != nil {
-		if err == nil {
+	if n, err := io.ReadFull(r, cart.pgrMem); err != nil {
+		if n > 0 || err == io.EOF {
 			err = fmt.Errorf("expected %d bytes, read %d bytes", len(cart.pgrMem), n)
 		}
 		return nil, fmt.Errorf("couldn't read PRG ROM: %s", err)
 	}
-	if n, err := file.Read(cart.chrMem); n != len(cart.chrMem) || err != nil {
-		if err == nil {
+	if n, err := io.ReadFull(r, cart.chrMem); err != nil {
+		if n > 0 || err == io.EOF {
 			err = fmt.Errorf("expected %d bytes, read %d bytes", len(cart.chrMem), n)
 		}
 		return nil, fmt.Errorf("couldn't read CHR ROM: %s", err)
 	}
 
+	crc := crc32.NewIEEE()
+	crc.Write(cart.pgrMem)
+	crc.Write(cart.chrMem)
+	cart.crc = crc.Sum32()
+	sum := md5.New()
+	sum.Write(cart.pgrMem)
+	sum.Write(cart.chrMem)
+	copy(cart.md5[:], sum.Sum(nil))
+
+	// no CHR ROM means the cartridge has 8KB of CHR RAM
+	if header.ChrRomSize == 0 {
+		cart.chrMem = make([]uint8, chrBankSizeBytes)
+		cart.chrRAM = true
+	}
+
 	return cart, nil
 }
 
+// Save writes the cartridge as an iNES file.
+// The CHR RAM is not saved, it is not a part of the ROM
+func (c *Cart) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("couldn't create the file: %s", err)
+	}
+	defer file.Close()
+
+	if err := binary.Write(file, binary.LittleEndian, c.header); err != nil {
+		return fmt.Errorf("couldn't write the header: %s", err)
+	}
+	data := [][]uint8{c.trainer, c.pgrMem}
+	if !c.chrRAM {
+		data = append(data, c.chrMem)
+	}
+	for _, d := range data {
+		if _, err := file.Write(d); err != nil {
+			return fmt.Errorf("couldn't write the ROM: %s", err)
+		}
+	}
+	return file.Close()
+}
+
+// Region returns the TV system the game is made for
+func (c *Cart) Region() Region {
+	return c.region
+}
+
+// CRC returns the CRC32 of PRG and CHR ROM which identifies the game
+func (c *Cart) CRC() uint32 {
+	return c.crc
+}
+
 func (c Cart) Read8(addr uint16) uint8 {
 	return c.mapper.Read8(addr)
 }
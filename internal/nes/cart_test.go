@@ -0,0 +1,23 @@
+package nes
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_NewCart_UnsupportedMapper(t *testing.T) {
+	rom := make([]uint8, 16+prgBankSizeBytes+chrBankSizeBytes)
+	copy(rom, "NES\x1a\x01\x01")
+	_, err := NewCart(bytes.NewReader(rom))
+	assert.NoError(t, err)
+
+	// a dropped MMC1 or MMC3 game doesn't replace the running one
+	rom[6] = 0x10
+	_, err = NewCart(bytes.NewReader(rom))
+	assert.EqualError(t, err, "unsupported mapper 1")
+	rom[6] = 0x40
+	_, err = NewCart(bytes.NewReader(rom))
+	assert.EqualError(t, err, "unsupported mapper 4")
+}
@@ -0,0 +1,116 @@
+package nes
+
+import (
+	"fmt"
+	"os"
+)
+
+// the flags of the bytes of the code/data log, the ones of FCEUX
+const (
+	CDLCode uint8 = 0x01 // the CPU ran the byte, the opcode or the operand
+	CDLData uint8 = 0x02 // the CPU read the byte as data
+	CDLPCM  uint8 = 0x40 // the DMC played the byte as a sample
+)
+
+// CodeDataLog is the code/data log of the PRG ROM, the flags by
+// the offset. It is saved as the FCEUX .cdl file, the PRG ROM and then
+// the CHR ROM. The CHR ROM isn't logged, its flags stay 0
+type CodeDataLog struct {
+	PRG []uint8
+	CHR []uint8 // none with the CHR RAM
+}
+
+// codeDataLogger marks the bytes of the CodeDataLog
+type codeDataLogger struct {
+	log CodeDataLog
+	// the CPU addresses of the instruction being run,
+	// its reads aren't data
+	start, end uint16
+}
+
+// SetCodeDataLogging turns on or off the code/data log of the PRG ROM,
+// turning it on starts the log over
+func (b *Bus) SetCodeDataLogging(enabled bool) {
+	b.cdl = nil
+	if !enabled || b.cart == nil {
+		return
+	}
+	var chr int
+	if !b.cart.chrRAM {
+		chr = len(b.cart.chrMem)
+	}
+	b.cdl = &codeDataLogger{log: CodeDataLog{
+		PRG: make([]uint8, len(b.cart.pgrMem)),
+		CHR: make([]uint8, chr),
+	}}
+}
+
+// CodeDataLog returns a copy of the code/data log
+func (b *Bus) CodeDataLog() CodeDataLog {
+	if b.cdl == nil {
+		return CodeDataLog{}
+	}
+	return CodeDataLog{
+		PRG: append([]uint8(nil), b.cdl.log.PRG...),
+		CHR: append([]uint8(nil), b.cdl.log.CHR...),
+	}
+}
+
+// LoadCodeDataLog adds the flags of the .cdl file to the log,
+// e.g. of the previous runs of the game
+func (b *Bus) LoadCodeDataLog(path string) error {
+	if b.cdl == nil {
+		return fmt.Errorf("the code/data log is off")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	l := &b.cdl.log
+	if len(data) != len(l.PRG)+len(l.CHR) {
+		return fmt.Errorf("the size %d isn't of the game, %d is expected", len(data), len(l.PRG)+len(l.CHR))
+	}
+	for i, flags := range data[:len(l.PRG)] {
+		l.PRG[i] |= flags
+	}
+	for i, flags := range data[len(l.PRG):] {
+		l.CHR[i] |= flags
+	}
+	return nil
+}
+
+// SaveCodeDataLog writes the log to the .cdl file
+func (b *Bus) SaveCodeDataLog(path string) error {
+	l := b.CodeDataLog()
+	return os.WriteFile(path, append(l.PRG, l.CHR...), 0o644)
+}
+
+// logCode marks the bytes of the instruction the CPU fetches next
+func (b *Bus) logCode() {
+	c := b.cpu
+	size := 1 + opcodeModes[b.PeekMemory(c.pc)].operandSize()
+	b.cdl.start, b.cdl.end = c.pc, c.pc+uint16(size)
+	for i := 0; i < size; i++ {
+		b.markCDL(c.pc+uint16(i), CDLCode)
+	}
+}
+
+// logData marks the byte the CPU reads unless it is of the instruction
+func (b *Bus) logData(addr uint16) {
+	// the instruction may wrap around $FFFF
+	if addr-b.cdl.start < b.cdl.end-b.cdl.start {
+		return
+	}
+	b.markCDL(addr, CDLData)
+}
+
+// markCDL sets the flags of the PRG ROM byte at the CPU address,
+// the bits 2 and 3 are the 8 KB window of $8000-$FFFF it was accessed in
+func (b *Bus) markCDL(addr uint16, flags uint8) {
+	prg, ok := b.PRGOffset(addr)
+	if !ok || prg >= len(b.cdl.log.PRG) {
+		return
+	}
+	window := uint8(addr>>13&0x3) << 2
+	b.cdl.log.PRG[prg] = b.cdl.log.PRG[prg]&^0x0C | flags | window
+}
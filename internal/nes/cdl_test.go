@@ -0,0 +1,52 @@
+package nes
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Bus_CodeDataLog(t *testing.T) {
+	bus := newTestBus()
+	copy(bus.cart.pgrMem, []uint8{
+		0xAD, 0x10, 0x80, // LDA $8010
+		0x4C, 0x00, 0x80, // JMP $8000
+	})
+	bus.cart.pgrMem[0x3FFD] = 0x80 // the reset vector
+	bus.SetCodeDataLogging(true)
+	bus.cpu.Reset()
+	for range 3 * 100 {
+		bus.Tic()
+	}
+
+	l := bus.CodeDataLog()
+	assert.Len(t, l.PRG, prgBankSizeBytes)
+	assert.Equal(t, make([]uint8, chrBankSizeBytes), l.CHR, "the CHR ROM isn't logged")
+	assert.Equal(t, []uint8{CDLCode, CDLCode, CDLCode, CDLCode, CDLCode, CDLCode, 0}, l.PRG[:7])
+	assert.Equal(t, CDLData, l.PRG[0x10])
+	assert.Equal(t, CDLData|0x0C, l.PRG[0x3FFC], "the reset vector is read in the window $E000")
+
+	// the logs of the runs add up
+	path := filepath.Join(t.TempDir(), "game.cdl")
+	other := make([]uint8, prgBankSizeBytes+chrBankSizeBytes)
+	other[0x20] = CDLCode
+	require.NoError(t, os.WriteFile(path, other, 0o644))
+	require.NoError(t, bus.LoadCodeDataLog(path))
+	assert.Equal(t, CDLCode, bus.CodeDataLog().PRG[0x20])
+	assert.Equal(t, CDLCode, bus.CodeDataLog().PRG[0])
+	assert.Error(t, bus.LoadCodeDataLog(filepath.Join(t.TempDir(), "none.cdl")))
+
+	require.NoError(t, bus.SaveCodeDataLog(path))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, bus.CodeDataLog().PRG, data[:prgBankSizeBytes])
+	assert.Len(t, data, prgBankSizeBytes+chrBankSizeBytes)
+
+	require.NoError(t, os.WriteFile(path, other[:10], 0o644))
+	assert.Error(t, bus.LoadCodeDataLog(path), "the log of another game")
+	bus.SetCodeDataLogging(false)
+	assert.Error(t, bus.LoadCodeDataLog(path))
+}
@@ -0,0 +1,80 @@
+package nes
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// CHR sheets are 128x256 images of the 512 tiles of a CHR bank,
+// 16 tiles per row, the $0000 pattern table above the $1000 one
+const (
+	chrSheetWidth  = 128
+	chrSheetHeight = 256
+)
+
+// chrSheetPalette is the grayscale palette of the 2-bit pixel values
+var chrSheetPalette = color.Palette{
+	color.RGBA{0, 0, 0, 255},
+	color.RGBA{85, 85, 85, 255},
+	color.RGBA{170, 170, 170, 255},
+	color.RGBA{255, 255, 255, 255},
+}
+
+// CHRBanks returns the number of 8KB CHR banks
+func (c *Cart) CHRBanks() int {
+	return len(c.chrMem) / chrBankSizeBytes
+}
+
+// CHRSheet returns the 8KB CHR bank as an indexed grayscale image.
+// The pixel indexes are the 2-bit pixel values
+func (c *Cart) CHRSheet(bank int) (*image.Paletted, error) {
+	if bank < 0 || bank >= c.CHRBanks() {
+		return nil, fmt.Errorf("invalid CHR bank %d", bank)
+	}
+	chr := c.chrMem[bank*chrBankSizeBytes : (bank+1)*chrBankSizeBytes]
+
+	img := image.NewPaletted(image.Rect(0, 0, chrSheetWidth, chrSheetHeight), chrSheetPalette)
+	for tile := 0; tile < len(chr)/16; tile++ {
+		left, top := tile%16*8, tile/16*8
+		for row := 0; row < 8; row++ {
+			lo, hi := chr[tile*16+row], chr[tile*16+row+8]
+			for col := 0; col < 8; col++ {
+				bit := 7 - col
+				img.SetColorIndex(left+col, top+row, (lo>>bit)&0x1|((hi>>bit)&0x1)<<1)
+			}
+		}
+	}
+	return img, nil
+}
+
+// ImportCHRSheet writes the CHR sheet image into the CHR bank.
+// The image may be edited in any editor: every pixel is converted
+// to the closest of the 4 gray levels. The change is live,
+// the PPU sees it immediately
+func (c *Cart) ImportCHRSheet(bank int, img image.Image) error {
+	if bank < 0 || bank >= c.CHRBanks() {
+		return fmt.Errorf("invalid CHR bank %d", bank)
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() != chrSheetWidth || bounds.Dy() != chrSheetHeight {
+		return fmt.Errorf("invalid CHR sheet size %dx%d, expected %dx%d",
+			bounds.Dx(), bounds.Dy(), chrSheetWidth, chrSheetHeight)
+	}
+
+	chr := c.chrMem[bank*chrBankSizeBytes : (bank+1)*chrBankSizeBytes]
+	for tile := 0; tile < len(chr)/16; tile++ {
+		left, top := bounds.Min.X+tile%16*8, bounds.Min.Y+tile/16*8
+		for row := 0; row < 8; row++ {
+			var lo, hi uint8
+			for col := 0; col < 8; col++ {
+				pixel := uint8(chrSheetPalette.Index(img.At(left+col, top+row)))
+				bit := 7 - col
+				lo |= (pixel & 0x1) << bit
+				hi |= (pixel >> 1) << bit
+			}
+			chr[tile*16+row], chr[tile*16+row+8] = lo, hi
+		}
+	}
+	return nil
+}
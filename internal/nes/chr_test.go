@@ -0,0 +1,41 @@
+package nes
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Cart_CHRSheet(t *testing.T) {
+	cart := &Cart{chrMem: make([]uint8, chrBankSizeBytes)}
+	// tile $101: first row is 0, 1, 2, 3, 0, 0, 0, 0
+	cart.chrMem[0x1010] = 0x50
+	cart.chrMem[0x1018] = 0x30
+
+	sheet, err := cart.CHRSheet(0)
+	assert.NoError(t, err)
+	for x, pixel := range []uint8{0, 1, 2, 3} {
+		assert.Equal(t, pixel, sheet.ColorIndexAt(8+x, 128))
+	}
+
+	// an edited RGBA image
+	edited := image.NewRGBA(sheet.Bounds())
+	for y := 0; y < chrSheetHeight; y++ {
+		for x := 0; x < chrSheetWidth; x++ {
+			edited.Set(x, y, sheet.At(x, y))
+		}
+	}
+	edited.Set(0, 0, color.RGBA{250, 250, 250, 255})
+	edited.Set(1, 0, color.RGBA{90, 80, 80, 255})
+	assert.NoError(t, cart.ImportCHRSheet(0, edited))
+	assert.Equal(t, uint8(0xC0), cart.chrMem[0x0000])
+	assert.Equal(t, uint8(0x80), cart.chrMem[0x0008])
+	assert.Equal(t, uint8(0x50), cart.chrMem[0x1010])
+	assert.Equal(t, uint8(0x30), cart.chrMem[0x1018])
+
+	_, err = cart.CHRSheet(1)
+	assert.Error(t, err)
+	assert.Error(t, cart.ImportCHRSheet(0, image.NewRGBA(image.Rect(0, 0, 8, 8))))
+}
@@ -0,0 +1,161 @@
+package nes
+
+import "fmt"
+
+// Button is a button of the standard controller
+type Button uint8
+
+// The buttons in the order the controller reports them
+const (
+	ButtonA Button = 1 << iota
+	ButtonB
+	ButtonSelect
+	ButtonStart
+	ButtonUp
+	ButtonDown
+	ButtonLeft
+	ButtonRight
+)
+
+var buttonNames = []string{"a", "b", "select", "start", "up", "down", "left", "right"}
+
+// String returns the names of the buttons joined by +, e.g. a+start
+func (b Button) String() string {
+	var s string
+	for i, name := range buttonNames {
+		if b&(1<<i) == 0 {
+			continue
+		}
+		if s != "" {
+			s += "+"
+		}
+		s += name
+	}
+	return s
+}
+
+// ParseButton returns the button by its name, e.g. a or start
+func ParseButton(s string) (Button, error) {
+	for i, name := range buttonNames {
+		if name == s {
+			return 1 << i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown button %q", s)
+}
+
+// Controller is the standard controller. The buttons are latched
+// into a shift register while the strobe is high, and every read
+// returns the next button. After the 8 buttons the reads return 1.
+type Controller struct {
+	buttons Button // the pressed buttons
+	shift   uint8
+	strobe  bool
+}
+
+// SetButtons sets the pressed buttons
+func (c *Controller) SetButtons(buttons Button) {
+	c.buttons = buttons
+	if c.strobe {
+		c.shift = uint8(buttons)
+	}
+}
+
+// Buttons returns the pressed buttons
+func (c *Controller) Buttons() Button {
+	return c.buttons
+}
+
+// Press presses the buttons, the other buttons keep their state
+func (c *Controller) Press(buttons Button) {
+	c.SetButtons(c.buttons | buttons)
+}
+
+// Release releases the buttons, the other buttons keep their state
+func (c *Controller) Release(buttons Button) {
+	c.SetButtons(c.buttons &^ buttons)
+}
+
+// write sets the strobe, while it is high the shift register
+// keeps reloading the buttons
+func (c *Controller) write(data uint8) {
+	c.strobe = data&0x1 != 0
+	if c.strobe {
+		c.shift = uint8(c.buttons)
+	}
+}
+
+// read returns the next button in bit 0
+func (c *Controller) read() uint8 {
+	if c.strobe {
+		return uint8(c.buttons & ButtonA)
+	}
+	data := c.shift & 0x1
+	// the serial input of the shift register is tied high
+	c.shift = c.shift>>1 | 0x80
+	return data
+}
+
+// writeControllers sets the strobe of the controllers
+// and passes the write to the port devices and the expansion port
+func (b *Bus) writeControllers(data uint8) {
+	if b.expansionPort != nil {
+		b.expansionPort.write(data)
+	}
+	for _, d := range b.portDevices {
+		if d != nil {
+			d.write(data)
+		}
+	}
+	for i := range b.controllers {
+		b.controllers[i].write(data)
+	}
+	// the buttons are latched while the strobe is high
+	// and when it goes low
+	f := &b.fourScore
+	if f.strobe || data&0x1 != 0 {
+		f.latch(b.controllers)
+	}
+	f.strobe = data&0x1 != 0
+}
+
+// SetMicrophone sets whether the microphone of the Famicom
+// controller 2 picks up sound, the games read it in bit 2 of $4016
+func (b *Bus) SetMicrophone(active bool) {
+	b.microphone = active
+}
+
+// Microphone reports whether the microphone picks up sound
+func (b *Bus) Microphone() bool {
+	return b.microphone
+}
+
+// readController returns the next bit of the port 0 or 1
+// with the bits of the expansion port and the microphone
+func (b *Bus) readController(port int) uint8 {
+	b.input.polled = true
+	var data uint8
+	if b.expansionPort != nil {
+		data = b.expansionPort.read(port)
+	}
+	if port == 0 && b.microphone {
+		data |= 0x4
+	}
+	return data | b.readPort(port)
+}
+
+func (b *Bus) readPort(port int) uint8 {
+	if d := b.portDevices[port]; d != nil {
+		return d.read()
+	}
+	f := &b.fourScore
+	if !f.enabled {
+		return b.controllers[port].read()
+	}
+	if f.strobe {
+		return uint8(b.controllers[port].buttons & ButtonA)
+	}
+	data := uint8(f.shift[port] & 0x1)
+	f.shift[port] = f.shift[port]>>1 | 1<<23
+	return data
+}
@@ -0,0 +1,221 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Controller_Read(t *testing.T) {
+	bus := newTestBus()
+	mem := bus.newCpuMemory()
+	bus.Controller(0).SetButtons(ButtonA | ButtonStart | ButtonRight)
+
+	// the strobe is high: every read returns A
+	mem.Write8(0x4016, 1)
+	assert.Equal(t, uint8(0x41), mem.Read8(0x4016))
+	assert.Equal(t, uint8(0x41), mem.Read8(0x4016))
+	bus.Controller(0).Release(ButtonA)
+	assert.Equal(t, uint8(0x40), mem.Read8(0x4016))
+	bus.Controller(0).Press(ButtonA)
+
+	mem.Write8(0x4016, 0)
+	var bits []uint8
+	for i := 0; i < 10; i++ {
+		bits = append(bits, mem.Read8(0x4016))
+	}
+	assert.Equal(t, []uint8{0x41, 0x40, 0x40, 0x41, 0x40, 0x40, 0x40, 0x41, 0x41, 0x41}, bits,
+		"A, B, Select, Start, Up, Down, Left, Right, then 1s")
+
+	// the buttons are latched by the strobe
+	bus.Controller(0).SetButtons(0)
+	mem.Write8(0x4016, 1)
+	mem.Write8(0x4016, 0)
+	bus.Controller(0).SetButtons(ButtonA)
+	assert.Equal(t, uint8(0x40), mem.Read8(0x4016))
+}
+
+func Test_Controller_SecondPort(t *testing.T) {
+	bus := newTestBus()
+	mem := bus.newCpuMemory()
+	bus.Controller(0).SetButtons(ButtonA)
+	bus.Controller(1).SetButtons(ButtonB)
+
+	mem.Write8(0x4016, 1)
+	mem.Write8(0x4016, 0)
+	assert.Equal(t, uint8(0x41), mem.Read8(0x4016))
+	assert.Equal(t, uint8(0x40), mem.Read8(0x4017))
+	assert.Equal(t, uint8(0x40), mem.Read8(0x4016))
+	assert.Equal(t, uint8(0x41), mem.Read8(0x4017))
+
+	// $4017 writes go to the frame counter
+	mem.Write8(0x4017, 0x80)
+	assert.Equal(t, uint8(1), bus.apu.frameCounter.mode)
+	assert.Equal(t, uint8(0x40), mem.Read8(0x4017))
+}
+
+func Test_Controller_ButtonNames(t *testing.T) {
+	assert.Equal(t, "a+start", (ButtonA | ButtonStart).String())
+	b, err := ParseButton("right")
+	assert.NoError(t, err)
+	assert.Equal(t, ButtonRight, b)
+	_, err = ParseButton("turbo")
+	assert.Error(t, err)
+}
+
+func Test_Controller_FourScore(t *testing.T) {
+	bus := newTestBus()
+	mem := bus.newCpuMemory()
+	bus.SetFourScore(true)
+	bus.Controller(0).SetButtons(ButtonA)
+	bus.Controller(1).SetButtons(ButtonB)
+	bus.Controller(2).SetButtons(ButtonStart)
+	bus.Controller(3).SetButtons(ButtonRight)
+
+	mem.Write8(0x4016, 1)
+	mem.Write8(0x4016, 0)
+	var port0, port1 []uint8
+	for i := 0; i < 26; i++ {
+		port0 = append(port0, mem.Read8(0x4016)&0x1)
+		port1 = append(port1, mem.Read8(0x4017)&0x1)
+	}
+	assert.Equal(t, []uint8{
+		1, 0, 0, 0, 0, 0, 0, 0, // controller 1
+		0, 0, 0, 1, 0, 0, 0, 0, // controller 3
+		0, 0, 0, 1, 0, 0, 0, 0, // signature $10
+		1, 1,
+	}, port0)
+	assert.Equal(t, []uint8{
+		0, 1, 0, 0, 0, 0, 0, 0, // controller 2
+		0, 0, 0, 0, 0, 0, 0, 1, // controller 4
+		0, 0, 1, 0, 0, 0, 0, 0, // signature $20
+		1, 1,
+	}, port1)
+
+	bus.SetFourScore(false)
+	mem.Write8(0x4016, 1)
+	mem.Write8(0x4016, 0)
+	for i := 0; i < 8; i++ {
+		mem.Read8(0x4016)
+	}
+	assert.Equal(t, uint8(0x41), mem.Read8(0x4016), "no controller 3 without the Four Score")
+}
+
+func Test_Controller_Keyboard(t *testing.T) {
+	bus := newTestBus()
+	mem := bus.newCpuMemory()
+	k := NewKeyboard()
+	bus.SetExpansionDevice(k)
+	ret, _ := ParseKeyboardKey("Return")
+	x, _ := ParseKeyboardKey("X")
+	space, _ := ParseKeyboardKey("Space")
+	assert.Equal(t, "Return", ret.String())
+	k.SetKeys([]KeyboardKey{ret, x, space})
+
+	// select the first row, then scan the columns of every row
+	mem.Write8(0x4016, 0x5)
+	var columns []uint8
+	for row := 0; row < 10; row++ {
+		mem.Write8(0x4016, 0x4)
+		columns = append(columns, mem.Read8(0x4017)&0x1E)
+		mem.Write8(0x4016, 0x6)
+		columns = append(columns, mem.Read8(0x4017)&0x1E)
+	}
+	assert.Equal(t, []uint8{
+		0x16, 0x1E, // Return
+		0x1E, 0x1E,
+		0x1E, 0x1E,
+		0x1E, 0x1E,
+		0x1E, 0x1E,
+		0x1E, 0x1E,
+		0x1E, 0x0E, // X
+		0x1E, 0x1E,
+		0x1E, 0x16, // Space
+		0x1E, 0x1E, // no more rows
+	}, columns)
+
+	// the disabled matrix reads 0
+	mem.Write8(0x4016, 0x0)
+	assert.Equal(t, uint8(0), mem.Read8(0x4017)&0x1E)
+
+	_, err := ParseKeyboardKey("Enter")
+	assert.Error(t, err)
+}
+
+func Test_Controller_Paddle(t *testing.T) {
+	bus := newTestBus()
+	mem := bus.newCpuMemory()
+	p := NewPaddle()
+	bus.SetPortDevice(1, p)
+	p.SetPosition(0x98)
+	p.SetFire(true)
+
+	mem.Write8(0x4016, 1)
+	mem.Write8(0x4016, 0)
+	p.Move(0x10) // the position is latched
+	var bits []uint8
+	for i := 0; i < 8; i++ {
+		data := mem.Read8(0x4017)
+		assert.Equal(t, uint8(0x08), data&0x08, "fire")
+		bits = append(bits, data>>4&0x1)
+	}
+	assert.Equal(t, []uint8{0, 1, 1, 0, 0, 1, 1, 1}, bits, "$98 inverted, MSB first")
+
+	p.SetPosition(0)
+	assert.Equal(t, PaddleMin, p.Position())
+
+	// the Famicom paddle
+	f := NewFamicomPaddle()
+	bus.SetPortDevice(1, nil)
+	bus.SetExpansionDevice(f)
+	f.SetPosition(0xF0)
+	f.SetFire(true)
+	mem.Write8(0x4016, 1)
+	mem.Write8(0x4016, 0)
+	assert.Equal(t, uint8(0x2), mem.Read8(0x4016)&0x2, "fire")
+	assert.Equal(t, uint8(0), mem.Read8(0x4017)&0x2)
+	assert.Equal(t, uint8(0), mem.Read8(0x4017)&0x2)
+	assert.Equal(t, uint8(0), mem.Read8(0x4017)&0x2)
+	assert.Equal(t, uint8(0), mem.Read8(0x4017)&0x2)
+	assert.Equal(t, uint8(0x2), mem.Read8(0x4017)&0x2)
+}
+
+func Test_Controller_PowerPad(t *testing.T) {
+	bus := newTestBus()
+	mem := bus.newCpuMemory()
+	p := NewPowerPad()
+	bus.SetPortDevice(1, p)
+	p.SetButtons(PowerPadButton(1) | PowerPadButton(12) | PowerPadButton(7))
+
+	mem.Write8(0x4016, 1)
+	mem.Write8(0x4016, 0)
+	var d3, d4 []uint8
+	for i := 0; i < 9; i++ {
+		data := mem.Read8(0x4017)
+		d3 = append(d3, data>>3&0x1)
+		d4 = append(d4, data>>4&0x1)
+	}
+	assert.Equal(t, []uint8{0, 1, 0, 0, 0, 0, 0, 1, 1}, d3, "2, 1, 5, 9, 6, 10, 11, 7, then 1s")
+	assert.Equal(t, []uint8{0, 0, 1, 0, 1, 1, 1, 1, 1}, d4, "4, 3, 12, 8, then 1s")
+
+	// the Family Trainer
+	f := NewFamilyTrainer()
+	bus.SetPortDevice(1, nil)
+	bus.SetExpansionDevice(f)
+	f.SetButtons(PowerPadButton(1) | PowerPadButton(6))
+	mem.Write8(0x4016, 0x6) // the first row
+	assert.Equal(t, uint8(0x0E), mem.Read8(0x4017)&0x1E, "1 is the highest bit")
+	mem.Write8(0x4016, 0x5) // the second row
+	assert.Equal(t, uint8(0x16), mem.Read8(0x4017)&0x1E)
+	mem.Write8(0x4016, 0x3) // the third row
+	assert.Equal(t, uint8(0x1E), mem.Read8(0x4017)&0x1E)
+}
+
+func Test_Controller_Microphone(t *testing.T) {
+	bus := newTestBus()
+	mem := bus.newCpuMemory()
+	assert.Equal(t, uint8(0), mem.Read8(0x4016)&0x4)
+	bus.SetMicrophone(true)
+	assert.Equal(t, uint8(0x4), mem.Read8(0x4016)&0x4)
+	assert.Equal(t, uint8(0), mem.Read8(0x4017)&0x4, "the microphone is on $4016 only")
+}
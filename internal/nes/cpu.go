@@ -38,9 +38,10 @@ const (
 )
 
 type instr struct {
-	mode   addrMode
-	fn     func()
-	cycles uint8
+	mode     addrMode
+	fn       func()
+	cycles   uint8
+	addrOnly bool // the instruction uses only the operand address and doesn't read it
 }
 
 type CPU struct {
@@ -59,6 +60,13 @@ type CPU struct {
 	operandValue uint8
 	pageCrossed  bool
 	halt         bool
+	nmiPending   bool
+	nmiLine      bool // the last sampled level of the NMI input
+	irqLine      bool // level of the IRQ input, IRQ is level triggered
+	stall        uint16
+	op           *instr // decoded instruction waiting for its last cycle
+	opPC         uint16 // address of the decoded instruction
+	opcode       uint8  // opcode of the decoded instruction
 }
 
 func isSameSign(a, b uint8) bool {
@@ -77,11 +85,11 @@ func NewCPU(mem ReadWriter) *CPU {
 	return c
 }
 
-func (c CPU) read8(addr uint16) uint8 {
+func (c *CPU) read8(addr uint16) uint8 {
 	return c.mem.Read8(addr)
 }
 
-func (c CPU) read16(addr uint16) uint16 {
+func (c *CPU) read16(addr uint16) uint16 {
 	return uint16(c.read8(addr)) | uint16(c.read8(addr+1))<<8
 }
 
@@ -89,7 +97,7 @@ func (c *CPU) write8(addr uint16, data uint8) {
 	c.mem.Write8(addr, data)
 }
 
-func (c CPU) getFlag(flag uint8) bool {
+func (c *CPU) getFlag(flag uint8) bool {
 	return c.p&flag > 0
 }
 
@@ -138,8 +146,14 @@ func (c *CPU) Reset() {
 	c.p = 0x00 | flagU | flagI
 	c.sp = 0xfd
 	c.pc = c.read16(0xfffc)
-	c.pc = 0xc000 // start from the beginning of the PRG ROM
-	c.cycles = 8
+	c.nmiPending = false
+	c.nmiLine = false
+	c.irqLine = false
+	c.stall = 0
+	c.op = nil
+	c.addrMode, c.operandAddr, c.operandValue, c.pageCrossed = 0, 0, 0, false
+	c.opPC, c.opcode = 0, 0
+	c.cycles = 7
 	c.totalCycles = 7
 }
 
@@ -166,41 +180,142 @@ func (c *CPU) NMI() {
 	c.setFlag(flagI, true)
 	c.stackPush8(c.p)
 	c.pc = c.read16(0xfffa)
-	c.cycles = 8
+	c.cycles = 7
+}
+
+// setNMI samples the NMI input. NMI is edge triggered:
+// only the transition from low to high requests the interrupt
+func (c *CPU) setNMI(line bool) {
+	if line && !c.nmiLine {
+		c.nmiPending = true
+	}
+	c.nmiLine = line
+}
+
+// Stall suspends the CPU for the given number of cycles, e.g. during DMA
+func (c *CPU) Stall(cycles uint16) {
+	c.stall += cycles
+	c.totalCycles += uint64(cycles)
+}
+
+// writeOpcodes are the instructions which write on their last cycle:
+// the stores and the read-modify-write instructions
+var writeOpcodes = func() (ops [0x100]bool) {
+	for _, op := range []uint8{
+		0x81, 0x83, 0x84, 0x85, 0x86, 0x87, 0x8C, 0x8D, 0x8E, 0x8F,
+		0x91, 0x93, 0x94, 0x95, 0x96, 0x97, 0x99, 0x9B, 0x9C, 0x9D, 0x9E, 0x9F,
+	} {
+		ops[op] = true
+	}
+	for _, group := range []uint8{0x00, 0x20, 0x40, 0x60, 0xC0, 0xE0} {
+		for _, op := range []uint8{0x03, 0x06, 0x07, 0x0E, 0x0F, 0x13, 0x16, 0x17, 0x1B, 0x1E, 0x1F} {
+			ops[group|op] = true
+		}
+	}
+	return ops
+}()
+
+// pendingRead returns the address the next cycle reads the operand from,
+// if the next cycle is the last one of an instruction reading memory
+func (c *CPU) pendingRead() (uint16, bool) {
+	if c.op == nil || c.cycles != 1 || c.stall != 0 || c.op.addrOnly || writeOpcodes[c.opcode] {
+		return 0, false
+	}
+	switch c.addrMode {
+	case addrModeACC, addrModeIMP, addrModeREL, addrModeIMM:
+		return 0, false
+	}
+	return c.operandAddr, true
+}
+
+// pendingWrite reports whether the next cycle is the write of an instruction
+func (c *CPU) pendingWrite() bool {
+	return c.op != nil && c.cycles == 1 && c.stall == 0 && writeOpcodes[c.opcode]
 }
 
 // Tic executes one CPU cycle and
-// returns the number of cycles left for the current operation
+// returns the number of cycles left for the current operation.
+//
+// An instruction is decoded on its first cycle and executed on its last one,
+// since loads and stores access the operand on the last cycle. This way
+// writes to the PPU registers take effect at the right dot.
 func (c *CPU) Tic() uint8 {
 	if c.halt {
 		return 0
 	}
 
 	if c.cycles != 0 {
+		c.cycles--
+		if c.cycles == 0 && c.op != nil {
+			c.execute()
+		}
+		return c.cycles
+	}
+
+	if c.stall != 0 {
+		c.stall--
+		return uint8(min(c.stall, 0xff))
+	}
+
+	// interrupts are handled between instructions
+	if c.nmiPending {
+		c.nmiPending = false
+		c.NMI()
+		c.totalCycles += uint64(c.cycles)
+		// this is the first cycle of the interrupt sequence
+		c.cycles--
+		return c.cycles
+	}
+	if c.irqLine && !c.getFlag(flagI) {
+		c.IRQ()
+		c.totalCycles += uint64(c.cycles)
 		c.cycles--
 		return c.cycles
 	}
 
+	c.opPC = c.pc
 	opcode := c.read8(c.pc)
+	c.opcode = opcode
 	c.pc++
-	instr := c.instrs[opcode]
+	instr := &c.instrs[opcode]
 	if instr.fn == nil {
 		c.hlt()
 		log.Printf("unsupported opcode %02X. PC: %04X. halting...\n", opcode, c.pc)
 		return 0
 	}
 	c.fetch(instr.mode)
+	c.op = instr
+	if instr.cycles <= 1 {
+		c.execute()
+		return c.cycles
+	}
+	c.cycles = instr.cycles - 1
+	return c.cycles
+}
+
+// fetching reports whether the next Tic fetches an instruction
+func (c *CPU) fetching() bool {
+	return !c.halt && c.cycles == 0 && c.stall == 0 && !c.nmiPending &&
+		!(c.irqLine && !c.getFlag(flagI))
+}
+
+// execute runs the decoded instruction on its last cycle.
+// Page crossings and taken branches add cycles after the execution
+func (c *CPU) execute() {
+	instr := c.op
+	c.op = nil
+
+	c.readOperand(instr.addrOnly)
 	instr.fn()
-	c.cycles += instr.cycles
-	c.totalCycles += uint64(c.cycles)
+	c.totalCycles += uint64(instr.cycles) + uint64(c.cycles)
 
 	c.addrMode = 0
 	c.operandAddr = 0
 	c.operandValue = 0
 	c.pageCrossed = false
-	return c.cycles
 }
 
+// fetch decodes the operand address of the addressing mode
 func (c *CPU) fetch(addrMode addrMode) {
 	c.addrMode = addrMode
 	c.pageCrossed = false
@@ -211,38 +326,32 @@ func (c *CPU) fetch(addrMode addrMode) {
 	case addrModeIMM:
 		c.operandAddr = c.pc
 		c.pc++
-		c.operandValue = c.read8(c.operandAddr)
 		return
 
 	case addrModeZP:
 		c.operandAddr = uint16(c.read8(c.pc))
 		c.pc++
-		c.operandValue = c.read8(c.operandAddr)
 		return
 
 	case addrModeZPX:
 		c.operandAddr = uint16(c.read8(c.pc) + c.x)
 		c.pc++
-		c.operandValue = c.read8(c.operandAddr)
 		return
 
 	case addrModeZPY:
 		c.operandAddr = uint16(c.read8(c.pc) + c.y)
 		c.pc++
-		c.operandValue = c.read8(c.operandAddr)
 		return
 
 	case addrModeABS:
 		c.operandAddr = c.read16(c.pc)
 		c.pc += 2
-		c.operandValue = c.read8(c.operandAddr)
 		return
 
 	case addrModeABSX:
 		baseAddr := c.read16(c.pc)
 		c.pc += 2
 		c.operandAddr = baseAddr + uint16(c.x)
-		c.operandValue = c.read8(c.operandAddr)
 		c.pageCrossed = isDiffPage(baseAddr, c.operandAddr)
 		return
 
@@ -250,7 +359,6 @@ func (c *CPU) fetch(addrMode addrMode) {
 		baseAddr := c.read16(c.pc)
 		c.pc += 2
 		c.operandAddr = baseAddr + uint16(c.y)
-		c.operandValue = c.read8(c.operandAddr)
 		c.pageCrossed = isDiffPage(baseAddr, c.operandAddr)
 		return
 
@@ -264,7 +372,6 @@ func (c *CPU) fetch(addrMode addrMode) {
 			hi = (lo & 0xff00) | uint16((lo+1)&0x00ff)
 		}
 		c.operandAddr = uint16(c.read8(lo)) | uint16(c.read8(hi))<<8
-		c.operandValue = c.read8(c.operandAddr)
 		return
 
 	case addrModeINDX:
@@ -273,7 +380,6 @@ func (c *CPU) fetch(addrMode addrMode) {
 		lo := uint16(c.read8(addr & 0x00ff))
 		hi := uint16(c.read8((addr + 1) & 0x00ff))
 		c.operandAddr = lo | hi<<8
-		c.operandValue = c.read8(c.operandAddr)
 		return
 
 	case addrModeINDY:
@@ -283,7 +389,6 @@ func (c *CPU) fetch(addrMode addrMode) {
 		hi := uint16(c.read8((addr + 1) & 0x00ff))
 		addr = lo | hi<<8
 		c.operandAddr = addr + uint16(c.y)
-		c.operandValue = c.read8(c.operandAddr)
 		c.pageCrossed = isDiffPage(addr, c.operandAddr)
 		return
 
@@ -296,7 +401,6 @@ func (c *CPU) fetch(addrMode addrMode) {
 		return
 
 	case addrModeACC:
-		c.operandValue = c.a
 		return
 
 	case addrModeIMP:
@@ -307,6 +411,19 @@ func (c *CPU) fetch(addrMode addrMode) {
 	log.Printf("unsupported addressing mode %d. PC: %04X. halting...\n", addrMode, c.pc)
 }
 
+// readOperand reads the operand value from the operand address.
+// Stores and jumps don't read the operand, so they avoid side effects
+// of reading memory mapped registers
+func (c *CPU) readOperand(addrOnly bool) {
+	switch {
+	case c.addrMode == addrModeACC:
+		c.operandValue = c.a
+	case c.addrMode == addrModeIMP, c.addrMode == addrModeREL, addrOnly:
+	default:
+		c.operandValue = c.read8(c.operandAddr)
+	}
+}
+
 func (c *CPU) adc() {
 	r16 := uint16(c.a) + uint16(c.operandValue)
 	if c.getFlag(flagC) {
@@ -784,7 +901,7 @@ func (c *CPU) initInstructions() {
 	c.instrs[0x1D] = instr{mode: addrModeABSX, fn: c.ora, cycles: 4}
 	c.instrs[0x1E] = instr{mode: addrModeABSX, fn: c.asl, cycles: 7}
 	c.instrs[0x1F] = instr{mode: addrModeABSX, fn: c.slo, cycles: 7}
-	c.instrs[0x20] = instr{mode: addrModeABS, fn: c.jsr, cycles: 6}
+	c.instrs[0x20] = instr{mode: addrModeABS, fn: c.jsr, cycles: 6, addrOnly: true}
 	c.instrs[0x21] = instr{mode: addrModeINDX, fn: c.and, cycles: 6}
 	c.instrs[0x22] = instr{mode: addrModeIMP, fn: c.hlt, cycles: 0}
 	c.instrs[0x23] = instr{mode: addrModeINDX, fn: c.rla, cycles: 8}
@@ -828,7 +945,7 @@ func (c *CPU) initInstructions() {
 	c.instrs[0x49] = instr{mode: addrModeIMM, fn: c.eor, cycles: 2}
 	c.instrs[0x4A] = instr{mode: addrModeACC, fn: c.lsr, cycles: 2}
 	c.instrs[0x4B] = instr{mode: addrModeIMM, fn: c.alr, cycles: 2}
-	c.instrs[0x4C] = instr{mode: addrModeABS, fn: c.jmp, cycles: 3}
+	c.instrs[0x4C] = instr{mode: addrModeABS, fn: c.jmp, cycles: 3, addrOnly: true}
 	c.instrs[0x4D] = instr{mode: addrModeABS, fn: c.eor, cycles: 4}
 	c.instrs[0x4E] = instr{mode: addrModeABS, fn: c.lsr, cycles: 6}
 	c.instrs[0x4F] = instr{mode: addrModeABS, fn: c.sre, cycles: 6}
@@ -859,7 +976,7 @@ func (c *CPU) initInstructions() {
 	c.instrs[0x68] = instr{mode: addrModeIMP, fn: c.pla, cycles: 4}
 	c.instrs[0x69] = instr{mode: addrModeIMM, fn: c.adc, cycles: 2}
 	c.instrs[0x6A] = instr{mode: addrModeACC, fn: c.ror, cycles: 2}
-	c.instrs[0x6C] = instr{mode: addrModeIND, fn: c.jmp, cycles: 5}
+	c.instrs[0x6C] = instr{mode: addrModeIND, fn: c.jmp, cycles: 5, addrOnly: true}
 	c.instrs[0x6D] = instr{mode: addrModeABS, fn: c.adc, cycles: 4}
 	c.instrs[0x6E] = instr{mode: addrModeABS, fn: c.ror, cycles: 6}
 	c.instrs[0x6F] = instr{mode: addrModeABS, fn: c.rra, cycles: 6}
@@ -880,31 +997,31 @@ func (c *CPU) initInstructions() {
 	c.instrs[0x7E] = instr{mode: addrModeABSX, fn: c.ror, cycles: 7}
 	c.instrs[0x7F] = instr{mode: addrModeABSX, fn: c.rra, cycles: 7}
 	c.instrs[0x80] = instr{mode: addrModeREL, fn: c.nop, cycles: 2}
-	c.instrs[0x81] = instr{mode: addrModeINDX, fn: c.sta, cycles: 6}
+	c.instrs[0x81] = instr{mode: addrModeINDX, fn: c.sta, cycles: 6, addrOnly: true}
 	c.instrs[0x82] = instr{mode: addrModeIMM, fn: c.nop, cycles: 2}
-	c.instrs[0x83] = instr{mode: addrModeINDX, fn: c.sax, cycles: 6}
-	c.instrs[0x84] = instr{mode: addrModeZP, fn: c.sty, cycles: 3}
-	c.instrs[0x85] = instr{mode: addrModeZP, fn: c.sta, cycles: 3}
-	c.instrs[0x86] = instr{mode: addrModeZP, fn: c.stx, cycles: 3}
-	c.instrs[0x87] = instr{mode: addrModeZP, fn: c.sax, cycles: 3}
+	c.instrs[0x83] = instr{mode: addrModeINDX, fn: c.sax, cycles: 6, addrOnly: true}
+	c.instrs[0x84] = instr{mode: addrModeZP, fn: c.sty, cycles: 3, addrOnly: true}
+	c.instrs[0x85] = instr{mode: addrModeZP, fn: c.sta, cycles: 3, addrOnly: true}
+	c.instrs[0x86] = instr{mode: addrModeZP, fn: c.stx, cycles: 3, addrOnly: true}
+	c.instrs[0x87] = instr{mode: addrModeZP, fn: c.sax, cycles: 3, addrOnly: true}
 	c.instrs[0x88] = instr{mode: addrModeIMP, fn: c.dey, cycles: 2}
 	c.instrs[0x89] = instr{mode: addrModeIMM, fn: c.nop, cycles: 2}
 	c.instrs[0x8A] = instr{mode: addrModeIMP, fn: c.txa, cycles: 2}
-	c.instrs[0x8C] = instr{mode: addrModeABS, fn: c.sty, cycles: 4}
-	c.instrs[0x8D] = instr{mode: addrModeABS, fn: c.sta, cycles: 4}
-	c.instrs[0x8E] = instr{mode: addrModeABS, fn: c.stx, cycles: 4}
-	c.instrs[0x8F] = instr{mode: addrModeABS, fn: c.sax, cycles: 4}
+	c.instrs[0x8C] = instr{mode: addrModeABS, fn: c.sty, cycles: 4, addrOnly: true}
+	c.instrs[0x8D] = instr{mode: addrModeABS, fn: c.sta, cycles: 4, addrOnly: true}
+	c.instrs[0x8E] = instr{mode: addrModeABS, fn: c.stx, cycles: 4, addrOnly: true}
+	c.instrs[0x8F] = instr{mode: addrModeABS, fn: c.sax, cycles: 4, addrOnly: true}
 	c.instrs[0x90] = instr{mode: addrModeREL, fn: c.bcc, cycles: 2}
-	c.instrs[0x91] = instr{mode: addrModeINDY, fn: c.sta, cycles: 6}
+	c.instrs[0x91] = instr{mode: addrModeINDY, fn: c.sta, cycles: 6, addrOnly: true}
 	c.instrs[0x92] = instr{mode: addrModeIMP, fn: c.hlt, cycles: 0}
-	c.instrs[0x94] = instr{mode: addrModeZPX, fn: c.sty, cycles: 4}
-	c.instrs[0x95] = instr{mode: addrModeZPX, fn: c.sta, cycles: 4}
-	c.instrs[0x96] = instr{mode: addrModeZPY, fn: c.stx, cycles: 4}
-	c.instrs[0x97] = instr{mode: addrModeZPY, fn: c.sax, cycles: 4}
+	c.instrs[0x94] = instr{mode: addrModeZPX, fn: c.sty, cycles: 4, addrOnly: true}
+	c.instrs[0x95] = instr{mode: addrModeZPX, fn: c.sta, cycles: 4, addrOnly: true}
+	c.instrs[0x96] = instr{mode: addrModeZPY, fn: c.stx, cycles: 4, addrOnly: true}
+	c.instrs[0x97] = instr{mode: addrModeZPY, fn: c.sax, cycles: 4, addrOnly: true}
 	c.instrs[0x98] = instr{mode: addrModeIMP, fn: c.tya, cycles: 2}
-	c.instrs[0x99] = instr{mode: addrModeABSY, fn: c.sta, cycles: 5}
+	c.instrs[0x99] = instr{mode: addrModeABSY, fn: c.sta, cycles: 5, addrOnly: true}
 	c.instrs[0x9A] = instr{mode: addrModeIMP, fn: c.txs, cycles: 2}
-	c.instrs[0x9D] = instr{mode: addrModeABSX, fn: c.sta, cycles: 5}
+	c.instrs[0x9D] = instr{mode: addrModeABSX, fn: c.sta, cycles: 5, addrOnly: true}
 	c.instrs[0xA0] = instr{mode: addrModeIMM, fn: c.ldy, cycles: 2}
 	c.instrs[0xA1] = instr{mode: addrModeINDX, fn: c.lda, cycles: 6}
 	c.instrs[0xA2] = instr{mode: addrModeIMM, fn: c.ldx, cycles: 2}
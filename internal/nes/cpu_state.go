@@ -0,0 +1,82 @@
+package nes
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// cpuState is the state of the CPU as it is serialized, together with
+// the instruction decoded and waiting for its last cycle
+type cpuState struct {
+	A, X, Y, P, SP uint8
+	PC             uint16
+	Cycles         uint8
+	TotalCycles    uint64
+	AddrMode       uint8
+	OperandAddr    uint16
+	OperandValue   uint8
+	PageCrossed    bool
+	Halt           bool
+	NMIPending     bool
+	NMILine        bool
+	IRQLine        bool
+	Stall          uint16
+	OpPending      bool
+	OpPC           uint16
+	Opcode         uint8
+}
+
+// SaveState writes the registers, the interrupt lines and the instruction in progress
+func (c *CPU) SaveState(w io.Writer) error {
+	s := cpuState{
+		A: c.a, X: c.x, Y: c.y, P: c.p, SP: c.sp,
+		PC:           c.pc,
+		Cycles:       c.cycles,
+		TotalCycles:  c.totalCycles,
+		AddrMode:     uint8(c.addrMode),
+		OperandAddr:  c.operandAddr,
+		OperandValue: c.operandValue,
+		PageCrossed:  c.pageCrossed,
+		Halt:         c.halt,
+		NMIPending:   c.nmiPending,
+		NMILine:      c.nmiLine,
+		IRQLine:      c.irqLine,
+		Stall:        c.stall,
+		OpPending:    c.op != nil,
+		OpPC:         c.opPC,
+		Opcode:       c.opcode,
+	}
+	if err := binary.Write(w, binary.LittleEndian, &s); err != nil {
+		return fmt.Errorf("couldn't write the CPU state: %s", err)
+	}
+	return nil
+}
+
+// LoadState reads the state written by SaveState
+func (c *CPU) LoadState(r io.Reader) error {
+	var s cpuState
+	if err := binary.Read(r, binary.LittleEndian, &s); err != nil {
+		return fmt.Errorf("couldn't read the CPU state: %s", err)
+	}
+	c.a, c.x, c.y, c.p, c.sp = s.A, s.X, s.Y, s.P, s.SP
+	c.pc = s.PC
+	c.cycles = s.Cycles
+	c.totalCycles = s.TotalCycles
+	c.addrMode = addrMode(s.AddrMode)
+	c.operandAddr = s.OperandAddr
+	c.operandValue = s.OperandValue
+	c.pageCrossed = s.PageCrossed
+	c.halt = s.Halt
+	c.nmiPending = s.NMIPending
+	c.nmiLine = s.NMILine
+	c.irqLine = s.IRQLine
+	c.stall = s.Stall
+	c.opPC = s.OpPC
+	c.opcode = s.Opcode
+	c.op = nil
+	if s.OpPending && c.instrs[s.Opcode].fn != nil {
+		c.op = &c.instrs[s.Opcode]
+	}
+	return nil
+}
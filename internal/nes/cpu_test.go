@@ -0,0 +1,115 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCPUTestBus returns the bus running the program at $8000 after the reset
+func newCPUTestBus(program ...uint8) *Bus {
+	bus := newTestBus()
+	copy(bus.cart.pgrMem, program)
+	bus.cart.pgrMem[0x3FFD] = 0x80 // the reset vector
+	bus.cart.pgrMem[0x3FFB] = 0x90 // the NMI vector
+	bus.cart.pgrMem[0x3FFF] = 0xA0 // the IRQ vector
+	bus.cpu.Reset()
+	// the reset sequence
+	for bus.cpu.Tic() != 0 {
+	}
+	return bus
+}
+
+// ticInstruction runs the next instruction or interrupt sequence
+// and returns its cycles
+func ticInstruction(c *CPU) int {
+	n := 1
+	for c.Tic() != 0 {
+		n++
+	}
+	return n
+}
+
+func Test_CPU_Tic_WriteOnLastCycle(t *testing.T) {
+	bus := newCPUTestBus(
+		0xA9, 0x42, // LDA #$42
+		0x8D, 0x00, 0x02, // STA $0200
+		0xEE, 0x00, 0x02, // INC $0200
+	)
+	c := bus.cpu
+	assert.Equal(t, 2, ticInstruction(c))
+
+	for i := 0; i < 3; i++ {
+		c.Tic()
+		assert.Equal(t, uint8(0), bus.PeekMemory(0x0200), "the cycle %d doesn't write", i+1)
+	}
+	c.Tic()
+	assert.Equal(t, uint8(0x42), bus.PeekMemory(0x0200), "the last cycle writes")
+
+	for i := 0; i < 5; i++ {
+		c.Tic()
+		assert.Equal(t, uint8(0x42), bus.PeekMemory(0x0200), "the cycle %d doesn't write", i+1)
+	}
+	c.Tic()
+	assert.Equal(t, uint8(0x43), bus.PeekMemory(0x0200), "the last cycle writes")
+}
+
+func Test_CPU_Tic_ExtraCycles(t *testing.T) {
+	bus := newCPUTestBus(
+		0xA2, 0x01, // LDX #$01
+		0xBD, 0xFF, 0x02, // LDA $02FF,X
+		0xBD, 0x00, 0x02, // LDA $0200,X
+		0x9D, 0xFF, 0x02, // STA $02FF,X
+		0x18,       // CLC
+		0x90, 0x00, // BCC $800E
+		0xB0, 0x00, // BCS $8010
+		0x90, 0x80, // BCC $7F92
+	)
+	c := bus.cpu
+	tests := []struct {
+		name   string
+		cycles int
+	}{
+		{"LDX #$01", 2},
+		{"LDA $02FF,X, the page crossed", 5},
+		{"LDA $0200,X", 4},
+		{"STA $02FF,X, always 5", 5},
+		{"CLC", 2},
+		{"BCC, taken", 3},
+		{"BCS, not taken", 2},
+		{"BCC, taken to the other page", 4},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.cycles, ticInstruction(c), tt.name)
+	}
+	assert.Equal(t, uint16(0x7F92), c.pc)
+}
+
+func Test_CPU_Tic_Interrupts(t *testing.T) {
+	bus := newCPUTestBus(
+		0xEA, // NOP
+		0xEA, // NOP
+		0x58, // CLI
+		0xEA, // NOP
+	)
+	c := bus.cpu
+
+	c.Tic()
+	c.setNMI(true)
+	require.Equal(t, uint8(0), c.Tic(), "the NOP ends first")
+	assert.Equal(t, uint16(0x8001), c.pc)
+	assert.Equal(t, 7, ticInstruction(c), "the NMI sequence")
+	assert.Equal(t, uint16(0x9000), c.pc)
+	assert.Equal(t, uint16(0x8001), c.read16(0x0100|uint16(c.sp+2)), "the return address")
+
+	c.rti() // back to $8001
+	c.irqLine = true
+	assert.Equal(t, 2, ticInstruction(c), "the IRQ is masked")
+	assert.Equal(t, uint16(0x8002), c.pc)
+	assert.Equal(t, 2, ticInstruction(c), "CLI")
+	assert.Equal(t, uint16(0x8003), c.pc)
+	assert.Equal(t, 7, ticInstruction(c), "the IRQ sequence")
+	assert.Equal(t, uint16(0xA000), c.pc)
+	assert.True(t, c.getFlag(flagI))
+}
@@ -0,0 +1,78 @@
+package nes
+
+// CycleProfile is the CPU cycles the instructions took by their addresses.
+// The cycles of the DMA and of the interrupt entries count for the
+// instruction they follow
+type CycleProfile struct {
+	Frames uint64   // the PPU frames the profile spans
+	PRG    []uint64 // by the offset of the PRG ROM
+	// the CPU address the offset of the PRG ROM was run at last
+	PRGAddr []uint16
+	// by the CPU address, the instructions out of the PRG ROM, e.g. in the RAM
+	CPU []uint64
+}
+
+// Cycles returns the cycles of all the instructions
+func (p CycleProfile) Cycles() uint64 {
+	var n uint64
+	for _, c := range p.PRG {
+		n += c
+	}
+	for _, c := range p.CPU {
+		n += c
+	}
+	return n
+}
+
+// cycleCounter counts the cycles of the CycleProfile
+type cycleCounter struct {
+	profile    CycleProfile
+	startFrame uint64
+}
+
+// SetCycleProfiling turns on or off counting the CPU cycles
+// of the instructions, turning it on starts the profile over
+func (b *Bus) SetCycleProfiling(enabled bool) {
+	b.cycles = nil
+	if !enabled {
+		return
+	}
+	var prg int
+	if b.cart != nil {
+		prg = len(b.cart.pgrMem)
+	}
+	b.cycles = &cycleCounter{
+		profile: CycleProfile{
+			PRG:     make([]uint64, prg),
+			PRGAddr: make([]uint16, prg),
+			CPU:     make([]uint64, 0x10000),
+		},
+		startFrame: b.ppu.frameCount,
+	}
+}
+
+// CycleProfile returns the cycles counted since the profiling started
+func (b *Bus) CycleProfile() CycleProfile {
+	if b.cycles == nil {
+		return CycleProfile{}
+	}
+	p := b.cycles.profile
+	return CycleProfile{
+		Frames:  b.ppu.frameCount - b.cycles.startFrame,
+		PRG:     append([]uint64(nil), p.PRG...),
+		PRGAddr: append([]uint16(nil), p.PRGAddr...),
+		CPU:     append([]uint64(nil), p.CPU...),
+	}
+}
+
+// countCycle counts the CPU cycle for the instruction being run
+func (b *Bus) countCycle() {
+	p := &b.cycles.profile
+	pc := b.cpu.opPC
+	if prg, ok := b.PRGOffset(pc); ok && prg < len(p.PRG) {
+		p.PRG[prg]++
+		p.PRGAddr[prg] = pc
+		return
+	}
+	p.CPU[pc]++
+}
@@ -0,0 +1,32 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Bus_CycleProfile(t *testing.T) {
+	bus := newTraceBus()
+	assert.Equal(t, CycleProfile{}, bus.CycleProfile(), "not profiling")
+	// the reset cycles run first
+	for i := 0; i < 3*7; i++ {
+		bus.Tic()
+	}
+	bus.SetCycleProfiling(true)
+	// 10 loops: LDX #, LDA abs,X, STA zp and JMP abs
+	for i := 0; i < 3*12*10; i++ {
+		bus.Tic()
+	}
+
+	p := bus.CycleProfile()
+	assert.Equal(t, uint64(12*10), p.Cycles())
+	assert.Equal(t, uint64(2*10), p.PRG[0x0000])
+	assert.Equal(t, uint64(4*10), p.PRG[0x0002])
+	assert.Equal(t, uint64(3*10), p.PRG[0x0005])
+	assert.Equal(t, uint64(3*10), p.PRG[0x0007])
+	assert.Equal(t, uint16(0x8007), p.PRGAddr[0x0007])
+
+	bus.SetCycleProfiling(true)
+	assert.Zero(t, bus.CycleProfile().Cycles(), "the profile starts over")
+}
@@ -0,0 +1,118 @@
+package nes
+
+// DebugHooks are called by the console as it runs, see SetDebugHooks.
+// A hook returning true breaks: RunFrame returns at once, before
+// the frame is completed, and the next RunFrame goes on from there
+type DebugHooks interface {
+	// Instruction is called when the CPU is about to start
+	// the instruction at pc, after the previous one is completed
+	Instruction(pc uint16) bool
+	// Access is called on every read and write of the CPU memory,
+	// after the access
+	Access(addr uint16, data uint8, write bool) bool
+}
+
+// DebugEventHooks are the hooks watching the events of the console too,
+// the ones of the event viewer, e.g. the NMI
+type DebugEventHooks interface {
+	DebugHooks
+	// Event is called when the event happens
+	Event(e Event) bool
+}
+
+// SetDebugHooks sets the hooks the debuggers watch the console with,
+// nil removes them. Without the hooks the console runs at the full speed
+func (b *Bus) SetDebugHooks(h DebugHooks) {
+	b.debug = h
+	b.debugEvents, _ = h.(DebugEventHooks)
+	b.debugBreak = false
+}
+
+// Instrumented reports whether the console runs with the trace log,
+// a profiler, the code/data log, the event log, the APU write log,
+// the debug hooks or the RAM freezes. The frames run and then undone, e.g. by the run-ahead,
+// would end up in them
+func (b *Bus) Instrumented() bool {
+	return b.trace != nil || b.profile != nil || b.cycles != nil || b.cdl != nil ||
+		b.events.enabled || b.apu.writeLog.enabled || b.debug != nil || len(b.freezes) > 0
+}
+
+// CPURegisters are the registers of the CPU. Between the instructions
+// the PC is the address of the next instruction
+type CPURegisters struct {
+	A, X, Y uint8
+	P       uint8 // the flags: NV-BDIZC
+	SP      uint8
+	PC      uint16
+	Cycles  uint64 // the cycles since the power-on
+}
+
+// CPURegisters returns the registers of the CPU
+func (b *Bus) CPURegisters() CPURegisters {
+	c := b.cpu
+	return CPURegisters{A: c.a, X: c.x, Y: c.y, P: c.p, SP: c.sp, PC: c.pc, Cycles: c.totalCycles}
+}
+
+// PPUPosition returns the scanline and the dot the PPU is at
+func (b *Bus) PPUPosition() (scanline, dot int) {
+	return int(b.ppu.scanLine), int(b.ppu.cycles)
+}
+
+// PPUFrames returns the frames the PPU completed since the power-on
+func (b *Bus) PPUFrames() uint64 {
+	return b.ppu.frameCount
+}
+
+// SetCPURegisters sets the registers of the CPU but the cycles,
+// the new PC takes effect between the instructions
+func (b *Bus) SetCPURegisters(r CPURegisters) {
+	c := b.cpu
+	c.a, c.x, c.y, c.p, c.sp, c.pc = r.A, r.X, r.Y, r.P, r.SP, r.PC
+}
+
+// PeekMemory reads the CPU memory without the side effects of the read:
+// the PPU registers read as the open bus, the I/O registers as 0.
+// The cartridge reads as the CPU sees it, with the ROM patches
+func (b *Bus) PeekMemory(addr uint16) uint8 {
+	switch {
+	case addr < 0x2000:
+		return b.ram.Read8(addr & 0x07FF)
+	case addr < 0x4000:
+		return b.ppu.openBus
+	case addr < 0x4020:
+		return 0
+	}
+	if b.cart == nil {
+		return 0
+	}
+	return b.patchRead(addr, b.cart.Read8(addr))
+}
+
+// WriteMemory writes the CPU memory the way the CPU does, with the side
+// effects of the write, e.g. on the mapper registers. The debug hooks
+// don't see the write
+func (b *Bus) WriteMemory(addr uint16, data uint8) {
+	debug := b.debug
+	b.debug = nil
+	b.newCpuMemory().Write8(addr, data)
+	b.debug = debug
+}
+
+// debugInstruction calls the instruction hook
+// once the CPU is between the instructions
+func (b *Bus) debugInstruction() {
+	c := b.cpu
+	if c.halt || c.cycles != 0 || c.op != nil || c.stall != 0 {
+		return
+	}
+	if b.debug.Instruction(c.pc) {
+		b.debugBreak = true
+	}
+}
+
+// debugAccess calls the access hook
+func (b *Bus) debugAccess(addr uint16, data uint8, write bool) {
+	if b.debug.Access(addr, data, write) {
+		b.debugBreak = true
+	}
+}
@@ -0,0 +1,78 @@
+package nes
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testHooks struct {
+	breakAt uint16
+	pcs     []uint16
+	writes  []uint16
+}
+
+func (h *testHooks) Instruction(pc uint16) bool {
+	h.pcs = append(h.pcs, pc)
+	return pc == h.breakAt
+}
+
+func (h *testHooks) Access(addr uint16, data uint8, write bool) bool {
+	if write {
+		h.writes = append(h.writes, addr)
+	}
+	return false
+}
+
+func Test_Bus_DebugHooks(t *testing.T) {
+	bus := newSnapshotBus()
+	hooks := &testHooks{breakAt: 0x800C}
+	bus.SetDebugHooks(hooks)
+
+	frame := bus.ppu.frameCount
+	bus.RunFrame()
+	assert.Equal(t, frame, bus.ppu.frameCount, "the frame breaks before it is completed")
+	assert.Equal(t, []uint16{0x8000, 0x8002, 0x8005, 0x8007, 0x800A, 0x800C}, hooks.pcs)
+	assert.Equal(t, []uint16{0x2000, 0x2001, 0x0010}, hooks.writes)
+	regs := bus.CPURegisters()
+	assert.Equal(t, uint16(0x800C), regs.PC)
+	assert.Equal(t, uint8(0x1E), regs.A)
+	assert.Equal(t, uint8(0x4C), bus.PeekMemory(0x800C))
+	assert.Equal(t, uint8(1), bus.PeekMemory(0x0810), "the RAM mirrors")
+
+	hooks.breakAt = 0
+	bus.RunFrame()
+	assert.Equal(t, frame+1, bus.ppu.frameCount, "the next RunFrame completes the frame")
+
+	bus.SetDebugHooks(nil)
+	hooks.pcs = nil
+	bus.RunFrame()
+	assert.Empty(t, hooks.pcs)
+}
+
+type testEventHooks struct {
+	testHooks
+	events []EventType
+}
+
+func (h *testEventHooks) Event(e Event) bool {
+	h.events = append(h.events, e.Type)
+	return e.Type == EventNMI
+}
+
+func Test_Bus_DebugEventHooks(t *testing.T) {
+	bus := newSnapshotBus()
+	bus.RunFrame()
+	hooks := &testEventHooks{}
+	bus.SetDebugHooks(hooks)
+
+	for i := 0; i < 3 && !slices.Contains(hooks.events, EventNMI); i++ {
+		bus.RunFrame()
+	}
+	require.NotEmpty(t, hooks.events)
+	assert.Equal(t, EventNMI, hooks.events[len(hooks.events)-1], "the NMI hook breaks")
+	assert.Contains(t, hooks.events, EventRegisterWrite)
+	assert.Empty(t, bus.Events(nil), "the event log stays off")
+}
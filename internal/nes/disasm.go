@@ -0,0 +1,241 @@
+package nes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Instruction is the CPU instruction at an address of the memory
+type Instruction struct {
+	Addr       uint16
+	Label      string  // the label of the address, see SetSymbols
+	Bytes      []uint8 // the opcode and the operand
+	Name       string  // e.g. LDA
+	Unofficial bool    // the opcode isn't documented, e.g. LAX or the NOPs but $EA
+	Text       string  // e.g. LDA $0200,X or LDA oam,X, the branches show the target
+	mode       addrMode
+}
+
+// Symbols names the addresses of the CPU memory, e.g. the symbol table
+// of the assembler
+type Symbols interface {
+	// Label returns the label of the CPU address, prg is the offset of
+	// the PRG ROM the CPU reads at the address or -1. "" is no label
+	Label(addr uint16, prg int) string
+}
+
+// SetSymbols sets the labels of the disassembly and the trace log,
+// nil removes them
+func (b *Bus) SetSymbols(s Symbols) {
+	b.symbols = s
+}
+
+// PRGOffset returns the offset of the PRG ROM the CPU reads at the
+// address, false out of the ROM
+func (b *Bus) PRGOffset(addr uint16) (int, bool) {
+	if b.cart == nil || addr < 0x8000 {
+		return 0, false
+	}
+	m, ok := b.cart.mapper.(interface{ mapAddr(uint16) uint16 })
+	if !ok {
+		return 0, false
+	}
+	return int(m.mapAddr(addr)), true
+}
+
+// label returns the label of the address, "" without it
+func (b *Bus) label(addr uint16) string {
+	if b.symbols == nil {
+		return ""
+	}
+	prg, ok := b.PRGOffset(addr)
+	if !ok {
+		prg = -1
+	}
+	return b.symbols.Label(addr, prg)
+}
+
+// the names of the opcodes, the way the CPU runs them
+var opcodeNames = [0x100]string{
+	"BRK", "ORA", "HLT", "SLO", "NOP", "ORA", "ASL", "SLO", "PHP", "ORA", "ASL", "ANC", "NOP", "ORA", "ASL", "SLO",
+	"BPL", "ORA", "HLT", "SLO", "NOP", "ORA", "ASL", "SLO", "CLC", "ORA", "NOP", "SLO", "NOP", "ORA", "ASL", "SLO",
+	"JSR", "AND", "HLT", "RLA", "BIT", "AND", "ROL", "RLA", "PLP", "AND", "ROL", "ANC", "BIT", "AND", "ROL", "RLA",
+	"BMI", "AND", "HLT", "RLA", "NOP", "AND", "ROL", "RLA", "SEC", "AND", "NOP", "RLA", "NOP", "AND", "ROL", "RLA",
+	"RTI", "EOR", "HLT", "SRE", "NOP", "EOR", "LSR", "SRE", "PHA", "EOR", "LSR", "ALR", "JMP", "EOR", "LSR", "SRE",
+	"BVC", "EOR", "HLT", "SRE", "NOP", "EOR", "LSR", "SRE", "CLI", "EOR", "NOP", "SRE", "NOP", "EOR", "LSR", "SRE",
+	"RTS", "ADC", "HLT", "RRA", "NOP", "ADC", "ROR", "RRA", "PLA", "ADC", "ROR", "ARR", "JMP", "ADC", "ROR", "RRA",
+	"BVS", "ADC", "HLT", "RRA", "NOP", "ADC", "ROR", "RRA", "SEI", "ADC", "NOP", "RRA", "NOP", "ADC", "ROR", "RRA",
+	"NOP", "STA", "NOP", "SAX", "STY", "STA", "STX", "SAX", "DEY", "NOP", "TXA", "XAA", "STY", "STA", "STX", "SAX",
+	"BCC", "STA", "HLT", "SHA", "STY", "STA", "STX", "SAX", "TYA", "STA", "TXS", "TAS", "SHY", "STA", "SHX", "SHA",
+	"LDY", "LDA", "LDX", "LAX", "LDY", "LDA", "LDX", "LAX", "TAY", "LDA", "TAX", "LXA", "LDY", "LDA", "LDX", "LAX",
+	"BCS", "LDA", "HLT", "LAX", "LDY", "LDA", "LDX", "LAX", "CLV", "LDA", "TSX", "LAS", "LDY", "LDA", "LDX", "LAX",
+	"CPY", "CMP", "NOP", "DCP", "CPY", "CMP", "DEC", "DCP", "INY", "CMP", "DEX", "AXS", "CPY", "CMP", "DEC", "DCP",
+	"BNE", "CMP", "HLT", "DCP", "NOP", "CMP", "DEC", "DCP", "CLD", "CMP", "NOP", "DCP", "NOP", "CMP", "DEC", "DCP",
+	"CPX", "SBC", "NOP", "ISC", "CPX", "SBC", "INC", "ISC", "INX", "SBC", "NOP", "SBC", "CPX", "SBC", "INC", "ISC",
+	"BEQ", "SBC", "HLT", "ISC", "NOP", "SBC", "INC", "ISC", "SED", "SBC", "NOP", "ISC", "NOP", "SBC", "INC", "ISC",
+}
+
+// the addressing modes of the opcodes, with the ones the CPU doesn't run
+var opcodeModes = func() (modes [0x100]addrMode) {
+	c := NewCPU(nil)
+	for op, in := range c.instrs {
+		modes[op] = in.mode
+	}
+	// the CPU skips the operand of the NOP the way of a branch
+	for _, op := range []uint8{0x6B, 0x80, 0x8B, 0xAB} {
+		modes[op] = addrModeIMM
+	}
+	modes[0x93] = addrModeINDY
+	modes[0x9C] = addrModeABSX
+	for _, op := range []uint8{0x9B, 0x9E, 0x9F} {
+		modes[op] = addrModeABSY
+	}
+	return modes
+}()
+
+const officialNames = "ADC AND ASL BCC BCS BEQ BIT BMI BNE BPL BRK BVC BVS CLC CLD CLI CLV CMP CPX CPY " +
+	"DEC DEX DEY EOR INC INX INY JMP JSR LDA LDX LDY LSR NOP ORA PHA PHP PLA PLP ROL ROR RTI RTS " +
+	"SBC SEC SED SEI STA STX STY TAX TAY TSX TXA TXS TYA"
+
+// unofficial reports whether the opcode isn't documented
+func unofficial(opcode uint8) bool {
+	name := opcodeNames[opcode]
+	return !strings.Contains(officialNames, name) || name == "NOP" && opcode != 0xEA || opcode == 0xEB
+}
+
+// operandSize returns how many bytes follow the opcode
+func (m addrMode) operandSize() int {
+	switch m {
+	case addrModeIMM, addrModeZP, addrModeZPX, addrModeZPY, addrModeINDX, addrModeINDY, addrModeREL:
+		return 1
+	case addrModeABS, addrModeABSX, addrModeABSY, addrModeIND:
+		return 2
+	}
+	return 0
+}
+
+// Disassemble decodes the instruction at the address of the CPU memory,
+// the memory is read without the side effects of the reads
+func (b *Bus) Disassemble(addr uint16) Instruction {
+	opcode := b.PeekMemory(addr)
+	mode := opcodeModes[opcode]
+	in := Instruction{
+		Addr:       addr,
+		Label:      b.label(addr),
+		Bytes:      []uint8{opcode},
+		Name:       opcodeNames[opcode],
+		Unofficial: unofficial(opcode),
+		mode:       mode,
+	}
+	for i := range mode.operandSize() {
+		in.Bytes = append(in.Bytes, b.PeekMemory(addr+1+uint16(i)))
+	}
+	in.Text = in.Name
+	var label string
+	if target, ok := in.target(); ok {
+		label = b.label(target)
+	}
+	if operand := in.operandText(label); operand != "" {
+		in.Text += " " + operand
+	}
+	return in
+}
+
+// operand returns the operand bytes as a number
+func (in Instruction) operand() uint16 {
+	switch len(in.Bytes) {
+	case 2:
+		return uint16(in.Bytes[1])
+	case 3:
+		return uint16(in.Bytes[1]) | uint16(in.Bytes[2])<<8
+	}
+	return 0
+}
+
+// target returns the address the operand names
+func (in Instruction) target() (uint16, bool) {
+	switch in.mode {
+	case addrModeIMM, addrModeACC, addrModeIMP:
+		return 0, false
+	case addrModeREL:
+		return in.Addr + 2 + uint16(int8(in.operand())), true
+	}
+	return in.operand(), true
+}
+
+// operandText returns the operand, the label replaces the address
+func (in Instruction) operandText(label string) string {
+	v := in.operand()
+	if label != "" {
+		switch in.mode {
+		case addrModeZPX, addrModeABSX:
+			return label + ",X"
+		case addrModeZPY, addrModeABSY:
+			return label + ",Y"
+		case addrModeIND:
+			return "(" + label + ")"
+		case addrModeINDX:
+			return "(" + label + ",X)"
+		case addrModeINDY:
+			return "(" + label + "),Y"
+		}
+		return label
+	}
+	switch in.mode {
+	case addrModeIMM:
+		return fmt.Sprintf("#$%02X", v)
+	case addrModeZP:
+		return fmt.Sprintf("$%02X", v)
+	case addrModeZPX:
+		return fmt.Sprintf("$%02X,X", v)
+	case addrModeZPY:
+		return fmt.Sprintf("$%02X,Y", v)
+	case addrModeABS:
+		return fmt.Sprintf("$%04X", v)
+	case addrModeABSX:
+		return fmt.Sprintf("$%04X,X", v)
+	case addrModeABSY:
+		return fmt.Sprintf("$%04X,Y", v)
+	case addrModeIND:
+		return fmt.Sprintf("($%04X)", v)
+	case addrModeINDX:
+		return fmt.Sprintf("($%02X,X)", v)
+	case addrModeINDY:
+		return fmt.Sprintf("($%02X),Y", v)
+	case addrModeREL:
+		return fmt.Sprintf("$%04X", in.Addr+2+uint16(int8(v)))
+	case addrModeACC:
+		return "A"
+	}
+	return ""
+}
+
+// accessAddr returns the address of the memory the instruction at the PC
+// reads or writes with the registers of the CPU, indexed tells the address
+// isn't the operand. The jumps and the stack don't access the memory
+func (b *Bus) accessAddr(in Instruction) (addr uint16, indexed, ok bool) {
+	if in.Name == "JMP" || in.Name == "JSR" {
+		return 0, false, false
+	}
+	c, v := b.cpu, in.operand()
+	peek16zp := func(zp uint8) uint16 {
+		return uint16(b.PeekMemory(uint16(zp))) | uint16(b.PeekMemory(uint16(zp+1)))<<8
+	}
+	switch in.mode {
+	case addrModeZP, addrModeABS:
+		return v, false, true
+	case addrModeZPX:
+		return uint16(uint8(v) + c.x), true, true
+	case addrModeZPY:
+		return uint16(uint8(v) + c.y), true, true
+	case addrModeABSX:
+		return v + uint16(c.x), true, true
+	case addrModeABSY:
+		return v + uint16(c.y), true, true
+	case addrModeINDX:
+		return peek16zp(uint8(v) + c.x), true, true
+	case addrModeINDY:
+		return peek16zp(uint8(v)) + uint16(c.y), true, true
+	}
+	return 0, false, false
+}
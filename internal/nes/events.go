@@ -0,0 +1,357 @@
+package nes
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"slices"
+)
+
+// EventType is the kind of a timeline event
+type EventType uint8
+
+const (
+	EventRegisterRead     EventType = iota // CPU read of $2000-$2007
+	EventRegisterWrite                     // CPU write to $2000-$2007
+	EventNMI                               // the PPU raised NMI
+	EventSpriteZeroHit                     // sprite 0 hit flag set
+	EventIRQ                               // an IRQ source asserted the IRQ line
+	EventMapperWrite                       // CPU write to the cartridge
+	EventVBlank                            // the PPU started the vertical blank
+	EventNMIEntry                          // the CPU entered the NMI handler
+	EventIRQEntry                          // the CPU entered the IRQ handler, Data is the IRQ sources
+	EventBRK                               // the CPU is about to run BRK
+	EventIllegalOpcode                     // the CPU is about to run an unofficial opcode, Data is the opcode
+	EventAPURegisterWrite                  // CPU write to $4000-$4017
+	EventOAMDMA                            // the OAM DMA copies the page at Addr
+	EventDMCDMA                            // the DMC fetched the sample byte at Addr
+	EventBankSwitch                        // the mapper switched the 8 KB PRG window at Addr to the bank in Data
+	eventTypeCount
+)
+
+// the IRQ sources in the Data of EventIRQEntry
+const (
+	IRQFrameCounter uint8 = 1 << iota // the APU frame counter
+	IRQDMC                            // the APU DMC channel
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventRegisterRead:
+		return "register read"
+	case EventRegisterWrite:
+		return "register write"
+	case EventNMI:
+		return "nmi"
+	case EventSpriteZeroHit:
+		return "sprite 0 hit"
+	case EventIRQ:
+		return "irq"
+	case EventMapperWrite:
+		return "mapper write"
+	case EventVBlank:
+		return "vblank"
+	case EventNMIEntry:
+		return "nmi entry"
+	case EventIRQEntry:
+		return "irq entry"
+	case EventBRK:
+		return "brk"
+	case EventIllegalOpcode:
+		return "illegal opcode"
+	case EventAPURegisterWrite:
+		return "apu register write"
+	case EventOAMDMA:
+		return "oam dma"
+	case EventDMCDMA:
+		return "dmc dma"
+	case EventBankSwitch:
+		return "bank switch"
+	}
+	return "unknown"
+}
+
+// ParseEventType returns the event type of the name
+func ParseEventType(name string) (EventType, error) {
+	for t := EventType(0); t < eventTypeCount; t++ {
+		if t.String() == name {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown event type: %s", name)
+}
+
+// Source returns the part of the console the event comes from
+func (t EventType) Source() EventSource {
+	switch t {
+	case EventNMIEntry, EventIRQEntry, EventBRK, EventIllegalOpcode, EventOAMDMA:
+		return SourceCPU
+	case EventIRQ, EventAPURegisterWrite, EventDMCDMA:
+		return SourceAPU
+	case EventMapperWrite, EventBankSwitch:
+		return SourceMapper
+	}
+	return SourcePPU
+}
+
+// EventSource is the part of the console an event comes from
+type EventSource uint8
+
+const (
+	SourceCPU EventSource = iota
+	SourcePPU
+	SourceAPU
+	SourceMapper
+)
+
+var eventSourceNames = []string{"cpu", "ppu", "apu", "mapper"}
+
+func (s EventSource) String() string {
+	if int(s) < len(eventSourceNames) {
+		return eventSourceNames[s]
+	}
+	return "unknown"
+}
+
+// ParseEventSource returns the event source of the name
+func ParseEventSource(name string) (EventSource, error) {
+	for i, n := range eventSourceNames {
+		if n == name {
+			return EventSource(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown event source: %s", name)
+}
+
+// Event is something that happened at a PPU dot
+type Event struct {
+	Type     EventType
+	Frame    uint64 // the number of the frame from the power-on, a frame starts at scanline 0
+	ScanLine int
+	Dot      int
+	PC       uint16 // address of the CPU instruction
+	Addr     uint16
+	Data     uint8
+}
+
+var eventColors = map[EventType]color.RGBA{
+	EventRegisterRead:     {0, 200, 255, 255},
+	EventRegisterWrite:    {255, 200, 0, 255},
+	EventNMI:              {255, 0, 0, 255},
+	EventSpriteZeroHit:    {0, 255, 0, 255},
+	EventIRQ:              {255, 0, 255, 255},
+	EventMapperWrite:      {255, 255, 255, 255},
+	EventVBlank:           {128, 128, 128, 255},
+	EventNMIEntry:         {255, 128, 128, 255},
+	EventIRQEntry:         {200, 128, 255, 255},
+	EventBRK:              {255, 128, 0, 255},
+	EventIllegalOpcode:    {255, 255, 0, 255},
+	EventAPURegisterWrite: {255, 160, 160, 255},
+	EventOAMDMA:           {0, 128, 255, 255},
+	EventDMCDMA:           {160, 255, 160, 255},
+	EventBankSwitch:       {0, 255, 255, 255},
+}
+
+// EventFilter selects the events by the type and the source
+type EventFilter struct {
+	Types   []EventType   // nil: all the types
+	Sources []EventSource // nil: all the sources
+}
+
+// Match reports whether the filter accepts the event
+func (f EventFilter) Match(e Event) bool {
+	if f.Types != nil && !slices.Contains(f.Types, e.Type) {
+		return false
+	}
+	return f.Sources == nil || slices.Contains(f.Sources, e.Type.Source())
+}
+
+// eventLog collects the events of the PPU frame being rendered.
+// A frame starts at the first dot of scanline 0
+type eventLog struct {
+	enabled    bool
+	frame      uint64 // the frame being rendered
+	current    []Event
+	last       []Event
+	spriteZero bool // sprite 0 hit flag at the previous dot
+	vblank     bool // vblank flag at the previous dot
+
+	// the interrupt the CPU is entering, logged at the first
+	// instruction of the handler
+	entering bool
+	entry    EventType
+	sources  uint8
+}
+
+// SetEventLogging turns on the recording of the timeline events
+// of the CPU, the PPU, the APU and the mapper.
+// It slows the emulation down a bit, so it is off by default
+func (b *Bus) SetEventLogging(enabled bool) {
+	b.events.enabled = enabled
+	b.events.frame = b.ppu.frameCount
+	b.events.current = b.events.current[:0]
+	b.events.last = nil
+}
+
+// Events returns the events of the last complete frame accepted by the filter.
+// nil filter accepts all the events
+func (b *Bus) Events(filter func(e Event) bool) []Event {
+	var events []Event
+	for _, e := range b.events.last {
+		if filter == nil || filter(e) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// EventView draws the events of the last complete frame on a 341x262 grid,
+// a pixel per dot, over the dimmed last frame
+func (b *Bus) EventView() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, ppuDotsPerScanline, ppuScanlinesPerFrame))
+	frame := b.ppu.Frame()
+	for y := 0; y < ppuScanlinesPerFrame; y++ {
+		for x := 0; x < ppuDotsPerScanline; x++ {
+			c := color.RGBA{32, 32, 32, 255}
+			// the pixels are output at dots 1-256
+			if y < FrameHeight && x >= 1 && x <= FrameWidth {
+				c = frame.RGBAAt(x-1, y)
+				c = color.RGBA{c.R / 3, c.G / 3, c.B / 3, 255}
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	for _, e := range b.events.last {
+		img.SetRGBA(e.Dot, e.ScanLine, eventColors[e.Type])
+	}
+	return img
+}
+
+// logEvent records the event at the current PPU dot
+// and passes it to the debug event hooks
+func (b *Bus) logEvent(t EventType, addr uint16, data uint8) {
+	b.logEventAt(t, b.cpu.opPC, addr, data)
+}
+
+// logEventAt records the event of the CPU instruction at the pc
+func (b *Bus) logEventAt(t EventType, pc uint16, addr uint16, data uint8) {
+	if !b.events.enabled && b.debugEvents == nil {
+		return
+	}
+	e := Event{
+		Type:     t,
+		Frame:    b.events.frame,
+		ScanLine: int(b.ppu.scanLine),
+		Dot:      int(b.ppu.cycles),
+		PC:       pc,
+		Addr:     addr,
+		Data:     data,
+	}
+	if b.debugEvents != nil && b.debugEvents.Event(e) {
+		b.debugBreak = true
+	}
+	if b.events.enabled {
+		b.events.current = append(b.events.current, e)
+	}
+}
+
+// watchEvents records the events the PPU produces by itself
+// and starts a new frame of events
+func (b *Bus) watchEvents() {
+	if !b.events.enabled && b.debugEvents == nil {
+		return
+	}
+	spriteZero := b.ppu.ppustatus.S == 1
+	if spriteZero && !b.events.spriteZero {
+		b.logEvent(EventSpriteZeroHit, 0x2002, 0x40)
+	}
+	b.events.spriteZero = spriteZero
+	vblank := b.ppu.ppustatus.V == 1
+	if vblank && !b.events.vblank {
+		b.logEvent(EventVBlank, 0x2002, 0x80)
+	}
+	b.events.vblank = vblank
+
+	if b.ppu.scanLine == 0 && b.ppu.cycles == 0 {
+		b.events.last = append(b.events.last[:0], b.events.current...)
+		b.events.current = b.events.current[:0]
+		b.events.frame = b.ppu.frameCount
+	}
+}
+
+// prgWindows returns the PRG offsets the 8 KB windows of $8000-$FFFF
+// map to, -1 is unmapped. They are only looked at for the events
+func (b *Bus) prgWindows() [4]int {
+	var windows [4]int
+	if !b.events.enabled && b.debugEvents == nil {
+		return windows
+	}
+	for i := range windows {
+		offset, ok := b.PRGOffset(0x8000 + uint16(i)*0x2000)
+		if !ok {
+			offset = -1
+		}
+		windows[i] = offset
+	}
+	return windows
+}
+
+// watchBanks records the bank switches of the windows
+// since prgWindows returned them
+func (b *Bus) watchBanks(before [4]int) {
+	if !b.events.enabled && b.debugEvents == nil {
+		return
+	}
+	for i, offset := range b.prgWindows() {
+		if offset != before[i] && offset >= 0 {
+			b.logEvent(EventBankSwitch, 0x8000+uint16(i)*0x2000, uint8(offset/0x2000))
+		}
+	}
+}
+
+// watchInterrupt notes the interrupt the CPU takes in the next cycle
+func (b *Bus) watchInterrupt() {
+	if !b.events.enabled && b.debugEvents == nil {
+		return
+	}
+	c := b.cpu
+	if c.halt || c.cycles != 0 || c.stall != 0 || c.fetching() {
+		return
+	}
+	b.events.entering = true
+	if c.nmiPending {
+		b.events.entry, b.events.sources = EventNMIEntry, 0
+		return
+	}
+	b.events.entry, b.events.sources = EventIRQEntry, b.apu.irqSources()
+}
+
+// watchInstruction records the events of the CPU between the instructions:
+// the entry of the interrupt handler, and BRK and the unofficial opcodes
+// before they run
+func (b *Bus) watchInstruction() {
+	if !b.events.enabled && b.debugEvents == nil {
+		return
+	}
+	c := b.cpu
+	if c.halt || c.cycles != 0 || c.op != nil || c.stall != 0 {
+		return
+	}
+	if b.events.entering {
+		b.events.entering = false
+		vector := uint16(0xFFFA)
+		if b.events.entry == EventIRQEntry {
+			vector = 0xFFFE
+		}
+		b.logEventAt(b.events.entry, c.pc, vector, b.events.sources)
+	}
+	if !c.fetching() {
+		return
+	}
+	switch op := b.PeekMemory(c.pc); {
+	case op == 0x00:
+		b.logEventAt(EventBRK, c.pc, c.pc, op)
+	case unofficial(op):
+		b.logEventAt(EventIllegalOpcode, c.pc, c.pc, op)
+	}
+}
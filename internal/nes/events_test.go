@@ -0,0 +1,188 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Bus_Events(t *testing.T) {
+	bus := newTestBus()
+	// JMP $EAEA at $EAEA, the vectors point to it
+	for i := range bus.cart.pgrMem {
+		bus.cart.pgrMem[i] = 0xEA
+	}
+	copy(bus.cart.pgrMem[0xEAEA&0x3FFF:], []uint8{0x4C, 0xEA, 0xEA})
+	bus.cpu.Reset()
+	bus.SetEventLogging(true)
+	mem := bus.newCpuMemory()
+	p := bus.ppu
+
+	ticTo := func(scanLine, dot uint16) {
+		for p.scanLine != scanLine || p.cycles != dot {
+			bus.Tic()
+		}
+	}
+
+	ticTo(10, 100)
+	mem.Write8(0x2000, 0x80)
+	ticTo(20, 0)
+	mem.Write8(0x8000, 0x01)
+	ticTo(0, 0)
+	ticTo(0, 1)
+
+	events := bus.Events(nil)
+	if assert.Len(t, events, 5) {
+		assert.Equal(t, Event{Type: EventRegisterWrite, ScanLine: 10, Dot: 100, PC: 0xEAEA, Addr: 0x2000, Data: 0x80}, events[0])
+		assert.Equal(t, EventMapperWrite, events[1].Type)
+		assert.Equal(t, EventVBlank, events[2].Type)
+		assert.Equal(t, EventNMI, events[3].Type)
+		assert.Equal(t, ppuVblankScanline, events[3].ScanLine)
+		assert.Equal(t, EventNMIEntry, events[4].Type)
+		assert.Equal(t, uint16(0xEAEA), events[4].PC)
+	}
+
+	nmi := bus.Events(func(e Event) bool { return e.Type == EventNMI })
+	assert.Len(t, nmi, 1)
+	img := bus.EventView()
+	assert.Equal(t, eventColors[EventRegisterWrite], img.RGBAAt(100, 10))
+}
+
+func Test_Bus_Events_CPU(t *testing.T) {
+	bus := newTraceBus()
+	bus.SetEventLogging(true)
+	// $8000 BRK, the handler at $8010 runs SLO $10
+	bus.cart.pgrMem[0x0000] = 0x00
+	bus.cart.pgrMem[0x0010] = 0x07
+	bus.cart.pgrMem[0x0011] = 0x10
+	bus.cart.pgrMem[0x3FFE] = 0x10
+	bus.cart.pgrMem[0x3FFF] = 0x80
+
+	for len(bus.events.current) < 2 {
+		bus.Tic()
+	}
+	events := bus.events.current
+	assert.Equal(t, EventBRK, events[0].Type)
+	assert.Equal(t, uint16(0x8000), events[0].PC)
+	assert.Equal(t, EventIllegalOpcode, events[1].Type)
+	assert.Equal(t, uint16(0x8010), events[1].PC)
+	assert.Equal(t, uint8(0x07), events[1].Data)
+}
+
+func Test_Bus_Events_IRQEntry(t *testing.T) {
+	bus := newTraceBus()
+	bus.SetEventLogging(true)
+	// $8000 CLI, $8001 JMP $8001, the handler at $8010
+	copy(bus.cart.pgrMem, []uint8{0x58, 0x4C, 0x01, 0x80})
+	bus.cart.pgrMem[0x0010] = 0xEA
+	bus.cart.pgrMem[0x3FFE] = 0x10
+	bus.cart.pgrMem[0x3FFF] = 0x80
+
+	var entries []Event
+	for i := 0; i < 3*40000 && len(entries) == 0; i++ {
+		bus.Tic()
+		for _, e := range bus.events.current {
+			if e.Type == EventIRQEntry {
+				entries = append(entries, e)
+			}
+		}
+	}
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, uint16(0x8010), entries[0].PC)
+		assert.Equal(t, uint16(0xFFFE), entries[0].Addr)
+		assert.Equal(t, IRQFrameCounter, entries[0].Data)
+	}
+}
+
+// bankTestMapper switches the bank of the window $8000-$9FFF on writes
+type bankTestMapper struct {
+	cart *Cart
+	bank uint16
+}
+
+func (m *bankTestMapper) mapAddr(addr uint16) uint16 {
+	if addr < 0xA000 {
+		return m.bank<<13 | addr&0x1FFF
+	}
+	return addr & 0x3FFF
+}
+
+func (m *bankTestMapper) Read8(addr uint16) uint8 {
+	return m.cart.pgrMem[m.mapAddr(addr)]
+}
+
+func (m *bankTestMapper) Write8(addr uint16, data uint8) {
+	m.bank = uint16(data & 1)
+}
+
+func Test_Bus_Events_Sources(t *testing.T) {
+	bus := newTestBus()
+	for i := range bus.cart.pgrMem {
+		bus.cart.pgrMem[i] = 0xEA
+	}
+	bus.cart.mapper = &bankTestMapper{cart: bus.cart}
+	// the program at $F000, out of the switched window
+	copy(bus.cart.pgrMem[0x3000:], []uint8{
+		0xA9, 0x0F, 0x8D, 0x15, 0x40, // LDA #$0F, STA $4015
+		0xA9, 0x02, 0x8D, 0x14, 0x40, // LDA #$02, STA $4014
+		0xA9, 0x01, 0x8D, 0x00, 0x80, // LDA #$01, STA $8000
+		0x8D, 0x00, 0x80, // STA $8000
+		0x4C, 0x12, 0xF0, // JMP $F012
+	})
+	bus.cart.pgrMem[0x3FFC], bus.cart.pgrMem[0x3FFD] = 0x00, 0xF0
+	bus.cpu.Reset()
+	bus.SetEventLogging(true)
+
+	for len(bus.events.current) < 6 {
+		bus.Tic()
+	}
+	events := bus.events.current
+	for i := range events {
+		// the position isn't checked here
+		events[i].ScanLine, events[i].Dot = 0, 0
+	}
+	assert.Equal(t, []Event{
+		{Type: EventAPURegisterWrite, PC: 0xF002, Addr: 0x4015, Data: 0x0F},
+		{Type: EventAPURegisterWrite, PC: 0xF007, Addr: 0x4014, Data: 0x02},
+		{Type: EventOAMDMA, PC: 0xF007, Addr: 0x0200, Data: 0x02},
+		{Type: EventMapperWrite, PC: 0xF00C, Addr: 0x8000, Data: 0x01},
+		{Type: EventBankSwitch, PC: 0xF00C, Addr: 0x8000, Data: 1},
+		{Type: EventMapperWrite, PC: 0xF00F, Addr: 0x8000, Data: 0x01}, // the same bank isn't a switch
+	}, events)
+
+	// the frames are numbered
+	for range 2 {
+		bus.RunFrame()
+	}
+	for bus.ppu.scanLine != 0 || bus.ppu.cycles != 1 {
+		bus.Tic()
+	}
+	events = bus.Events(EventFilter{Sources: []EventSource{SourcePPU}}.Match)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, EventVBlank, events[0].Type)
+		assert.Equal(t, uint64(1), events[0].Frame, "the vblank of the second frame")
+	}
+}
+
+func Test_EventFilter(t *testing.T) {
+	nmi := Event{Type: EventNMI}
+	write := Event{Type: EventAPURegisterWrite}
+	assert.True(t, EventFilter{}.Match(nmi))
+	assert.True(t, EventFilter{Types: []EventType{EventNMI}}.Match(nmi))
+	assert.False(t, EventFilter{Types: []EventType{EventNMI}}.Match(write))
+	assert.True(t, EventFilter{Sources: []EventSource{SourceAPU}}.Match(write))
+	assert.False(t, EventFilter{Types: []EventType{EventNMI}, Sources: []EventSource{SourceAPU}}.Match(nmi))
+
+	for tp := EventType(0); tp < eventTypeCount; tp++ {
+		parsed, err := ParseEventType(tp.String())
+		assert.NoError(t, err)
+		assert.Equal(t, tp, parsed)
+		assert.Contains(t, eventColors, tp)
+	}
+	_, err := ParseEventType("nope")
+	assert.Error(t, err)
+	source, err := ParseEventSource("mapper")
+	assert.NoError(t, err)
+	assert.Equal(t, SourceMapper, source)
+	assert.Equal(t, SourceMapper, EventBankSwitch.Source())
+}
@@ -0,0 +1,35 @@
+package nes
+
+import "image"
+
+// VideoFilter converts a frame of pixels into RGBA pixels.
+// Every pixel is a 6-bit palette index in the lower bits
+// and the color emphasis in bits 6-8 (red, green, blue)
+type VideoFilter interface {
+	Apply(dst *image.RGBA, pixels []uint16)
+}
+
+// frameSkipper is a VideoFilter which keeps the state between frames.
+// Skip is called instead of Apply for the frame which isn't converted
+type frameSkipper interface {
+	Skip()
+}
+
+// PaletteFilter maps every pixel directly to the palette color
+type PaletteFilter struct {
+	Palette *Palette // nil: the system palette
+}
+
+func (f PaletteFilter) Apply(dst *image.RGBA, pixels []uint16) {
+	palette := f.Palette
+	if palette == nil {
+		palette = defaultPalette
+	}
+	for i, pixel := range pixels {
+		c := palette[pixel>>6&0x7][pixel&0x3F]
+		dst.Pix[i*4+0] = c.R
+		dst.Pix[i*4+1] = c.G
+		dst.Pix[i*4+2] = c.B
+		dst.Pix[i*4+3] = c.A
+	}
+}
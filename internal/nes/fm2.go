@@ -0,0 +1,245 @@
+package nes
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// FCEUX movies (.fm2) are text files: the header with a field per line,
+// then a line per frame with the commands and the controllers
+//
+//	version 3
+//	romFilename smb
+//	romChecksum base64:jjYwGG411HcjG/j9UOVM3Q==
+//	fourscore 0
+//	port0 1
+//	port1 1
+//	port2 0
+//	|0|R......A|........||
+//
+// Only the power-on movies with the standard controllers are supported,
+// the save states of FCEUX can't be loaded.
+const (
+	fm2Version = 3
+
+	// the commands of the frame
+	fm2SoftReset = 0x1
+	fm2HardReset = 0x2
+
+	// the devices of the ports
+	fm2DeviceNone    = 0
+	fm2DeviceGamepad = 1
+)
+
+// fm2Buttons is the order of the buttons in the frame lines
+const fm2Buttons = "RLDUTSBA"
+
+// ReadFM2 reads the FCEUX movie from r
+func ReadFM2(r io.Reader) (*Movie, error) {
+	s := bufio.NewScanner(r)
+	// the save state is a long line
+	s.Buffer(nil, 16<<20)
+
+	m := &Movie{}
+	ports := [2]int{fm2DeviceGamepad, fm2DeviceGamepad}
+	line := 0
+	for s.Scan() {
+		line++
+		text := s.Text()
+		if strings.HasPrefix(text, "|") {
+			if err := m.readFM2Frame(text, ports); err != nil {
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			continue
+		}
+
+		key, value, _ := strings.Cut(text, " ")
+		var err error
+		switch key {
+		case "version":
+			if value != strconv.Itoa(fm2Version) {
+				err = fmt.Errorf("unsupported version %s", value)
+			}
+		case "binary":
+			if value != "0" && value != "false" {
+				err = fmt.Errorf("binary movies are not supported")
+			}
+		case "romFilename":
+			m.ROMName = value
+		case "romChecksum":
+			var sum []byte
+			sum, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(value, "base64:"))
+			if err == nil && len(sum) != len(m.ROMMD5) {
+				err = fmt.Errorf("invalid ROM checksum %q", value)
+			}
+			copy(m.ROMMD5[:], sum)
+		case "rerecordCount":
+			m.Rerecords, err = strconv.Atoi(value)
+		case "fourscore":
+			m.FourScore = value == "1"
+		case "port0", "port1":
+			port := int(key[4] - '0')
+			ports[port], err = strconv.Atoi(value)
+			if err == nil && ports[port] != fm2DeviceNone && ports[port] != fm2DeviceGamepad {
+				err = fmt.Errorf("the device %s of the %s is not supported", value, key)
+			}
+		case "palFlag":
+			if value == "1" {
+				err = fmt.Errorf("PAL movies are not supported")
+			}
+		case "savestate":
+			err = fmt.Errorf("the movie starts from an FCEUX save state, only power-on movies are supported")
+		}
+		// the other fields, e.g. the comments and the subtitles, don't affect the playback
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't read the movie: %s", err)
+	}
+	return m, nil
+}
+
+// readFM2Frame parses the frame line: |commands|port0|port1|port2|,
+// or |commands|1|2|3|4|port2| with the Four Score
+func (m *Movie) readFM2Frame(text string, ports [2]int) error {
+	fields := strings.Split(text, "|")
+	if len(fields) < 3 {
+		return fmt.Errorf("invalid frame %q", text)
+	}
+	commands, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return fmt.Errorf("invalid commands %q", fields[1])
+	}
+
+	frame := len(m.Frames)
+	switch {
+	case commands&fm2HardReset != 0:
+		// the movie starts at power-on anyway
+		if frame > 0 {
+			m.Resets = append(m.Resets, MovieReset{Frame: frame, Power: true})
+		}
+	case commands&fm2SoftReset != 0:
+		m.Resets = append(m.Resets, MovieReset{Frame: frame})
+	}
+
+	var buttons [4]Button
+	controllers := fields[2:]
+	count := 4
+	if !m.FourScore {
+		count = len(ports)
+	}
+	if len(controllers) < count {
+		return fmt.Errorf("expected %d controllers in %q", count, text)
+	}
+	for port := 0; port < count; port++ {
+		// the field of a port without a device is empty
+		if !m.FourScore && ports[port] == fm2DeviceNone {
+			continue
+		}
+		buttons[port], err = parseFM2Buttons(controllers[port])
+		if err != nil {
+			return err
+		}
+	}
+	m.Frames = append(m.Frames, buttons)
+	return nil
+}
+
+// parseFM2Buttons parses the RLDUTSBA field, any character but
+// a dot or a space is a pressed button
+func parseFM2Buttons(field string) (Button, error) {
+	if len(field) != len(fm2Buttons) {
+		return 0, fmt.Errorf("invalid buttons %q", field)
+	}
+	var buttons Button
+	for i := 0; i < len(field); i++ {
+		if field[i] != '.' && field[i] != ' ' {
+			buttons |= ButtonRight >> i
+		}
+	}
+	return buttons, nil
+}
+
+// WriteFM2 writes the movie as an FCEUX movie
+func (m *Movie) WriteFM2(w io.Writer) error {
+	if m.State != nil {
+		return fmt.Errorf("the movie starts from a save state, FCEUX can't load it")
+	}
+	if m.ROMMD5 == [16]byte{} {
+		return fmt.Errorf("the MD5 of the ROM is not known")
+	}
+
+	bw := bufio.NewWriter(w)
+	fourScore := 0
+	if m.FourScore {
+		fourScore = 1
+	}
+	fmt.Fprintf(bw, "version %d\n", fm2Version)
+	fmt.Fprintf(bw, "emuVersion 0\n")
+	fmt.Fprintf(bw, "rerecordCount %d\n", m.Rerecords)
+	fmt.Fprintf(bw, "palFlag 0\n")
+	fmt.Fprintf(bw, "romFilename %s\n", strings.TrimSuffix(m.ROMName, ".nes"))
+	fmt.Fprintf(bw, "romChecksum base64:%s\n", base64.StdEncoding.EncodeToString(m.ROMMD5[:]))
+	fmt.Fprintf(bw, "guid %s\n", m.fm2GUID())
+	fmt.Fprintf(bw, "fourscore %d\n", fourScore)
+	fmt.Fprintf(bw, "port0 %d\n", fm2DeviceGamepad)
+	fmt.Fprintf(bw, "port1 %d\n", fm2DeviceGamepad)
+	fmt.Fprintf(bw, "port2 0\n")
+
+	ports := 2
+	if m.FourScore {
+		ports = 4
+	}
+	for i, frame := range m.Frames {
+		commands := 0
+		if r := m.reset(i); r != nil && r.Power {
+			commands = fm2HardReset
+		} else if r != nil {
+			commands = fm2SoftReset
+		}
+		fmt.Fprintf(bw, "|%d|", commands)
+		for port := 0; port < ports; port++ {
+			fmt.Fprintf(bw, "%s|", formatFM2Buttons(frame[port]))
+		}
+		fmt.Fprintln(bw, "|")
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("couldn't write the movie: %s", err)
+	}
+	return nil
+}
+
+// formatFM2Buttons formats the buttons as the RLDUTSBA field
+func formatFM2Buttons(buttons Button) string {
+	field := []byte(fm2Buttons)
+	for i := range field {
+		if buttons&(ButtonRight>>i) == 0 {
+			field[i] = '.'
+		}
+	}
+	return string(field)
+}
+
+// fm2GUID identifies the movie, FCEUX matches the save states made
+// during the playback with it. It is derived from the input,
+// so the same movie always gets the same GUID
+func (m *Movie) fm2GUID() string {
+	sum := md5.New()
+	sum.Write(m.ROMMD5[:])
+	for _, frame := range m.Frames {
+		sum.Write([]byte{uint8(frame[0]), uint8(frame[1]), uint8(frame[2]), uint8(frame[3])})
+	}
+	for _, r := range m.Resets {
+		binary.Write(sum, binary.LittleEndian, int64(r.Frame))
+	}
+	g := sum.Sum(nil)
+	return fmt.Sprintf("%X-%X-%X-%X-%X", g[0:4], g[4:6], g[6:8], g[8:10], g[10:16])
+}
@@ -0,0 +1,35 @@
+package nes
+
+// The Four Score plugs four controllers into the two ports. A port
+// reports 24 bits: the 8 buttons of its controller, the 8 buttons of
+// the controller 3 or 4, and the signature which tells the games
+// the adapter is present. After the 24 bits the reads return 1.
+type fourScore struct {
+	enabled bool
+	shift   [2]uint32
+	strobe  bool
+}
+
+// the signatures in the order they are read, $10 on $4016 and $20 on $4017
+// when the games shift them in MSB first
+var fourScoreSignatures = [2]uint32{0x08, 0x04}
+
+// SetFourScore plugs the Four Score in, the controllers 3 and 4
+// are read after the controllers 1 and 2
+func (b *Bus) SetFourScore(enabled bool) {
+	b.fourScore = fourScore{enabled: enabled}
+}
+
+// FourScore reports whether the Four Score is plugged in
+func (b *Bus) FourScore() bool {
+	return b.fourScore.enabled
+}
+
+// latch loads the buttons and the signatures into the shift registers
+func (f *fourScore) latch(controllers [4]Controller) {
+	for port := range f.shift {
+		f.shift[port] = uint32(controllers[port].buttons) |
+			uint32(controllers[port+2].buttons)<<8 |
+			fourScoreSignatures[port]<<16
+	}
+}
@@ -0,0 +1,59 @@
+package nes
+
+// inputState is the input of the frame as the console received it
+type inputState struct {
+	buttons   [4]Button
+	frames    int  // frames with the input set since power-on
+	polled    bool // the game read the controllers during the frame
+	lag       bool // the last frame didn't read the controllers
+	lagFrames int
+}
+
+// InputView is the input of the current frame for the on-screen
+// input display. The buttons are the ones the controllers got:
+// the toggled turbo buttons and the input of the playing movie
+type InputView struct {
+	Buttons [4]Button
+	Ports   int // 2, or 4 with the Four Score
+
+	Frame int // frames since power-on
+	// the previous frame didn't read the controllers, the game ignored the input
+	Lag       bool
+	LagFrames int
+
+	Movie      MovieMode
+	MovieFrame int
+	ReadOnly   bool
+}
+
+// InputView returns the input of the current frame
+func (b *Bus) InputView() InputView {
+	view := InputView{
+		Buttons:    b.input.buttons,
+		Ports:      2,
+		Frame:      b.input.frames,
+		Lag:        b.input.lag,
+		LagFrames:  b.input.lagFrames,
+		Movie:      b.movie.mode,
+		MovieFrame: b.movie.frame,
+		ReadOnly:   b.movie.readOnly,
+	}
+	if b.fourScore.enabled {
+		view.Ports = 4
+	}
+	return view
+}
+
+// updateInput starts the input of the next frame
+func (b *Bus) updateInput(buttons [4]Button) {
+	s := &b.input
+	if s.frames > 0 {
+		s.lag = !s.polled
+		if s.lag {
+			s.lagFrames++
+		}
+	}
+	s.buttons = buttons
+	s.frames++
+	s.polled = false
+}
@@ -0,0 +1,114 @@
+package nes
+
+import "fmt"
+
+// ExpansionDevice is a device plugged into the Famicom expansion port.
+// It sees the $4016 writes and drives the bits of the $4016 and $4017
+// reads along with the controllers.
+type ExpansionDevice interface {
+	write(data uint8)
+	read(port int) uint8
+}
+
+// SetExpansionDevice plugs the device into the expansion port, nil unplugs it
+func (b *Bus) SetExpansionDevice(d ExpansionDevice) {
+	b.expansionPort = d
+}
+
+// ExpansionDevice returns the device plugged into the expansion port
+func (b *Bus) ExpansionDevice() ExpansionDevice {
+	return b.expansionPort
+}
+
+// KeyboardKey is a key of the Family BASIC keyboard:
+// the row in bits 3-6, the column in bit 2 and the bit in bits 0-1
+type KeyboardKey uint8
+
+// the keys of the matrix by the row, the column and the bit
+var keyboardKeyNames = [9][2][4]string{
+	{{"]", "[", "Return", "F8"}, {"Stop", "Yen", "RShift", "Kana"}},
+	{{";", ":", "@", "F7"}, {"^", "-", "/", "_"}},
+	{{"K", "L", "O", "F6"}, {"0", "P", ",", "."}},
+	{{"J", "U", "I", "F5"}, {"8", "9", "N", "M"}},
+	{{"H", "G", "Y", "F4"}, {"6", "7", "V", "B"}},
+	{{"D", "R", "T", "F3"}, {"4", "5", "C", "F"}},
+	{{"A", "S", "W", "F2"}, {"3", "E", "Z", "X"}},
+	{{"Ctr", "Q", "Esc", "F1"}, {"2", "1", "Grph", "LShift"}},
+	{{"Left", "Right", "Up", "ClrHome"}, {"Ins", "Del", "Space", "Down"}},
+}
+
+func (k KeyboardKey) String() string {
+	return keyboardKeyNames[k>>3][k>>2&0x1][k&0x3]
+}
+
+// ParseKeyboardKey returns the key by the name on it, e.g. A, Return or ClrHome
+func ParseKeyboardKey(s string) (KeyboardKey, error) {
+	for row := range keyboardKeyNames {
+		for column := range keyboardKeyNames[row] {
+			for bit, name := range keyboardKeyNames[row][column] {
+				if name == s {
+					return KeyboardKey(row<<3 | column<<2 | bit), nil
+				}
+			}
+		}
+	}
+	return 0, fmt.Errorf("unknown keyboard key %q", s)
+}
+
+// Keyboard is the Family BASIC keyboard. The $4016 writes scan
+// the 9 rows of the matrix: bit 0 selects the first row, bit 1 selects
+// the column and moves to the next row when it goes low, bit 2
+// enables the matrix. The $4017 reads return the 4 keys
+// of the column in bits 1-4, 0 is pressed.
+type Keyboard struct {
+	keys    [9][2]uint8 // pressed keys in bits 0-3
+	row     int
+	column  int
+	enabled bool
+}
+
+// NewKeyboard returns the keyboard with no keys pressed
+func NewKeyboard() *Keyboard {
+	return &Keyboard{}
+}
+
+// SetKeys sets the pressed keys, the other keys are released
+func (k *Keyboard) SetKeys(keys []KeyboardKey) {
+	k.keys = [9][2]uint8{}
+	for _, key := range keys {
+		k.Press(key)
+	}
+}
+
+// Press presses the key
+func (k *Keyboard) Press(key KeyboardKey) {
+	k.keys[key>>3][key>>2&0x1] |= 1 << (key & 0x3)
+}
+
+// Release releases the key
+func (k *Keyboard) Release(key KeyboardKey) {
+	k.keys[key>>3][key>>2&0x1] &^= 1 << (key & 0x3)
+}
+
+func (k *Keyboard) write(data uint8) {
+	k.enabled = data&0x4 != 0
+	column := int(data >> 1 & 0x1)
+	if k.column == 1 && column == 0 {
+		k.row++
+	}
+	k.column = column
+	if data&0x1 != 0 {
+		k.row = 0
+	}
+}
+
+func (k *Keyboard) read(port int) uint8 {
+	if port != 1 || !k.enabled {
+		return 0
+	}
+	// the reads after the last row find no keys pressed
+	if k.row >= len(k.keys) {
+		return 0x1E
+	}
+	return ^k.keys[k.row][k.column] << 1 & 0x1E
+}
@@ -7,6 +7,12 @@ type Mapper interface {
 	ReadWriter
 }
 
+// A12Watcher is implemented by mappers which are clocked by rising edges
+// of the PPU address line A12, like the MMC3 scanline counter
+type A12Watcher interface {
+	A12Rise()
+}
+
 func NewMapper(cart *Cart) Mapper {
 	switch cart.mapperID {
 	case 0:
@@ -47,8 +53,11 @@ func (m Mapper0) Read8(addr uint16) uint8 {
 
 func (m *Mapper0) Write8(addr uint16, data uint8) {
 	switch {
-	// Write to CHR ROM
+	// Write to CHR RAM
 	case addr <= 0x1FFF:
+		if m.cart.chrRAM {
+			m.cart.chrMem[m.mapAddr(addr)] = data
+		}
 	// Write to PRG ROM
 	case addr >= 0x8000 && addr <= 0xFFFF:
 		m.cart.pgrMem[m.mapAddr(addr)] = data
@@ -38,14 +38,31 @@ func (b *Bus) newCpuMemory() *cpuMemory {
 }
 
 func (c cpuMemory) Read8(addr uint16) uint8 {
+	data := c.read8(addr)
+	if c.bus.debug != nil {
+		c.bus.debugAccess(addr, data, false)
+	}
+	return data
+}
+
+func (c cpuMemory) read8(addr uint16) uint8 {
 	switch {
 	// read from ram
 	case addr < 0x2000:
 		return c.bus.ram.Read8(addr & 0x07FF)
 	// read from ppu
 	case addr < 0x4000:
-		return c.bus.ppu.readRegister(addr & 0x7)
+		data := c.bus.ppu.readRegister(addr & 0x7)
+		c.bus.logEvent(EventRegisterRead, addr, data)
+		return data
 	// read from apu
+	case addr == 0x4015:
+		return c.bus.apu.readRegister(addr)
+	// read from the controllers, the upper bits are open bus
+	case addr == 0x4016:
+		return 0x40 | c.bus.readController(0)
+	case addr == 0x4017:
+		return 0x40 | c.bus.readController(1)
 	case addr < 0x4018:
 		return 0
 	// read from io
@@ -53,7 +70,14 @@ func (c cpuMemory) Read8(addr uint16) uint8 {
 		return 0
 	// read from cartridge
 	case addr <= 0xFFFF:
-		return c.bus.cart.Read8(addr)
+		data := c.bus.cart.Read8(addr)
+		if c.bus.cdl != nil {
+			c.bus.logData(addr)
+		}
+		if len(c.bus.patches) > 0 {
+			data = c.bus.patchRead(addr, data)
+		}
+		return data
 	}
 
 	log.Fatalln("cpuMemory: unhandled read8 at address", addr)
@@ -61,6 +85,12 @@ func (c cpuMemory) Read8(addr uint16) uint8 {
 }
 
 func (c *cpuMemory) Write8(addr uint16, data uint8) {
+	if c.bus.debug != nil {
+		defer c.bus.debugAccess(addr, data, true)
+	}
+	if len(c.bus.freezes) > 0 && addr < 0x2000 {
+		data = c.bus.freezeWrite(addr, data)
+	}
 	switch {
 	// write to ram
 	case addr < 0x2000:
@@ -68,9 +98,24 @@ func (c *cpuMemory) Write8(addr uint16, data uint8) {
 		return
 	// write to ppu
 	case addr < 0x4000:
+		c.bus.logEvent(EventRegisterWrite, addr, data)
 		c.bus.ppu.writeRegister(addr&0x7, data)
 		return
-	// write to apu
+	// oam dma
+	case addr == 0x4014:
+		c.bus.logEvent(EventAPURegisterWrite, addr, data)
+		c.bus.oamDMA(data)
+		return
+	// the strobe goes to all the controllers
+	case addr == 0x4016:
+		c.bus.logEvent(EventAPURegisterWrite, addr, data)
+		c.bus.writeControllers(data)
+		return
+	// write to apu, $4017 is the frame counter
+	case addr < 0x4016, addr == 0x4017:
+		c.bus.logEvent(EventAPURegisterWrite, addr, data)
+		c.bus.apu.writeRegister(addr, data)
+		return
 	case addr < 0x4018:
 		return
 	// write to io
@@ -78,7 +123,11 @@ func (c *cpuMemory) Write8(addr uint16, data uint8) {
 		return
 		// write to cartridge
 	case addr <= 0xFFFF:
+		c.bus.logEvent(EventMapperWrite, addr, data)
+		c.bus.apu.logExpansionWrite(addr, data)
+		windows := c.bus.prgWindows()
 		c.bus.cart.Write8(addr, data)
+		c.bus.watchBanks(windows)
 		return
 	}
 
@@ -96,44 +145,102 @@ func (c *cpuMemory) Write8(addr uint16, data uint8) {
 // $3F20-$3FFF: Mirrors of $3F00-$3F1F
 type ppuMemory struct {
 	bus *Bus
+	a12 a12Filter
+}
+
+// a12Filter detects rising edges of the PPU address line A12.
+// Like the MMC3, it ignores edges after A12 was low only for a short time,
+// so only the switch from background to sprite patterns clocks the mapper
+type a12Filter struct {
+	high bool
+	low  uint64 // dot when A12 went low
 }
 
-func (b Bus) newPpuMemory() *ppuMemory {
-	return &ppuMemory{bus: &b}
+// a12MinLowDots is how long A12 must stay low before a rising edge counts
+const a12MinLowDots = 10
+
+// update tracks A12 of the address accessed at the dot
+// and reports whether it is a filtered rising edge
+func (f *a12Filter) update(addr uint16, dot uint64) bool {
+	high := addr&0x1000 != 0
+	rise := high && !f.high && dot-f.low >= a12MinLowDots
+	if !high && f.high {
+		f.low = dot
+	}
+	f.high = high
+	return rise
 }
 
-func (p ppuMemory) Read8(addr uint16) uint8 {
+// watchA12 notifies the mapper about rising edges of A12
+func (p *ppuMemory) watchA12(addr uint16) {
+	if !p.a12.update(addr, p.bus.ppu.clock) {
+		return
+	}
+	if w, ok := p.bus.cart.mapper.(A12Watcher); ok {
+		w.A12Rise()
+	}
+}
+
+func (b *Bus) newPpuMemory() *ppuMemory {
+	return &ppuMemory{bus: b}
+}
+
+// nametableAddr maps $2000-$2FFF into one of two physical nametables
+// according to the cartridge mirroring
+func (p ppuMemory) nametableAddr(addr uint16) (table uint16, offset uint16) {
+	offset = addr & 0x3FF
+	switch p.bus.cart.mirror {
+	case mirrorVertical:
+		table = (addr >> 10) & 0x1
+	default:
+		table = (addr >> 11) & 0x1
+	}
+	return table, offset
+}
+
+// palleteAddr maps $3F00-$3FFF into the palette RAM.
+// $3F10/$3F14/$3F18/$3F1C are mirrors of $3F00/$3F04/$3F08/$3F0C
+func palleteAddr(addr uint16) uint16 {
+	addr &= 0x1F
+	if addr&0x13 == 0x10 {
+		addr &= 0x0F
+	}
+	return addr
+}
+
+func (p *ppuMemory) Read8(addr uint16) uint8 {
+	p.watchA12(addr & 0x3FFF)
+	return p.peek8(addr)
+}
+
+// peek8 reads without notifying the mapper, for debugging tools
+func (p *ppuMemory) peek8(addr uint16) uint8 {
 	addr &= 0x3FFF
 	switch {
 	case addr < 0x2000:
 		return p.bus.cart.Read8(addr)
 	case addr < 0x3F00:
+		table, offset := p.nametableAddr(addr)
+		return p.bus.ppu.tableNames[table][offset]
 	case addr < 0x4000:
-		addr &= 0x1F
-		// Palette mirroring
-		if addr >= 0x10 {
-			addr -= 0x10
-		}
-		return p.bus.ppu.tablePallete[addr]
+		return p.bus.ppu.tablePallete[palleteAddr(addr)]
 	}
 	return 0
 }
 
 func (p *ppuMemory) Write8(addr uint16, data uint8) {
 	addr &= 0x3FFF
+	p.watchA12(addr)
 	switch {
 	case addr < 0x2000:
 		p.bus.cart.Write8(addr, data)
 		return
 	case addr < 0x3F00:
+		table, offset := p.nametableAddr(addr)
+		p.bus.ppu.tableNames[table][offset] = data
 		return
 	case addr < 0x4000:
-		addr &= 0x1F
-		// Palette mirroring
-		if addr >= 0x10 {
-			addr -= 0x10
-		}
-		p.bus.ppu.tablePallete[addr] = data
+		p.bus.ppu.tablePallete[palleteAddr(addr)] = data
 		return
 	}
 }
@@ -0,0 +1,102 @@
+package nes
+
+import "fmt"
+
+// MemorySpace is a memory of the console the hex viewers show
+type MemorySpace uint8
+
+const (
+	MemoryCPU MemorySpace = iota // the CPU address space, $0000-$FFFF
+	MemoryPPU                    // the PPU address space, $0000-$3FFF
+	MemoryOAM                    // the 256 bytes of the sprites
+	MemoryPRG                    // the PRG ROM of the cartridge
+	MemoryCHR                    // the CHR ROM or RAM of the cartridge
+)
+
+var memorySpaceNames = []string{"cpu", "ppu", "oam", "prg", "chr"}
+
+func (m MemorySpace) String() string {
+	if int(m) < len(memorySpaceNames) {
+		return memorySpaceNames[m]
+	}
+	return fmt.Sprintf("MemorySpace(%d)", int(m))
+}
+
+// ParseMemorySpace returns the memory by its name, e.g. cpu or chr
+func ParseMemorySpace(s string) (MemorySpace, error) {
+	for i, name := range memorySpaceNames {
+		if name == s {
+			return MemorySpace(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown memory %q", s)
+}
+
+// MemorySize returns the size of the memory, 0 for the ROM
+// without the cartridge
+func (b *Bus) MemorySize(m MemorySpace) int {
+	switch m {
+	case MemoryCPU:
+		return 0x10000
+	case MemoryPPU:
+		return 0x4000
+	case MemoryOAM:
+		return len(b.ppu.oam)
+	case MemoryPRG:
+		if b.cart != nil {
+			return len(b.cart.pgrMem)
+		}
+	case MemoryCHR:
+		if b.cart != nil {
+			return len(b.cart.chrMem)
+		}
+	}
+	return 0
+}
+
+// Peek reads the memory without the side effects of the read,
+// the address is below MemorySize
+func (b *Bus) Peek(m MemorySpace, addr int) uint8 {
+	switch m {
+	case MemoryCPU:
+		return b.PeekMemory(uint16(addr))
+	case MemoryPPU:
+		if b.cart == nil && addr < 0x2000 {
+			return 0
+		}
+		return b.newPpuMemory().peek8(uint16(addr))
+	case MemoryOAM:
+		return b.ppu.oam[addr]
+	case MemoryPRG:
+		return b.cart.pgrMem[addr]
+	case MemoryCHR:
+		return b.cart.chrMem[addr]
+	}
+	return 0
+}
+
+// Poke changes the memory without the side effects of the write, the hex
+// editors edit the memory with it. In the CPU space the RAM and the cartridge
+// are changed, the registers are not. In the PPU space the CHR ROM is not,
+// it is changed in the CHR space
+func (b *Bus) Poke(m MemorySpace, addr int, data uint8) {
+	switch m {
+	case MemoryCPU:
+		switch {
+		case addr < 0x2000:
+			b.ram.Write8(uint16(addr)&0x07FF, data)
+		case addr >= 0x4020 && b.cart != nil:
+			b.cart.Write8(uint16(addr), data)
+		}
+	case MemoryPPU:
+		if b.cart != nil || addr >= 0x2000 {
+			b.newPpuMemory().Write8(uint16(addr), data)
+		}
+	case MemoryOAM:
+		b.ppu.oam[addr] = data
+	case MemoryPRG:
+		b.cart.pgrMem[addr] = data
+	case MemoryCHR:
+		b.cart.chrMem[addr] = data
+	}
+}
@@ -0,0 +1,47 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Bus_Poke(t *testing.T) {
+	bus := newSnapshotBus()
+	assert.Equal(t, 0x10000, bus.MemorySize(MemoryCPU))
+	assert.Equal(t, 0x4000, bus.MemorySize(MemoryPPU))
+	assert.Equal(t, 256, bus.MemorySize(MemoryOAM))
+	assert.Equal(t, prgBankSizeBytes, bus.MemorySize(MemoryPRG))
+	assert.Equal(t, chrBankSizeBytes, bus.MemorySize(MemoryCHR))
+
+	bus.Poke(MemoryCPU, 0x0812, 0x42)
+	assert.Equal(t, uint8(0x42), bus.Peek(MemoryCPU, 0x0012), "the RAM mirrors")
+	bus.Poke(MemoryCPU, 0xC001, 0x33)
+	assert.Equal(t, uint8(0x33), bus.Peek(MemoryPRG, 0x0001), "the ROM is patched")
+	ctrl := bus.ppu.ppuctrl
+	bus.Poke(MemoryCPU, 0x2000, 0)
+	assert.Equal(t, ctrl, bus.ppu.ppuctrl, "the registers are not written")
+
+	bus.Poke(MemoryPPU, 0x2401, 0x24)
+	assert.Equal(t, uint8(0x24), bus.Peek(MemoryPPU, 0x2401))
+	bus.Poke(MemoryPPU, 0x3F01, 0x15)
+	assert.Equal(t, uint8(0x15), bus.Peek(MemoryPPU, 0x3F01))
+	bus.Poke(MemoryPPU, 0x0010, 0x77)
+	assert.Equal(t, uint8(0x77), bus.Peek(MemoryCHR, 0x0010), "the CHR RAM")
+
+	bus.Poke(MemoryOAM, 0xFF, 0x99)
+	assert.Equal(t, uint8(0x99), bus.Peek(MemoryOAM, 0xFF))
+	bus.Poke(MemoryCHR, 0x1FFF, 0x88)
+	assert.Equal(t, uint8(0x88), bus.Peek(MemoryPPU, 0x1FFF))
+}
+
+func Test_ParseMemorySpace(t *testing.T) {
+	for _, m := range []MemorySpace{MemoryCPU, MemoryPPU, MemoryOAM, MemoryPRG, MemoryCHR} {
+		parsed, err := ParseMemorySpace(m.String())
+		require.NoError(t, err)
+		assert.Equal(t, m, parsed)
+	}
+	_, err := ParseMemorySpace("vram")
+	assert.EqualError(t, err, `unknown memory "vram"`)
+}
@@ -0,0 +1,395 @@
+package nes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Movie is the controller input of every frame from the start state.
+// Replayed from the same start on the same ROM it reproduces the run.
+type Movie struct {
+	ROMName   string
+	ROMCRC    uint32   // CRC32 of PRG and CHR ROM, 0: not known
+	ROMMD5    [16]byte // MD5 of PRG and CHR ROM, zero: not known
+	FourScore bool
+	// State is the save state the movie starts from, nil: power-on
+	State []byte
+	// Rerecords counts the times the recording continued from an earlier frame
+	Rerecords int
+	Frames    [][4]Button
+	Resets    []MovieReset // in the frame order
+}
+
+// MovieReset is the reset button pressed, or the power cycled,
+// before the frame
+type MovieReset struct {
+	Frame int
+	Power bool
+}
+
+// MovieMode is what the console does with the movie
+type MovieMode uint8
+
+const (
+	MovieOff MovieMode = iota
+	MoviePlaying
+	MovieRecording
+)
+
+var movieModeNames = []string{"off", "playing", "recording"}
+
+func (m MovieMode) String() string {
+	if int(m) < len(movieModeNames) {
+		return movieModeNames[m]
+	}
+	return fmt.Sprintf("MovieMode(%d)", int(m))
+}
+
+// movieState is the movie the console plays or records
+type movieState struct {
+	movie    *Movie
+	mode     MovieMode
+	frame    int // the next frame of the movie
+	readOnly bool
+
+	reset *MovieReset // the reset queued for the next frame
+}
+
+// PowerOn restarts the console with the memory cleared,
+// the state movies and tests start from
+func (b *Bus) PowerOn() {
+	b.ram = NewRAM()
+	b.ppu.powerOn()
+	if b.cart != nil && b.cart.chrRAM {
+		clear(b.cart.chrMem)
+	}
+	b.controllers = [4]Controller{}
+	b.input = inputState{}
+	b.fourScore = fourScore{enabled: b.fourScore.enabled}
+	b.Reset()
+}
+
+// RecordMovie powers the console on and records a new movie
+func (b *Bus) RecordMovie() *Movie {
+	m := b.newMovie()
+	b.PowerOn()
+	b.movie = movieState{movie: m, mode: MovieRecording}
+	return m
+}
+
+// RecordMovieFromState records a new movie from the current state
+// of the console, the state is saved into the movie
+func (b *Bus) RecordMovieFromState() (*Movie, error) {
+	m := b.newMovie()
+	var state bytes.Buffer
+	if err := b.SaveState(&state); err != nil {
+		return nil, fmt.Errorf("couldn't save the state the movie starts from: %s", err)
+	}
+	m.State = state.Bytes()
+	b.movie = movieState{movie: m, mode: MovieRecording}
+	return m, nil
+}
+
+// newMovie returns the empty movie of the game
+func (b *Bus) newMovie() *Movie {
+	m := &Movie{FourScore: b.fourScore.enabled}
+	if b.cart != nil {
+		m.ROMCRC, m.ROMMD5 = b.cart.crc, b.cart.md5
+	}
+	return m
+}
+
+// PlayMovie restarts the console from the start of the movie, its save
+// state or the power-on, and plays it. In the read-only mode the movie
+// stops at the end, otherwise the live input is recorded after the end
+func (b *Bus) PlayMovie(m *Movie, readOnly bool) error {
+	if b.cart != nil {
+		if m.ROMCRC != 0 && m.ROMCRC != b.cart.crc {
+			return fmt.Errorf("the movie is recorded on another ROM, CRC %08X", m.ROMCRC)
+		}
+		if m.ROMMD5 != [16]byte{} && m.ROMMD5 != b.cart.md5 {
+			return fmt.Errorf("the movie is recorded on another ROM, MD5 %x", m.ROMMD5)
+		}
+	}
+	b.SetFourScore(m.FourScore)
+	if m.State != nil {
+		if err := b.LoadState(bytes.NewReader(m.State)); err != nil {
+			return fmt.Errorf("couldn't load the state the movie starts from: %s", err)
+		}
+	} else {
+		b.PowerOn()
+	}
+	b.movie = movieState{movie: m, mode: MoviePlaying, readOnly: readOnly}
+	return nil
+}
+
+// StopMovie stops playing or recording the movie
+func (b *Bus) StopMovie() {
+	b.movie = movieState{}
+}
+
+// Movie returns the movie, its mode and the frame it is at
+func (b *Bus) Movie() (*Movie, MovieMode, int) {
+	return b.movie.movie, b.movie.mode, b.movie.frame
+}
+
+// SetMovieReadOnly toggles the read-only mode. Turning it off while
+// the movie plays drops the rest of the movie and records the live input
+// from the current frame. Turning it on while the movie records plays it
+// back, which ends the movie at the current frame
+func (b *Bus) SetMovieReadOnly(readOnly bool) {
+	s := &b.movie
+	s.readOnly = readOnly
+	switch {
+	case !readOnly && s.mode == MoviePlaying:
+		s.movie.Frames = s.movie.Frames[:s.frame]
+		s.movie.Resets = slices.DeleteFunc(s.movie.Resets, func(r MovieReset) bool {
+			return r.Frame >= s.frame
+		})
+		s.movie.Rerecords++
+		s.mode = MovieRecording
+	case readOnly && s.mode == MovieRecording:
+		s.mode = MoviePlaying
+	}
+}
+
+// MovieReadOnly reports whether the movie is in the read-only mode
+func (b *Bus) MovieReadOnly() bool {
+	return b.movie.readOnly
+}
+
+// QueueReset presses the reset button, or cycles the power, before
+// the next frame, so a recorded movie records it
+func (b *Bus) QueueReset(power bool) {
+	b.movie.reset = &MovieReset{Power: power}
+}
+
+// SetInput sets the buttons of the controllers for the next frame,
+// the frontends call it once before every frame. While a movie plays
+// the buttons and the resets come from the movie, while it records
+// they are recorded. The frozen RAM addresses are written with the input
+func (b *Bus) SetInput(buttons [4]Button) {
+	s := &b.movie
+	reset := s.reset
+	s.reset = nil
+	switch s.mode {
+	case MoviePlaying:
+		if s.frame < len(s.movie.Frames) {
+			buttons = s.movie.Frames[s.frame]
+			reset = s.movie.reset(s.frame)
+			s.frame++
+			break
+		}
+		if s.readOnly {
+			s.mode = MovieOff
+			break
+		}
+		s.mode = MovieRecording
+		fallthrough
+	case MovieRecording:
+		if reset != nil {
+			s.movie.Resets = append(s.movie.Resets, MovieReset{Frame: s.frame, Power: reset.Power})
+		}
+		s.movie.Frames = append(s.movie.Frames, buttons)
+		s.frame++
+	}
+
+	if reset != nil && reset.Power {
+		b.PowerOn()
+	} else if reset != nil {
+		b.Reset()
+	}
+	b.updateInput(buttons)
+	for port := range b.controllers {
+		b.controllers[port].SetButtons(buttons[port])
+	}
+	b.writeFreezes()
+}
+
+// reset returns the reset before the frame
+func (m *Movie) reset(frame int) *MovieReset {
+	i, ok := slices.BinarySearchFunc(m.Resets, frame, func(r MovieReset, frame int) int {
+		return r.Frame - frame
+	})
+	if !ok {
+		return nil
+	}
+	return &m.Resets[i]
+}
+
+// movieMagic is the first line of the movie file
+const movieMagic = "nestic movie 1"
+
+// LoadMovie reads the movie file, the .fm2 files are FCEUX movies
+func LoadMovie(path string) (*Movie, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open the file: %s", err)
+	}
+	defer file.Close()
+	if isFM2(path) {
+		return ReadFM2(file)
+	}
+	return ReadMovie(file)
+}
+
+func isFM2(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".fm2")
+}
+
+// ReadMovie reads the movie from r. The movie is a text file:
+// the header with a field per line, an empty line, and a line per frame
+// with the buttons of every controller separated by |. The reset
+// and the power lines press the reset button or cycle the power
+// before the next frame
+//
+//	nestic movie 1
+//	name smb.nes
+//	rom 1A2B3C4D
+//	md5 8e3630186e35d477231bf8fd50e54cdd
+//	fourscore false
+//	rerecords 2
+//	state <base64 of the save state>
+//
+//	a+right|
+//	reset
+//	|start
+func ReadMovie(r io.Reader) (*Movie, error) {
+	s := bufio.NewScanner(r)
+	// the save state is a long line
+	s.Buffer(nil, 16<<20)
+	if !s.Scan() || s.Text() != movieMagic {
+		return nil, fmt.Errorf("not a movie file")
+	}
+
+	m := &Movie{}
+	line := 1
+	for s.Scan() {
+		line++
+		key, value, _ := strings.Cut(s.Text(), " ")
+		if key == "" {
+			break
+		}
+		var err error
+		switch key {
+		case "name":
+			m.ROMName = value
+		case "md5":
+			var sum []byte
+			if sum, err = hex.DecodeString(value); err == nil && len(sum) != len(m.ROMMD5) {
+				err = fmt.Errorf("invalid MD5 %q", value)
+			}
+			copy(m.ROMMD5[:], sum)
+		case "rom":
+			var crc uint64
+			crc, err = strconv.ParseUint(value, 16, 32)
+			m.ROMCRC = uint32(crc)
+		case "fourscore":
+			m.FourScore, err = strconv.ParseBool(value)
+		case "rerecords":
+			m.Rerecords, err = strconv.Atoi(value)
+		case "state":
+			m.State, err = base64.StdEncoding.DecodeString(value)
+		default:
+			err = fmt.Errorf("unknown field %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+	}
+
+	for s.Scan() {
+		line++
+		if s.Text() == "reset" || s.Text() == "power" {
+			m.Resets = append(m.Resets, MovieReset{Frame: len(m.Frames), Power: s.Text() == "power"})
+			continue
+		}
+		var frame [4]Button
+		for port, names := range strings.Split(s.Text(), "|") {
+			if port >= len(frame) {
+				return nil, fmt.Errorf("line %d: too many controllers", line)
+			}
+			if names == "" {
+				continue
+			}
+			for _, name := range strings.Split(names, "+") {
+				button, err := ParseButton(name)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s", line, err)
+				}
+				frame[port] |= button
+			}
+		}
+		m.Frames = append(m.Frames, frame)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't read the movie: %s", err)
+	}
+	return m, nil
+}
+
+// Save writes the movie file, the .fm2 files are FCEUX movies
+func (m *Movie) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("couldn't create the file: %s", err)
+	}
+	defer file.Close()
+	write := m.Write
+	if isFM2(path) {
+		write = m.WriteFM2
+	}
+	if err := write(file); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Write writes the movie in the format ReadMovie reads
+func (m *Movie) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, movieMagic)
+	if m.ROMName != "" {
+		fmt.Fprintf(bw, "name %s\n", m.ROMName)
+	}
+	fmt.Fprintf(bw, "rom %08X\n", m.ROMCRC)
+	if m.ROMMD5 != [16]byte{} {
+		fmt.Fprintf(bw, "md5 %x\n", m.ROMMD5)
+	}
+	fmt.Fprintf(bw, "fourscore %t\n", m.FourScore)
+	fmt.Fprintf(bw, "rerecords %d\n", m.Rerecords)
+	if m.State != nil {
+		fmt.Fprintf(bw, "state %s\n", base64.StdEncoding.EncodeToString(m.State))
+	}
+	fmt.Fprintln(bw)
+
+	ports := 2
+	if m.FourScore {
+		ports = 4
+	}
+	for i, frame := range m.Frames {
+		if r := m.reset(i); r != nil && r.Power {
+			fmt.Fprintln(bw, "power")
+		} else if r != nil {
+			fmt.Fprintln(bw, "reset")
+		}
+		names := make([]string, ports)
+		for port := range names {
+			names[port] = frame[port].String()
+		}
+		fmt.Fprintln(bw, strings.Join(names, "|"))
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("couldn't write the movie: %s", err)
+	}
+	return nil
+}
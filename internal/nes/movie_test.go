@@ -0,0 +1,172 @@
+package nes
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runMovieFrames sets the input and runs a frame for every input
+func runMovieFrames(bus *Bus, inputs ...Button) []Button {
+	done := false
+	bus.ppu.OnFrame(func(*image.RGBA) {
+		done = true
+	})
+	var seen []Button
+	for _, buttons := range inputs {
+		bus.SetInput([4]Button{buttons})
+		seen = append(seen, bus.Controller(0).Buttons())
+		for done = false; !done; {
+			bus.Tic()
+		}
+	}
+	return seen
+}
+
+func Test_Bus_PowerOn(t *testing.T) {
+	bus := newSnapshotBus()
+	for i := 0; i < 5; i++ {
+		bus.RunFrame()
+	}
+	bus.apu.writeRegister(0x4015, 0x0F)
+	bus.apu.writeRegister(0x4003, 0xF8)
+	bus.PowerOn()
+	fresh := newSnapshotBus()
+	fresh.PowerOn()
+
+	var used, powered bytes.Buffer
+	require.NoError(t, bus.SaveState(&used))
+	require.NoError(t, fresh.SaveState(&powered))
+	_, a, order := stateChunksOf(t, used.Bytes())
+	_, b, _ := stateChunksOf(t, powered.Bytes())
+	for _, id := range order {
+		if id != "THMB" {
+			assert.Equal(t, b[id], a[id], "the %q chunk is of the power-on", id)
+		}
+	}
+}
+
+func Test_Movie_RecordPlay(t *testing.T) {
+	bus := newTestBus()
+	bus.ram.Write8(0x10, 0xAA)
+	m := bus.RecordMovie()
+	assert.Equal(t, uint8(0), bus.ram.Read8(0x10), "recording starts at power-on")
+
+	runMovieFrames(bus, ButtonA, 0, ButtonStart|ButtonUp)
+	_, mode, frame := bus.Movie()
+	assert.Equal(t, MovieRecording, mode)
+	assert.Equal(t, 3, frame)
+	assert.Equal(t, [][4]Button{{ButtonA}, {}, {ButtonStart | ButtonUp}}, m.Frames)
+
+	// the live input is ignored during the playback
+	assert.NoError(t, bus.PlayMovie(m, true))
+	seen := runMovieFrames(bus, ButtonB, ButtonB, ButtonB, ButtonB)
+	assert.Equal(t, []Button{ButtonA, 0, ButtonStart | ButtonUp, ButtonB}, seen)
+	_, mode, _ = bus.Movie()
+	assert.Equal(t, MovieOff, mode, "the read-only movie stops at the end")
+
+	// turning the read-only mode off records from the current frame
+	assert.NoError(t, bus.PlayMovie(m, true))
+	runMovieFrames(bus, 0)
+	bus.SetMovieReadOnly(false)
+	runMovieFrames(bus, ButtonSelect)
+	assert.Equal(t, [][4]Button{{ButtonA}, {ButtonSelect}}, m.Frames)
+	assert.Equal(t, 1, m.Rerecords)
+
+	m.ROMCRC++
+	assert.Error(t, bus.PlayMovie(m, true))
+}
+
+func Test_Movie_RecordFromState(t *testing.T) {
+	bus := newTestBus()
+	bus.ram.Write8(0x10, 0xAA)
+	m, err := bus.RecordMovieFromState()
+	require.NoError(t, err)
+	assert.Equal(t, uint8(0xAA), bus.ram.Read8(0x10), "the state is kept")
+	assert.NotEmpty(t, m.State)
+	runMovieFrames(bus, ButtonA, ButtonB)
+
+	bus.ram.Write8(0x10, 0)
+	require.NoError(t, bus.PlayMovie(m, true))
+	assert.Equal(t, uint8(0xAA), bus.ram.Read8(0x10), "the playback starts from the state")
+	assert.Equal(t, []Button{ButtonA, ButtonB}, runMovieFrames(bus, 0, 0))
+}
+
+func Test_MovieMode_String(t *testing.T) {
+	assert.Equal(t, "recording", MovieRecording.String())
+	assert.Equal(t, "MovieMode(7)", MovieMode(7).String())
+}
+
+func Test_Movie_ReadWrite(t *testing.T) {
+	m := &Movie{
+		ROMCRC:    0x1A2B3C4D,
+		FourScore: true,
+		Rerecords: 2,
+		Frames:    [][4]Button{{ButtonA | ButtonRight}, {0, 0, ButtonStart}},
+	}
+	var out bytes.Buffer
+	assert.NoError(t, m.Write(&out))
+	assert.Equal(t, "nestic movie 1\nrom 1A2B3C4D\nfourscore true\nrerecords 2\n\na+right|||\n||start|\n", out.String())
+
+	read, err := ReadMovie(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, m, read)
+
+	_, err = ReadMovie(bytes.NewBufferString("nestic movie 1\n\nturbo|\n"))
+	assert.Error(t, err)
+}
+
+func Test_Movie_FM2(t *testing.T) {
+	m, err := ReadFM2(bytes.NewBufferString(`version 3
+emuVersion 22020
+rerecordCount 7
+palFlag 0
+romFilename smb
+romChecksum base64:jjYwGG411HcjG/j9UOVM3Q==
+guid 0A1B2C3D-0000-0000-0000-000000000000
+fourscore 0
+port0 1
+port1 0
+port2 0
+comment author someone
+|2|........|||
+|0|R......A|||
+|1|...UT...|||
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, "smb", m.ROMName)
+	assert.Equal(t, 7, m.Rerecords)
+	assert.Equal(t, uint8(0x8e), m.ROMMD5[0])
+	assert.Equal(t, [][4]Button{{}, {ButtonRight | ButtonA}, {ButtonUp | ButtonStart}}, m.Frames)
+	assert.Equal(t, []MovieReset{{Frame: 2}}, m.Resets, "the hard reset of the first frame is the power-on")
+
+	var out bytes.Buffer
+	assert.NoError(t, m.WriteFM2(&out))
+	read, err := ReadFM2(&out)
+	assert.NoError(t, err)
+	assert.Equal(t, m, read)
+
+	_, err = ReadFM2(bytes.NewBufferString("version 3\nsavestate base64:AAAA\n"))
+	assert.Error(t, err)
+	_, err = ReadFM2(bytes.NewBufferString("version 3\nport0 2\n"))
+	assert.Error(t, err, "the zapper")
+}
+
+func Test_Movie_Resets(t *testing.T) {
+	bus := newTestBus()
+	m := bus.RecordMovie()
+	runMovieFrames(bus, ButtonA)
+	bus.QueueReset(false)
+	runMovieFrames(bus, ButtonB)
+	assert.Equal(t, []MovieReset{{Frame: 1}}, m.Resets)
+
+	assert.NoError(t, bus.PlayMovie(m, true))
+	runMovieFrames(bus, 0)
+	bus.ram.Write8(0x10, 0xAA)
+	bus.QueueReset(true) // the movie input wins
+	runMovieFrames(bus, 0)
+	assert.Equal(t, uint8(0xAA), bus.ram.Read8(0x10), "the reset button keeps the memory")
+}
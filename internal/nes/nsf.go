@@ -0,0 +1,128 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+var nsfMagic = [5]uint8{'N', 'E', 'S', 'M', 0x1A}
+
+// nsfHeader is the 128 byte header of the NSF file
+type nsfHeader struct {
+	Magic     [5]uint8
+	Version   uint8
+	Songs     uint8
+	StartSong uint8 // 1-based
+	LoadAddr  uint16
+	InitAddr  uint16
+	PlayAddr  uint16
+	Name      [32]uint8
+	Artist    [32]uint8
+	Copyright [32]uint8
+	NTSCSpeed uint16 // play routine period in microseconds
+	Banks     [8]uint8
+	PALSpeed  uint16
+	Region    uint8
+	Chips     uint8
+	Reserved  [4]uint8
+}
+
+// Expansion sound chips used by the NSF
+const (
+	NSFChipVRC6 = 1 << iota
+	NSFChipVRC7
+	NSFChipFDS
+	NSFChipMMC5
+	NSFChipN163
+	NSFChipSunsoft5B
+)
+
+// NSF is a music rip in the NES Sound Format: the music code and data
+// of a game with the addresses of its init and play routines
+type NSF struct {
+	Name      string
+	Artist    string
+	Copyright string
+
+	Songs     int
+	StartSong int // 0-based
+
+	LoadAddr uint16
+	InitAddr uint16
+	PlayAddr uint16
+	// PlaySpeed is the period of the play routine calls in microseconds
+	PlaySpeed uint16
+
+	// Banks are the initial 4KB banks at $8000-$FFFF,
+	// all zero when the music is not bank switched
+	Banks [8]uint8
+	Chips uint8
+
+	data []uint8
+}
+
+// LoadNSF reads the .nsf file
+func LoadNSF(path string) (*NSF, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open the file: %s", err)
+	}
+	defer file.Close()
+	return ReadNSF(file)
+}
+
+// ReadNSF reads the NSF from r
+func ReadNSF(r io.Reader) (*NSF, error) {
+	var header nsfHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, fmt.Errorf("couldn't read the header: %s", err)
+	}
+	if header.Magic != nsfMagic {
+		return nil, fmt.Errorf("invalid header")
+	}
+	if header.Songs == 0 {
+		return nil, fmt.Errorf("no songs")
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read the data: %s", err)
+	}
+
+	nsf := &NSF{
+		Name:      nsfString(header.Name),
+		Artist:    nsfString(header.Artist),
+		Copyright: nsfString(header.Copyright),
+		Songs:     int(header.Songs),
+		StartSong: max(int(header.StartSong), 1) - 1,
+		LoadAddr:  header.LoadAddr,
+		InitAddr:  header.InitAddr,
+		PlayAddr:  header.PlayAddr,
+		PlaySpeed: header.NTSCSpeed,
+		Banks:     header.Banks,
+		Chips:     header.Chips,
+		data:      data,
+	}
+	if nsf.StartSong >= nsf.Songs {
+		nsf.StartSong = 0
+	}
+	if !nsf.Banked() && nsf.LoadAddr < 0x8000 {
+		return nil, fmt.Errorf("load address %04X is below $8000", nsf.LoadAddr)
+	}
+	return nsf, nil
+}
+
+// Banked reports whether the music is bank switched
+func (n *NSF) Banked() bool {
+	return n.Banks != [8]uint8{}
+}
+
+// nsfString returns the zero terminated string of the header field
+func nsfString(field [32]uint8) string {
+	if i := bytes.IndexByte(field[:], 0); i >= 0 {
+		return string(field[:i])
+	}
+	return string(field[:])
+}
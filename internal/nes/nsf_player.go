@@ -0,0 +1,197 @@
+package nes
+
+import "time"
+
+// nsfIdleAddr is where the player keeps the CPU between the routine calls.
+// The PPU registers are not used by NSF music, so the player puts
+// an endless loop there and the routines return into it
+const nsfIdleAddr = 0x3FF0
+
+// nsfDefaultSpeed is the play period of the NTSC frame rate in microseconds
+const nsfDefaultSpeed = 16639
+
+// NSFPlayer plays NSF music on the CPU and the APU, without the PPU
+type NSFPlayer struct {
+	nsf *NSF
+	cpu *CPU
+	apu *APU
+
+	ram   [0x800]uint8
+	sram  [0x2000]uint8
+	rom   []uint8 // 4KB banks, the first one starts at a bank boundary
+	banks [8]uint8
+
+	song       int
+	playPeriod uint64 // CPU cycles between the play routine calls
+	nextPlay   uint64
+	cycles     uint64 // CPU cycles since the song start
+}
+
+// NewNSFPlayer creates the player and starts the first song of the NSF
+func NewNSFPlayer(nsf *NSF) *NSFPlayer {
+	p := &NSFPlayer{nsf: nsf}
+	mem := &nsfMemory{p}
+	p.cpu = NewCPU(mem)
+	p.apu = NewAPU(mem)
+
+	// unbanked music is loaded at its address,
+	// banked music is loaded at the offset within the bank
+	padding := int(nsf.LoadAddr & 0x0FFF)
+	p.banks = nsf.Banks
+	if !nsf.Banked() {
+		padding = int(nsf.LoadAddr - 0x8000)
+		p.banks = [8]uint8{0, 1, 2, 3, 4, 5, 6, 7}
+	}
+	p.rom = make([]uint8, padding+len(nsf.data))
+	copy(p.rom[padding:], nsf.data)
+
+	speed := uint64(nsf.PlaySpeed)
+	if speed == 0 {
+		speed = nsfDefaultSpeed
+	}
+	p.playPeriod = speed * cpuFrequency / 1000000
+
+	p.SetSong(nsf.StartSong)
+	return p
+}
+
+// APU returns the audio processing unit the music plays on
+func (p *NSFPlayer) APU() *APU {
+	return p.apu
+}
+
+// Song returns the playing song, 0-based
+func (p *NSFPlayer) Song() int {
+	return p.song
+}
+
+// Elapsed returns the time the song has been playing for
+func (p *NSFPlayer) Elapsed() time.Duration {
+	return time.Duration(p.cycles * uint64(time.Second) / cpuFrequency)
+}
+
+// SetSong restarts the player with the song, 0-based.
+// The songs out of range wrap around
+func (p *NSFPlayer) SetSong(song int) {
+	songs := p.nsf.Songs
+	p.song = (song%songs + songs) % songs
+
+	p.ram = [0x800]uint8{}
+	p.sram = [0x2000]uint8{}
+	if p.nsf.Banked() {
+		p.banks = p.nsf.Banks
+	}
+
+	p.apu.Reset()
+	for addr := uint16(0x4000); addr <= 0x4013; addr++ {
+		p.apu.writeRegister(addr, 0)
+	}
+	p.apu.writeRegister(0x4015, 0)
+	p.apu.writeRegister(0x4015, 0x0F)
+	p.apu.writeRegister(0x4017, 0x40)
+
+	c := p.cpu
+	c.halt = false
+	c.op = nil
+	c.cycles = 0
+	c.stall = 0
+	c.nmiPending = false
+	c.irqLine = false
+	c.sp = 0xFD
+	c.p = flagU | flagI
+	c.a = uint8(p.song)
+	c.x = 0 // NTSC
+	c.y = 0
+	c.pc = nsfIdleAddr
+	p.call(p.nsf.InitAddr)
+
+	p.cycles = 0
+	p.nextPlay = 0
+}
+
+// call jumps to the routine, it returns into the idle loop
+func (p *NSFPlayer) call(addr uint16) {
+	p.cpu.stackPush16(nsfIdleAddr - 1)
+	p.cpu.pc = addr
+}
+
+// idle reports whether the CPU is waiting for the next routine call
+func (p *NSFPlayer) idle() bool {
+	c := p.cpu
+	return c.op == nil && c.cycles == 0 && c.pc == nsfIdleAddr
+}
+
+// Tic executes one CPU cycle
+func (p *NSFPlayer) Tic() {
+	// a play routine running longer than the period delays the next call
+	if p.cycles >= p.nextPlay && p.idle() {
+		p.call(p.nsf.PlayAddr)
+		p.nextPlay = max(p.nextPlay+p.playPeriod, p.cycles)
+	}
+
+	p.cpu.Tic()
+	p.apu.Tic()
+	if stall := p.apu.takeStall(); stall > 0 {
+		p.cpu.Stall(stall)
+	}
+	p.cpu.irqLine = p.apu.irq()
+	p.cycles++
+}
+
+// RunFrame runs the player for one play routine period
+func (p *NSFPlayer) RunFrame() {
+	for i := uint64(0); i < p.playPeriod; i++ {
+		p.Tic()
+	}
+}
+
+// nsfMemory is the CPU memory of the player
+//
+// $0000-$1FFF: RAM and its mirrors
+// $3FF0-$3FF2: the idle loop
+// $4000-$4017: APU
+// $5FF8-$5FFF: bank registers
+// $6000-$7FFF: RAM
+// $8000-$FFFF: 4KB banks
+type nsfMemory struct {
+	p *NSFPlayer
+}
+
+// nsfIdleLoop is JMP nsfIdleAddr
+var nsfIdleLoop = [3]uint8{0x4C, nsfIdleAddr & 0xFF, nsfIdleAddr >> 8}
+
+func (m *nsfMemory) Read8(addr uint16) uint8 {
+	p := m.p
+	switch {
+	case addr < 0x2000:
+		return p.ram[addr&0x07FF]
+	case addr >= nsfIdleAddr && addr < nsfIdleAddr+3:
+		return nsfIdleLoop[addr-nsfIdleAddr]
+	case addr == 0x4015:
+		return p.apu.readRegister(addr)
+	case addr >= 0x6000 && addr < 0x8000:
+		return p.sram[addr-0x6000]
+	case addr >= 0x8000:
+		offset := int(p.banks[(addr-0x8000)>>12])<<12 | int(addr&0x0FFF)
+		if offset < len(p.rom) {
+			return p.rom[offset]
+		}
+	}
+	return 0
+}
+
+func (m *nsfMemory) Write8(addr uint16, data uint8) {
+	p := m.p
+	switch {
+	case addr < 0x2000:
+		p.ram[addr&0x07FF] = data
+	case addr >= 0x4000 && addr < 0x4016, addr == 0x4017:
+		p.apu.writeRegister(addr, data)
+	case addr >= 0x5FF8 && addr < 0x6000:
+		if p.nsf.Banked() {
+			p.banks[addr-0x5FF8] = data
+		}
+	case addr >= 0x6000 && addr < 0x8000:
+		p.sram[addr-0x6000] = data
+	}
+}
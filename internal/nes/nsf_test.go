@@ -0,0 +1,79 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestNSF(t *testing.T, header nsfHeader, data []uint8) *NSF {
+	header.Magic = nsfMagic
+	var buf bytes.Buffer
+	assert.NoError(t, binary.Write(&buf, binary.LittleEndian, &header))
+	buf.Write(data)
+	nsf, err := ReadNSF(&buf)
+	assert.NoError(t, err)
+	return nsf
+}
+
+func Test_NSF_Read(t *testing.T) {
+	header := nsfHeader{Songs: 5, StartSong: 2, LoadAddr: 0x8000}
+	copy(header.Name[:], "Song")
+	nsf := newTestNSF(t, header, []uint8{0x60})
+	assert.Equal(t, "Song", nsf.Name)
+	assert.Equal(t, 1, nsf.StartSong)
+	assert.False(t, nsf.Banked())
+
+	_, err := ReadNSF(bytes.NewReader(make([]uint8, 128)))
+	assert.Error(t, err)
+}
+
+func Test_NSFPlayer(t *testing.T) {
+	// init: STA $00, RTS
+	// play: INC $01, RTS
+	data := []uint8{0x85, 0x00, 0x60, 0xE6, 0x01, 0x60}
+	nsf := newTestNSF(t, nsfHeader{
+		Songs:     3,
+		StartSong: 1,
+		LoadAddr:  0x8000,
+		InitAddr:  0x8000,
+		PlayAddr:  0x8003,
+		NTSCSpeed: 10000,
+	}, data)
+
+	p := NewNSFPlayer(nsf)
+	p.SetSong(2)
+	for i := 0; i < 10; i++ {
+		p.RunFrame()
+	}
+	assert.Equal(t, uint8(2), p.ram[0], "init gets the song in A")
+	assert.Equal(t, uint8(10), p.ram[1], "play is called every period")
+	assert.InDelta(t, 0.1, p.Elapsed().Seconds(), 0.001)
+
+	p.SetSong(3)
+	assert.Equal(t, 0, p.Song())
+	assert.Equal(t, uint8(0), p.ram[1])
+}
+
+func Test_NSFPlayer_Banks(t *testing.T) {
+	// the data starts at $8010 of the bank 0
+	// init: LDA #$02, STA $5FF9, LDA $9000, STA $00, RTS
+	data := make([]uint8, 0x2000)
+	copy(data, []uint8{0xA9, 0x02, 0x8D, 0xF9, 0x5F, 0xAD, 0x00, 0x90, 0x85, 0x00, 0x60})
+	data[0x1FF0] = 0x42 // the first byte of the bank 2
+	nsf := newTestNSF(t, nsfHeader{
+		Songs:    1,
+		LoadAddr: 0x8010,
+		InitAddr: 0x8010,
+		PlayAddr: 0x8010,
+		Banks:    [8]uint8{0, 1},
+	}, data)
+	assert.True(t, nsf.Banked())
+
+	p := NewNSFPlayer(nsf)
+	p.RunFrame()
+	assert.Equal(t, uint8(0x42), p.ram[0])
+	assert.Equal(t, uint8(2), p.banks[1])
+}
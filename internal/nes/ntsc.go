@@ -0,0 +1,222 @@
+package nes
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// The NTSC PPU generates the composite signal directly: every pixel is
+// 8 samples of a square wave at the color subcarrier frequency.
+// One period of the subcarrier is 12 samples.
+const (
+	ntscSamplesPerPixel = 8
+	ntscPhases          = 12
+	// phase of the color burst relative to the generated square waves
+	ntscBurstPhase = 3.9
+)
+
+// signal voltage levels relative to the sync level
+var (
+	ntscBlack       = 0.518
+	ntscWhite       = 1.962
+	ntscAttenuation = 0.746
+	ntscLevels      = [8]float64{
+		0.350, 0.518, 0.962, 1.550, // signal low
+		1.094, 1.506, 1.962, 1.962, // signal high
+	}
+)
+
+// NTSCFilter simulates the composite video output of the NTSC PPU.
+// It decodes the generated signal back into RGB the way a TV does,
+// so it reproduces color fringing and the dithering tricks games use
+// to create transparency and extra colors.
+type NTSCFilter struct {
+	Hue        float64 // hue shift in degrees
+	Saturation float64 // 1: normal
+	Sharpness  float64 // -1: blurry, 0: normal, 1: sharp
+	Fringing   float64 // 0: no chroma artifacts in luma, 1: full artifacts
+
+	// signal[pixel][phase] is the normalized signal level
+	// of the pixel with emphasis at the subcarrier phase
+	signal [0x200][ntscPhases]float64
+	// line samples buffer
+	samples [FrameWidth * ntscSamplesPerPixel]float64
+	frame   uint64
+}
+
+func NewNTSCFilter() *NTSCFilter {
+	f := &NTSCFilter{
+		Saturation: 1,
+		Fringing:   0.5,
+	}
+	for index := range f.signal {
+		for phase := range f.signal[index] {
+			level := ntscSignal(uint16(index), phase)
+			f.signal[index][phase] = (level - ntscBlack) / (ntscWhite - ntscBlack)
+		}
+	}
+	return f
+}
+
+// Skip advances the subcarrier phase over the frame which isn't converted
+func (f *NTSCFilter) Skip() {
+	f.frame++
+}
+
+// ntscSignal returns the signal voltage of the pixel at the phase
+func ntscSignal(pixel uint16, phase int) float64 {
+	color := int(pixel & 0x0F)
+	level := int(pixel>>4) & 0x3
+	emphasis := pixel >> 6
+	// colors $xE and $xF are black
+	if color > 13 {
+		level = 1
+	}
+
+	low, high := ntscLevels[level], ntscLevels[4+level]
+	switch {
+	// color $x0 is gray and has no square wave
+	case color == 0:
+		low = high
+	// colors $xD-$xF are gray too
+	case color > 12:
+		high = low
+	}
+
+	inColorPhase := func(color int) bool {
+		return (color+phase)%ntscPhases < 6
+	}
+
+	signal := low
+	if inColorPhase(color) {
+		signal = high
+	}
+
+	// emphasis attenuates the signal during the phase of the emphasized color
+	if color < 0x0E {
+		if emphasis&0x1 != 0 && inColorPhase(0) ||
+			emphasis&0x2 != 0 && inColorPhase(4) ||
+			emphasis&0x4 != 0 && inColorPhase(8) {
+			signal *= ntscAttenuation
+		}
+	}
+	return signal
+}
+
+func (f *NTSCFilter) Apply(dst *image.RGBA, pixels []uint16) {
+	var cosTable, sinTable [ntscPhases]float64
+	for i := range cosTable {
+		angle := math.Pi*(float64(i)+ntscBurstPhase)/6 + f.Hue*math.Pi/180
+		cosTable[i] = math.Cos(angle)
+		sinTable[i] = math.Sin(angle)
+	}
+
+	// the sharper the picture the narrower the luma window
+	lumaWidth := int(math.Round(12 - 4*f.Sharpness))
+	lumaWidth = max(4, min(lumaWidth, 20))
+	fringing := max(0, min(f.Fringing, 1))
+
+	// every frame starts at a different subcarrier phase
+	// and every scanline shifts the phase by 341*8 samples
+	framePhase := int(f.frame%3) * 4
+	f.frame++
+
+	for y := 0; y < FrameHeight; y++ {
+		phase := (framePhase + y*ppuDotsPerScanline*ntscSamplesPerPixel) % ntscPhases
+		line := pixels[y*FrameWidth : (y+1)*FrameWidth]
+		for x, pixel := range line {
+			for s := 0; s < ntscSamplesPerPixel; s++ {
+				n := x*ntscSamplesPerPixel + s
+				f.samples[n] = f.signal[pixel&0x1FF][(phase+n)%ntscPhases]
+			}
+		}
+
+		for x := 0; x < FrameWidth; x++ {
+			center := x*ntscSamplesPerPixel + ntscSamplesPerPixel/2
+
+			// chroma is demodulated over a full subcarrier period
+			var yFull, i, q float64
+			for s := center - ntscPhases/2; s < center+ntscPhases/2; s++ {
+				level := f.sample(s)
+				yFull += level
+				i += level * cosTable[(phase+s+ntscPhases*4)%ntscPhases]
+				q += level * sinTable[(phase+s+ntscPhases*4)%ntscPhases]
+			}
+			yFull /= ntscPhases
+			i = i / ntscPhases * f.Saturation
+			q = q / ntscPhases * f.Saturation
+
+			// luma with the window that doesn't cancel the subcarrier
+			// leaks chroma into the picture as fringes
+			var yLuma float64
+			for s := center - lumaWidth/2; s < center-lumaWidth/2+lumaWidth; s++ {
+				yLuma += f.sample(s)
+			}
+			yLuma /= float64(lumaWidth)
+			luma := yFull*(1-fringing) + yLuma*fringing
+
+			r := luma + 0.946882*i + 0.623557*q
+			g := luma - 0.274788*i - 0.635691*q
+			b := luma - 1.108545*i + 1.709007*q
+
+			offset := (y*FrameWidth + x) * 4
+			dst.Pix[offset+0] = ntscGamma(r)
+			dst.Pix[offset+1] = ntscGamma(g)
+			dst.Pix[offset+2] = ntscGamma(b)
+			dst.Pix[offset+3] = 255
+		}
+	}
+}
+
+// GeneratePalette generates the palette by decoding the NTSC signal
+// of every color with a TV which has the given hue shift in degrees,
+// saturation and brightness (1: normal)
+func GeneratePalette(hue, saturation, brightness float64) *Palette {
+	var palette Palette
+	for emphasis := range palette {
+		for index := range palette[emphasis] {
+			pixel := uint16(emphasis)<<6 | uint16(index)
+
+			// demodulate over one period of the subcarrier
+			var y, i, q float64
+			for phase := 0; phase < ntscPhases; phase++ {
+				level := (ntscSignal(pixel, phase) - ntscBlack) / (ntscWhite - ntscBlack)
+				angle := math.Pi*(float64(phase)+ntscBurstPhase)/6 + hue*math.Pi/180
+				y += level
+				i += level * math.Cos(angle)
+				q += level * math.Sin(angle)
+			}
+			y = y / ntscPhases * brightness
+			i = i / ntscPhases * saturation
+			q = q / ntscPhases * saturation
+
+			palette[emphasis][index] = color.RGBA{
+				R: ntscGamma(y + 0.946882*i + 0.623557*q),
+				G: ntscGamma(y - 0.274788*i - 0.635691*q),
+				B: ntscGamma(y - 1.108545*i + 1.709007*q),
+				A: 255,
+			}
+		}
+	}
+	return &palette
+}
+
+// sample returns the line sample clamping at the line edges
+func (f *NTSCFilter) sample(i int) float64 {
+	i = max(0, min(i, len(f.samples)-1))
+	return f.samples[i]
+}
+
+// ntscGamma converts a linear signal level into a color component
+// with the TV gamma correction
+func ntscGamma(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	v = math.Pow(v, 2.2/1.8) * 255
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v)
+}
@@ -0,0 +1,55 @@
+package nes
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ntscColor returns the color the filter decodes the solid frame of the pixel to
+func ntscColor(f *NTSCFilter, pixel uint16) color.RGBA {
+	pixels := make([]uint16, FrameWidth*FrameHeight)
+	for i := range pixels {
+		pixels[i] = pixel
+	}
+	frame := image.NewRGBA(image.Rect(0, 0, FrameWidth, FrameHeight))
+	f.Apply(frame, pixels)
+	return frame.RGBAAt(FrameWidth/2, FrameHeight/2)
+}
+
+func assertGray(t *testing.T, c color.RGBA, msgAndArgs ...any) {
+	t.Helper()
+	assert.InDelta(t, c.R, c.G, 2, msgAndArgs...)
+	assert.InDelta(t, c.G, c.B, 2, msgAndArgs...)
+}
+
+func Test_NTSCFilter(t *testing.T) {
+	f := NewNTSCFilter()
+
+	black, white := ntscColor(f, 0x0F), ntscColor(f, 0x30)
+	assertGray(t, black, "black")
+	assertGray(t, white, "white")
+	assert.Less(t, black.R, uint8(0x10))
+	assert.Greater(t, white.R, uint8(0xF0))
+
+	red := ntscColor(f, 0x16)
+	assert.Greater(t, red.R, red.G, "red")
+	assert.Greater(t, red.R, red.B, "red")
+	blue := ntscColor(f, 0x12)
+	assert.Greater(t, blue.B, blue.R, "blue")
+	assert.Greater(t, blue.B, blue.G, "blue")
+
+	// the emphasis darkens the other colors
+	emphasized := ntscColor(f, 1<<6|0x30)
+	assert.Greater(t, emphasized.R, emphasized.G)
+	assert.Greater(t, emphasized.R, emphasized.B)
+
+	f.Saturation = 0
+	assertGray(t, ntscColor(f, 0x16), "no saturation")
+
+	f.Saturation, f.Hue = 1, 180
+	shifted := ntscColor(f, 0x16)
+	assert.Less(t, shifted.R, shifted.G, "the hue is shifted")
+}
@@ -0,0 +1,112 @@
+package nes
+
+// PortDevice is a device plugged into a controller port
+// instead of the standard controller
+type PortDevice interface {
+	write(data uint8)
+	read() uint8
+}
+
+// SetPortDevice plugs the device into the port 0 or 1,
+// nil plugs the standard controller back
+func (b *Bus) SetPortDevice(port int, d PortDevice) {
+	b.portDevices[port&0x1] = d
+}
+
+// PortDevice returns the device plugged into the port 0 or 1,
+// nil is the standard controller
+func (b *Bus) PortDevice(port int) PortDevice {
+	return b.portDevices[port&0x1]
+}
+
+// the range of the potentiometer of the Arkanoid paddle
+const (
+	PaddleMin = 0x62
+	PaddleMax = 0xF2
+)
+
+// Paddle is the Vaus controller of Arkanoid: a knob turning
+// a potentiometer and a fire button. The strobe latches the position
+// of the knob, the reads return it MSB first in bit 4, inverted,
+// and the button in bit 3.
+type Paddle struct {
+	position uint8
+	fire     bool
+	shift    uint8
+	strobe   bool
+}
+
+// NewPaddle returns the paddle with the knob in the middle
+func NewPaddle() *Paddle {
+	return &Paddle{position: (PaddleMin + PaddleMax) / 2}
+}
+
+// SetPosition turns the knob to the position, it is clamped
+// to PaddleMin-PaddleMax
+func (p *Paddle) SetPosition(position int) {
+	p.position = uint8(max(PaddleMin, min(position, PaddleMax)))
+	if p.strobe {
+		p.shift = p.position
+	}
+}
+
+// Position returns the position of the knob
+func (p *Paddle) Position() int {
+	return int(p.position)
+}
+
+// Move turns the knob by the delta, positive to the right
+func (p *Paddle) Move(delta int) {
+	p.SetPosition(int(p.position) + delta)
+}
+
+// SetFire sets the state of the fire button
+func (p *Paddle) SetFire(pressed bool) {
+	p.fire = pressed
+}
+
+func (p *Paddle) write(data uint8) {
+	p.strobe = data&0x1 != 0
+	if p.strobe {
+		p.shift = p.position
+	}
+}
+
+// next returns the next bit of the position, inverted
+func (p *Paddle) next() uint8 {
+	data := ^p.shift >> 7 & 0x1
+	if !p.strobe {
+		p.shift <<= 1
+	}
+	return data
+}
+
+func (p *Paddle) button() uint8 {
+	if p.fire {
+		return 1
+	}
+	return 0
+}
+
+func (p *Paddle) read() uint8 {
+	return p.button()<<3 | p.next()<<4
+}
+
+// FamicomPaddle is the Famicom version of the paddle on the expansion
+// port. It reports the button in bit 1 of $4016 and the position
+// in bit 1 of $4017
+type FamicomPaddle struct {
+	Paddle
+}
+
+// NewFamicomPaddle returns the paddle with the knob in the middle
+func NewFamicomPaddle() *FamicomPaddle {
+	return &FamicomPaddle{Paddle: *NewPaddle()}
+}
+
+func (p *FamicomPaddle) read(port int) uint8 {
+	if port == 0 {
+		return p.button() << 1
+	}
+	return p.next() << 1
+}
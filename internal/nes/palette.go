@@ -0,0 +1,108 @@
+package nes
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+)
+
+// Palette maps the PPU pixels to colors.
+// It is indexed by the color emphasis bits (bit 0: red, bit 1: green,
+// bit 2: blue) and the 6-bit color index, the same layout as
+// the 512 color .pal files have.
+type Palette [8][0x40]color.RGBA
+
+// systemPalette is the 2C02 NTSC palette.
+// The PPU outputs 6-bit indexes into this table.
+var systemPalette = [0x40]color.RGBA{
+	{84, 84, 84, 255}, {0, 30, 116, 255}, {8, 16, 144, 255}, {48, 0, 136, 255},
+	{68, 0, 100, 255}, {92, 0, 48, 255}, {84, 4, 0, 255}, {60, 24, 0, 255},
+	{32, 42, 0, 255}, {8, 58, 0, 255}, {0, 64, 0, 255}, {0, 60, 0, 255},
+	{0, 50, 60, 255}, {0, 0, 0, 255}, {0, 0, 0, 255}, {0, 0, 0, 255},
+
+	{152, 150, 152, 255}, {8, 76, 196, 255}, {48, 50, 236, 255}, {92, 30, 228, 255},
+	{136, 20, 176, 255}, {160, 20, 100, 255}, {152, 34, 32, 255}, {120, 60, 0, 255},
+	{84, 90, 0, 255}, {40, 114, 0, 255}, {8, 124, 0, 255}, {0, 118, 40, 255},
+	{0, 102, 120, 255}, {0, 0, 0, 255}, {0, 0, 0, 255}, {0, 0, 0, 255},
+
+	{236, 238, 236, 255}, {76, 154, 236, 255}, {120, 124, 236, 255}, {176, 98, 236, 255},
+	{228, 84, 236, 255}, {236, 88, 180, 255}, {236, 106, 100, 255}, {212, 136, 32, 255},
+	{160, 170, 0, 255}, {116, 196, 0, 255}, {76, 208, 32, 255}, {56, 204, 108, 255},
+	{56, 180, 204, 255}, {60, 60, 60, 255}, {0, 0, 0, 255}, {0, 0, 0, 255},
+
+	{236, 238, 236, 255}, {168, 204, 236, 255}, {188, 188, 236, 255}, {212, 178, 236, 255},
+	{236, 174, 236, 255}, {236, 174, 212, 255}, {236, 180, 176, 255}, {228, 196, 144, 255},
+	{204, 210, 120, 255}, {180, 222, 120, 255}, {168, 226, 144, 255}, {152, 226, 180, 255},
+	{160, 214, 228, 255}, {160, 162, 160, 255}, {0, 0, 0, 255}, {0, 0, 0, 255},
+}
+
+// emphasisAttenuation is how much the color emphasis
+// darkens the color components which are not emphasized
+const emphasisAttenuation = 0.816328
+
+// defaultPalette is the system palette with the emphasis applied
+var defaultPalette = newEmphasisPalette(systemPalette)
+
+// newEmphasisPalette makes the palette for every combination
+// of the color emphasis bits out of the 64 base colors
+func newEmphasisPalette(base [0x40]color.RGBA) *Palette {
+	attenuate := func(c uint8) uint8 {
+		return uint8(float64(c) * emphasisAttenuation)
+	}
+	var palette Palette
+	for emphasis := range palette {
+		for index, c := range base {
+			// the black column is not affected
+			if emphasis != 0 && index&0x0F < 0x0E {
+				if emphasis&0x1 == 0 {
+					c.R = attenuate(c.R)
+				}
+				if emphasis&0x2 == 0 {
+					c.G = attenuate(c.G)
+				}
+				if emphasis&0x4 == 0 {
+					c.B = attenuate(c.B)
+				}
+			}
+			palette[emphasis][index] = c
+		}
+	}
+	return &palette
+}
+
+// ReadPalette reads a palette in the .pal format: RGB triplets of
+// either 64 colors or 512 colors which include all the emphasis combinations.
+// The emphasis of 64 color palettes is emulated.
+func ReadPalette(r io.Reader) (*Palette, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read the palette: %s", err)
+	}
+
+	switch len(data) {
+	case 0x40 * 3:
+		var base [0x40]color.RGBA
+		for i := range base {
+			base[i] = color.RGBA{data[i*3], data[i*3+1], data[i*3+2], 255}
+		}
+		return newEmphasisPalette(base), nil
+	case 0x200 * 3:
+		var palette Palette
+		for i := 0; i < 0x200; i++ {
+			palette[i/0x40][i%0x40] = color.RGBA{data[i*3], data[i*3+1], data[i*3+2], 255}
+		}
+		return &palette, nil
+	}
+	return nil, fmt.Errorf("invalid palette size %d, expected %d or %d bytes", len(data), 0x40*3, 0x200*3)
+}
+
+// LoadPalette reads a .pal file
+func LoadPalette(path string) (*Palette, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open the file: %s", err)
+	}
+	defer file.Close()
+	return ReadPalette(file)
+}
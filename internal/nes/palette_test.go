@@ -0,0 +1,43 @@
+package nes
+
+import (
+	"bytes"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ReadPalette(t *testing.T) {
+	data := make([]byte, 0x40*3)
+	for i := range data {
+		data[i] = uint8(i)
+	}
+	palette, err := ReadPalette(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, color.RGBA{3, 4, 5, 255}, palette[0][1])
+	assert.Equal(t, color.RGBA{3, 3, 4, 255}, palette[0x1][1], "emphasized red is not attenuated")
+
+	data = make([]byte, 0x200*3)
+	data[0x41*3] = 0xAA
+	palette, err = ReadPalette(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, color.RGBA{0xAA, 0, 0, 255}, palette[1][1])
+
+	_, err = ReadPalette(bytes.NewReader(data[:100]))
+	assert.Error(t, err)
+}
+
+func Test_GeneratePalette(t *testing.T) {
+	palette := GeneratePalette(0, 1, 1)
+	assert.Equal(t, color.RGBA{0, 0, 0, 255}, palette[0][0x0F])
+	white := palette[0][0x30]
+	assert.True(t, white.R > 240 && white.G > 240 && white.B > 240, "$30 is white: %v", white)
+
+	// the hue shift rotates the colors
+	red := palette[0][0x16]
+	assert.True(t, red.R > red.G && red.R > red.B, "$16 is red: %v", red)
+	assert.NotEqual(t, red, GeneratePalette(30, 1, 1)[0][0x16])
+	gray := GeneratePalette(0, 0, 1)[0][0x16]
+	assert.True(t, gray.R == gray.G && gray.G == gray.B, "no saturation is gray: %v", gray)
+}
@@ -0,0 +1,43 @@
+package nes
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+)
+
+// SaveFramePNG saves the last completed frame as a PNG file
+func (b *Bus) SaveFramePNG(path string) error {
+	return savePNG(path, b.ppu.Frame())
+}
+
+// SaveNametablesPNG saves the four nametables as a 512x480 PNG file
+func (b *Bus) SaveNametablesPNG(path string) error {
+	return savePNG(path, b.NametableView().Image)
+}
+
+// SavePatternTablePNG saves the pattern table (0: $0000, 1: $1000)
+// colored with the palette as a 128x128 PNG file
+func (b *Bus) SavePatternTablePNG(path string, table int, pallete uint8) error {
+	if table < 0 || table > 1 {
+		return fmt.Errorf("invalid pattern table %d", table)
+	}
+	img := b.PatternTableView(pallete)
+	return savePNG(path, img.SubImage(image.Rect(table*128, 0, table*128+128, 128)))
+}
+
+func savePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("couldn't create the file: %s", err)
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return fmt.Errorf("couldn't encode the image: %s", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("couldn't write the file: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package nes
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Bus_SavePNG(t *testing.T) {
+	bus := newTestBus()
+	dir := t.TempDir()
+
+	size := func(path string) (int, int) {
+		file, err := os.Open(path)
+		if !assert.NoError(t, err) {
+			return 0, 0
+		}
+		defer file.Close()
+		cfg, err := png.DecodeConfig(file)
+		assert.NoError(t, err)
+		return cfg.Width, cfg.Height
+	}
+
+	frame := filepath.Join(dir, "frame.png")
+	assert.NoError(t, bus.SaveFramePNG(frame))
+	w, h := size(frame)
+	assert.Equal(t, []int{FrameWidth, FrameHeight}, []int{w, h})
+
+	nametables := filepath.Join(dir, "nametables.png")
+	assert.NoError(t, bus.SaveNametablesPNG(nametables))
+	w, h = size(nametables)
+	assert.Equal(t, []int{FrameWidth * 2, FrameHeight * 2}, []int{w, h})
+
+	table := filepath.Join(dir, "table1.png")
+	assert.NoError(t, bus.SavePatternTablePNG(table, 1, 0))
+	w, h = size(table)
+	assert.Equal(t, []int{128, 128}, []int{w, h})
+	assert.Error(t, bus.SavePatternTablePNG(table, 2, 0))
+}
@@ -0,0 +1,119 @@
+package nes
+
+// PowerPadButtons are the 12 buttons of the Power Pad mat,
+// the button n in bit n-1. The buttons are numbered on the side B:
+//
+//	1  2  3  4
+//	5  6  7  8
+//	9 10 11 12
+type PowerPadButtons uint16
+
+// PowerPadButton returns the button 1-12
+func PowerPadButton(n int) PowerPadButtons {
+	return 1 << (n - 1) & 0xFFF
+}
+
+// the order the buttons are shifted out in bit 3 and bit 4
+var (
+	powerPadOrderD3 = []int{2, 1, 5, 9, 6, 10, 11, 7}
+	powerPadOrderD4 = []int{4, 3, 12, 8}
+)
+
+// PowerPad is the Power Pad mat in a controller port. The strobe
+// latches the buttons into two shift registers, the reads return them
+// in bit 3 and bit 4, 1 is pressed. After the buttons the reads return 1.
+type PowerPad struct {
+	buttons PowerPadButtons
+	shiftD3 uint8
+	shiftD4 uint8
+	strobe  bool
+}
+
+// NewPowerPad returns the mat with no buttons pressed
+func NewPowerPad() *PowerPad {
+	return &PowerPad{}
+}
+
+// SetButtons sets the pressed buttons
+func (p *PowerPad) SetButtons(buttons PowerPadButtons) {
+	p.buttons = buttons & 0xFFF
+	if p.strobe {
+		p.latch()
+	}
+}
+
+// Buttons returns the pressed buttons
+func (p *PowerPad) Buttons() PowerPadButtons {
+	return p.buttons
+}
+
+func (p *PowerPad) latch() {
+	p.shiftD3, p.shiftD4 = 0, 0xF0
+	for i, n := range powerPadOrderD3 {
+		if p.buttons&PowerPadButton(n) != 0 {
+			p.shiftD3 |= 1 << i
+		}
+	}
+	for i, n := range powerPadOrderD4 {
+		if p.buttons&PowerPadButton(n) != 0 {
+			p.shiftD4 |= 1 << i
+		}
+	}
+}
+
+func (p *PowerPad) write(data uint8) {
+	p.strobe = data&0x1 != 0
+	if p.strobe {
+		p.latch()
+	}
+}
+
+func (p *PowerPad) read() uint8 {
+	data := (p.shiftD3&0x1)<<3 | (p.shiftD4&0x1)<<4
+	if !p.strobe {
+		p.shiftD3 = p.shiftD3>>1 | 0x80
+		p.shiftD4 = p.shiftD4>>1 | 0x80
+	}
+	return data
+}
+
+// FamilyTrainer is the Famicom version of the mat on the expansion port.
+// The $4016 writes select the rows of the matrix with bits 0-2, 0 is
+// selected, and the $4017 reads return the 4 buttons of the selected rows
+// in bits 1-4, 0 is pressed:
+//
+//	bit 0: 4 3 2 1
+//	bit 1: 8 7 6 5
+//	bit 2: 12 11 10 9
+type FamilyTrainer struct {
+	PowerPad
+	rows uint8 // the selected rows
+}
+
+// NewFamilyTrainer returns the mat with no buttons pressed
+func NewFamilyTrainer() *FamilyTrainer {
+	return &FamilyTrainer{}
+}
+
+func (f *FamilyTrainer) write(data uint8) {
+	f.rows = ^data & 0x7
+}
+
+func (f *FamilyTrainer) read(port int) uint8 {
+	if port != 1 {
+		return 0
+	}
+	var pressed uint8
+	for row := 0; row < 3; row++ {
+		if f.rows&(1<<row) == 0 {
+			continue
+		}
+		// the leftmost button of the row is the highest bit
+		for column := 0; column < 4; column++ {
+			if f.buttons&PowerPadButton(row*4+column+1) != 0 {
+				pressed |= 1 << (3 - column)
+			}
+		}
+	}
+	return ^pressed << 1 & 0x1E
+}
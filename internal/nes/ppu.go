@@ -1,6 +1,66 @@
 package nes
 
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+const (
+	FrameWidth  = 256
+	FrameHeight = 240
+)
+
+const (
+	ppuDotsPerScanline   = 341
+	ppuScanlinesPerFrame = 262
+	ppuVblankScanline    = 241
+	ppuPreRenderScanline = 261
+
+	ppuOpenBusDecayFrames = 36
+)
+
+// RenderMode selects how the PPU produces the picture
+type RenderMode uint8
+
+const (
+	// RenderModeDot renders one pixel per dot in lockstep with the CPU.
+	// Register writes take effect at the exact dot they happen at,
+	// so mid-scanline raster effects and the timing test ROMs work.
+	RenderModeDot RenderMode = iota
+	// RenderModeScanline renders a whole scanline at once at the end
+	// of its visible part. It is much faster, but raster effects which
+	// change the registers in the middle of a scanline are lost and
+	// sprite 0 hit is reported at the end of the scanline.
+	RenderModeScanline
+)
+
+func (m RenderMode) String() string {
+	switch m {
+	case RenderModeDot:
+		return "dot"
+	case RenderModeScanline:
+		return "scanline"
+	}
+	return fmt.Sprintf("RenderMode(%d)", m)
+}
+
+// ParseRenderMode returns the render mode by its name: dot or scanline
+func ParseRenderMode(s string) (RenderMode, error) {
+	switch s {
+	case "dot":
+		return RenderModeDot, nil
+	case "scanline":
+		return RenderModeScanline, nil
+	}
+	return 0, fmt.Errorf("unknown render mode %q", s)
+}
+
 type PPU struct {
+	mem ReadWriter
+
 	ppuctrl struct {
 		N uint8 // nametable: 0: $2000, 1: $2400, 2: $2800, 3: $2C00
 		I uint8 // increment: 0: add 1, 1: add 32
@@ -13,10 +73,10 @@ type PPU struct {
 
 	ppumask struct {
 		g uint8 // greyscale: 0: color, 1: greyscale
-		m uint  // background left column: 0: hide, 1: show
-		M uint  // sprites left column: 0: hide, 1: show
-		b uint  // background: 0: hide, 1: show
-		s uint  // sprites: 0: hide, 1: show
+		m uint8 // background left column: 0: hide, 1: show
+		M uint8 // sprites left column: 0: hide, 1: show
+		b uint8 // background: 0: hide, 1: show
+		s uint8 // sprites: 0: hide, 1: show
 		R uint8 // red intensity: 0: normal, 1: emphasize
 		G uint8 // green intensity: 0: normal, 1: emphasize
 		B uint8 // blue intensity: 0: normal, 1: emphasize
@@ -27,14 +87,14 @@ type PPU struct {
 		O uint8 // sprite overflow: 0: no overflow, 1: overflow
 		S uint8 // sprite 0 hit: 0: no hit, 1: hit
 		V uint8 // vblank: 0: not in vblank, 1: in vblank
-
 	}
-	oamaddr   uint8  // oam address
-	oamdata   uint8  // oam data
-	ppuscroll uint8  // ppu scroll. first write is x, second write is y
-	ppuaddr   uint16 // ppu address. first write is high byte, second write is low byte
-	ppudata   uint8  // ppu data
-	oamdma    uint8  // oam dma
+	oamaddr uint8 // oam address
+	ppudata uint8 // ppu data read buffer
+
+	// I/O data latch. Every bit decays to 0
+	// when it is not refreshed for about 600ms
+	openBus        uint8
+	openBusRefresh [8]uint64 // frame when the latch bit was last refreshed
 
 	// Internal registers
 	v uint16 // current vram address
@@ -44,57 +104,907 @@ type PPU struct {
 
 	tableNames   [2][0x400]uint8
 	tablePallete [0x20]uint8
-	// TODO: it stored in the cart. should we use it here?
-	tablePatterns [2][0x1000]uint8
 
 	oam [0x100]uint8 // Object Attribute Memory
 
-	cycles   uint16
-	scanLine uint16
-	frame    uint16
+	// Background fetch latches and shifters
+	bgNextTileID     uint8
+	bgNextTileAttr   uint8
+	bgNextTileLo     uint8
+	bgNextTileHi     uint8
+	bgShifterPattern [2]uint16
+	bgShifterAttr    [2]uint16
+
+	// Sprite evaluation
+	secondaryOAM       [0x20]uint8
+	oamLatch           uint8 // the last byte read by the sprite evaluation
+	spriteAddrH        uint8 // sprite index in OAM
+	spriteAddrL        uint8 // byte index of the sprite in OAM
+	secondaryAddr      uint8
+	spriteInRange      bool
+	spriteZeroAdded    bool
+	oamCopyDone        bool
+	overflowBugCounter uint8
+
+	// Sprites of the current scanline. The hardware has 8 slots,
+	// the rest are used with the sprite limit removed
+	spriteCount     int
+	spriteX         [64]uint8
+	spriteY         [64]uint8
+	spriteTile      [64]uint8
+	spriteAttr      [64]uint8
+	spritePattern   [64][2]uint8
+	spriteZeroLine  bool // sprite 0 is on the current scanline
+	spriteZeroNext  bool // sprite 0 is on the next scanline
+	spriteCountNext int
+
+	// reading PPUSTATUS one dot before the vblank starts
+	// prevents the flag from being set for the frame
+	vblankSuppressed bool
+
+	mode RenderMode
+
+	// render all the sprites of a scanline instead of the first 8
+	noSpriteLimit bool
+
+	// Forced blank: with rendering disabled for the whole frame the frame
+	// is a single backdrop color, and the conversion of the same blank frame
+	// is skipped
+	blankFrame     bool
+	blankColor     uint16
+	lastBlank      bool
+	lastBlankColor uint16
+
+	// the scroll the frame starts rendering with
+	frameScrollV uint16
+	frameScrollX uint8
+
+	pixels  [FrameWidth * FrameHeight]uint16 // palette indexes with emphasis of the frame being rendered
+	frame   *image.RGBA                      // last completed frame
+	filter  VideoFilter
+	palette *Palette // the palette of the raw frames, nil: the system palette
+	onFrame func(frame *image.RGBA)
+
+	frameHash uint64
+	hashBuf   [FrameWidth * FrameHeight * 2]uint8
+
+	region Region
+
+	cycles     uint16
+	scanLine   uint16
+	frameCount uint64
+	clock      uint64 // dots since power-up
+}
+
+func NewPPU(mem ReadWriter) *PPU {
+	return &PPU{
+		mem:    mem,
+		frame:  image.NewRGBA(image.Rect(0, 0, FrameWidth, FrameHeight)),
+		filter: PaletteFilter{},
+	}
+}
+
+// Reset the PPU to its power-up state
+func (p *PPU) Reset() {
+	p.ppuctrl = struct{ N, I, S, B, H, P, V uint8 }{}
+	p.ppumask = struct{ g, m, M, b, s, R, G, B uint8 }{}
+	p.ppudata = 0
+	p.openBus = 0
+	p.openBusRefresh = [8]uint64{}
+	p.v, p.t, p.x, p.w = 0, 0, 0, 0
+	p.vblankSuppressed = false
+	p.cycles = 0
+	p.scanLine = 0
+	p.frameCount = 0
+}
+
+// powerOn clears the PPU the way NewPPU returns it, the host settings
+// stay: the video filter, the render mode, the sprite limit and the region
+func (p *PPU) powerOn() {
+	*p = PPU{
+		mem:           p.mem,
+		mode:          p.mode,
+		noSpriteLimit: p.noSpriteLimit,
+		frame:         p.frame,
+		filter:        p.filter,
+		palette:       p.palette,
+		onFrame:       p.onFrame,
+		region:        p.region,
+	}
+}
+
+// Frame returns the last completed frame as a 256x240 RGBA image.
+// The image is reused between frames, so copy it if it must outlive
+// the next frame.
+func (p *PPU) Frame() *image.RGBA {
+	return p.frame
+}
+
+// RawFrame returns the last completed frame mapped through the palette
+// only, without the video filter. The palette is the one of the last
+// SetPalette, also while another video filter is set. The image is new
+// on every call
+func (p *PPU) RawFrame() *image.RGBA {
+	pixels := make([]uint16, FrameWidth*FrameHeight)
+	for i := range pixels {
+		pixels[i] = binary.LittleEndian.Uint16(p.hashBuf[i*2:])
+	}
+	frame := image.NewRGBA(image.Rect(0, 0, FrameWidth, FrameHeight))
+	PaletteFilter{Palette: p.palette}.Apply(frame, pixels)
+	return frame
+}
+
+// FrameHash returns the hash of the palette indexes and emphasis bits
+// of the last completed frame. It doesn't depend on the palette or
+// the video filter, so it is stable for golden frame tests
+func (p *PPU) FrameHash() uint64 {
+	return p.frameHash
+}
+
+// SetRegion sets the TV system the PPU works in
+func (p *PPU) SetRegion(r Region) {
+	p.region = r
+}
+
+// SetVideoFilter sets the filter which converts the rendered pixels
+// into the RGBA frame. nil restores the plain lookup of the palette
+func (p *PPU) SetVideoFilter(f VideoFilter) {
+	switch f := f.(type) {
+	case nil:
+		p.filter = PaletteFilter{Palette: p.palette}
+	case PaletteFilter:
+		p.filter, p.palette = f, f.Palette
+	default:
+		p.filter = f
+	}
+	p.lastBlank = false
+}
+
+// SetPalette sets the palette the pixels are mapped to colors with.
+// It replaces the video filter, nil restores the system palette
+func (p *PPU) SetPalette(pal *Palette) {
+	p.SetVideoFilter(PaletteFilter{Palette: pal})
+}
+
+// SetSpriteLimit turns the 8 sprites per scanline limit on or off.
+// Without the limit games which multiplex sprites don't flicker.
+// The sprite overflow flag works the same either way
+func (p *PPU) SetSpriteLimit(enabled bool) {
+	p.noSpriteLimit = !enabled
+}
+
+// SetRenderMode sets how the PPU produces the picture
+func (p *PPU) SetRenderMode(m RenderMode) {
+	p.mode = m
+}
+
+// RenderMode returns how the PPU produces the picture
+func (p *PPU) RenderMode() RenderMode {
+	return p.mode
+}
+
+// OnFrame sets a callback that is called every time the PPU completes a frame
+func (p *PPU) OnFrame(fn func(frame *image.RGBA)) {
+	p.onFrame = fn
+}
+
+// refreshOpenBus puts the masked bits of data on the PPU data latch
+func (p *PPU) refreshOpenBus(data uint8, mask uint8) {
+	p.openBus = p.openBus&^mask | data&mask
+	for i := range p.openBusRefresh {
+		if mask&(1<<i) != 0 {
+			p.openBusRefresh[i] = p.frameCount
+		}
+	}
 }
 
-func NewPPU() *PPU {
-	return &PPU{}
+// decayOpenBus clears the latch bits which haven't been refreshed for a while
+func (p *PPU) decayOpenBus() {
+	for i := range p.openBusRefresh {
+		if p.frameCount-p.openBusRefresh[i] > ppuOpenBusDecayFrames {
+			p.openBus &^= 1 << i
+		}
+	}
 }
 
-func (p PPU) readRegister(addr uint16) uint8 {
+func (p *PPU) readRegister(addr uint16) uint8 {
+	p.decayOpenBus()
 	switch addr {
-	case 0x0:
-	case 0x1:
 	case 0x2:
-	case 0x3:
+		// the lower bits are not driven and come from the latch
+		data := p.ppustatus.V<<7 | p.ppustatus.S<<6 | p.ppustatus.O<<5 | p.openBus&0x1F
+		p.ppustatus.V = 0
+		p.w = 0
+		// the read races with the vblank flag being set on the next dot
+		if p.scanLine == ppuVblankScanline && p.cycles == 1 {
+			p.vblankSuppressed = true
+		}
+		p.refreshOpenBus(data, 0xE0)
+		return data
 	case 0x4:
-	case 0x5:
-	case 0x6:
+		data := p.oam[p.oamaddr]
+		// during rendering the read returns the byte
+		// the sprite evaluation is working with
+		if p.renderingLine() {
+			data = p.oamLatch
+		}
+		p.refreshOpenBus(data, 0xFF)
+		return data
 	case 0x7:
+		// reads return the buffered value of the previous read
+		data := p.ppudata
+		p.ppudata = p.mem.Read8(p.v)
+		// palette memory is not buffered, but the buffer is still
+		// filled from the nametable "under" the palette ($2F00-$2FFF)
+		mask := uint8(0xFF)
+		if p.v&0x3FFF >= 0x3F00 {
+			// palette entries are 6 bits, the upper bits come from the latch
+			data = p.readPallete(p.v) | p.openBus&0xC0
+			p.ppudata = p.mem.Read8(p.v - 0x1000)
+			mask = 0x3F
+		}
+		p.incrementAddr()
+		p.refreshOpenBus(data, mask)
+		return data
 	}
-	return 0
+	// write-only registers return the latch
+	return p.openBus
 }
 
 func (p *PPU) writeRegister(addr uint16, data uint8) {
-	_ = data
+	p.refreshOpenBus(data, 0xFF)
 	switch addr {
 	case 0x0:
+		p.ppuctrl.N = data & 0x3
+		p.ppuctrl.I = (data >> 2) & 0x1
+		p.ppuctrl.S = (data >> 3) & 0x1
+		p.ppuctrl.B = (data >> 4) & 0x1
+		p.ppuctrl.H = (data >> 5) & 0x1
+		p.ppuctrl.P = (data >> 6) & 0x1
+		p.ppuctrl.V = (data >> 7) & 0x1
+		p.t = (p.t & 0xF3FF) | uint16(p.ppuctrl.N)<<10
 	case 0x1:
-	case 0x2:
+		p.ppumask.g = data & 0x1
+		p.ppumask.m = (data >> 1) & 0x1
+		p.ppumask.M = (data >> 2) & 0x1
+		p.ppumask.b = (data >> 3) & 0x1
+		p.ppumask.s = (data >> 4) & 0x1
+		p.ppumask.R = (data >> 5) & 0x1
+		p.ppumask.G = (data >> 6) & 0x1
+		p.ppumask.B = (data >> 7) & 0x1
 	case 0x3:
+		p.oamaddr = data
 	case 0x4:
+		// writes during rendering don't modify OAM,
+		// but bump the high 6 bits of the address
+		if p.renderingLine() {
+			p.oamaddr += 4
+			break
+		}
+		// the unused bits of the attribute byte don't exist
+		if p.oamaddr&0x3 == 0x2 {
+			data &= 0xE3
+		}
+		p.oam[p.oamaddr] = data
+		p.oamaddr++
 	case 0x5:
+		if p.w == 0 {
+			p.t = (p.t & 0xFFE0) | uint16(data>>3)
+			p.x = data & 0x7
+			p.w = 1
+		} else {
+			p.t = (p.t & 0x8C1F) | uint16(data&0x7)<<12 | uint16(data&0xF8)<<2
+			p.w = 0
+		}
 	case 0x6:
+		if p.w == 0 {
+			p.t = (p.t & 0x80FF) | uint16(data&0x3F)<<8
+			p.w = 1
+		} else {
+			p.t = (p.t & 0xFF00) | uint16(data)
+			p.v = p.t
+			p.w = 0
+		}
 	case 0x7:
+		p.mem.Write8(p.v, data)
+		p.incrementAddr()
+	}
+}
+
+func (p *PPU) incrementAddr() {
+	if p.ppuctrl.I == 1 {
+		p.v += 32
+	} else {
+		p.v++
+	}
+}
+
+// nmiLine returns the level of the NMI output.
+// The CPU reacts to its rising edge, so enabling the NMI during
+// the vblank triggers it and reading PPUSTATUS right when the vblank
+// starts cancels it
+func (p *PPU) nmiLine() bool {
+	return p.ppuctrl.V == 1 && p.ppustatus.V == 1
+}
+
+func (p *PPU) renderingEnabled() bool {
+	return p.ppumask.b == 1 || p.ppumask.s == 1
+}
+
+// renderingLine reports whether the PPU is rendering the current scanline
+func (p *PPU) renderingLine() bool {
+	return p.renderingEnabled() && (p.scanLine < FrameHeight || p.scanLine == ppuPreRenderScanline)
+}
+
+func (p *PPU) spriteHeight() int {
+	if p.ppuctrl.H == 1 {
+		return 16
+	}
+	return 8
+}
+
+// incrementX increments coarse X and switches horizontal nametable on overflow
+func (p *PPU) incrementX() {
+	if p.v&0x001F == 31 {
+		p.v &= ^uint16(0x001F)
+		p.v ^= 0x0400
+		return
+	}
+	p.v++
+}
+
+// incrementY increments fine Y, then coarse Y,
+// and switches vertical nametable on overflow
+func (p *PPU) incrementY() {
+	if p.v&0x7000 != 0x7000 {
+		p.v += 0x1000
+		return
+	}
+	p.v &= ^uint16(0x7000)
+	y := (p.v & 0x03E0) >> 5
+	switch y {
+	case 29:
+		y = 0
+		p.v ^= 0x0800
+	case 31:
+		// coarse Y points to the attribute table, wrap without switching
+		y = 0
+	default:
+		y++
+	}
+	p.v = (p.v & ^uint16(0x03E0)) | y<<5
+}
+
+func (p *PPU) transferX() {
+	p.v = (p.v & ^uint16(0x041F)) | (p.t & 0x041F)
+}
+
+func (p *PPU) transferY() {
+	p.v = (p.v & ^uint16(0x7BE0)) | (p.t & 0x7BE0)
+}
+
+func (p *PPU) loadBackgroundShifters() {
+	p.bgShifterPattern[0] = (p.bgShifterPattern[0] & 0xFF00) | uint16(p.bgNextTileLo)
+	p.bgShifterPattern[1] = (p.bgShifterPattern[1] & 0xFF00) | uint16(p.bgNextTileHi)
+
+	// attribute bits are the same for all 8 pixels of the tile
+	var lo, hi uint16
+	if p.bgNextTileAttr&0x1 != 0 {
+		lo = 0xFF
+	}
+	if p.bgNextTileAttr&0x2 != 0 {
+		hi = 0xFF
+	}
+	p.bgShifterAttr[0] = (p.bgShifterAttr[0] & 0xFF00) | lo
+	p.bgShifterAttr[1] = (p.bgShifterAttr[1] & 0xFF00) | hi
+}
+
+// updateBackgroundShifters shifts the background shifters by one pixel.
+// They shift whenever rendering is enabled, even if the background is hidden
+func (p *PPU) updateBackgroundShifters() {
+	p.bgShifterPattern[0] <<= 1
+	p.bgShifterPattern[1] <<= 1
+	p.bgShifterAttr[0] <<= 1
+	p.bgShifterAttr[1] <<= 1
+}
+
+// fetchBackground performs the background memory accesses
+// of the 8 dot tile fetch cycle
+func (p *PPU) fetchBackground() {
+	switch (p.cycles - 1) % 8 {
+	case 0:
+		p.loadBackgroundShifters()
+		p.bgNextTileID = p.mem.Read8(0x2000 | (p.v & 0x0FFF))
+	case 2:
+		attr := p.mem.Read8(0x23C0 | (p.v & 0x0C00) | ((p.v >> 4) & 0x38) | ((p.v >> 2) & 0x07))
+		// each attribute byte covers 4x4 tiles, 2 bits per 2x2 tiles
+		if p.v&0x40 != 0 {
+			attr >>= 4
+		}
+		if p.v&0x02 != 0 {
+			attr >>= 2
+		}
+		p.bgNextTileAttr = attr & 0x3
+	case 4:
+		p.bgNextTileLo = p.mem.Read8(p.backgroundPatternAddr())
+	case 6:
+		p.bgNextTileHi = p.mem.Read8(p.backgroundPatternAddr() + 8)
+	case 7:
+		p.incrementX()
+	}
+}
+
+func (p *PPU) backgroundPatternAddr() uint16 {
+	fineY := (p.v >> 12) & 0x7
+	return uint16(p.ppuctrl.B)<<12 | uint16(p.bgNextTileID)<<4 | fineY
+}
+
+// evaluateSprites performs one dot of the sprite evaluation for the next scanline.
+// It copies up to 8 sprites from OAM into the secondary OAM and replicates
+// the hardware bugs of the sprite overflow detection
+func (p *PPU) evaluateSprites() {
+	// dots 1-64 clear the secondary OAM
+	if p.cycles <= 64 {
+		p.oamLatch = 0xFF
+		p.secondaryOAM[(p.cycles-1)/2] = 0xFF
+		return
+	}
+
+	switch p.cycles {
+	case 65:
+		p.spriteAddrH = (p.oamaddr >> 2) & 0x3F
+		p.spriteAddrL = p.oamaddr & 0x3
+		p.secondaryAddr = 0
+		p.spriteInRange = false
+		p.spriteZeroAdded = false
+		p.oamCopyDone = false
+		p.overflowBugCounter = 0
+	case 256:
+		p.spriteZeroNext = p.spriteZeroAdded
+		p.spriteCountNext = int(p.secondaryAddr >> 2)
 	}
+
+	// odd dots read from OAM
+	if p.cycles%2 == 1 {
+		p.oamLatch = p.oam[p.oamaddr]
+		return
+	}
+
+	// even dots write to the secondary OAM
+	if !p.oamCopyDone && !p.spriteInRange {
+		diff := int(p.scanLine) - int(p.oamLatch)
+		p.spriteInRange = diff >= 0 && diff < p.spriteHeight()
+	}
+
+	switch {
+	case p.oamCopyDone:
+		p.spriteAddrH = (p.spriteAddrH + 1) & 0x3F
+		// writes to the full secondary OAM turn into reads
+		if p.secondaryAddr >= 0x20 {
+			p.oamLatch = p.secondaryOAM[p.secondaryAddr&0x1F]
+		}
+
+	case p.secondaryAddr < 0x20:
+		p.secondaryOAM[p.secondaryAddr] = p.oamLatch
+		if !p.spriteInRange {
+			// skip to the next sprite
+			p.spriteAddrH = (p.spriteAddrH + 1) & 0x3F
+			p.oamCopyDone = p.spriteAddrH == 0
+			break
+		}
+
+		p.spriteAddrL++
+		p.secondaryAddr++
+		if p.spriteAddrH == 0 {
+			p.spriteZeroAdded = true
+		}
+		// all 4 bytes are copied
+		if p.secondaryAddr&0x3 == 0 {
+			p.spriteInRange = false
+			p.spriteAddrL = 0
+			p.spriteAddrH = (p.spriteAddrH + 1) & 0x3F
+			p.oamCopyDone = p.spriteAddrH == 0
+		}
+
+	default:
+		// 8 sprites are found, look for the overflow
+		p.oamLatch = p.secondaryOAM[p.secondaryAddr&0x1F]
+		if !p.spriteInRange {
+			// the hardware bug: both the sprite index and
+			// the byte index are incremented
+			p.spriteAddrH = (p.spriteAddrH + 1) & 0x3F
+			p.spriteAddrL = (p.spriteAddrL + 1) & 0x3
+			p.oamCopyDone = p.spriteAddrH == 0
+			break
+		}
+
+		p.ppustatus.O = 1
+		p.spriteAddrL++
+		if p.spriteAddrL == 4 {
+			p.spriteAddrH = (p.spriteAddrH + 1) & 0x3F
+			p.spriteAddrL = 0
+		}
+		// the rest of the overflowed sprite is read and the evaluation stops
+		switch p.overflowBugCounter {
+		case 0:
+			p.overflowBugCounter = 3
+		case 1:
+			p.overflowBugCounter = 0
+			p.oamCopyDone = true
+			p.spriteAddrL = 0
+		default:
+			p.overflowBugCounter--
+		}
+	}
+	p.oamaddr = p.spriteAddrL&0x3 | p.spriteAddrH<<2
+}
+
+// fetchSprites loads the sprites from the secondary OAM and performs
+// the sprite pattern memory accesses for one of the 8 sprite slots in dots 257-320
+func (p *PPU) fetchSprites() {
+	slot := int(p.cycles-257) / 8
+	step := (p.cycles - 257) % 8
+
+	// the secondary OAM is read during the first 4 dots of the slot
+	p.oamLatch = p.secondaryOAM[slot*4+int(min(step, 3))]
+	switch step {
+	case 0:
+		p.spriteY[slot] = p.oamLatch
+	case 1:
+		p.spriteTile[slot] = p.oamLatch
+	case 2:
+		p.spriteAttr[slot] = p.oamLatch
+	case 3:
+		p.spriteX[slot] = p.oamLatch
+	}
+	if step != 4 && step != 6 {
+		return
+	}
+
+	// empty slots fetch the tile $FF
+	tile, attr, row := uint8(0xFF), uint8(0), uint16(0)
+	if slot < p.spriteCountNext {
+		tile, attr = p.spriteTile[slot], p.spriteAttr[slot]
+		row = p.scanLine - uint16(p.spriteY[slot])
+	}
+
+	addr := p.spritePatternAddr(tile, attr, row)
+	if step == 6 {
+		addr += 8
+	}
+	data := p.mem.Read8(addr)
+	if slot >= p.spriteCountNext {
+		return
+	}
+	// horizontal flip
+	if attr&0x40 != 0 {
+		data = reverseBits(data)
+	}
+	p.spritePattern[slot][step/6] = data
+}
+
+// fetchExtraSprites loads the sprites beyond the first 8 on the next scanline.
+// The hardware doesn't fetch them, so the memory is read without side effects
+func (p *PPU) fetchExtraSprites() {
+	found := 0
+	for i := 0; i < 64; i++ {
+		y := p.oam[i*4]
+		row := int(p.scanLine) - int(y)
+		if row < 0 || row >= p.spriteHeight() {
+			continue
+		}
+		found++
+		if found <= 8 {
+			continue
+		}
+
+		slot := p.spriteCountNext
+		p.spriteY[slot] = y
+		p.spriteTile[slot] = p.oam[i*4+1]
+		p.spriteAttr[slot] = p.oam[i*4+2]
+		p.spriteX[slot] = p.oam[i*4+3]
+		addr := p.spritePatternAddr(p.spriteTile[slot], p.spriteAttr[slot], uint16(row))
+		lo, hi := p.peek(addr), p.peek(addr+8)
+		if p.spriteAttr[slot]&0x40 != 0 {
+			lo, hi = reverseBits(lo), reverseBits(hi)
+		}
+		p.spritePattern[slot] = [2]uint8{lo, hi}
+		p.spriteCountNext++
+	}
+}
+
+// peek reads the memory without side effects if the memory supports it
+func (p *PPU) peek(addr uint16) uint8 {
+	if m, ok := p.mem.(interface{ peek8(addr uint16) uint8 }); ok {
+		return m.peek8(addr)
+	}
+	return p.mem.Read8(addr)
+}
+
+// spritePatternAddr returns the address of the low pattern plane
+// of the sprite tile row
+func (p *PPU) spritePatternAddr(tile, attr uint8, row uint16) uint16 {
+	// vertical flip
+	if attr&0x80 != 0 {
+		row = uint16(p.spriteHeight()-1) - row
+	}
+
+	if p.ppuctrl.H == 0 {
+		return uint16(p.ppuctrl.S)<<12 | uint16(tile)<<4 | row
+	}
+	// 8x16: the bank is the lowest bit of the tile number
+	addr := uint16(tile&0x1)<<12 | uint16(tile&0xFE)<<4
+	if row >= 8 {
+		addr += 16
+		row -= 8
+	}
+	return addr | row
+}
+
+func reverseBits(b uint8) uint8 {
+	b = (b&0xF0)>>4 | (b&0x0F)<<4
+	b = (b&0xCC)>>2 | (b&0x33)<<2
+	b = (b&0xAA)>>1 | (b&0x55)<<1
+	return b
+}
+
+func (p *PPU) backgroundPixel() (pixel uint8, pallete uint8) {
+	if p.ppumask.b == 0 {
+		return 0, 0
+	}
+	mux := uint16(0x8000) >> p.x
+	if p.bgShifterPattern[0]&mux != 0 {
+		pixel |= 0x1
+	}
+	if p.bgShifterPattern[1]&mux != 0 {
+		pixel |= 0x2
+	}
+	if p.bgShifterAttr[0]&mux != 0 {
+		pallete |= 0x1
+	}
+	if p.bgShifterAttr[1]&mux != 0 {
+		pallete |= 0x2
+	}
+	return pixel, pallete
+}
+
+func (p *PPU) spritePixel(x int) (pixel uint8, pallete uint8, behind bool, zero bool) {
+	if p.ppumask.s == 0 {
+		return 0, 0, false, false
+	}
+	for i := 0; i < p.spriteCount; i++ {
+		offset := x - int(p.spriteX[i])
+		if offset < 0 || offset > 7 {
+			continue
+		}
+		bit := 7 - offset
+		pixel = (p.spritePattern[i][0]>>bit)&0x1 | ((p.spritePattern[i][1]>>bit)&0x1)<<1
+		if pixel == 0 {
+			continue
+		}
+		return pixel, p.spriteAttr[i]&0x3 + 4, p.spriteAttr[i]&0x20 != 0, i == 0 && p.spriteZeroLine
+	}
+	return 0, 0, false, false
 }
 
+// renderPixel composes the background and sprite pixels for the current dot
+func (p *PPU) renderPixel() {
+	x := int(p.cycles) - 1
+	if !p.renderingEnabled() {
+		p.pixels[int(p.scanLine)*FrameWidth+x] = p.blankPixel()
+		return
+	}
+	p.blankFrame = false
+	bgPixel, bgPallete := p.backgroundPixel()
+	spPixel, spPallete, spBehind, spZero := p.spritePixel(x)
+	p.pixels[int(p.scanLine)*FrameWidth+x] = p.composePixel(x, bgPixel, bgPallete, spPixel, spPallete, spBehind, spZero)
+}
+
+// composePixel picks the color of the pixel at x from the background and
+// sprite pixels, and detects the sprite 0 hit
+func (p *PPU) composePixel(x int, bgPixel, bgPallete, spPixel, spPallete uint8, spBehind, spZero bool) uint16 {
+	// the leftmost 8 pixels can be hidden to mask scrolling glitches.
+	// hidden pixels are transparent, so they can't trigger sprite 0 hit
+	if x < 8 {
+		if p.ppumask.m == 0 {
+			bgPixel = 0
+		}
+		if p.ppumask.M == 0 {
+			spPixel = 0
+		}
+	}
+
+	var pixel, pallete uint8
+	switch {
+	case bgPixel == 0 && spPixel == 0:
+	case bgPixel == 0:
+		pixel, pallete = spPixel, spPallete
+	case spPixel == 0:
+		pixel, pallete = bgPixel, bgPallete
+	default:
+		if spZero && x != 255 {
+			p.ppustatus.S = 1
+		}
+		if spBehind {
+			pixel, pallete = bgPixel, bgPallete
+		} else {
+			pixel, pallete = spPixel, spPallete
+		}
+	}
+
+	addr := p.backdropAddr()
+	if pixel != 0 {
+		addr = 0x3F00 | uint16(pallete)<<2 | uint16(pixel)
+	}
+	return uint16(p.readPallete(addr)) | p.emphasis()<<6
+}
+
+// blankPixel returns the backdrop color displayed with rendering disabled
+// and tracks whether the frame is a single color
+func (p *PPU) blankPixel() uint16 {
+	color := uint16(p.readPallete(p.backdropAddr())) | p.emphasis()<<6
+	if p.blankColor != color {
+		if p.blankColor != 0xFFFF {
+			p.blankFrame = false
+		}
+		p.blankColor = color
+	}
+	return color
+}
+
+// backdropAddr returns the palette address of the backdrop color.
+// With rendering disabled the backdrop is the palette entry
+// the vram address points to
+func (p *PPU) backdropAddr() uint16 {
+	if !p.renderingEnabled() && p.v&0x3FFF >= 0x3F00 {
+		return p.v
+	}
+	return 0x3F00
+}
+
+// readPallete reads a color from the palette RAM.
+// The palette RAM is inside the PPU, so the read doesn't go to the bus.
+// The grayscale mode takes only the gray column of the palette
+func (p *PPU) readPallete(addr uint16) uint8 {
+	data := p.tablePallete[palleteAddr(addr)] & 0x3F
+	if p.ppumask.g == 1 {
+		data &= 0x30
+	}
+	return data
+}
+
+// emphasis returns the color emphasis bits of PPUMASK as
+// bit 0: red, bit 1: green, bit 2: blue
+func (p *PPU) emphasis() uint16 {
+	r, g := p.ppumask.R, p.ppumask.G
+	// the PAL PPU has the red and green bits swapped
+	if p.region == RegionPAL {
+		r, g = g, r
+	}
+	return uint16(r) | uint16(g)<<1 | uint16(p.ppumask.B)<<2
+}
+
+// completeFrame converts the rendered palette indexes into the RGBA frame
+func (p *PPU) completeFrame() {
+	// the same blank frame converts to the same image
+	if !p.blankFrame || !p.lastBlank || p.blankColor != p.lastBlankColor {
+		p.filter.Apply(p.frame, p.pixels[:])
+	} else if s, ok := p.filter.(frameSkipper); ok {
+		s.Skip()
+	}
+	p.lastBlank, p.lastBlankColor = p.blankFrame, p.blankColor
+
+	for i, pixel := range p.pixels {
+		binary.LittleEndian.PutUint16(p.hashBuf[i*2:], pixel)
+	}
+	p.frameHash = xxhash.Sum64(p.hashBuf[:])
+	p.frameCount++
+	if p.onFrame != nil {
+		p.onFrame(p.frame)
+	}
+}
+
+// ticDot performs the rendering work of one dot:
+// the memory fetches, the sprite evaluation and the pixel output
+func (p *PPU) ticDot() {
+	visibleLine := p.scanLine < FrameHeight
+	preRenderLine := p.scanLine == ppuPreRenderScanline
+
+	if (visibleLine || preRenderLine) && p.renderingEnabled() {
+		switch {
+		case p.cycles >= 2 && p.cycles <= 257, p.cycles >= 321 && p.cycles <= 337:
+			p.updateBackgroundShifters()
+			p.fetchBackground()
+		case p.cycles == 338, p.cycles == 340:
+			// unused nametable fetches
+			p.bgNextTileID = p.mem.Read8(0x2000 | (p.v & 0x0FFF))
+		}
+
+		switch {
+		case p.cycles == 256:
+			p.incrementY()
+		case p.cycles == 257:
+			p.transferX()
+		case preRenderLine && p.cycles >= 280 && p.cycles <= 304:
+			p.transferY()
+		}
+
+		switch {
+		case visibleLine && p.cycles >= 1 && p.cycles <= 256:
+			p.evaluateSprites()
+		case preRenderLine && p.cycles >= 1 && p.cycles <= 8 && p.oamaddr >= 8:
+			// OAM corruption: rendering starts with OAMADDR not at
+			// the beginning, the row of OAMADDR overwrites the first row
+			p.oam[p.cycles-1] = p.oam[int(p.oamaddr&0xF8)+int(p.cycles)-1]
+		case preRenderLine && p.cycles == 256:
+			// no sprite evaluation for the first visible scanline
+			p.spriteCountNext = 0
+			p.spriteZeroNext = false
+		case p.cycles >= 257 && p.cycles <= 320:
+			p.oamaddr = 0
+			p.fetchSprites()
+			if p.cycles == 320 && p.noSpriteLimit && p.spriteCountNext == 8 {
+				p.fetchExtraSprites()
+			}
+		}
+	}
+
+	if visibleLine && p.cycles >= 1 && p.cycles <= FrameWidth {
+		p.renderPixel()
+	}
+}
+
+// Tic executes one PPU cycle (dot)
 func (p *PPU) Tic() {
+	preRenderLine := p.scanLine == ppuPreRenderScanline
+
+	if p.scanLine == 0 && p.cycles == 0 {
+		p.blankFrame = true
+		p.blankColor = 0xFFFF
+	}
+
+	if preRenderLine && p.cycles == 1 {
+		p.ppustatus.V = 0
+		p.ppustatus.S = 0
+		p.ppustatus.O = 0
+	}
+
+	// vertical scroll is reloaded by dot 304
+	if preRenderLine && p.cycles == 304 && p.renderingEnabled() {
+		p.frameScrollV, p.frameScrollX = p.v, p.x
+	}
+
+	if p.mode == RenderModeScanline {
+		p.ticScanline()
+	} else {
+		p.ticDot()
+	}
+
+	if p.scanLine == ppuVblankScanline && p.cycles == 1 {
+		if !p.vblankSuppressed {
+			p.ppustatus.V = 1
+		}
+		p.vblankSuppressed = false
+		p.completeFrame()
+	}
+
+	p.clock++
 	p.cycles++
-	if p.cycles > 340 {
+	// the pre-render scanline is one dot shorter on odd frames when rendering
+	if preRenderLine && p.cycles == 340 && p.frameCount%2 == 1 && p.renderingEnabled() {
+		p.cycles++
+	}
+	if p.cycles >= ppuDotsPerScanline {
 		p.cycles = 0
 		p.scanLine++
-
-		if p.scanLine > 260 {
-			p.scanLine = 0 // or -1?
-			p.frame++
+		if p.scanLine >= ppuScanlinesPerFrame {
+			p.scanLine = 0
+		}
+		// sprites evaluated on the previous scanline become active
+		p.spriteCount = p.spriteCountNext
+		p.spriteZeroLine = p.spriteZeroNext
+		if !p.renderingEnabled() {
+			p.spriteCount = 0
 		}
 	}
 }
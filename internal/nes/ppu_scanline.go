@@ -0,0 +1,150 @@
+package nes
+
+// ticScanline performs the rendering work of the scanline renderer.
+// Everything the dot renderer does during a scanline is done at once:
+// the visible part is rendered at dot 256, and the scroll updates
+// happen at the dots they are done at by the dot renderer.
+func (p *PPU) ticScanline() {
+	visibleLine := p.scanLine < FrameHeight
+	preRenderLine := p.scanLine == ppuPreRenderScanline
+
+	if visibleLine && p.cycles == 256 {
+		p.renderScanline()
+	}
+
+	if !(visibleLine || preRenderLine) || !p.renderingEnabled() {
+		return
+	}
+	switch {
+	case visibleLine && p.cycles == 256:
+		p.incrementY()
+	case p.cycles == 257:
+		p.transferX()
+		p.oamaddr = 0
+	case preRenderLine && p.cycles == 280:
+		p.transferY()
+	}
+}
+
+// renderScanline renders the visible part of the current scanline
+func (p *PPU) renderScanline() {
+	y := int(p.scanLine)
+	line := p.pixels[y*FrameWidth : (y+1)*FrameWidth]
+
+	if !p.renderingEnabled() {
+		color := p.blankPixel()
+		for x := range line {
+			line[x] = color
+		}
+		return
+	}
+	p.blankFrame = false
+
+	// pixel in bits 0-1, palette in bits 2-3
+	var bg [FrameWidth + 8]uint8
+	if p.ppumask.b == 1 {
+		p.renderScanlineBackground(bg[:])
+	}
+
+	// pixel in bits 0-1, palette in bits 2-3,
+	// bit 4: behind the background, bit 5: sprite 0
+	var sp [FrameWidth]uint8
+	p.renderScanlineSprites(sp[:])
+
+	for x := range line {
+		b, s := bg[x+int(p.x)], sp[x]
+		line[x] = p.composePixel(x, b&0x3, b>>2, s&0x3, s>>2&0x3+4, s&0x10 != 0, s&0x20 != 0)
+	}
+}
+
+// renderScanlineBackground fetches the 33 tiles covering the scanline,
+// starting at the vram address, and puts their pixels into bg
+func (p *PPU) renderScanlineBackground(bg []uint8) {
+	v := p.v
+	for tile := 0; tile < len(bg)/8; tile++ {
+		p.bgNextTileID = p.mem.Read8(0x2000 | (p.v & 0x0FFF))
+		attr := p.mem.Read8(0x23C0 | (p.v & 0x0C00) | ((p.v >> 4) & 0x38) | ((p.v >> 2) & 0x07))
+		if p.v&0x40 != 0 {
+			attr >>= 4
+		}
+		if p.v&0x02 != 0 {
+			attr >>= 2
+		}
+		lo := p.mem.Read8(p.backgroundPatternAddr())
+		hi := p.mem.Read8(p.backgroundPatternAddr() + 8)
+
+		for i := 0; i < 8; i++ {
+			bit := 7 - i
+			pixel := (lo>>bit)&0x1 | ((hi>>bit)&0x1)<<1
+			bg[tile*8+i] = pixel | (attr&0x3)<<2
+		}
+		p.incrementX()
+	}
+	// the horizontal position is reloaded at dot 257 anyway
+	p.v = v
+}
+
+// renderScanlineSprites finds the first 8 sprites on the scanline, or all
+// of them with the sprite limit removed,
+// fetches their patterns and puts their pixels into sp.
+// Sprites are evaluated on the previous scanline, so the first one has none.
+func (p *PPU) renderScanlineSprites(sp []uint8) {
+	if p.scanLine == 0 {
+		return
+	}
+	evalLine := int(p.scanLine) - 1
+
+	count := 0
+	for i := 0; i < 64; i++ {
+		row := evalLine - int(p.oam[i*4])
+		if row < 0 || row >= p.spriteHeight() {
+			continue
+		}
+		if count == 8 {
+			p.ppustatus.O = 1
+			if !p.noSpriteLimit {
+				break
+			}
+		}
+		// the hardware doesn't fetch the sprites beyond the limit
+		read := p.mem.Read8
+		if count >= 8 {
+			read = p.peek
+		}
+		count++
+
+		tile, attr, x := p.oam[i*4+1], p.oam[i*4+2], int(p.oam[i*4+3])
+		addr := p.spritePatternAddr(tile, attr, uint16(row))
+		lo, hi := read(addr), read(addr+8)
+		if attr&0x40 != 0 {
+			lo, hi = reverseBits(lo), reverseBits(hi)
+		}
+		if p.ppumask.s == 0 {
+			continue
+		}
+
+		flags := (attr & 0x3) << 2
+		if attr&0x20 != 0 {
+			flags |= 0x10
+		}
+		if i == 0 {
+			flags |= 0x20
+		}
+		for offset := 0; offset < 8 && x+offset < FrameWidth; offset++ {
+			bit := 7 - offset
+			pixel := (lo>>bit)&0x1 | ((hi>>bit)&0x1)<<1
+			// the sprite with the lower index wins
+			if pixel == 0 || sp[x+offset] != 0 {
+				continue
+			}
+			sp[x+offset] = pixel | flags
+		}
+	}
+
+	// empty slots fetch the tile $FF, mappers watching A12 rely on it
+	for ; count < 8; count++ {
+		addr := p.spritePatternAddr(0xFF, 0, 0)
+		p.mem.Read8(addr)
+		p.mem.Read8(addr + 8)
+	}
+}
@@ -0,0 +1,263 @@
+package nes
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// ppuState is the emulated state of the PPU as it is serialized, the pixels
+// of the frame being rendered and of the last frame follow it. The host
+// settings (the video filter, the render mode and the sprite limit)
+// are not a part of it
+type ppuState struct {
+	Ctrl, Mask, Status uint8
+	OAMAddr            uint8
+	Data               uint8
+	OpenBus            uint8
+	OpenBusRefresh     [8]uint64
+
+	V, T uint16
+	X, W uint8
+
+	Nametables [2][0x400]uint8
+	Palette    [0x20]uint8
+	OAM        [0x100]uint8
+
+	BgNextTileID     uint8
+	BgNextTileAttr   uint8
+	BgNextTileLo     uint8
+	BgNextTileHi     uint8
+	BgShifterPattern [2]uint16
+	BgShifterAttr    [2]uint16
+
+	SecondaryOAM       [0x20]uint8
+	OAMLatch           uint8
+	SpriteAddrH        uint8
+	SpriteAddrL        uint8
+	SecondaryAddr      uint8
+	SpriteInRange      bool
+	SpriteZeroAdded    bool
+	OAMCopyDone        bool
+	OverflowBugCounter uint8
+
+	SpriteCount     uint8
+	SpriteX         [64]uint8
+	SpriteY         [64]uint8
+	SpriteTile      [64]uint8
+	SpriteAttr      [64]uint8
+	SpritePattern   [64][2]uint8
+	SpriteZeroLine  bool
+	SpriteZeroNext  bool
+	SpriteCountNext uint8
+
+	VblankSuppressed bool
+	BlankFrame       bool
+	BlankColor       uint16
+	FrameScrollV     uint16
+	FrameScrollX     uint8
+
+	Cycles     uint16
+	ScanLine   uint16
+	FrameCount uint64
+	Clock      uint64
+}
+
+// SaveState writes the registers, the memories, the rendering
+// pipeline and the position of the PPU in the frame, then the pixels
+func (p *PPU) SaveState(w io.Writer) error {
+	if err := p.saveRegisters(w); err != nil {
+		return err
+	}
+	return p.savePixels(w)
+}
+
+// saveRegisters writes the state without the pixels
+func (p *PPU) saveRegisters(w io.Writer) error {
+	s := new(ppuState)
+	c, m := &p.ppuctrl, &p.ppumask
+	s.Ctrl = c.N | c.I<<2 | c.S<<3 | c.B<<4 | c.H<<5 | c.P<<6 | c.V<<7
+	s.Mask = m.g | m.m<<1 | m.M<<2 | m.b<<3 | m.s<<4 | m.R<<5 | m.G<<6 | m.B<<7
+	s.Status = p.ppustatus.O<<5 | p.ppustatus.S<<6 | p.ppustatus.V<<7
+	s.OAMAddr = p.oamaddr
+	s.Data = p.ppudata
+	s.OpenBus = p.openBus
+	s.OpenBusRefresh = p.openBusRefresh
+
+	s.V, s.T, s.X, s.W = p.v, p.t, p.x, p.w
+	s.Nametables = p.tableNames
+	s.Palette = p.tablePallete
+	s.OAM = p.oam
+
+	s.BgNextTileID = p.bgNextTileID
+	s.BgNextTileAttr = p.bgNextTileAttr
+	s.BgNextTileLo = p.bgNextTileLo
+	s.BgNextTileHi = p.bgNextTileHi
+	s.BgShifterPattern = p.bgShifterPattern
+	s.BgShifterAttr = p.bgShifterAttr
+
+	s.SecondaryOAM = p.secondaryOAM
+	s.OAMLatch = p.oamLatch
+	s.SpriteAddrH = p.spriteAddrH
+	s.SpriteAddrL = p.spriteAddrL
+	s.SecondaryAddr = p.secondaryAddr
+	s.SpriteInRange = p.spriteInRange
+	s.SpriteZeroAdded = p.spriteZeroAdded
+	s.OAMCopyDone = p.oamCopyDone
+	s.OverflowBugCounter = p.overflowBugCounter
+
+	s.SpriteCount = uint8(p.spriteCount)
+	s.SpriteX = p.spriteX
+	s.SpriteY = p.spriteY
+	s.SpriteTile = p.spriteTile
+	s.SpriteAttr = p.spriteAttr
+	s.SpritePattern = p.spritePattern
+	s.SpriteZeroLine = p.spriteZeroLine
+	s.SpriteZeroNext = p.spriteZeroNext
+	s.SpriteCountNext = uint8(p.spriteCountNext)
+
+	s.VblankSuppressed = p.vblankSuppressed
+	s.BlankFrame = p.blankFrame
+	s.BlankColor = p.blankColor
+	s.FrameScrollV = p.frameScrollV
+	s.FrameScrollX = p.frameScrollX
+
+	s.Cycles = p.cycles
+	s.ScanLine = p.scanLine
+	s.FrameCount = p.frameCount
+	s.Clock = p.clock
+
+	if err := binary.Write(w, binary.LittleEndian, s); err != nil {
+		return fmt.Errorf("couldn't write the PPU state: %s", err)
+	}
+	return nil
+}
+
+// savePixels writes the pixels of the frame being rendered and of the last
+// frame, as the slices without the reflection of the struct
+func (p *PPU) savePixels(w io.Writer) error {
+	if err := binary.Write(w, binary.LittleEndian, p.pixels[:]); err != nil {
+		return fmt.Errorf("couldn't write the PPU state: %s", err)
+	}
+	if _, err := w.Write(p.hashBuf[:]); err != nil {
+		return fmt.Errorf("couldn't write the PPU state: %s", err)
+	}
+	return nil
+}
+
+// LoadState reads the state written by SaveState. The last frame
+// is converted again, so the picture shows the loaded state
+func (p *PPU) LoadState(r io.Reader) error {
+	if err := p.loadRegisters(r); err != nil {
+		return err
+	}
+	return p.loadPixels(r)
+}
+
+// loadPixels reads the pixels written by savePixels
+func (p *PPU) loadPixels(r io.Reader) error {
+	var pixels [FrameWidth * FrameHeight]uint16
+	if err := binary.Read(r, binary.LittleEndian, pixels[:]); err != nil {
+		return fmt.Errorf("couldn't read the PPU pixels: %s", err)
+	}
+	var lastFrame [len(p.hashBuf)]uint8
+	if _, err := io.ReadFull(r, lastFrame[:]); err != nil {
+		return fmt.Errorf("couldn't read the PPU pixels: %s", err)
+	}
+	p.pixels = pixels
+	p.hashBuf = lastFrame
+	p.redrawFrame()
+	return nil
+}
+
+// loadRegisters reads the state written by saveRegisters
+func (p *PPU) loadRegisters(r io.Reader) error {
+	s := new(ppuState)
+	if err := binary.Read(r, binary.LittleEndian, s); err != nil {
+		return fmt.Errorf("couldn't read the PPU state: %s", err)
+	}
+	if s.SpriteCount > 64 || s.SpriteCountNext > 64 || s.Cycles >= ppuDotsPerScanline || s.ScanLine >= ppuScanlinesPerFrame {
+		return errors.New("the PPU state is corrupted")
+	}
+	c, m := &p.ppuctrl, &p.ppumask
+	c.N = s.Ctrl & 0x3
+	c.I = (s.Ctrl >> 2) & 0x1
+	c.S = (s.Ctrl >> 3) & 0x1
+	c.B = (s.Ctrl >> 4) & 0x1
+	c.H = (s.Ctrl >> 5) & 0x1
+	c.P = (s.Ctrl >> 6) & 0x1
+	c.V = (s.Ctrl >> 7) & 0x1
+	m.g = s.Mask & 0x1
+	m.m = (s.Mask >> 1) & 0x1
+	m.M = (s.Mask >> 2) & 0x1
+	m.b = (s.Mask >> 3) & 0x1
+	m.s = (s.Mask >> 4) & 0x1
+	m.R = (s.Mask >> 5) & 0x1
+	m.G = (s.Mask >> 6) & 0x1
+	m.B = (s.Mask >> 7) & 0x1
+	p.ppustatus.O = (s.Status >> 5) & 0x1
+	p.ppustatus.S = (s.Status >> 6) & 0x1
+	p.ppustatus.V = (s.Status >> 7) & 0x1
+	p.oamaddr = s.OAMAddr
+	p.ppudata = s.Data
+	p.openBus = s.OpenBus
+	p.openBusRefresh = s.OpenBusRefresh
+
+	p.v, p.t, p.x, p.w = s.V&0x7FFF, s.T&0x7FFF, s.X&0x7, s.W&0x1
+	p.tableNames = s.Nametables
+	p.tablePallete = s.Palette
+	p.oam = s.OAM
+
+	p.bgNextTileID = s.BgNextTileID
+	p.bgNextTileAttr = s.BgNextTileAttr
+	p.bgNextTileLo = s.BgNextTileLo
+	p.bgNextTileHi = s.BgNextTileHi
+	p.bgShifterPattern = s.BgShifterPattern
+	p.bgShifterAttr = s.BgShifterAttr
+
+	p.secondaryOAM = s.SecondaryOAM
+	p.oamLatch = s.OAMLatch
+	p.spriteAddrH = s.SpriteAddrH
+	p.spriteAddrL = s.SpriteAddrL
+	p.secondaryAddr = s.SecondaryAddr
+	p.spriteInRange = s.SpriteInRange
+	p.spriteZeroAdded = s.SpriteZeroAdded
+	p.oamCopyDone = s.OAMCopyDone
+	p.overflowBugCounter = s.OverflowBugCounter
+
+	p.spriteCount = int(s.SpriteCount)
+	p.spriteX = s.SpriteX
+	p.spriteY = s.SpriteY
+	p.spriteTile = s.SpriteTile
+	p.spriteAttr = s.SpriteAttr
+	p.spritePattern = s.SpritePattern
+	p.spriteZeroLine = s.SpriteZeroLine
+	p.spriteZeroNext = s.SpriteZeroNext
+	p.spriteCountNext = int(s.SpriteCountNext)
+
+	p.vblankSuppressed = s.VblankSuppressed
+	p.blankFrame = s.BlankFrame
+	p.blankColor = s.BlankColor
+	p.frameScrollV = s.FrameScrollV
+	p.frameScrollX = s.FrameScrollX
+
+	p.cycles = s.Cycles
+	p.scanLine = s.ScanLine
+	p.frameCount = s.FrameCount
+	p.clock = s.Clock
+	return nil
+}
+
+// redrawFrame converts the last frame again from its palette indexes
+func (p *PPU) redrawFrame() {
+	pixels := make([]uint16, FrameWidth*FrameHeight)
+	for i := range pixels {
+		pixels[i] = binary.LittleEndian.Uint16(p.hashBuf[i*2:])
+	}
+	p.frameHash = xxhash.Sum64(p.hashBuf[:])
+	p.filter.Apply(p.frame, pixels)
+	p.lastBlank = false
+}
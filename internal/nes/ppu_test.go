@@ -0,0 +1,483 @@
+package nes
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBus() *Bus {
+	cart := &Cart{
+		pgrMem:   make([]uint8, prgBankSizeBytes),
+		chrMem:   make([]uint8, chrBankSizeBytes),
+		pgrBanks: 1,
+		chrBanks: 1,
+	}
+	cart.mapper = NewMapper(cart)
+
+	bus := NewBus()
+	bus.cart = cart
+	return bus
+}
+
+func setPpuAddr(p *PPU, addr uint16) {
+	p.writeRegister(0x6, uint8(addr>>8))
+	p.writeRegister(0x6, uint8(addr))
+}
+
+func Test_PPU_ReadDataBuffer(t *testing.T) {
+	bus := newTestBus()
+	p := bus.ppu
+
+	setPpuAddr(p, 0x2000)
+	p.writeRegister(0x7, 0x11)
+	p.writeRegister(0x7, 0x22)
+
+	setPpuAddr(p, 0x2000)
+	assert.Equal(t, uint8(0x00), p.readRegister(0x7), "first read returns the stale buffer")
+	assert.Equal(t, uint8(0x11), p.readRegister(0x7))
+	assert.Equal(t, uint8(0x22), p.readRegister(0x7))
+}
+
+func Test_PPU_ReadDataPallete(t *testing.T) {
+	bus := newTestBus()
+	p := bus.ppu
+
+	// nametable under the palette
+	setPpuAddr(p, 0x2F00)
+	p.writeRegister(0x7, 0x55)
+	setPpuAddr(p, 0x3F00)
+	p.writeRegister(0x7, 0x2A)
+
+	setPpuAddr(p, 0x3F00)
+	assert.Equal(t, uint8(0x2A), p.readRegister(0x7), "palette reads are immediate")
+	assert.Equal(t, uint8(0x55), p.ppudata, "buffer is filled from the nametable")
+
+	// grayscale
+	p.writeRegister(0x1, 0x01)
+	setPpuAddr(p, 0x3F00)
+	assert.Equal(t, uint8(0x20), p.readRegister(0x7))
+}
+
+func Test_PPU_OpenBus(t *testing.T) {
+	bus := newTestBus()
+	p := bus.ppu
+
+	// write-only registers return the latch
+	p.writeRegister(0x3, 0x5A)
+	assert.Equal(t, uint8(0x5A), p.readRegister(0x0))
+	assert.Equal(t, uint8(0x5A), p.readRegister(0x6))
+
+	// status fills only the upper bits
+	p.ppustatus.V = 1
+	assert.Equal(t, uint8(0x80|0x1A), p.readRegister(0x2))
+	assert.Equal(t, uint8(0x9A), p.readRegister(0x5))
+
+	// the latch decays when it is not refreshed
+	p.frameCount += ppuOpenBusDecayFrames + 1
+	assert.Equal(t, uint8(0x00), p.readRegister(0x5))
+
+	// the frame count starts over with the reset
+	p.writeRegister(0x3, 0x5A)
+	p.Reset()
+	assert.Equal(t, [8]uint64{}, p.openBusRefresh)
+	p.writeRegister(0x3, 0x5A)
+	p.frameCount += ppuOpenBusDecayFrames
+	assert.Equal(t, uint8(0x5A), p.readRegister(0x0))
+}
+
+func Test_PPU_OAMData(t *testing.T) {
+	bus := newTestBus()
+	p := bus.ppu
+
+	// the unused bits of the attribute byte read as 0
+	p.writeRegister(0x3, 0x02)
+	p.writeRegister(0x4, 0xFF)
+	p.writeRegister(0x3, 0x02)
+	assert.Equal(t, uint8(0xE3), p.readRegister(0x4))
+
+	// writes during rendering only bump the address
+	p.writeRegister(0x1, 0x18)
+	p.scanLine = 10
+	p.writeRegister(0x3, 0x11)
+	p.writeRegister(0x4, 0xAA)
+	assert.Equal(t, uint8(0x15), p.oamaddr)
+	assert.Equal(t, uint8(0x00), p.oam[0x11])
+
+	// reads during the secondary OAM clear return $FF
+	p.cycles = 10
+	p.evaluateSprites()
+	assert.Equal(t, uint8(0xFF), p.readRegister(0x4))
+}
+
+type a12CountingMapper struct {
+	Mapper
+	rises int
+}
+
+func (m *a12CountingMapper) A12Rise() {
+	m.rises++
+}
+
+func Test_PPU_A12Rise(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		ctrl uint8
+	}{
+		{name: "8x8 sprites at $1000", ctrl: 0x08},
+		{name: "8x16 sprites", ctrl: 0x20},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := newTestBus()
+			mapper := &a12CountingMapper{Mapper: bus.cart.mapper}
+			bus.cart.mapper = mapper
+			p := bus.ppu
+
+			// hide all sprites, empty sprite slots fetch the tile $FF
+			for i := range p.oam {
+				p.oam[i] = 0xFF
+			}
+			p.writeRegister(0x0, tt.ctrl)
+			p.writeRegister(0x1, 0x18)
+			// skip to the start of a frame
+			for p.scanLine != 0 || p.cycles != 0 {
+				p.Tic()
+			}
+			mapper.rises = 0
+			for i := 0; i < ppuDotsPerScanline*ppuScanlinesPerFrame; i++ {
+				p.Tic()
+			}
+			// one rise per rendered scanline including the pre-render one
+			assert.Equal(t, FrameHeight+1, mapper.rises)
+		})
+	}
+}
+
+func Test_PPU_VblankRace(t *testing.T) {
+	bus := newTestBus()
+	p := bus.ppu
+
+	tic := func(scanLine, cycles uint16) {
+		for p.scanLine != scanLine || p.cycles != cycles {
+			p.Tic()
+		}
+	}
+
+	// reading one dot before the vblank suppresses the flag for the frame
+	tic(ppuVblankScanline, 1)
+	assert.Equal(t, uint8(0x00), p.readRegister(0x2)&0x80)
+	p.Tic()
+	assert.Equal(t, uint8(0x00), p.readRegister(0x2)&0x80)
+
+	// the next frame sets it as usual
+	tic(ppuPreRenderScanline, 0)
+	tic(ppuVblankScanline, 2)
+	assert.Equal(t, uint8(0x80), p.readRegister(0x2)&0x80)
+
+	// enabling the NMI during the vblank raises the line
+	tic(ppuVblankScanline+1, 0)
+	assert.False(t, p.nmiLine())
+	p.ppustatus.V = 1
+	p.writeRegister(0x0, 0x80)
+	assert.True(t, p.nmiLine())
+}
+
+func Test_PPU_ScanlineRenderer(t *testing.T) {
+	render := func(mode RenderMode) [FrameWidth * FrameHeight]uint16 {
+		bus := newTestBus()
+		p := bus.ppu
+		p.SetRenderMode(mode)
+
+		rnd := uint32(1)
+		next := func() uint8 {
+			rnd = rnd*1103515245 + 12345
+			return uint8(rnd >> 16)
+		}
+		for i := range bus.cart.chrMem {
+			bus.cart.chrMem[i] = next()
+		}
+		for i := range p.tableNames[0] {
+			p.tableNames[0][i] = next()
+			p.tableNames[1][i] = next()
+		}
+		for i := range p.tablePallete {
+			p.tablePallete[i] = next() & 0x3F
+		}
+		for i := range p.oam {
+			p.oam[i] = next()
+		}
+
+		p.writeRegister(0x0, 0x08)
+		p.writeRegister(0x1, 0x1E)
+		p.writeRegister(0x5, 0x13)
+		p.writeRegister(0x5, 0x27)
+		for p.frameCount < 2 {
+			p.Tic()
+		}
+		return p.pixels
+	}
+
+	assert.Equal(t, render(RenderModeDot), render(RenderModeScanline))
+}
+
+type countingFilter struct {
+	PaletteFilter
+	applied int
+}
+
+func (f *countingFilter) Apply(dst *image.RGBA, pixels []uint16) {
+	f.applied++
+	f.PaletteFilter.Apply(dst, pixels)
+}
+
+func Test_PPU_SkipBlankFrames(t *testing.T) {
+	bus := newTestBus()
+	p := bus.ppu
+	filter := &countingFilter{}
+	p.SetVideoFilter(filter)
+	p.tablePallete[0] = 0x16
+
+	frames := func(n uint64) {
+		for end := p.frameCount + n; p.frameCount < end; {
+			p.Tic()
+		}
+	}
+
+	frames(4)
+	assert.Equal(t, 1, filter.applied, "the same blank frame is converted once")
+	assert.Equal(t, defaultPalette[0][0x16], p.Frame().RGBAAt(100, 100))
+
+	p.tablePallete[0] = 0x2A
+	frames(1)
+	assert.Equal(t, 2, filter.applied)
+	assert.Equal(t, defaultPalette[0][0x2A], p.Frame().RGBAAt(100, 100))
+
+	p.writeRegister(0x1, 0x08)
+	frames(2)
+	assert.Equal(t, 4, filter.applied, "rendered frames are always converted")
+
+	// the NTSC phase goes on over the skipped frames
+	ntsc := NewNTSCFilter()
+	p.SetVideoFilter(ntsc)
+	p.writeRegister(0x1, 0x00)
+	frames(4)
+	assert.Equal(t, uint64(4), ntsc.frame)
+}
+
+func Test_PPU_SpriteLimit(t *testing.T) {
+	for _, mode := range []RenderMode{RenderModeDot, RenderModeScanline} {
+		for _, limit := range []bool{true, false} {
+			bus := newTestBus()
+			p := bus.ppu
+			p.SetRenderMode(mode)
+			p.SetSpriteLimit(limit)
+
+			// tile 1 is solid color 1
+			for i := 0; i < 8; i++ {
+				bus.cart.chrMem[0x10+i] = 0xFF
+			}
+			p.tablePallete[0x11] = 0x16
+			for i := range p.oam {
+				p.oam[i] = 0xFF
+			}
+			// 10 sprites on scanlines 21-28
+			for i := 0; i < 10; i++ {
+				p.oam[i*4+0] = 20
+				p.oam[i*4+1] = 1
+				p.oam[i*4+2] = 0
+				p.oam[i*4+3] = uint8(16 + i*8)
+			}
+			p.writeRegister(0x1, 0x14)
+
+			for p.scanLine != 30 {
+				p.Tic()
+			}
+			ninth := p.pixels[24*FrameWidth+16+8*8]
+			if limit {
+				assert.Equal(t, uint16(0), ninth, "%s: the 9th sprite is dropped", mode)
+			} else {
+				assert.Equal(t, uint16(0x16), ninth, "%s: the 9th sprite is rendered", mode)
+			}
+			assert.Equal(t, uint16(0x16), p.pixels[24*FrameWidth+16])
+			assert.Equal(t, uint8(1), p.ppustatus.O, "%s: overflow is set", mode)
+		}
+	}
+}
+
+func Test_PPU_FrameHash(t *testing.T) {
+	bus := newTestBus()
+	p := bus.ppu
+	frame := func() uint64 {
+		for end := p.frameCount + 1; p.frameCount < end; {
+			p.Tic()
+		}
+		return p.FrameHash()
+	}
+
+	p.tablePallete[0] = 0x16
+	first := frame()
+	assert.Equal(t, first, frame(), "the same frame has the same hash")
+
+	// the palette doesn't change the palette indexes
+	p.SetPalette(GeneratePalette(0, 1, 1))
+	assert.Equal(t, first, frame())
+
+	p.tablePallete[0] = 0x2A
+	assert.NotEqual(t, first, frame())
+}
+
+func Test_PPU_RawFrame(t *testing.T) {
+	bus := newTestBus()
+	p := bus.ppu
+	p.tablePallete[0] = 0x16
+	p.SetVideoFilter(NewNTSCFilter())
+	for p.frameCount == 0 {
+		p.Tic()
+	}
+
+	raw := p.RawFrame()
+	assert.Equal(t, defaultPalette[0][0x16], raw.RGBAAt(100, 100), "the video filter is skipped")
+	assert.NotEqual(t, p.Frame().Pix, raw.Pix)
+
+	// the palette stays under the video filter
+	palette := GeneratePalette(30, 1, 0.5)
+	p.SetPalette(palette)
+	p.SetVideoFilter(NewNTSCFilter())
+	assert.Equal(t, palette[0][0x16], p.RawFrame().RGBAAt(100, 100))
+	p.SetVideoFilter(nil)
+	assert.Equal(t, PaletteFilter{Palette: palette}, p.filter)
+}
+
+func Test_PPU_OnFrame(t *testing.T) {
+	bus := newTestBus()
+	p := bus.ppu
+	p.tablePallete[0] = 0x16
+
+	var frames []*image.RGBA
+	p.OnFrame(func(frame *image.RGBA) {
+		frames = append(frames, frame)
+	})
+	for p.frameCount < 2 {
+		p.Tic()
+	}
+
+	require.Len(t, frames, 2, "the callback is called once a frame")
+	assert.Same(t, p.Frame(), frames[1], "the callback gets the frame")
+	assert.Equal(t, image.Rect(0, 0, FrameWidth, FrameHeight), p.Frame().Bounds())
+	assert.Equal(t, defaultPalette[0][0x16], p.Frame().RGBAAt(0, 0))
+	assert.Equal(t, defaultPalette[0][0x16], p.Frame().RGBAAt(FrameWidth-1, FrameHeight-1))
+
+	p.OnFrame(nil)
+	for p.frameCount < 3 {
+		p.Tic()
+	}
+	assert.Len(t, frames, 2)
+}
+
+func Test_PPU_Emphasis(t *testing.T) {
+	tests := []struct {
+		name     string
+		region   Region
+		mask     uint8
+		emphasis uint16
+	}{
+		{"none", RegionNTSC, 0x00, 0},
+		{"red", RegionNTSC, 0x20, 1},
+		{"green", RegionNTSC, 0x40, 2},
+		{"blue", RegionNTSC, 0x80, 4},
+		{"all", RegionNTSC, 0xE0, 7},
+		{"PAL red", RegionPAL, 0x20, 2},
+		{"PAL green", RegionPAL, 0x40, 1},
+		{"PAL blue", RegionPAL, 0x80, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := newTestBus()
+			p := bus.ppu
+			p.SetRegion(tt.region)
+			p.tablePallete[0] = 0x30
+			p.writeRegister(0x1, tt.mask)
+			for p.frameCount == 0 {
+				p.Tic()
+			}
+
+			assert.Equal(t, tt.emphasis<<6|0x30, p.pixels[100*FrameWidth+100])
+			assert.Equal(t, defaultPalette[tt.emphasis][0x30], p.Frame().RGBAAt(100, 100))
+		})
+	}
+
+	white, red := defaultPalette[0][0x30], defaultPalette[1][0x30]
+	assert.Equal(t, white.R, red.R, "the emphasized color stays")
+	assert.Less(t, red.G, white.G, "the other colors are darkened")
+	assert.Less(t, red.B, white.B, "the other colors are darkened")
+	assert.Equal(t, defaultPalette[0][0x0F], defaultPalette[7][0x0F], "the black column is not affected")
+}
+
+func Test_PPU_Grayscale(t *testing.T) {
+	bus := newTestBus()
+	p := bus.ppu
+	frame := func() uint16 {
+		for end := p.frameCount + 1; p.frameCount < end; {
+			p.Tic()
+		}
+		return p.pixels[100*FrameWidth+100]
+	}
+
+	p.tablePallete[0] = 0x26
+	assert.Equal(t, uint16(0x26), frame())
+
+	p.writeRegister(0x1, 0x01)
+	assert.Equal(t, uint16(0x20), frame(), "only the gray column")
+	assert.Equal(t, uint8(0x26), p.tablePallete[0], "the palette RAM is kept")
+
+	p.writeRegister(0x1, 0x21)
+	assert.Equal(t, uint16(1<<6|0x20), frame(), "the emphasis applies to the gray")
+}
+
+func Test_PPU_LeftColumn(t *testing.T) {
+	tests := []struct {
+		mask       uint8
+		background uint16 // at x 4
+		sprite     uint16
+		hit        uint8
+	}{
+		{0x18, 0x0F, 0x0F, 0},
+		{0x1A, 0x16, 0x16, 0},
+		{0x1C, 0x0F, 0x2A, 0},
+		{0x1E, 0x16, 0x2A, 1},
+	}
+	for _, mode := range []RenderMode{RenderModeDot, RenderModeScanline} {
+		for _, tt := range tests {
+			bus := newTestBus()
+			p := bus.ppu
+			p.SetRenderMode(mode)
+
+			// tile 1 is solid color 1 on the whole screen
+			for i := 0; i < 8; i++ {
+				bus.cart.chrMem[0x10+i] = 0xFF
+			}
+			for i := 0; i < 960; i++ {
+				p.tableNames[0][i] = 1
+			}
+			p.tablePallete[0x00] = 0x0F
+			p.tablePallete[0x01] = 0x16
+			p.tablePallete[0x11] = 0x2A
+			for i := range p.oam {
+				p.oam[i] = 0xFF
+			}
+			// sprite 0 on scanlines 21-28 at x 0-7
+			copy(p.oam[:], []uint8{20, 1, 0, 0})
+			p.writeRegister(0x1, tt.mask)
+
+			for p.scanLine != 30 {
+				p.Tic()
+			}
+			assert.Equal(t, tt.background, p.pixels[10*FrameWidth+4], "%s %02X: the background", mode, tt.mask)
+			assert.Equal(t, uint16(0x16), p.pixels[10*FrameWidth+12], "%s %02X: the background past the column", mode, tt.mask)
+			assert.Equal(t, tt.sprite, p.pixels[24*FrameWidth+4], "%s %02X: the sprite", mode, tt.mask)
+			assert.Equal(t, tt.hit, p.ppustatus.S, "%s %02X: sprite 0 hit", mode, tt.mask)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package nes
+
+import "time"
+
+// profileInterval is how often the dots are timed while profiling,
+// a multiple of 3 so the timed dots run the CPU and the APU too.
+// Timing every dot would take longer than the dots themselves
+const profileInterval = 96
+
+// Profile is the time the console spent in its chips,
+// estimated from the timed dots
+type Profile struct {
+	CPU time.Duration
+	PPU time.Duration
+	APU time.Duration
+}
+
+// Total returns the time of all the chips
+func (p Profile) Total() time.Duration {
+	return p.CPU + p.PPU + p.APU
+}
+
+// SetProfiling turns on or off timing the chips, see ReadProfile
+func (b *Bus) SetProfiling(enabled bool) {
+	b.profile = nil
+	if enabled {
+		b.profile = &Profile{}
+	}
+}
+
+// ReadProfile returns the time spent in the chips since the last read
+func (b *Bus) ReadProfile() Profile {
+	if b.profile == nil {
+		return Profile{}
+	}
+	p := *b.profile
+	*b.profile = Profile{}
+	return p
+}
+
+// profiledTic is the Tic timing the chips, the time stands
+// for all the dots since the previous timed dot
+func (b *Bus) profiledTic() {
+	start := time.Now()
+	b.ppu.Tic()
+	b.watchEvents()
+	ppu := time.Now()
+	b.cpuTic()
+	cpu := time.Now()
+	b.apuTic()
+	apu := time.Now()
+	b.ticCounter++
+
+	p := b.profile
+	p.PPU += ppu.Sub(start) * profileInterval
+	p.CPU += cpu.Sub(ppu) * profileInterval / 3
+	p.APU += apu.Sub(cpu) * profileInterval / 3
+}
@@ -0,0 +1,26 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Bus_ReadProfile(t *testing.T) {
+	plain, profiled := newSnapshotBus(), newSnapshotBus()
+	assert.Equal(t, Profile{}, profiled.ReadProfile(), "not profiling")
+	profiled.SetProfiling(true)
+	for i := 0; i < 3; i++ {
+		plain.RunFrame()
+		profiled.RunFrame()
+	}
+	assert.Equal(t, plain.ppu.FrameHash(), profiled.ppu.FrameHash(), "the timed dots run the same")
+	assert.Equal(t, plain.ticCounter, profiled.ticCounter)
+
+	p := profiled.ReadProfile()
+	assert.Positive(t, p.CPU)
+	assert.Positive(t, p.PPU)
+	assert.Positive(t, p.APU)
+	assert.Equal(t, p.CPU+p.PPU+p.APU, p.Total())
+	assert.Equal(t, Profile{}, profiled.ReadProfile(), "the read resets the profile")
+}
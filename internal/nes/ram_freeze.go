@@ -0,0 +1,45 @@
+package nes
+
+import "slices"
+
+// RAMFreeze keeps the value at the address of the RAM, $0000-$1FFF.
+// The value is written before every frame, with OnWrite the CPU writes
+// of the address write it too. The other addresses are ignored,
+// the cartridges have no RAM
+type RAMFreeze struct {
+	Addr    uint16
+	Value   uint8
+	OnWrite bool
+}
+
+// SetRAMFreezes sets the frozen addresses and writes their values,
+// nil removes them
+func (b *Bus) SetRAMFreezes(freezes []RAMFreeze) {
+	b.freezes = slices.Clone(freezes)
+	b.writeFreezes()
+}
+
+// RAMFreezes returns the frozen addresses
+func (b *Bus) RAMFreezes() []RAMFreeze {
+	return slices.Clone(b.freezes)
+}
+
+// writeFreezes writes the values of the frozen addresses
+func (b *Bus) writeFreezes() {
+	for _, f := range b.freezes {
+		if f.Addr < 0x2000 {
+			b.ram.Write8(f.Addr&0x07FF, f.Value)
+		}
+	}
+}
+
+// freezeWrite returns the byte the CPU writes to the RAM with the frozen addresses
+func (b *Bus) freezeWrite(addr uint16, data uint8) uint8 {
+	addr &= 0x07FF
+	for _, f := range b.freezes {
+		if f.OnWrite && f.Addr < 0x2000 && f.Addr&0x07FF == addr {
+			return f.Value
+		}
+	}
+	return data
+}
@@ -0,0 +1,51 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Bus_RAMFreezes(t *testing.T) {
+	bus := newTestBus()
+	mem := bus.newCpuMemory()
+
+	bus.SetRAMFreezes([]RAMFreeze{
+		{Addr: 0x0075, Value: 9},
+		{Addr: 0x0076, Value: 5, OnWrite: true},
+	})
+	assert.Equal(t, uint8(9), mem.Read8(0x0075), "the value is written when it is set")
+	assert.Equal(t, uint8(5), mem.Read8(0x0876), "the mirror of the RAM")
+
+	mem.Write8(0x0075, 8)
+	mem.Write8(0x0876, 4)
+	assert.Equal(t, uint8(8), mem.Read8(0x0075), "the value waits for the frame")
+	assert.Equal(t, uint8(5), mem.Read8(0x0076), "the write keeps the value")
+
+	bus.SetInput([4]Button{})
+	assert.Equal(t, uint8(9), mem.Read8(0x0075))
+
+	bus.SetRAMFreezes(nil)
+	mem.Write8(0x0076, 4)
+	assert.Equal(t, uint8(4), mem.Read8(0x0076))
+}
+
+type writeRecorder struct {
+	Mapper
+	writes []uint8
+}
+
+func (m *writeRecorder) Write8(addr uint16, data uint8) {
+	m.writes = append(m.writes, data)
+}
+
+func Test_Bus_RAMFreezes_Cartridge(t *testing.T) {
+	bus := newTestBus()
+	mem := bus.newCpuMemory()
+	mapper := &writeRecorder{Mapper: bus.cart.mapper}
+	bus.cart.mapper = mapper
+
+	bus.SetRAMFreezes([]RAMFreeze{{Addr: 0x6000, Value: 5, OnWrite: true}})
+	mem.Write8(0x6000, 4)
+	assert.Equal(t, []uint8{4}, mapper.writes, "the mapper gets the write unchanged")
+}
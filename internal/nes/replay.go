@@ -0,0 +1,108 @@
+package nes
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+)
+
+// ReplayTrace is what a replay of the movie produced: the hashes
+// of every frame and the RAM after the last one. The replays of
+// the same movie on the same ROM must produce the same traces
+type ReplayTrace struct {
+	Frames []ReplayFrame
+	RAM    [ramSizeBytes]uint8
+}
+
+// ReplayFrame is the hashes of the picture and of the RAM after the frame
+type ReplayFrame struct {
+	Picture uint64
+	RAM     uint64
+}
+
+// Replay plays the movie from its start in the read-only mode for
+// the frames and traces them, past the end of the movie the buttons
+// are released
+func (b *Bus) Replay(m *Movie, frames int) (*ReplayTrace, error) {
+	if err := b.PlayMovie(m, true); err != nil {
+		return nil, err
+	}
+	defer b.StopMovie()
+	t := &ReplayTrace{Frames: make([]ReplayFrame, 0, frames)}
+	for i := 0; i < frames; i++ {
+		b.SetInput([4]Button{})
+		b.RunFrame()
+		t.Frames = append(t.Frames, ReplayFrame{
+			Picture: b.ppu.FrameHash(),
+			RAM:     xxhash.Sum64(b.ram.ram[:]),
+		})
+	}
+	t.RAM = b.ram.ram
+	return t, nil
+}
+
+// Divergence returns the first frame the traces differ at, from 0,
+// and what differs. The frame is -1 for the same traces
+func (t *ReplayTrace) Divergence(other *ReplayTrace) (int, string) {
+	for i := range min(len(t.Frames), len(other.Frames)) {
+		a, b := t.Frames[i], other.Frames[i]
+		switch {
+		case a.RAM != b.RAM && a.Picture != b.Picture:
+			return i, "the RAM and the picture"
+		case a.RAM != b.RAM:
+			return i, "the RAM"
+		case a.Picture != b.Picture:
+			return i, "the picture"
+		}
+	}
+	if len(t.Frames) != len(other.Frames) {
+		return min(len(t.Frames), len(other.Frames)), "the number of frames"
+	}
+	if t.RAM != other.RAM {
+		return len(t.Frames), "the final RAM"
+	}
+	return -1, ""
+}
+
+// Write writes the trace as text: a line of the hashes of every frame,
+// then the final RAM in hex
+func (t *ReplayTrace) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range t.Frames {
+		fmt.Fprintf(bw, "%016x %016x\n", f.Picture, f.RAM)
+	}
+	fmt.Fprintf(bw, "ram %s\n", hex.EncodeToString(t.RAM[:]))
+	return bw.Flush()
+}
+
+// ReadReplayTrace reads the trace written by Write
+func ReadReplayTrace(r io.Reader) (*ReplayTrace, error) {
+	t := &ReplayTrace{}
+	scanner := bufio.NewScanner(r)
+	// the RAM is a long line
+	scanner.Buffer(nil, 8*ramSizeBytes)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if ram, ok := strings.CutPrefix(text, "ram "); ok {
+			data, err := hex.DecodeString(ram)
+			if err != nil || len(data) != ramSizeBytes {
+				return nil, fmt.Errorf("invalid RAM at the line %d", line)
+			}
+			copy(t.RAM[:], data)
+			return t, nil
+		}
+		var f ReplayFrame
+		if _, err := fmt.Sscanf(text, "%016x %016x", &f.Picture, &f.RAM); err != nil {
+			return nil, fmt.Errorf("invalid frame at the line %d: %s", line, err)
+		}
+		t.Frames = append(t.Frames, f)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't read the trace: %s", err)
+	}
+	return nil, fmt.Errorf("the trace has no RAM")
+}
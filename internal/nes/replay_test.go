@@ -0,0 +1,88 @@
+package nes
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Bus_Replay(t *testing.T) {
+	bus := newSnapshotBus()
+	m := bus.RecordMovie()
+	for i := 0; i < 5; i++ {
+		bus.SetInput([4]Button{Button(i)})
+		bus.RunFrame()
+	}
+	m.Resets = append(m.Resets, MovieReset{Frame: 3})
+
+	first, err := bus.Replay(m, 8)
+	require.NoError(t, err)
+	assert.Len(t, first.Frames, 8)
+	assert.Equal(t, bus.ram.ram, first.RAM)
+	_, mode, _ := bus.Movie()
+	assert.Equal(t, MovieOff, mode)
+
+	second, err := newSnapshotBus().Replay(m, 8)
+	require.NoError(t, err)
+	frame, _ := first.Divergence(second)
+	assert.Equal(t, -1, frame, "the replays run the same frames")
+
+	// the movie starting from a state
+	var state bytes.Buffer
+	require.NoError(t, bus.SaveState(&state))
+	m.State = state.Bytes()
+	first, err = bus.Replay(m, 4)
+	require.NoError(t, err)
+	second, err = newSnapshotBus().Replay(m, 4)
+	require.NoError(t, err)
+	frame, _ = first.Divergence(second)
+	assert.Equal(t, -1, frame)
+}
+
+func Test_ReplayTrace_Divergence(t *testing.T) {
+	trace := func() *ReplayTrace {
+		return &ReplayTrace{Frames: []ReplayFrame{{1, 2}, {3, 4}, {5, 6}}}
+	}
+	a, b := trace(), trace()
+	b.Frames[1].Picture = 0
+	b.Frames[2].RAM = 0
+	frame, what := a.Divergence(b)
+	assert.Equal(t, 1, frame)
+	assert.Equal(t, "the picture", what)
+
+	b = trace()
+	b.Frames[2].RAM = 0
+	frame, what = a.Divergence(b)
+	assert.Equal(t, 2, frame)
+	assert.Equal(t, "the RAM", what)
+
+	b = trace()
+	b.Frames = b.Frames[:2]
+	frame, what = a.Divergence(b)
+	assert.Equal(t, 2, frame)
+	assert.Equal(t, "the number of frames", what)
+
+	b = trace()
+	b.RAM[0x10] = 1
+	frame, what = a.Divergence(b)
+	assert.Equal(t, 3, frame)
+	assert.Equal(t, "the final RAM", what)
+}
+
+func Test_ReplayTrace_ReadWrite(t *testing.T) {
+	trace := &ReplayTrace{Frames: []ReplayFrame{{0x0123456789ABCDEF, 2}, {3, 0xFEDCBA9876543210}}}
+	trace.RAM[0x7FF] = 0xAB
+
+	var buf bytes.Buffer
+	require.NoError(t, trace.Write(&buf))
+	read, err := ReadReplayTrace(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, trace, read)
+
+	_, err = ReadReplayTrace(bytes.NewReader([]uint8("0123 x\n")))
+	assert.ErrorContains(t, err, "invalid frame at the line 1")
+	_, err = ReadReplayTrace(bytes.NewReader(nil))
+	assert.EqualError(t, err, "the trace has no RAM")
+}
@@ -0,0 +1,35 @@
+package nes
+
+import "slices"
+
+// ROMPatch replaces the byte the CPU reads from the cartridge at the
+// address, the way the Game Genie does. With the compare value the byte
+// is replaced only while the cartridge has that value at the address,
+// e.g. in the bank the code is for
+type ROMPatch struct {
+	Addr       uint16 // $8000-$FFFF
+	Value      uint8
+	Compare    uint8
+	HasCompare bool
+}
+
+// SetROMPatches sets the patches of the cartridge reads, nil removes them.
+// The cartridge stays as it is
+func (b *Bus) SetROMPatches(patches []ROMPatch) {
+	b.patches = slices.Clone(patches)
+}
+
+// ROMPatches returns the patches of the cartridge reads
+func (b *Bus) ROMPatches() []ROMPatch {
+	return slices.Clone(b.patches)
+}
+
+// patchRead returns the byte read from the cartridge with the patches
+func (b *Bus) patchRead(addr uint16, data uint8) uint8 {
+	for _, p := range b.patches {
+		if p.Addr == addr && (!p.HasCompare || p.Compare == data) {
+			return p.Value
+		}
+	}
+	return data
+}
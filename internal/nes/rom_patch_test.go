@@ -0,0 +1,30 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Bus_ROMPatches(t *testing.T) {
+	bus := newTestBus()
+	mem := bus.newCpuMemory()
+	bus.cart.pgrMem[0x0010] = 0x11
+	bus.cart.pgrMem[0x0020] = 0x22
+
+	bus.SetROMPatches([]ROMPatch{
+		{Addr: 0x8010, Value: 0xAA},
+		{Addr: 0x8020, Value: 0xBB, Compare: 0x33, HasCompare: true},
+	})
+	assert.Equal(t, uint8(0xAA), mem.Read8(0x8010))
+	assert.Equal(t, uint8(0x11), mem.Read8(0xC010), "the patch is of the CPU address")
+	assert.Equal(t, uint8(0x22), mem.Read8(0x8020), "the compare value differs")
+	assert.Equal(t, uint8(0xAA), bus.PeekMemory(0x8010))
+	assert.Equal(t, uint8(0x11), bus.cart.pgrMem[0x0010], "the cartridge stays")
+
+	bus.cart.pgrMem[0x0020] = 0x33
+	assert.Equal(t, uint8(0xBB), mem.Read8(0x8020))
+
+	bus.SetROMPatches(nil)
+	assert.Equal(t, uint8(0x11), mem.Read8(0x8010))
+}
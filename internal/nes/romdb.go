@@ -0,0 +1,19 @@
+package nes
+
+// romInfo is what the emulator knows about a particular game
+type romInfo struct {
+	name string
+
+	// The game relies on raster effects in the middle of a scanline
+	// or on exact sprite 0 hit timing, e.g. Battletoads, and is rendered
+	// wrong by the scanline renderer.
+	needsDotRenderer bool
+}
+
+// romDatabase maps the CRC32 of PRG and CHR ROM to the game info.
+// A game gets an entry once it is verified to need special handling.
+var romDatabase = map[uint32]romInfo{
+	// it splits the status bar from the playfield on sprite 0 hit,
+	// the hit at the end of the scanline moves the split a line down
+	0x3337EC46: {name: "Super Mario Bros.", needsDotRenderer: true},
+}
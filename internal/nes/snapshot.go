@@ -0,0 +1,81 @@
+package nes
+
+// Snapshot is the emulated state of the console kept in the memory,
+// e.g. for the run-ahead. Taking and restoring it only copies the state,
+// without allocations once the snapshot has its buffers.
+//
+// The host side is not a part of it: the video filter and the last
+// converted frame, the audio output settings, the devices plugged in
+// and the movie. The snapshot is restored into the console it was taken of
+type Snapshot struct {
+	cpu    CPU
+	ppu    PPU
+	apu    APU
+	ram    RAM
+	chrRAM []uint8
+
+	controllers [4]Controller
+	fourScore   fourScore
+	input       inputState
+	ticCounter  uint64
+	oamDMAEnd   uint64
+}
+
+// SaveSnapshot keeps the state of the console in the snapshot
+func (b *Bus) SaveSnapshot(s *Snapshot) {
+	s.cpu = *b.cpu
+	s.ppu = *b.ppu
+	s.apu = *b.apu
+	s.ram = *b.ram
+	s.chrRAM = s.chrRAM[:0]
+	if b.cart != nil && b.cart.chrRAM {
+		s.chrRAM = append(s.chrRAM, b.cart.chrMem...)
+	}
+
+	s.controllers = b.controllers
+	s.fourScore = b.fourScore
+	s.input = b.input
+	s.ticCounter = b.ticCounter
+	s.oamDMAEnd = b.oamDMAEnd
+}
+
+// LoadSnapshot restores the state kept in the snapshot
+func (b *Bus) LoadSnapshot(s *Snapshot) {
+	*b.cpu = s.cpu
+	b.ppu.restore(&s.ppu)
+	b.apu.restore(&s.apu)
+	*b.ram = s.ram
+	if b.cart != nil && b.cart.chrRAM {
+		copy(b.cart.chrMem, s.chrRAM)
+	}
+
+	b.controllers = s.controllers
+	b.fourScore = s.fourScore
+	b.input = s.input
+	b.ticCounter = s.ticCounter
+	b.oamDMAEnd = s.oamDMAEnd
+}
+
+// restore copies the emulated state of the snapshot, the host
+// settings and the converted frame stay
+func (p *PPU) restore(s *PPU) {
+	frame, filter, onFrame := p.frame, p.filter, p.onFrame
+	mode, noSpriteLimit := p.mode, p.noSpriteLimit
+	lastBlank, lastBlankColor := p.lastBlank, p.lastBlankColor
+	*p = *s
+	p.frame, p.filter, p.onFrame = frame, filter, onFrame
+	p.mode, p.noSpriteLimit = mode, noSpriteLimit
+	p.lastBlank, p.lastBlankColor = lastBlank, lastBlankColor
+}
+
+// restore copies the channels, the frame counter and the output levels
+// of the snapshot, so the sound continues from them without a click.
+// The output settings stay
+func (a *APU) restore(s *APU) {
+	a.triangle, a.dmc, a.frameCounter = s.triangle, s.dmc, s.frameCounter
+	a.stall, a.cycles = s.stall, s.cycles
+
+	ratio := a.resampler.ratio
+	a.resampler, a.filters, a.right = s.resampler, s.filters, s.right
+	a.resampler.ratio, a.right.resampler.ratio = ratio, ratio
+}
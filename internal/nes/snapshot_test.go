@@ -0,0 +1,78 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newSnapshotBus returns the console running a program which counts
+// the frames into $11 and shows the count as the backdrop color
+func newSnapshotBus() *Bus {
+	bus := newTestBus()
+	prg := bus.cart.pgrMem
+	copy(prg, []uint8{
+		0xA9, 0x80, 0x8D, 0x00, 0x20, // LDA #$80, STA $2000: NMI on
+		0xA9, 0x1E, 0x8D, 0x01, 0x20, // LDA #$1E, STA $2001: rendering on
+		0xE6, 0x10, // loop: INC $10
+		0x4C, 0x0A, 0x80, // JMP loop
+	})
+	copy(prg[0x20:], []uint8{
+		0xE6, 0x11, // NMI: INC $11
+		0xA9, 0x3F, 0x8D, 0x06, 0x20, // LDA #$3F, STA $2006
+		0xA9, 0x00, 0x8D, 0x06, 0x20, // LDA #$00, STA $2006
+		0xA5, 0x11, 0x8D, 0x07, 0x20, // LDA $11, STA $2007: the backdrop
+		0xA9, 0x00, 0x8D, 0x06, 0x20, 0x8D, 0x06, 0x20, // the address back to 0
+		0x40, // RTI
+	})
+	copy(prg[0x3FFA:], []uint8{0x20, 0x80, 0x00, 0x80, 0x00, 0x80})
+	bus.cart.chrRAM = true
+	bus.LoadCart(bus.cart)
+	bus.Reset()
+	return bus
+}
+
+func Test_Bus_LoadSnapshot(t *testing.T) {
+	bus := newSnapshotBus()
+	for i := 0; i < 5; i++ {
+		bus.RunFrame()
+	}
+
+	type frame struct {
+		hash   uint64
+		frames uint8
+		ram    [ramSizeBytes]uint8
+		dots   uint64
+	}
+	run := func() []frame {
+		var frames []frame
+		for i := 0; i < 3; i++ {
+			bus.SetInput([4]Button{Button(i)})
+			bus.cart.chrMem[i]++
+			bus.RunFrame()
+			frames = append(frames, frame{bus.ppu.FrameHash(), bus.ram.Read8(0x11), bus.ram.ram, bus.ppu.clock})
+		}
+		return frames
+	}
+
+	var s Snapshot
+	bus.SaveSnapshot(&s)
+	chr := append([]uint8(nil), bus.cart.chrMem...)
+	first := run()
+	assert.NotEqual(t, first[0].hash, first[1].hash, "the backdrop changes every frame")
+	bus.LoadSnapshot(&s)
+	assert.Equal(t, chr, bus.cart.chrMem, "the CHR RAM is restored")
+	assert.Equal(t, first, run(), "the restored console runs the same frames")
+}
+
+func Test_Bus_SaveSnapshot_Allocs(t *testing.T) {
+	bus := newSnapshotBus()
+	bus.RunFrame()
+	var s Snapshot
+	bus.SaveSnapshot(&s)
+	allocs := testing.AllocsPerRun(10, func() {
+		bus.SaveSnapshot(&s)
+		bus.LoadSnapshot(&s)
+	})
+	assert.Zero(t, allocs)
+}
@@ -0,0 +1,513 @@
+package nes
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// StateVersion is the version of the save state format:
+//
+//	header  "NSTS", the version uint16, the CRC32 of the game uint32 and,
+//	        from the version 3, the compression of the chunks uint8:
+//	        0: none, 1: zlib, the chunks are one zlib stream
+//	chunks  the id [4]byte, the length uint32 and the data of the length,
+//	        up to the "END " chunk of the length 0
+//
+// The numbers are little-endian, the structs are their fields in order
+// with a byte for a bool. The chunks are:
+//
+//	THMB  the thumbnail of the frame, ThumbnailWidth x ThumbnailHeight RGB
+//	CPU   the registers and the instruction in progress, cpuState
+//	PPU   the registers, the memories and the rendering pipeline, ppuState
+//	PIXL  the pixels being rendered and of the last frame, uint16 each
+//	APU   the channels and the frame counter, apuState
+//	RAM   the 2 KB of the work RAM
+//	CHR   the CHR RAM, only with the games with it
+//	MAPR  the registers of the mapper, only with the mappers with them
+//	BUS   the controller ports and the DMA in progress, busState
+//
+// The fields are only ever appended to the chunks: a longer chunk of
+// a newer version loads without its new fields, a shorter one of an older
+// version loads with the missing fields zeroed, and the unknown chunks are
+// skipped. The version 1 states, the sections without the chunk headers,
+// are migrated on load
+const StateVersion = 3
+
+var stateMagic = [4]byte{'N', 'S', 'T', 'S'}
+
+// ErrStateGame is returned when the save state is of another game
+var ErrStateGame = errors.New("the state is of another game")
+
+// stateHeader starts the save state file
+type stateHeader struct {
+	Magic   [4]byte
+	Version uint16
+	CRC     uint32 // the game the state is of
+}
+
+// the compression of the chunks
+const (
+	stateUncompressed uint8 = iota
+	stateZlib
+)
+
+// chunkHeader starts a chunk of the save state
+type chunkHeader struct {
+	ID     [4]byte
+	Length uint32
+}
+
+var chunkEnd = [4]byte{'E', 'N', 'D', ' '}
+
+// maxChunkLength keeps a corrupted length from taking the memory
+const maxChunkLength = 16 << 20
+
+// stateChunk is how a chunk is saved and loaded. The chunks not used
+// by the console, e.g. the CHR RAM of a game with CHR ROM, are not saved
+type stateChunk struct {
+	id       [4]byte
+	save     func(b *Bus, w io.Writer) error
+	load     func(b *Bus, data []uint8) error
+	used     func(b *Bus) bool // nil: used by every console
+	optional bool              // the states without the chunk load
+}
+
+var stateChunks = []stateChunk{
+	{
+		// the first one, it is read without the rest of the state
+		id:       chunkThumbnail,
+		save:     func(b *Bus, w io.Writer) error { return b.ppu.saveThumbnail(w) },
+		load:     func(b *Bus, data []uint8) error { return nil },
+		optional: true,
+	},
+	{
+		id:   [4]byte{'C', 'P', 'U', ' '},
+		save: func(b *Bus, w io.Writer) error { return b.cpu.SaveState(w) },
+		load: func(b *Bus, data []uint8) error { return b.cpu.LoadState(chunkReader(data)) },
+	},
+	{
+		id:   [4]byte{'P', 'P', 'U', ' '},
+		save: func(b *Bus, w io.Writer) error { return b.ppu.saveRegisters(w) },
+		load: func(b *Bus, data []uint8) error { return b.ppu.loadRegisters(chunkReader(data)) },
+	},
+	{
+		id:       [4]byte{'P', 'I', 'X', 'L'},
+		save:     func(b *Bus, w io.Writer) error { return b.ppu.savePixels(w) },
+		load:     func(b *Bus, data []uint8) error { return b.ppu.loadPixels(chunkReader(data)) },
+		optional: true,
+	},
+	{
+		id:   [4]byte{'A', 'P', 'U', ' '},
+		save: func(b *Bus, w io.Writer) error { return b.apu.SaveState(w) },
+		load: func(b *Bus, data []uint8) error { return b.apu.LoadState(chunkReader(data)) },
+	},
+	{
+		id: [4]byte{'R', 'A', 'M', ' '},
+		save: func(b *Bus, w io.Writer) error {
+			_, err := w.Write(b.ram.ram[:])
+			return err
+		},
+		load: func(b *Bus, data []uint8) error {
+			_, err := io.ReadFull(chunkReader(data), b.ram.ram[:])
+			return err
+		},
+	},
+	{
+		id: [4]byte{'C', 'H', 'R', ' '},
+		save: func(b *Bus, w io.Writer) error {
+			_, err := w.Write(b.cart.chrMem)
+			return err
+		},
+		load: func(b *Bus, data []uint8) error {
+			if len(data) != len(b.cart.chrMem) {
+				return errors.New("the CHR RAM of the state doesn't match the game")
+			}
+			copy(b.cart.chrMem, data)
+			return nil
+		},
+		used: func(b *Bus) bool { return b.cart.chrRAM },
+	},
+	{
+		id:   [4]byte{'M', 'A', 'P', 'R'},
+		save: func(b *Bus, w io.Writer) error { return b.cart.mapper.(MapperState).SaveState(w) },
+		load: func(b *Bus, data []uint8) error {
+			return b.cart.mapper.(MapperState).LoadState(chunkReader(data))
+		},
+		used: func(b *Bus) bool {
+			_, ok := b.cart.mapper.(MapperState)
+			return ok
+		},
+		optional: true,
+	},
+	{
+		id:   [4]byte{'B', 'U', 'S', ' '},
+		save: (*Bus).savePorts,
+		load: func(b *Bus, data []uint8) error { return b.loadPorts(chunkReader(data)) },
+	},
+}
+
+// chunkReader reads the data of the chunk, past its end it reads zeros,
+// the fields missing from the chunks of the older versions
+func chunkReader(data []uint8) io.Reader {
+	return io.MultiReader(bytes.NewReader(data), zeroReader{})
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// busState is the state of the console outside of the chips:
+// the controller ports and the DMA in progress. The devices plugged
+// in are the host settings and stay as they are
+type busState struct {
+	Controllers [4]struct {
+		Buttons uint8
+		Shift   uint8
+		Strobe  bool
+	}
+	FourScoreShift  [2]uint32
+	FourScoreStrobe bool
+
+	Input struct {
+		Buttons   [4]uint8
+		Frames    int64
+		Polled    bool
+		Lag       bool
+		LagFrames int64
+	}
+
+	TicCounter uint64
+	OAMDMAEnd  uint64
+}
+
+// MapperState is implemented by the mappers with the registers
+// or the memory of their own, the save states include it
+type MapperState interface {
+	SaveState(w io.Writer) error
+	LoadState(r io.Reader) error
+}
+
+// SaveState writes the state of the console to w. The state is exact
+// at any dot, it may be saved and loaded in the middle of a frame.
+// The host side is not a part of it: the video filter, the audio output
+// settings, the devices plugged in and the movie. The chunks aren't
+// compressed, the states kept in the memory are compared byte by byte
+func (b *Bus) SaveState(w io.Writer) error {
+	return b.saveState(w, stateUncompressed)
+}
+
+// SaveStateCompressed writes the state like SaveState
+// with the chunks compressed, the way the state files are
+func (b *Bus) SaveStateCompressed(w io.Writer) error {
+	return b.saveState(w, stateZlib)
+}
+
+func (b *Bus) saveState(w io.Writer, compression uint8) error {
+	if b.cart == nil {
+		return errors.New("no game is loaded")
+	}
+	header := stateHeader{Magic: stateMagic, Version: StateVersion, CRC: b.cart.crc}
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("couldn't write the state header: %s", err)
+	}
+	if err := binary.Write(w, binary.LittleEndian, compression); err != nil {
+		return fmt.Errorf("couldn't write the state header: %s", err)
+	}
+	if compression == stateZlib {
+		zw := zlib.NewWriter(w)
+		if err := b.saveChunks(zw); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("couldn't compress the state: %s", err)
+		}
+		return nil
+	}
+	return b.saveChunks(w)
+}
+
+// saveChunks writes the chunks used by the console and the END chunk
+func (b *Bus) saveChunks(w io.Writer) error {
+	var data bytes.Buffer
+	for _, c := range stateChunks {
+		if c.used != nil && !c.used(b) {
+			continue
+		}
+		data.Reset()
+		if err := c.save(b, &data); err != nil {
+			return err
+		}
+		if err := writeChunk(w, c.id, data.Bytes()); err != nil {
+			return err
+		}
+	}
+	return writeChunk(w, chunkEnd, nil)
+}
+
+func writeChunk(w io.Writer, id [4]byte, data []uint8) error {
+	header := chunkHeader{ID: id, Length: uint32(len(data))}
+	if err := binary.Write(w, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("couldn't write the %q chunk: %s", id[:], err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("couldn't write the %q chunk: %s", id[:], err)
+	}
+	return nil
+}
+
+// LoadState reads the state written by SaveState or SaveStateCompressed.
+// The state must be of the loaded game. A state which couldn't be read
+// leaves the console as it was
+func (b *Bus) LoadState(r io.Reader) error {
+	if b.cart == nil {
+		return errors.New("no game is loaded")
+	}
+	header, compression, chunks, err := readStateHeader(r)
+	if err != nil {
+		return err
+	}
+	if header.CRC != b.cart.crc {
+		return ErrStateGame
+	}
+
+	load := b.loadChunks
+	if header.Version == 1 {
+		load = b.loadStateV1
+	}
+	var backup Snapshot
+	b.SaveSnapshot(&backup)
+	err = load(chunks)
+	if compression == stateZlib && err == nil {
+		// the checksum is past the END chunk
+		if _, err = io.Copy(io.Discard, chunks); err != nil {
+			err = fmt.Errorf("couldn't decompress the state: %s", err)
+		}
+	}
+	if err != nil {
+		b.LoadSnapshot(&backup)
+		b.ppu.redrawFrame()
+		return err
+	}
+	return nil
+}
+
+// readStateHeader reads the header of the state and returns
+// the compression and the reader of the decompressed chunks
+func readStateHeader(r io.Reader) (stateHeader, uint8, io.Reader, error) {
+	var header stateHeader
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return header, 0, nil, fmt.Errorf("couldn't read the state header: %s", err)
+	}
+	if header.Magic != stateMagic {
+		return header, 0, nil, errors.New("not a save state")
+	}
+	if header.Version == 0 {
+		return header, 0, nil, fmt.Errorf("invalid state version %d", header.Version)
+	}
+	compression := stateUncompressed
+	if header.Version >= 3 {
+		if err := binary.Read(r, binary.LittleEndian, &compression); err != nil {
+			return header, 0, nil, fmt.Errorf("couldn't read the state header: %s", err)
+		}
+	}
+	switch compression {
+	case stateUncompressed:
+		return header, compression, r, nil
+	case stateZlib:
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return header, 0, nil, fmt.Errorf("couldn't decompress the state: %s", err)
+		}
+		return header, compression, zr, nil
+	}
+	return header, 0, nil, fmt.Errorf("unknown state compression %d", compression)
+}
+
+// loadChunks reads the chunks up to the END chunk
+func (b *Bus) loadChunks(r io.Reader) error {
+	loaded := make([]bool, len(stateChunks))
+	var data []uint8
+	for {
+		var header chunkHeader
+		if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+			return fmt.Errorf("couldn't read the chunk header: %s", err)
+		}
+		if header.ID == chunkEnd {
+			break
+		}
+		if header.Length > maxChunkLength {
+			return fmt.Errorf("the %q chunk is too long", header.ID[:])
+		}
+		// the chunk is read before it's known, so the unknown ones are skipped
+		if cap(data) < int(header.Length) {
+			data = make([]uint8, header.Length)
+		}
+		data = data[:header.Length]
+		if _, err := io.ReadFull(r, data); err != nil {
+			return fmt.Errorf("couldn't read the %q chunk: %s", header.ID[:], err)
+		}
+		for i, c := range stateChunks {
+			if c.id != header.ID || c.used != nil && !c.used(b) {
+				continue
+			}
+			if err := c.load(b, data); err != nil {
+				return fmt.Errorf("couldn't load the %q chunk: %s", c.id[:], err)
+			}
+			loaded[i] = true
+		}
+	}
+	for i, c := range stateChunks {
+		if !loaded[i] && !c.optional && (c.used == nil || c.used(b)) {
+			return fmt.Errorf("the state has no %q chunk", c.id[:])
+		}
+	}
+	return nil
+}
+
+// loadStateV1 reads the sections of the version 1 state one after another
+func (b *Bus) loadStateV1(r io.Reader) error {
+	if err := b.cpu.LoadState(r); err != nil {
+		return err
+	}
+	if err := b.ppu.LoadState(r); err != nil {
+		return err
+	}
+	if err := b.apu.LoadState(r); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(r, b.ram.ram[:]); err != nil {
+		return fmt.Errorf("couldn't read the RAM: %s", err)
+	}
+	var chrSize uint32
+	if err := binary.Read(r, binary.LittleEndian, &chrSize); err != nil {
+		return fmt.Errorf("couldn't read the CHR RAM: %s", err)
+	}
+	if b.cart.chrRAM != (chrSize > 0) || b.cart.chrRAM && int(chrSize) != len(b.cart.chrMem) {
+		return errors.New("the CHR RAM of the state doesn't match the game")
+	}
+	if b.cart.chrRAM {
+		if _, err := io.ReadFull(r, b.cart.chrMem); err != nil {
+			return fmt.Errorf("couldn't read the CHR RAM: %s", err)
+		}
+	}
+	if m, ok := b.cart.mapper.(MapperState); ok {
+		if err := m.LoadState(r); err != nil {
+			return err
+		}
+	}
+	return b.loadPorts(r)
+}
+
+// savePorts writes the controller ports and the DMA in progress
+func (b *Bus) savePorts(w io.Writer) error {
+	var s busState
+	for i, c := range b.controllers {
+		s.Controllers[i].Buttons = uint8(c.buttons)
+		s.Controllers[i].Shift = c.shift
+		s.Controllers[i].Strobe = c.strobe
+	}
+	s.FourScoreShift = b.fourScore.shift
+	s.FourScoreStrobe = b.fourScore.strobe
+	for i, buttons := range b.input.buttons {
+		s.Input.Buttons[i] = uint8(buttons)
+	}
+	s.Input.Frames = int64(b.input.frames)
+	s.Input.Polled = b.input.polled
+	s.Input.Lag = b.input.lag
+	s.Input.LagFrames = int64(b.input.lagFrames)
+	s.TicCounter = b.ticCounter
+	s.OAMDMAEnd = b.oamDMAEnd
+	if err := binary.Write(w, binary.LittleEndian, &s); err != nil {
+		return fmt.Errorf("couldn't write the controllers state: %s", err)
+	}
+	return nil
+}
+
+// loadPorts reads the state written by savePorts
+func (b *Bus) loadPorts(r io.Reader) error {
+	var s busState
+	if err := binary.Read(r, binary.LittleEndian, &s); err != nil {
+		return fmt.Errorf("couldn't read the controllers state: %s", err)
+	}
+	for i := range b.controllers {
+		c := &b.controllers[i]
+		c.buttons = Button(s.Controllers[i].Buttons)
+		c.shift = s.Controllers[i].Shift
+		c.strobe = s.Controllers[i].Strobe
+	}
+	b.fourScore.shift = s.FourScoreShift
+	b.fourScore.strobe = s.FourScoreStrobe
+	for i, buttons := range s.Input.Buttons {
+		b.input.buttons[i] = Button(buttons)
+	}
+	b.input.frames = int(s.Input.Frames)
+	b.input.polled = s.Input.Polled
+	b.input.lag = s.Input.Lag
+	b.input.lagFrames = int(s.Input.LagFrames)
+	b.ticCounter = s.TicCounter
+	b.oamDMAEnd = s.OAMDMAEnd
+	return nil
+}
+
+// SaveStateFile writes the state of the console to the file. The state
+// is written next to it and then renamed over it, so the crash while
+// saving keeps the previous state
+func (b *Bus) SaveStateFile(path string) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("couldn't create the state file: %s", err)
+	}
+	if err := b.writeStateFile(file); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("couldn't write the state file: %s", err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		os.Remove(file.Name())
+		return fmt.Errorf("couldn't replace the state file: %s", err)
+	}
+	return nil
+}
+
+// writeStateFile writes the state to the file and syncs it to the disk
+func (b *Bus) writeStateFile(file *os.File) error {
+	w := bufio.NewWriter(file)
+	if err := b.SaveStateCompressed(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("couldn't write the state file: %s", err)
+	}
+	// the temporary file is created only readable by the user
+	if err := file.Chmod(0o644); err != nil {
+		return fmt.Errorf("couldn't write the state file: %s", err)
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("couldn't write the state file: %s", err)
+	}
+	return nil
+}
+
+// LoadStateFile reads the state of the console from the file
+func (b *Bus) LoadStateFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("couldn't open the state file: %s", err)
+	}
+	defer file.Close()
+	return b.LoadState(bufio.NewReader(file))
+}
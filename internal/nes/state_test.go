@@ -0,0 +1,269 @@
+package nes
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Bus_SaveState(t *testing.T) {
+	bus := newSnapshotBus()
+	for i := 0; i < 5; i++ {
+		bus.RunFrame()
+	}
+	// in the middle of a frame and of an instruction
+	for i := 0; i < 12345; i++ {
+		bus.Tic()
+	}
+
+	type frame struct {
+		hash   uint64
+		frames uint8
+		ram    [ramSizeBytes]uint8
+		dots   uint64
+		pc     uint16
+	}
+	run := func(bus *Bus) []frame {
+		var frames []frame
+		for i := 0; i < 3; i++ {
+			bus.SetInput([4]Button{Button(i)})
+			bus.cart.chrMem[i]++
+			bus.RunFrame()
+			frames = append(frames, frame{bus.ppu.FrameHash(), bus.ram.Read8(0x11), bus.ram.ram, bus.ppu.clock, bus.cpu.pc})
+		}
+		return frames
+	}
+
+	var state bytes.Buffer
+	require.NoError(t, bus.SaveState(&state))
+	saved := state.Bytes()
+	first := run(bus)
+
+	// the state is loaded into a console just powered on
+	other := newSnapshotBus()
+	require.NoError(t, other.LoadState(bytes.NewReader(saved)))
+	assert.Equal(t, first, run(other), "the loaded console runs the same frames")
+
+	require.NoError(t, bus.LoadState(bytes.NewReader(saved)))
+	assert.Equal(t, first, run(bus))
+}
+
+func Test_Bus_LoadState_Frame(t *testing.T) {
+	bus := newSnapshotBus()
+	for i := 0; i < 4; i++ {
+		bus.RunFrame()
+	}
+	var state bytes.Buffer
+	require.NoError(t, bus.SaveState(&state))
+	hash := bus.ppu.FrameHash()
+	pixels := bytes.Clone(bus.ppu.Frame().Pix)
+
+	other := newSnapshotBus()
+	require.NoError(t, other.LoadState(&state))
+	assert.Equal(t, hash, other.ppu.FrameHash())
+	assert.Equal(t, pixels, other.ppu.Frame().Pix, "the picture shows the loaded state")
+}
+
+func Test_Bus_LoadState_Errors(t *testing.T) {
+	bus := newSnapshotBus()
+	bus.RunFrame()
+	var state bytes.Buffer
+	require.NoError(t, bus.SaveState(&state))
+	saved := state.Bytes()
+
+	tests := []struct {
+		name  string
+		state func() []uint8
+		err   string
+	}{
+		{"not a state", func() []uint8 { return []uint8("NES\x1a0123456789") }, "not a save state"},
+		{"version", func() []uint8 {
+			s := bytes.Clone(saved)
+			s[4] = 0
+			return s
+		}, "invalid state version 0"},
+		{"game", func() []uint8 {
+			s := bytes.Clone(saved)
+			s[6] ^= 0xFF
+			return s
+		}, ErrStateGame.Error()},
+		{"truncated", func() []uint8 { return saved[:len(saved)-10] }, `couldn't read the "BUS " chunk: unexpected EOF`},
+		{"no chunk", func() []uint8 { return withoutChunk(saved, "APU ") }, `the state has no "APU " chunk`},
+		{"chunk length", func() []uint8 {
+			s := bytes.Clone(saved)
+			binary.LittleEndian.PutUint32(s[15:], maxChunkLength+1)
+			return s
+		}, `the "THMB" chunk is too long`},
+		{"truncated header", func() []uint8 { return saved[:5] }, "couldn't read the state header: unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus.RunFrame()
+			var s Snapshot
+			bus.SaveSnapshot(&s)
+			ram, clock := bus.ram.ram, bus.ppu.clock
+
+			err := bus.LoadState(bytes.NewReader(tt.state()))
+			assert.EqualError(t, err, tt.err)
+			assert.Equal(t, ram, bus.ram.ram, "the console stays as it was")
+			assert.Equal(t, clock, bus.ppu.clock)
+		})
+	}
+}
+
+// stateChunksOf splits the state into its header and chunks
+func stateChunksOf(t *testing.T, state []uint8) ([]uint8, map[string][]uint8, []string) {
+	header, rest := state[:11], state[11:]
+	chunks := map[string][]uint8{}
+	var order []string
+	for {
+		require.GreaterOrEqual(t, len(rest), 8)
+		id, length := string(rest[:4]), binary.LittleEndian.Uint32(rest[4:])
+		if id == "END " {
+			return header, chunks, order
+		}
+		chunks[id] = rest[8 : 8+length]
+		order = append(order, id)
+		rest = rest[8+length:]
+	}
+}
+
+func withoutChunk(state []uint8, id string) []uint8 {
+	i := bytes.Index(state, []uint8(id))
+	length := binary.LittleEndian.Uint32(state[i+4:])
+	return append(bytes.Clone(state[:i]), state[i+8+int(length):]...)
+}
+
+func Test_Bus_LoadState_Versions(t *testing.T) {
+	bus := newSnapshotBus()
+	for i := 0; i < 3; i++ {
+		bus.RunFrame()
+	}
+	var state bytes.Buffer
+	require.NoError(t, bus.SaveState(&state))
+	header, chunks, order := stateChunksOf(t, state.Bytes())
+	ram, clock, hash := bus.ram.ram, bus.ppu.clock, bus.ppu.FrameHash()
+
+	check := func(t *testing.T, state []uint8) {
+		other := newSnapshotBus()
+		require.NoError(t, other.LoadState(bytes.NewReader(state)))
+		assert.Equal(t, ram, other.ram.ram)
+		assert.Equal(t, clock, other.ppu.clock)
+		assert.Equal(t, hash, other.ppu.FrameHash())
+	}
+
+	t.Run("newer", func(t *testing.T) {
+		// a newer version has the chunks unknown here and the fields appended
+		s := bytes.Clone(header)
+		binary.LittleEndian.PutUint16(s[4:], StateVersion+1)
+		for _, id := range append([]string{"NEW "}, order...) {
+			data := append(bytes.Clone(chunks[id]), 1, 2, 3)
+			if id == "RAM " || id == "CHR " {
+				data = chunks[id]
+			}
+			s = binary.LittleEndian.AppendUint32(append(s, id...), uint32(len(data)))
+			s = append(s, data...)
+		}
+		check(t, append(s, "END \x00\x00\x00\x00"...))
+	})
+	t.Run("without optional", func(t *testing.T) {
+		other := newSnapshotBus()
+		require.NoError(t, other.LoadState(bytes.NewReader(withoutChunk(state.Bytes(), "PIXL"))))
+		assert.Equal(t, clock, other.ppu.clock)
+	})
+	t.Run("version 1", func(t *testing.T) {
+		// the sections one after another, the CHR RAM with its length
+		var s bytes.Buffer
+		v1 := bytes.Clone(header[:10])
+		binary.LittleEndian.PutUint16(v1[4:], 1)
+		s.Write(v1)
+		require.NoError(t, bus.cpu.SaveState(&s))
+		require.NoError(t, bus.ppu.SaveState(&s))
+		require.NoError(t, bus.apu.SaveState(&s))
+		s.Write(bus.ram.ram[:])
+		var chr []uint8
+		if bus.cart.chrRAM {
+			chr = bus.cart.chrMem
+		}
+		require.NoError(t, binary.Write(&s, binary.LittleEndian, uint32(len(chr))))
+		s.Write(chr)
+		require.NoError(t, bus.savePorts(&s))
+		check(t, s.Bytes())
+		assert.Error(t, newSnapshotBus().LoadState(bytes.NewReader(s.Bytes()[:s.Len()/2])))
+	})
+}
+
+func Test_Bus_SaveStateFile(t *testing.T) {
+	bus := newSnapshotBus()
+	bus.RunFrame()
+	path := filepath.Join(t.TempDir(), "game.state")
+	require.NoError(t, bus.SaveStateFile(path))
+	clock := bus.ppu.clock
+
+	bus.RunFrame()
+	require.NoError(t, bus.LoadStateFile(path))
+	assert.Equal(t, clock, bus.ppu.clock)
+	assert.ErrorContains(t, bus.LoadStateFile(filepath.Join(t.TempDir(), "none.state")), "couldn't open the state file")
+
+	// the state is replaced whole, without the temporary file left
+	bus.RunFrame()
+	require.NoError(t, bus.SaveStateFile(path))
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+	}
+	require.NoError(t, bus.LoadStateFile(path))
+	assert.NotEqual(t, clock, bus.ppu.clock)
+	assert.Error(t, bus.SaveStateFile(filepath.Join(t.TempDir(), "none", "game.state")))
+}
+
+func Test_Bus_SaveStateCompressed(t *testing.T) {
+	bus := newSnapshotBus()
+	for i := 0; i < 3; i++ {
+		bus.RunFrame()
+	}
+	var raw, compressed bytes.Buffer
+	require.NoError(t, bus.SaveState(&raw))
+	require.NoError(t, bus.SaveStateCompressed(&compressed))
+	assert.Less(t, compressed.Len(), raw.Len()/4)
+	ram, clock := bus.ram.ram, bus.ppu.clock
+
+	other := newSnapshotBus()
+	require.NoError(t, other.LoadState(bytes.NewReader(compressed.Bytes())))
+	assert.Equal(t, ram, other.ram.ram)
+	assert.Equal(t, clock, other.ppu.clock)
+	thumb, err := ReadStateThumbnail(bytes.NewReader(compressed.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, ThumbnailWidth, thumb.Rect.Dx())
+
+	t.Run("version 2", func(t *testing.T) {
+		// the header without the compression
+		s := append(bytes.Clone(raw.Bytes()[:10]), raw.Bytes()[11:]...)
+		binary.LittleEndian.PutUint16(s[4:], 2)
+		other := newSnapshotBus()
+		require.NoError(t, other.LoadState(bytes.NewReader(s)))
+		assert.Equal(t, clock, other.ppu.clock)
+	})
+	t.Run("checksum", func(t *testing.T) {
+		s := bytes.Clone(compressed.Bytes())
+		s[len(s)-1] ^= 0xFF
+		other := newSnapshotBus()
+		assert.EqualError(t, other.LoadState(bytes.NewReader(s)), "couldn't decompress the state: zlib: invalid checksum")
+		assert.NotEqual(t, clock, other.ppu.clock, "the console stays as it was")
+	})
+	t.Run("compression", func(t *testing.T) {
+		s := bytes.Clone(raw.Bytes())
+		s[10] = 7
+		assert.EqualError(t, newSnapshotBus().LoadState(bytes.NewReader(s)), "unknown state compression 7")
+	})
+}
@@ -0,0 +1,88 @@
+package nes
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+// the size of the thumbnail of the save states, a quarter of the frame
+const (
+	ThumbnailWidth  = FrameWidth / 4
+	ThumbnailHeight = FrameHeight / 4
+)
+
+// ErrNoThumbnail is returned for the save states without the thumbnail,
+// e.g. of the version 1
+var ErrNoThumbnail = errors.New("the state has no thumbnail")
+
+var chunkThumbnail = [4]byte{'T', 'H', 'M', 'B'}
+
+// saveThumbnail writes the last frame downscaled to the thumbnail size
+// as RGB, every pixel is the average of the 4x4 pixels of the frame
+func (p *PPU) saveThumbnail(w io.Writer) error {
+	frame := p.frame
+	data := make([]uint8, 0, ThumbnailWidth*ThumbnailHeight*3)
+	for ty := 0; ty < ThumbnailHeight; ty++ {
+		for tx := 0; tx < ThumbnailWidth; tx++ {
+			var sum [3]int
+			for y := ty * 4; y < ty*4+4; y++ {
+				i := frame.PixOffset(tx*4, y)
+				for x := 0; x < 4; x++ {
+					for c := range sum {
+						sum[c] += int(frame.Pix[i+x*4+c])
+					}
+				}
+			}
+			data = append(data, uint8(sum[0]/16), uint8(sum[1]/16), uint8(sum[2]/16))
+		}
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// ReadStateThumbnail reads the thumbnail of the save state written
+// by SaveState or SaveStateCompressed, the state isn't loaded. It is
+// of the frame the state was saved at, ThumbnailWidth x ThumbnailHeight
+func ReadStateThumbnail(r io.Reader) (*image.RGBA, error) {
+	header, _, r, err := readStateHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if header.Version < 2 {
+		return nil, ErrNoThumbnail
+	}
+	for {
+		var chunk chunkHeader
+		if err := binary.Read(r, binary.LittleEndian, &chunk); err != nil {
+			return nil, fmt.Errorf("couldn't read the chunk header: %s", err)
+		}
+		switch chunk.ID {
+		case chunkEnd:
+			return nil, ErrNoThumbnail
+		case chunkThumbnail:
+			return readThumbnail(r, chunk.Length)
+		}
+		if _, err := io.CopyN(io.Discard, r, int64(chunk.Length)); err != nil {
+			return nil, fmt.Errorf("couldn't read the %q chunk: %s", chunk.ID[:], err)
+		}
+	}
+}
+
+func readThumbnail(r io.Reader, length uint32) (*image.RGBA, error) {
+	if length < ThumbnailWidth*ThumbnailHeight*3 {
+		return nil, errors.New("the thumbnail is corrupted")
+	}
+	data := make([]uint8, ThumbnailWidth*ThumbnailHeight*3)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("couldn't read the thumbnail: %s", err)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, ThumbnailWidth, ThumbnailHeight))
+	for i := 0; i < ThumbnailWidth*ThumbnailHeight; i++ {
+		copy(img.Pix[i*4:], data[i*3:i*3+3])
+		img.Pix[i*4+3] = 0xFF
+	}
+	return img, nil
+}
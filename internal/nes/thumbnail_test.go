@@ -0,0 +1,37 @@
+package nes
+
+import (
+	"bytes"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ReadStateThumbnail(t *testing.T) {
+	bus := newSnapshotBus()
+	bus.RunFrame()
+	frame := bus.ppu.Frame()
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			frame.Set(x, y, color.RGBA{uint8(x * 16), 0x80, uint8(y * 4), 0xFF})
+		}
+	}
+	var state bytes.Buffer
+	require.NoError(t, bus.SaveState(&state))
+
+	thumb, err := ReadStateThumbnail(bytes.NewReader(state.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, ThumbnailWidth, thumb.Rect.Dx())
+	assert.Equal(t, ThumbnailHeight, thumb.Rect.Dy())
+	assert.Equal(t, color.RGBA{24, 0x80, 6, 0xFF}, thumb.At(0, 0), "the average of the 4x4 pixels")
+
+	other := newSnapshotBus()
+	require.NoError(t, other.LoadState(bytes.NewReader(state.Bytes())), "the thumbnail is skipped on load")
+
+	_, err = ReadStateThumbnail(bytes.NewReader(withoutChunk(state.Bytes(), "THMB")))
+	assert.ErrorIs(t, err, ErrNoThumbnail)
+	_, err = ReadStateThumbnail(bytes.NewReader([]uint8("NES\x1a0123456789")))
+	assert.EqualError(t, err, "not a save state")
+}
@@ -0,0 +1,264 @@
+package nes
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// the trace formats of the other emulators, their names stand
+// for them in ParseTraceFormat
+var traceFormats = map[string]string{
+	"mesen": "[PC,4h]  [ByteCode,11][Disassembly][EffectiveAddress][MemoryValue,h][Align,48] " +
+		"A:[A,2h] X:[X,2h] Y:[Y,2h] S:[SP,2h] P:[P,8] V:[Scanline,3] H:[Cycle,3] Fr:[FrameCount] Cycle:[CycleCount]",
+	"fceux": "A:[A,2h] X:[X,2h] Y:[Y,2h] S:[SP,2h] P:[P,8]  $[PC,4h]:[ByteCode,10][Disassembly][EffectiveAddress][MemoryValue,#]",
+}
+
+// the tags of the trace formats
+const (
+	traceText = iota
+	tracePC
+	traceLabel
+	traceA
+	traceX
+	traceY
+	traceSP
+	traceP
+	traceByteCode
+	traceDisassembly
+	traceEffectiveAddress
+	traceMemoryValue
+	traceAlign
+	traceScanline
+	traceCycle
+	traceFrameCount
+	traceCycleCount
+)
+
+var traceTags = map[string]int{
+	"PC": tracePC, "Label": traceLabel, "A": traceA, "X": traceX, "Y": traceY, "SP": traceSP, "P": traceP,
+	"ByteCode": traceByteCode, "Disassembly": traceDisassembly,
+	"EffectiveAddress": traceEffectiveAddress, "MemoryValue": traceMemoryValue,
+	"Align": traceAlign, "Scanline": traceScanline, "Cycle": traceCycle,
+	"FrameCount": traceFrameCount, "CycleCount": traceCycleCount,
+}
+
+type tracePart struct {
+	tag   int
+	text  string
+	width int  // the numbers are padded to it, the text is aligned to it
+	hex   bool // h: the number is hex
+	flags bool // P,8: the flags are the letters, the set ones are capital
+	hash  bool // MemoryValue,#: the value is #$XX, the way FCEUX shows it
+}
+
+// TraceFormat is the template of the trace log lines, the way Mesen
+// sets it: the tags in the brackets are replaced by the state of the
+// console before every instruction, the rest is copied as it is.
+//
+//	[PC,4h] [Disassembly][Align,24] A:[A,2h] CYC:[CycleCount]
+//
+// The tags are PC, Label (of the PC), A, X, Y, SP, P, ByteCode,
+// Disassembly, EffectiveAddress ( @ $0203 of the indexed modes),
+// MemoryValue ( = $00 of the memory the instruction accesses),
+// Scanline, Cycle (the PPU dot), FrameCount and CycleCount (the CPU
+// cycles). After the comma, Nh is N hex digits, N pads the number or
+// the text to N characters, and P,8 is the letters of the flags.
+// Align,N pads the line to the column N
+type TraceFormat struct {
+	parts []tracePart
+}
+
+// ParseTraceFormat parses the template, or returns the format of the
+// other emulator by its name: mesen or fceux
+func ParseTraceFormat(template string) (*TraceFormat, error) {
+	if preset, ok := traceFormats[template]; ok {
+		template = preset
+	}
+	f := &TraceFormat{}
+	for template != "" {
+		open := strings.IndexByte(template, '[')
+		if open < 0 {
+			f.parts = append(f.parts, tracePart{tag: traceText, text: template})
+			break
+		}
+		if open > 0 {
+			f.parts = append(f.parts, tracePart{tag: traceText, text: template[:open]})
+		}
+		end := strings.IndexByte(template[open:], ']')
+		if end < 0 {
+			return nil, fmt.Errorf("the trace format has an unclosed [")
+		}
+		part, err := parseTracePart(template[open+1 : open+end])
+		if err != nil {
+			return nil, err
+		}
+		f.parts = append(f.parts, part)
+		template = template[open+end+1:]
+	}
+	return f, nil
+}
+
+func parseTracePart(s string) (tracePart, error) {
+	name, spec, _ := strings.Cut(s, ",")
+	tag, ok := traceTags[strings.TrimSpace(name)]
+	if !ok {
+		return tracePart{}, fmt.Errorf("unknown trace tag %q", name)
+	}
+	p := tracePart{tag: tag}
+	spec = strings.TrimSpace(spec)
+	if strings.HasSuffix(spec, "#") {
+		p.hash, spec = true, strings.TrimSuffix(spec, "#")
+	}
+	if strings.HasSuffix(spec, "h") {
+		p.hex, spec = true, strings.TrimSuffix(spec, "h")
+	}
+	if spec != "" {
+		width, err := strconv.Atoi(spec)
+		if err != nil || width < 0 {
+			return tracePart{}, fmt.Errorf("invalid width %q of the trace tag %s", spec, name)
+		}
+		p.width = width
+	}
+	p.flags = tag == traceP && !p.hex && p.width == 8
+	return p, nil
+}
+
+// tracer writes the trace log
+type tracer struct {
+	w      *bufio.Writer
+	format *TraceFormat
+	line   []byte
+	err    error // the first write error, the log stops at it
+}
+
+// StartTrace writes the line of the format to w before every
+// instruction the CPU runs, until StopTrace. The console runs
+// much slower while tracing
+func (b *Bus) StartTrace(w io.Writer, format *TraceFormat) {
+	b.trace = &tracer{w: bufio.NewWriter(w), format: format}
+}
+
+// StopTrace stops the trace log and returns the error of writing it
+func (b *Bus) StopTrace() error {
+	t := b.trace
+	if t == nil {
+		return nil
+	}
+	b.trace = nil
+	if t.err != nil {
+		return t.err
+	}
+	return t.w.Flush()
+}
+
+// traceInstruction writes the line of the instruction at the PC
+func (b *Bus) traceInstruction() {
+	t := b.trace
+	if t.err != nil {
+		return
+	}
+	c := b.cpu
+	in := b.Disassemble(c.pc)
+	line := t.line[:0]
+	for _, p := range t.format.parts {
+		switch p.tag {
+		case traceText:
+			line = append(line, p.text...)
+		case tracePC:
+			line = p.appendNumber(line, uint64(c.pc), 4)
+		case traceLabel:
+			start := len(line)
+			line = append(line, in.Label...)
+			line = pad(line, start+p.width)
+		case traceA:
+			line = p.appendNumber(line, uint64(c.a), 2)
+		case traceX:
+			line = p.appendNumber(line, uint64(c.x), 2)
+		case traceY:
+			line = p.appendNumber(line, uint64(c.y), 2)
+		case traceSP:
+			line = p.appendNumber(line, uint64(c.sp), 2)
+		case traceP:
+			if p.flags {
+				line = appendFlags(line, c.p)
+				break
+			}
+			line = p.appendNumber(line, uint64(c.p), 2)
+		case traceByteCode:
+			start := len(line)
+			for i, v := range in.Bytes {
+				if i > 0 {
+					line = append(line, ' ')
+				}
+				line = fmt.Appendf(line, "%02X", v)
+			}
+			line = pad(line, start+p.width)
+		case traceDisassembly:
+			start := len(line)
+			line = append(line, in.Text...)
+			line = pad(line, start+p.width)
+		case traceEffectiveAddress:
+			if addr, indexed, ok := b.accessAddr(in); ok && indexed {
+				line = fmt.Appendf(line, " @ $%04X", addr)
+			}
+		case traceMemoryValue:
+			if addr, _, ok := b.accessAddr(in); ok {
+				if p.hash {
+					line = fmt.Appendf(line, " = #$%02X", b.PeekMemory(addr))
+				} else {
+					line = fmt.Appendf(line, " = $%02X", b.PeekMemory(addr))
+				}
+			}
+		case traceAlign:
+			line = pad(line, p.width)
+		case traceScanline:
+			line = p.appendNumber(line, uint64(b.ppu.scanLine), 0)
+		case traceCycle:
+			line = p.appendNumber(line, uint64(b.ppu.cycles), 0)
+		case traceFrameCount:
+			line = p.appendNumber(line, b.ppu.frameCount, 0)
+		case traceCycleCount:
+			line = p.appendNumber(line, c.totalCycles, 0)
+		}
+	}
+	line = append(line, '\n')
+	t.line = line
+	if _, err := t.w.Write(line); err != nil {
+		t.err = err
+	}
+}
+
+// appendNumber appends the number, the registers are hex
+// of their digits without the spec
+func (p tracePart) appendNumber(line []byte, v uint64, digits int) []byte {
+	switch {
+	case p.hex:
+		return fmt.Appendf(line, "%0*X", p.width, v)
+	case p.width == 0 && digits > 0:
+		return fmt.Appendf(line, "%0*X", digits, v)
+	default:
+		return fmt.Appendf(line, "%*d", p.width, v)
+	}
+}
+
+// appendFlags appends the flags NVUBDIZC, the clear ones in lowercase
+func appendFlags(line []byte, flags uint8) []byte {
+	for i, name := range "NVUBDIZC" {
+		if flags&(0x80>>i) == 0 {
+			name += 'a' - 'A'
+		}
+		line = append(line, byte(name))
+	}
+	return line
+}
+
+// pad appends the spaces up to the column
+func pad(line []byte, column int) []byte {
+	for len(line) < column {
+		line = append(line, ' ')
+	}
+	return line
+}
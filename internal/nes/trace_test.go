@@ -0,0 +1,128 @@
+package nes
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTraceBus() *Bus {
+	bus := newTestBus()
+	copy(bus.cart.pgrMem, []uint8{
+		0xA2, 0x02, // LDX #$02
+		0xBD, 0x00, 0x02, // LDA $0200,X
+		0x85, 0x10, // STA $10
+		0x4C, 0x00, 0x80, // JMP $8000
+		0xD0, 0xFE, // BNE $800A
+		0xA7, 0x10, // LAX $10
+		0x0A,             // ASL A
+		0x6C, 0x00, 0x02, // JMP ($0200)
+	})
+	bus.cart.pgrMem[0x3FFD] = 0x80 // the reset vector
+	bus.ram.Write8(0x0202, 0x7F)
+	bus.cpu.Reset()
+	return bus
+}
+
+func Test_Bus_Disassemble(t *testing.T) {
+	bus := newTraceBus()
+	for addr, want := range map[uint16]string{
+		0x8000: "LDX #$02",
+		0x8002: "LDA $0200,X",
+		0x8005: "STA $10",
+		0x800A: "BNE $800A",
+		0x800C: "LAX $10",
+		0x800E: "ASL A",
+		0x800F: "JMP ($0200)",
+	} {
+		assert.Equal(t, want, bus.Disassemble(addr).Text)
+	}
+	in := bus.Disassemble(0x8002)
+	assert.Equal(t, []uint8{0xBD, 0x00, 0x02}, in.Bytes)
+	assert.False(t, in.Unofficial)
+	assert.True(t, bus.Disassemble(0x800C).Unofficial)
+}
+
+func Test_Bus_Trace(t *testing.T) {
+	bus := newTraceBus()
+	format, err := ParseTraceFormat("[PC,4h] [ByteCode,9][Disassembly][EffectiveAddress][MemoryValue][Align,40]A:[A,2h] X:[X] P:[P,8] CYC:[CycleCount,3]")
+	require.NoError(t, err)
+
+	var log bytes.Buffer
+	bus.StartTrace(&log, format)
+	for range 3 * 20 {
+		bus.Tic()
+	}
+	require.NoError(t, bus.StopTrace())
+
+	lines := strings.Split(log.String(), "\n")
+	require.Greater(t, len(lines), 4)
+	assert.Equal(t, []string{
+		fmt.Sprintf("%-40sA:00 X:00 P:nvUbdIzc CYC:  7", "8000 A2 02    LDX #$02"),
+		fmt.Sprintf("%-40sA:00 X:02 P:nvUbdIzc CYC:  9", "8002 BD 00 02 LDA $0200,X @ $0202 = $7F"),
+		fmt.Sprintf("%-40sA:7F X:02 P:nvUbdIzc CYC: 13", "8005 85 10    STA $10 = $00"),
+		fmt.Sprintf("%-40sA:7F X:02 P:nvUbdIzc CYC: 16", "8007 4C 00 80 JMP $8000"),
+	}, lines[:4])
+}
+
+func Test_ParseTraceFormat(t *testing.T) {
+	for _, name := range []string{"mesen", "fceux"} {
+		_, err := ParseTraceFormat(name)
+		assert.NoError(t, err, name)
+	}
+	for _, template := range []string{"[PC", "[Foo]", "[A,x]"} {
+		_, err := ParseTraceFormat(template)
+		assert.Error(t, err, template)
+	}
+
+	bus := newTraceBus()
+	format, err := ParseTraceFormat("fceux")
+	require.NoError(t, err)
+	var log bytes.Buffer
+	bus.StartTrace(&log, format)
+	for range 3 * 10 {
+		bus.Tic()
+	}
+	require.NoError(t, bus.StopTrace())
+	assert.Equal(t, "A:00 X:02 Y:00 S:FD P:nvUbdIzc  $8002:BD 00 02  LDA $0200,X @ $0202 = #$7F", strings.Split(log.String(), "\n")[1])
+}
+
+// testSymbols labels the CPU addresses
+type testSymbols map[uint16]string
+
+func (s testSymbols) Label(addr uint16, prg int) string {
+	return s[addr]
+}
+
+func Test_Bus_Disassemble_Labels(t *testing.T) {
+	bus := newTraceBus()
+	bus.SetSymbols(testSymbols{0x8000: "reset", 0x0200: "table", 0x800A: "wait", 0x0010: "lives"})
+
+	in := bus.Disassemble(0x8000)
+	assert.Equal(t, "reset", in.Label)
+	assert.Equal(t, "LDA table,X", bus.Disassemble(0x8002).Text)
+	assert.Equal(t, "STA lives", bus.Disassemble(0x8005).Text)
+	assert.Equal(t, "JMP reset", bus.Disassemble(0x8007).Text)
+	assert.Equal(t, "BNE wait", bus.Disassemble(0x800A).Text)
+	assert.Equal(t, "JMP (table)", bus.Disassemble(0x800F).Text)
+
+	format, err := ParseTraceFormat("[Label,6][Disassembly]")
+	require.NoError(t, err)
+	var log bytes.Buffer
+	bus.StartTrace(&log, format)
+	for range 3 * 10 {
+		bus.Tic()
+	}
+	require.NoError(t, bus.StopTrace())
+	assert.Equal(t, "reset LDX #$02\n      LDA table,X\n", log.String())
+
+	offset, ok := bus.PRGOffset(0xC005)
+	assert.True(t, ok)
+	assert.Equal(t, 0x0005, offset, "the 16 KB ROM is mirrored")
+	_, ok = bus.PRGOffset(0x0005)
+	assert.False(t, ok)
+}
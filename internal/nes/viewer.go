@@ -0,0 +1,234 @@
+package nes
+
+import (
+	"image"
+	"image/color"
+)
+
+// Debug views of the PPU state. They read the memory without side effects,
+// so they can be called at any time, e.g. from the OnFrame callback.
+
+// NametableView is a snapshot of the four nametables
+type NametableView struct {
+	// Image is the four nametables with their attributes as a 512x480 image:
+	// $2000 top left, $2400 top right, $2800 bottom left, $2C00 bottom right.
+	// The viewport of the scroll the last frame started with is outlined
+	Image *image.RGBA
+
+	// top left corner of the viewport in the image
+	ScrollX int
+	ScrollY int
+
+	Mirroring string
+}
+
+var viewportColor = color.RGBA{255, 255, 255, 255}
+
+// NametableView renders the four nametables
+func (b *Bus) NametableView() NametableView {
+	p := b.ppu
+	mem := b.newPpuMemory()
+	img := image.NewRGBA(image.Rect(0, 0, FrameWidth*2, FrameHeight*2))
+
+	bank := uint16(p.ppuctrl.B) << 12
+	for table := uint16(0); table < 4; table++ {
+		base := 0x2000 + table*0x400
+		left, top := int(table&0x1)*FrameWidth, int(table>>1)*FrameHeight
+		for y := uint16(0); y < 30; y++ {
+			for x := uint16(0); x < 32; x++ {
+				tile := mem.peek8(base + y*32 + x)
+				attr := mem.peek8(base + 0x3C0 + y/4*8 + x/4)
+				// 2 bits per 2x2 tiles
+				pallete := attr >> ((y & 0x2 << 1) | (x & 0x2)) & 0x3
+				b.drawTile(img, left+int(x)*8, top+int(y)*8, bank|uint16(tile)<<4, pallete)
+			}
+		}
+	}
+
+	v, fineX := p.frameScrollV, p.frameScrollX
+	view := NametableView{
+		Image:     img,
+		ScrollX:   int(v&0x1F)*8 + int(fineX) + int(v>>10&0x1)*FrameWidth,
+		ScrollY:   int(v>>5&0x1F)*8 + int(v>>12&0x7) + int(v>>11&0x1)*FrameHeight,
+		Mirroring: "none",
+	}
+	if b.cart != nil {
+		view.Mirroring = b.cart.mirror.String()
+	}
+
+	// the viewport wraps around the edges
+	w, h := FrameWidth*2, FrameHeight*2
+	for i := 0; i < FrameWidth; i++ {
+		img.SetRGBA((view.ScrollX+i)%w, view.ScrollY%h, viewportColor)
+		img.SetRGBA((view.ScrollX+i)%w, (view.ScrollY+FrameHeight-1)%h, viewportColor)
+	}
+	for i := 0; i < FrameHeight; i++ {
+		img.SetRGBA(view.ScrollX%w, (view.ScrollY+i)%h, viewportColor)
+		img.SetRGBA((view.ScrollX+FrameWidth-1)%w, (view.ScrollY+i)%h, viewportColor)
+	}
+	return view
+}
+
+// PatternTableView renders both pattern tables side by side as a 256x128
+// image: $0000 on the left, $1000 on the right. The tiles are colored
+// with the palette (0-3: background, 4-7: sprites). The CHR is read through
+// the mapper, so the view shows the currently switched in banks
+func (b *Bus) PatternTableView(pallete uint8) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 256, 128))
+	for table := 0; table < 2; table++ {
+		for tile := 0; tile < 256; tile++ {
+			addr := uint16(table)<<12 | uint16(tile)<<4
+			b.drawTile(img, table*128+tile%16*8, tile/16*8, addr, pallete&0x7)
+		}
+	}
+	return img
+}
+
+// PaletteEntry is an entry of the palette RAM
+type PaletteEntry struct {
+	Index int   // $00-$1F, offset from $3F00
+	Value uint8 // color index in the system palette
+	Color color.RGBA
+}
+
+// PaletteView is a snapshot of the palette RAM
+type PaletteView struct {
+	Entries [0x20]PaletteEntry
+	// Image is the entries as 16x16 swatches, a row per palette:
+	// 4 background palettes at the top, 4 sprite palettes at the bottom
+	Image *image.RGBA
+}
+
+const paletteSwatchSize = 16
+
+// PaletteView returns the 32 palette entries with their colors
+func (b *Bus) PaletteView() PaletteView {
+	p := b.ppu
+	view := PaletteView{
+		Image: image.NewRGBA(image.Rect(0, 0, 4*paletteSwatchSize, 8*paletteSwatchSize)),
+	}
+	for i := range view.Entries {
+		value := p.readPallete(0x3F00 | uint16(i))
+		c := p.displayPalette()[p.emphasis()][value]
+		view.Entries[i] = PaletteEntry{Index: i, Value: value, Color: c}
+
+		left, top := i%4*paletteSwatchSize, i/4*paletteSwatchSize
+		for y := top; y < top+paletteSwatchSize; y++ {
+			for x := left; x < left+paletteSwatchSize; x++ {
+				view.Image.SetRGBA(x, y, c)
+			}
+		}
+	}
+	return view
+}
+
+// SetPaletteEntry writes the color index into the palette RAM entry $00-$1F
+func (b *Bus) SetPaletteEntry(index int, value uint8) {
+	b.ppu.tablePallete[palleteAddr(0x3F00|uint16(index))] = value & 0x3F
+}
+
+// SpriteEntry is a decoded OAM entry
+type SpriteEntry struct {
+	Index   int
+	X       uint8
+	Y       uint8 // the sprite is displayed from the next scanline
+	Tile    uint8
+	Attr    uint8
+	Pallete uint8 // 4-7
+	FlipH   bool
+	FlipV   bool
+	Behind  bool // behind the background
+
+	// Image is the sprite as it is displayed, 8x8 or 8x16.
+	// Transparent pixels have zero alpha
+	Image *image.RGBA
+
+	// the sprite is on the current scanline
+	OnScanline bool
+	// the sprite is on the current scanline, but is not displayed
+	// because of the 8 sprites per scanline limit
+	Dropped bool
+}
+
+// SpriteView decodes the 64 OAM entries
+func (b *Bus) SpriteView() [64]SpriteEntry {
+	p := b.ppu
+	mem := b.newPpuMemory()
+	height := p.spriteHeight()
+
+	var sprites [64]SpriteEntry
+	onScanline := 0
+	for i := range sprites {
+		y, tile, attr, x := p.oam[i*4], p.oam[i*4+1], p.oam[i*4+2], p.oam[i*4+3]
+		sprite := SpriteEntry{
+			Index:   i,
+			X:       x,
+			Y:       y,
+			Tile:    tile,
+			Attr:    attr,
+			Pallete: attr&0x3 + 4,
+			FlipH:   attr&0x40 != 0,
+			FlipV:   attr&0x80 != 0,
+			Behind:  attr&0x20 != 0,
+			Image:   image.NewRGBA(image.Rect(0, 0, 8, height)),
+		}
+
+		row := int(p.scanLine) - 1 - int(y)
+		if p.scanLine < FrameHeight && row >= 0 && row < height {
+			sprite.OnScanline = true
+			sprite.Dropped = onScanline >= 8 && !p.noSpriteLimit
+			onScanline++
+		}
+
+		for row := 0; row < height; row++ {
+			addr := p.spritePatternAddr(tile, attr, uint16(row))
+			lo, hi := mem.peek8(addr), mem.peek8(addr+8)
+			if sprite.FlipH {
+				lo, hi = reverseBits(lo), reverseBits(hi)
+			}
+			for col := 0; col < 8; col++ {
+				bit := 7 - col
+				pixel := (lo>>bit)&0x1 | ((hi>>bit)&0x1)<<1
+				if pixel != 0 {
+					sprite.Image.SetRGBA(col, row, b.palleteColor(sprite.Pallete, pixel))
+				}
+			}
+		}
+		sprites[i] = sprite
+	}
+	return sprites
+}
+
+// drawTile draws the 8x8 tile at the pattern address
+// with the colors of the palette (0-3: background, 4-7: sprites)
+func (b *Bus) drawTile(img *image.RGBA, left, top int, addr uint16, pallete uint8) {
+	mem := b.newPpuMemory()
+	for row := 0; row < 8; row++ {
+		lo := mem.peek8(addr + uint16(row))
+		hi := mem.peek8(addr + uint16(row) + 8)
+		for col := 0; col < 8; col++ {
+			bit := 7 - col
+			pixel := (lo>>bit)&0x1 | ((hi>>bit)&0x1)<<1
+			img.SetRGBA(left+col, top+row, b.palleteColor(pallete, pixel))
+		}
+	}
+}
+
+// palleteColor returns the color of the pixel value in the palette
+// as it is displayed on the screen
+func (b *Bus) palleteColor(pallete uint8, pixel uint8) color.RGBA {
+	p := b.ppu
+	addr := uint16(0x3F00)
+	if pixel != 0 {
+		addr |= uint16(pallete)<<2 | uint16(pixel)
+	}
+	return p.displayPalette()[p.emphasis()][p.readPallete(addr)]
+}
+
+// displayPalette returns the palette the frame colors come from
+func (p *PPU) displayPalette() *Palette {
+	if f, ok := p.filter.(PaletteFilter); ok && f.Palette != nil {
+		return f.Palette
+	}
+	return defaultPalette
+}
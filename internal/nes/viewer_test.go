@@ -0,0 +1,120 @@
+package nes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Bus_NametableView(t *testing.T) {
+	bus := newTestBus()
+	p := bus.ppu
+
+	// tile 1 is solid color 3
+	for i := 0; i < 16; i++ {
+		bus.cart.chrMem[0x10+i] = 0xFF
+	}
+	p.tablePallete[0x03] = 0x16
+	p.tablePallete[0x07] = 0x2A
+	// vertical mirroring: $2400 is the second table
+	bus.cart.mirror = mirrorVertical
+	p.tableNames[1][0] = 0x01
+	p.tableNames[1][0x3C0] = 0x01
+
+	p.frameScrollV = 0x0402
+	p.frameScrollX = 3
+	view := bus.NametableView()
+	assert.Equal(t, "vertical", view.Mirroring)
+	assert.Equal(t, FrameWidth+19, view.ScrollX)
+	assert.Equal(t, 0, view.ScrollY)
+	assert.Equal(t, defaultPalette[0][0x2A], view.Image.RGBAAt(FrameWidth+4, 4))
+	assert.Equal(t, defaultPalette[0][0x2A], view.Image.RGBAAt(FrameWidth+4, FrameHeight+4), "$2C00 mirrors $2400")
+	assert.Equal(t, viewportColor, view.Image.RGBAAt(FrameWidth+19, 100))
+}
+
+func Test_Bus_PatternTableView(t *testing.T) {
+	bus := newTestBus()
+	p := bus.ppu
+
+	// the first row of tile $11 in the second table is color 1
+	bus.cart.chrMem[0x1110] = 0x80
+	p.tablePallete[0x00] = 0x0F
+	p.tablePallete[0x15] = 0x21
+
+	img := bus.PatternTableView(5)
+	assert.Equal(t, defaultPalette[0][0x21], img.RGBAAt(128+8, 8))
+	assert.Equal(t, defaultPalette[0][0x0F], img.RGBAAt(128+9, 8))
+}
+
+func Test_Bus_PaletteView(t *testing.T) {
+	bus := newTestBus()
+
+	bus.SetPaletteEntry(0x05, 0x16)
+	// $3F10 mirrors $3F00
+	bus.SetPaletteEntry(0x10, 0x21)
+
+	view := bus.PaletteView()
+	assert.Equal(t, PaletteEntry{Index: 0x05, Value: 0x16, Color: defaultPalette[0][0x16]}, view.Entries[0x05])
+	assert.Equal(t, uint8(0x21), view.Entries[0x00].Value)
+	assert.Equal(t, defaultPalette[0][0x16], view.Image.RGBAAt(paletteSwatchSize+1, paletteSwatchSize+1))
+}
+
+func Test_Bus_SpriteView(t *testing.T) {
+	bus := newTestBus()
+	p := bus.ppu
+
+	// tile 2 has color 1 in the top left corner
+	bus.cart.chrMem[0x20] = 0x80
+	p.tablePallete[0x19] = 0x30
+	for i := range p.oam {
+		p.oam[i] = 0xFF
+	}
+	// 9 sprites on scanline 20, the first one is flipped horizontally
+	for i := 0; i < 9; i++ {
+		p.oam[i*4+0] = 15
+		p.oam[i*4+1] = 2
+		p.oam[i*4+2] = 0x02
+		p.oam[i*4+3] = uint8(i * 8)
+	}
+	p.oam[2] = 0x42
+	p.scanLine = 20
+
+	sprites := bus.SpriteView()
+	assert.True(t, sprites[0].FlipH)
+	assert.Equal(t, uint8(6), sprites[0].Pallete)
+	assert.Equal(t, defaultPalette[0][0x30], sprites[0].Image.RGBAAt(7, 0))
+	assert.Equal(t, uint8(0), sprites[0].Image.RGBAAt(0, 0).A)
+	assert.Equal(t, defaultPalette[0][0x30], sprites[1].Image.RGBAAt(0, 0))
+
+	assert.True(t, sprites[7].OnScanline)
+	assert.False(t, sprites[7].Dropped)
+	assert.True(t, sprites[8].Dropped)
+	assert.False(t, sprites[9].OnScanline)
+}
+
+func Test_Bus_InputView(t *testing.T) {
+	bus := newTestBus()
+	bus.SetFourScore(true)
+	bus.RecordMovie()
+
+	runMovieFrames(bus, ButtonA)
+	view := bus.InputView()
+	assert.Equal(t, [4]Button{ButtonA}, view.Buttons)
+	assert.Equal(t, 4, view.Ports)
+	assert.Equal(t, 1, view.Frame)
+	assert.Equal(t, MovieRecording, view.Movie)
+	assert.False(t, view.Lag, "the first frame has no previous frame")
+
+	// the test program doesn't read the controllers
+	runMovieFrames(bus, ButtonB)
+	view = bus.InputView()
+	assert.True(t, view.Lag)
+	assert.Equal(t, 1, view.LagFrames)
+
+	bus.newCpuMemory().Read8(0x4016)
+	runMovieFrames(bus, 0)
+	view = bus.InputView()
+	assert.False(t, view.Lag)
+	assert.Equal(t, 1, view.LagFrames)
+	assert.Equal(t, 3, view.MovieFrame)
+}
@@ -0,0 +1,55 @@
+// Package nestest builds the consoles of the tests in memory
+package nestest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/stretchr/testify/require"
+)
+
+// NewROM returns the iNES image of an empty NROM cartridge,
+// 16K of PRG ROM and 8K of CHR ROM
+func NewROM() []byte {
+	rom := make([]byte, 16+0x4000+0x2000)
+	copy(rom, "NES\x1a\x01\x01")
+	return rom
+}
+
+// LoopROM returns the cartridge running the loop calling the subroutine at $8010:
+// the loop counts into $10, the subroutine into $11
+func LoopROM() []byte {
+	rom := NewROM()
+	prg := rom[16:]
+	copy(prg, []uint8{
+		0xA9, 0x00, // LDA #$00
+		0x20, 0x10, 0x80, // loop: JSR $8010
+		0xE6, 0x10, // INC $10
+		0x4C, 0x02, 0x80, // JMP loop
+	})
+	copy(prg[0x10:], []uint8{
+		0xE6, 0x11, // INC $11
+		0x60, // RTS
+	})
+	copy(prg[0x3FFA:], []uint8{0x13, 0x80, 0x00, 0x80, 0x13, 0x80})
+	prg[0x13] = 0x40 // RTI
+	return rom
+}
+
+// NewCart reads the cartridge from the iNES image
+func NewCart(t testing.TB, rom []byte) *nes.Cart {
+	t.Helper()
+	cart, err := nes.NewCart(bytes.NewReader(rom))
+	require.NoError(t, err)
+	return cart
+}
+
+// NewConsole returns the console reset with the cartridge of the iNES image
+func NewConsole(t testing.TB, rom []byte) *nes.Bus {
+	t.Helper()
+	console := nes.NewBus()
+	console.LoadCart(NewCart(t, rom))
+	console.Reset()
+	return console
+}
@@ -0,0 +1,262 @@
+// Package profiler reports where the game spends the CPU cycles: by the
+// PRG ROM bank and by the function of the symbol files, the code from a
+// label to the next one. The homebrew developers see what takes the frame
+// budget of about 29780 cycles.
+package profiler
+
+import (
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/symbols"
+)
+
+// DefaultBankSize is the PRG bank of the iNES header, 16 KB
+const DefaultBankSize = 0x4000
+
+// Entry is the cycles of a bank or of a function
+type Entry struct {
+	Name   string // the label, "" for the code out of the labels
+	Bank   int    // the PRG bank, -1: out of the PRG ROM
+	Addr   uint16 // the CPU address of the label
+	Cycles uint64
+}
+
+// Report is the cycles of the profile by the banks and by the functions
+type Report struct {
+	Frames    uint64
+	Cycles    uint64
+	Banks     []Entry
+	Functions []Entry
+}
+
+// SortKey is the order of the entries of the report
+type SortKey int
+
+const (
+	SortCycles  SortKey = iota // the most cycles first
+	SortName                   // by the label
+	SortAddress                // by the bank and the address
+)
+
+var sortKeyNames = []string{"cycles", "name", "address"}
+
+func (k SortKey) String() string {
+	if int(k) < len(sortKeyNames) {
+		return sortKeyNames[k]
+	}
+	return fmt.Sprintf("SortKey(%d)", int(k))
+}
+
+// ParseSortKey returns the order by its name, e.g. cycles
+func ParseSortKey(s string) (SortKey, error) {
+	if i := slices.Index(sortKeyNames, s); i >= 0 {
+		return SortKey(i), nil
+	}
+	return 0, fmt.Errorf("unknown sort key %q", s)
+}
+
+// NewReport sums the cycles of the profile by the banks of the size,
+// 0 is DefaultBankSize, and by the functions of the table, nil is
+// no labels. The entries are sorted by the cycles
+func NewReport(p nes.CycleProfile, table *symbols.Table, bankSize int) *Report {
+	if bankSize <= 0 {
+		bankSize = DefaultBankSize
+	}
+	r := &Report{Frames: p.Frames, Cycles: p.Cycles()}
+	funcs := newFunctions(table)
+	banks := map[int]*Entry{}
+	// the functions by the label and the bank, the mirrors of the bank
+	// have the function once
+	type key struct {
+		name string
+		bank int
+	}
+	functions := map[key]*Entry{}
+	count := func(bank int, fn Entry, cycles uint64) {
+		if banks[bank] == nil {
+			banks[bank] = &Entry{Bank: bank}
+		}
+		banks[bank].Cycles += cycles
+		k := key{fn.Name, fn.Bank}
+		if functions[k] == nil {
+			functions[k] = &fn
+		}
+		functions[k].Cycles += cycles
+	}
+	for prg, cycles := range p.PRG {
+		if cycles == 0 {
+			continue
+		}
+		bank := prg / bankSize
+		count(bank, funcs.find(p.PRGAddr[prg], prg, bank, bankSize), cycles)
+	}
+	for addr, cycles := range p.CPU {
+		if cycles == 0 {
+			continue
+		}
+		count(-1, funcs.find(uint16(addr), -1, -1, bankSize), cycles)
+	}
+	for _, e := range banks {
+		r.Banks = append(r.Banks, *e)
+	}
+	for _, e := range functions {
+		r.Functions = append(r.Functions, *e)
+	}
+	r.Sort(SortCycles)
+	return r
+}
+
+// Sort sorts the banks and the functions
+func (r *Report) Sort(key SortKey) {
+	compare := func(a, b Entry) int {
+		switch key {
+		case SortName:
+			if c := strings.Compare(a.Name, b.Name); c != 0 {
+				return c
+			}
+		case SortCycles:
+			if c := cmp.Compare(b.Cycles, a.Cycles); c != 0 {
+				return c
+			}
+		}
+		return cmp.Or(cmp.Compare(a.Bank, b.Bank), cmp.Compare(a.Addr, b.Addr), strings.Compare(a.Name, b.Name))
+	}
+	slices.SortFunc(r.Banks, compare)
+	slices.SortFunc(r.Functions, compare)
+}
+
+// Write writes the report as the text tables
+func (r *Report) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "frames: %d\tcycles: %d\tper frame: %s\t\n\n", r.Frames, r.Cycles, r.perFrame(r.Cycles))
+	fmt.Fprintf(tw, "bank\tcycles\t%%\tper frame\t\n")
+	for _, e := range r.Banks {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t\n", bankName(e.Bank), e.Cycles, r.percent(e.Cycles), r.perFrame(e.Cycles))
+	}
+	fmt.Fprintf(tw, "\nfunction\tbank\taddress\tcycles\t%%\tper frame\t\n")
+	for _, e := range r.Functions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t\n", functionName(e), bankName(e.Bank), address(e),
+			e.Cycles, r.percent(e.Cycles), r.perFrame(e.Cycles))
+	}
+	return tw.Flush()
+}
+
+// WriteCSV writes the report as the CSV table, the banks are
+// the rows without the function
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"bank", "function", "address", "cycles", "percent", "per_frame"})
+	for _, e := range r.Banks {
+		cw.Write([]string{bankName(e.Bank), "", "", strconv.FormatUint(e.Cycles, 10), r.percent(e.Cycles), r.perFrame(e.Cycles)})
+	}
+	for _, e := range r.Functions {
+		cw.Write([]string{bankName(e.Bank), functionName(e), address(e),
+			strconv.FormatUint(e.Cycles, 10), r.percent(e.Cycles), r.perFrame(e.Cycles)})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (r *Report) percent(cycles uint64) string {
+	if r.Cycles == 0 {
+		return "0.00"
+	}
+	return strconv.FormatFloat(float64(cycles)*100/float64(r.Cycles), 'f', 2, 64)
+}
+
+func (r *Report) perFrame(cycles uint64) string {
+	if r.Frames == 0 {
+		return "-"
+	}
+	return strconv.FormatFloat(float64(cycles)/float64(r.Frames), 'f', 1, 64)
+}
+
+func bankName(bank int) string {
+	if bank < 0 {
+		return "cpu"
+	}
+	return strconv.Itoa(bank)
+}
+
+func functionName(e Entry) string {
+	if e.Name == "" {
+		return "(no label)"
+	}
+	return e.Name
+}
+
+func address(e Entry) string {
+	if e.Name == "" {
+		return ""
+	}
+	return fmt.Sprintf("$%04X", e.Addr)
+}
+
+// functions finds the labels the code is under
+type functions struct {
+	prg []symbols.Symbol // the labels of the PRG ROM by the offset
+	cpu []symbols.Symbol // the labels of the CPU addresses by the address
+}
+
+func newFunctions(table *symbols.Table) *functions {
+	f := &functions{}
+	for _, s := range table.Symbols() {
+		if s.PRG >= 0 {
+			f.prg = append(f.prg, s)
+		} else {
+			f.cpu = append(f.cpu, s)
+		}
+	}
+	// the labels of the same address stay in the order of the names
+	slices.SortStableFunc(f.prg, func(a, b symbols.Symbol) int { return cmp.Compare(a.PRG, b.PRG) })
+	slices.SortStableFunc(f.cpu, func(a, b symbols.Symbol) int { return cmp.Compare(a.Addr, b.Addr) })
+	return f
+}
+
+// find returns the function of the code at the CPU address and the offset
+// of the PRG ROM, -1 out of it: the nearest label before it in the bank,
+// else in the area of the CPU memory. The code out of the labels is the
+// function without the name of the bank
+func (f *functions) find(addr uint16, prg, bank, bankSize int) Entry {
+	if prg >= 0 {
+		i := lastAtOrBefore(f.prg, func(s symbols.Symbol) bool { return s.PRG <= prg })
+		if i >= 0 && f.prg[i].PRG/bankSize == bank {
+			s := f.prg[i]
+			return Entry{Name: s.Name, Bank: bank, Addr: addr - uint16(prg-s.PRG)}
+		}
+	}
+	i := lastAtOrBefore(f.cpu, func(s symbols.Symbol) bool { return s.Addr <= addr })
+	if i >= 0 && area(f.cpu[i].Addr) == area(addr) {
+		return Entry{Name: f.cpu[i].Name, Bank: bank, Addr: f.cpu[i].Addr}
+	}
+	return Entry{Bank: bank}
+}
+
+// lastAtOrBefore returns the index of the last sorted label before
+// the code or at it, -1: none
+func lastAtOrBefore(labels []symbols.Symbol, before func(s symbols.Symbol) bool) int {
+	return sort.Search(len(labels), func(i int) bool { return !before(labels[i]) }) - 1
+}
+
+// area returns the area of the CPU memory: the RAM, the registers,
+// the cartridge RAM or the PRG ROM
+func area(addr uint16) int {
+	switch {
+	case addr < 0x2000:
+		return 0
+	case addr < 0x6000:
+		return 1
+	case addr < 0x8000:
+		return 2
+	}
+	return 3
+}
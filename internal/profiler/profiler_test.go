@@ -0,0 +1,111 @@
+package profiler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/symbols"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestProfile is 2 banks of 16 KB at $8000 and $C000 and a routine in the RAM
+func newTestProfile() (nes.CycleProfile, *symbols.Table) {
+	p := nes.CycleProfile{
+		Frames:  2,
+		PRG:     make([]uint64, 0x8000),
+		PRGAddr: make([]uint16, 0x8000),
+		CPU:     make([]uint64, 0x10000),
+	}
+	count := func(prg int, addr uint16, cycles uint64) {
+		p.PRG[prg], p.PRGAddr[prg] = cycles, addr
+	}
+	count(0x0000, 0x8000, 100) // main
+	count(0x0010, 0x8010, 50)  // main
+	count(0x0100, 0x8100, 300) // update
+	count(0x4000, 0xC000, 10)  // no label in the bank 1
+	count(0x4100, 0xC100, 40)  // nmi
+	p.CPU[0x0300] = 20         // ram_routine
+	p.CPU[0x6000] = 5          // no label in the cartridge RAM
+
+	table := symbols.NewTable()
+	table.Add(symbols.Symbol{Name: "main", Addr: 0x8000, PRG: 0x0000})
+	table.Add(symbols.Symbol{Name: "update", Addr: 0x8100, PRG: 0x0100})
+	table.Add(symbols.Symbol{Name: "nmi", Addr: 0xC100, PRG: 0x4100})
+	table.Add(symbols.Symbol{Name: "ram_routine", Addr: 0x0300, PRG: -1})
+	table.Add(symbols.Symbol{Name: "player_x", Addr: 0x0010, PRG: -1})
+	return p, table
+}
+
+func Test_NewReport(t *testing.T) {
+	p, table := newTestProfile()
+	r := NewReport(p, table, 0)
+	assert.Equal(t, uint64(2), r.Frames)
+	assert.Equal(t, uint64(525), r.Cycles)
+	assert.Equal(t, []Entry{
+		{Bank: 0, Cycles: 450},
+		{Bank: 1, Cycles: 50},
+		{Bank: -1, Cycles: 25},
+	}, r.Banks)
+	assert.Equal(t, []Entry{
+		{Name: "update", Bank: 0, Addr: 0x8100, Cycles: 300},
+		{Name: "main", Bank: 0, Addr: 0x8000, Cycles: 150},
+		{Name: "nmi", Bank: 1, Addr: 0xC100, Cycles: 40},
+		{Name: "ram_routine", Bank: -1, Addr: 0x0300, Cycles: 20},
+		{Bank: 1, Cycles: 10},
+		{Bank: -1, Cycles: 5},
+	}, r.Functions)
+
+	r.Sort(SortAddress)
+	assert.Equal(t, []int{-1, 0, 1}, []int{r.Banks[0].Bank, r.Banks[1].Bank, r.Banks[2].Bank})
+	assert.Equal(t, "ram_routine", r.Functions[1].Name)
+	r.Sort(SortName)
+	assert.Equal(t, "main", r.Functions[2].Name)
+}
+
+func Test_NewReport_BankSize(t *testing.T) {
+	p, _ := newTestProfile()
+	r := NewReport(p, nil, 0x2000)
+	assert.Equal(t, []Entry{
+		{Bank: 0, Cycles: 450},
+		{Bank: 2, Cycles: 50},
+		{Bank: -1, Cycles: 25},
+	}, r.Banks)
+	assert.Equal(t, r.Banks, r.Functions, "without the labels the banks are the functions")
+}
+
+func Test_Report_Write(t *testing.T) {
+	p, table := newTestProfile()
+	r := NewReport(p, table, 0)
+
+	var text bytes.Buffer
+	require.NoError(t, r.Write(&text))
+	lines := strings.Split(text.String(), "\n")
+	assert.Contains(t, lines[0], "cycles: 525")
+	assert.Equal(t, []string{"update", "0", "$8100", "300", "57.14", "150.0"}, strings.Fields(lines[8]))
+	assert.Equal(t, []string{"(no", "label)", "cpu", "5", "0.95", "2.5"}, strings.Fields(lines[13]))
+
+	var csv bytes.Buffer
+	require.NoError(t, r.WriteCSV(&csv))
+	assert.Equal(t, "bank,function,address,cycles,percent,per_frame\n"+
+		"0,,,450,85.71,225.0\n"+
+		"1,,,50,9.52,25.0\n"+
+		"cpu,,,25,4.76,12.5\n"+
+		"0,update,$8100,300,57.14,150.0\n"+
+		"0,main,$8000,150,28.57,75.0\n"+
+		"1,nmi,$C100,40,7.62,20.0\n"+
+		"cpu,ram_routine,$0300,20,3.81,10.0\n"+
+		"1,(no label),,10,1.90,5.0\n"+
+		"cpu,(no label),,5,0.95,2.5\n", csv.String())
+}
+
+func Test_ParseSortKey(t *testing.T) {
+	k, err := ParseSortKey("name")
+	require.NoError(t, err)
+	assert.Equal(t, SortName, k)
+	assert.Equal(t, "name", k.String())
+	_, err = ParseSortKey("size")
+	assert.EqualError(t, err, `unknown sort key "size"`)
+}
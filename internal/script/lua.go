@@ -0,0 +1,313 @@
+//go:build lua
+
+package script
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/nevisdale/nestic/internal/frontend"
+	"github.com/nevisdale/nestic/internal/nes"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// luaScript is the Lua script run along the console
+type luaScript struct {
+	state   *lua.LState
+	console *nes.Bus
+
+	main   *lua.LFunction // the script, it runs until emu.frameadvance
+	thread *lua.LState    // nil: the script returned
+	before *lua.LFunction
+	after  *lua.LFunction
+
+	overlay overlay
+	joypad  [4]joypadSet
+}
+
+// Load loads the Lua script and runs it until it waits for the frame
+func Load(path string, console *nes.Bus) (frontend.Script, error) {
+	s := &luaScript{state: lua.NewState(), console: console}
+	s.register()
+	main, err := s.state.LoadFile(path)
+	if err != nil {
+		s.state.Close()
+		return nil, fmt.Errorf("couldn't load the script: %s", err)
+	}
+	s.main = main
+	s.thread, _ = s.state.NewThread()
+	if err := s.resume(); err != nil {
+		s.state.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// resume runs the script until emu.frameadvance or its end
+func (s *luaScript) resume() error {
+	if s.thread == nil {
+		return nil
+	}
+	state, err, _ := s.state.Resume(s.thread, s.main)
+	switch state {
+	case lua.ResumeError:
+		return err
+	case lua.ResumeOK:
+		// the callbacks keep running
+		s.thread = nil
+	}
+	return nil
+}
+
+func (s *luaScript) call(fn *lua.LFunction) error {
+	if fn == nil {
+		return nil
+	}
+	return s.state.CallByParam(lua.P{Fn: fn, Protect: true})
+}
+
+// BeforeFrame implements frontend.Script
+func (s *luaScript) BeforeFrame() error {
+	s.overlay.clear()
+	return s.call(s.before)
+}
+
+// Input implements frontend.Script
+func (s *luaScript) Input(buttons *[4]nes.Button) {
+	for port := range buttons {
+		buttons[port] = s.joypad[port].apply(buttons[port])
+	}
+	s.joypad = [4]joypadSet{}
+}
+
+// AfterFrame implements frontend.Script
+func (s *luaScript) AfterFrame() error {
+	if err := s.call(s.after); err != nil {
+		return err
+	}
+	return s.resume()
+}
+
+// Draw implements frontend.Script
+func (s *luaScript) Draw(dst *image.RGBA) {
+	s.overlay.draw(dst)
+}
+
+// Close implements frontend.Script
+func (s *luaScript) Close() {
+	s.state.Close()
+}
+
+func (s *luaScript) register() {
+	L := s.state
+	for name, funcs := range map[string]map[string]lua.LGFunction{
+		"memory": {
+			"readbyte":       s.readByte,
+			"readbytesigned": s.readByteSigned,
+			"readword":       s.readWord,
+			"writebyte":      s.writeByte,
+			"getregister":    s.getRegister,
+			"setregister":    s.setRegister,
+		},
+		"emu": {
+			"framecount":     s.frameCount,
+			"lagcount":       s.lagCount,
+			"frameadvance":   s.frameAdvance,
+			"registerbefore": s.registerBefore,
+			"registerafter":  s.registerAfter,
+		},
+		"gui": {
+			"pixel": s.pixel,
+			"line":  s.line,
+			"box":   s.box,
+			"text":  s.text,
+		},
+		"joypad": {
+			"get": s.joypadGet,
+			"set": s.joypadSet,
+		},
+	} {
+		table := L.NewTable()
+		L.SetFuncs(table, funcs)
+		L.SetGlobal(name, table)
+	}
+}
+
+func checkAddr(L *lua.LState, n int) uint16 {
+	return uint16(L.CheckInt(n))
+}
+
+func (s *luaScript) readByte(L *lua.LState) int {
+	L.Push(lua.LNumber(s.console.PeekMemory(checkAddr(L, 1))))
+	return 1
+}
+
+func (s *luaScript) readByteSigned(L *lua.LState) int {
+	L.Push(lua.LNumber(int8(s.console.PeekMemory(checkAddr(L, 1)))))
+	return 1
+}
+
+func (s *luaScript) readWord(L *lua.LState) int {
+	addr := checkAddr(L, 1)
+	lo, hi := s.console.PeekMemory(addr), s.console.PeekMemory(addr+1)
+	L.Push(lua.LNumber(uint16(hi)<<8 | uint16(lo)))
+	return 1
+}
+
+func (s *luaScript) writeByte(L *lua.LState) int {
+	s.console.WriteMemory(checkAddr(L, 1), uint8(L.CheckInt(2)))
+	return 0
+}
+
+func (s *luaScript) getRegister(L *lua.LState) int {
+	r := s.console.CPURegisters()
+	var v int
+	switch name := L.CheckString(1); strings.ToLower(name) {
+	case "a":
+		v = int(r.A)
+	case "x":
+		v = int(r.X)
+	case "y":
+		v = int(r.Y)
+	case "s":
+		v = int(r.SP)
+	case "p":
+		v = int(r.P)
+	case "pc":
+		v = int(r.PC)
+	default:
+		L.ArgError(1, fmt.Sprintf("unknown register %q", name))
+	}
+	L.Push(lua.LNumber(v))
+	return 1
+}
+
+func (s *luaScript) setRegister(L *lua.LState) int {
+	r := s.console.CPURegisters()
+	v := L.CheckInt(2)
+	switch name := L.CheckString(1); strings.ToLower(name) {
+	case "a":
+		r.A = uint8(v)
+	case "x":
+		r.X = uint8(v)
+	case "y":
+		r.Y = uint8(v)
+	case "s":
+		r.SP = uint8(v)
+	case "p":
+		r.P = uint8(v)
+	case "pc":
+		r.PC = uint16(v)
+	default:
+		L.ArgError(1, fmt.Sprintf("unknown register %q", name))
+	}
+	s.console.SetCPURegisters(r)
+	return 0
+}
+
+func (s *luaScript) frameCount(L *lua.LState) int {
+	L.Push(lua.LNumber(s.console.InputView().Frame))
+	return 1
+}
+
+func (s *luaScript) lagCount(L *lua.LState) int {
+	L.Push(lua.LNumber(s.console.InputView().LagFrames))
+	return 1
+}
+
+// frameAdvance waits for the end of the frame, the script goes on after it
+func (s *luaScript) frameAdvance(L *lua.LState) int {
+	if L != s.thread {
+		L.RaiseError("emu.frameadvance is called outside the main script")
+	}
+	return L.Yield()
+}
+
+func (s *luaScript) registerBefore(L *lua.LState) int {
+	s.before = optFunction(L, 1)
+	return 0
+}
+
+func (s *luaScript) registerAfter(L *lua.LState) int {
+	s.after = optFunction(L, 1)
+	return 0
+}
+
+// optFunction returns the function argument, nil removes the callback
+func optFunction(L *lua.LState, n int) *lua.LFunction {
+	if L.Get(n) == lua.LNil {
+		return nil
+	}
+	return L.CheckFunction(n)
+}
+
+func checkColor(L *lua.LState, n int, def string) color.RGBA {
+	c, err := ParseColor(L.OptString(n, def))
+	if err != nil {
+		L.ArgError(n, err.Error())
+	}
+	return c
+}
+
+func (s *luaScript) pixel(L *lua.LState) int {
+	s.overlay.add(drawOp{kind: drawPixel, x1: L.CheckInt(1), y1: L.CheckInt(2), outline: checkColor(L, 3, "white")})
+	return 0
+}
+
+func (s *luaScript) line(L *lua.LState) int {
+	s.overlay.add(drawOp{
+		kind: drawLine,
+		x1:   L.CheckInt(1), y1: L.CheckInt(2), x2: L.CheckInt(3), y2: L.CheckInt(4),
+		outline: checkColor(L, 5, "white"),
+	})
+	return 0
+}
+
+func (s *luaScript) box(L *lua.LState) int {
+	s.overlay.add(drawOp{
+		kind: drawBox,
+		x1:   L.CheckInt(1), y1: L.CheckInt(2), x2: L.CheckInt(3), y2: L.CheckInt(4),
+		fill:    checkColor(L, 5, "#FFFFFF3F"),
+		outline: checkColor(L, 6, "white"),
+	})
+	return 0
+}
+
+func (s *luaScript) text(L *lua.LState) int {
+	s.overlay.add(drawOp{kind: drawText, x1: L.CheckInt(1), y1: L.CheckInt(2), text: L.CheckString(3)})
+	return 0
+}
+
+func checkPort(L *lua.LState, n int) int {
+	port := L.CheckInt(n)
+	if port < 1 || port > 4 {
+		L.ArgError(n, "the port is 1-4")
+	}
+	return port - 1
+}
+
+func (s *luaScript) joypadGet(L *lua.LState) int {
+	port := checkPort(L, 1)
+	table := L.NewTable()
+	for name, pressed := range buttonNames(s.console.InputView().Buttons[port]) {
+		table.RawSetString(name, lua.LBool(pressed))
+	}
+	L.Push(table)
+	return 1
+}
+
+func (s *luaScript) joypadSet(L *lua.LState) int {
+	port := checkPort(L, 1)
+	set := &s.joypad[port]
+	L.CheckTable(2).ForEach(func(key, value lua.LValue) {
+		if value == lua.LNil {
+			return
+		}
+		if err := set.set(key.String(), lua.LVAsBool(value)); err != nil {
+			L.ArgError(2, err.Error())
+		}
+	})
+	return 0
+}
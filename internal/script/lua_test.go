@@ -0,0 +1,97 @@
+//go:build lua
+
+package script
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/nevisdale/nestic/internal/nestest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadScript(t *testing.T, console *nes.Bus, source string) *luaScript {
+	path := filepath.Join(t.TempDir(), "test.lua")
+	require.NoError(t, os.WriteFile(path, []byte(source), 0o644))
+	s, err := Load(path, console)
+	require.NoError(t, err)
+	t.Cleanup(s.Close)
+	return s.(*luaScript)
+}
+
+// runFrame runs the frame the way the session does
+func runFrame(t *testing.T, s *luaScript, console *nes.Bus) {
+	require.NoError(t, s.BeforeFrame())
+	var buttons [4]nes.Button
+	s.Input(&buttons)
+	console.SetInput(buttons)
+	console.RunFrame()
+	require.NoError(t, s.AfterFrame())
+}
+
+func Test_Lua_Memory(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := loadScript(t, console, `
+		memory.writebyte(0x10, 0x34)
+		memory.writebyte(0x11, 0x12)
+		memory.writebyte(0x12, 0xFF)
+		memory.setregister("a", 0x42)
+		assert(memory.readword(0x10) == 0x1234)
+		assert(memory.readbytesigned(0x12) == -1)
+		assert(memory.readbyte(0x0812) == 0xFF)
+		assert(memory.getregister("A") == 0x42)
+	`)
+	assert.Nil(t, s.thread, "the script returned")
+	assert.Equal(t, uint8(0x42), console.CPURegisters().A)
+}
+
+func Test_Lua_Frames(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	s := loadScript(t, console, `
+		before, after = 0, 0
+		emu.registerbefore(function()
+			before = before + 1
+			joypad.set(1, {A=true, start=true})
+		end)
+		emu.registerafter(function()
+			after = emu.framecount()
+			gui.text(1, 2, "frame")
+		end)
+		while true do
+			memory.writebyte(0x20, memory.readbyte(0x20) + 1)
+			emu.frameadvance()
+		end
+	`)
+	assert.Equal(t, uint8(1), console.PeekMemory(0x20), "the script runs until the frame")
+	for i := 0; i < 3; i++ {
+		runFrame(t, s, console)
+	}
+	assert.Equal(t, uint8(4), console.PeekMemory(0x20), "the loop goes on after every frame")
+	assert.Equal(t, nes.ButtonA|nes.ButtonStart, console.InputView().Buttons[0])
+	assert.Equal(t, "3", s.state.GetGlobal("before").String())
+	assert.Equal(t, "3", s.state.GetGlobal("after").String())
+	assert.Len(t, s.overlay.ops, 1, "the drawings of the last frame")
+	s.Draw(image.NewRGBA(image.Rect(0, 0, nes.FrameWidth, nes.FrameHeight)))
+
+	runFrame(t, s, console)
+	assert.Len(t, s.overlay.ops, 1)
+}
+
+func Test_Lua_Errors(t *testing.T) {
+	console := nestest.NewConsole(t, nestest.NewROM())
+	path := filepath.Join(t.TempDir(), "error.lua")
+	require.NoError(t, os.WriteFile(path, []byte(`memory.getregister("q")`), 0o644))
+	_, err := Load(path, console)
+	assert.ErrorContains(t, err, `unknown register "q"`)
+
+	_, err = Load(filepath.Join(t.TempDir(), "none.lua"), console)
+	assert.ErrorContains(t, err, "couldn't load the script")
+
+	s := loadScript(t, console, `emu.registerafter(function() gui.box(0, 0, 1, 1, "pink") end)`)
+	require.NoError(t, s.BeforeFrame())
+	assert.ErrorContains(t, s.AfterFrame(), `invalid color "pink"`)
+}
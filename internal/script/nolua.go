@@ -0,0 +1,15 @@
+//go:build !lua
+
+package script
+
+import (
+	"errors"
+
+	"github.com/nevisdale/nestic/internal/frontend"
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// Load loads the Lua script, it needs the build with the lua tag
+func Load(path string, console *nes.Bus) (frontend.Script, error) {
+	return nil, errors.New("the Lua scripts need the build with the lua tag: go build -tags lua")
+}
@@ -0,0 +1,14 @@
+//go:build !lua
+
+package script
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Load_NoLua(t *testing.T) {
+	_, err := Load("script.lua", nil)
+	assert.ErrorContains(t, err, "the lua tag")
+}
@@ -0,0 +1,158 @@
+package script
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/nevisdale/nestic/internal/frontend"
+)
+
+// the colors of the names FCEUX knows
+var colorNames = map[string]color.RGBA{
+	"white":      {0xFF, 0xFF, 0xFF, 0xFF},
+	"black":      {0x00, 0x00, 0x00, 0xFF},
+	"clear":      {},
+	"gray":       {0x7F, 0x7F, 0x7F, 0xFF},
+	"grey":       {0x7F, 0x7F, 0x7F, 0xFF},
+	"red":        {0xFF, 0x00, 0x00, 0xFF},
+	"orange":     {0xFF, 0x7F, 0x00, 0xFF},
+	"yellow":     {0xFF, 0xFF, 0x00, 0xFF},
+	"chartreuse": {0x7F, 0xFF, 0x00, 0xFF},
+	"green":      {0x00, 0xFF, 0x00, 0xFF},
+	"teal":       {0x00, 0xFF, 0x7F, 0xFF},
+	"cyan":       {0x00, 0xFF, 0xFF, 0xFF},
+	"blue":       {0x00, 0x00, 0xFF, 0xFF},
+	"purple":     {0x7F, 0x00, 0xFF, 0xFF},
+	"magenta":    {0xFF, 0x00, 0xFF, 0xFF},
+}
+
+// ParseColor parses the color of the drawing functions: a name,
+// e.g. red, or #RRGGBB, or #RRGGBBAA with the opacity
+func ParseColor(s string) (color.RGBA, error) {
+	if c, ok := colorNames[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+	hex, ok := strings.CutPrefix(s, "#")
+	if !ok || (len(hex) != 6 && len(hex) != 8) {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	if len(hex) == 6 {
+		hex += "FF"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	return color.RGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+type drawKind int
+
+const (
+	drawPixel drawKind = iota
+	drawLine
+	drawBox
+	drawText
+)
+
+// drawOp is a drawing of the script, in the picture coordinates
+type drawOp struct {
+	kind           drawKind
+	x1, y1, x2, y2 int
+	fill, outline  color.RGBA // the pixel and the line are of the outline color
+	text           string
+}
+
+// overlay is what the script drew for the frame,
+// it is drawn over every displayed frame until the next one
+type overlay struct {
+	ops []drawOp
+}
+
+func (o *overlay) clear() {
+	o.ops = o.ops[:0]
+}
+
+func (o *overlay) add(op drawOp) {
+	o.ops = append(o.ops, op)
+}
+
+func (o *overlay) draw(dst *image.RGBA) {
+	at := dst.Rect.Min
+	for _, op := range o.ops {
+		x1, y1, x2, y2 := at.X+op.x1, at.Y+op.y1, at.X+op.x2, at.Y+op.y2
+		switch op.kind {
+		case drawPixel:
+			blend(dst, x1, y1, op.outline)
+		case drawLine:
+			drawLineTo(dst, x1, y1, x2, y2, op.outline)
+		case drawBox:
+			x1, x2 = min(x1, x2), max(x1, x2)
+			y1, y2 = min(y1, y2), max(y1, y2)
+			for y := y1 + 1; y < y2; y++ {
+				for x := x1 + 1; x < x2; x++ {
+					blend(dst, x, y, op.fill)
+				}
+			}
+			drawLineTo(dst, x1, y1, x2, y1, op.outline)
+			drawLineTo(dst, x1, y2, x2, y2, op.outline)
+			drawLineTo(dst, x1, y1+1, x1, y2-1, op.outline)
+			drawLineTo(dst, x2, y1+1, x2, y2-1, op.outline)
+		case drawText:
+			frontend.DrawText(dst, op.text, x1, y1)
+		}
+	}
+}
+
+// drawLineTo draws the line from x1, y1 to x2, y2, both ends included
+func drawLineTo(dst *image.RGBA, x1, y1, x2, y2 int, c color.RGBA) {
+	dx, dy := abs(x2-x1), -abs(y2-y1)
+	sx, sy := sign(x2-x1), sign(y2-y1)
+	e := dx + dy
+	for {
+		blend(dst, x1, y1, c)
+		if x1 == x2 && y1 == y2 {
+			return
+		}
+		if 2*e >= dy {
+			e += dy
+			x1 += sx
+		}
+		if 2*e <= dx {
+			e += dx
+			y1 += sy
+		}
+	}
+}
+
+// blend draws the pixel over the picture by its opacity
+func blend(dst *image.RGBA, x, y int, c color.RGBA) {
+	if c.A == 0 || !image.Pt(x, y).In(dst.Rect) {
+		return
+	}
+	i := dst.PixOffset(x, y)
+	a := int(c.A)
+	for n, v := range []uint8{c.R, c.G, c.B} {
+		dst.Pix[i+n] = uint8((int(v)*a + int(dst.Pix[i+n])*(0xFF-a)) / 0xFF)
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func sign(v int) int {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+// Package script runs the Lua scripts along the console, the frontends
+// load them with the -lua flag. The API follows the one of FCEUX, the
+// scripts written for it run as they are:
+//
+//	memory.readbyte(addr), memory.readbytesigned(addr), memory.readword(addr)
+//	memory.writebyte(addr, value)
+//	memory.getregister(name), memory.setregister(name, value): a, x, y, s, p or pc
+//	emu.framecount(), emu.lagcount(), emu.frameadvance()
+//	emu.registerbefore(fn), emu.registerafter(fn): fn runs before or after every frame
+//	gui.pixel(x, y, color), gui.line(x1, y1, x2, y2, color)
+//	gui.box(x1, y1, x2, y2, fill, outline), gui.text(x, y, text)
+//	joypad.get(port), joypad.set(port, buttons): the ports from 1,
+//	  the buttons {A=true, B=false, select=nil, ...}
+//
+// The colors are the names, e.g. red, or #RRGGBB and #RRGGBBAA.
+// The Lua interpreter is built with the lua build tag.
+package script
+
+import (
+	"strings"
+
+	"github.com/nevisdale/nestic/internal/nes"
+)
+
+// joypadSet is the buttons joypad.set forces for the next frame
+type joypadSet struct {
+	pressed  nes.Button
+	released nes.Button
+}
+
+// set forces the button pressed or released, the names are of FCEUX:
+// A, B, select, start, up, down, left and right
+func (j *joypadSet) set(name string, pressed bool) error {
+	button, err := nes.ParseButton(strings.ToLower(name))
+	if err != nil {
+		return err
+	}
+	if pressed {
+		j.pressed |= button
+		j.released &^= button
+	} else {
+		j.released |= button
+		j.pressed &^= button
+	}
+	return nil
+}
+
+func (j *joypadSet) apply(buttons nes.Button) nes.Button {
+	return buttons&^j.released | j.pressed
+}
+
+// buttonNames returns the FCEUX names of the buttons
+// with whether they are pressed
+func buttonNames(buttons nes.Button) map[string]bool {
+	names := map[string]bool{}
+	for i := 0; i < 8; i++ {
+		button := nes.Button(1 << i)
+		name := button.String()
+		if name == "a" || name == "b" {
+			name = strings.ToUpper(name)
+		}
+		names[name] = buttons&button != 0
+	}
+	return names
+}
@@ -0,0 +1,78 @@
+package script
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/nevisdale/nestic/internal/nes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParseColor(t *testing.T) {
+	tests := []struct {
+		s    string
+		want color.RGBA
+		err  string
+	}{
+		{s: "red", want: color.RGBA{0xFF, 0, 0, 0xFF}},
+		{s: "White", want: color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}},
+		{s: "#102030", want: color.RGBA{0x10, 0x20, 0x30, 0xFF}},
+		{s: "#1020307f", want: color.RGBA{0x10, 0x20, 0x30, 0x7F}},
+		{s: "#12345", err: `invalid color "#12345"`},
+		{s: "#GG0000", err: `invalid color "#GG0000"`},
+		{s: "pink", err: `invalid color "pink"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			c, err := ParseColor(tt.s)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, c)
+		})
+	}
+}
+
+func Test_Overlay_Draw(t *testing.T) {
+	dst := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(dst, dst.Rect, image.Black, image.Point{}, draw.Src)
+	red := color.RGBA{0xFF, 0, 0, 0xFF}
+	var o overlay
+	o.add(drawOp{kind: drawPixel, x1: 1, y1: 1, outline: red})
+	o.add(drawOp{kind: drawLine, x1: 0, y1: 15, x2: 15, y2: 0, outline: red})
+	o.add(drawOp{kind: drawBox, x1: 12, y1: 12, x2: 8, y2: 8, fill: color.RGBA{0xFF, 0xFF, 0xFF, 0x80}, outline: red})
+	o.add(drawOp{kind: drawPixel, x1: 20, y1: 1, outline: red})
+	o.draw(dst)
+
+	assert.Equal(t, red, dst.RGBAAt(1, 1))
+	for i := 0; i < 16; i++ {
+		assert.Equal(t, red, dst.RGBAAt(i, 15-i), "the line")
+	}
+	assert.Equal(t, red, dst.RGBAAt(8, 12), "the outline")
+	assert.Equal(t, color.RGBA{0x80, 0x80, 0x80, 0xFF}, dst.RGBAAt(10, 9), "the fill blends")
+	assert.Equal(t, color.RGBA{0, 0, 0, 0xFF}, dst.RGBAAt(13, 13))
+
+	o.clear()
+	assert.Empty(t, o.ops)
+}
+
+func Test_JoypadSet(t *testing.T) {
+	var j joypadSet
+	require.NoError(t, j.set("A", true))
+	require.NoError(t, j.set("right", false))
+	require.NoError(t, j.set("start", true))
+	require.NoError(t, j.set("start", false))
+	assert.EqualError(t, j.set("turbo", true), `unknown button "turbo"`)
+	assert.Equal(t, nes.ButtonA|nes.ButtonUp, j.apply(nes.ButtonRight|nes.ButtonUp|nes.ButtonStart))
+
+	names := buttonNames(nes.ButtonA | nes.ButtonSelect)
+	assert.Len(t, names, 8)
+	assert.True(t, names["A"])
+	assert.True(t, names["select"])
+	assert.False(t, names["B"])
+}
@@ -0,0 +1,346 @@
+// Package symbols loads the labels of the game from the debug files of
+// the assembler and of the other emulators: the FCEUX .nl files, the
+// Mesen .mlb files and the .dbg files of the cc65 linker. The labels
+// name the addresses in the disassembly, the trace logs and the
+// breakpoints.
+package symbols
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Symbol is a label of the memory
+type Symbol struct {
+	Name    string
+	Addr    uint16 // the CPU address, when PRG is -1
+	PRG     int    // the offset of the PRG ROM, -1: the label is of the CPU address
+	Size    int    // the bytes the label spans, e.g. of an array
+	Comment string
+}
+
+// Table is the labels of the game
+type Table struct {
+	symbols []Symbol
+	byAddr  map[uint16]string // the labels of the bytes of the CPU addresses
+	byPRG   map[int]string    // the labels of the bytes of the PRG ROM
+	byName  map[string]int    // the index of the symbol
+}
+
+// NewTable returns the table without the labels
+func NewTable() *Table {
+	return &Table{byAddr: map[uint16]string{}, byPRG: map[int]string{}, byName: map[string]int{}}
+}
+
+// Add adds the label, the later label of the address or of the name
+// replaces the earlier one
+func (t *Table) Add(s Symbol) {
+	s.Size = max(s.Size, 1)
+	if i, ok := t.byName[s.Name]; ok {
+		t.symbols[i] = s
+	} else {
+		t.byName[s.Name] = len(t.symbols)
+		t.symbols = append(t.symbols, s)
+	}
+	for i := range s.Size {
+		name := s.Name
+		if i > 0 {
+			name = fmt.Sprintf("%s+%d", s.Name, i)
+		}
+		if s.PRG >= 0 {
+			t.byPRG[s.PRG+i] = name
+		} else {
+			t.byAddr[s.Addr+uint16(i)] = name
+		}
+	}
+}
+
+// Label returns the label of the CPU address, prg is the offset of the
+// PRG ROM the CPU reads at the address or -1. "" is no label
+func (t *Table) Label(addr uint16, prg int) string {
+	if t == nil {
+		return ""
+	}
+	if prg >= 0 {
+		if name, ok := t.byPRG[prg]; ok {
+			return name
+		}
+	}
+	return t.byAddr[addr]
+}
+
+// Lookup returns the symbol by its name
+func (t *Table) Lookup(name string) (Symbol, bool) {
+	if t == nil {
+		return Symbol{}, false
+	}
+	i, ok := t.byName[name]
+	if !ok {
+		return Symbol{}, false
+	}
+	return t.symbols[i], true
+}
+
+// Symbols returns the symbols by their names
+func (t *Table) Symbols() []Symbol {
+	if t == nil {
+		return nil
+	}
+	symbols := slices.Clone(t.symbols)
+	slices.SortFunc(symbols, func(a, b Symbol) int { return strings.Compare(a.Name, b.Name) })
+	return symbols
+}
+
+// Len returns how many symbols the table has
+func (t *Table) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.symbols)
+}
+
+// Load adds the labels of the file to the table by its extension:
+// .nl, .mlb or .dbg
+func (t *Table) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("couldn't read the file: %s", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".nl":
+		return t.loadNL(string(data), nlBank(path))
+	case ".mlb":
+		return t.loadMLB(string(data))
+	case ".dbg":
+		return t.loadDBG(string(data))
+	}
+	return fmt.Errorf("unknown symbol file %s, it is .nl, .mlb or .dbg", filepath.Base(path))
+}
+
+// Load reads the symbol file, see Table.Load
+func Load(path string) (*Table, error) {
+	t := NewTable()
+	if err := t.Load(path); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// LoadGame reads the symbol files next to the ROM: game.nes.ram.nl and
+// game.nes.N.nl of FCEUX, game.mlb of Mesen and game.dbg of cc65. The
+// game without them has no labels
+func LoadGame(romPath string) (*Table, error) {
+	t := NewTable()
+	base := strings.TrimSuffix(romPath, filepath.Ext(romPath))
+	// the FCEUX files with the RAM file
+	paths, _ := filepath.Glob(escapeGlob(romPath) + ".*.nl")
+	paths = append(paths, base+".mlb", base+".dbg")
+	var errs []error
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := t.Load(path); err != nil {
+			errs = append(errs, fmt.Errorf("couldn't load %s: %s", filepath.Base(path), err))
+		}
+	}
+	return t, errors.Join(errs...)
+}
+
+// escapeGlob escapes the glob characters of the path
+func escapeGlob(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// nlBank returns the PRG bank of the FCEUX file game.nes.N.nl,
+// -1 for game.nes.ram.nl
+func nlBank(path string) int {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	dot := strings.LastIndexByte(name, '.')
+	if dot < 0 {
+		return -1
+	}
+	bank, err := strconv.ParseInt(name[dot+1:], 16, 32)
+	if err != nil {
+		return -1
+	}
+	return int(bank)
+}
+
+// loadNL reads the FCEUX labels, $C000#Reset#the comment or
+// $0200/100#oam# of the array. The labels of the bank files are
+// of the 16 KB bank of the PRG ROM
+func (t *Table) loadNL(data string, bank int) error {
+	for n, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !strings.HasPrefix(line, "$") {
+			continue
+		}
+		fields := strings.SplitN(line[1:], "#", 3)
+		if len(fields) < 2 {
+			return fmt.Errorf("line %d: no label", n+1)
+		}
+		addrText, sizeText, hasSize := strings.Cut(fields[0], "/")
+		addr, err := strconv.ParseUint(addrText, 16, 16)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid address %q", n+1, addrText)
+		}
+		s := Symbol{Name: fields[1], Addr: uint16(addr), PRG: -1}
+		if len(fields) == 3 {
+			s.Comment = fields[2]
+		}
+		if hasSize {
+			size, err := strconv.ParseUint(sizeText, 16, 16)
+			if err != nil {
+				return fmt.Errorf("line %d: invalid size %q", n+1, sizeText)
+			}
+			s.Size = int(size)
+		}
+		if bank >= 0 && addr >= 0x8000 {
+			s.PRG = bank*0x4000 + int(addr&0x3FFF)
+		}
+		if s.Name != "" {
+			t.Add(s)
+		}
+	}
+	return nil
+}
+
+// loadMLB reads the Mesen labels, P:1234:label:comment with the memory
+// P, R, W, S or G, or NesPrgRom, NesInternalRam, NesWorkRam, NesSaveRam
+// or NesMemory of Mesen 2, and the address or the range 0200-02FF
+func (t *Table) loadMLB(data string) error {
+	for n, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 4)
+		if len(fields) < 3 {
+			return fmt.Errorf("line %d: no label", n+1)
+		}
+		startText, endText, isRange := strings.Cut(fields[1], "-")
+		start, err := strconv.ParseUint(startText, 16, 32)
+		if err != nil {
+			return fmt.Errorf("line %d: invalid address %q", n+1, startText)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.ParseUint(endText, 16, 32); err != nil || end < start {
+				return fmt.Errorf("line %d: invalid address %q", n+1, endText)
+			}
+		}
+		s := Symbol{Name: fields[2], PRG: -1, Size: int(end - start + 1)}
+		if len(fields) == 4 {
+			s.Comment = strings.ReplaceAll(fields[3], `\n`, "\n")
+		}
+		switch fields[0] {
+		case "P", "NesPrgRom":
+			s.PRG = int(start)
+		case "R", "NesInternalRam", "G", "NesMemory":
+			s.Addr = uint16(start)
+		case "W", "S", "NesWorkRam", "NesSaveRam":
+			s.Addr = 0x6000 + uint16(start)
+		default:
+			continue // the memories of the other chips
+		}
+		if s.Name != "" {
+			t.Add(s)
+		}
+	}
+	return nil
+}
+
+// loadDBG reads the labels of the cc65 debug file, the sym lines of the
+// type lab. The labels of the segments of the ROM are of the PRG ROM
+func (t *Table) loadDBG(data string) error {
+	type segment struct {
+		start, size, offset int // offset: of the PRG ROM, -1 out of it
+	}
+	segments := map[string]segment{}
+	var syms []map[string]string
+	for n, line := range strings.Split(data, "\n") {
+		kind, rest, ok := strings.Cut(strings.TrimRight(line, "\r"), "\t")
+		if !ok || kind != "seg" && kind != "sym" {
+			continue
+		}
+		attrs, err := dbgAttributes(rest)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", n+1, err)
+		}
+		if kind == "sym" {
+			syms = append(syms, attrs)
+			continue
+		}
+		seg := segment{start: dbgNumber(attrs["start"]), size: dbgNumber(attrs["size"]), offset: -1}
+		// the offset in the file is after the header of 16 bytes
+		if ooffs, ok := attrs["ooffs"]; ok && attrs["type"] == "ro" {
+			seg.offset = dbgNumber(ooffs) - 16
+		}
+		segments[attrs["id"]] = seg
+	}
+	for _, attrs := range syms {
+		if attrs["type"] != "lab" {
+			continue
+		}
+		val := dbgNumber(attrs["val"])
+		if val < 0 || val > 0xFFFF {
+			continue
+		}
+		s := Symbol{Name: attrs["name"], Addr: uint16(val), PRG: -1, Size: dbgNumber(attrs["size"])}
+		if seg, ok := segments[attrs["seg"]]; ok && seg.offset >= 0 && val >= 0x8000 &&
+			val >= seg.start && val < seg.start+seg.size {
+			s.PRG = seg.offset + val - seg.start
+		}
+		if s.Name != "" {
+			t.Add(s)
+		}
+	}
+	return nil
+}
+
+// dbgAttributes splits the attributes, name="reset",val=0xC000
+func dbgAttributes(s string) (map[string]string, error) {
+	attrs := map[string]string{}
+	for s != "" {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid attribute %q", s)
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed quote of %s", key)
+			}
+			value, rest = rest[1:end+1], rest[end+2:]
+			rest = strings.TrimPrefix(rest, ",")
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		attrs[key] = value
+		s = rest
+	}
+	return attrs, nil
+}
+
+// dbgNumber parses the decimal or the 0x hex number, -1 if it isn't
+func dbgNumber(s string) int {
+	n, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		return -1
+	}
+	return int(n)
+}
@@ -0,0 +1,85 @@
+package symbols
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, data string) {
+	require.NoError(t, os.WriteFile(path, []byte(data), 0o644))
+}
+
+func Test_Load_NL(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "game.nes.ram.nl"), "$0010#lives#the lives left\r\n$0200/4#oam#\n")
+	writeFile(t, filepath.Join(dir, "game.nes.1.nl"), "$C010#reset#\n$C020##only a comment\n")
+
+	table, err := LoadGame(filepath.Join(dir, "game.nes"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, table.Len())
+	assert.Equal(t, "lives", table.Label(0x0010, -1))
+	assert.Equal(t, "oam+3", table.Label(0x0203, -1))
+	assert.Equal(t, "", table.Label(0x0204, -1))
+	assert.Equal(t, "reset", table.Label(0xC010, 0x4010), "the bank 1 of the PRG ROM")
+	assert.Equal(t, "", table.Label(0xC010, 0x0010), "the other bank")
+
+	sym, ok := table.Lookup("lives")
+	require.True(t, ok)
+	assert.Equal(t, Symbol{Name: "lives", Addr: 0x10, PRG: -1, Size: 1, Comment: "the lives left"}, sym)
+}
+
+func Test_Load_MLB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.mlb")
+	writeFile(t, path, "P:0010:reset:the entry\\nof the game\nR:0300-0303:buffer\nW:0000:save\nG:2000:PPUCTRL\nNesPrgRom:0020:nmi\nX:0000:other\n")
+
+	table, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "reset", table.Label(0x8010, 0x0010))
+	assert.Equal(t, "nmi", table.Label(0x8020, 0x0020))
+	assert.Equal(t, "buffer+2", table.Label(0x0302, -1))
+	assert.Equal(t, "save", table.Label(0x6000, -1))
+	assert.Equal(t, "PPUCTRL", table.Label(0x2000, -1))
+	sym, _ := table.Lookup("reset")
+	assert.Equal(t, "the entry\nof the game", sym.Comment)
+	assert.Equal(t, 5, table.Len())
+
+	writeFile(t, path, "P:zz:reset\n")
+	_, err = Load(path)
+	assert.Error(t, err)
+}
+
+func Test_Load_DBG(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.dbg")
+	writeFile(t, path, `version	major=2,minor=0
+seg	id=0,name="ZEROPAGE",start=0x000000,size=0x0010,addrsize=zeropage,type=rw
+seg	id=1,name="CODE",start=0x00C000,size=0x0100,addrsize=absolute,type=ro,oname="game.nes",ooffs=16400
+sym	id=0,name="lives",addrsize=zeropage,size=1,scope=0,def=1,val=0x10,seg=0,type=lab
+sym	id=1,name="reset_handler",addrsize=absolute,scope=0,def=2,ref=3,val=0xC004,seg=1,type=lab
+sym	id=2,name="PPUCTRL",addrsize=absolute,scope=0,def=4,val=0x2000,type=equ
+`)
+	table, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, table.Len(), "the equates aren't labels")
+	assert.Equal(t, "lives", table.Label(0x10, -1))
+	sym, ok := table.Lookup("reset_handler")
+	require.True(t, ok)
+	assert.Equal(t, 0x4004, sym.PRG, "the offset in the file after the header")
+}
+
+func Test_Load_Unknown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.sym")
+	writeFile(t, path, "")
+	_, err := Load(path)
+	assert.Error(t, err)
+
+	table, err := LoadGame(filepath.Join(t.TempDir(), "game.nes"))
+	require.NoError(t, err, "no symbol files")
+	assert.Zero(t, table.Len())
+
+	var none *Table
+	assert.Equal(t, "", none.Label(0, -1))
+}